@@ -0,0 +1,180 @@
+package dmr
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxID is the largest 24-bit subscriber or talkgroup ID.
+const MaxID = 0xffffff
+
+// ACL is an access control list of source and destination ID rules. Rules are
+// evaluated in the order they were added, the first matching rule decides, if
+// no rule matches the default applies.
+type ACL struct {
+	mutex        *sync.RWMutex
+	rules        []aclRule
+	defaultAllow bool
+}
+
+type aclRule struct {
+	srcMin, srcMax uint32
+	dstMin, dstMax uint32
+	allow          bool
+}
+
+func (r aclRule) match(srcID, dstID uint32) bool {
+	return srcID >= r.srcMin && srcID <= r.srcMax && dstID >= r.dstMin && dstID <= r.dstMax
+}
+
+// NewACL returns an empty access control list, defaultAllow sets whether
+// packets that match none of the rules are allowed or denied.
+func NewACL(defaultAllow bool) *ACL {
+	return &ACL{
+		mutex:        &sync.RWMutex{},
+		defaultAllow: defaultAllow,
+	}
+}
+
+// Allow allows packets from srcID to dstID, an ID of 0 matches any ID.
+func (acl *ACL) Allow(srcID, dstID uint32) {
+	acl.add(idRange(srcID), idRange(dstID), true)
+}
+
+// Deny denies packets from srcID to dstID, an ID of 0 matches any ID.
+func (acl *ACL) Deny(srcID, dstID uint32) {
+	acl.add(idRange(srcID), idRange(dstID), false)
+}
+
+// AllowRange allows packets from source IDs srcMin to srcMax to destination
+// IDs dstMin to dstMax, inclusive.
+func (acl *ACL) AllowRange(srcMin, srcMax, dstMin, dstMax uint32) {
+	acl.add([2]uint32{srcMin, srcMax}, [2]uint32{dstMin, dstMax}, true)
+}
+
+// DenyRange denies packets from source IDs srcMin to srcMax to destination
+// IDs dstMin to dstMax, inclusive.
+func (acl *ACL) DenyRange(srcMin, srcMax, dstMin, dstMax uint32) {
+	acl.add([2]uint32{srcMin, srcMax}, [2]uint32{dstMin, dstMax}, false)
+}
+
+func (acl *ACL) add(src, dst [2]uint32, allow bool) {
+	acl.mutex.Lock()
+	defer acl.mutex.Unlock()
+	acl.rules = append(acl.rules, aclRule{
+		srcMin: src[0], srcMax: src[1],
+		dstMin: dst[0], dstMax: dst[1],
+		allow: allow,
+	})
+}
+
+func idRange(id uint32) [2]uint32 {
+	if id == 0 {
+		return [2]uint32{0, MaxID}
+	}
+	return [2]uint32{id, id}
+}
+
+// Check returns true if the packet is allowed.
+func (acl *ACL) Check(p *Packet) bool {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+
+	for _, rule := range acl.rules {
+		if rule.match(p.SrcID, p.DstID) {
+			return rule.allow
+		}
+	}
+	return acl.defaultAllow
+}
+
+// Middleware returns a PacketMiddleware dropping the packets denied by the ACL.
+func (acl *ACL) Middleware() PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		if acl.Check(p) {
+			next(p)
+		}
+	}
+}
+
+// LoadFile adds the rules from a CSV file. Each record has an action, allow
+// or deny, a source and a destination, where an ID is either a single ID, a
+// range min-max or * for any ID. Lines starting with # are ignored.
+//
+//	# action,source,destination
+//	deny,2042214,*
+//	allow,2040000-2049999,204
+func (acl *ACL) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return acl.Load(f)
+}
+
+// Load adds the rules from CSV formatted data, see LoadFile. No rules are
+// added if any of the records is invalid.
+func (acl *ACL) Load(r io.Reader) error {
+	var cr = csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return fmt.Errorf("dmr/acl: %v", err)
+	}
+
+	var rules = make([]aclRule, 0, len(records))
+	for i, record := range records {
+		var rule aclRule
+		switch strings.ToLower(record[0]) {
+		case "allow":
+			rule.allow = true
+			break
+		case "deny":
+			break
+		default:
+			return fmt.Errorf("dmr/acl: record %d: unknown action %q", i+1, record[0])
+		}
+		if rule.srcMin, rule.srcMax, err = parseIDRange(record[1]); err != nil {
+			return fmt.Errorf("dmr/acl: record %d: %v", i+1, err)
+		}
+		if rule.dstMin, rule.dstMax, err = parseIDRange(record[2]); err != nil {
+			return fmt.Errorf("dmr/acl: record %d: %v", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	acl.mutex.Lock()
+	defer acl.mutex.Unlock()
+	acl.rules = append(acl.rules, rules...)
+	return nil
+}
+
+func parseIDRange(s string) (uint32, uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return 0, MaxID, nil
+	}
+
+	var part = strings.SplitN(s, "-", 2)
+	min, err := strconv.ParseUint(strings.TrimSpace(part[0]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ID %q", s)
+	}
+	if len(part) == 1 {
+		return uint32(min), uint32(min), nil
+	}
+	max, err := strconv.ParseUint(strings.TrimSpace(part[1]), 10, 32)
+	if err != nil || max < min {
+		return 0, 0, fmt.Errorf("invalid ID range %q", s)
+	}
+	return uint32(min), uint32(max), nil
+}
@@ -0,0 +1,90 @@
+package dmr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	var acl = NewACL(true)
+	acl.Allow(2042214, 91)
+	acl.Deny(2042214, 0)
+	acl.DenyRange(2040000, 2049999, 1, 99)
+
+	var tests = []struct {
+		SrcID, DstID uint32
+		Want         bool
+	}{
+		{2042214, 91, true},   // first rule
+		{2042214, 204, false}, // second rule, any destination
+		{2043044, 91, false},  // range
+		{2043044, 204, true},  // default
+		{3104, 91, true},      // default
+		{2040000, 1, false},   // range lower bound
+		{2049999, 99, false},  // range upper bound
+		{2050000, 99, true},   // outside range
+	}
+	for _, test := range tests {
+		p := &Packet{SrcID: test.SrcID, DstID: test.DstID}
+		if got := acl.Check(p); got != test.Want {
+			t.Fatalf("check %d->%d failed: expected %t, got %t", test.SrcID, test.DstID, test.Want, got)
+		}
+	}
+
+	var passed bool
+	acl.Middleware()(&Packet{SrcID: 2042214, DstID: 204}, func(*Packet) { passed = true })
+	if passed {
+		t.Fatal("denied packet was passed")
+	}
+
+	acl = NewACL(false)
+	acl.AllowRange(2040000, 2049999, 0, MaxID)
+	if acl.Check(&Packet{SrcID: 3104, DstID: 91}) {
+		t.Fatal("default deny failed")
+	}
+	if !acl.Check(&Packet{SrcID: 2042214, DstID: 91}) {
+		t.Fatal("allow range failed")
+	}
+}
+
+func TestACLLoadFile(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "acl.csv")
+	if err := os.WriteFile(path, []byte(`# action,source,destination
+allow, 2042214, 91
+deny,2042214,*
+deny,2040000-2049999,1-99
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var acl = NewACL(true)
+	if err := acl.LoadFile(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	switch {
+	case !acl.Check(&Packet{SrcID: 2042214, DstID: 91}):
+		t.Fatal("load failed: allow rule")
+	case acl.Check(&Packet{SrcID: 2042214, DstID: 204}):
+		t.Fatal("load failed: deny rule")
+	case acl.Check(&Packet{SrcID: 2043044, DstID: 9}):
+		t.Fatal("load failed: deny range rule")
+	case !acl.Check(&Packet{SrcID: 2043044, DstID: 204}):
+		t.Fatal("load failed: default")
+	}
+
+	for _, data := range []string{
+		"block,1,2\n",
+		"allow,1\n",
+		"allow,x,2\n",
+		"allow,9-1,2\n",
+	} {
+		if err := NewACL(true).Load(strings.NewReader(data)); err == nil {
+			t.Fatalf("load %q succeeded, expected an error", data)
+		}
+	}
+	if err := acl.LoadFile(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Fatal("load of missing file succeeded")
+	}
+}
@@ -0,0 +1,183 @@
+package dmr
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/fec/golay"
+)
+
+// AMBE+2 voice frame sizes.
+const (
+	AMBEFrameBits  = 72 // Frame bits in a voice burst, with FEC
+	AMBEDataBits   = 49 // Frame bits after FEC decoding
+	AMBEBurstFrame = 3  // Frames in a voice burst
+
+	AMBEFrameSamples = 160 // PCM samples per frame, 20 ms at 8 kHz
+)
+
+// VoiceCodec transcodes between AMBE+2 frames and PCM audio, for example
+// with a DV3000 or a software vocoder. The AMBE+2 frame is the 72 bit frame
+// with FEC as carried in a voice burst, packed to 9 bytes. The PCM audio is
+// 16 bit signed samples at 8 kHz, AMBEFrameSamples per frame.
+type VoiceCodec interface {
+	Decode(ambe []byte) (pcm []int16, err error)
+	Encode(pcm []int16) (ambe []byte, err error)
+}
+
+// DecodeVoiceBurst decodes the three AMBE+2 frames of a voice burst with the
+// codec and returns the PCM audio of the burst.
+func DecodeVoiceBurst(codec VoiceCodec, p *Packet) ([]int16, error) {
+	if len(p.Bits) < PayloadBits {
+		return nil, fmt.Errorf("dmr/ambe: expected %d payload bits, got %d", PayloadBits, len(p.Bits))
+	}
+	frames, err := SplitAMBEFrames(p.VoiceBits())
+	if err != nil {
+		return nil, err
+	}
+	var pcm = make([]int16, 0, AMBEBurstFrame*AMBEFrameSamples)
+	for _, frame := range frames {
+		samples, err := codec.Decode(BitsToBytes(frame))
+		if err != nil {
+			return nil, err
+		}
+		pcm = append(pcm, samples...)
+	}
+	return pcm, nil
+}
+
+// Bit positions of the Golay(24, 12) protected C0, the Golay(23, 12)
+// protected C1 and the unprotected C2 and C3 in an interleaved 72 bit AMBE+2
+// frame, most significant bit first.
+var (
+	ambeA = [24]int{0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 60, 64, 68, 1, 5, 9, 13, 17, 21}
+	ambeB = [23]int{25, 29, 33, 37, 41, 45, 49, 53, 57, 61, 65, 69, 2, 6, 10, 14, 18, 22, 26, 30, 34, 38, 42}
+	ambeC = [25]int{46, 50, 54, 58, 62, 66, 70, 3, 7, 11, 15, 19, 23, 27, 31, 35, 39, 43, 47, 51, 55, 59, 63, 67, 71}
+)
+
+// ExtractVoiceBits returns the 216 voice bits of a voice burst payload,
+// without the sync or EMB and embedded signalling in the center.
+func ExtractVoiceBits(payload []byte) ([]byte, error) {
+	if len(payload) != PayloadBits {
+		return nil, fmt.Errorf("dmr/ambe: expected %d payload bits, got %d", PayloadBits, len(payload))
+	}
+	var bits = make([]byte, VoiceBits)
+	copy(bits[:VoiceHalfBits], payload[:VoiceHalfBits])
+	copy(bits[VoiceHalfBits:], payload[VoiceHalfBits+SignalBits:])
+	return bits, nil
+}
+
+// BuildVoiceBurst builds a voice burst payload from the three 72 bit AMBE+2
+// frames around the 48 center bits, which are either a voice sync or the EMB
+// with an embedded signalling fragment.
+func BuildVoiceBurst(frames [AMBEBurstFrame][]byte, center []byte) ([]byte, error) {
+	if len(center) != SignalBits {
+		return nil, fmt.Errorf("dmr/ambe: expected %d center bits, got %d", SignalBits, len(center))
+	}
+	var voice = make([]byte, 0, VoiceBits)
+	for _, frame := range frames {
+		if len(frame) != AMBEFrameBits {
+			return nil, fmt.Errorf("dmr/ambe: expected %d frame bits, got %d", AMBEFrameBits, len(frame))
+		}
+		voice = append(voice, frame...)
+	}
+
+	var payload = make([]byte, PayloadBits)
+	copy(payload[:VoiceHalfBits], voice[:VoiceHalfBits])
+	copy(payload[VoiceHalfBits:], center)
+	copy(payload[VoiceHalfBits+SignalBits:], voice[VoiceHalfBits:])
+	return payload, nil
+}
+
+// SplitAMBEFrames splits the 216 voice bits in the three 72 bit AMBE+2 frames.
+func SplitAMBEFrames(voice []byte) ([AMBEBurstFrame][]byte, error) {
+	var frames [AMBEBurstFrame][]byte
+	if len(voice) != VoiceBits {
+		return frames, fmt.Errorf("dmr/ambe: expected %d voice bits, got %d", VoiceBits, len(voice))
+	}
+	for i := range frames {
+		frames[i] = voice[i*AMBEFrameBits : (i+1)*AMBEFrameBits]
+	}
+	return frames, nil
+}
+
+// DecodeAMBEFrame corrects a 72 bit AMBE+2 frame and returns the 49 voice
+// parameter bits and the number of corrected bits.
+func DecodeAMBEFrame(frame []byte) ([]byte, int, error) {
+	if len(frame) != AMBEFrameBits {
+		return nil, -1, fmt.Errorf("dmr/ambe: expected %d frame bits, got %d", AMBEFrameBits, len(frame))
+	}
+
+	var a, b uint32
+	for _, i := range ambeA {
+		a = a<<1 | uint32(frame[i])
+	}
+	for _, i := range ambeB {
+		b = b<<1 | uint32(frame[i])
+	}
+
+	c0, errsA, err := golay.Decode24_12(a)
+	if err != nil {
+		return nil, -1, err
+	}
+	c1, errsB := golay.Decode23_12(b ^ ambeScramble(c0))
+
+	var bits = make([]byte, 0, AMBEDataBits)
+	bits = appendBits(bits, uint32(c0), 12)
+	bits = appendBits(bits, uint32(c1), 12)
+	for _, i := range ambeC {
+		bits = append(bits, frame[i])
+	}
+	return bits, errsA + errsB, nil
+}
+
+// EncodeAMBEFrame encodes 49 voice parameter bits to a 72 bit AMBE+2 frame.
+func EncodeAMBEFrame(bits []byte) ([]byte, error) {
+	if len(bits) != AMBEDataBits {
+		return nil, fmt.Errorf("dmr/ambe: expected %d data bits, got %d", AMBEDataBits, len(bits))
+	}
+
+	var c0, c1 uint16
+	for _, bit := range bits[:12] {
+		c0 = c0<<1 | uint16(bit)
+	}
+	for _, bit := range bits[12:24] {
+		c1 = c1<<1 | uint16(bit)
+	}
+
+	var (
+		frame = make([]byte, AMBEFrameBits)
+		a     = golay.Encode24_12(c0)
+		b     = golay.Encode23_12(c1) ^ ambeScramble(c0)
+	)
+	for j, i := range ambeA {
+		frame[i] = uint8(a>>uint(23-j)) & 0x01
+	}
+	for j, i := range ambeB {
+		frame[i] = uint8(b>>uint(22-j)) & 0x01
+	}
+	for j, i := range ambeC {
+		frame[i] = bits[24+j]
+	}
+	return frame, nil
+}
+
+// ambeScramble returns the 23 bit pseudo random sequence seeded by the C0
+// data bits, which scrambles C1.
+func ambeScramble(c0 uint16) uint32 {
+	var (
+		pr  = uint32(c0) << 4
+		seq uint32
+	)
+	for i := 0; i < 23; i++ {
+		pr = (173*pr + 13849) & 0xffff
+		seq = seq<<1 | pr>>15
+	}
+	return seq
+}
+
+func appendBits(bits []byte, v uint32, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		bits = append(bits, uint8(v>>uint(i))&0x01)
+	}
+	return bits
+}
@@ -0,0 +1,144 @@
+package dmr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Voice burst A with the AMBE+2 silence frame, as sent by MMDVM repeaters.
+const testSilenceBurst = "b9e881526173002a6bb9e881526755fd7df75f7173002a6bb9e881526173002a6b"
+
+var (
+	testSilenceFrame = []byte{0xb9, 0xe8, 0x81, 0x52, 0x61, 0x73, 0x00, 0x2a, 0x6b}
+	testSilenceData  = []byte{0xf8, 0x01, 0xa9, 0x9f, 0x8c, 0xe0, 0x80} // 49 bits, zero padded
+)
+
+func TestAMBEVoiceBurst(t *testing.T) {
+	burst, _ := hex.DecodeString(testSilenceBurst)
+	payload := BytesToBits(burst)
+
+	voice, err := ExtractVoiceBits(payload)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	frames, err := SplitAMBEFrames(voice)
+	if err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	for i, frame := range frames {
+		if !bytes.Equal(BitsToBytes(frame), testSilenceFrame) {
+			t.Fatalf("split failed: frame %d is %x, expected %x", i, BitsToBytes(frame), testSilenceFrame)
+		}
+		data, errs, err := DecodeAMBEFrame(frame)
+		switch {
+		case err != nil:
+			t.Fatalf("decode frame %d failed: %v", i, err)
+		case errs != 0:
+			t.Fatalf("decode frame %d failed: corrected %d bits in a clean frame", i, errs)
+		case !bytes.Equal(BitsToBytes(append(data, make([]byte, 7)...)), testSilenceData):
+			t.Fatalf("decode frame %d failed: got %x, expected %x", i, BitsToBytes(append(data, make([]byte, 7)...)), testSilenceData)
+		}
+	}
+
+	test, err := BuildVoiceBurst(frames, SyncPatternBits(SyncPatternBSSourcedVoice))
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if !bytes.Equal(test, payload) {
+		t.Fatalf("build failed: got %x, expected %s", BitsToBytes(test), testSilenceBurst)
+	}
+}
+
+func TestAMBEFrame(t *testing.T) {
+	var data = make([]byte, AMBEDataBits)
+	for i := range data {
+		data[i] = uint8(i*7/3) & 0x01
+	}
+	frame, err := EncodeAMBEFrame(data)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	// Up to 3 bit errors in C0 and in C1 are corrected
+	for _, flip := range [][]int{
+		{},
+		{ambeA[0]},
+		{ambeA[3], ambeA[10], ambeA[23]},
+		{ambeB[0], ambeB[12], ambeB[22]},
+		{ambeA[1], ambeA[2], ambeB[5], ambeB[6], ambeB[7]},
+	} {
+		var test = make([]byte, AMBEFrameBits)
+		copy(test, frame)
+		for _, i := range flip {
+			test[i] ^= 1
+		}
+		got, errs, err := DecodeAMBEFrame(test)
+		switch {
+		case err != nil:
+			t.Fatalf("decode with %d errors failed: %v", len(flip), err)
+		case errs != len(flip):
+			t.Fatalf("decode with %d errors failed: corrected %d bits", len(flip), errs)
+		case !bytes.Equal(got, data):
+			t.Fatalf("decode with %d errors failed: got %v, expected %v", len(flip), got, data)
+		}
+	}
+
+	// 4 bit errors in C0 are detected
+	var test = make([]byte, AMBEFrameBits)
+	copy(test, frame)
+	for _, i := range ambeA[:4] {
+		test[i] ^= 1
+	}
+	if _, _, err := DecodeAMBEFrame(test); err == nil {
+		t.Fatal("decode with 4 errors in C0 succeeded, expected an error")
+	}
+}
+
+// testCodec decodes each frame to samples holding the first byte of the frame.
+type testCodec struct {
+	frames [][]byte
+}
+
+func (c *testCodec) Decode(ambe []byte) ([]int16, error) {
+	c.frames = append(c.frames, ambe)
+	var pcm = make([]int16, AMBEFrameSamples)
+	for i := range pcm {
+		pcm[i] = int16(ambe[0])
+	}
+	return pcm, nil
+}
+
+func (c *testCodec) Encode(pcm []int16) ([]byte, error) {
+	return nil, nil
+}
+
+func TestDecodeVoiceBurst(t *testing.T) {
+	burst, _ := hex.DecodeString(testSilenceBurst)
+	var (
+		codec = &testCodec{}
+		p     = &Packet{DataType: VoiceBurstA}
+	)
+	p.SetData(burst)
+
+	pcm, err := DecodeVoiceBurst(codec, p)
+	switch {
+	case err != nil:
+		t.Fatalf("decode failed: %v", err)
+	case len(codec.frames) != AMBEBurstFrame:
+		t.Fatalf("expected %d frames decoded, got %d", AMBEBurstFrame, len(codec.frames))
+	case len(pcm) != AMBEBurstFrame*AMBEFrameSamples:
+		t.Fatalf("expected %d samples, got %d", AMBEBurstFrame*AMBEFrameSamples, len(pcm))
+	case pcm[0] != 0xb9:
+		t.Fatalf("expected sample 0xb9, got %#x", pcm[0])
+	}
+	for i, frame := range codec.frames {
+		if !bytes.Equal(frame, testSilenceFrame) {
+			t.Fatalf("frame %d is %x, expected %x", i, frame, testSilenceFrame)
+		}
+	}
+
+	if _, err := DecodeVoiceBurst(codec, &Packet{DataType: VoiceBurstA}); err == nil {
+		t.Fatal("decode of empty burst succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package dmr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AMBMagic starts a .amb file, the container of AMBE+2 voice parameters
+// written by DSD and read by mbelib based decoders and the md380tools. Each
+// frame in the file is the number of corrected bits, the first 48 voice
+// parameter bits in 6 bytes and the last bit in a byte.
+var AMBMagic = []byte(".amb")
+
+// AMBFrameSize is the size of a frame in a .amb file.
+const AMBFrameSize = 8
+
+// ambeSilence is the 72 bit AMBE+2 silence frame.
+var ambeSilence = []byte{0xb9, 0xe8, 0x81, 0x52, 0x61, 0x73, 0x00, 0x2a, 0x6b}
+
+// AppendAMBFrame appends the 49 voice parameter bits of an AMBE+2 frame with
+// the number of corrected bits to a .amb file.
+func AppendAMBFrame(data, bits []byte, errs int) ([]byte, error) {
+	if len(bits) != AMBEDataBits {
+		return data, fmt.Errorf("dmr/ambe: expected %d data bits, got %d", AMBEDataBits, len(bits))
+	}
+	if errs > 0xff {
+		errs = 0xff
+	}
+	data = append(data, byte(errs))
+	data = append(data, BitsToBytes(bits[:48])...)
+	return append(data, bits[48]), nil
+}
+
+// AMBRecorder writes each voice call to a .amb file in Dir, named after the
+// start time, source, destination and timeslot of the call, for example
+// 20160102T120000Z_2042214_204_TS2.amb. Frames lost in transit or that
+// can't be corrected are written as silence, to keep the timing of the call.
+type AMBRecorder struct {
+	Dir string
+
+	// OnWrite is called after the file of a call was written, or failed to
+	// be written.
+	OnWrite func(path string, err error)
+
+	vs    *VoiceStream
+	mutex *sync.Mutex
+	calls map[uint32]*ambCall
+	now   func() time.Time
+}
+
+type ambCall struct {
+	name     string
+	sequence sequence
+	data     []byte
+}
+
+// NewAMBRecorder returns a recorder writing to dir.
+func NewAMBRecorder(dir string) *AMBRecorder {
+	var r = &AMBRecorder{
+		Dir:   dir,
+		vs:    NewVoiceStream(),
+		mutex: &sync.Mutex{},
+		calls: make(map[uint32]*ambCall),
+		now:   time.Now,
+	}
+	r.vs.OnCallStart = r.CallStart
+	r.vs.OnVoiceFrame = r.VoiceFrame
+	r.vs.OnCallEnd = r.CallEnd
+	return r
+}
+
+// PacketFunc can be installed as the PacketFunc of a Repeater.
+func (r *AMBRecorder) PacketFunc(_ Repeater, p *Packet) error {
+	r.AddPacket(p)
+	return nil
+}
+
+// Middleware records the voice calls of the packets it passes on.
+func (r *AMBRecorder) Middleware() PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		r.AddPacket(p)
+		next(p)
+	}
+}
+
+// AddPacket processes a packet, packets that are not part of a voice call
+// are ignored.
+func (r *AMBRecorder) AddPacket(p *Packet) {
+	r.vs.AddPacket(p)
+}
+
+// CallStart starts the file of a call, CallStart, VoiceFrame and CallEnd can
+// be installed as the callbacks of a VoiceStream instead of passing packets to
+// the recorder.
+func (r *AMBRecorder) CallStart(p *Packet) {
+	var call = &ambCall{
+		name: fmt.Sprintf("%s_%d_%d_TS%d.amb",
+			r.now().UTC().Format("20060102T150405Z"), p.SrcID, p.DstID, p.Timeslot+1),
+		data: append([]byte{}, AMBMagic...),
+	}
+	r.mutex.Lock()
+	r.calls[p.StreamID] = call
+	r.mutex.Unlock()
+}
+
+// VoiceFrame adds the AMBE+2 frames of a voice burst to the file of its call.
+func (r *AMBRecorder) VoiceFrame(p *Packet, _ byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	call, ok := r.calls[p.StreamID]
+	if !ok {
+		return
+	}
+
+	_, lost, _ := call.sequence.check(p)
+	for i := 0; i < lost*AMBEBurstFrame; i++ {
+		call.data = appendAMBSilence(call.data)
+	}
+
+	if len(p.Bits) < PayloadBits {
+		for i := 0; i < AMBEBurstFrame; i++ {
+			call.data = appendAMBSilence(call.data)
+		}
+		return
+	}
+	frames, _ := SplitAMBEFrames(p.VoiceBits())
+	for _, frame := range frames {
+		bits, errs, err := DecodeAMBEFrame(frame)
+		if err != nil {
+			call.data = appendAMBSilence(call.data)
+			continue
+		}
+		call.data, _ = AppendAMBFrame(call.data, bits, errs)
+	}
+}
+
+// CallEnd writes the file of the call.
+func (r *AMBRecorder) CallEnd(streamID uint32, _ time.Duration) {
+	r.mutex.Lock()
+	call, ok := r.calls[streamID]
+	delete(r.calls, streamID)
+	r.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	var (
+		path = filepath.Join(r.Dir, call.name)
+		err  = os.WriteFile(path, call.data, 0644)
+	)
+	if r.OnWrite != nil {
+		r.OnWrite(path, err)
+	}
+}
+
+func appendAMBSilence(data []byte) []byte {
+	bits, _, _ := DecodeAMBEFrame(BytesToBits(ambeSilence)[:AMBEFrameBits])
+	data, _ = AppendAMBFrame(data, bits, 0)
+	return data
+}
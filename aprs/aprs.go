@@ -0,0 +1,233 @@
+// Package aprs forwards DMR GPS positions to APRS-IS
+package aprs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// Defaults for a new Gateway.
+const (
+	DefaultAddr              = "rotate.aprs2.net:14580"
+	DefaultReconnectInterval = time.Second * 5
+	DefaultQueueSize         = 64
+)
+
+// Passcode returns the APRS-IS passcode of the callsign, the SSID is ignored.
+func Passcode(callsign string) int {
+	if i := strings.IndexByte(callsign, '-'); i >= 0 {
+		callsign = callsign[:i]
+	}
+	callsign = strings.ToUpper(callsign)
+
+	var hash = 0x73e2
+	for i := 0; i < len(callsign); i += 2 {
+		hash ^= int(callsign[i]) << 8
+		if i+1 < len(callsign) {
+			hash ^= int(callsign[i+1])
+		}
+	}
+	return hash & 0x7fff
+}
+
+// Gateway keeps a connection to an APRS-IS server and forwards GPS info LCs
+// as position reports. If the connection drops, the gateway reconnects every
+// ReconnectInterval.
+type Gateway struct {
+	// Addr is the host:port of the APRS-IS server.
+	Addr string
+	// Callsign and Passcode are used to log in.
+	Callsign string
+	Passcode int
+	// Filter is sent in the login line, if not empty.
+	Filter string
+	// ReconnectInterval is the time between connection attempts.
+	ReconnectInterval time.Duration
+	// Lookup returns the APRS callsign for a DMR ID, positions from IDs
+	// without callsign are dropped.
+	Lookup func(id uint32) (string, bool)
+
+	// Logger receives the log messages, if nil slog.Default() is used.
+	Logger *slog.Logger
+
+	queue     chan string
+	stop      chan struct{}
+	closeOnce *sync.Once
+	mutex     *sync.Mutex
+	conn      net.Conn
+	emb       *dmr.EMBReassembler
+	srcID     uint32 // Source of the packet passed to emb
+}
+
+// NewGateway returns a gateway logging in to the server at addr.
+func NewGateway(addr, callsign string, passcode int) *Gateway {
+	var g = &Gateway{
+		Addr:              addr,
+		Callsign:          callsign,
+		Passcode:          passcode,
+		ReconnectInterval: DefaultReconnectInterval,
+		queue:             make(chan string, DefaultQueueSize),
+		stop:              make(chan struct{}),
+		closeOnce:         &sync.Once{},
+		mutex:             &sync.Mutex{},
+	}
+	g.emb = dmr.NewEMBReassembler(g.onLC)
+	return g
+}
+
+// logger returns the configured logger, or the default logger.
+func (g *Gateway) logger() *slog.Logger {
+	if g.Logger != nil {
+		return g.Logger
+	}
+	return slog.Default()
+}
+
+// Start connects to the server in the background.
+func (g *Gateway) Start() {
+	go g.run()
+}
+
+// Close stops the gateway and closes the connection.
+func (g *Gateway) Close() error {
+	g.closeOnce.Do(func() { close(g.stop) })
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.conn != nil {
+		return g.conn.Close()
+	}
+	return nil
+}
+
+// Send queues a position report of the callsign. Reports are dropped if the
+// queue is full.
+func (g *Gateway) Send(callsign string, info *dmr.GPSInfoLC) error {
+	if info == nil {
+		return errors.New("aprs: info can't be nil")
+	}
+	select {
+	case g.queue <- info.ToAPRS(callsign):
+		return nil
+	default:
+		return errors.New("aprs: queue full")
+	}
+}
+
+// Middleware returns a PacketMiddleware that forwards the GPS info embedded in
+// voice calls. Packets are passed on unmodified.
+func (g *Gateway) Middleware() dmr.PacketMiddleware {
+	return func(p *dmr.Packet, next func(*dmr.Packet)) {
+		g.mutex.Lock()
+		g.srcID = p.SrcID
+		if err := g.emb.AddPacket(p); err != nil {
+			g.logger().Debug("embedded LC error", "stream", p.StreamID, "error", err)
+		}
+		g.mutex.Unlock()
+
+		next(p)
+	}
+}
+
+// onLC is called by the EMB reassembler, with the mutex held.
+func (g *Gateway) onLC(streamID uint32, lc *dmr.LC) {
+	info, ok := lc.Data.(*dmr.GPSInfoLC)
+	if !ok || g.Lookup == nil {
+		return
+	}
+	callsign, ok := g.Lookup(g.srcID)
+	if !ok {
+		return
+	}
+	if err := g.Send(callsign, info); err != nil {
+		g.logger().Error("position dropped", "src", g.srcID, "error", err)
+	}
+}
+
+func (g *Gateway) run() {
+	for {
+		if err := g.serve(); err != nil {
+			g.logger().Error("APRS-IS connection failed; retrying", "addr", g.Addr, "error", err)
+		}
+
+		var interval = g.ReconnectInterval
+		if interval <= 0 {
+			interval = DefaultReconnectInterval
+		}
+		select {
+		case <-g.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// serve logs in and writes queued reports until the connection fails or the
+// gateway is closed.
+func (g *Gateway) serve() error {
+	conn, err := net.Dial("tcp", g.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	g.mutex.Lock()
+	select {
+	case <-g.stop:
+		g.mutex.Unlock()
+		return nil
+	default:
+	}
+	g.conn = conn
+	g.mutex.Unlock()
+
+	if _, err = conn.Write([]byte(g.login())); err != nil {
+		return err
+	}
+	g.logger().Info("connected to APRS-IS", "addr", g.Addr)
+
+	// The server sends comments and, depending on the filter, packets,
+	// reading detects a closed connection.
+	var readErr = make(chan error, 1)
+	go func() {
+		var scanner = bufio.NewScanner(conn)
+		for scanner.Scan() {
+			g.logger().Debug("APRS-IS", "line", scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			readErr <- err
+		} else {
+			readErr <- errors.New("connection closed by server")
+		}
+	}()
+
+	for {
+		select {
+		case report := <-g.queue:
+			if _, err = conn.Write([]byte(report + "\r\n")); err != nil {
+				return err
+			}
+		case err = <-readErr:
+			return err
+		case <-g.stop:
+			return nil
+		}
+	}
+}
+
+func (g *Gateway) login() string {
+	var line = fmt.Sprintf("user %s pass %s vers go-dmr %s", g.Callsign, strconv.Itoa(g.Passcode), dmr.Version)
+	if g.Filter != "" {
+		line += " filter " + g.Filter
+	}
+	return line + "\r\n"
+}
@@ -0,0 +1,112 @@
+package aprs
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestPasscode(t *testing.T) {
+	for callsign, want := range map[string]int{
+		"N0CALL":    13023,
+		"n0call-10": 13023,
+	} {
+		if got := Passcode(callsign); got != want {
+			t.Fatalf("passcode %s failed: got %d, expected %d", callsign, got, want)
+		}
+	}
+}
+
+func accept(t *testing.T, l net.Listener) (net.Conn, *bufio.Reader, string) {
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second * 2))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second * 2))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read login failed: %v", err)
+	}
+	return conn, r, line
+}
+
+func TestGateway(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var g = NewGateway(l.Addr().String(), "PD0MZ", Passcode("PD0MZ"))
+	g.Filter = "r/52.4/4.9/50"
+	g.ReconnectInterval = time.Millisecond * 10
+	g.Lookup = func(id uint32) (string, bool) { return "PD0MZ-9", id == 2042214 }
+	g.Start()
+	defer g.Close()
+
+	conn, r, login := accept(t, l)
+	if want := "user PD0MZ pass 18923 vers go-dmr " + dmr.Version + " filter r/52.4/4.9/50\r\n"; login != want {
+		t.Fatalf("login failed: got %q, expected %q", login, want)
+	}
+
+	var info = &dmr.GPSInfoLC{Latitude: 52.3676, Longitude: 4.9041}
+	if err := g.Send("PD0MZ-9", info); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if want := info.ToAPRS("PD0MZ-9") + "\r\n"; line != want {
+		t.Fatalf("send failed: got %q, expected %q", line, want)
+	}
+
+	// The gateway reconnects after the server closed the connection
+	conn.Close()
+	conn, r, login = accept(t, l)
+	defer conn.Close()
+	if !strings.HasPrefix(login, "user PD0MZ ") {
+		t.Fatalf("reconnect failed: got %q", login)
+	}
+
+	// GPS info embedded in a voice call is forwarded
+	lc := &dmr.LC{Opcode: dmr.GPSInfo, Data: info}
+	fragments, err := dmr.BuildEmbeddedLCFragments(lc)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	var (
+		mw     = g.Middleware()
+		passed int
+		lcss   = []uint8{dmr.FirstFragment, dmr.Continuation, dmr.Continuation, dmr.LastFragment}
+	)
+	for i, fragment := range fragments {
+		emb, err := dmr.BuildEMB(&dmr.EMB{ColorCode: 1, LCSS: lcss[i]})
+		if err != nil {
+			t.Fatalf("encode emb failed: %v", err)
+		}
+		sync, err := dmr.BuildSyncBitsFromEMB(emb, fragment)
+		if err != nil {
+			t.Fatalf("encode sync failed: %v", err)
+		}
+		p := &dmr.Packet{SrcID: 2042214, StreamID: 1, DataType: dmr.VoiceBurstB + uint8(i)}
+		p.SetSyncBits(sync)
+		mw(p, func(*dmr.Packet) { passed++ })
+	}
+	if passed != len(fragments) {
+		t.Fatalf("middleware passed %d of %d packets", passed, len(fragments))
+	}
+	line, err = r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read forwarded position failed: %v", err)
+	}
+	if !strings.HasPrefix(line, "PD0MZ-9>") {
+		t.Fatalf("forward failed: got %q", line)
+	}
+}
@@ -0,0 +1,126 @@
+// Package bit implements bit strings with one bit per byte
+package bit
+
+import "fmt"
+
+// Bits is a bit string, every byte holds a single bit as 0 or 1, most
+// significant bit first.
+type Bits []byte
+
+// NewBits unpacks the bytes to bits, most significant bit first.
+func NewBits(data []byte) Bits {
+	return Unpack(data, len(data)*8)
+}
+
+// Bytes packs the bits to bytes, most significant bit first. The last byte
+// is padded with zero bits.
+func (b Bits) Bytes() []byte {
+	var (
+		data = make([]byte, (len(b)+7)/8)
+		full = len(b) / 8
+	)
+	for i := 0; i < full; i++ {
+		var o = b[i*8 : i*8+8]
+		data[i] = (o[0]&1)<<7 | (o[1]&1)<<6 | (o[2]&1)<<5 | (o[3]&1)<<4 |
+			(o[4]&1)<<3 | (o[5]&1)<<2 | (o[6]&1)<<1 | o[7]&1
+	}
+	for i := full * 8; i < len(b); i++ {
+		data[full] |= (b[i] & 1) << uint(7-i&7)
+	}
+	return data
+}
+
+// Uint reads width bits at offset as an unsigned integer, most significant
+// bit first.
+func (b Bits) Uint(offset, width int) (uint64, error) {
+	if err := b.check(offset, width, 64); err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, bit := range b[offset : offset+width] {
+		v = v<<1 | uint64(bit&1)
+	}
+	return v, nil
+}
+
+// Uint8 reads up to 8 bits at offset.
+func (b Bits) Uint8(offset, width int) (uint8, error) {
+	if width > 8 {
+		return 0, fmt.Errorf("bit: width %d exceeds 8 bits", width)
+	}
+	v, err := b.Uint(offset, width)
+	return uint8(v), err
+}
+
+// Uint16 reads up to 16 bits at offset.
+func (b Bits) Uint16(offset, width int) (uint16, error) {
+	if width > 16 {
+		return 0, fmt.Errorf("bit: width %d exceeds 16 bits", width)
+	}
+	v, err := b.Uint(offset, width)
+	return uint16(v), err
+}
+
+// Uint32 reads up to 32 bits at offset.
+func (b Bits) Uint32(offset, width int) (uint32, error) {
+	if width > 32 {
+		return 0, fmt.Errorf("bit: width %d exceeds 32 bits", width)
+	}
+	v, err := b.Uint(offset, width)
+	return uint32(v), err
+}
+
+// SetUint writes the width least significant bits of v at offset, most
+// significant bit first.
+func (b Bits) SetUint(offset, width int, v uint64) error {
+	if err := b.check(offset, width, 64); err != nil {
+		return err
+	}
+	if width < 64 && v>>uint(width) != 0 {
+		return fmt.Errorf("bit: value %d exceeds %d bits", v, width)
+	}
+	for i := offset + width - 1; i >= offset; i-- {
+		b[i] = uint8(v & 1)
+		v >>= 1
+	}
+	return nil
+}
+
+func (b Bits) check(offset, width, max int) error {
+	switch {
+	case width < 0 || width > max:
+		return fmt.Errorf("bit: width %d out of range", width)
+	case offset < 0 || offset+width > len(b):
+		return fmt.Errorf("bit: %d bits at offset %d exceed %d bits", width, offset, len(b))
+	}
+	return nil
+}
+
+// Equal returns true if both bit strings are the same.
+func (b Bits) Equal(o Bits) bool {
+	if len(b) != len(o) {
+		return false
+	}
+	for i := range b {
+		if b[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HammingDistance returns the number of bits that differ, bits beyond the
+// end of the shorter string count as different.
+func (b Bits) HammingDistance(o Bits) int {
+	var n, d = len(b), 0
+	if len(o) < n {
+		n = len(o)
+	}
+	for i := 0; i < n; i++ {
+		d += int((b[i] ^ o[i]) & 1)
+	}
+	if len(b) > len(o) {
+		return d + len(b) - len(o)
+	}
+	return d + len(o) - len(b)
+}
@@ -0,0 +1,153 @@
+package bit
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBits(t *testing.T) {
+	var data = []byte{0xbe, 0xef, 0x2a}
+	bits := NewBits(data)
+	if len(bits) != 24 || bits[0] != 1 || bits[1] != 0 || bits[23] != 0 || bits[22] != 1 {
+		t.Fatalf("new bits failed: got %v", bits)
+	}
+	if !bytes.Equal(bits.Bytes(), data) {
+		t.Fatalf("bytes failed: got %x, expected %x", bits.Bytes(), data)
+	}
+	if got := bits[:12].Bytes(); !bytes.Equal(got, []byte{0xbe, 0xe0}) {
+		t.Fatalf("bytes with padding failed: got %x", got)
+	}
+
+	u8, err := bits.Uint8(4, 8)
+	switch {
+	case err != nil:
+		t.Fatalf("uint8 failed: %v", err)
+	case u8 != 0xee:
+		t.Fatalf("uint8 failed: got %#x", u8)
+	}
+	u16, err := bits.Uint16(0, 16)
+	switch {
+	case err != nil:
+		t.Fatalf("uint16 failed: %v", err)
+	case u16 != 0xbeef:
+		t.Fatalf("uint16 failed: got %#x", u16)
+	}
+	u32, err := bits.Uint32(3, 21)
+	switch {
+	case err != nil:
+		t.Fatalf("uint32 failed: %v", err)
+	case u32 != 0xbeef2a&0x1fffff:
+		t.Fatalf("uint32 failed: got %#x", u32)
+	}
+
+	for _, test := range []struct{ Offset, Width int }{{20, 8}, {-1, 4}, {0, 9}} {
+		if _, err := bits.Uint8(test.Offset, test.Width); err == nil {
+			t.Fatalf("uint8 at %d width %d succeeded, expected an error", test.Offset, test.Width)
+		}
+	}
+
+	var out = make(Bits, 24)
+	if err := out.SetUint(0, 16, 0xbeef); err != nil {
+		t.Fatalf("set uint failed: %v", err)
+	}
+	if err := out.SetUint(16, 8, 0x2a); err != nil {
+		t.Fatalf("set uint failed: %v", err)
+	}
+	if !out.Equal(bits) {
+		t.Fatalf("set uint failed: got %x, expected %x", out.Bytes(), data)
+	}
+	if err := out.SetUint(0, 4, 0x10); err == nil {
+		t.Fatal("set uint of a too large value succeeded, expected an error")
+	}
+	if err := out.SetUint(20, 8, 0); err == nil {
+		t.Fatal("set uint beyond the end succeeded, expected an error")
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	var a, b = NewBits([]byte{0xff, 0x00}), NewBits([]byte{0xfe, 0x01})
+	switch {
+	case a.HammingDistance(a) != 0 || !a.Equal(a):
+		t.Fatal("hamming distance to itself is not 0")
+	case a.HammingDistance(b) != 2 || a.Equal(b):
+		t.Fatalf("hamming distance failed: got %d, expected 2", a.HammingDistance(b))
+	case a.HammingDistance(b[:12]) != 5 || b[:12].HammingDistance(a) != 5:
+		t.Fatalf("hamming distance of different lengths failed: got %d, expected 5", a.HammingDistance(b[:12]))
+	}
+}
+
+func BenchmarkNewBits(b *testing.B) {
+	var data = make([]byte, 33)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewBits(data)
+	}
+}
+
+func BenchmarkBytes(b *testing.B) {
+	var bits = make(Bits, 264)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bits.Bytes()
+	}
+}
+
+func BenchmarkUint32(b *testing.B) {
+	var bits = make(Bits, 264)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bits.Uint32(100, 24)
+	}
+}
+
+func BenchmarkHammingDistance(b *testing.B) {
+	var x, y = make(Bits, 48), make(Bits, 48)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		x.HammingDistance(y)
+	}
+}
+
+func TestPack(t *testing.T) {
+	var data = []byte{0xbe, 0xef, 0x2a}
+	var tests = []struct {
+		N         int
+		MSB, LSB  []byte
+		FirstBits Bits
+	}{
+		{24, []byte{0xbe, 0xef, 0x2a}, []byte{0xbe, 0xef, 0x2a}, Bits{1, 0, 1, 1}},
+		{12, []byte{0xbe, 0xe0}, []byte{0xbe, 0x0f}, Bits{1, 0, 1, 1}},
+		{3, []byte{0xa0}, []byte{0x06}, Bits{1, 0, 1}},
+		{32, []byte{0xbe, 0xef, 0x2a}, []byte{0xbe, 0xef, 0x2a}, Bits{1, 0, 1, 1}},
+		{0, []byte{}, []byte{}, Bits{}},
+	}
+	for _, test := range tests {
+		var msb, lsb = Unpack(data, test.N), UnpackLSB(data, test.N)
+		var n = test.N
+		if n > len(data)*8 {
+			n = len(data) * 8
+		}
+		switch {
+		case len(msb) != n || len(lsb) != n:
+			t.Fatalf("unpack %d: expected %d bits, got %d and %d", test.N, n, len(msb), len(lsb))
+		case !bytes.Equal(msb.Bytes(), test.MSB):
+			t.Fatalf("bytes %d: expected %x, got %x", test.N, test.MSB, msb.Bytes())
+		case !bytes.Equal(lsb.BytesLSB(), test.LSB):
+			t.Fatalf("bytes lsb %d: expected %x, got %x", test.N, test.LSB, lsb.BytesLSB())
+		case !msb[:len(test.FirstBits)].Equal(test.FirstBits):
+			t.Fatalf("unpack %d: expected %v first, got %v", test.N, test.FirstBits, msb)
+		}
+	}
+	// 0xbe least significant bit first
+	if lsb := UnpackLSB(data, 8); !lsb.Equal(Bits{0, 1, 1, 1, 1, 1, 0, 1}) {
+		t.Fatalf("unpack lsb failed: got %v", lsb)
+	}
+}
+
+func BenchmarkUnpack(b *testing.B) {
+	var data = make([]byte, 33)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Unpack(data, 264)
+	}
+}
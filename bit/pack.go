@@ -0,0 +1,65 @@
+package bit
+
+// Unpacked bits of every byte value, for Unpack and UnpackLSB.
+var (
+	unpackMSB [256][8]byte
+	unpackLSB [256][8]byte
+)
+
+func init() {
+	for v := range unpackMSB {
+		for i := 0; i < 8; i++ {
+			unpackMSB[v][i] = uint8(v>>uint(7-i)) & 1
+			unpackLSB[v][i] = uint8(v>>uint(i)) & 1
+		}
+	}
+}
+
+// Unpack unpacks the first n bits of data, most significant bit first. If
+// data has less than n bits, all its bits are returned.
+func Unpack(data []byte, n int) Bits {
+	return unpack(&unpackMSB, data, n)
+}
+
+// BytesLSB is like Bytes, least significant bit first.
+func (b Bits) BytesLSB() []byte {
+	var (
+		data = make([]byte, (len(b)+7)/8)
+		full = len(b) / 8
+	)
+	for i := 0; i < full; i++ {
+		var o = b[i*8 : i*8+8]
+		data[i] = (o[7]&1)<<7 | (o[6]&1)<<6 | (o[5]&1)<<5 | (o[4]&1)<<4 |
+			(o[3]&1)<<3 | (o[2]&1)<<2 | (o[1]&1)<<1 | o[0]&1
+	}
+	for i := full * 8; i < len(b); i++ {
+		data[full] |= (b[i] & 1) << uint(i&7)
+	}
+	return data
+}
+
+// UnpackLSB unpacks the first n bits of data, least significant bit first. If
+// data has less than n bits, all its bits are returned.
+func UnpackLSB(data []byte, n int) Bits {
+	return unpack(&unpackLSB, data, n)
+}
+
+func unpack(table *[256][8]byte, data []byte, n int) Bits {
+	if n > len(data)*8 {
+		n = len(data) * 8
+	}
+	if n < 0 {
+		n = 0
+	}
+	var (
+		bits = make(Bits, (n+7)/8*8)
+		full = n / 8
+	)
+	for i := 0; i < full; i++ {
+		copy(bits[i*8:], table[data[i]][:])
+	}
+	if full*8 < n {
+		copy(bits[full*8:], table[data[full]][:])
+	}
+	return bits[:n]
+}
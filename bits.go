@@ -1,5 +1,7 @@
 package dmr
 
+import "github.com/pd0mz/go-dmr/bit"
+
 // Various sizes of information chunks.
 const (
 	PayloadBits                 = 98 + 10 + 48 + 10 + 98
@@ -280,30 +282,10 @@ const (
 
 // BytesToBits converts a byte slice to a byte slice representing the individual data bits.
 func BytesToBits(data []byte) []byte {
-	var bits = make([]byte, len(data)*8)
-	for i := 0; i < len(data); i++ {
-		copy(bits[i*8:], toBits(data[i]))
-	}
-	return bits
-}
-
-func toBits(b byte) []byte {
-	var o = make([]byte, 8)
-	for bit, mask := 0, byte(128); bit < 8; bit, mask = bit+1, mask>>1 {
-		if b&mask != 0 {
-			o[bit] = 1
-		}
-	}
-	return o
+	return bit.NewBits(data)
 }
 
 // BitsToBytes converts a byte slice of bits to a byte slice.
 func BitsToBytes(bits []byte) []byte {
-	var data = make([]byte, (len(bits)+7)/8)
-	for i, b := range bits {
-		if b == 0x01 {
-			data[i/8] |= (1 << byte(7-(i%8)))
-		}
-	}
-	return data
+	return bit.Bits(bits).Bytes()
 }
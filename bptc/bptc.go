@@ -1,3 +1,5 @@
+// Package bptc implements the Block Product Turbo Code (196, 96) used to
+// protect the info bits of data sync bursts, see DMR AI spec. page 120.
 package bptc
 
 import (
@@ -5,6 +7,18 @@ import (
 	"os"
 
 	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bit"
+	"github.com/pd0mz/go-dmr/fec/hamming"
+)
+
+// Matrix dimensions, the 196 bits contain a reserved bit followed by a 13x15
+// matrix. The first 9 rows are protected by a Hamming (15, 11, 3) code, all 15
+// columns are protected by a Hamming (13, 9, 3) code.
+const (
+	rows     = 13
+	cols     = 15
+	dataRows = 9
+	dataCols = 11
 )
 
 var (
@@ -24,10 +38,10 @@ func init() {
 }
 
 func dump(bits []byte) {
-	for row := 0; row < 13; row++ {
+	for row := 0; row < rows; row++ {
 		if row == 0 {
 			fmt.Printf("col #    ")
-			for col := 0; col < 15; col++ {
+			for col := 0; col < cols; col++ {
 				fmt.Printf("%02d ", col+1)
 				if col == 10 {
 					fmt.Print("| ")
@@ -38,11 +52,11 @@ func dump(bits []byte) {
 		if row == 9 {
 			fmt.Println("          -------------------------------   ------------")
 		}
-		for col := 0; col < 15; col++ {
+		for col := 0; col < cols; col++ {
 			if col == 0 {
 				fmt.Printf("row #%02d: ", row+1)
 			}
-			fmt.Printf(" %d ", bits[col+row*15+1])
+			fmt.Printf(" %d ", bits[col+row*cols])
 			if col == 10 {
 				fmt.Print("| ")
 			}
@@ -51,21 +65,30 @@ func dump(bits []byte) {
 	}
 }
 
+// Decode deinterleaves the 196 info bits, corrects single bit errors in each
+// row and column and extracts the 96 data bits to 12 bytes of data.
 func Decode(info, data []byte) error {
+	_, err := DecodeCorrected(info, data)
+	return err
+}
+
+// DecodeCorrected is like Decode, but also returns the number of corrected bits.
+func DecodeCorrected(info, data []byte) (int, error) {
 	if len(info) < 196 {
-		return fmt.Errorf("bptc: info size %d too small, need at least 196 bits", len(info))
+		return 0, fmt.Errorf("bptc: info size %d too small, need at least 196 bits", len(info))
 	}
 	if len(data) < 12 {
-		return fmt.Errorf("bptc: data size %d too small, need at least 12 bytes", len(data))
+		return 0, fmt.Errorf("bptc: data size %d too small, need at least 12 bytes", len(data))
 	}
 
 	var (
 		i, j, k uint32
 		bits    = make([]byte, 196)
-		temp    = make([]byte, 196)
+		temp    = make([]byte, 96)
 	)
 
-	// Deinterleave
+	// Deinterleave, this moves the reserved bit to the end so the matrix
+	// starts at bit 0.
 	for i = 1; i < 197; i++ {
 		bits[i-1] = info[dm[i]]
 	}
@@ -75,25 +98,47 @@ func Decode(info, data []byte) error {
 	}
 
 	// Hamming checks
-	if err := hamming_check(bits); err != nil {
-		//return err
-		//log.Warningf("hamming check failed: %v", err)
+	corrected, err := hamming_check(bits)
+	if err != nil {
+		return corrected, err
 	}
 
-	// Extract data bits
-	for i, k = 3, 0; i < 11; i, k = i+1, k+1 {
-		temp[k] = bits[0*15+i]
+	// Extract data bits, the first three bits are reserved
+	for i, k = 3, 0; i < dataCols; i, k = i+1, k+1 {
+		temp[k] = bits[0*cols+i]
 	}
-	for j = 1; j < 9; j++ {
-		for i = 0; i < 11; i, k = i+1, k+1 {
-			temp[k] = bits[j*15+i]
+	for j = 1; j < dataRows; j++ {
+		for i = 0; i < dataCols; i, k = i+1, k+1 {
+			temp[k] = bits[j*cols+i]
 		}
 	}
 
 	copy(data, dmr.BitsToBytes(temp))
-	return nil
+	return corrected, nil
 }
 
+// DecodeBits decodes the 196 info bits and returns the 96 data bits.
+func DecodeBits(info []byte) ([]byte, error) {
+	var data = make([]byte, 12)
+	if err := Decode(info, data); err != nil {
+		return nil, err
+	}
+	return dmr.BytesToBits(data), nil
+}
+
+// EncodeBits encodes the 96 data bits and returns the 196 info bits.
+func EncodeBits(bits []byte) ([]byte, error) {
+	if len(bits) != 96 {
+		return nil, fmt.Errorf("bptc: expected 96 data bits, got %d", len(bits))
+	}
+	var info = make([]byte, 196)
+	if err := Encode(dmr.BitsToBytes(bits), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Encode encodes 12 bytes of data to 196 interleaved info bits.
 func Encode(data, info []byte) error {
 	if len(data) < 12 {
 		return fmt.Errorf("bptc: data size %d too small, need at least 12 bytes", len(data))
@@ -103,40 +148,41 @@ func Encode(data, info []byte) error {
 	}
 
 	var (
-		bits = dmr.BytesToBits(data)
+		bits = dmr.BytesToBits(data[:12])
 		temp = make([]byte, 196)
-		errs = make([]byte, 4)
-		cols = make([]byte, 13)
+		col  = make(bit.Bits, dataRows)
 	)
 
 	var c, r, k uint32
-	for r = 0; r < 9; r++ {
+	for r = 0; r < dataRows; r++ {
 		if r == 0 {
-			for c = 3; c < 11; c, k = c+1, k+1 {
+			for c = 3; c < dataCols; c, k = c+1, k+1 {
 				temp[c] = bits[k]
 			}
 		} else {
-			for c = 0; c < 11; c, k = c+1, k+1 {
-				temp[c+r*15] = bits[k]
+			for c = 0; c < dataCols; c, k = c+1, k+1 {
+				temp[c+r*cols] = bits[k]
 			}
 		}
 
-		hamming_15_11_3_parity(temp[r*15:], errs)
-		temp[r*15+11] = errs[0]
-		temp[r*15+12] = errs[1]
-		temp[r*15+13] = errs[2]
-		temp[r*15+14] = errs[3]
+		row, err := hamming.Hamming15_11_3.Encode(temp[r*cols : r*cols+dataCols])
+		if err != nil {
+			return err
+		}
+		copy(temp[r*cols:], row)
 	}
-	for c = 0; c < 15; c++ {
-		for r = 0; r < 9; r++ {
-			cols[r] = temp[c+r*15+1]
+	for c = 0; c < cols; c++ {
+		for r = 0; r < dataRows; r++ {
+			col[r] = temp[c+r*cols]
 		}
 
-		hamming_13_9_3_parity(cols, errs)
-		temp[c+135+1] = errs[0]
-		temp[c+135+15+1] = errs[1]
-		temp[c+135+30+1] = errs[2]
-		temp[c+135+45+1] = errs[3]
+		codeword, err := hamming.Hamming13_9_3.Encode(col)
+		if err != nil {
+			return err
+		}
+		for r = dataRows; r < rows; r++ {
+			temp[c+r*cols] = codeword[r]
+		}
 	}
 
 	if debug {
@@ -151,54 +197,71 @@ func Encode(data, info []byte) error {
 	return nil
 }
 
-// Hamming(13, 9, 3) check
-func hamming_13_9_3_parity(bits, errs []byte) bool {
-	errs[0] = bits[0] ^ bits[1] ^ bits[3] ^ bits[5] ^ bits[6]
-	errs[1] = bits[0] ^ bits[1] ^ bits[2] ^ bits[4] ^ bits[6] ^ bits[7]
-	errs[2] = bits[0] ^ bits[1] ^ bits[2] ^ bits[3] ^ bits[5] ^ bits[7] ^ bits[8]
-	errs[3] = bits[0] ^ bits[2] ^ bits[4] ^ bits[5] ^ bits[8]
-	return (errs[0] == bits[9]) && (errs[1] == bits[10]) && (errs[2] == bits[11]) && (errs[3] == bits[12])
-}
-
-// Hamming(15, 11, 3) check
-func hamming_15_11_3_parity(bits, errs []byte) bool {
-	errs[0] = bits[0] ^ bits[1] ^ bits[2] ^ bits[3] ^ bits[5] ^ bits[7] ^ bits[8]
-	errs[1] = bits[1] ^ bits[2] ^ bits[3] ^ bits[4] ^ bits[6] ^ bits[8] ^ bits[9]
-	errs[2] = bits[2] ^ bits[3] ^ bits[4] ^ bits[5] ^ bits[7] ^ bits[9] ^ bits[10]
-	errs[3] = bits[0] ^ bits[1] ^ bits[2] ^ bits[4] ^ bits[6] ^ bits[7] ^ bits[10]
-	return (errs[0] == bits[11]) && (errs[1] == bits[12]) && (errs[2] == bits[13]) && (errs[3] == bits[14])
-}
-
-// hamming_check checks each row with a Hamming(15,11,3) code and each column with Hamming(13, 9, 3)
-func hamming_check(bits []byte) error {
+// hamming_check checks each row with a Hamming(15,11,3) code and each column
+// with Hamming(13, 9, 3), correcting single bit errors in place. Correcting a
+// column may fix a row that had multiple errors, so we keep going until there
+// is nothing left to repair.
+func hamming_check(bits []byte) (int, error) {
 	var (
-		c, r, k uint32
-		row     = make([]byte, 15)
-		col     = make([]byte, 13)
-		errs    = make([]byte, 4)
+		c, r      uint32
+		col       = make(bit.Bits, rows)
+		corrected int
 	)
 
-	// Run through each of the 9 rows containing data
-	for r = 0; r < 9; r++ {
-		k = r*15 + 1
-		for a := 0; a < 15; a++ {
-			row[a] = bits[k]
+	for pass := 0; pass < 5; pass++ {
+		var fixed, failed bool
+
+		// Run through each of the 9 rows containing data
+		for r = 0; r < dataRows; r++ {
+			switch pos, ok := hamming.Hamming15_11_3.Correct(bits[r*cols : (r+1)*cols]); {
+			case !ok:
+				failed = true
+				break
+			case pos >= 0:
+				corrected++
+				fixed = true
+				break
+			}
+		}
+
+		// Run through each of the 15 columns
+		for c = 0; c < cols; c++ {
+			for r = 0; r < rows; r++ {
+				col[r] = bits[c+r*cols]
+			}
+			switch pos, ok := hamming.Hamming13_9_3.Correct(col); {
+			case !ok:
+				failed = true
+				break
+			case pos >= 0:
+				bits[c+uint32(pos)*cols] ^= 1
+				corrected++
+				fixed = true
+				break
+			}
+		}
+
+		if !fixed && !failed {
+			return corrected, nil
 		}
-		if !hamming_15_11_3_parity(row, errs) {
-			return fmt.Errorf("hamming(15, 11, 3) check failed on row #%d", r)
+		if !fixed {
+			break
 		}
 	}
 
-	// Run through each of the 15 columns
-	for c = 0; c < 15; c++ {
-		k = c + 1
-		for a := 0; a < 13; a, k = a+1, k+15 {
-			col[a] = bits[k]
+	// Final verification pass
+	for r = 0; r < dataRows; r++ {
+		if !hamming.Hamming15_11_3.Check(bits[r*cols : (r+1)*cols]) {
+			return corrected, fmt.Errorf("bptc: hamming(15, 11, 3) check failed on row #%d", r)
 		}
-		if !hamming_13_9_3_parity(col, errs) {
-			return fmt.Errorf("hamming(13, 9, 3) check failed on col #%d", c)
+	}
+	for c = 0; c < cols; c++ {
+		for r = 0; r < rows; r++ {
+			col[r] = bits[c+r*cols]
+		}
+		if !hamming.Hamming13_9_3.Check(col) {
+			return corrected, fmt.Errorf("bptc: hamming(13, 9, 3) check failed on col #%d", c)
 		}
 	}
-
-	return nil
+	return corrected, nil
 }
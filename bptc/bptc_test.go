@@ -54,3 +54,75 @@ func TestEncode(t *testing.T) {
 	t.Logf("input:\n%s", hex.Dump(decoded))
 	t.Logf("encoded:\n%s", hex.Dump(test))
 }
+
+func TestDecodeCorrect(t *testing.T) {
+	var test = make([]byte, 12)
+
+	// Every single bit error must be corrected
+	for i := 0; i < 196; i++ {
+		var bits = dmr.BytesToBits(encoded)
+		bits[i] ^= 1
+
+		corrected, err := DecodeCorrected(bits, test)
+		if err != nil {
+			t.Fatalf("decode with bit %d flipped failed: %v", i, err)
+		}
+		if !bytes.Equal(test, decoded) {
+			t.Fatalf("decode with bit %d flipped failed: not equal", i)
+		}
+		// Bit 0 is reserved and not protected
+		if i != 0 && corrected != 1 {
+			t.Fatalf("decode with bit %d flipped: expected 1 corrected bit, got %d", i, corrected)
+		}
+	}
+
+	// Two errors in the same row are repaired by the column code
+	var bits = make([]byte, 196)
+	copy(bits, dmr.BytesToBits(encoded))
+	bits[dm[1+15+2]] ^= 1
+	bits[dm[1+15+5]] ^= 1
+	if _, err := DecodeCorrected(bits, test); err != nil {
+		t.Fatalf("decode with two errors failed: %v", err)
+	}
+	if !bytes.Equal(test, decoded) {
+		t.Fatal("decode with two errors failed: not equal")
+	}
+}
+
+func TestPacketInfoBits(t *testing.T) {
+	info, err := EncodeBits(dmr.BytesToBits(decoded))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var p = &dmr.Packet{}
+	p.SetInfoBits(info)
+	if len(p.Data) != 33 {
+		t.Fatalf("expected 33 data bytes, got %d", len(p.Data))
+	}
+
+	bits, err := DecodeBits(p.InfoBits())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if test := dmr.BitsToBytes(bits); !bytes.Equal(test, decoded) {
+		t.Fatalf("decode failed: not equal")
+	}
+}
+
+func TestIdleBurst(t *testing.T) {
+	bits, err := dmr.IdleBurst(1)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var (
+		p    = &dmr.Packet{DataType: dmr.Idle, Bits: bits}
+		data = make([]byte, 12)
+	)
+	if err := Decode(p.InfoBits(), data); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(data, make([]byte, 12)) {
+		t.Fatalf("expected the null message, got %x", data)
+	}
+}
@@ -0,0 +1,133 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/bit"
+	"github.com/pd0mz/go-dmr/fec/hamming"
+)
+
+// CACH sizes, a burst on air is the CACH followed by the payload. Repeaters
+// send the CACH with every outbound burst, networks only carry the payload.
+const (
+	CACHBits           = 24
+	CACHTACTBits       = 7
+	CACHSignallingBits = CACHBits - CACHTACTBits
+	BurstBits          = CACHBits + PayloadBits
+)
+
+// CACH access type, of the inbound channel of the timeslot in TC
+const (
+	AccessTypeIdle uint8 = iota
+	AccessTypeBusy
+)
+
+// Positions of the TACT bits in the CACH, the other bits carry the CACH
+// signalling.
+var cachTACTPositions = [CACHTACTBits]int{0, 4, 8, 12, 14, 18, 22}
+
+// CACH is the Common Announcement Channel, which precedes every outbound
+// burst of a repeater. The TACT announces the access type of the inbound
+// channel and the timeslot of the next burst, the bursts of both timeslots
+// alternate so the busy state of both timeslots follows from two successive
+// CACHs. The signalling bits carry fragments of a Short LC.
+type CACH struct {
+	AccessType uint8 // Busy or idle, see AccessType* constants
+	TC         uint8 // TDMA channel of the next burst, 0 for slot 1 and 1 for slot 2
+	LCSS       uint8 // Short LC fragment, see LCSS constants
+	Signalling bit.Bits
+}
+
+func (c *CACH) String() string {
+	var at = "idle"
+	if c.AccessType == AccessTypeBusy {
+		at = "busy"
+	}
+	return fmt.Sprintf("access %s, TC %d, %s (%d)", at, c.TC, LCSSName[c.LCSS], c.LCSS)
+}
+
+// Busy returns true if the inbound channel is busy.
+func (c *CACH) Busy() bool {
+	return c.AccessType == AccessTypeBusy
+}
+
+// ExtractCACHBits returns the 24 CACH bits of a burst of BurstBits, the
+// payload of the burst follows.
+func ExtractCACHBits(burst bit.Bits) (bit.Bits, error) {
+	if len(burst) != BurstBits {
+		return nil, fmt.Errorf("dmr/cach: expected %d burst bits, got %d", BurstBits, len(burst))
+	}
+	return append(bit.Bits{}, burst[:CACHBits]...), nil
+}
+
+// ParseCACH parses the CACH bits and corrects a single bit error of the TACT
+// using the Hamming (7, 4, 3) parity. The passed bits are left untouched.
+func ParseCACH(bits bit.Bits) (*CACH, error) {
+	if bits == nil {
+		return nil, errors.New("dmr/cach: bits can't be nil")
+	}
+	if len(bits) != CACHBits {
+		return nil, fmt.Errorf("dmr/cach: expected %d bits, got %d", CACHBits, len(bits))
+	}
+
+	var (
+		tact       = make(bit.Bits, CACHTACTBits)
+		signalling = make(bit.Bits, 0, CACHSignallingBits)
+		t          int
+	)
+	for i, b := range bits {
+		if t < CACHTACTBits && cachTACTPositions[t] == i {
+			tact[t] = b
+			t++
+			continue
+		}
+		signalling = append(signalling, b)
+	}
+	if _, ok := hamming.Hamming7_4_3.Correct(tact); !ok {
+		return nil, errors.New("dmr/cach: TACT checksum error")
+	}
+
+	return &CACH{
+		AccessType: tact[0],
+		TC:         tact[1],
+		LCSS:       tact[2]<<1 | tact[3],
+		Signalling: signalling,
+	}, nil
+}
+
+// Bits returns the CACH bits with the Hamming (7, 4, 3) parity of the TACT.
+// Missing signalling bits are zero.
+func (c *CACH) Bits() (bit.Bits, error) {
+	switch {
+	case c.AccessType > AccessTypeBusy:
+		return nil, fmt.Errorf("dmr/cach: access type %d out of range", c.AccessType)
+	case c.TC > 1:
+		return nil, fmt.Errorf("dmr/cach: TC %d out of range", c.TC)
+	case c.LCSS > Continuation:
+		return nil, fmt.Errorf("dmr/cach: LCSS %d out of range", c.LCSS)
+	case len(c.Signalling) > CACHSignallingBits:
+		return nil, fmt.Errorf("dmr/cach: expected %d signalling bits, got %d", CACHSignallingBits, len(c.Signalling))
+	}
+
+	tact, err := hamming.Hamming7_4_3.Encode(bit.Bits{c.AccessType, c.TC, c.LCSS >> 1, c.LCSS & 1})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		bits = make(bit.Bits, CACHBits)
+		t, s int
+	)
+	for i := range bits {
+		if t < CACHTACTBits && cachTACTPositions[t] == i {
+			bits[i] = tact[t]
+			t++
+			continue
+		}
+		if s < len(c.Signalling) {
+			bits[i] = c.Signalling[s] & 1
+		}
+		s++
+	}
+	return bits, nil
+}
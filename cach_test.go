@@ -0,0 +1,57 @@
+package dmr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+func TestCACH(t *testing.T) {
+	var want = &CACH{
+		AccessType: AccessTypeBusy,
+		TC:         1,
+		LCSS:       LastFragment,
+		Signalling: bit.Bits{1, 0, 1, 1, 0, 0, 1, 1, 1, 0, 0, 0, 1, 1, 0, 1, 0},
+	}
+	bits, err := want.Bits()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	var burst = append(append(bit.Bits{}, bits...), make(bit.Bits, PayloadBits)...)
+	cach, err := ExtractCACHBits(burst)
+	switch {
+	case err != nil:
+		t.Fatalf("extract failed: %v", err)
+	case !bytes.Equal(cach, bits):
+		t.Fatalf("extract failed: expected %v, got %v", bits, cach)
+	}
+	if _, err := ExtractCACHBits(burst[:PayloadBits]); err == nil {
+		t.Fatal("extract from payload succeeded")
+	}
+
+	// Every single bit error of the TACT is corrected
+	for _, i := range append([]int{-1}, cachTACTPositions[:]...) {
+		var corrupt = append(bit.Bits{}, bits...)
+		if i >= 0 {
+			corrupt[i] ^= 1
+		}
+		got, err := ParseCACH(corrupt)
+		switch {
+		case err != nil:
+			t.Fatalf("parse with error in bit %d failed: %v", i, err)
+		case got.AccessType != want.AccessType || got.TC != want.TC || got.LCSS != want.LCSS || !got.Busy():
+			t.Fatalf("parse with error in bit %d: expected %s, got %s", i, want, got)
+		case !bytes.Equal(got.Signalling, want.Signalling):
+			t.Fatalf("parse with error in bit %d: expected signalling %v, got %v", i, want.Signalling, got.Signalling)
+		}
+	}
+
+	if _, err := (&CACH{LCSS: 4}).Bits(); err == nil {
+		t.Fatal("build with LCSS 4 succeeded")
+	}
+	if _, err := ParseCACH(bits[:CACHTACTBits]); err == nil {
+		t.Fatal("parse of TACT bits only succeeded")
+	}
+}
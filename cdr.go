@@ -0,0 +1,310 @@
+package dmr
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultCDRTimeout is the time after the last frame of a stream after which
+// a stream without terminator is finalized.
+const DefaultCDRTimeout = time.Second
+
+// DefaultCDRMaxRecords is the number of finalized CDRs kept until they are
+// written, the oldest records are dropped when more CDRs are finalized.
+const DefaultCDRMaxRecords = 4096
+
+// CDR is the call detail record of a stream.
+type CDR struct {
+	StreamID   uint32
+	SrcID      uint32
+	DstID      uint32
+	CallType   uint8
+	Slot       uint8 // Timeslot, 0 for slot 1 and 1 for slot 2
+	StartTime  time.Time
+	EndTime    time.Time
+	FrameCount int
+	LostFrames int     // Frames missing in the sequence numbers
+	Callsign   string  // Callsign of the source, if the CDRWriter has a Callsign func
+	BER        float64 // Average bit error rate in percent, of the frames with a signal report
+	RSSI       float64 // Average received signal strength in -dBm, of the frames with a signal report
+	MetaFrames int     // Frames with a signal report
+}
+
+// Duration returns the time between the first and the last frame.
+func (c *CDR) Duration() time.Duration {
+	return c.EndTime.Sub(c.StartTime)
+}
+
+// cdrHeader are the CSV columns, the JSON fields use the same names. The
+// callsign and signal report are only included in JSON, to keep the CSV
+// layout stable.
+var cdrHeader = []string{
+	"stream_id", "src_id", "dst_id", "call_type", "slot",
+	"start_time", "end_time", "duration", "frame_count", "lost_frames",
+}
+
+func (c *CDR) record() []string {
+	return []string{
+		strconv.FormatUint(uint64(c.StreamID), 10),
+		strconv.FormatUint(uint64(c.SrcID), 10),
+		strconv.FormatUint(uint64(c.DstID), 10),
+		CallTypeName[c.CallType],
+		strconv.Itoa(int(c.Slot) + 1),
+		c.StartTime.UTC().Format(time.RFC3339Nano),
+		c.EndTime.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(c.Duration().Seconds(), 'f', 3, 64),
+		strconv.Itoa(c.FrameCount),
+		strconv.Itoa(c.LostFrames),
+	}
+}
+
+// MarshalJSON encodes the CDR with the duration in seconds and UTC times.
+func (c *CDR) MarshalJSON() ([]byte, error) {
+	var ber, rssi *float64
+	if c.MetaFrames > 0 {
+		ber, rssi = &c.BER, &c.RSSI
+	}
+	return json.Marshal(struct {
+		StreamID   uint32    `json:"stream_id"`
+		SrcID      uint32    `json:"src_id"`
+		DstID      uint32    `json:"dst_id"`
+		CallType   string    `json:"call_type"`
+		Slot       int       `json:"slot"`
+		StartTime  time.Time `json:"start_time"`
+		EndTime    time.Time `json:"end_time"`
+		Duration   float64   `json:"duration"`
+		FrameCount int       `json:"frame_count"`
+		LostFrames int       `json:"lost_frames"`
+		Callsign   string    `json:"callsign,omitempty"`
+		BER        *float64  `json:"ber,omitempty"`
+		RSSI       *float64  `json:"rssi,omitempty"`
+	}{
+		c.StreamID, c.SrcID, c.DstID, CallTypeName[c.CallType], int(c.Slot) + 1,
+		c.StartTime.UTC(), c.EndTime.UTC(), c.Duration().Seconds(), c.FrameCount, c.LostFrames,
+		c.Callsign, ber, rssi,
+	})
+}
+
+// CDRWriter tracks streams by stream ID and records a CDR for each stream,
+// which is finalized by a terminator or when no frames are received for
+// Timeout. Finalized CDRs are passed to OnCDR and written to Out, if neither
+// is set up to MaxRecords CDRs are kept until they are written with WriteJSON
+// or WriteCSV.
+type CDRWriter struct {
+	Timeout    time.Duration
+	MaxRecords int
+
+	// OnCDR is called with every finalized CDR.
+	OnCDR func(cdr *CDR)
+	// Out receives every finalized CDR as newline delimited JSON. Write
+	// errors are kept and returned by Err.
+	Out io.Writer
+	// Callsign returns the callsign of a source ID, it is called once at the
+	// start of every stream, for example with dmrid.Database.Callsign.
+	Callsign func(id uint32) string
+
+	mutex   *sync.Mutex
+	streams map[uint32]*cdrStream
+	records []*CDR
+	err     error
+	now     func() time.Time
+}
+
+type cdrStream struct {
+	cdr      *CDR
+	sequence sequence
+	timer    *time.Timer
+}
+
+// NewCDRWriter returns a CDR writer with the default timeout.
+func NewCDRWriter() *CDRWriter {
+	return &CDRWriter{
+		Timeout:    DefaultCDRTimeout,
+		MaxRecords: DefaultCDRMaxRecords,
+		mutex:      &sync.Mutex{},
+		streams:    make(map[uint32]*cdrStream),
+		now:        time.Now,
+	}
+}
+
+// PacketFunc can be installed as the PacketFunc of a Repeater.
+func (w *CDRWriter) PacketFunc(_ Repeater, p *Packet) error {
+	w.AddPacket(p)
+	return nil
+}
+
+// AddPacket counts the packet in the CDR of its stream.
+func (w *CDRWriter) AddPacket(p *Packet) {
+	if p == nil {
+		return
+	}
+
+	var now = w.now()
+
+	w.mutex.Lock()
+	stream, ok := w.streams[p.StreamID]
+	if !ok {
+		stream = &cdrStream{
+			cdr: &CDR{
+				StreamID:  p.StreamID,
+				SrcID:     p.SrcID,
+				DstID:     p.DstID,
+				CallType:  p.CallType,
+				Slot:      p.Timeslot,
+				StartTime: now,
+			},
+		}
+		if w.Callsign != nil {
+			stream.cdr.Callsign = w.Callsign(p.SrcID)
+		}
+		w.streams[p.StreamID] = stream
+
+		var streamID = p.StreamID
+		stream.timer = time.AfterFunc(w.timeout(), func() { w.finalize(streamID, stream) })
+	} else {
+		stream.timer.Reset(w.timeout())
+	}
+	_, lost, _ := stream.sequence.check(p)
+	stream.cdr.LostFrames += lost
+	stream.cdr.FrameCount++
+	if p.HasMeta {
+		// Running averages, so the CDR is complete at any time
+		var c, n = stream.cdr, float64(stream.cdr.MetaFrames + 1)
+		c.BER += (float64(p.BER) - c.BER) / n
+		c.RSSI += (float64(p.RSSI) - c.RSSI) / n
+		c.MetaFrames++
+	}
+	stream.cdr.EndTime = now
+	w.mutex.Unlock()
+
+	if p.DataType == TerminatorWithLC {
+		w.finalize(p.StreamID, nil)
+	}
+}
+
+// Add adds a finalized CDR.
+func (w *CDRWriter) Add(cdr *CDR) {
+	w.mutex.Lock()
+	switch {
+	case w.Out != nil:
+		if err := json.NewEncoder(w.Out).Encode(cdr); err != nil && w.err == nil {
+			w.err = err
+		}
+		break
+	case w.OnCDR == nil:
+		w.records = append(w.records, cdr)
+		if len(w.records) > w.maxRecords() {
+			w.records = w.records[len(w.records)-w.maxRecords():]
+		}
+		break
+	}
+	w.mutex.Unlock()
+
+	if w.OnCDR != nil {
+		w.OnCDR(cdr)
+	}
+}
+
+// Err returns the first error writing to Out.
+func (w *CDRWriter) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+// finalize finalizes the CDR of streamID, if stream is not nil it only
+// finalizes that stream, as the timer may fire after a new stream with the
+// same stream ID started.
+func (w *CDRWriter) finalize(streamID uint32, stream *cdrStream) {
+	w.mutex.Lock()
+	active, ok := w.streams[streamID]
+	if !ok || (stream != nil && active != stream) {
+		w.mutex.Unlock()
+		return
+	}
+	active.timer.Stop()
+	delete(w.streams, streamID)
+	w.mutex.Unlock()
+
+	w.Add(active.cdr)
+}
+
+// flush returns and removes the finalized CDRs.
+func (w *CDRWriter) flush() []*CDR {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var records = w.records
+	w.records = nil
+	return records
+}
+
+// restore puts back the CDRs that could not be written, in front of the CDRs
+// finalized in the mean time.
+func (w *CDRWriter) restore(records []*CDR) {
+	w.mutex.Lock()
+	w.records = append(records, w.records...)
+	if len(w.records) > w.maxRecords() {
+		w.records = w.records[len(w.records)-w.maxRecords():]
+	}
+	w.mutex.Unlock()
+}
+
+// WriteJSON writes the finalized CDRs as newline delimited JSON and removes
+// them from the writer. On error the CDRs that were not written are kept.
+func (w *CDRWriter) WriteJSON(out io.Writer) error {
+	var (
+		enc     = json.NewEncoder(out)
+		records = w.flush()
+	)
+	for i, cdr := range records {
+		if err := enc.Encode(cdr); err != nil {
+			w.restore(records[i:])
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the finalized CDRs as CSV with a header line and removes
+// them from the writer. On error all CDRs are kept, as it is unknown which
+// rows made it out of the CSV buffer.
+func (w *CDRWriter) WriteCSV(out io.Writer) error {
+	var (
+		cw      = csv.NewWriter(out)
+		records = w.flush()
+	)
+	if err := cw.Write(cdrHeader); err != nil {
+		w.restore(records)
+		return err
+	}
+	for _, cdr := range records {
+		if err := cw.Write(cdr.record()); err != nil {
+			w.restore(records)
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		w.restore(records)
+		return err
+	}
+	return nil
+}
+
+func (w *CDRWriter) timeout() time.Duration {
+	if w.Timeout <= 0 {
+		return DefaultCDRTimeout
+	}
+	return w.Timeout
+}
+
+func (w *CDRWriter) maxRecords() int {
+	if w.MaxRecords <= 0 {
+		return DefaultCDRMaxRecords
+	}
+	return w.MaxRecords
+}
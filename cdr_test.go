@@ -0,0 +1,180 @@
+package dmr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCDRWriter(t *testing.T) {
+	var (
+		w     = NewCDRWriter()
+		clock = time.Date(2026, 3, 1, 23, 59, 58, 0, time.UTC)
+		done  = make(chan *CDR, 2)
+	)
+	w.now = func() time.Time { return clock }
+	w.OnCDR = func(cdr *CDR) { done <- cdr }
+	w.Callsign = func(id uint32) string {
+		if id == 2042214 {
+			return "PD0MZ"
+		}
+		return ""
+	}
+
+	// A call across midnight UTC, with sequence 3 and 4 lost
+	for _, seq := range []uint8{0, 1, 2, 5, 6} {
+		w.AddPacket(&Packet{StreamID: 1, SrcID: 2042214, DstID: 204, CallType: CallTypeGroup, Timeslot: 1, Sequence: seq, DataType: VoiceBurstA})
+		clock = clock.Add(time.Millisecond * 700)
+	}
+	w.AddPacket(&Packet{StreamID: 1, Sequence: 7, DataType: TerminatorWithLC})
+
+	var cdr = <-done
+	switch {
+	case cdr.StreamID != 1 || cdr.SrcID != 2042214 || cdr.DstID != 204 || cdr.Slot != 1:
+		t.Fatalf("cdr failed: got %+v", cdr)
+	case cdr.Duration() != time.Millisecond*3500:
+		t.Fatalf("cdr across midnight failed: expected duration 3.5s, got %s", cdr.Duration())
+	case cdr.FrameCount != 6 || cdr.LostFrames != 2:
+		t.Fatalf("cdr failed: expected 6 frames and 2 lost, got %d and %d", cdr.FrameCount, cdr.LostFrames)
+	case cdr.Callsign != "PD0MZ":
+		t.Fatalf("cdr failed: expected callsign PD0MZ, got %q", cdr.Callsign)
+	}
+
+	var first = cdr
+
+	// A stream without terminator is finalized by the timeout, sequence
+	// numbers wrap
+	w.Timeout = time.Millisecond * 10
+	w.AddPacket(&Packet{StreamID: 2, Sequence: 255, BER: 2, RSSI: 80, HasMeta: true})
+	w.AddPacket(&Packet{StreamID: 2, Sequence: 0, BER: 4, RSSI: 90, HasMeta: true})
+	select {
+	case cdr = <-done:
+		if cdr.StreamID != 2 || cdr.FrameCount != 2 || cdr.LostFrames != 0 {
+			t.Fatalf("cdr timeout failed: got %+v", cdr)
+		}
+		if cdr.MetaFrames != 2 || cdr.BER != 3 || cdr.RSSI != 85 {
+			t.Fatalf("cdr signal report failed: expected BER 3 and RSSI 85, got %v and %v", cdr.BER, cdr.RSSI)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cdr timeout failed: not finalized")
+	}
+
+	// Records passed to OnCDR are not buffered
+	var buf bytes.Buffer
+	if err := w.WriteJSON(&buf); err != nil || buf.Len() != 0 {
+		t.Fatalf("write JSON failed: records buffered with OnCDR set: %q (%v)", buf.String(), err)
+	}
+
+	w.OnCDR = nil
+	w.Add(first)
+	w.Add(cdr)
+	if err := w.WriteJSON(&buf); err != nil {
+		t.Fatalf("write JSON failed: %v", err)
+	}
+	var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("write JSON failed: expected 2 lines, got %q", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("write JSON failed: %v", err)
+	}
+	if record["duration"] != 3.5 || record["callsign"] != "PD0MZ" || record["start_time"] != "2026-03-01T23:59:58Z" || record["end_time"] != "2026-03-02T00:00:01.5Z" {
+		t.Fatalf("write JSON failed: got %s", lines[0])
+	}
+	if _, ok := record["ber"]; ok {
+		t.Fatalf("write JSON failed: signal report without frames with a report: %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record["ber"] != 3.0 || record["rssi"] != 85.0 {
+		t.Fatalf("write JSON failed: got %s", lines[1])
+	}
+
+	// Written records are removed
+	buf.Reset()
+	w.WriteJSON(&buf)
+	if buf.Len() != 0 {
+		t.Fatalf("write JSON failed: records written twice: %s", buf.String())
+	}
+}
+
+func TestCDRWriterCSV(t *testing.T) {
+	var w = NewCDRWriter()
+	w.Add(&CDR{
+		StreamID:   42,
+		SrcID:      2042214,
+		DstID:      204,
+		CallType:   CallTypeGroup,
+		StartTime:  time.Date(2026, 3, 1, 23, 59, 59, 0, time.UTC),
+		EndTime:    time.Date(2026, 3, 2, 0, 0, 1, 250e6, time.UTC),
+		FrameCount: 38,
+		LostFrames: 1,
+	})
+
+	var buf bytes.Buffer
+	if err := w.WriteCSV(&buf); err != nil {
+		t.Fatalf("write CSV failed: %v", err)
+	}
+	var want = "stream_id,src_id,dst_id,call_type,slot,start_time,end_time,duration,frame_count,lost_frames\n" +
+		"42,2042214,204," + CallTypeName[CallTypeGroup] + ",1,2026-03-01T23:59:59Z,2026-03-02T00:00:01.25Z,2.250,38,1\n"
+	if buf.String() != want {
+		t.Fatalf("write CSV failed: got %q, expected %q", buf.String(), want)
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestCDRWriterErrors(t *testing.T) {
+	var w = NewCDRWriter()
+	w.MaxRecords = 3
+	for id := uint32(1); id <= 4; id++ {
+		w.Add(&CDR{StreamID: id})
+	}
+
+	// The oldest record is dropped, the records that failed are kept
+	if err := w.WriteJSON(&failingWriter{n: 1}); err == nil {
+		t.Fatal("write JSON to failing writer succeeded")
+	}
+	if err := w.WriteCSV(&failingWriter{}); err == nil {
+		t.Fatal("write CSV to failing writer succeeded")
+	}
+	var buf bytes.Buffer
+	if err := w.WriteJSON(&buf); err != nil {
+		t.Fatalf("write JSON failed: %v", err)
+	}
+	var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"stream_id":3`) || !strings.Contains(lines[1], `"stream_id":4`) {
+		t.Fatalf("write JSON failed: expected stream 3 and 4, got %q", buf.String())
+	}
+}
+
+func TestCDRWriterOut(t *testing.T) {
+	var (
+		w   = NewCDRWriter()
+		buf bytes.Buffer
+	)
+	w.Out = &buf
+	w.Add(&CDR{StreamID: 42})
+	if !strings.Contains(buf.String(), `"stream_id":42`) {
+		t.Fatalf("out failed: got %q", buf.String())
+	}
+	if records := w.flush(); len(records) != 0 {
+		t.Fatalf("out failed: %d records buffered", len(records))
+	}
+
+	w.Out = &failingWriter{}
+	w.Add(&CDR{StreamID: 43})
+	if w.Err() == nil {
+		t.Fatal("out to failing writer succeeded")
+	}
+}
@@ -1,9 +1,10 @@
 package dmr
 
 import (
-	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/pd0mz/go-dmr/crc"
 )
 
 // Control Block Opcode
@@ -18,7 +19,9 @@ const (
 type ControlBlock struct {
 	CRC          uint16
 	Last         bool
+	Protect      bool
 	Opcode       uint8
+	FeatureSetID uint8
 	SrcID, DstID uint32
 	Data         ControlBlockData
 }
@@ -32,24 +35,23 @@ func (cb *ControlBlock) Bytes() ([]byte, error) {
 	if cb.Last {
 		data[0] |= B10000000
 	}
-
-	data[4] = uint8(cb.DstID >> 16)
-	data[5] = uint8(cb.DstID >> 8)
-	data[6] = uint8(cb.DstID)
-	data[7] = uint8(cb.SrcID >> 16)
-	data[8] = uint8(cb.SrcID >> 8)
-	data[9] = uint8(cb.SrcID)
-
-	// Calculate CRC16
-	for i := 0; i < 10; i++ {
-		crc16(&cb.CRC, data[i])
+	if cb.Protect {
+		data[0] |= B01000000
+	}
+	data[1] = cb.FeatureSetID
+
+	// Raw control blocks carry their own octets 2 to 9, these don't have to
+	// be addresses for manufacturer specific opcodes.
+	if _, ok := cb.Data.(*RawControlBlock); !ok {
+		data[4] = uint8(cb.DstID >> 16)
+		data[5] = uint8(cb.DstID >> 8)
+		data[6] = uint8(cb.DstID)
+		data[7] = uint8(cb.SrcID >> 16)
+		data[8] = uint8(cb.SrcID >> 8)
+		data[9] = uint8(cb.SrcID)
 	}
-	crc16end(&cb.CRC)
 
-	// Inverting according to the inversion polynomial.
-	cb.CRC = ^cb.CRC
-	// Applying CRC mask, see DMR AI spec. page 143.
-	cb.CRC ^= 0xa5a5
+	cb.CRC = crc.CRC16(data[:10], crc.MaskCSBK)
 
 	data[10] = uint8(cb.CRC >> 8)
 	data[11] = uint8(cb.CRC)
@@ -192,7 +194,7 @@ type Preamble struct {
 func (d *Preamble) String() string {
 	var part = []string{"preamble"}
 	if d.DataFollows {
-		part = append(part, "data folllows")
+		part = append(part, "data follows")
 	}
 	if d.DstIsGroup {
 		part = append(part, "group")
@@ -230,61 +232,89 @@ func (d *Preamble) Write(data []byte) error {
 
 var _ (ControlBlockData) = (*Preamble)(nil)
 
-func ParseControlBlock(data []byte) (*ControlBlock, error) {
+// RawControlBlockSize is the number of octets kept by a RawControlBlock, the
+// octets between the Feature Set ID and the CRC.
+const RawControlBlockSize = 8
+
+// RawControlBlock contains the content of a control block with an opcode
+// that is not supported by this package.
+type RawControlBlock struct {
+	Opcode uint8
+	Data   []byte
+}
+
+func (d *RawControlBlock) String() string {
+	return fmt.Sprintf("unknown, data %x", d.Data)
+}
+
+func (d *RawControlBlock) Parse(data []byte) error {
 	if len(data) != InfoSize {
-		return nil, fmt.Errorf("dmr: expected %d info bytes, got %d", InfoSize, len(data))
+		return fmt.Errorf("dmr: expected %d info bytes, got %d", InfoSize, len(data))
 	}
+	d.Opcode = data[0] & B00111111
+	d.Data = make([]byte, RawControlBlockSize)
+	copy(d.Data, data[2:10])
+	return nil
+}
 
-	// Calculate CRC16
-	var crc uint16
-	for i := 0; i < 10; i++ {
-		crc16(&crc, data[i])
+func (d *RawControlBlock) Write(data []byte) error {
+	if len(data) != InfoSize {
+		return fmt.Errorf("dmr: expected %d info bytes, got %d", InfoSize, len(data))
+	}
+	if len(d.Data) != RawControlBlockSize {
+		return fmt.Errorf("dmr: expected %d raw control block bytes, got %d", RawControlBlockSize, len(d.Data))
 	}
-	crc16end(&crc)
+	data[0] |= d.Opcode & B00111111
+	copy(data[2:10], d.Data)
+	return nil
+}
 
-	// Inverting according to the inversion polynomial
-	crc = ^crc
-	// Applying CRC mask, see DMR AI spec. page 143.
-	crc ^= 0xa5a5
+var _ (ControlBlockData) = (*RawControlBlock)(nil)
 
-	// Check packet
-	if data[0]&B01000000 > 0 {
-		return nil, errors.New("dmr: CSBK protect flag is set")
-	}
-	if data[1] != 0 {
-		return nil, errors.New("dmr: CSBK feature set ID is set")
+func ParseControlBlock(data []byte) (*ControlBlock, error) {
+	if len(data) != InfoSize {
+		return nil, fmt.Errorf("dmr: expected %d info bytes, got %d", InfoSize, len(data))
 	}
 
+	var checksum = crc.CRC16(data[:10], crc.MaskCSBK)
+
 	cb := &ControlBlock{
-		CRC:    uint16(data[10])<<8 | uint16(data[11]),
-		Last:   (data[0] & B10000000) > 0,
-		Opcode: (data[0] & B00111111),
-		DstID:  uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6]),
-		SrcID:  uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9]),
+		CRC:          uint16(data[10])<<8 | uint16(data[11]),
+		Last:         (data[0] & B10000000) > 0,
+		Protect:      (data[0] & B01000000) > 0,
+		Opcode:       (data[0] & B00111111),
+		FeatureSetID: data[1],
+		DstID:        uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6]),
+		SrcID:        uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9]),
 	}
 
-	if crc != cb.CRC {
-		return nil, fmt.Errorf("dmr: control block CRC error (%#04x != %#04x)", crc, cb.CRC)
+	if checksum != cb.CRC {
+		return nil, fmt.Errorf("dmr: control block CRC error (%#04x != %#04x)", checksum, cb.CRC)
 	}
 
-	switch cb.Opcode {
-	case OutboundActivationOpcode:
+	switch {
+	case cb.FeatureSetID != StandardFeatureSetID:
+		// Manufacturer specific opcodes
+		cb.Data = &RawControlBlock{}
+		break
+	case cb.Opcode == OutboundActivationOpcode:
 		cb.Data = &OutboundActivation{}
 		break
-	case UnitToUnitVoiceServiceRequestOpcode:
+	case cb.Opcode == UnitToUnitVoiceServiceRequestOpcode:
 		cb.Data = &UnitToUnitVoiceServiceRequest{}
 		break
-	case UnitToUnitVoiceServiceAnswerResponseOpcode:
+	case cb.Opcode == UnitToUnitVoiceServiceAnswerResponseOpcode:
 		cb.Data = &UnitToUnitVoiceServiceAnswerResponse{}
 		break
-	case NegativeAcknowledgeResponseOpcode:
+	case cb.Opcode == NegativeAcknowledgeResponseOpcode:
 		cb.Data = &NegativeAcknowledgeResponse{}
 		break
-	case PreambleOpcode:
+	case cb.Opcode == PreambleOpcode:
 		cb.Data = &Preamble{}
 		break
 	default:
-		return nil, fmt.Errorf("dmr: unknown CSBK opcode %#02x (%#06b)", cb.Opcode, cb.Opcode)
+		cb.Data = &RawControlBlock{}
+		break
 	}
 
 	if err := cb.Data.Parse(data); err != nil {
@@ -1,6 +1,9 @@
 package dmr
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 func testCSBK(want *ControlBlock, t *testing.T) *ControlBlock {
 	want.SrcID = 2042214
@@ -142,3 +145,79 @@ func TestCSBKPreamble(t *testing.T) {
 		t.Logf("decode: %s", test.String())
 	}
 }
+
+func TestCSBKVector(t *testing.T) {
+	// Preamble CSBK as received on air
+	var data = []byte{0xbd, 0x00, 0x80, 0x03, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x66, 0x7e}
+
+	cb, err := ParseControlBlock(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	d, ok := cb.Data.(*Preamble)
+	switch {
+	case !ok:
+		t.Fatalf("decode failed: expected Preamble, got %T", cb.Data)
+
+	case !cb.Last || cb.Protect:
+		t.Fatalf("decode failed, last block or protect flag wrong")
+
+	case !d.DataFollows || d.DstIsGroup || d.Blocks != 3:
+		t.Fatalf("decode failed, preamble wrong: %s", d)
+
+	case cb.DstID != 2042214 || cb.SrcID != 2043044:
+		t.Fatalf("decode failed, ID wrong")
+	}
+
+	test, err := cb.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(test, data) {
+		t.Fatalf("encode failed: expected %x, got %x", data, test)
+	}
+
+	data[4] ^= 0x01
+	if _, err := ParseControlBlock(data); err == nil {
+		t.Fatal("decode with bit error did not fail")
+	}
+}
+
+func TestCSBKRaw(t *testing.T) {
+	var raw = []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	for _, fid := range []uint8{StandardFeatureSetID, 0x10} {
+		want := &ControlBlock{
+			Opcode:       0x2a,
+			FeatureSetID: fid,
+			Data:         &RawControlBlock{Opcode: 0x2a, Data: raw},
+		}
+		data, err := want.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		test, err := ParseControlBlock(data)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+
+		d, ok := test.Data.(*RawControlBlock)
+		switch {
+		case !ok:
+			t.Fatalf("decode failed: expected RawControlBlock, got %T", test.Data)
+
+		case test.FeatureSetID != fid || d.Opcode != 0x2a || !bytes.Equal(d.Data, raw):
+			t.Fatalf("decode failed, raw data wrong: %s", test)
+
+		default:
+			t.Logf("decode: %s", test.String())
+		}
+
+		again, err := test.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Fatalf("encode failed: expected %x, got %x", data, again)
+		}
+	}
+}
@@ -1,85 +1,58 @@
 package dmr
 
+import "github.com/pd0mz/go-dmr/crc"
+
+// The CRC functions below update a CRC register one octet at a time, they are
+// thin wrappers around the crc package. Use the crc package for complete
+// messages with the DMR inversion and masks applied.
+
+// CRC9 updates the 9-bit CRC with the least significant bits of b, followed
+// by zero bits up to a full octet, used to protect confirmed data blocks, see
+// DMR AI spec. page 142.
+//
 // G(x) = x^9+x^6+x^4+x^3+1
-func crc9(crc *uint16, b uint8, bits int) {
-	var v uint8 = 0x80
-	for i := 0; i < 8-bits; i++ {
-		v >>= 1
-	}
-	for i := 0; i < 8; i++ {
-		xor := (*crc)&0x0100 > 0
-		(*crc) <<= 1
-		// Limit the number of shift registers to 9.
-		*crc &= 0x01ff
-		if b&v > 0 {
-			(*crc)++
-		}
-		if xor {
-			(*crc) ^= 0x0059
-		}
-		v >>= 1
-	}
+func CRC9(register *uint16, b uint8, bits int) {
+	*register = crc.Update9(*register, b<<uint(8-bits), 8)
 }
 
-func crc9end(crc *uint16, bits int) {
+// CRC9End flushes bits zero bits through the 9-bit CRC register.
+func CRC9End(register *uint16, bits int) {
 	for i := 0; i < bits; i++ {
-		xor := (*crc)&0x100 > 0
-		(*crc) <<= 1
-		// Limit the number of shift registers to 9.
-		*crc &= 0x01ff
-		if xor {
-			(*crc) ^= 0x0059
-		}
+		*register = crc.Update9(*register, 0, 1)
 	}
 }
 
+// CRC16 updates the CRC-CCITT with b, used to protect data headers and
+// control blocks, see DMR AI spec. page 140.
+//
 // G(x) = x^16+x^12+x^5+1
-func crc16(crc *uint16, b byte) {
-	var v uint8 = 0x80
-	for i := 0; i < 8; i++ {
-		xor := ((*crc) & 0x8000) != 0
-		(*crc) <<= 1
-		if b&v > 0 {
-			(*crc)++
-		}
-		if xor {
-			(*crc) ^= 0x1021
-		}
-		v >>= 1
-	}
+func CRC16(register *uint16, b byte) {
+	*register = crc.Update16(*register, []byte{b})
 }
 
-func crc16end(crc *uint16) {
-	for i := 0; i < 16; i++ {
-		xor := ((*crc) & 0x8000) != 0
-		(*crc) <<= 1
-		if xor {
-			(*crc) ^= 0x1021
-		}
-	}
-}
+// CRC16End completes the CRC-CCITT. The register is kept up to date by
+// CRC16, so there is nothing left to flush.
+func CRC16End(register *uint16) {}
 
-func crc32(crc *uint32, b byte) {
-	var v uint8 = 0x80
-	for i := 0; i < 8; i++ {
-		xor := ((*crc) & 0x80000000) > 0
-		(*crc) <<= 1
-		if b&v > 0 {
-			(*crc)++
-		}
-		if xor {
-			(*crc) ^= 0x04c11db7
-		}
-		v >>= 1
-	}
+// CRC32 updates the 32-bit CRC with b, used to protect complete data
+// fragments, see DMR AI spec. page 143.
+//
+// G(x) = x^32+x^26+x^23+x^22+x^16+x^12+x^11+x^10+x^8+x^7+x^5+x^4+x^2+x+1
+func CRC32(register *uint32, b byte) {
+	*register = crc.Update32(*register, []byte{b})
 }
 
-func crc32end(crc *uint32) {
-	for i := 0; i < 32; i++ {
-		xor := ((*crc) & 0x80000000) > 0
-		(*crc) <<= 1
-		if xor {
-			(*crc) ^= 0x04c11db7
-		}
+// CRC32End completes the 32-bit CRC. The register is kept up to date by
+// CRC32, so there is nothing left to flush.
+func CRC32End(register *uint32) {}
+
+// CheckCRC16 verifies the CRC-CCITT stored in the last two bytes (big endian)
+// of data against the CRC calculated over the preceding bytes. No inversion or
+// CRC mask is applied, callers have to remove those first.
+func CheckCRC16(data []byte) bool {
+	if len(data) < 2 {
+		return false
 	}
+	var n = len(data) - 2
+	return crc.Update16(0, data[:n]) == uint16(data[n])<<8|uint16(data[n+1])
 }
@@ -0,0 +1,225 @@
+// Package crc implements the cyclic redundancy checks of the DMR AI spec.
+package crc
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// CRC-CCITT masks, see DMR AI spec. page 143.
+const (
+	MaskPIHeader   uint16 = 0x6969
+	MaskCSBK       uint16 = 0xa5a5
+	MaskMBCHeader  uint16 = 0xaaaa
+	MaskDataHeader uint16 = 0xcccc
+	MaskUSBD       uint16 = 0x3333
+)
+
+// CRC-9 masks for confirmed data blocks, see DMR AI spec. page 143.
+const (
+	MaskRate12Data uint16 = 0x00f0
+	MaskRate34Data uint16 = 0x01ff
+	MaskRate1Data  uint16 = 0x010f
+)
+
+// Reed-Solomon (12, 9) parity masks of the full LC, applied to each of the
+// three parity octets, see DMR AI spec. page 143.
+const (
+	MaskVoiceLCHeader    uint32 = 0x969696
+	MaskTerminatorWithLC uint32 = 0x999999
+)
+
+// Generator polynomials, most significant bit first.
+const (
+	poly9  = 0x0059     // x^9+x^6+x^4+x^3+1
+	poly16 = 0x1021     // x^16+x^12+x^5+1
+	poly32 = 0x04c11db7 // x^32+x^26+x^23+x^22+x^16+x^12+x^11+x^10+x^8+x^7+x^5+x^4+x^2+x+1
+)
+
+var (
+	table16 [256]uint16
+	table32 [256]uint32
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		var (
+			c16 = uint16(i) << 8
+			c32 = uint32(i) << 24
+		)
+		for j := 0; j < 8; j++ {
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ poly16
+			} else {
+				c16 <<= 1
+			}
+			if c32&0x80000000 != 0 {
+				c32 = c32<<1 ^ poly32
+			} else {
+				c32 <<= 1
+			}
+		}
+		table16[i] = c16
+		table32[i] = c32
+	}
+}
+
+// Update16 returns the CRC-CCITT register after shifting in data, without
+// inversion or mask.
+func Update16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc = crc<<8 ^ table16[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// Update32 returns the 32-bit CRC register after shifting in data, in the
+// passed order.
+func Update32(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ table32[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// Update9 returns the 9-bit CRC register after shifting in the most
+// significant bits of b. Unlike Update16 and Update32 the message enters the
+// register directly, callers shift in 9 zero bits after the message to get
+// the CRC, without inversion or mask.
+func Update9(crc uint16, b uint8, bits int) uint16 {
+	for i := 7; i > 7-bits; i-- {
+		var xor = crc&0x0100 != 0
+		crc = (crc<<1 | uint16(b>>uint(i))&1) & 0x01ff
+		if xor {
+			crc ^= poly9
+		}
+	}
+	return crc
+}
+
+// CRC16 returns the inverted CRC-CCITT of data with the mask applied, as used
+// by data headers and control blocks.
+func CRC16(data []byte, mask uint16) uint16 {
+	return ^Update16(0, data) ^ mask
+}
+
+// Check16 verifies the masked CRC-CCITT stored big endian in the last two
+// bytes of data.
+func Check16(data []byte, mask uint16) bool {
+	if len(data) < 2 {
+		return false
+	}
+	var n = len(data) - 2
+	return CRC16(data[:n], mask) == binary.BigEndian.Uint16(data[n:])
+}
+
+// CRC9 returns the inverted 9-bit CRC over the data octets and the 7-bit
+// serial number of a confirmed data block, with the mask applied.
+func CRC9(data []byte, serial uint8, mask uint16) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = Update9(crc, b, 8)
+	}
+	crc = Update9(crc, serial<<1, 7)
+	for i := 0; i < 9; i++ {
+		crc = Update9(crc, 0, 1)
+	}
+	return (^crc ^ mask) & 0x01ff
+}
+
+// CRC32 returns the 32-bit CRC of a packet data fragment. The CRC is
+// calculated over the octet pairs in swapped order, an odd trailing octet is
+// padded with zero. The result is transmitted little endian.
+func CRC32(data []byte) uint32 {
+	var crc uint32
+	for i := 0; i < len(data); i += 2 {
+		var pair = [2]byte{0, data[i]}
+		if i+1 < len(data) {
+			pair[0] = data[i+1]
+		}
+		crc = Update32(crc, pair[:])
+	}
+	return crc
+}
+
+// Hash16 is the hash.Hash of a masked CRC-CCITT.
+type Hash16 struct {
+	crc  uint16
+	mask uint16
+}
+
+// New16 returns a streaming CRC-CCITT with the mask, the checksum equals
+// CRC16 over all written data.
+func New16(mask uint16) *Hash16 {
+	return &Hash16{mask: mask}
+}
+
+func (h *Hash16) Write(p []byte) (int, error) {
+	h.crc = Update16(h.crc, p)
+	return len(p), nil
+}
+
+// Sum16 returns the checksum of the written data.
+func (h *Hash16) Sum16() uint16 { return ^h.crc ^ h.mask }
+
+// Sum appends the big endian checksum to b.
+func (h *Hash16) Sum(b []byte) []byte {
+	var s = h.Sum16()
+	return append(b, byte(s>>8), byte(s))
+}
+
+func (h *Hash16) Reset()         { h.crc = 0 }
+func (h *Hash16) Size() int      { return 2 }
+func (h *Hash16) BlockSize() int { return 1 }
+
+var _ (hash.Hash) = (*Hash16)(nil)
+
+// Hash32 is the hash.Hash32 of the packet data CRC-32, written data is
+// paired up as for CRC32. An odd octet is held back until the next write or
+// until the checksum is taken.
+type Hash32 struct {
+	crc     uint32
+	odd     byte
+	pending bool
+}
+
+// New32 returns a streaming packet data CRC-32.
+func New32() *Hash32 {
+	return &Hash32{}
+}
+
+func (h *Hash32) Write(p []byte) (int, error) {
+	var n = len(p)
+	if h.pending && len(p) > 0 {
+		h.crc = Update32(h.crc, []byte{p[0], h.odd})
+		h.pending = false
+		p = p[1:]
+	}
+	for ; len(p) >= 2; p = p[2:] {
+		h.crc = Update32(h.crc, []byte{p[1], p[0]})
+	}
+	if len(p) == 1 {
+		h.odd, h.pending = p[0], true
+	}
+	return n, nil
+}
+
+// Sum32 returns the checksum of the written data.
+func (h *Hash32) Sum32() uint32 {
+	if h.pending {
+		return Update32(h.crc, []byte{0, h.odd})
+	}
+	return h.crc
+}
+
+// Sum appends the little endian checksum to b, as transmitted.
+func (h *Hash32) Sum(b []byte) []byte {
+	var s = h.Sum32()
+	return append(b, byte(s), byte(s>>8), byte(s>>16), byte(s>>24))
+}
+
+func (h *Hash32) Reset()         { *h = Hash32{} }
+func (h *Hash32) Size() int      { return 4 }
+func (h *Hash32) BlockSize() int { return 2 }
+
+var _ (hash.Hash32) = (*Hash32)(nil)
@@ -0,0 +1,92 @@
+package crc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	// CRC-CCITT (XMODEM) check value of "123456789" is 0x31c3
+	if got := CRC16([]byte("123456789"), 0); got != ^uint16(0x31c3) {
+		t.Fatalf("CRC16 check failed: %#04x != %#04x", got, ^uint16(0x31c3))
+	}
+
+	// Preamble CSBK as received on air
+	var csbk = []byte{0xbd, 0x00, 0x80, 0x03, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x66, 0x7e}
+	if got := CRC16(csbk[:10], MaskCSBK); got != 0x667e {
+		t.Fatalf("CRC16 CSBK failed: %#04x != %#04x", got, 0x667e)
+	}
+	if !Check16(csbk, MaskCSBK) {
+		t.Fatal("Check16 CSBK failed")
+	}
+	if Check16(csbk, MaskDataHeader) || Check16(csbk[:1], MaskCSBK) {
+		t.Fatal("Check16 accepted an invalid CRC")
+	}
+
+	var h = New16(MaskCSBK)
+	h.Write(csbk[:3])
+	h.Write(csbk[3:10])
+	if got := h.Sum(nil); !bytes.Equal(got, csbk[10:]) {
+		t.Fatalf("Hash16 failed: %x != %x", got, csbk[10:])
+	}
+	h.Reset()
+	if h.Sum16() != ^uint16(0)^MaskCSBK {
+		t.Fatal("Hash16 reset failed")
+	}
+}
+
+func TestCRC9(t *testing.T) {
+	var tests = []struct {
+		Data   []byte
+		Serial uint8
+		Mask   uint16
+		Want   uint16
+	}{
+		{[]byte{}, 0, 0, 0x01ff},
+		{[]byte{}, 0, MaskRate12Data, 0x010f},
+	}
+	for _, test := range tests {
+		if got := CRC9(test.Data, test.Serial, test.Mask); got != test.Want {
+			t.Fatalf("CRC9 %x serial %d failed: %#03x != %#03x", test.Data, test.Serial, got, test.Want)
+		}
+	}
+
+	// A single bit error changes the CRC
+	var data = []byte("hello world, this is a confirmed data block")[:16]
+	var want = CRC9(data, 42, MaskRate34Data)
+	for i := 0; i < len(data)*8; i++ {
+		data[i/8] ^= 0x80 >> uint(i%8)
+		if CRC9(data, 42, MaskRate34Data) == want {
+			t.Fatalf("CRC9 missed bit error %d", i)
+		}
+		data[i/8] ^= 0x80 >> uint(i%8)
+	}
+	if CRC9(data, 43, MaskRate34Data) == want {
+		t.Fatal("CRC9 missed a serial number change")
+	}
+}
+
+func TestCRC32(t *testing.T) {
+	// With swapped octet pairs this is the CRC-32/POSIX of "12345678",
+	// without the final inversion.
+	if got := CRC32([]byte("21436587")); got != 0x20e779a2 {
+		t.Fatalf("CRC32 failed: %#08x != %#08x", got, 0x20e779a2)
+	}
+
+	var data = []byte("hello world, packet data")
+	for _, n := range []int{len(data), len(data) - 1} {
+		var (
+			want = CRC32(data[:n])
+			h    = New32()
+		)
+		h.Write(data[:3])
+		h.Write(data[3:8])
+		h.Write(data[8:n])
+		if got := h.Sum32(); got != want {
+			t.Fatalf("Hash32 of %d bytes failed: %#08x != %#08x", n, got, want)
+		}
+		if got := h.Sum(nil); got[0] != byte(want) || got[3] != byte(want>>24) {
+			t.Fatalf("Hash32 sum of %d bytes is not little endian: %x", n, got)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 // Package quadres_16_7 implements the quadratic residue (16, 7, 6) parity check.
 package quadres_16_7
 
-import "bytes"
+import (
+	"bytes"
+	"fmt"
+)
 
 var (
 	validDataParities = [128][]byte{}
@@ -39,6 +42,19 @@ func ParityBits(bits []byte) []byte {
 	return parity
 }
 
+// Encode returns the 16 bits codeword for the 7 data bits.
+func Encode(bits []byte) []byte {
+	if len(bits) < 7 {
+		return nil
+	}
+
+	var codeword = make([]byte, 16)
+	copy(codeword, bits[:7])
+	copy(codeword[7:], ParityBits(bits))
+	return codeword
+}
+
+// Check verifies the parity bits of the 16 bits codeword.
 func Check(bits []byte) bool {
 	codeword := NewCodeword(bits)
 	if codeword == nil {
@@ -48,13 +64,48 @@ func Check(bits []byte) bool {
 	var dataval uint8
 	for col := uint8(0); col < 7; col++ {
 		if codeword.Data[col] == 1 {
-			dataval |= (1 << (7 - col))
+			dataval |= (1 << (6 - col))
 		}
 	}
 
 	return bytes.Equal(codeword.Parity, validDataParities[dataval])
 }
 
+// Correct corrects up to 2 bit errors in the 16 bits codeword and returns the
+// number of corrected bits. The code has a minimum distance of 6, so 3 bit
+// errors are detected but can't be corrected.
+func Correct(bits []byte) (int, error) {
+	if len(bits) < 16 {
+		return -1, fmt.Errorf("quadres_16_7: expected 16 bits, got %d", len(bits))
+	}
+
+	var (
+		best     = -1
+		distance = 17
+	)
+	for i := 0; i < 128; i++ {
+		var d int
+		for j := 0; j < 7; j++ {
+			d += int(bits[j] ^ (uint8(i>>uint(6-j)) & 1))
+		}
+		for j, p := range validDataParities[i] {
+			d += int(bits[7+j] ^ p)
+		}
+		if d < distance {
+			best, distance = i, d
+		}
+	}
+	if distance > 2 {
+		return -1, fmt.Errorf("quadres_16_7: uncorrectable errors in %v", bits[:16])
+	}
+
+	for j := 0; j < 7; j++ {
+		bits[j] = uint8(best>>uint(6-j)) & 1
+	}
+	copy(bits[7:16], validDataParities[best])
+	return distance, nil
+}
+
 func toBits(b byte) []byte {
 	var o = make([]byte, 8)
 	for bit, mask := 0, byte(128); bit < 8; bit, mask = bit+1, mask>>1 {
@@ -67,7 +118,8 @@ func toBits(b byte) []byte {
 
 func init() {
 	for i := byte(0); i < 128; i++ {
-		bits := toBits(i)
+		// Shift the 7 data bits to the most significant bits.
+		bits := toBits(i << 1)
 		validDataParities[i] = ParityBits(bits)
 	}
 }
@@ -0,0 +1,86 @@
+package quadres_16_7
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	for i := byte(0); i < 128; i++ {
+		bits := toBits(i << 1)[:7]
+		codeword := Encode(bits)
+		if len(codeword) != 16 {
+			t.Fatalf("encode %07b failed: expected 16 bits, got %d", i, len(codeword))
+		}
+		if !Check(codeword) {
+			t.Fatalf("check %07b failed: %v", i, codeword)
+		}
+
+		// Any single bit error must be detected
+		for j := range codeword {
+			codeword[j] ^= 1
+			if Check(codeword) {
+				t.Fatalf("check %07b with bit %d flipped succeeded", i, j)
+			}
+			codeword[j] ^= 1
+		}
+	}
+}
+
+func TestEncodeVectors(t *testing.T) {
+	var tests = map[byte]uint16{
+		0x00: 0x0000,
+		0x01: 0x0273,
+		0x02: 0x04e5,
+		0x03: 0x0696,
+		0x04: 0x09c9,
+		0x05: 0x0bba,
+	}
+
+	for data, want := range tests {
+		codeword := Encode(toBits(data << 1)[:7])
+		var test uint16
+		for _, b := range codeword {
+			test = test<<1 | uint16(b)
+		}
+		if test != want {
+			t.Fatalf("encode %07b failed: %#04x != %#04x", data, test, want)
+		}
+	}
+}
+
+func TestCorrect(t *testing.T) {
+	for i := byte(0); i < 128; i++ {
+		want := Encode(toBits(i << 1)[:7])
+		for j := 0; j < 16; j++ {
+			for k := j; k < 16; k++ {
+				var bits = make([]byte, 16)
+				copy(bits, want)
+				bits[j] ^= 1
+				var flipped = 1
+				if k != j {
+					bits[k] ^= 1
+					flipped++
+				}
+
+				n, err := Correct(bits)
+				if err != nil {
+					t.Fatalf("correct %07b with %d errors failed: %v", i, flipped, err)
+				}
+				if n != flipped || !bytes.Equal(bits, want) {
+					t.Fatalf("correct %07b with %d errors failed: corrected %d bits, %v != %v", i, flipped, n, bits, want)
+				}
+			}
+		}
+
+		// 3 bit errors are detected
+		var bits = make([]byte, 16)
+		copy(bits, want)
+		bits[0] ^= 1
+		bits[8] ^= 1
+		bits[15] ^= 1
+		if _, err := Correct(bits); err == nil {
+			t.Fatalf("correct %07b with 3 errors succeeded", i)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package dmr
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/pd0mz/go-dmr/crc"
+)
 
 func TestCRC9(t *testing.T) {
 	tests := map[uint16][]byte{
@@ -12,11 +16,11 @@ func TestCRC9(t *testing.T) {
 	for want, test := range tests {
 		var crc uint16
 		for _, b := range test {
-			crc9(&crc, b, 8)
+			CRC9(&crc, b, 8)
 		}
-		crc9end(&crc, 8)
+		CRC9End(&crc, 8)
 		if crc != want {
-			t.Fatalf("crc9 %v failed: %#04x != %#04x", test, crc, want)
+			t.Fatalf("CRC9 %v failed: %#04x != %#04x", test, crc, want)
 		}
 	}
 }
@@ -31,11 +35,11 @@ func TestCRC16(t *testing.T) {
 	for want, test := range tests {
 		var crc uint16
 		for _, b := range test {
-			crc16(&crc, b)
+			CRC16(&crc, b)
 		}
-		crc16end(&crc)
+		CRC16End(&crc)
 		if crc != want {
-			t.Fatalf("crc16 %v failed: %#04x != %#04x", test, crc, want)
+			t.Fatalf("CRC16 %v failed: %#04x != %#04x", test, crc, want)
 		}
 	}
 }
@@ -50,11 +54,71 @@ func TestCRC32(t *testing.T) {
 	for want, test := range tests {
 		var crc uint32
 		for _, b := range test {
-			crc32(&crc, b)
+			CRC32(&crc, b)
 		}
-		crc32end(&crc)
+		CRC32End(&crc)
 		if crc != want {
-			t.Fatalf("crc32 %v failed: %#08x != %#08x", test, crc, want)
+			t.Fatalf("CRC32 %v failed: %#08x != %#08x", test, crc, want)
 		}
 	}
 }
+
+func TestCRC16ControlBlock(t *testing.T) {
+	// Preamble CSBK as received on air, the CRC is inverted and masked with
+	// the CSBK CRC mask, see DMR AI spec. page 143.
+	var data = []byte{0xbd, 0x00, 0x80, 0x03, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x66, 0x7e}
+
+	var crc uint16
+	for _, b := range data[:10] {
+		CRC16(&crc, b)
+	}
+	CRC16End(&crc)
+	if crc != 0x3c24 {
+		t.Fatalf("CRC16 %v failed: %#04x != %#04x", data[:10], crc, 0x3c24)
+	}
+	if want := uint16(data[10])<<8 | uint16(data[11]); (^crc)^0xa5a5 != want {
+		t.Fatalf("CRC16 %v failed: %#04x != %#04x", data[:10], (^crc)^0xa5a5, want)
+	}
+}
+
+func TestCheckCRC16(t *testing.T) {
+	tests := map[bool][]byte{
+		true:  []byte{0xbd, 0x00, 0x80, 0x03, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x3c, 0x24},
+		false: []byte{0xbd, 0x00, 0x80, 0x03, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x66, 0x7e},
+	}
+
+	for want, test := range tests {
+		if got := CheckCRC16(test); got != want {
+			t.Fatalf("CheckCRC16 %v failed: %t != %t", test, got, want)
+		}
+	}
+	if CheckCRC16([]byte{0x00}) {
+		t.Fatal("CheckCRC16 accepted a single byte")
+	}
+}
+
+func TestCRCPackage(t *testing.T) {
+	var data = []byte("hello world, packet data block")
+	for serial := uint8(0); serial < 128; serial += 9 {
+		var want uint16
+		for _, b := range data[:16] {
+			CRC9(&want, b, 8)
+		}
+		CRC9(&want, serial, 7)
+		CRC9End(&want, 8)
+		want = (^want & 0x01ff) ^ crc.MaskRate34Data
+		if got := crc.CRC9(data[:16], serial, crc.MaskRate34Data); got != want {
+			t.Fatalf("crc.CRC9 serial %d failed: %#03x != %#03x", serial, got, want)
+		}
+	}
+
+	var want uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		CRC32(&want, data[i+1])
+		CRC32(&want, data[i])
+	}
+	CRC32End(&want)
+	if got := crc.CRC32(data); got != want {
+		t.Fatalf("crc.CRC32 failed: %#08x != %#08x", got, want)
+	}
+}
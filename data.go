@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/pd0mz/go-dmr/crc"
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/unicode"
@@ -15,6 +16,13 @@ const (
 	MaxPacketFragmentSize = 1500
 )
 
+// CRC masks for confirmed data blocks, see DMR AI spec. page 143.
+const (
+	Rate12DataCRCMask = crc.MaskRate12Data
+	Rate34DataCRCMask = crc.MaskRate34Data
+	Rate1DataCRCMask  = crc.MaskRate1Data
+)
+
 type DataBlock struct {
 	Serial uint8
 	CRC    uint16
@@ -23,35 +31,29 @@ type DataBlock struct {
 	Length uint8
 }
 
+// ParseDataBlock parses a data block as returned by the BPTC (rate ½) or
+// Trellis (rate ¾) decoder. Confirmed blocks start with the 7-bit serial
+// number and the 9-bit CRC, which is checked.
 func ParseDataBlock(data []byte, dataType uint8, confirmed bool) (*DataBlock, error) {
-	var (
-		crc uint16
-		db  = &DataBlock{
-			Length: dataBlockLength(dataType, confirmed),
-		}
-	)
+	var db = &DataBlock{
+		Length: dataBlockLength(dataType, confirmed),
+	}
+	if db.Length == 0 {
+		return nil, fmt.Errorf("dmr/data block: unsupported data type %s (%d)", DataTypeName[dataType], dataType)
+	}
+	var size = int(dataBlockLength(dataType, false))
+	if len(data) < size {
+		return nil, fmt.Errorf("dmr/data block: expected %d bytes, got %d", size, len(data))
+	}
 
+	db.Data = make([]byte, db.Length)
 	if confirmed {
 		db.Serial = data[0] >> 1
 		db.CRC = uint16(data[0]&B00000001)<<8 | uint16(data[1])
-		db.Data = make([]byte, db.Length)
 		copy(db.Data, data[2:2+db.Length])
 
-		for _, block := range db.Data {
-			crc9(&crc, block, 8)
-		}
-		crc9(&crc, db.Serial, 7)
-		crc9end(&crc, 8)
-
-		// Inverting according to the inversion polynomial.
-		crc = ^crc
-		crc &= 0x01ff
-		// Applying CRC mask, see DMR AI spec. page 143
-		crc ^= 0x01ff
-
-		// FIXME(pd0mz): this is not working
-		if crc != db.CRC {
-			return nil, fmt.Errorf("dmr: block CRC error (%#04x != %#04x)", crc, db.CRC)
+		if crc := dataBlockCRC(db.Data, db.Serial, dataType); crc != db.CRC {
+			return nil, fmt.Errorf("dmr/data block: CRC error (%#04x != %#04x)", crc, db.CRC)
 		}
 	} else {
 		copy(db.Data, data[:db.Length])
@@ -61,25 +63,24 @@ func ParseDataBlock(data []byte, dataType uint8, confirmed bool) (*DataBlock, er
 	return db, nil
 }
 
+// ParseDataBlockBits is like ParseDataBlock, for data bits, such as the 96 bits
+// returned by bptc.DecodeBits.
+func ParseDataBlockBits(bits []byte, dataType uint8, confirmed bool) (*DataBlock, error) {
+	if len(bits)%8 != 0 {
+		return nil, fmt.Errorf("dmr/data block: expected a multiple of 8 bits, got %d", len(bits))
+	}
+	return ParseDataBlock(BitsToBytes(bits), dataType, confirmed)
+}
+
+// Bytes encodes the data block, for confirmed blocks the CRC is updated.
 func (db *DataBlock) Bytes(dataType uint8, confirmed bool) []byte {
 	var (
-		size = dataBlockLength(dataType, confirmed)
+		size = dataBlockLength(dataType, false)
 		data = make([]byte, size)
 	)
 
 	if confirmed {
-		for _, block := range db.Data {
-			crc9(&db.CRC, block, 8)
-		}
-		crc9(&db.CRC, db.Serial, 7)
-		crc9end(&db.CRC, 8)
-
-		// Inverting according to the inversion polynomial.
-		db.CRC = ^db.CRC
-		db.CRC &= 0x01ff
-		// Applying CRC mask, see DMR AI spec. page 143
-		db.CRC ^= 0x01ff
-
+		db.CRC = dataBlockCRC(db.Data, db.Serial, dataType)
 		data[0] = (db.Serial << 1) | (uint8(db.CRC>>8) & 0x01)
 		data[1] = uint8(db.CRC)
 		copy(data[2:], db.Data)
@@ -90,6 +91,24 @@ func (db *DataBlock) Bytes(dataType uint8, confirmed bool) []byte {
 	return data
 }
 
+// dataBlockCRC calculates the CRC-9 over the data octets and the 7-bit serial
+// number of a confirmed data block.
+func dataBlockCRC(data []byte, serial uint8, dataType uint8) uint16 {
+	var mask uint16
+	switch dataType {
+	case Rate12Data:
+		mask = Rate12DataCRCMask
+		break
+	case Rate34Data:
+		mask = Rate34DataCRCMask
+		break
+	case Data:
+		mask = Rate1DataCRCMask
+		break
+	}
+	return crc.CRC9(data, serial, mask)
+}
+
 func dataBlockLength(dataType uint8, confirmed bool) uint8 {
 	var size uint8
 
@@ -120,14 +139,19 @@ type DataFragment struct {
 	CRC    uint32
 }
 
+// DataBlocks splits the fragment in data blocks with serial numbers and block
+// CRCs, the last block carries the fragment CRC-32.
 func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock, error) {
+	// See DMR AI spec. page. 73. for block sizes.
+	var size = int(dataBlockLength(dataType, confirm))
+	if size == 0 {
+		return nil, fmt.Errorf("dmr/data block: unsupported data type %s (%d)", DataTypeName[dataType], dataType)
+	}
+
 	df.Stored = len(df.Data)
 	if df.Stored > MaxPacketFragmentSize {
 		df.Stored = MaxPacketFragmentSize
 	}
-
-	// See DMR AI spec. page. 73. for block sizes.
-	var size = int(dataBlockLength(dataType, confirm))
 	df.Needed = (df.Stored + size - 1) / size
 
 	// Leave enough room for the 4 bytes CRC32
@@ -135,20 +159,10 @@ func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock,
 		df.Needed++
 	}
 
-	// Calculate fragment CRC32
-	for i := 0; i < (df.Needed*size)-4; i += 2 {
-		if i+1 < df.Stored {
-			crc32(&df.CRC, df.Data[i+1])
-		} else {
-			crc32(&df.CRC, 0)
-		}
-		if i < df.Stored {
-			crc32(&df.CRC, df.Data[i])
-		} else {
-			crc32(&df.CRC, 0)
-		}
-	}
-	crc32end(&df.CRC)
+	// Calculate fragment CRC32 over the data and the pad octets
+	var padded = make([]byte, (df.Needed*size)-4)
+	copy(padded, df.Data[:df.Stored])
+	df.CRC = crc.CRC32(padded)
 
 	var (
 		blocks = make([]*DataBlock, df.Needed)
@@ -163,7 +177,7 @@ func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock,
 
 		store := int(block.Length)
 		if df.Stored-stored < store {
-			store = df.Stored - store
+			store = df.Stored - stored
 		}
 		copy(block.Data, df.Data[stored:stored+store])
 		stored += store
@@ -175,19 +189,9 @@ func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock,
 			block.Data[block.Length-4] = uint8(df.CRC)
 		}
 
-		// Calculate block CRC9
-		block.CRC = 0
-		for _, b := range block.Data {
-			crc9(&block.CRC, b, 8)
+		if confirm {
+			block.CRC = dataBlockCRC(block.Data, block.Serial, dataType)
 		}
-		crc9(&block.CRC, block.Serial, 7)
-		crc9end(&block.CRC, 8)
-
-		// Inverting according to the inversion polynomial
-		block.CRC = ^block.CRC
-		block.CRC &= 0x01ff
-		// Applying CRC mask, see DMR AI spec. page 143
-		block.CRC ^= 0x01ff
 
 		blocks[i] = block
 	}
@@ -195,6 +199,40 @@ func (df *DataFragment) DataBlocks(dataType uint8, confirm bool) ([]*DataBlock,
 	return blocks, nil
 }
 
+// PadOctets returns the number of pad octets between the data and the CRC-32
+// in the last block, as announced in the data header. Only valid after
+// calling DataBlocks.
+func (df *DataFragment) PadOctets(dataType uint8, confirm bool) int {
+	return df.Needed*int(dataBlockLength(dataType, confirm)) - 4 - df.Stored
+}
+
+// Fragmenter splits payloads in encoded data blocks for transmission.
+type Fragmenter struct {
+	DataType  uint8
+	Confirmed bool
+}
+
+// Fragment splits the payload in encoded data blocks, ready to be passed to
+// the BPTC (rate ½) or Trellis (rate ¾) encoder. Also returns the number of
+// pad octets for the data header.
+func (f Fragmenter) Fragment(data []byte) ([][]byte, int, error) {
+	if len(data) > MaxPacketFragmentSize {
+		return nil, 0, fmt.Errorf("dmr/data block: payload of %d bytes exceeds maximum of %d", len(data), MaxPacketFragmentSize)
+	}
+
+	var df = &DataFragment{Data: data}
+	blocks, err := df.DataBlocks(f.DataType, f.Confirmed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var encoded = make([][]byte, len(blocks))
+	for i, block := range blocks {
+		encoded[i] = block.Bytes(f.DataType, f.Confirmed)
+	}
+	return encoded, df.PadOctets(f.DataType, f.Confirmed), nil
+}
+
 func CombineDataBlocks(blocks []*DataBlock) (*DataFragment, error) {
 	if blocks == nil || len(blocks) == 0 {
 		return nil, errors.New("dmr: no data blocks to combine")
@@ -225,15 +263,12 @@ func CombineDataBlocks(blocks []*DataBlock) (*DataFragment, error) {
 		}
 	}
 
-	var crc uint32
-	for i := 0; i < f.Stored-4; i += 2 {
-		crc32(&crc, f.Data[i+1])
-		crc32(&crc, f.Data[i])
+	var checksum uint32
+	if f.Stored > 4 {
+		checksum = crc.CRC32(f.Data[:f.Stored-4])
 	}
-	crc32end(&crc)
-
-	if crc != f.CRC {
-		return nil, fmt.Errorf("dmr: fragment CRC error (%#08x != %#08x)", crc, f.CRC)
+	if checksum != f.CRC {
+		return nil, fmt.Errorf("dmr: fragment CRC error (%#08x != %#08x)", checksum, f.CRC)
 	}
 	return f, nil
 }
@@ -275,6 +310,7 @@ func ParseMessageData(data []byte, ddFormat uint8, nullTerminated bool) (string,
 func init() {
 	encodingMap = map[uint8]encoding.Encoding{
 		DDFormatBinary:         binaryEncoding{},
+		DDFormat8BitISO8859_1:  charmap.ISO8859_1,
 		DDFormat8BitISO8859_2:  charmap.ISO8859_2,
 		DDFormat8BitISO8859_3:  charmap.ISO8859_3,
 		DDFormat8BitISO8859_4:  charmap.ISO8859_4,
@@ -282,6 +318,7 @@ func init() {
 		DDFormat8BitISO8859_6:  charmap.ISO8859_6,
 		DDFormat8BitISO8859_7:  charmap.ISO8859_7,
 		DDFormat8BitISO8859_8:  charmap.ISO8859_8,
+		DDFormat8BitISO8859_9:  charmap.ISO8859_9,
 		DDFormat8BitISO8859_10: charmap.ISO8859_10,
 		DDFormat8BitISO8859_13: charmap.ISO8859_13,
 		DDFormat8BitISO8859_14: charmap.ISO8859_14,
@@ -19,7 +19,8 @@ func TestDataBlock(t *testing.T) {
 	if data == nil {
 		t.Fatal("encode failed")
 	}
-	size := int(dataBlockLength(Rate34Data, true))
+	// Encoded blocks include the serial and CRC
+	size := int(dataBlockLength(Rate34Data, false))
 	if len(data) != size {
 		t.Fatalf("encode failed: expected %d bytes, got %d", size, len(data))
 	}
@@ -91,3 +92,50 @@ func TestMessage(t *testing.T) {
 		t.Log(fmt.Sprintf("decoder:\n%s", hex.Dump([]byte(out))))
 	}
 }
+
+func TestFragmenter(t *testing.T) {
+	msg, err := BuildMessageData("CQCQCQ PD0MZ de PD0ZRY", DDFormatUTF16, true)
+	if err != nil {
+		t.Fatalf("build message failed: %v", err)
+	}
+
+	for _, dataType := range []uint8{Rate12Data, Rate34Data} {
+		for _, confirmed := range []bool{false, true} {
+			f := Fragmenter{DataType: dataType, Confirmed: confirmed}
+			encoded, pad, err := f.Fragment(msg)
+			if err != nil {
+				t.Fatalf("fragment failed: %v", err)
+			}
+			size := int(dataBlockLength(dataType, confirmed))
+			if want := len(encoded)*size - 4 - len(msg); pad != want || pad < 0 {
+				t.Fatalf("fragment failed: expected %d pad octets, got %d", want, pad)
+			}
+
+			var blocks = make([]*DataBlock, len(encoded))
+			for i, data := range encoded {
+				bits := BytesToBits(data)
+				if blocks[i], err = ParseDataBlockBits(bits, dataType, confirmed); err != nil {
+					t.Fatalf("decode %s block %d failed: %v", DataTypeName[dataType], i, err)
+				}
+				if confirmed && blocks[i].Serial != uint8(i) {
+					t.Fatalf("decode %s block %d failed: serial %d", DataTypeName[dataType], i, blocks[i].Serial)
+				}
+
+				if confirmed {
+					data[4] ^= 0x10
+					if _, err := ParseDataBlock(data, dataType, confirmed); err == nil {
+						t.Fatalf("decode %s block %d with bit error did not fail", DataTypeName[dataType], i)
+					}
+				}
+			}
+
+			test, err := CombineDataBlocks(blocks)
+			if err != nil {
+				t.Fatalf("combine %s failed: %v", DataTypeName[dataType], err)
+			}
+			if !bytes.Equal(test.Data[:len(msg)], msg) {
+				t.Fatalf("combine %s failed: data is wrong", DataTypeName[dataType])
+			}
+		}
+	}
+}
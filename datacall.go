@@ -0,0 +1,287 @@
+package dmr
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDataCallTimeout is the time after the last data block after which an
+// incomplete data call is dropped.
+const DefaultDataCallTimeout = time.Second * 2
+
+// DataCall is a completed data call.
+type DataCall struct {
+	SrcID    uint32
+	DstID    uint32
+	Timeslot uint8
+	Header   *DataHeader
+	Data     []byte // Payload without padding and CRC-32
+}
+
+// ServiceAccessPoint returns the SAP of the data call, see ServiceAccessPoint* constants.
+func (c *DataCall) ServiceAccessPoint() uint8 {
+	return c.Header.ServiceAccessPoint
+}
+
+// DataCallStats contains the counters of a DataCallAssembler.
+type DataCallStats struct {
+	Completed       uint64
+	CRCErrors       uint64
+	Retransmissions uint64
+	Timeouts        uint64
+}
+
+// DataCallAssembler tracks data calls per source, destination, timeslot and
+// stream. It consumes the data header and the decoded data blocks, and calls
+// OnData with the reassembled payload if all blocks are received and the
+// CRC-32 is valid. The CRC-16 of the appended blocks of an UDT header is not
+// checked.
+type DataCallAssembler struct {
+	Timeout time.Duration
+
+	// OnData is called with every completed data call.
+	OnData func(call *DataCall)
+	// OnDataError is called for data calls that can't be reassembled, because
+	// blocks were lost or failed their CRC, because a new data header
+	// interrupted the call, or because the call timed out. Timed out calls
+	// are reported from the goroutine of their timer.
+	OnDataError func(srcID, dstID uint32, err error)
+
+	stats *DataCallStats
+	mutex *sync.Mutex
+	calls map[dataCallKey]*dataCall
+}
+
+type dataCallKey struct {
+	srcID, dstID uint32
+	timeslot     uint8
+	streamID     uint32
+}
+
+type dataCall struct {
+	header    *DataHeader
+	confirmed bool
+	expected  int
+	received  int                  // Blocks received, including lost ones
+	blocks    map[uint8]*DataBlock // Blocks by serial number
+	timer     *time.Timer
+}
+
+// NewDataCallAssembler returns a data call assembler with the default timeout.
+func NewDataCallAssembler(fn func(call *DataCall)) *DataCallAssembler {
+	return &DataCallAssembler{
+		Timeout: DefaultDataCallTimeout,
+		OnData:  fn,
+		stats:   &DataCallStats{},
+		mutex:   &sync.Mutex{},
+		calls:   make(map[dataCallKey]*dataCall),
+	}
+}
+
+// Stats returns a snapshot of the assembler counters.
+func (a *DataCallAssembler) Stats() DataCallStats {
+	return DataCallStats{
+		Completed:       atomic.LoadUint64(&a.stats.Completed),
+		CRCErrors:       atomic.LoadUint64(&a.stats.CRCErrors),
+		Retransmissions: atomic.LoadUint64(&a.stats.Retransmissions),
+		Timeouts:        atomic.LoadUint64(&a.stats.Timeouts),
+	}
+}
+
+// AddHeader starts a data call for the packet, an incomplete call of the
+// same stream is dropped. Headers that are not followed by data blocks are
+// ignored. A confirmed data header that is repeated for an active call is
+// considered a retransmission and keeps the received blocks.
+func (a *DataCallAssembler) AddHeader(p *Packet, h *DataHeader) error {
+	if p == nil || h == nil {
+		return nil
+	}
+
+	var call = &dataCall{
+		header:   h,
+		expected: int(h.BlocksToFollow()),
+		blocks:   make(map[uint8]*DataBlock),
+	}
+	_, call.confirmed = h.Data.(*ConfirmedData)
+
+	var (
+		key         = dataCallKey{p.SrcID, p.DstID, p.Timeslot, p.StreamID}
+		interrupted error
+	)
+	a.mutex.Lock()
+	if active, ok := a.calls[key]; ok {
+		if active.confirmed && call.confirmed && active.expected == call.expected {
+			atomic.AddUint64(&a.stats.Retransmissions, 1)
+			active.header = h
+			active.timer.Reset(a.timeout())
+			a.mutex.Unlock()
+			return nil
+		}
+		active.timer.Stop()
+		delete(a.calls, key)
+		interrupted = fmt.Errorf("dmr/data call: interrupted after %d of %d blocks", active.received, active.expected)
+	}
+	if call.expected > 0 {
+		call.timer = time.AfterFunc(a.timeout(), func() { a.expire(key, call) })
+		a.calls[key] = call
+	}
+	a.mutex.Unlock()
+
+	if interrupted != nil {
+		a.fail(key, interrupted)
+	}
+	return nil
+}
+
+// AddBlock adds a data block, as returned by the BPTC (rate ½) or Trellis
+// (rate ¾) decoder, to the data call of the packet, see AddDataBlock.
+func (a *DataCallAssembler) AddBlock(p *Packet, data []byte) error {
+	if p == nil {
+		return nil
+	}
+	return a.AddDataBlock(p, p.DataType, data)
+}
+
+// AddDataBlock adds a data block of the data type to the data call of the
+// packet. Blocks without an active data call are ignored. A block that
+// can't be parsed is counted as lost, unconfirmed data calls complete when
+// all their blocks are received or lost, confirmed data calls when all their
+// blocks are received. The error of the block or of the completed call is
+// returned, failed calls are also passed to OnDataError.
+func (a *DataCallAssembler) AddDataBlock(p *Packet, dataType uint8, data []byte) error {
+	if p == nil {
+		return nil
+	}
+
+	var key = dataCallKey{p.SrcID, p.DstID, p.Timeslot, p.StreamID}
+	a.mutex.Lock()
+	call, ok := a.calls[key]
+	if !ok {
+		a.mutex.Unlock()
+		return nil
+	}
+
+	call.received++
+	call.timer.Reset(a.timeout())
+	db, err := ParseDataBlock(data, dataType, call.confirmed)
+	if err != nil {
+		atomic.AddUint64(&a.stats.CRCErrors, 1)
+	} else if call.confirmed {
+		if _, ok := call.blocks[db.Serial]; ok {
+			atomic.AddUint64(&a.stats.Retransmissions, 1)
+		}
+		call.blocks[db.Serial] = db
+	} else {
+		// Unconfirmed blocks have no serial, they are received in order
+		db.Serial = uint8(call.received - 1)
+		call.blocks[db.Serial] = db
+	}
+
+	if len(call.blocks) < call.expected && (call.confirmed || call.received < call.expected) {
+		a.mutex.Unlock()
+		return err
+	}
+	call.timer.Stop()
+	delete(a.calls, key)
+	a.mutex.Unlock()
+
+	if cerr := a.complete(key, call); cerr != nil {
+		a.fail(key, cerr)
+		return cerr
+	}
+	return err
+}
+
+func (a *DataCallAssembler) complete(key dataCallKey, call *dataCall) error {
+	var serials = make([]int, 0, len(call.blocks))
+	for serial := range call.blocks {
+		serials = append(serials, int(serial))
+	}
+	sort.Ints(serials)
+
+	var blocks = make([]*DataBlock, 0, call.expected)
+	for i, serial := range serials {
+		if serial != i || i >= call.expected {
+			break
+		}
+		blocks = append(blocks, call.blocks[uint8(serial)])
+	}
+	if len(blocks) < call.expected {
+		return fmt.Errorf("dmr/data call: %d of %d blocks lost", call.expected-len(blocks), call.expected)
+	}
+
+	var data []byte
+	if udt, ok := call.header.Data.(*UDTData); ok {
+		// Appended blocks end with a CRC-16, the pad is counted in nibbles
+		var appended []byte
+		for _, block := range blocks {
+			appended = append(appended, block.Data[:block.Length]...)
+		}
+		var bits = (len(appended)-2)*8 - int(udt.PadNibble)*4
+		if bits < 0 {
+			return fmt.Errorf("dmr/data call: %d pad nibbles exceed %d bytes of data", udt.PadNibble, len(appended)-2)
+		}
+		data = appended[:(bits+7)/8]
+	} else {
+		f, err := CombineDataBlocks(blocks)
+		if err != nil {
+			atomic.AddUint64(&a.stats.CRCErrors, 1)
+			return err
+		}
+
+		var (
+			pad  = int(call.header.PadOctetCount())
+			size = f.Stored - 4 - pad
+		)
+		if size < 0 {
+			return fmt.Errorf("dmr/data call: %d pad octets exceed %d bytes of data", pad, f.Stored-4)
+		}
+		data = make([]byte, size)
+		copy(data, f.Data[:size])
+	}
+
+	atomic.AddUint64(&a.stats.Completed, 1)
+	if a.OnData != nil {
+		a.OnData(&DataCall{
+			SrcID:    key.srcID,
+			DstID:    key.dstID,
+			Timeslot: key.timeslot,
+			Header:   call.header,
+			Data:     data,
+		})
+	}
+	return nil
+}
+
+// expire drops call, unless another call for the same key started.
+func (a *DataCallAssembler) expire(key dataCallKey, call *dataCall) {
+	a.mutex.Lock()
+	active, ok := a.calls[key]
+	if !ok || active != call {
+		a.mutex.Unlock()
+		return
+	}
+	delete(a.calls, key)
+	atomic.AddUint64(&a.stats.Timeouts, 1)
+	var err = fmt.Errorf("dmr/data call: timed out after %d of %d blocks", call.received, call.expected)
+	a.mutex.Unlock()
+
+	a.fail(key, err)
+}
+
+// fail reports a failed call, the caller must not hold the mutex.
+func (a *DataCallAssembler) fail(key dataCallKey, err error) {
+	if a.OnDataError != nil {
+		a.OnDataError(key.srcID, key.dstID, err)
+	}
+}
+
+func (a *DataCallAssembler) timeout() time.Duration {
+	if a.Timeout <= 0 {
+		return DefaultDataCallTimeout
+	}
+	return a.Timeout
+}
@@ -0,0 +1,148 @@
+package dmr
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDataCallAssembler(t *testing.T) {
+	msg, err := BuildMessageData("CQCQCQ PD0MZ de PD0ZRY", DDFormatUTF16, true)
+	if err != nil {
+		t.Fatalf("build message failed: %v", err)
+	}
+
+	for _, confirmed := range []bool{false, true} {
+		var (
+			dataType = Rate12Data
+			f        = Fragmenter{DataType: dataType, Confirmed: confirmed}
+		)
+		blocks, pad, err := f.Fragment(msg)
+		if err != nil {
+			t.Fatalf("fragment failed: %v", err)
+		}
+
+		var h = &DataHeader{
+			PacketFormat:       PacketFormatUnconfirmedData,
+			ServiceAccessPoint: ServiceAccessPointShortData,
+			Data: &UnconfirmedData{
+				PadOctetCount:  uint8(pad),
+				FullMessage:    true,
+				BlocksToFollow: uint8(len(blocks)),
+			},
+		}
+		if confirmed {
+			h.PacketFormat = PacketFormatConfirmedData
+			h.Data = &ConfirmedData{
+				PadOctetCount:  uint8(pad),
+				FullMessage:    true,
+				BlocksToFollow: uint8(len(blocks)),
+			}
+		}
+
+		var (
+			got []*DataCall
+			a   = NewDataCallAssembler(func(call *DataCall) { got = append(got, call) })
+			p   = &Packet{Timeslot: 1, SrcID: 2042214, DstID: 2043044, DataType: dataType}
+		)
+		if err := a.AddHeader(p, h); err != nil {
+			t.Fatalf("add header failed: %v", err)
+		}
+
+		var order = []int{}
+		for i := range blocks {
+			order = append(order, i)
+		}
+		if confirmed {
+			// Blocks arrive out of order, the first one is retransmitted and one
+			// is received with a bit error
+			order = append([]int{1, 0, 0}, order[2:]...)
+
+			var corrupt = make([]byte, len(blocks[2]))
+			copy(corrupt, blocks[2])
+			corrupt[5] ^= 0x01
+			if err := a.AddBlock(p, corrupt); err == nil {
+				t.Fatal("add block with bit error did not fail")
+			}
+		}
+		for _, i := range order {
+			if err := a.AddBlock(p, blocks[i]); err != nil {
+				t.Fatalf("add block %d failed: %v", i, err)
+			}
+		}
+
+		if len(got) != 1 {
+			t.Fatalf("expected 1 data call, got %d", len(got))
+		}
+		if !bytes.Equal(got[0].Data, msg) {
+			t.Fatalf("expected %x, got %x", msg, got[0].Data)
+		}
+		if got[0].ServiceAccessPoint() != ServiceAccessPointShortData || got[0].SrcID != p.SrcID || got[0].Timeslot != 1 {
+			t.Fatalf("data call has wrong header")
+		}
+
+		var s = a.Stats()
+		switch {
+		case s.Completed != 1:
+			t.Fatalf("expected 1 completed call, got %d", s.Completed)
+
+		case confirmed && (s.Retransmissions != 1 || s.CRCErrors != 1):
+			t.Fatalf("expected 1 retransmission and 1 CRC error, got %d and %d", s.Retransmissions, s.CRCErrors)
+		}
+	}
+}
+
+func TestDataCallAssemblerTimeout(t *testing.T) {
+	var (
+		a = NewDataCallAssembler(func(*DataCall) { t.Fatal("unexpected data call") })
+		p = &Packet{Timeslot: 1, SrcID: 2042214, DstID: 2043044, DataType: Rate12Data}
+		h = &DataHeader{
+			PacketFormat: PacketFormatUnconfirmedData,
+			Data:         &UnconfirmedData{BlocksToFollow: 2},
+		}
+	)
+	a.Timeout = time.Millisecond * 10
+	if err := a.AddHeader(p, h); err != nil {
+		t.Fatalf("add header failed: %v", err)
+	}
+	time.Sleep(a.Timeout * 5)
+
+	if s := a.Stats(); s.Timeouts != 1 {
+		t.Fatalf("expected 1 timeout, got %d", s.Timeouts)
+	}
+	if err := a.AddBlock(p, make([]byte, 12)); err != nil {
+		t.Fatalf("add block after timeout failed: %v", err)
+	}
+}
+
+func TestDataCallAssemblerUDT(t *testing.T) {
+	var (
+		got  []*DataCall
+		errs []error
+		a    = NewDataCallAssembler(func(call *DataCall) { got = append(got, call) })
+		p    = &Packet{Timeslot: 1, SrcID: 2042214, DstID: 2043044, StreamID: 1, DataType: Rate12Data}
+		h    = &DataHeader{
+			PacketFormat: PacketFormatUDT,
+			Data:         &UDTData{Format: UDTFormatISO_8BitChars, AppendedBlocks: 1, PadNibble: 12},
+		}
+		// 16 octets of text, 6 pad octets and the CRC-16 in two blocks
+		appended = append([]byte("CQCQCQ de PD0MZ "), make([]byte, 8)...)
+	)
+	a.OnDataError = func(_, _ uint32, err error) { errs = append(errs, err) }
+	if err := a.AddHeader(p, h); err != nil {
+		t.Fatalf("add header failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := a.AddBlock(p, appended[i*12:(i+1)*12]); err != nil {
+			t.Fatalf("add block %d failed: %v", i, err)
+		}
+	}
+	switch {
+	case len(errs) != 0:
+		t.Fatalf("unexpected errors %v", errs)
+	case len(got) != 1:
+		t.Fatalf("expected 1 data call, got %d", len(got))
+	case string(got[0].Data) != "CQCQCQ de PD0MZ ":
+		t.Fatalf("expected %q, got %q", "CQCQCQ de PD0MZ ", got[0].Data)
+	}
+}
@@ -3,8 +3,18 @@ package dmr
 import (
 	"fmt"
 	"strings"
+
+	"github.com/pd0mz/go-dmr/bit"
+	"github.com/pd0mz/go-dmr/crc"
 )
 
+// DataHeaderSize is the size of a data header including its CRC.
+const DataHeaderSize = 12
+
+// DataHeaderBits is the size of a data header in bits, the info bits of a
+// data header burst after BPTC(196, 96) decoding.
+const DataHeaderBits = DataHeaderSize * 8
+
 // Data Header Packet Format
 const (
 	PacketFormatUDT              uint8 = iota // 0b0000
@@ -210,25 +220,31 @@ type DataHeader struct {
 }
 
 func (h *DataHeader) Bytes() ([]byte, error) {
-	var data = make([]byte, 12)
+	var data = make([]byte, DataHeaderSize)
 
-	data[0] = (h.PacketFormat & B00001111)
-	if h.DstIsGroup {
-		data[0] |= B10000000
-	}
-	if h.ResponseRequested {
-		data[0] |= B01000000
-	}
-	if h.HeaderCompression {
-		data[0] |= B00100000
+	if h.PacketFormat == PacketFormatProprietaryData {
+		// The proprietary header carries the SAP in the first octet and has no
+		// addressing, see DMR AI spec. section 9.2.9.
+		data[0] = (h.ServiceAccessPoint&B00001111)<<4 | PacketFormatProprietaryData
+	} else {
+		data[0] = (h.PacketFormat & B00001111)
+		if h.DstIsGroup {
+			data[0] |= B10000000
+		}
+		if h.ResponseRequested {
+			data[0] |= B01000000
+		}
+		if h.HeaderCompression {
+			data[0] |= B00100000
+		}
+		data[1] = (h.ServiceAccessPoint & B00001111) << 4
+		data[2] = uint8(h.DstID >> 16)
+		data[3] = uint8(h.DstID >> 8)
+		data[4] = uint8(h.DstID)
+		data[5] = uint8(h.SrcID >> 16)
+		data[6] = uint8(h.SrcID >> 8)
+		data[7] = uint8(h.SrcID)
 	}
-	data[1] = (h.ServiceAccessPoint & B00001111)
-	data[2] = uint8(h.DstID >> 16)
-	data[3] = uint8(h.DstID >> 8)
-	data[4] = uint8(h.DstID)
-	data[5] = uint8(h.SrcID >> 16)
-	data[6] = uint8(h.SrcID >> 8)
-	data[7] = uint8(h.SrcID)
 
 	if h.Data != nil {
 		if err := h.Data.Write(data); err != nil {
@@ -236,16 +252,7 @@ func (h *DataHeader) Bytes() ([]byte, error) {
 		}
 	}
 
-	h.CRC = 0
-	for i := 0; i < 10; i++ {
-		crc16(&h.CRC, data[i])
-	}
-	crc16end(&h.CRC)
-
-	// Inverting according to the inversion polynomial.
-	h.CRC = ^h.CRC
-	// Applying CRC mask, see DMR AI spec. page 143.
-	h.CRC ^= 0xcccc
+	h.CRC = crc.CRC16(data[:10], crc.MaskDataHeader)
 
 	data[10] = uint8(h.CRC >> 8)
 	data[11] = uint8(h.CRC)
@@ -253,6 +260,46 @@ func (h *DataHeader) Bytes() ([]byte, error) {
 	return data, nil
 }
 
+// BlocksToFollow returns the number of data blocks that follow the header,
+// or zero for headers that are not followed by data blocks.
+func (h *DataHeader) BlocksToFollow() uint8 {
+	switch d := h.Data.(type) {
+	case *UDTData:
+		// The UDT appended blocks field counts from one block
+		return d.AppendedBlocks + 1
+	case *ResponseData:
+		return d.BlocksToFollow
+	case *UnconfirmedData:
+		return d.BlocksToFollow
+	case *ConfirmedData:
+		return d.BlocksToFollow
+	case *ShortDataRawData:
+		return d.AppendedBlocks
+	case *ShortDataDefinedData:
+		return d.AppendedBlocks
+	}
+	return 0
+}
+
+// PadOctetCount returns the number of pad octets at the end of the data
+// blocks that follow the header. For short data the bit padding and for UDT
+// the pad nibbles are rounded down to octets.
+func (h *DataHeader) PadOctetCount() uint8 {
+	switch d := h.Data.(type) {
+	case *UDTData:
+		return d.PadNibble / 2
+	case *UnconfirmedData:
+		return d.PadOctetCount
+	case *ConfirmedData:
+		return d.PadOctetCount
+	case *ShortDataRawData:
+		return d.BitPadding / 8
+	case *ShortDataDefinedData:
+		return d.BitPadding / 8
+	}
+	return 0
+}
+
 func (h DataHeader) String() string {
 	var part = []string{"data header"}
 	if h.DstIsGroup {
@@ -272,7 +319,7 @@ func (h DataHeader) String() string {
 type UDTData struct {
 	Format            uint8
 	PadNibble         uint8
-	AppendedBlocks    uint8
+	AppendedBlocks    uint8 // Number of appended blocks minus one
 	SupplementaryFlag bool
 	Opcode            uint8
 }
@@ -336,7 +383,7 @@ func (d ConfirmedData) Write(data []byte) error {
 	if d.FullMessage {
 		data[8] |= B10000000
 	}
-	data[9] = (d.FragmentSequenceNumber&B00000111)<<0 | (d.SendSequenceNumber&B00000111)<<4
+	data[9] = (d.FragmentSequenceNumber & B00001111) | (d.SendSequenceNumber&B00000111)<<4
 	if d.Resync {
 		data[9] |= B10000000
 	}
@@ -362,15 +409,20 @@ func (d ResponseData) Write(data []byte) error {
 
 type ProprietaryData struct {
 	ManufacturerID uint8
+	Data           []byte // 8 bytes
 }
 
 func (d ProprietaryData) String() string {
-	return fmt.Sprintf("proprietary, manufacturer %s (%d)",
-		ManufacturerName[d.ManufacturerID], d.ManufacturerID)
+	return fmt.Sprintf("proprietary, manufacturer %s (%d), data %x",
+		ManufacturerName[d.ManufacturerID], d.ManufacturerID, d.Data)
 }
 
 func (d ProprietaryData) Write(data []byte) error {
-	data[1] = (d.ManufacturerID & B01111111)
+	if len(d.Data) > 8 {
+		return fmt.Errorf("dmr/data header: proprietary data can't exceed 8 bytes, got %d", len(d.Data))
+	}
+	data[1] = d.ManufacturerID
+	copy(data[2:10], d.Data)
 	return nil
 }
 
@@ -429,18 +481,42 @@ func (d ShortDataDefinedData) Write(data []byte) error {
 	return nil
 }
 
-var _ (DataHeaderData) = (*ShortDataDefinedData)(nil)
+// Interface compliance checks
+var (
+	_ (DataHeaderData) = (*UDTData)(nil)
+	_ (DataHeaderData) = (*UnconfirmedData)(nil)
+	_ (DataHeaderData) = (*ConfirmedData)(nil)
+	_ (DataHeaderData) = (*ResponseData)(nil)
+	_ (DataHeaderData) = (*ProprietaryData)(nil)
+	_ (DataHeaderData) = (*ShortDataRawData)(nil)
+	_ (DataHeaderData) = (*ShortDataDefinedData)(nil)
+)
 
+// ParseDataHeader parses a data header and checks its CRC. If proprietary is
+// set, or the packet format indicates so, the data is parsed as a proprietary
+// header, which follows a data header with the proprietary SAP.
 func ParseDataHeader(data []byte, proprietary bool) (*DataHeader, error) {
-	if len(data) != 12 {
-		return nil, fmt.Errorf("data must be 12 bytes, got %d", len(data))
+	if len(data) != DataHeaderSize {
+		return nil, fmt.Errorf("dmr/data header: data must be %d bytes, got %d", DataHeaderSize, len(data))
 	}
 	var (
 		ccrc = (uint16(data[10]) << 8) | uint16(data[11])
 		hcrc = dataHeaderCRC(data)
 	)
 	if ccrc != hcrc {
-		return nil, fmt.Errorf("data CRC mismatch, %#04x != %#04x", ccrc, hcrc)
+		return nil, fmt.Errorf("dmr/data header: CRC mismatch, %#04x != %#04x", ccrc, hcrc)
+	}
+
+	if proprietary || (data[0]&B00001111) == PacketFormatProprietaryData {
+		return &DataHeader{
+			PacketFormat:       PacketFormatProprietaryData,
+			ServiceAccessPoint: (data[0] & B11110000) >> 4,
+			CRC:                ccrc,
+			Data: &ProprietaryData{
+				ManufacturerID: data[1],
+				Data:           append([]byte{}, data[2:10]...),
+			},
+		}, nil
 	}
 
 	h := &DataHeader{
@@ -454,90 +530,85 @@ func ParseDataHeader(data []byte, proprietary bool) (*DataHeader, error) {
 		CRC:                ccrc,
 	}
 
-	if proprietary {
-		h.Data = ProprietaryData{
-			ManufacturerID: data[1] & B01111111,
+	switch h.PacketFormat {
+	case PacketFormatUDT:
+		h.Data = &UDTData{
+			Format:            (data[1] & B00001111),
+			PadNibble:         (data[8] & B11111000) >> 3,
+			AppendedBlocks:    (data[8] & B00000011),
+			SupplementaryFlag: (data[9] & B10000000) > 0,
+			Opcode:            (data[9] & B00111111),
 		}
+		break
 
-	} else {
-		switch h.PacketFormat {
-		case PacketFormatUDT:
-			h.Data = &UDTData{
-				Format:            (data[1] & B00001111),
-				PadNibble:         (data[8] & B11111000) >> 3,
-				AppendedBlocks:    (data[8] & B00000011),
-				SupplementaryFlag: (data[9] & B10000000) > 0,
-				Opcode:            (data[9] & B00111111),
-			}
-			break
-
-		case PacketFormatResponse:
-			h.Data = &ResponseData{
-				BlocksToFollow: (data[8] & B01111111),
-				ClassType:      (data[9] & B11111000) >> 3,
-				Status:         (data[9] & B00000111),
-			}
-			break
-
-		case PacketFormatUnconfirmedData:
-			h.Data = &UnconfirmedData{
-				PadOctetCount:          (data[0] & B00010000) | (data[1] & B00001111),
-				FullMessage:            (data[8] & B10000000) > 0,
-				BlocksToFollow:         (data[8] & B01111111),
-				FragmentSequenceNumber: (data[9] & B00001111),
-			}
-			break
-
-		case PacketFormatConfirmedData:
-			h.Data = &ConfirmedData{
-				PadOctetCount:          (data[0] & B00010000) | (data[1] & B00001111),
-				FullMessage:            (data[8] & B10000000) > 0,
-				BlocksToFollow:         (data[8] & B01111111),
-				Resync:                 (data[9] & B10000000) > 0,
-				SendSequenceNumber:     (data[9] & B01110000) >> 4,
-				FragmentSequenceNumber: (data[9] & B00001111),
-			}
-			break
-
-		case PacketFormatShortDataRaw:
-			h.Data = &ShortDataRawData{
-				AppendedBlocks: (data[0] & B00110000) | (data[1] & B00001111),
-				SrcPort:        (data[8] & B11100000) >> 5,
-				DstPort:        (data[8] & B00011100) >> 2,
-				Resync:         (data[8] & B00000010) > 0,
-				FullMessage:    (data[8] & B00000001) > 0,
-				BitPadding:     (data[9]),
-			}
-			break
-
-		case PacketFormatShortDataDefined:
-			h.Data = &ShortDataDefinedData{
-				AppendedBlocks: (data[0] & B00110000) | (data[1] & B00001111),
-				DDFormat:       (data[8] & B11111100) >> 2,
-				Resync:         (data[8] & B00000010) > 0,
-				FullMessage:    (data[8] & B00000001) > 0,
-				BitPadding:     (data[9]),
-			}
-			break
-
-		default:
-			return nil, fmt.Errorf("dmr: unknown data data packet format %#02x (%d)", h.PacketFormat, h.PacketFormat)
+	case PacketFormatResponse:
+		h.Data = &ResponseData{
+			BlocksToFollow: (data[8] & B01111111),
+			ClassType:      (data[9] & B11111000) >> 3,
+			Status:         (data[9] & B00000111),
+		}
+		break
+
+	case PacketFormatUnconfirmedData:
+		h.Data = &UnconfirmedData{
+			PadOctetCount:          (data[0] & B00010000) | (data[1] & B00001111),
+			FullMessage:            (data[8] & B10000000) > 0,
+			BlocksToFollow:         (data[8] & B01111111),
+			FragmentSequenceNumber: (data[9] & B00001111),
+		}
+		break
+
+	case PacketFormatConfirmedData:
+		h.Data = &ConfirmedData{
+			PadOctetCount:          (data[0] & B00010000) | (data[1] & B00001111),
+			FullMessage:            (data[8] & B10000000) > 0,
+			BlocksToFollow:         (data[8] & B01111111),
+			Resync:                 (data[9] & B10000000) > 0,
+			SendSequenceNumber:     (data[9] & B01110000) >> 4,
+			FragmentSequenceNumber: (data[9] & B00001111),
+		}
+		break
+
+	case PacketFormatShortDataRaw:
+		h.Data = &ShortDataRawData{
+			AppendedBlocks: (data[0] & B00110000) | (data[1] & B00001111),
+			SrcPort:        (data[8] & B11100000) >> 5,
+			DstPort:        (data[8] & B00011100) >> 2,
+			Resync:         (data[8] & B00000010) > 0,
+			FullMessage:    (data[8] & B00000001) > 0,
+			BitPadding:     (data[9]),
 		}
+		break
+
+	case PacketFormatShortDataDefined:
+		h.Data = &ShortDataDefinedData{
+			AppendedBlocks: (data[0] & B00110000) | (data[1] & B00001111),
+			DDFormat:       (data[8] & B11111100) >> 2,
+			Resync:         (data[8] & B00000010) > 0,
+			FullMessage:    (data[8] & B00000001) > 0,
+			BitPadding:     (data[9]),
+		}
+		break
+
+	default:
+		return nil, fmt.Errorf("dmr/data header: unknown packet format %#02x (%d)", h.PacketFormat, h.PacketFormat)
 	}
 
 	return h, nil
 }
 
-func dataHeaderCRC(data []byte) uint16 {
-	var crc uint16
-	if len(data) < 10 {
-		return crc
+// ParseDataHeaderBits parses the 96 info bits of a data header burst, as
+// returned by BPTC(196, 96) decoding, and checks the CRC.
+func ParseDataHeaderBits(bits bit.Bits) (*DataHeader, error) {
+	if len(bits) != DataHeaderBits {
+		return nil, fmt.Errorf("dmr/data header: expected %d bits, got %d", DataHeaderBits, len(bits))
 	}
+	return ParseDataHeader(bits.Bytes(), false)
+}
 
-	for i := 0; i < 10; i++ {
-		crc16(&crc, data[i])
+func dataHeaderCRC(data []byte) uint16 {
+	if len(data) < 10 {
+		return 0
 	}
-	crc16end(&crc)
-
-	return (^crc) ^ 0xcccc
+	return crc.CRC16(data[:10], crc.MaskDataHeader)
 }
@@ -1,8 +1,12 @@
 package dmr
 
 import (
+	"bytes"
 	"encoding/hex"
+	"reflect"
 	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
 )
 
 func testDataHeader(want *DataHeader, t *testing.T) *DataHeader {
@@ -211,7 +215,7 @@ func TestDataHeaderShortDataDefined(t *testing.T) {
 		t.Fatalf("decode failed: appended blocks wrong")
 
 	case d.DDFormat != DDFormatUTF16:
-		t.Fatalf("decode failed: dd format wrong, expected UTF-16, got %d", DDFormatName[d.DDFormat])
+		t.Fatalf("decode failed: dd format wrong, expected UTF-16, got %s", DDFormatName[d.DDFormat])
 
 	case d.Resync:
 		t.Fatalf("decode failed: rsync bit wrong")
@@ -223,3 +227,154 @@ func TestDataHeaderShortDataDefined(t *testing.T) {
 		t.Fatalf("decode failed: bit padding wrong")
 	}
 }
+
+func TestDataHeaderProprietary(t *testing.T) {
+	want := &DataHeader{
+		PacketFormat:       PacketFormatProprietaryData,
+		ServiceAccessPoint: ServiceAccessPointProprietaryData,
+		Data: &ProprietaryData{
+			ManufacturerID: 0x10,
+			Data:           []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		},
+	}
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	test, err := ParseDataHeader(data, true)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	d, ok := test.Data.(*ProprietaryData)
+	switch {
+	case !ok:
+		t.Fatalf("decode failed: expected ProprietaryData, got %T", test.Data)
+
+	case test.ServiceAccessPoint != ServiceAccessPointProprietaryData:
+		t.Fatalf("decode failed: service access point wrong")
+
+	case d.ManufacturerID != 0x10:
+		t.Fatalf("decode failed: manufacturer wrong")
+
+	case !bytes.Equal(d.Data, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}):
+		t.Fatalf("decode failed: data wrong, got %x", d.Data)
+	}
+}
+
+func TestDataHeaderVector(t *testing.T) {
+	var tests = []struct {
+		data []byte
+		want *DataHeader
+	}{
+		{
+			// Unconfirmed IP data header, 3 blocks, 5 pad octets
+			data: []byte{0x02, 0x45, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x83, 0x08, 0x01, 0x59},
+			want: &DataHeader{
+				PacketFormat:       PacketFormatUnconfirmedData,
+				ServiceAccessPoint: ServiceAccessPointIPBasedPacketData,
+				DstID:              2042214,
+				SrcID:              2043044,
+				CRC:                0x0159,
+				Data: &UnconfirmedData{
+					PadOctetCount:          5,
+					FullMessage:            true,
+					BlocksToFollow:         3,
+					FragmentSequenceNumber: 8,
+				},
+			},
+		},
+		{
+			// Confirmed IP data header with response requested, 6 blocks
+			data: []byte{0x43, 0x40, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x86, 0x28, 0xb0, 0x5d},
+			want: &DataHeader{
+				PacketFormat:       PacketFormatConfirmedData,
+				ResponseRequested:  true,
+				ServiceAccessPoint: ServiceAccessPointIPBasedPacketData,
+				DstID:              2042214,
+				SrcID:              2043044,
+				CRC:                0xb05d,
+				Data: &ConfirmedData{
+					FullMessage:            true,
+					BlocksToFollow:         6,
+					SendSequenceNumber:     2,
+					FragmentSequenceNumber: 8,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		h, err := ParseDataHeader(test.data, false)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if !reflect.DeepEqual(h, test.want) {
+			t.Fatalf("decode failed: expected %s, got %s", test.want, h)
+		}
+
+		data, err := h.Bytes()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Fatalf("encode failed: expected %x, got %x", test.data, data)
+		}
+
+		data[3] ^= 0x01
+		if _, err := ParseDataHeader(data, false); err == nil {
+			t.Fatal("decode with bit error did not fail")
+		}
+	}
+}
+
+func TestParseDataHeaderBits(t *testing.T) {
+	// Unconfirmed IP data header, 3 blocks, 5 pad octets
+	var bits = bit.NewBits([]byte{0x02, 0x45, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x83, 0x08, 0x01, 0x59})
+	h, err := ParseDataHeaderBits(bits)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	switch {
+	case h.DstIsGroup || h.ResponseRequested:
+		t.Fatalf("decode failed: flags wrong, got %s", h)
+	case h.ServiceAccessPoint != ServiceAccessPointIPBasedPacketData:
+		t.Fatalf("decode failed: sap wrong, got %d", h.ServiceAccessPoint)
+	case h.DstID != 2042214 || h.SrcID != 2043044:
+		t.Fatalf("decode failed: ID wrong, got %d->%d", h.SrcID, h.DstID)
+	case h.BlocksToFollow() != 3:
+		t.Fatalf("decode failed: expected 3 blocks to follow, got %d", h.BlocksToFollow())
+	case h.PadOctetCount() != 5:
+		t.Fatalf("decode failed: expected 5 pad octets, got %d", h.PadOctetCount())
+	}
+
+	bits[20] ^= 1
+	if _, err := ParseDataHeaderBits(bits); err == nil {
+		t.Fatal("decode with bit error did not fail")
+	}
+	if _, err := ParseDataHeaderBits(bits[:DataHeaderBits-1]); err == nil {
+		t.Fatal("decode of 95 bits succeeded")
+	}
+
+	h = &DataHeader{
+		PacketFormat: PacketFormatShortDataRaw,
+		Data:         &ShortDataRawData{AppendedBlocks: 2, SrcPort: 1, DstPort: 2, BitPadding: 16},
+	}
+	switch {
+	case h.BlocksToFollow() != 2:
+		t.Fatalf("expected 2 blocks to follow, got %d", h.BlocksToFollow())
+	case h.PadOctetCount() != 2:
+		t.Fatalf("expected 2 pad octets, got %d", h.PadOctetCount())
+	}
+
+	h = &DataHeader{
+		PacketFormat: PacketFormatUDT,
+		Data:         &UDTData{Format: UDTFormat16BitUnicodeChars, AppendedBlocks: 1, PadNibble: 5},
+	}
+	switch {
+	case h.BlocksToFollow() != 2:
+		t.Fatalf("UDT: expected 2 blocks to follow, got %d", h.BlocksToFollow())
+	case h.PadOctetCount() != 2:
+		t.Fatalf("UDT: expected 2 pad octets, got %d", h.PadOctetCount())
+	}
+}
@@ -0,0 +1,114 @@
+package dmr
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Deduplicator defaults.
+const (
+	DefaultDedupWindow = 64              // Frames remembered per repeater
+	DefaultDedupTTL    = time.Second * 5 // Time a frame is remembered
+)
+
+// Deduplicator drops frames seen before, which happens if masters forward
+// traffic to each other in a loop. Frames are identified by their stream ID
+// and sequence number, for each source repeater the last Window frames of
+// at most TTL ago are remembered.
+type Deduplicator struct {
+	dropped uint64 // First, for the alignment of atomic access on 32-bit
+
+	Window int
+	TTL    time.Duration
+
+	mutex     *sync.Mutex
+	repeaters map[uint32]*dedupWindow
+	now       func() time.Time
+}
+
+type dedupKey struct {
+	streamID uint32
+	sequence uint8
+}
+
+// dedupWindow is a ring of the most recent frames of a repeater.
+type dedupWindow struct {
+	seen map[dedupKey]time.Time
+	ring []dedupKey
+	next int
+}
+
+// NewDeduplicator returns a deduplicator with the default window and TTL.
+func NewDeduplicator() *Deduplicator {
+	return &Deduplicator{
+		Window:    DefaultDedupWindow,
+		TTL:       DefaultDedupTTL,
+		mutex:     &sync.Mutex{},
+		repeaters: make(map[uint32]*dedupWindow),
+		now:       time.Now,
+	}
+}
+
+// Middleware drops duplicate packets.
+func (d *Deduplicator) Middleware() PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		if !d.Duplicate(p) {
+			next(p)
+		}
+	}
+}
+
+// Duplicate returns true if the packet was seen before, otherwise the packet
+// is remembered.
+func (d *Deduplicator) Duplicate(p *Packet) bool {
+	var (
+		key = dedupKey{p.StreamID, p.Sequence}
+		now = d.now()
+		ttl = d.TTL
+	)
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, ok := d.repeaters[p.RepeaterID]
+	if !ok {
+		var size = d.Window
+		if size <= 0 {
+			size = DefaultDedupWindow
+		}
+		w = &dedupWindow{
+			seen: make(map[dedupKey]time.Time, size),
+			ring: make([]dedupKey, 0, size),
+		}
+		d.repeaters[p.RepeaterID] = w
+	}
+
+	if seen, ok := w.seen[key]; ok {
+		if now.Sub(seen) <= ttl {
+			atomic.AddUint64(&d.dropped, 1)
+			return true
+		}
+		// Expired, but still in the ring
+		w.seen[key] = now
+		return false
+	}
+
+	if len(w.ring) < cap(w.ring) {
+		w.ring = append(w.ring, key)
+	} else {
+		delete(w.seen, w.ring[w.next])
+		w.ring[w.next] = key
+		w.next = (w.next + 1) % len(w.ring)
+	}
+	w.seen[key] = now
+	return false
+}
+
+// DroppedFrames returns the number of duplicates dropped.
+func (d *Deduplicator) DroppedFrames() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
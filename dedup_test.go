@@ -0,0 +1,56 @@
+package dmr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	var (
+		d      = NewDeduplicator()
+		clock  = time.Now()
+		passed int
+		mw     = d.Middleware()
+	)
+	d.Window = 4
+	d.now = func() time.Time { return clock }
+	var send = func(repeaterID, streamID uint32, seq uint8) bool {
+		var before = passed
+		mw(&Packet{RepeaterID: repeaterID, StreamID: streamID, Sequence: seq}, func(*Packet) { passed++ })
+		return passed > before
+	}
+
+	for _, test := range []struct {
+		Name       string
+		RepeaterID uint32
+		StreamID   uint32
+		Sequence   uint8
+		Want       bool
+	}{
+		{"first", 1, 1, 0, true},
+		{"next", 1, 1, 1, true},
+		{"duplicate", 1, 1, 0, false},
+		{"other stream", 1, 2, 0, true},
+		{"other repeater", 2, 1, 0, true},
+		{"fill window", 1, 1, 2, true},
+		{"slide window", 1, 1, 3, true},
+		{"out of window", 1, 1, 0, true},
+		{"in window", 1, 1, 3, false},
+	} {
+		if got := send(test.RepeaterID, test.StreamID, test.Sequence); got != test.Want {
+			t.Fatalf("%s: expected passed %t, got %t", test.Name, test.Want, got)
+		}
+	}
+	if dropped := d.DroppedFrames(); dropped != 2 {
+		t.Fatalf("expected 2 dropped frames, got %d", dropped)
+	}
+
+	// Frames older than the TTL are not duplicates
+	clock = clock.Add(d.TTL + time.Second)
+	if !send(1, 1, 3) {
+		t.Fatal("expired frame was dropped")
+	}
+	if send(1, 1, 3) {
+		t.Fatal("duplicate of expired frame was passed")
+	}
+}
@@ -0,0 +1,283 @@
+package dmrid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Database is an in-memory index of the user or repeater dumps published by
+// RadioID.net and DMR-MARC. It is safe for use by multiple goroutines, a
+// reload parses the new dump first and then swaps it in, so lookups never see
+// a partially loaded database.
+type Database struct {
+	mutex   *sync.RWMutex
+	records map[uint32]*Subscriber
+}
+
+// NewDatabase returns an empty database.
+func NewDatabase() *Database {
+	return &Database{
+		mutex:   &sync.RWMutex{},
+		records: make(map[uint32]*Subscriber),
+	}
+}
+
+// LoadDatabase returns a database loaded from the file, see Load.
+func LoadDatabase(path string) (*Database, error) {
+	var db = NewDatabase()
+	if err := db.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Lookup returns the subscriber or repeater with the ID.
+func (db *Database) Lookup(id uint32) (*Subscriber, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	s, ok := db.records[id]
+	return s, ok
+}
+
+// Callsign returns the callsign of the ID, or an empty string if the ID is
+// unknown. It can be used as the Callsign func of a dmr.CDRWriter.
+func (db *Database) Callsign(id uint32) string {
+	if s, ok := db.Lookup(id); ok {
+		return s.Callsign
+	}
+	return ""
+}
+
+// Len returns the number of records.
+func (db *Database) Len() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return len(db.records)
+}
+
+// LoadFile replaces the records with the dump in the file, see Load.
+func (db *Database) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return db.Load(f)
+}
+
+// Load replaces the records with a dump, which is either CSV with a header
+// line, such as RadioID.net user.csv, or JSON, such as users.json and
+// rptrs.json. The format is detected from the first character. The records
+// are only replaced if the whole dump is valid.
+func (db *Database) Load(r io.Reader) error {
+	var br = bufio.NewReaderSize(r, 64*1024)
+	first, err := firstByte(br)
+	if err != nil {
+		return err
+	}
+
+	var records map[uint32]*Subscriber
+	if first == '{' || first == '[' {
+		records, err = parseJSON(br, first == '[')
+	} else {
+		records, err = parseCSV(br)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	db.records = records
+	db.mutex.Unlock()
+	return nil
+}
+
+// firstByte returns the first non-space byte of the reader, without
+// consuming it.
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, errors.New("dmrid: empty database")
+			}
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', 0xef, 0xbb, 0xbf: // Space or UTF-8 BOM
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// dumpRecord holds the fields of the RadioID.net and DMR-MARC JSON dumps,
+// repeater dumps use id with a string value.
+type dumpRecord struct {
+	RadioID   dumpID `json:"radio_id"`
+	ID        dumpID `json:"id"`
+	Callsign  string `json:"callsign"`
+	FirstName string `json:"fname"`
+	Name      string `json:"name"`
+	Surname   string `json:"surname"`
+	City      string `json:"city"`
+	State     string `json:"state"`
+	Country   string `json:"country"`
+}
+
+type dumpID uint32
+
+func (id *dumpID) UnmarshalJSON(data []byte) error {
+	var s = string(bytes.Trim(data, `"`))
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid ID %s", data)
+	}
+	*id = dumpID(v)
+	return nil
+}
+
+// parseJSON parses a JSON dump, which is either a list of records or an
+// object with a list of records.
+func parseJSON(r io.Reader, list bool) (map[uint32]*Subscriber, error) {
+	var (
+		dump struct {
+			Users    []dumpRecord `json:"users"`
+			Rptrs    []dumpRecord `json:"rptrs"`
+			Results  []dumpRecord `json:"results"`
+			Contacts []dumpRecord `json:"contacts"`
+		}
+		records []dumpRecord
+		dec     = json.NewDecoder(r)
+	)
+	if list {
+		if err := dec.Decode(&records); err != nil {
+			return nil, fmt.Errorf("dmrid: invalid JSON: %v", err)
+		}
+		return index(records), nil
+	}
+	if err := dec.Decode(&dump); err != nil {
+		return nil, fmt.Errorf("dmrid: invalid JSON: %v", err)
+	}
+	records = append(append(append(dump.Users, dump.Rptrs...), dump.Results...), dump.Contacts...)
+	return index(records), nil
+}
+
+func index(list []dumpRecord) map[uint32]*Subscriber {
+	var records = make(map[uint32]*Subscriber, len(list))
+	for _, r := range list {
+		var id = uint32(r.RadioID)
+		if id == 0 {
+			id = uint32(r.ID)
+		}
+		if id == 0 {
+			continue
+		}
+		records[id] = &Subscriber{
+			ID:       id,
+			Callsign: r.Callsign,
+			Name:     fullName(r.FirstName, r.Surname, r.Name),
+			City:     r.City,
+			State:    r.State,
+			Country:  r.Country,
+		}
+	}
+	return records
+}
+
+func fullName(first, last, name string) string {
+	if full := strings.TrimSpace(first + " " + last); full != "" {
+		return full
+	}
+	return strings.TrimSpace(name)
+}
+
+// csvColumns maps the normalized header names of the known CSV dumps to the
+// fields.
+var csvColumns = map[string]string{
+	"radioid":    "id",
+	"radio_id":   "id",
+	"id":         "id",
+	"callsign":   "callsign",
+	"firstname":  "first",
+	"first_name": "first",
+	"fname":      "first",
+	"lastname":   "last",
+	"last_name":  "last",
+	"surname":    "last",
+	"name":       "name",
+	"city":       "city",
+	"state":      "state",
+	"country":    "country",
+}
+
+func parseCSV(r io.Reader) (map[uint32]*Subscriber, error) {
+	var cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("dmrid: invalid CSV header: %v", err)
+	}
+	var columns = make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.ReplaceAll(name, " ", "_")
+		if field, ok := csvColumns[name]; ok {
+			if _, dup := columns[field]; !dup {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, errors.New("dmrid: CSV header has no ID column")
+	}
+
+	var (
+		records = make(map[uint32]*Subscriber)
+		line    = 1
+	)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("dmrid: line %d: %v", line, err)
+		}
+		var field = func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		id, err := strconv.ParseUint(field("id"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("dmrid: line %d: invalid ID %q", line, field("id"))
+		}
+		records[uint32(id)] = &Subscriber{
+			ID:       uint32(id),
+			Callsign: field("callsign"),
+			Name:     fullName(field("first"), field("last"), field("name")),
+			City:     field("city"),
+			State:    field("state"),
+			Country:  field("country"),
+		}
+	}
+	return records, nil
+}
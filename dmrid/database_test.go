@@ -0,0 +1,138 @@
+package dmrid
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDatabaseLoad(t *testing.T) {
+	for _, test := range []struct {
+		Name string
+		Data string
+	}{
+		{"RadioID CSV", "\ufeffRADIO_ID,CALLSIGN,FIRST_NAME,LAST_NAME,CITY,STATE,COUNTRY\n" +
+			"2042214,PD0MZ,Wijnand,,Almere,Flevoland,Netherlands\n" +
+			"2043044,PE1XYZ,Jan,Jansen,Utrecht,Utrecht,Netherlands\n"},
+		{"DMR-MARC CSV", "Radio ID,Callsign,Name,City,State,Country,Remarks\n" +
+			"2042214,PD0MZ,Wijnand,Almere,Flevoland,Netherlands,\n" +
+			"2043044,PE1XYZ,Jan Jansen,Utrecht,Utrecht,Netherlands,\"DMR, hotspot\"\n"},
+		{"users JSON", `{"users": [
+			{"radio_id": 2042214, "callsign": "PD0MZ", "fname": "Wijnand", "surname": "", "city": "Almere", "state": "Flevoland", "country": "Netherlands"},
+			{"radio_id": 2043044, "callsign": "PE1XYZ", "fname": "Jan", "surname": "Jansen", "city": "Utrecht", "state": "Utrecht", "country": "Netherlands"}
+		]}`},
+		{"repeaters JSON", `{"rptrs": [
+			{"id": "2042214", "callsign": "PD0MZ", "name": "Wijnand", "city": "Almere", "state": "Flevoland", "country": "Netherlands"},
+			{"id": "2043044", "callsign": "PE1XYZ", "name": "Jan Jansen", "city": "Utrecht", "state": "Utrecht", "country": "Netherlands"}
+		]}`},
+		{"list JSON", `[{"id": 2042214, "callsign": "PD0MZ", "fname": "Wijnand", "city": "Almere", "state": "Flevoland", "country": "Netherlands"},
+			{"id": 2043044, "callsign": "PE1XYZ", "fname": "Jan", "surname": "Jansen", "city": "Utrecht", "state": "Utrecht", "country": "Netherlands"}]`},
+	} {
+		var db = NewDatabase()
+		if err := db.Load(strings.NewReader(test.Data)); err != nil {
+			t.Fatalf("%s: load failed: %v", test.Name, err)
+		}
+		if db.Len() != 2 {
+			t.Fatalf("%s: expected 2 records, got %d", test.Name, db.Len())
+		}
+		s, ok := db.Lookup(2043044)
+		switch {
+		case !ok:
+			t.Fatalf("%s: lookup failed", test.Name)
+		case s.Callsign != "PE1XYZ" || s.Name != "Jan Jansen" || s.City != "Utrecht" || s.Country != "Netherlands":
+			t.Fatalf("%s: unexpected record %+v", test.Name, s)
+		}
+		if callsign := db.Callsign(2042214); callsign != "PD0MZ" {
+			t.Fatalf("%s: expected callsign PD0MZ, got %q", test.Name, callsign)
+		}
+		if _, ok := db.Lookup(1234567); ok {
+			t.Fatalf("%s: lookup of unknown ID succeeded", test.Name)
+		}
+	}
+}
+
+func TestDatabaseInvalid(t *testing.T) {
+	var db = NewDatabase()
+	if err := db.Load(strings.NewReader("RADIO_ID,CALLSIGN\n2042214,PD0MZ\n")); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	for _, data := range []string{
+		"",
+		"CALLSIGN,NAME\nPD0MZ,Wijnand\n",
+		"RADIO_ID,CALLSIGN\nPD0MZ,2042214\n",
+		`{"users": [{"radio_id": "x"}]}`,
+	} {
+		if err := db.Load(strings.NewReader(data)); err == nil {
+			t.Fatalf("load of %q succeeded", data)
+		}
+	}
+	// Failed loads keep the records
+	if db.Callsign(2042214) != "PD0MZ" {
+		t.Fatal("failed load replaced the records")
+	}
+}
+
+func TestDatabaseReload(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "user.csv")
+	if err := os.WriteFile(path, []byte("RADIO_ID,CALLSIGN\n2042214,PD0MZ\n"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c := db.Callsign(2042214); c != "PD0MZ" && c != "PD0MZ/P" {
+					t.Errorf("unexpected callsign %q", c)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		var callsign = "PD0MZ"
+		if i%2 == 0 {
+			callsign = "PD0MZ/P"
+		}
+		if err := db.Load(strings.NewReader("RADIO_ID,CALLSIGN\n2042214," + callsign + "\n")); err != nil {
+			t.Fatalf("reload failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkDatabaseLoad(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("RADIO_ID,CALLSIGN,FIRST_NAME,LAST_NAME,CITY,STATE,COUNTRY\n")
+	for i := 0; i < 250000; i++ {
+		fmt.Fprintf(&buf, "%d,PD%dMZ,Wijnand,Modderman,Almere,Flevoland,Netherlands\n", 2040000+i, i)
+	}
+	var data = buf.Bytes()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var db = NewDatabase()
+		if err := db.Load(bytes.NewReader(data)); err != nil {
+			b.Fatalf("load failed: %v", err)
+		}
+	}
+}
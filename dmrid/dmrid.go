@@ -0,0 +1,241 @@
+// Package dmrid resolves DMR subscriber IDs using the RadioID.net API, or a
+// local copy of the RadioID.net and DMR-MARC databases
+package dmrid
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultURL is the RadioID.net user API.
+const DefaultURL = "https://www.radioid.net/api/dmr/user/"
+
+// DefaultCacheSize is the number of subscribers cached by a new Client.
+const DefaultCacheSize = 1024
+
+// ErrNotFound is returned if the ID is not registered.
+var ErrNotFound = errors.New("dmrid: subscriber not found")
+
+// Subscriber is a registered DMR subscriber.
+type Subscriber struct {
+	ID       uint32
+	Callsign string
+	Name     string
+	City     string
+	State    string
+	Country  string
+}
+
+func (s *Subscriber) String() string {
+	return fmt.Sprintf("%d %s (%s)", s.ID, s.Callsign, s.Name)
+}
+
+// Client looks up subscribers and caches the results in a least recently
+// used cache.
+type Client struct {
+	// URL of the user API, defaults to DefaultURL.
+	URL string
+	// HTTPClient is used for requests, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// TTL is the time results are cached, zero caches until evicted.
+	TTL time.Duration
+	// Size is the maximum number of cached subscribers.
+	Size int
+
+	mutex *sync.Mutex
+	cache map[uint32]*list.Element
+	order *list.List
+}
+
+type cacheEntry struct {
+	subscriber *Subscriber
+	expires    time.Time
+}
+
+// NewClient returns a client using the RadioID.net API.
+func NewClient() *Client {
+	return &Client{
+		URL:   DefaultURL,
+		Size:  DefaultCacheSize,
+		mutex: &sync.Mutex{},
+		cache: make(map[uint32]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Lookup returns the subscriber with the ID.
+func (c *Client) Lookup(ctx context.Context, id uint32) (*Subscriber, error) {
+	if s, ok := c.cached(id); ok {
+		return s, nil
+	}
+
+	found, err := c.fetch(ctx, []uint32{id})
+	if err != nil {
+		return nil, err
+	}
+	s, ok := found[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// LookupBatch returns the subscribers with the IDs, IDs that are not cached
+// are requested in a single API call. IDs that are not registered are absent
+// from the result.
+func (c *Client) LookupBatch(ctx context.Context, ids []uint32) (map[uint32]*Subscriber, error) {
+	var (
+		result  = make(map[uint32]*Subscriber, len(ids))
+		seen    = make(map[uint32]bool, len(ids))
+		missing []uint32
+	)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if s, ok := c.cached(id); ok {
+			result[id] = s
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	found, err := c.fetch(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, s := range found {
+		result[id] = s
+	}
+	return result, nil
+}
+
+// radioIDResponse is the response of the user API.
+type radioIDResponse struct {
+	Count   int `json:"count"`
+	Results []struct {
+		ID        uint32 `json:"id"`
+		Callsign  string `json:"callsign"`
+		FirstName string `json:"fname"`
+		Name      string `json:"name"`
+		Surname   string `json:"surname"`
+		City      string `json:"city"`
+		State     string `json:"state"`
+		Country   string `json:"country"`
+	} `json:"results"`
+}
+
+// fetch requests the IDs, passed as repeated id parameters, and caches the
+// results.
+func (c *Client) fetch(ctx context.Context, ids []uint32) (map[uint32]*Subscriber, error) {
+	var base = c.URL
+	if base == "" {
+		base = DefaultURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("dmrid: %v", err)
+	}
+	var query = u.Query()
+	for _, id := range ids {
+		query.Add("id", strconv.FormatUint(uint64(id), 10))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("dmrid: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var client = c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dmrid: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dmrid: unexpected response %s", res.Status)
+	}
+
+	var response radioIDResponse
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("dmrid: invalid response: %v", err)
+	}
+
+	var found = make(map[uint32]*Subscriber, len(response.Results))
+	for _, r := range response.Results {
+		var name = strings.TrimSpace(r.FirstName + " " + r.Surname)
+		if name == "" {
+			name = r.Name
+		}
+		found[r.ID] = &Subscriber{
+			ID:       r.ID,
+			Callsign: r.Callsign,
+			Name:     name,
+			City:     r.City,
+			State:    r.State,
+			Country:  r.Country,
+		}
+	}
+	for _, s := range found {
+		c.store(s)
+	}
+	return found, nil
+}
+
+func (c *Client) cached(id uint32) (*Subscriber, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.cache[id]
+	if !ok {
+		return nil, false
+	}
+	var entry = e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(e)
+		delete(c.cache, id)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return entry.subscriber, true
+}
+
+func (c *Client) store(s *Subscriber) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var entry = &cacheEntry{subscriber: s}
+	if c.TTL > 0 {
+		entry.expires = time.Now().Add(c.TTL)
+	}
+	if e, ok := c.cache[s.ID]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+	c.cache[s.ID] = c.order.PushFront(entry)
+
+	for c.Size > 0 && c.order.Len() > c.Size {
+		var oldest = c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.cache, oldest.Value.(*cacheEntry).subscriber.ID)
+	}
+}
@@ -0,0 +1,112 @@
+package dmrid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSubscribers = map[string]string{
+	"2042214": `{"callsign":"PD0MZ","city":"Almere","country":"Netherlands","fname":"Wijnand","id":2042214,"state":"Flevoland","surname":""}`,
+	"2043044": `{"callsign":"PE1XYZ","city":"Utrecht","country":"Netherlands","fname":"Jan","id":2043044,"state":"Utrecht","surname":"Jansen"}`,
+}
+
+func testServer(requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ids = r.URL.Query()["id"]
+		sort.Strings(ids)
+		*requests = append(*requests, strings.Join(ids, ","))
+
+		var results []string
+		for _, id := range ids {
+			if s, ok := testSubscribers[id]; ok {
+				results = append(results, s)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count":` + strconv.Itoa(len(results)) + `,"results":[` + strings.Join(results, ",") + `]}`))
+	}))
+}
+
+func TestLookup(t *testing.T) {
+	var requests []string
+	server := testServer(&requests)
+	defer server.Close()
+
+	var c = NewClient()
+	c.URL = server.URL
+
+	s, err := c.Lookup(context.Background(), 2042214)
+	switch {
+	case err != nil:
+		t.Fatalf("lookup failed: %v", err)
+	case s.Callsign != "PD0MZ" || s.Name != "Wijnand" || s.City != "Almere" || s.Country != "Netherlands":
+		t.Fatalf("lookup failed: got %+v", s)
+	}
+	if _, err = c.Lookup(context.Background(), 2042214); err != nil {
+		t.Fatalf("cached lookup failed: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+
+	if _, err = c.Lookup(context.Background(), 1); err != ErrNotFound {
+		t.Fatalf("lookup of unknown ID failed: expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestLookupBatch(t *testing.T) {
+	var requests []string
+	server := testServer(&requests)
+	defer server.Close()
+
+	var c = NewClient()
+	c.URL = server.URL
+	if _, err := c.Lookup(context.Background(), 2042214); err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+
+	found, err := c.LookupBatch(context.Background(), []uint32{2042214, 2043044, 1, 2043044})
+	switch {
+	case err != nil:
+		t.Fatalf("batch lookup failed: %v", err)
+	case len(found) != 2 || found[2043044] == nil || found[2043044].Name != "Jan Jansen":
+		t.Fatalf("batch lookup failed: got %v", found)
+	case len(requests) != 2 || requests[1] != "1,2043044":
+		t.Fatalf("batch lookup failed: expected a single request for uncached IDs, got %q", requests)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var requests []string
+	server := testServer(&requests)
+	defer server.Close()
+
+	var c = NewClient()
+	c.URL = server.URL
+	c.Size = 1
+	for _, id := range []uint32{2042214, 2043044, 2042214} {
+		if _, err := c.Lookup(context.Background(), id); err != nil {
+			t.Fatalf("lookup failed: %v", err)
+		}
+	}
+	if len(requests) != 3 {
+		t.Fatalf("LRU eviction failed: expected 3 requests, got %d", len(requests))
+	}
+
+	requests = nil
+	c = NewClient()
+	c.URL = server.URL
+	c.TTL = time.Millisecond
+	c.Lookup(context.Background(), 2042214)
+	time.Sleep(time.Millisecond * 5)
+	c.Lookup(context.Background(), 2042214)
+	if len(requests) != 2 {
+		t.Fatalf("TTL expiry failed: expected 2 requests, got %d", len(requests))
+	}
+}
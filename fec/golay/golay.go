@@ -0,0 +1,106 @@
+// Package golay implements the Golay codes used by DMR. The shortened Golay
+// (20, 8, 7) code protecting the Slot Type works on bit strings with the data
+// bits followed by the parity bits, the Golay (23, 12, 7) and (24, 12, 8)
+// codes of the AMBE+2 voice frames work on packed codewords.
+package golay
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+// Sizes of the Golay (20, 8, 7) code.
+const (
+	Bits20_8     = 20
+	DataBits20_8 = 8
+)
+
+// parity20_8 returns the 12 parity bits of the 8 data bits.
+func parity20_8(data bit.Bits) bit.Bits {
+	var p = make(bit.Bits, Bits20_8-DataBits20_8)
+	p[0] = data[1] ^ data[4] ^ data[5] ^ data[6] ^ data[7]
+	p[1] = data[1] ^ data[2] ^ data[4]
+	p[2] = data[0] ^ data[2] ^ data[3] ^ data[5]
+	p[3] = data[0] ^ data[1] ^ data[3] ^ data[4] ^ data[6]
+	p[4] = data[0] ^ data[1] ^ data[2] ^ data[4] ^ data[5] ^ data[7]
+	p[5] = data[0] ^ data[2] ^ data[3] ^ data[4] ^ data[7]
+	p[6] = data[3] ^ data[6] ^ data[7]
+	p[7] = data[0] ^ data[1] ^ data[5] ^ data[6]
+	p[8] = data[0] ^ data[1] ^ data[2] ^ data[6] ^ data[7]
+	p[9] = data[2] ^ data[3] ^ data[4] ^ data[5] ^ data[6]
+	p[10] = data[0] ^ data[3] ^ data[4] ^ data[5] ^ data[6] ^ data[7]
+	p[11] = data[1] ^ data[2] ^ data[3] ^ data[5] ^ data[7]
+	return p
+}
+
+// errors20_8 maps a syndrome to the error pattern with the least bit errors,
+// for all patterns up to 3 bit errors.
+var errors20_8 = map[uint16][]int{}
+
+func init() {
+	var bits = make(bit.Bits, Bits20_8)
+	for i := 0; i < Bits20_8; i++ {
+		bits[i] = 1
+		errors20_8[syndrome20_8(bits)] = []int{i}
+		for j := i + 1; j < Bits20_8; j++ {
+			bits[j] = 1
+			errors20_8[syndrome20_8(bits)] = []int{i, j}
+			for k := j + 1; k < Bits20_8; k++ {
+				bits[k] = 1
+				errors20_8[syndrome20_8(bits)] = []int{i, j, k}
+				bits[k] = 0
+			}
+			bits[j] = 0
+		}
+		bits[i] = 0
+	}
+}
+
+func syndrome20_8(bits bit.Bits) uint16 {
+	var s uint16
+	for i, p := range parity20_8(bits[:DataBits20_8]) {
+		s = s<<1 | uint16((p^bits[DataBits20_8+i])&1)
+	}
+	return s
+}
+
+// Encode20_8 returns the 20 bits codeword of the 8 data bits.
+func Encode20_8(data bit.Bits) (bit.Bits, error) {
+	if len(data) != DataBits20_8 {
+		return nil, fmt.Errorf("fec/golay: expected %d data bits, got %d", DataBits20_8, len(data))
+	}
+	return append(append(bit.Bits{}, data...), parity20_8(data)...), nil
+}
+
+// Correct20_8 corrects up to 3 bit errors of the 20 bits codeword in place,
+// and returns the number of corrected bits.
+func Correct20_8(bits bit.Bits) (int, error) {
+	if len(bits) != Bits20_8 {
+		return -1, fmt.Errorf("fec/golay: expected %d bits, got %d", Bits20_8, len(bits))
+	}
+
+	var s = syndrome20_8(bits)
+	if s == 0 {
+		return 0, nil
+	}
+	pattern, ok := errors20_8[s]
+	if !ok {
+		return -1, fmt.Errorf("fec/golay: uncorrectable errors, syndrome %03x", s)
+	}
+	for _, i := range pattern {
+		bits[i] ^= 1
+	}
+	return len(pattern), nil
+}
+
+// Decode20_8 returns the 8 data bits of the 20 bits codeword and the number of
+// corrected bits. The passed bits are left untouched.
+func Decode20_8(bits bit.Bits) (bit.Bits, int, error) {
+	var corrected = append(bit.Bits{}, bits...)
+	n, err := Correct20_8(corrected)
+	if err != nil {
+		return nil, n, err
+	}
+	return corrected[:DataBits20_8], n, nil
+}
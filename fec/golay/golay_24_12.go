@@ -0,0 +1,81 @@
+package golay
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Golay (23, 12, 7) and extended Golay (24, 12, 8) codewords with the 12 data
+// bits in the most significant bits, as used by the AMBE+2 voice frames. The
+// extended code appends an even parity bit as least significant bit.
+
+// poly23_12 is the generator polynomial x^11+x^10+x^6+x^5+x^4+x^2+1.
+const poly23_12 = 0xc75
+
+// patterns23_12 maps a syndrome to its error pattern, the code is perfect so
+// every syndrome maps to a pattern of up to 3 bit errors.
+var patterns23_12 [2048]uint32
+
+func init() {
+	for i := 0; i < 23; i++ {
+		for j := i; j < 23; j++ {
+			for k := j; k < 23; k++ {
+				var pattern = uint32(1)<<uint(i) | uint32(1)<<uint(j) | uint32(1)<<uint(k)
+				patterns23_12[syndrome23_12(pattern)] = pattern
+			}
+		}
+	}
+	patterns23_12[0] = 0
+}
+
+// syndrome23_12 returns the remainder of the codeword divided by the
+// generator polynomial.
+func syndrome23_12(code uint32) uint32 {
+	for i := 22; i >= 11; i-- {
+		if code&(1<<uint(i)) != 0 {
+			code ^= poly23_12 << uint(i-11)
+		}
+	}
+	return code & 0x7ff
+}
+
+// Encode23_12 encodes 12 data bits to a 23 bit codeword with the data in the
+// most significant bits.
+func Encode23_12(data uint16) uint32 {
+	var code = uint32(data&0xfff) << 11
+	return code | syndrome23_12(code)
+}
+
+// Decode23_12 corrects up to 3 bit errors in a 23 bit codeword and returns the
+// data bits and the number of corrected bits.
+func Decode23_12(code uint32) (uint16, int) {
+	code &= 0x7fffff
+	var pattern = patterns23_12[syndrome23_12(code)]
+	return uint16((code ^ pattern) >> 11), bits.OnesCount32(pattern)
+}
+
+// Encode24_12 encodes 12 data bits to a 24 bit extended Golay codeword.
+func Encode24_12(data uint16) uint32 {
+	var code = Encode23_12(data) << 1
+	return code | uint32(bits.OnesCount32(code)&1)
+}
+
+// Decode24_12 corrects up to 3 bit errors and detects 4 bit errors in a 24 bit
+// extended Golay codeword, it returns the data bits and the number of
+// corrected bits.
+func Decode24_12(code uint32) (uint16, int, error) {
+	code &= 0xffffff
+	var (
+		data, n = Decode23_12(code >> 1)
+		parity  = bits.OnesCount32(code) & 1
+	)
+	switch {
+	case n%2 == parity:
+		return data, n, nil
+	case n < 3:
+		// The parity bit is in error as well
+		return data, n + 1, nil
+	default:
+		return 0, -1, fmt.Errorf("fec/golay: uncorrectable errors in %06x", code)
+	}
+}
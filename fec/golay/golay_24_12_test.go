@@ -0,0 +1,44 @@
+package golay
+
+import "testing"
+
+func TestGolay24_12(t *testing.T) {
+	for data := uint16(0); data < 0x1000; data++ {
+		var code = Encode24_12(data)
+		if code>>12 != uint32(data) {
+			t.Fatalf("encode %03x failed: got %06x", data, code)
+		}
+
+		for _, pattern := range []uint32{0, 1 << 0, 1 << 23, 1<<1 | 1<<12, 1<<2 | 1<<9 | 1<<20, 1<<0 | 1<<8 | 1<<16} {
+			var want = 0
+			for p := pattern; p > 0; p &= p - 1 {
+				want++
+			}
+			got, n, err := Decode24_12(code ^ pattern)
+			switch {
+			case err != nil:
+				t.Fatalf("decode %03x with %d errors failed: %v", data, want, err)
+			case got != data || n != want:
+				t.Fatalf("decode %03x with %d errors failed: got %03x, corrected %d bits", data, want, got, n)
+			}
+		}
+
+		if _, _, err := Decode24_12(code ^ 0x000f00); err == nil {
+			t.Fatalf("decode %03x with 4 errors succeeded, expected an error", data)
+		}
+	}
+}
+
+func TestGolay23_12(t *testing.T) {
+	for data := uint16(0); data < 0x1000; data += 7 {
+		var code = Encode23_12(data)
+		for i := 0; i < 23; i++ {
+			for j := i + 1; j < 23; j++ {
+				got, n := Decode23_12(code ^ (1<<uint(i) | 1<<uint(j) | 1<<uint((i+j+5)%23)))
+				if got != data || n < 2 {
+					t.Fatalf("decode %03x failed: got %03x, corrected %d bits", data, got, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package golay
+
+import (
+	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+func TestGolay20_8(t *testing.T) {
+	for v := 0; v < 256; v++ {
+		var data = bit.NewBits([]byte{uint8(v)})
+		bits, err := Encode20_8(data)
+		if err != nil {
+			t.Fatalf("encode %02x failed: %v", v, err)
+		}
+		if len(bits) != Bits20_8 || !bits[:DataBits20_8].Equal(data) {
+			t.Fatalf("encode %02x: expected systematic %d bits, got %v", v, Bits20_8, bits)
+		}
+
+		// Single, double and triple bit errors are detected and corrected
+		for i := -1; i < Bits20_8; i++ {
+			for j := i + 1; j < Bits20_8; j++ {
+				for _, k := range []int{-1, (j + 7) % Bits20_8} {
+					var (
+						corrupt = append(bit.Bits{}, bits...)
+						flipped = map[int]bool{}
+					)
+					for _, n := range []int{i, j, k} {
+						if n >= 0 && !flipped[n] {
+							corrupt[n] ^= 1
+							flipped[n] = true
+						}
+					}
+
+					got, n, err := Decode20_8(corrupt)
+					switch {
+					case err != nil:
+						t.Fatalf("decode %02x with %d errors failed: %v", v, len(flipped), err)
+					case n != len(flipped):
+						t.Fatalf("decode %02x with %d errors: corrected %d bits", v, len(flipped), n)
+					case !got.Equal(data):
+						t.Fatalf("decode %02x with %d errors: got %v", v, len(flipped), got)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err := Encode20_8(make(bit.Bits, 7)); err == nil {
+		t.Fatal("encode of 7 bits succeeded")
+	}
+	if _, _, err := Decode20_8(make(bit.Bits, 19)); err == nil {
+		t.Fatal("decode of 19 bits succeeded")
+	}
+}
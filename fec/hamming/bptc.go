@@ -0,0 +1,35 @@
+package hamming
+
+import "github.com/pd0mz/go-dmr/bit"
+
+// Encode15_11 returns the Hamming (15, 11, 3) codeword of a BPTC (196, 96)
+// row, or nil if data doesn't have 11 bits.
+func Encode15_11(data bit.Bits) bit.Bits {
+	codeword, err := Hamming15_11_3.Encode(data)
+	if err != nil {
+		return nil
+	}
+	return codeword
+}
+
+// Decode15_11 returns the 11 data bits of a Hamming (15, 11, 3) codeword, and
+// whether a bit error was corrected.
+func Decode15_11(bits bit.Bits) (bit.Bits, bool, error) {
+	return Hamming15_11_3.Decode(bits)
+}
+
+// Encode13_9 returns the Hamming (13, 9, 3) codeword of a BPTC (196, 96)
+// column, or nil if data doesn't have 9 bits.
+func Encode13_9(data bit.Bits) bit.Bits {
+	codeword, err := Hamming13_9_3.Encode(data)
+	if err != nil {
+		return nil
+	}
+	return codeword
+}
+
+// Decode13_9 returns the 9 data bits of a Hamming (13, 9, 3) codeword, and
+// whether a bit error was corrected.
+func Decode13_9(bits bit.Bits) (bit.Bits, bool, error) {
+	return Hamming13_9_3.Decode(bits)
+}
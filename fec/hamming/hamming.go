@@ -0,0 +1,155 @@
+// Package hamming implements the systematic Hamming codes of the DMR AI spec,
+// on bit strings with the data bits followed by the parity bits.
+package hamming
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+// Code is a Hamming code with N codeword bits, of which K are data bits.
+type Code struct {
+	N, K int
+
+	name    string
+	columns []uint32 // Syndrome of a bit error by position
+	errors  []int    // Error position by syndrome, -1 if not a single bit error
+}
+
+// Codes of the DMR AI spec., the parity bits are defined by the data bits they
+// are the sum of.
+var (
+	// Hamming15_11_3 protects the rows of the BPTC (196, 96).
+	Hamming15_11_3 = newCode(15, 11, 3,
+		[]int{0, 1, 2, 3, 5, 7, 8},
+		[]int{1, 2, 3, 4, 6, 8, 9},
+		[]int{2, 3, 4, 5, 7, 9, 10},
+		[]int{0, 1, 2, 4, 6, 7, 10},
+	)
+	// Hamming13_9_3 protects the columns of the BPTC (196, 96).
+	Hamming13_9_3 = newCode(13, 9, 3,
+		[]int{0, 1, 3, 5, 6},
+		[]int{0, 1, 2, 4, 6, 7},
+		[]int{0, 1, 2, 3, 5, 7, 8},
+		[]int{0, 2, 4, 5, 8},
+	)
+	// Hamming16_11_4 protects the rows of the variable length BPTC of the
+	// embedded signalling.
+	Hamming16_11_4 = newCode(16, 11, 4,
+		[]int{0, 1, 2, 3, 5, 7, 8},
+		[]int{1, 2, 3, 4, 6, 8, 9},
+		[]int{2, 3, 4, 5, 7, 9, 10},
+		[]int{0, 1, 2, 4, 6, 7, 10},
+		[]int{0, 2, 5, 6, 8, 9, 10},
+	)
+	// Hamming7_4_3 protects the TACT of the CACH and the single burst reverse
+	// channel.
+	Hamming7_4_3 = newCode(7, 4, 3,
+		[]int{0, 1, 2},
+		[]int{1, 2, 3},
+		[]int{0, 1, 3},
+	)
+)
+
+func newCode(n, k, d int, parity ...[]int) *Code {
+	var c = &Code{
+		N:       n,
+		K:       k,
+		name:    fmt.Sprintf("hamming(%d, %d, %d)", n, k, d),
+		columns: make([]uint32, n),
+		errors:  make([]int, 1<<uint(n-k)),
+	}
+	for i, bits := range parity {
+		var m = uint32(1) << uint(len(parity)-1-i)
+		for _, j := range bits {
+			c.columns[j] |= m
+		}
+		c.columns[k+i] = m
+	}
+	for i := range c.errors {
+		c.errors[i] = -1
+	}
+	for i, s := range c.columns {
+		c.errors[s] = i
+	}
+	return c
+}
+
+func (c *Code) String() string {
+	return c.name
+}
+
+// Encode returns the codeword of the K data bits.
+func (c *Code) Encode(data bit.Bits) (bit.Bits, error) {
+	if len(data) != c.K {
+		return nil, fmt.Errorf("fec/hamming: %s expected %d data bits, got %d", c.name, c.K, len(data))
+	}
+	var (
+		codeword = make(bit.Bits, c.N)
+		p        uint32
+	)
+	copy(codeword, data)
+	for j, b := range data {
+		if b&1 == 1 {
+			p ^= c.columns[j]
+		}
+	}
+	for i := c.N - 1; i >= c.K; i-- {
+		codeword[i] = uint8(p & 1)
+		p >>= 1
+	}
+	return codeword, nil
+}
+
+// Check returns true if the codeword has N bits and no bit errors.
+func (c *Code) Check(codeword bit.Bits) bool {
+	return len(codeword) == c.N && c.syndrome(codeword) == 0
+}
+
+// Correct corrects a single bit error of the codeword in place. It returns
+// the position of the corrected bit, or -1 if the codeword had no errors. If
+// the errors can't be corrected ok is false and the codeword is left as is.
+// Two bit errors are detected by the codes with distance 4, the codes with
+// distance 3 may correct the wrong bit instead.
+func (c *Code) Correct(codeword bit.Bits) (fixedPos int, ok bool) {
+	if len(codeword) != c.N {
+		return -1, false
+	}
+	var s = c.syndrome(codeword)
+	if s == 0 {
+		return -1, true
+	}
+	if fixedPos = c.errors[s]; fixedPos < 0 {
+		return -1, false
+	}
+	codeword[fixedPos] ^= 1
+	return fixedPos, true
+}
+
+// Decode returns the K data bits of the codeword after correcting a single
+// bit error, and whether a bit was corrected. The passed bits are left
+// untouched.
+func (c *Code) Decode(codeword bit.Bits) (bit.Bits, bool, error) {
+	if len(codeword) != c.N {
+		return nil, false, fmt.Errorf("fec/hamming: %s expected %d bits, got %d", c.name, c.N, len(codeword))
+	}
+	var corrected = append(bit.Bits{}, codeword...)
+	pos, ok := c.Correct(corrected)
+	if !ok {
+		return nil, false, fmt.Errorf("fec/hamming: %s uncorrectable errors", c.name)
+	}
+	return corrected[:c.K], pos >= 0, nil
+}
+
+// syndrome returns the parity bits of the data bits XORed with the received
+// parity bits, the first parity bit is the most significant bit.
+func (c *Code) syndrome(codeword bit.Bits) uint32 {
+	var s uint32
+	for i, b := range codeword {
+		if b&1 == 1 {
+			s ^= c.columns[i]
+		}
+	}
+	return s
+}
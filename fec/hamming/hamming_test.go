@@ -0,0 +1,127 @@
+package hamming
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+func TestCodes(t *testing.T) {
+	for _, c := range []*Code{Hamming15_11_3, Hamming13_9_3, Hamming16_11_4, Hamming7_4_3} {
+		for v := 0; v < 1<<uint(c.K); v++ {
+			var data = make(bit.Bits, c.K)
+			for i := range data {
+				data[i] = byte(v>>uint(c.K-1-i)) & 1
+			}
+			want, err := c.Encode(data)
+			if err != nil {
+				t.Fatalf("%s: encode failed: %v", c, err)
+			}
+			if !c.Check(want) || !bytes.Equal(want[:c.K], data) {
+				t.Fatalf("%s: encode %v failed, got %v", c, data, want)
+			}
+			if pos, ok := c.Correct(want); pos != -1 || !ok {
+				t.Fatalf("%s: correct %v without errors returned %d, %t", c, want, pos, ok)
+			}
+
+			// Single bit errors are corrected
+			for i := 0; i < c.N; i++ {
+				var codeword = append(bit.Bits{}, want...)
+				codeword[i] ^= 1
+				if c.Check(codeword) {
+					t.Fatalf("%s: check %v with error in bit %d succeeded", c, codeword, i)
+				}
+				pos, ok := c.Correct(codeword)
+				switch {
+				case !ok || pos != i:
+					t.Fatalf("%s: correct error in bit %d of %v returned %d, %t", c, i, want, pos, ok)
+				case !bytes.Equal(codeword, want):
+					t.Fatalf("%s: correct error in bit %d: expected %v, got %v", c, i, want, codeword)
+				}
+			}
+
+			// Double bit errors are detected by the distance 4 code
+			if c != Hamming16_11_4 {
+				continue
+			}
+			for i := 0; i < c.N; i++ {
+				for j := i + 1; j < c.N; j++ {
+					var codeword = append(bit.Bits{}, want...)
+					codeword[i] ^= 1
+					codeword[j] ^= 1
+					if pos, ok := c.Correct(codeword); ok {
+						t.Fatalf("%s: correct errors in bits %d and %d returned %d", c, i, j, pos)
+					}
+				}
+			}
+		}
+	}
+
+	if Hamming7_4_3.Check(make(bit.Bits, 6)) {
+		t.Fatal("check of short codeword succeeded")
+	}
+	if _, err := Hamming7_4_3.Encode(make(bit.Bits, 5)); err == nil {
+		t.Fatal("encode of 5 data bits succeeded")
+	}
+	if _, ok := Hamming7_4_3.Correct(make(bit.Bits, 8)); ok {
+		t.Fatal("correct of long codeword succeeded")
+	}
+}
+
+func TestBPTCCodes(t *testing.T) {
+	var tests = []struct {
+		Code   *Code
+		Encode func(bit.Bits) bit.Bits
+		Decode func(bit.Bits) (bit.Bits, bool, error)
+	}{
+		{Hamming15_11_3, Encode15_11, Decode15_11},
+		{Hamming13_9_3, Encode13_9, Decode13_9},
+	}
+	for _, test := range tests {
+		var c = test.Code
+		for v := 0; v < 1<<uint(c.K); v++ {
+			var data = make(bit.Bits, c.K)
+			for i := range data {
+				data[i] = byte(v>>uint(c.K-1-i)) & 1
+			}
+			var codeword = test.Encode(data)
+			if len(codeword) != c.N {
+				t.Fatalf("%s: encode %v failed", c, data)
+			}
+
+			for i := -1; i < c.N; i++ {
+				var corrupt = append(bit.Bits{}, codeword...)
+				if i >= 0 {
+					corrupt[i] ^= 1
+				}
+				got, corrected, err := test.Decode(corrupt)
+				switch {
+				case err != nil:
+					t.Fatalf("%s: decode with error in bit %d failed: %v", c, i, err)
+				case corrected != (i >= 0):
+					t.Fatalf("%s: decode with error in bit %d: corrected %t", c, i, corrected)
+				case !bytes.Equal(got, data):
+					t.Fatalf("%s: decode with error in bit %d: expected %v, got %v", c, i, data, got)
+				case i >= 0 && corrupt[i] == codeword[i]:
+					t.Fatalf("%s: decode changed the passed bits", c)
+				}
+			}
+		}
+
+		if test.Encode(make(bit.Bits, c.K+1)) != nil {
+			t.Fatalf("%s: encode of %d bits succeeded", c, c.K+1)
+		}
+		if _, _, err := test.Decode(make(bit.Bits, c.N-1)); err == nil {
+			t.Fatalf("%s: decode of %d bits succeeded", c, c.N-1)
+		}
+	}
+}
+
+func BenchmarkDecode15_11(b *testing.B) {
+	var codeword = Encode15_11(bit.Bits{1, 0, 1, 1, 0, 0, 1, 0, 1, 1, 1})
+	codeword[3] ^= 1
+	for i := 0; i < b.N; i++ {
+		Decode15_11(codeword)
+	}
+}
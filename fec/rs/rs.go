@@ -0,0 +1,136 @@
+// Package rs implements the shortened Reed-Solomon (12, 9, 4) code over
+// GF(2^8) of the DMR AI spec, with primitive polynomial x^8 + x^4 + x^3 +
+// x^2 + 1 (0x11d) and generator polynomial (x + a)(x + a^2)(x + a^3). The
+// code corrects a single symbol error and detects two symbol errors.
+package rs
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DataSize is the number of data symbols of a codeword.
+	DataSize = 9
+	// ParitySize is the number of parity symbols of a codeword.
+	ParitySize = 3
+	// CodewordSize is the number of symbols of a codeword.
+	CodewordSize = DataSize + ParitySize
+
+	primitive = 0x11d
+)
+
+// Masks applied to the parity symbols of the full LC, per burst type. See
+// DMR AI. spec. page 143.
+const (
+	VoiceLCHeaderMask    uint8 = 0x96
+	TerminatorWithLCMask uint8 = 0x99
+)
+
+// ErrUncorrectable is returned by Decode if the codeword has more symbol
+// errors than can be corrected.
+var ErrUncorrectable = errors.New("fec/rs: errors can't be corrected")
+
+var (
+	expTable [510]uint8
+	logTable [256]int
+	// Generator polynomial coefficients of x^2, x^1 and x^0, see DMR AI spec.
+	// page 136.
+	generator = [ParitySize]uint8{0x0e, 0x38, 0x40}
+)
+
+func init() {
+	var x = 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = uint8(x)
+		expTable[i+255] = uint8(x)
+		logTable[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= primitive
+		}
+	}
+}
+
+func mul(a, b uint8) uint8 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[logTable[a]+logTable[b]]
+}
+
+func div(a, b uint8) uint8 {
+	if a == 0 {
+		return 0
+	}
+	return expTable[logTable[a]+255-logTable[b]]
+}
+
+// Encode returns the codeword of the 9 data symbols, the data followed by
+// the 3 parity symbols.
+func Encode(data []byte) ([]byte, error) {
+	if len(data) != DataSize {
+		return nil, fmt.Errorf("fec/rs: expected %d data bytes, got %d", DataSize, len(data))
+	}
+
+	var parity [ParitySize]uint8
+	for _, b := range data {
+		var feedback = b ^ parity[0]
+		parity[0] = parity[1] ^ mul(generator[0], feedback)
+		parity[1] = parity[2] ^ mul(generator[1], feedback)
+		parity[2] = mul(generator[2], feedback)
+	}
+
+	var codeword = make([]byte, 0, CodewordSize)
+	codeword = append(codeword, data...)
+	return append(codeword, parity[:]...), nil
+}
+
+// Decode checks the 12 symbol codeword and returns the corrected data
+// symbols along with the number of corrected symbol errors. The passed
+// codeword is left untouched. ErrUncorrectable is returned if the codeword
+// has more than one symbol error.
+func Decode(codeword []byte) ([]byte, int, error) {
+	if len(codeword) != CodewordSize {
+		return nil, -1, fmt.Errorf("fec/rs: expected %d bytes, got %d", CodewordSize, len(codeword))
+	}
+
+	var data = make([]byte, DataSize)
+	copy(data, codeword)
+
+	var s = syndrome(codeword)
+	if s[0] == 0 && s[1] == 0 && s[2] == 0 {
+		return data, 0, nil
+	}
+
+	// For a single error with value e at degree k of the codeword polynomial,
+	// the syndromes are S(j) = e * a^(jk), so S(2)/S(1) = S(3)/S(2) = a^k.
+	if s[0] == 0 || s[1] == 0 || s[2] == 0 {
+		return nil, -1, ErrUncorrectable
+	}
+	var x = div(s[1], s[0])
+	if div(s[2], s[1]) != x {
+		return nil, -1, ErrUncorrectable
+	}
+	var k = logTable[x]
+	if k >= CodewordSize {
+		return nil, -1, ErrUncorrectable
+	}
+	if i := CodewordSize - 1 - k; i < DataSize {
+		data[i] ^= div(s[0], x)
+	}
+	return data, 1, nil
+}
+
+// syndrome evaluates the codeword polynomial at the roots a, a^2 and a^3 of
+// the generator polynomial, the first symbol is the coefficient of x^11.
+func syndrome(codeword []byte) [ParitySize]uint8 {
+	var s [ParitySize]uint8
+	for j := range s {
+		var root = expTable[j+1]
+		for _, b := range codeword {
+			s[j] = mul(s[j], root) ^ b
+		}
+	}
+	return s
+}
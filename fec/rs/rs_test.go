@@ -0,0 +1,102 @@
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Full LCs as received on air, with the voice LC header (0x96) and
+// terminator with LC (0x99) parity masks removed, and group calls to 204.
+var testCodewords = [][]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x09, 0x1f, 0x29, 0x66, 0x25 ^ 0x96, 0x35 ^ 0x96, 0x3b ^ 0x96},
+	{0x03, 0x00, 0x20, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x6d ^ 0x99, 0x9d ^ 0x99, 0xd3 ^ 0x99},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0xcc, 0x1f, 0x29, 0x66, 0xd5, 0xdf, 0xc7},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0xcc, 0x1f, 0x29, 0x67, 0xdb, 0xe7, 0x87},
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range testCodewords {
+		codeword, err := Encode(test[:DataSize])
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(codeword, test) {
+			t.Fatalf("encode failed: expected %x, got %x", test, codeword)
+		}
+	}
+
+	if _, err := Encode(make([]byte, CodewordSize)); err == nil {
+		t.Fatal("encode of 12 bytes succeeded")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, test := range testCodewords {
+		data, corrected, err := Decode(test)
+		switch {
+		case err != nil:
+			t.Fatalf("decode failed: %v", err)
+		case corrected != 0:
+			t.Fatalf("expected no corrections, got %d", corrected)
+		case !bytes.Equal(data, test[:DataSize]):
+			t.Fatalf("decode failed: expected %x, got %x", test[:DataSize], data)
+		}
+
+		// Every single symbol error must be corrected
+		for i := range test {
+			for _, e := range []byte{0x01, 0x5a, 0xff} {
+				var corrupt = append([]byte{}, test...)
+				corrupt[i] ^= e
+
+				data, corrected, err := Decode(corrupt)
+				switch {
+				case err != nil:
+					t.Fatalf("decode with error %#02x in symbol %d failed: %v", e, i, err)
+				case corrected != 1:
+					t.Fatalf("decode with error in symbol %d: expected 1 correction, got %d", i, corrected)
+				case !bytes.Equal(data, test[:DataSize]):
+					t.Fatalf("decode with error in symbol %d failed: expected %x, got %x", i, test[:DataSize], data)
+				case corrupt[i] == test[i]:
+					t.Fatal("decode changed the codeword")
+				}
+			}
+		}
+
+		// Two symbol errors must be detected
+		for i := range test {
+			for j := i + 1; j < len(test); j++ {
+				var corrupt = append([]byte{}, test...)
+				corrupt[i] ^= 0x01
+				corrupt[j] ^= 0x80
+				if _, _, err := Decode(corrupt); err != ErrUncorrectable {
+					t.Fatalf("decode with errors in symbols %d and %d: expected %v, got %v", i, j, ErrUncorrectable, err)
+				}
+			}
+		}
+	}
+
+	if _, _, err := Decode(make([]byte, DataSize)); err == nil {
+		t.Fatal("decode of 9 bytes succeeded")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var data = make([]byte, DataSize)
+	for n := 0; n < 256; n++ {
+		for i := range data {
+			data[i] = uint8(n*31 + i*7)
+		}
+		codeword, err := Encode(data)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		codeword[n%CodewordSize] ^= uint8(n | 1)
+		decoded, corrected, err := Decode(codeword)
+		switch {
+		case err != nil:
+			t.Fatalf("decode of %x failed: %v", codeword, err)
+		case corrected != 1 || !bytes.Equal(decoded, data):
+			t.Fatalf("decode of %x failed: expected %x, got %x (%d corrected)", codeword, data, decoded, corrected)
+		}
+	}
+}
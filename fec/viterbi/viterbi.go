@@ -0,0 +1,137 @@
+// Package viterbi implements the rate ½ convolutional code with constraint
+// length 5 and generator polynomials 0x17 and 0x19, with a hard and a soft
+// decision Viterbi decoder.
+package viterbi
+
+import (
+	"math"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+const (
+	// ConstraintLength is the number of input bits each output bit depends on.
+	ConstraintLength = 5
+	// TailBits is the number of zero bits the encoder appends to return to
+	// the zero state.
+	TailBits = ConstraintLength - 1
+
+	g1     = 0x17
+	g2     = 0x19
+	states = 1 << TailBits
+)
+
+// output returns the two coded bits for the register holding the newest
+// input bit in the least significant bit.
+func output(register uint8) (uint8, uint8) {
+	return parity(register & g1), parity(register & g2)
+}
+
+func parity(v uint8) uint8 {
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return v & 1
+}
+
+// Encode returns the coded bits of the data bits, two bits per data bit and
+// for each of the TailBits zero bits that terminate the code.
+func Encode(bits bit.Bits) bit.Bits {
+	var (
+		coded    = make(bit.Bits, 0, 2*(len(bits)+TailBits))
+		register uint8
+	)
+	for i := 0; i < len(bits)+TailBits; i++ {
+		var b uint8
+		if i < len(bits) {
+			b = bits[i] & 1
+		}
+		register = (register<<1 | b) & (1<<ConstraintLength - 1)
+		o1, o2 := output(register)
+		coded = append(coded, o1, o2)
+	}
+	return coded
+}
+
+// Decode returns the most likely data bits of the coded bits, as returned by
+// Encode. It returns nil if the coded bits are too short or of odd length.
+func Decode(bits bit.Bits) bit.Bits {
+	var llr = make([]float32, len(bits))
+	for i, b := range bits {
+		if b&1 == 0 {
+			llr[i] = 1
+		} else {
+			llr[i] = -1
+		}
+	}
+	return DecodeSoft(llr)
+}
+
+// DecodeSoft is like Decode, for soft decisions of the coded bits given as log
+// likelihood ratios log(P(0) / P(1)). Positive values are likely zero bits,
+// the larger the magnitude the more reliable the bit. A zero is an erasure.
+func DecodeSoft(llr []float32) bit.Bits {
+	if len(llr)%2 != 0 || len(llr)/2 < TailBits {
+		return nil
+	}
+
+	var (
+		steps   = len(llr) / 2
+		metrics [states]float32
+		next    [states]float32
+		// Previous state and input bit per step and state
+		paths = make([][states]uint8, steps)
+	)
+	for s := 1; s < states; s++ {
+		metrics[s] = math.MaxFloat32
+	}
+
+	for i := 0; i < steps; i++ {
+		for s := range next {
+			next[s] = math.MaxFloat32
+		}
+		for s := 0; s < states; s++ {
+			if metrics[s] == math.MaxFloat32 {
+				continue
+			}
+			for b := uint8(0); b < 2; b++ {
+				if i >= steps-TailBits && b == 1 {
+					// The tail bits are zero
+					continue
+				}
+				var (
+					register = uint8(s)<<1 | b
+					o1, o2   = output(register)
+					metric   = metrics[s] + cost(llr[2*i], o1) + cost(llr[2*i+1], o2)
+					to       = register & (states - 1)
+				)
+				if metric < next[to] {
+					next[to] = metric
+					paths[i][to] = uint8(s)<<1 | b
+				}
+			}
+		}
+		metrics = next
+	}
+
+	// Trace back from the zero state the tail bits end in
+	var (
+		bits  = make(bit.Bits, steps)
+		state uint8
+	)
+	for i := steps - 1; i >= 0; i-- {
+		var path = paths[i][state]
+		bits[i] = path & 1
+		state = path >> 1
+	}
+	return bits[:steps-TailBits]
+}
+
+// cost returns the branch metric of a coded bit, the less likely the bit,
+// the higher the cost.
+func cost(llr float32, b uint8) float32 {
+	if b == 0 {
+		return -llr
+	}
+	return llr
+}
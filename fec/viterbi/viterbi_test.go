@@ -0,0 +1,55 @@
+package viterbi
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+func TestViterbi(t *testing.T) {
+	var r = rand.New(rand.NewSource(1451736000))
+	for n := 0; n < 100; n++ {
+		var data = make(bit.Bits, 1+r.Intn(96))
+		for i := range data {
+			data[i] = uint8(r.Intn(2))
+		}
+
+		var coded = Encode(data)
+		if len(coded) != 2*(len(data)+TailBits) {
+			t.Fatalf("encode %v: expected %d bits, got %d", data, 2*(len(data)+TailBits), len(coded))
+		}
+		if got := Decode(coded); !bytes.Equal(got, data) {
+			t.Fatalf("decode without errors: expected %v, got %v", data, got)
+		}
+
+		// Bit errors that are far enough apart are corrected
+		var corrupt = append(bit.Bits{}, coded...)
+		for i := r.Intn(12); i < len(corrupt); i += 12 {
+			corrupt[i] ^= 1
+		}
+		if got := Decode(corrupt); !bytes.Equal(got, data) {
+			t.Fatalf("decode with bit errors: expected %v, got %v", data, got)
+		}
+
+		// Soft decisions with noise, weak wrong bits are outvoted
+		var llr = make([]float32, len(coded))
+		for i, b := range coded {
+			llr[i] = 1 + r.Float32()
+			if b == 1 {
+				llr[i] = -llr[i]
+			}
+			if i%5 == 2 {
+				llr[i] = -llr[i] / 4
+			}
+		}
+		if got := DecodeSoft(llr); !bytes.Equal(got, data) {
+			t.Fatalf("soft decode with noise: expected %v, got %v", data, got)
+		}
+	}
+
+	if Decode(make(bit.Bits, 7)) != nil || Decode(make(bit.Bits, 6)) != nil {
+		t.Fatal("decode of invalid size succeeded")
+	}
+}
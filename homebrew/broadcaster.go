@@ -0,0 +1,128 @@
+package homebrew
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// Broadcaster bridges a repeater to several masters at once, for example to
+// Brandmeister and DMR-MARC. Packets received from any link are passed to the
+// PacketFunc and broadcast to all other links, packets sent with SendFrame go
+// out on all links. Every link has an ACL that decides which packets are sent
+// to it.
+//
+// Broadcaster is a Group with unnamed links, streams are remembered by the
+// link they were received from and are never sent back to that link, also
+// not when another master relays them back.
+type Broadcaster struct {
+	group *Group
+	mutex *sync.Mutex
+	links []*Homebrew
+	names map[*Homebrew]string
+	next  int
+	pf    dmr.PacketFunc
+}
+
+// NewBroadcaster returns a broadcaster passing all received packets to f,
+// which may be nil.
+func NewBroadcaster(f dmr.PacketFunc) *Broadcaster {
+	var b = &Broadcaster{
+		group: NewGroup(),
+		mutex: &sync.Mutex{},
+		names: make(map[*Homebrew]string),
+		pf:    f,
+	}
+	b.group.SetPacketFunc(b.receive)
+	return b
+}
+
+// Group returns the group the links are bridged with, for example to change
+// its StreamTimeout.
+func (b *Broadcaster) Group() *Group {
+	return b.group
+}
+
+// Add adds a link, it replaces the PacketFunc of the link. Only the packets
+// allowed by acl are sent to the link, a nil acl allows all packets.
+func (b *Broadcaster) Add(link *Homebrew, acl *dmr.ACL) error {
+	if link == nil {
+		return errors.New("homebrew: link can't be nil")
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.names[link]; ok {
+		return errors.New("homebrew: link already in broadcaster")
+	}
+	var name = strconv.Itoa(b.next)
+	if err := b.group.Add(name, link); err != nil {
+		return err
+	}
+	if err := b.group.SetACL(name, acl); err != nil {
+		b.group.Remove(name)
+		return err
+	}
+	b.next++
+	b.links = append(b.links, link)
+	b.names[link] = name
+	return nil
+}
+
+// Remove removes a link, the link is not closed.
+func (b *Broadcaster) Remove(link *Homebrew) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	name, ok := b.names[link]
+	if !ok {
+		return
+	}
+	b.group.Remove(name)
+	delete(b.names, link)
+	for i, l := range b.links {
+		if l == link {
+			b.links = append(b.links[:i:i], b.links[i+1:]...)
+			break
+		}
+	}
+}
+
+// Links returns the links, in the order they were added.
+func (b *Broadcaster) Links() []*Homebrew {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]*Homebrew{}, b.links...)
+}
+
+// SendFrame sends a packet on all links that allow it. Streams received from
+// one of the links are not sent back to that link.
+func (b *Broadcaster) SendFrame(p *dmr.Packet) error {
+	return b.group.forward(b.group.origin(p.StreamID), p)
+}
+
+func (b *Broadcaster) receive(name string, link *Homebrew, p *dmr.Packet) error {
+	if !b.group.track(name, p) {
+		// Relayed back to us by another link, it was handled already
+		return nil
+	}
+
+	if b.pf != nil {
+		if err := b.pf(link, p); err != nil {
+			return err
+		}
+	}
+	return b.group.forward(name, p)
+}
+
+// origin returns the link a stream was received from, or nil.
+func (b *Broadcaster) origin(streamID uint32) *Homebrew {
+	var name = b.group.origin(streamID)
+	if name == "" {
+		return nil
+	}
+	return b.group.Link(name)
+}
@@ -0,0 +1,123 @@
+package homebrew
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestBroadcaster(t *testing.T) {
+	var (
+		links    [3]*Homebrew
+		conns    [3]*net.UDPConn
+		received []uint32
+		b        = NewBroadcaster(func(_ dmr.Repeater, p *dmr.Packet) error {
+			received = append(received, p.StreamID)
+			return nil
+		})
+		acl = dmr.NewACL(true)
+	)
+	b.Group().StreamTimeout = time.Second
+	acl.Deny(0, 91)
+	for i := range links {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+
+		links[i] = testHomebrew(t)
+		defer links[i].Close()
+		var peer = &Peer{ID: 1, Addr: conn.LocalAddr().(*net.UDPAddr), Status: AuthDone}
+		links[i].Peer[peer.Addr.String()] = peer
+		links[i].PeerID[peer.ID] = peer
+
+		var linkACL *dmr.ACL
+		if i == 2 {
+			linkACL = acl
+		}
+		if err := b.Add(links[i], linkACL); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if err := b.Add(links[0], nil); err == nil {
+		t.Fatal("add of duplicate link succeeded")
+	}
+
+	// receive passes a packet to the broadcaster as if link i received it
+	var receive = func(i int, p *dmr.Packet) error {
+		return b.receive(b.names[links[i]], links[i], p)
+	}
+
+	// sent returns which links received a packet
+	var sent = func() [3]bool {
+		var got [3]bool
+		var data = make([]byte, 64)
+		for i, conn := range conns {
+			conn.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+			if _, err := conn.Read(data); err == nil {
+				got[i] = true
+			}
+		}
+		return got
+	}
+
+	for _, test := range []struct {
+		Name     string
+		From     int // -1 for SendFrame
+		Packet   *dmr.Packet
+		Want     [3]bool
+		Received int
+	}{
+		{"broadcast", 0, &dmr.Packet{StreamID: 1, DstID: 204}, [3]bool{false, true, true}, 1},
+		{"echo", 1, &dmr.Packet{StreamID: 1, DstID: 204}, [3]bool{}, 1},
+		{"acl", 1, &dmr.Packet{StreamID: 2, DstID: 91}, [3]bool{true, false, false}, 2},
+		{"send", -1, &dmr.Packet{StreamID: 3, DstID: 204}, [3]bool{true, true, true}, 2},
+		{"send stream", -1, &dmr.Packet{StreamID: 1, DstID: 204}, [3]bool{false, true, true}, 2},
+	} {
+		var err error
+		if test.From < 0 {
+			err = b.SendFrame(test.Packet)
+		} else {
+			err = receive(test.From, test.Packet)
+		}
+		if err != nil {
+			t.Fatalf("%s: failed: %v", test.Name, err)
+		}
+		if got := sent(); got != test.Want {
+			t.Fatalf("%s: expected sent to %v, got %v", test.Name, test.Want, got)
+		}
+		if len(received) != test.Received {
+			t.Fatalf("%s: expected %d received packets, got %d", test.Name, test.Received, len(received))
+		}
+	}
+
+	// The origin of a stream is kept after the terminator, so relayed copies
+	// arriving late are not sent back, and forgotten after the timeout
+	b.Group().StreamTimeout = time.Millisecond * 250
+	if err := receive(0, &dmr.Packet{StreamID: 1, DataType: dmr.TerminatorWithLC}); err != nil {
+		t.Fatalf("terminator failed: %v", err)
+	}
+	sent()
+	if err := receive(1, &dmr.Packet{StreamID: 1, DataType: dmr.TerminatorWithLC}); err != nil {
+		t.Fatalf("relayed terminator failed: %v", err)
+	}
+	if got := sent(); got != [3]bool{} {
+		t.Fatalf("relayed terminator sent to %v", got)
+	}
+	if origin := b.origin(1); origin != links[0] {
+		t.Fatal("stream origin forgotten at terminator")
+	}
+	time.Sleep(time.Millisecond * 300)
+	if origin := b.origin(1); origin != nil {
+		t.Fatal("stream origin not forgotten after timeout")
+	}
+
+	b.Remove(links[1])
+	if got := b.Links(); len(got) != 2 || got[0] != links[0] || got[1] != links[2] {
+		t.Fatalf("unexpected links after remove %v", got)
+	}
+}
@@ -1,5 +1,18 @@
 package homebrew
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/pd0mz/go-dmr"
+)
+
 type Config struct {
 	// ID is the local DMR ID.
 	ID uint32
@@ -10,3 +23,183 @@ type Config struct {
 	// AuthKey is the shared secret.
 	AuthKey string
 }
+
+// Network holds the link settings that are kept in a configuration file next
+// to the RepeaterConfiguration.
+type Network struct {
+	// Local is the address to listen on, as host:port, :port or a port,
+	// which listens on the port of DefaultLocal. A fixed port keeps the
+	// mapping of a NAT stable across restarts.
+	Local string `json:"local,omitempty"`
+	// Master is the host and port of the master.
+	Master string `json:"master,omitempty"`
+	// Masters are tried in order when the link fails, they take precedence
+	// over Master.
+	Masters []string `json:"masters,omitempty"`
+	// RotateMasters starts over at the first of Masters after the last one
+	// failed.
+	RotateMasters bool `json:"rotate_masters,omitempty"`
+	// MasterID is the DMR ID of the master.
+	MasterID uint32 `json:"master_id,omitempty"`
+	// AuthKey is the shared secret, it can only be empty with NoAuth.
+	AuthKey string `json:"auth_key"`
+	// NoAuth allows an empty AuthKey, for masters with authentication
+	// disabled.
+	NoAuth bool `json:"no_auth,omitempty"`
+	// Slots are the timeslots to receive, 1 or 2. Empty receives both.
+	Slots []int `json:"slots,omitempty"`
+	// Groups are the talkgroups to receive group calls for. Empty receives
+	// all talkgroups.
+	Groups []uint32 `json:"groups,omitempty"`
+	// IPv4Only keeps the link on IPv4, by default the link listens dual
+	// stack and prefers the IPv6 address of masters that have both.
+	IPv4Only bool `json:"ipv4_only,omitempty"`
+}
+
+// Default local addresses, used if the Network has no Local address.
+const (
+	DefaultLocal     = "[::]:62030"
+	DefaultLocalIPv4 = "0.0.0.0:62030"
+)
+
+// UDPNetwork returns the network to pass to NewNetwork, "udp4" if IPv4Only
+// is set and "udp" otherwise.
+func (n *Network) UDPNetwork() string {
+	if n.IPv4Only {
+		return "udp4"
+	}
+	return "udp"
+}
+
+// LocalAddr returns the local address to listen on, DefaultLocal or
+// DefaultLocalIPv4 if Local is empty or only a port.
+func (n *Network) LocalAddr() (*net.UDPAddr, error) {
+	var local = DefaultLocal
+	if n.IPv4Only {
+		local = DefaultLocalIPv4
+	}
+	if _, err := strconv.ParseUint(n.Local, 10, 16); err == nil {
+		host, _, _ := net.SplitHostPort(local)
+		local = net.JoinHostPort(host, n.Local)
+	} else if n.Local != "" {
+		local = n.Local
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultResolveTimeout)
+	defer cancel()
+	addr, err := resolveUDPAddr(ctx, n.UDPNetwork(), local, !n.IPv4Only)
+	if err != nil {
+		return nil, fmt.Errorf("homebrew: invalid local address %q: %v", local, err)
+	}
+	return addr, nil
+}
+
+// Peer returns a peer for the master, to pass to Link.
+func (n *Network) Peer() (*Peer, error) {
+	if n.Master == "" && len(n.Masters) == 0 {
+		return nil, errors.New("homebrew: network has no master")
+	}
+	if n.AuthKey == "" && !n.NoAuth {
+		return nil, errors.New("homebrew: network has no auth key")
+	}
+	return &Peer{
+		ID:          n.MasterID,
+		Host:        n.Master,
+		Hosts:       append([]string{}, n.Masters...),
+		RotateHosts: n.RotateMasters,
+		AuthKey:     []byte(n.AuthKey),
+		NoAuth:      n.NoAuth,
+	}, nil
+}
+
+// AcceptFunc returns the filter for the Slots and Groups, to set as the
+// AcceptFunc of the link. It returns nil if all frames are accepted.
+func (n *Network) AcceptFunc() func(*dmr.Packet) bool {
+	if len(n.Slots) == 0 && len(n.Groups) == 0 {
+		return nil
+	}
+	return AcceptFilter(n.Slots, n.Groups)
+}
+
+// AcceptFilter returns an AcceptFunc that passes frames on one of the
+// timeslots, numbered 1 and 2, and group calls to one of the groups. Private
+// calls are not filtered by group. An empty list passes everything.
+func AcceptFilter(slots []int, groups []uint32) func(*dmr.Packet) bool {
+	var (
+		slot  [2]bool
+		group = make(map[uint32]bool, len(groups))
+	)
+	for _, s := range slots {
+		if s == 1 || s == 2 {
+			slot[s-1] = true
+		}
+	}
+	for _, id := range groups {
+		group[id] = true
+	}
+	return func(p *dmr.Packet) bool {
+		if len(slots) > 0 && (p.Timeslot > 1 || !slot[p.Timeslot]) {
+			return false
+		}
+		return len(groups) == 0 || p.CallType != dmr.CallTypeGroup || group[p.DstID]
+	}
+}
+
+// configFile is the layout of the JSON configuration files.
+type configFile struct {
+	Network  *Network               `json:"network"`
+	Repeater *RepeaterConfiguration `json:"repeater"`
+}
+
+// LoadConfig reads the network and repeater configuration from a JSON file,
+// as written by SaveConfig:
+//
+//	{
+//	  "network": {
+//	    "masters": ["master1.example.org:62031", "master2.example.org:62031"],
+//	    "auth_key": "passw0rd"
+//	  },
+//	  "repeater": {
+//	    "callsign": "PD0MZ",
+//	    "id": 2042214,
+//	    "color_code": 1
+//	  }
+//	}
+//
+// Only JSON is supported, YAML files are not read. The repeater
+// configuration is not validated, the master is only sent a valid
+// configuration at login.
+func LoadConfig(path string) (*Network, *RepeaterConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		config  configFile
+		decoder = json.NewDecoder(bytes.NewReader(data))
+	)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, nil, fmt.Errorf("homebrew: %s: %v", path, err)
+	}
+	switch {
+	case config.Network == nil:
+		return nil, nil, fmt.Errorf("homebrew: %s: no network section", path)
+	case config.Repeater == nil:
+		return nil, nil, fmt.Errorf("homebrew: %s: no repeater section", path)
+	}
+	return config.Network, config.Repeater, nil
+}
+
+// SaveConfig writes the network and repeater configuration to a JSON file,
+// which is readable by the owner only as it holds the auth key.
+func SaveConfig(path string, n *Network, rc *RepeaterConfiguration) error {
+	if n == nil || rc == nil {
+		return errors.New("homebrew: network and repeater configuration can't be nil")
+	}
+	data, err := json.MarshalIndent(configFile{Network: n, Repeater: rc}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
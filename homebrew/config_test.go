@@ -0,0 +1,144 @@
+package homebrew
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestConfig(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "homebrew.json")
+		n    = &Network{
+			Local:         ":62032",
+			Masters:       []string{"master1.example.org:62031", "master2.example.org:62031"},
+			RotateMasters: true,
+			MasterID:      2041,
+			AuthKey:       "passw0rd",
+			Slots:         []int{2},
+			Groups:        []uint32{91, 2621},
+		}
+		rc = &RepeaterConfiguration{
+			Callsign:    "PD0MZ",
+			ID:          2042214,
+			RXFreq:      438800000,
+			TXFreq:      431200000,
+			TXPower:     25,
+			ColorCode:   1,
+			Latitude:    52.3676,
+			Longitude:   4.9041,
+			Height:      12,
+			Location:    "Amsterdam",
+			Description: "Test",
+			URL:         "https://example.org/",
+		}
+	)
+	if err := SaveConfig(path, n, rc); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	gotNetwork, gotRepeater, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotNetwork, n) {
+		t.Fatalf("expected network %+v, got %+v", n, gotNetwork)
+	}
+	if *gotRepeater != *rc {
+		t.Fatalf("expected repeater %+v, got %+v", rc, gotRepeater)
+	}
+
+	peer, err := gotNetwork.Peer()
+	if err != nil {
+		t.Fatalf("peer failed: %v", err)
+	}
+	if peer.ID != 2041 || len(peer.Hosts) != 2 || !peer.RotateHosts || string(peer.AuthKey) != "passw0rd" {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+	if addr, err := gotNetwork.LocalAddr(); err != nil || addr.Port != 62032 {
+		t.Fatalf("unexpected local address %v: %v", addr, err)
+	}
+
+	for _, test := range []struct {
+		Name, Data string
+	}{
+		{"invalid", `{"network": `},
+		{"unknown field", `{"network": {"auth_key": "x", "password": "x"}, "repeater": {}}`},
+		{"no repeater", `{"network": {"auth_key": "x"}}`},
+	} {
+		if err := os.WriteFile(path, []byte(test.Data), 0600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if _, _, err := LoadConfig(path); err == nil {
+			t.Fatalf("%s: load succeeded", test.Name)
+		}
+	}
+	for _, test := range []struct {
+		Network *Network
+		Want    string
+	}{
+		{&Network{}, "[::]:62030"},
+		{&Network{IPv4Only: true}, "0.0.0.0:62030"},
+		{&Network{Local: "127.0.0.1:62032", IPv4Only: true}, "127.0.0.1:62032"},
+		{&Network{Local: "62032"}, "[::]:62032"},
+		{&Network{Local: "62032", IPv4Only: true}, "0.0.0.0:62032"},
+	} {
+		addr, err := test.Network.LocalAddr()
+		if err != nil {
+			t.Fatalf("local address of %+v failed: %v", test.Network, err)
+		}
+		if addr.String() != test.Want {
+			t.Fatalf("expected local address %s, got %s", test.Want, addr)
+		}
+	}
+	if _, err := (&Network{Local: "[::1]:62032", IPv4Only: true}).LocalAddr(); err == nil {
+		t.Fatal("IPv6 local address with IPv4Only succeeded")
+	}
+	if _, err := (&Network{AuthKey: "x"}).Peer(); err == nil {
+		t.Fatal("peer without master succeeded")
+	}
+	if _, err := (&Network{Master: "master.example.org:62031"}).Peer(); err == nil {
+		t.Fatal("peer without auth key succeeded")
+	}
+	if peer, err := (&Network{Master: "master.example.org:62031", NoAuth: true}).Peer(); err != nil || len(peer.AuthKey) != 0 || !peer.NoAuth {
+		t.Fatalf("peer without auth key and NoAuth failed: %v", err)
+	}
+}
+
+func TestAcceptFunc(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var n = &Network{Slots: []int{2}, Groups: []uint32{91, 2621}}
+	h.AcceptFunc = n.AcceptFunc()
+	var got []uint32
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		got = append(got, p.StreamID)
+		return nil
+	})
+
+	for _, p := range []*dmr.Packet{
+		{StreamID: 1, Timeslot: 1, CallType: dmr.CallTypeGroup, DstID: 91},
+		{StreamID: 2, Timeslot: 0, CallType: dmr.CallTypeGroup, DstID: 91},
+		{StreamID: 3, Timeslot: 1, CallType: dmr.CallTypeGroup, DstID: 204},
+		{StreamID: 4, Timeslot: 1, CallType: dmr.CallTypePrivate, DstID: 2043044},
+		{StreamID: 5, Timeslot: 0, CallType: dmr.CallTypePrivate, DstID: 2042214}, // To us
+		{StreamID: 6, Timeslot: 1, CallType: dmr.CallTypeGroup, DstID: 2621},
+	} {
+		if err := h.enqueue(p, &Peer{ID: 1}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	if len(got) != 4 || got[0] != 1 || got[1] != 4 || got[2] != 5 || got[3] != 6 {
+		t.Fatalf("expected streams [1 4 5 6], got %v", got)
+	}
+	if s := h.Stats(); s.FramesAccepted != 4 || s.FramesFiltered != 2 {
+		t.Fatalf("expected 4/2 frames accepted, got %d/%d", s.FramesAccepted, s.FramesFiltered)
+	}
+
+	if (&Network{}).AcceptFunc() != nil {
+		t.Fatal("network without filters returned an AcceptFunc")
+	}
+}
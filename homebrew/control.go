@@ -0,0 +1,109 @@
+package homebrew
+
+import (
+	"fmt"
+)
+
+// ControlEvent is a control message received from a linked peer, other than
+// the DMR data and the keepalives, see Homebrew.ControlFunc.
+type ControlEvent interface {
+	String() string
+}
+
+// TGBusy is sent by a master, as an MSTNAK with the timeslot number 1 or 2
+// and the 24 bit talkgroup after our repeater ID, when it refuses our
+// transmission because the talkgroup is busy.
+type TGBusy struct {
+	Slot  int
+	DstID uint32
+}
+
+func (e TGBusy) String() string {
+	return fmt.Sprintf("talkgroup %d busy on TS%d", e.DstID, e.Slot)
+}
+
+// Beacon is sent by a master, as an RPTSBKN, to request a beacon
+// transmission from the repeater.
+type Beacon struct{}
+
+func (e Beacon) String() string {
+	return "beacon request"
+}
+
+// Unknown is a message with an opcode the package doesn't know, passed on as
+// is so new features of a master are observable.
+type Unknown struct {
+	Opcode string
+	Data   []byte // Data following the opcode
+}
+
+func (e Unknown) String() string {
+	return fmt.Sprintf("unknown opcode %q, %d bytes", e.Opcode, len(e.Data))
+}
+
+// NAKReason is the reason of an MSTNAK, sent by masters that give one as a
+// byte following the repeater ID. A plain NAK has NAKReasonNone.
+type NAKReason uint8
+
+// NAK reasons
+const (
+	NAKReasonNone       NAKReason = iota
+	NAKReasonIDConflict           // Another repeater is linked with the same ID
+)
+
+func (r NAKReason) String() string {
+	switch r {
+	case NAKReasonNone:
+		return "none"
+	case NAKReasonIDConflict:
+		return "ID conflict"
+	default:
+		return fmt.Sprintf("reason %d", uint8(r))
+	}
+}
+
+// parseNAKReason returns the reason of an MSTNAK payload, which is
+// NAKReasonNone for a plain NAK.
+func (h *Homebrew) parseNAKReason(payload []byte) NAKReason {
+	if len(payload) != len(h.id)+1 || !h.checkRepeaterID(payload[:len(h.id)]) {
+		return NAKReasonNone
+	}
+	return NAKReason(payload[len(h.id)])
+}
+
+// parseTGBusy returns the talkgroup busy event of an MSTNAK payload, or false
+// if the payload is a plain NAK.
+func (h *Homebrew) parseTGBusy(payload []byte) (TGBusy, bool) {
+	if len(payload) != len(h.id)+4 || !h.checkRepeaterID(payload[:len(h.id)]) {
+		return TGBusy{}, false
+	}
+	var data = payload[len(h.id):]
+	if data[0] != 1 && data[0] != 2 {
+		return TGBusy{}, false
+	}
+	return TGBusy{
+		Slot:  int(data[0]),
+		DstID: uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]),
+	}, true
+}
+
+// parseUnknown splits an unknown message in the opcode, the leading upper
+// case letters, and the data following it.
+func parseUnknown(data []byte) Unknown {
+	var n int
+	for n < len(data) && data[n] >= 'A' && data[n] <= 'Z' {
+		n++
+	}
+	return Unknown{
+		Opcode: string(data[:n]),
+		Data:   append([]byte{}, data[n:]...),
+	}
+}
+
+// control passes the event to the ControlFunc, if set.
+func (h *Homebrew) control(peer *Peer, event ControlEvent) {
+	h.logger().Debug("peer sent control message", "peer", peer.ID, "event", event.String())
+	if h.ControlFunc != nil {
+		h.ControlFunc(peer, event)
+	}
+}
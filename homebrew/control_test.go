@@ -0,0 +1,50 @@
+package homebrew
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestControlFunc(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var (
+		events []ControlEvent
+		peer   = &Peer{ID: 1, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Status: AuthDone, linked: true}
+	)
+	h.Peer[peer.Addr.String()] = peer
+	h.PeerID[peer.ID] = peer
+	h.ControlFunc = func(p *Peer, event ControlEvent) {
+		if p != peer {
+			t.Fatalf("expected peer %d, got %d", peer.ID, p.ID)
+		}
+		events = append(events, event)
+	}
+
+	for _, data := range [][]byte{
+		append(append(MasterNAK, h.id...), 2, 0x00, 0x00, 0x5b),
+		append(RepeaterBeacon, h.id...),
+		append([]byte("MSTFOO"), h.id...),
+	} {
+		if err := h.handle(peer.Addr, data); err != nil {
+			t.Fatalf("handle %q failed: %v", data, err)
+		}
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", events)
+	}
+	if busy, ok := events[0].(TGBusy); !ok || busy.Slot != 2 || busy.DstID != 91 {
+		t.Fatalf("expected talkgroup 91 busy on TS2, got %v", events[0])
+	}
+	if _, ok := events[1].(Beacon); !ok {
+		t.Fatalf("expected beacon request, got %v", events[1])
+	}
+	if unknown, ok := events[2].(Unknown); !ok || unknown.Opcode != "MSTFOO" || !bytes.Equal(unknown.Data, h.id) {
+		t.Fatalf("expected unknown opcode MSTFOO, got %v", events[2])
+	}
+	if peer.Status != AuthDone {
+		t.Fatalf("expected the link to stay up after a talkgroup busy NAK, got %s", peer.Status.String())
+	}
+}
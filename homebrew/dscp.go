@@ -0,0 +1,35 @@
+//go:build linux || darwin || freebsd
+
+package homebrew
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDSCP sets the traffic class of the socket. The DSCP is the upper six
+// bits of the IPv4 TOS and IPv6 traffic class.
+func setDSCP(conn *net.UDPConn, dscp uint8) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var (
+		tos  = int(dscp) << 2
+		ipv6 = conn.LocalAddr().(*net.UDPAddr).IP.To4() == nil
+		serr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		if ipv6 {
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+			// Dual stack sockets also send IPv4, where the platform allows it
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+			return
+		}
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
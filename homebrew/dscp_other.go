@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+
+package homebrew
+
+import (
+	"errors"
+	"net"
+)
+
+func setDSCP(conn *net.UDPConn, dscp uint8) error {
+	return errors.New("not supported on this platform")
+}
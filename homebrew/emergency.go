@@ -0,0 +1,84 @@
+package homebrew
+
+import (
+	"sync"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// emergencyTracker decodes the Link Control messages of voice streams and
+// remembers the streams that signalled an emergency call in their service
+// options. A stream stays an emergency call until it ends, even if later LCs
+// don't have the emergency flag set.
+type emergencyTracker struct {
+	mutex   *sync.Mutex
+	emb     *dmr.EMBReassembler
+	lc      *dmr.LC // Set by the EMB reassembler
+	streams map[uint32]bool
+}
+
+func newEmergencyTracker() *emergencyTracker {
+	var t = &emergencyTracker{
+		mutex:   &sync.Mutex{},
+		streams: make(map[uint32]bool),
+	}
+	t.emb = dmr.NewEMBReassembler(func(_ uint32, lc *dmr.LC) { t.lc = lc })
+	return t
+}
+
+// add decodes the LC of the packet, if any. It returns the LC if the packet
+// starts an emergency call.
+func (t *emergencyTracker) add(p *dmr.Packet) *dmr.LC {
+	if len(p.Bits) < dmr.PayloadBits {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var lc *dmr.LC
+	switch p.DataType {
+	case dmr.VoiceLC, dmr.TerminatorWithLC:
+		var (
+			data = make([]byte, 12)
+			mask = dmr.VoiceLCHeaderMask
+		)
+		if p.DataType == dmr.TerminatorWithLC {
+			mask = dmr.TerminatorWithLCMask
+		}
+		if err := bptc.Decode(p.InfoBits(), data); err != nil {
+			return nil
+		}
+		var err error
+		if lc, err = dmr.ParseFullLCWithMask(data, mask); err != nil {
+			return nil
+		}
+		break
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		t.lc = nil
+		if err := t.emb.AddPacket(p); err != nil {
+			return nil
+		}
+		lc = t.lc
+		break
+	}
+
+	if lc == nil || !lc.ServiceOptions.Emergency || t.streams[p.StreamID] {
+		return nil
+	}
+	t.streams[p.StreamID] = true
+	return lc
+}
+
+func (t *emergencyTracker) active(streamID uint32) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.streams[streamID]
+}
+
+func (t *emergencyTracker) end(streamID uint32) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.streams, streamID)
+}
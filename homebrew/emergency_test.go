@@ -0,0 +1,96 @@
+package homebrew
+
+import (
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+func TestEmergency(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var got = map[uint32]int{}
+	h.OnEmergency = func(p *dmr.Packet, lc *dmr.LC) {
+		if !lc.ServiceOptions.Emergency {
+			t.Fatalf("stream %d: LC without emergency flag", p.StreamID)
+		}
+		got[p.StreamID]++
+	}
+
+	var lc = func(emergency bool) *dmr.LC {
+		return &dmr.LC{
+			CallType:       dmr.CallTypeGroup,
+			Opcode:         dmr.GroupVoiceChannelUser,
+			ServiceOptions: dmr.ServiceOptions{Emergency: emergency},
+			DstID:          204,
+			SrcID:          2042214,
+		}
+	}
+	var header = func(streamID uint32, lc *dmr.LC) *dmr.Packet {
+		data, err := dmr.BuildFullLC(lc, dmr.VoiceLCHeaderMask)
+		if err != nil {
+			t.Fatalf("encode lc failed: %v", err)
+		}
+		var info = make([]byte, dmr.InfoBits)
+		if err := bptc.Encode(data, info); err != nil {
+			t.Fatalf("encode bptc failed: %v", err)
+		}
+		var p = &dmr.Packet{StreamID: streamID, DataType: dmr.VoiceLC}
+		p.SetInfoBits(info)
+		return p
+	}
+	var superframe = func(streamID uint32, lc *dmr.LC) []*dmr.Packet {
+		fragments, err := dmr.BuildEmbeddedLCFragments(lc)
+		if err != nil {
+			t.Fatalf("encode embedded lc failed: %v", err)
+		}
+		var (
+			lcss    = []uint8{dmr.FirstFragment, dmr.Continuation, dmr.Continuation, dmr.LastFragment}
+			packets = []*dmr.Packet{{StreamID: streamID, DataType: dmr.VoiceBurstA}}
+		)
+		for i, dt := range []uint8{dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE} {
+			emb, err := dmr.BuildEMB(&dmr.EMB{ColorCode: 1, LCSS: lcss[i]})
+			if err != nil {
+				t.Fatalf("encode emb failed: %v", err)
+			}
+			sync, err := dmr.BuildSyncBitsFromEMB(emb, fragments[i])
+			if err != nil {
+				t.Fatalf("encode sync failed: %v", err)
+			}
+			var p = &dmr.Packet{StreamID: streamID, DataType: dt}
+			p.SetSyncBits(sync)
+			packets = append(packets, p)
+		}
+		return packets
+	}
+
+	var packets []*dmr.Packet
+	// Stream 1 signals emergency in the header and in every superframe
+	packets = append(packets, header(1, lc(true)))
+	packets = append(packets, superframe(1, lc(true))...)
+	packets = append(packets, superframe(1, lc(false))...)
+	packets = append(packets, superframe(1, lc(true))...)
+	// Stream 2 only signals emergency in the embedded LC
+	packets = append(packets, header(2, lc(false)))
+	packets = append(packets, superframe(2, lc(true))...)
+	// Stream 3 is a normal call
+	packets = append(packets, header(3, lc(false)))
+	packets = append(packets, superframe(3, lc(false))...)
+
+	var peer = &Peer{ID: 2043044}
+	for _, p := range packets {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+
+	switch {
+	case len(got) != 2 || got[1] != 1 || got[2] != 1:
+		t.Fatalf("expected one emergency for streams 1 and 2, got %v", got)
+	case !h.Emergency(1) || !h.Emergency(2) || h.Emergency(3):
+		t.Fatal("emergency state of active streams wrong")
+	}
+}
@@ -0,0 +1,93 @@
+package homebrew
+
+import "github.com/pd0mz/go-dmr"
+
+// Frame types, as stored in the flags byte of a DMRD packet.
+const (
+	FrameTypeVoice uint8 = iota
+	FrameTypeVoiceSync
+	FrameTypeDataSync
+	FrameTypeUnused
+)
+
+// FrameTypeName is a map of frame type to string.
+var FrameTypeName = map[uint8]string{
+	FrameTypeVoice:     "voice",
+	FrameTypeVoiceSync: "voice sync",
+	FrameTypeDataSync:  "data sync",
+	FrameTypeUnused:    "unused",
+}
+
+// Flags is the flags byte of a DMRD packet, it packs the timeslot, call
+// type, frame type and data type (or voice sequence).
+type Flags uint8
+
+// Timeslot returns 0 for slot 1, 1 for slot 2.
+func (f Flags) Timeslot() uint8 { return uint8(f) & 0x01 }
+
+// CallType returns the call type, see dmr.CallTypeGroup and dmr.CallTypePrivate.
+func (f Flags) CallType() uint8 {
+	// 0 for group call, 1 for unit to unit
+	if uint8(f)&0x02 > 0 {
+		return dmr.CallTypePrivate
+	}
+	return dmr.CallTypeGroup
+}
+
+// FrameType returns the frame type.
+func (f Flags) FrameType() uint8 { return (uint8(f) >> 2) & 0x03 }
+
+// DataType returns the data type for data sync frames, or the voice sequence
+// (0 for burst A up to 5 for burst F) for voice frames.
+func (f Flags) DataType() uint8 { return (uint8(f) >> 4) & 0x0f }
+
+// SetTimeslot updates the timeslot, 0 for slot 1, 1 for slot 2.
+func (f *Flags) SetTimeslot(ts uint8) {
+	*f = Flags((uint8(*f) &^ 0x01) | (ts & 0x01))
+}
+
+// SetCallType updates the call type.
+func (f *Flags) SetCallType(ct uint8) {
+	var v uint8
+	if ct == dmr.CallTypePrivate {
+		v = 0x02
+	}
+	*f = Flags((uint8(*f) &^ 0x02) | v)
+}
+
+// SetFrameType updates the frame type.
+func (f *Flags) SetFrameType(ft uint8) {
+	*f = Flags((uint8(*f) &^ 0x0c) | (ft&0x03)<<2)
+}
+
+// SetDataType updates the data type or voice sequence.
+func (f *Flags) SetDataType(dt uint8) {
+	*f = Flags((uint8(*f) &^ 0xf0) | (dt&0x0f)<<4)
+}
+
+// NewFrame returns a DMRD frame of a group call on timeslot 1 of the stream,
+// with the signature and IDs filled in and an all zero payload. Use Flags to
+// change byte 15 of the frame, or dmr.NewPacket and BuildData to build it
+// from a packet.
+func NewFrame(src, dst, repeater, streamID uint32) []byte {
+	return BuildData(dmr.NewPacket(src, dst, repeater, streamID), repeater)
+}
+
+// PacketFlags returns the flags for a DMR packet.
+func PacketFlags(p *dmr.Packet) Flags {
+	var f Flags
+	f.SetTimeslot(p.Timeslot)
+	f.SetCallType(p.CallType)
+	switch p.DataType {
+	case dmr.VoiceBurstA:
+		f.SetFrameType(FrameTypeVoiceSync)
+		f.SetDataType(0)
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		f.SetFrameType(FrameTypeVoice)
+		f.SetDataType(p.DataType - dmr.VoiceBurstA)
+	default:
+		f.SetFrameType(FrameTypeDataSync)
+		f.SetDataType(p.DataType)
+	}
+	return f
+}
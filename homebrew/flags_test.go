@@ -0,0 +1,140 @@
+package homebrew
+
+import (
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestFlags(t *testing.T) {
+	for ts := uint8(0); ts < 2; ts++ {
+		for _, ct := range []uint8{dmr.CallTypeGroup, dmr.CallTypePrivate} {
+			for ft := FrameTypeVoice; ft <= FrameTypeUnused; ft++ {
+				for dt := uint8(0); dt < 16; dt++ {
+					var f Flags
+					f.SetTimeslot(ts)
+					f.SetCallType(ct)
+					f.SetFrameType(ft)
+					f.SetDataType(dt)
+
+					switch {
+					case f.Timeslot() != ts:
+						t.Fatalf("flags %#02x: timeslot %d != %d", f, f.Timeslot(), ts)
+					case f.CallType() != ct:
+						t.Fatalf("flags %#02x: call type %d != %d", f, f.CallType(), ct)
+					case f.FrameType() != ft:
+						t.Fatalf("flags %#02x: frame type %d != %d", f, f.FrameType(), ft)
+					case f.DataType() != dt:
+						t.Fatalf("flags %#02x: data type %d != %d", f, f.DataType(), dt)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestData(t *testing.T) {
+	for dataType := dmr.PrivacyIndicator; dataType <= dmr.VoiceBurstF; dataType++ {
+		want := &dmr.Packet{
+			Timeslot:   1,
+			Sequence:   0x2a,
+			SrcID:      2042214,
+			DstID:      2043044,
+			RepeaterID: 204342201,
+			StreamID:   0x1a2b3c4d,
+			DataType:   dataType,
+			CallType:   dmr.CallTypePrivate,
+			Data:       make([]byte, 33),
+		}
+
+		test, err := ParseData(BuildData(want, want.RepeaterID))
+		if err != nil {
+			t.Fatalf("decode %s failed: %v", dmr.DataTypeName[dataType], err)
+		}
+		switch {
+		case test.Timeslot != want.Timeslot:
+			t.Fatalf("decode %s failed: timeslot wrong", dmr.DataTypeName[dataType])
+		case test.Sequence != want.Sequence:
+			t.Fatalf("decode %s failed: sequence wrong", dmr.DataTypeName[dataType])
+		case test.SrcID != want.SrcID || test.DstID != want.DstID:
+			t.Fatalf("decode %s failed: ID wrong", dmr.DataTypeName[dataType])
+		case test.RepeaterID != want.RepeaterID:
+			t.Fatalf("decode %s failed: repeater ID wrong", dmr.DataTypeName[dataType])
+		case test.StreamID != want.StreamID:
+			t.Fatalf("decode %s failed: stream ID wrong", dmr.DataTypeName[dataType])
+		case test.DataType != want.DataType:
+			t.Fatalf("decode %s failed: data type %s", dmr.DataTypeName[dataType], dmr.DataTypeName[test.DataType])
+		case test.CallType != want.CallType:
+			t.Fatalf("decode %s failed: call type wrong", dmr.DataTypeName[dataType])
+		}
+	}
+}
+
+func TestDataMeta(t *testing.T) {
+	var want = &dmr.Packet{
+		SrcID:    2042214,
+		DstID:    204,
+		StreamID: 0x1a2b3c4d,
+		DataType: dmr.VoiceBurstC,
+		CallType: dmr.CallTypeGroup,
+		Data:     make([]byte, 33),
+	}
+	var data = BuildData(want, 2042214)
+	if len(data) != DataSize {
+		t.Fatalf("expected %d bytes without signal report, got %d", DataSize, len(data))
+	}
+	test, err := ParseData(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if test.HasMeta {
+		t.Fatal("decode failed: signal report without trailing bytes")
+	}
+
+	want.BER, want.RSSI, want.HasMeta = 3, 87, true
+	if data = BuildData(want, 2042214); len(data) != DataMetaSize {
+		t.Fatalf("expected %d bytes with signal report, got %d", DataMetaSize, len(data))
+	}
+	if test, err = ParseData(data); err != nil {
+		t.Fatalf("decode with signal report failed: %v", err)
+	}
+	switch {
+	case !test.HasMeta || test.BER != 3 || test.RSSI != 87:
+		t.Fatalf("decode failed: expected BER 3 and RSSI 87, got %+v", test)
+	case test.StreamID != want.StreamID || len(test.Data) != 33:
+		t.Fatalf("decode failed: unexpected packet %+v", test)
+	}
+
+	// Trailing bytes that aren't a signal report are invalid
+	for _, size := range []int{DataSize + 1, DataMetaSize + 1, DataMetaSize + 8} {
+		var garbage = make([]byte, size)
+		copy(garbage, data)
+		if _, err := ParseData(garbage); err == nil {
+			t.Fatalf("decode of %d bytes succeeded", size)
+		}
+	}
+}
+
+func TestNewFrame(t *testing.T) {
+	var frame = NewFrame(2042214, 204, 2042214, 0x1a2b3c4d)
+	switch {
+	case len(frame) != DataSize:
+		t.Fatalf("expected %d bytes, got %d", DataSize, len(frame))
+	case string(frame[:4]) != string(DMRData):
+		t.Fatalf("expected signature %q, got %q", DMRData, frame[:4])
+	}
+
+	var flags = Flags(frame[15])
+	flags.SetTimeslot(1)
+	flags.SetFrameType(FrameTypeVoiceSync)
+	frame[15] = uint8(flags)
+	p, err := ParseData(frame)
+	switch {
+	case err != nil:
+		t.Fatalf("parse failed: %v", err)
+	case p.SrcID != 2042214 || p.DstID != 204 || p.RepeaterID != 2042214 || p.StreamID != 0x1a2b3c4d:
+		t.Fatalf("unexpected packet %s", p)
+	case p.CallType != dmr.CallTypeGroup || p.Timeslot != 1 || p.DataType != dmr.VoiceBurstA:
+		t.Fatalf("unexpected flags of packet %s", p)
+	}
+}
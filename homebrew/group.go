@@ -0,0 +1,272 @@
+package homebrew
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// DefaultOriginTimeout is the default time without frames after which a
+// bridge forgets the origin of a stream, see Group.StreamTimeout. It is well
+// above the round trip time of a stream relayed back by another master.
+const DefaultOriginTimeout = time.Second * 2
+
+// GroupPacketFunc is called with every packet received by a link in a Group,
+// name is the name the link was added with.
+type GroupPacketFunc func(name string, link *Homebrew, p *dmr.Packet) error
+
+// Group runs several links in one process, for example to bridge a
+// Brandmeister master and a local XLX or HBlink master. Every link has its
+// own socket, created by New with port 0 for an ephemeral port, and its own
+// login state. Packets received by any link are passed to the PacketFunc of
+// the group, tagged with the name of the link.
+//
+// Packets can be forwarded to other links with Send or Forward, the
+// receiving link logs them with its own repeater ID while the stream ID is
+// kept, so streams can be followed across links. Forward remembers the link
+// a stream was received from and never sends it back to that link, also not
+// when another master relays it back.
+type Group struct {
+	// StreamTimeout is the time without frames after which the origin of a
+	// stream is forgotten, the origin is also kept this long after the
+	// terminator to catch late relayed copies. Zero or less uses
+	// DefaultOriginTimeout.
+	StreamTimeout time.Duration
+
+	mutex   *sync.Mutex
+	links   map[string]*Homebrew
+	acls    map[string]*dmr.ACL
+	pf      GroupPacketFunc
+	streams map[uint32]*groupStream
+}
+
+type groupStream struct {
+	origin string
+	timer  *time.Timer
+}
+
+// NewGroup returns an empty link group.
+func NewGroup() *Group {
+	return &Group{
+		StreamTimeout: DefaultOriginTimeout,
+		mutex:         &sync.Mutex{},
+		links:         make(map[string]*Homebrew),
+		acls:          make(map[string]*dmr.ACL),
+		streams:       make(map[uint32]*groupStream),
+	}
+}
+
+// Add adds a link to the group, it replaces the PacketFunc of the link.
+func (g *Group) Add(name string, link *Homebrew) error {
+	if link == nil {
+		return errors.New("homebrew: link can't be nil")
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.links[name]; ok {
+		return fmt.Errorf("homebrew: link %q already in group", name)
+	}
+	g.links[name] = link
+	link.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		g.mutex.Lock()
+		var pf = g.pf
+		g.mutex.Unlock()
+
+		if pf == nil {
+			return nil
+		}
+		return pf(name, link, p)
+	})
+	return nil
+}
+
+// Remove removes a link from the group, the link is not closed.
+func (g *Group) Remove(name string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.links, name)
+	delete(g.acls, name)
+}
+
+// SetACL sets the ACL deciding which packets Forward sends to the named link,
+// a nil acl allows all packets.
+func (g *Group) SetACL(name string, acl *dmr.ACL) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.links[name]; !ok {
+		return fmt.Errorf("homebrew: link %q not in group", name)
+	}
+	if acl == nil {
+		delete(g.acls, name)
+	} else {
+		g.acls[name] = acl
+	}
+	return nil
+}
+
+// Link returns the link with the name, or nil.
+func (g *Group) Link(name string) *Homebrew {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.links[name]
+}
+
+// Names returns the sorted names of the links.
+func (g *Group) Names() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var names = make([]string, 0, len(g.links))
+	for name := range g.links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type groupLink struct {
+	name string
+	link *Homebrew
+	acl  *dmr.ACL
+}
+
+// snapshot returns the links sorted by name, taken under the lock so links
+// removed in the mean time are still valid.
+func (g *Group) snapshot() []groupLink {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var links = make([]groupLink, 0, len(g.links))
+	for name, link := range g.links {
+		links = append(links, groupLink{name, link, g.acls[name]})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].name < links[j].name })
+	return links
+}
+
+// SetPacketFunc sets the function receiving the packets of all links.
+func (g *Group) SetPacketFunc(f GroupPacketFunc) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.pf = f
+}
+
+// Send sends a packet on the named link.
+func (g *Group) Send(name string, p *dmr.Packet) error {
+	var link = g.Link(name)
+	if link == nil {
+		return fmt.Errorf("homebrew: link %q not in group", name)
+	}
+	return link.Send(p)
+}
+
+// Forward sends a packet received on the link named from on all other links
+// that their ACL allows. Packets of a stream that was first received on
+// another link are relayed copies and are dropped. A failing link doesn't
+// stop the others, the first error is returned.
+func (g *Group) Forward(from string, p *dmr.Packet) error {
+	if !g.track(from, p) {
+		return nil
+	}
+	return g.forward(from, p)
+}
+
+// forward sends a packet on all links but the one named from.
+func (g *Group) forward(from string, p *dmr.Packet) error {
+	var first error
+	for _, l := range g.snapshot() {
+		if l.name == from || (l.acl != nil && !l.acl.Check(p)) {
+			continue
+		}
+		if err := l.link.Send(p); err != nil && first == nil {
+			first = fmt.Errorf("homebrew: forward to %q failed: %v", l.name, err)
+		}
+	}
+	return first
+}
+
+// track records the link a stream was received from, it returns whether the
+// packet was received from the origin of the stream. The origin is forgotten
+// once no frames were seen for StreamTimeout, the terminator doesn't end it
+// right away as relayed copies may still follow.
+func (g *Group) track(name string, p *dmr.Packet) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var timeout = g.StreamTimeout
+	if timeout <= 0 {
+		timeout = DefaultOriginTimeout
+	}
+
+	var streamID = p.StreamID
+	s, ok := g.streams[streamID]
+	if !ok {
+		s = &groupStream{origin: name}
+		g.streams[streamID] = s
+		s.timer = time.AfterFunc(timeout, func() {
+			g.mutex.Lock()
+			defer g.mutex.Unlock()
+			if g.streams[streamID] == s {
+				delete(g.streams, streamID)
+			}
+		})
+	} else {
+		s.timer.Reset(timeout)
+	}
+	return s.origin == name
+}
+
+// origin returns the name of the link a stream was received from, or "".
+func (g *Group) origin(streamID uint32) string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if s, ok := g.streams[streamID]; ok {
+		return s.origin
+	}
+	return ""
+}
+
+// ListenAndServe serves all links until they are all closed, it returns the
+// first error of any link.
+func (g *Group) ListenAndServe() error {
+	var (
+		links = g.snapshot()
+		errs  = make(chan error, len(links))
+	)
+	for _, l := range links {
+		go func(l groupLink) {
+			if err := l.link.ListenAndServe(); err != nil {
+				errs <- fmt.Errorf("homebrew: link %q: %v", l.name, err)
+				return
+			}
+			errs <- nil
+		}(l)
+	}
+
+	var first error
+	for range links {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes all links.
+func (g *Group) Close() error {
+	var first error
+	for _, l := range g.snapshot() {
+		if err := l.link.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,202 @@
+package homebrew
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// TestGroupBridge bridges two fake masters, as a bridge between Brandmeister
+// and a local XLX master would.
+func TestGroupBridge(t *testing.T) {
+	type received struct {
+		RepeaterID uint32
+		Packet     *dmr.Packet
+	}
+	var (
+		masters    = map[string]*Master{}
+		registered = make(chan uint32, 2)
+		packets    = map[string]chan received{}
+		g          = NewGroup()
+	)
+	for name, id := range map[string]uint32{"bm": 2042214, "xlx": 2042215} {
+		var (
+			m  = testMaster(t)
+			ch = make(chan received, 1)
+		)
+		defer m.Close()
+		m.OnRegister = func(id uint32, _ *RepeaterConfiguration) { registered <- id }
+		m.OnPacket = func(id uint32, p *dmr.Packet) { ch <- received{id, p} }
+		m.AddRepeater(id, []byte("s3cr3t"))
+		go m.ListenAndServe()
+		masters[name], packets[name] = m, ch
+
+		link, err := New(&RepeaterConfiguration{
+			Callsign:  "PD0MZ",
+			ID:        id,
+			ColorCode: 1,
+		}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("new failed: %v", err)
+		}
+		if err := g.Add(name, link); err != nil {
+			t.Fatalf("add %s failed: %v", name, err)
+		}
+	}
+	defer g.Close()
+	if err := g.Add("bm", g.Link("bm")); err == nil {
+		t.Fatal("add of duplicate link succeeded")
+	}
+
+	g.SetPacketFunc(func(name string, _ *Homebrew, p *dmr.Packet) error {
+		return g.Forward(name, p)
+	})
+	go g.ListenAndServe()
+
+	for _, name := range g.Names() {
+		link := g.Link(name)
+		if err := link.Link(&Peer{ID: 1, Addr: masters[name].Addr(), AuthKey: []byte("s3cr3t")}); err != nil {
+			t.Fatalf("link %s failed: %v", name, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-registered:
+		case <-time.After(time.Second):
+			t.Fatal("links did not log in")
+		}
+	}
+
+	for _, test := range []struct {
+		From, To string
+		FromID   uint32
+		ToID     uint32
+	}{
+		{"bm", "xlx", 2042214, 2042215},
+		{"xlx", "bm", 2042215, 2042214},
+	} {
+		var p = &dmr.Packet{
+			SrcID:    2043044,
+			DstID:    204,
+			StreamID: 0xcafe + test.FromID,
+			Data:     bytes.Repeat([]byte{0xa5}, 33),
+		}
+		if err := masters[test.From].SendTo(test.FromID, p); err != nil {
+			t.Fatalf("send to %s failed: %v", test.From, err)
+		}
+		select {
+		case got := <-packets[test.To]:
+			switch {
+			case got.RepeaterID != test.ToID:
+				t.Fatalf("%s: expected repeater %d, got %d", test.To, test.ToID, got.RepeaterID)
+			case got.Packet.StreamID != p.StreamID || got.Packet.SrcID != p.SrcID || !bytes.Equal(got.Packet.Data, p.Data):
+				t.Fatalf("%s: unexpected packet %+v", test.To, got.Packet)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("packet from %s not forwarded to %s", test.From, test.To)
+		}
+		select {
+		case got := <-packets[test.From]:
+			t.Fatalf("packet echoed to %s: %+v", test.From, got.Packet)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+}
+
+// TestGroupForwardError checks that a failing link doesn't stop the packet
+// from reaching the other links.
+func TestGroupForwardError(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	var g = NewGroup()
+	for _, name := range []string{"a", "b", "c"} {
+		var link = testHomebrew(t)
+		link.Peer[name] = &Peer{ID: 1, Addr: listener.LocalAddr().(*net.UDPAddr)}
+		if err := g.Add(name, link); err != nil {
+			t.Fatalf("add %s failed: %v", name, err)
+		}
+	}
+	defer g.Close()
+	g.Link("b").Close()
+
+	if err := g.Forward("a", &dmr.Packet{SrcID: 2042214, DstID: 204, Data: make([]byte, 33)}); err == nil {
+		t.Fatal("forward to closed link succeeded")
+	}
+
+	var data = make([]byte, 512)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFromUDP(data)
+	if err != nil {
+		t.Fatalf("link c did not receive the packet: %v", err)
+	}
+	if !bytes.HasPrefix(data[:n], DMRData) {
+		t.Fatalf("expected DMR data, got %q", data[:n])
+	}
+}
+
+// TestGroupForwardLoop checks that a stream relayed back by another link is
+// not forwarded again, and that ACLs are applied.
+func TestGroupForwardLoop(t *testing.T) {
+	var (
+		g         = NewGroup()
+		listeners = map[string]*net.UDPConn{}
+		acl       = dmr.NewACL(true)
+	)
+	acl.Deny(0, 91)
+	for _, name := range []string{"a", "b"} {
+		listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer listener.Close()
+		listeners[name] = listener
+
+		var link = testHomebrew(t)
+		link.Peer[name] = &Peer{ID: 1, Addr: listener.LocalAddr().(*net.UDPAddr), Status: AuthDone}
+		if err := g.Add(name, link); err != nil {
+			t.Fatalf("add %s failed: %v", name, err)
+		}
+	}
+	defer g.Close()
+	if err := g.SetACL("b", acl); err != nil {
+		t.Fatalf("set acl failed: %v", err)
+	}
+	if err := g.SetACL("c", acl); err == nil {
+		t.Fatal("set acl of unknown link succeeded")
+	}
+
+	// received returns whether the named link sent a packet
+	var received = func(name string) bool {
+		var data = make([]byte, 512)
+		listeners[name].SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+		_, err := listeners[name].Read(data)
+		return err == nil
+	}
+
+	for _, test := range []struct {
+		Name   string
+		From   string
+		Packet *dmr.Packet
+		A, B   bool
+	}{
+		{"forward", "a", &dmr.Packet{StreamID: 1, DstID: 204, Data: make([]byte, 33)}, false, true},
+		{"relayed", "b", &dmr.Packet{StreamID: 1, DstID: 204, Data: make([]byte, 33)}, false, false},
+		{"terminator", "a", &dmr.Packet{StreamID: 1, DstID: 204, DataType: dmr.TerminatorWithLC, Data: make([]byte, 33)}, false, true},
+		{"relayed terminator", "b", &dmr.Packet{StreamID: 1, DstID: 204, DataType: dmr.TerminatorWithLC, Data: make([]byte, 33)}, false, false},
+		{"acl", "a", &dmr.Packet{StreamID: 2, DstID: 91, Data: make([]byte, 33)}, false, false},
+	} {
+		if err := g.Forward(test.From, test.Packet); err != nil {
+			t.Fatalf("%s: forward failed: %v", test.Name, err)
+		}
+		if a, b := received("a"), received("b"); a != test.A || b != test.B {
+			t.Fatalf("%s: expected sent to a %t, b %t, got a %t, b %t", test.Name, test.A, test.B, a, b)
+		}
+	}
+}
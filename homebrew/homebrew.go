@@ -3,23 +3,23 @@ package homebrew
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
-	"encoding/binary"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/op/go-logging"
 	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
 )
 
-var log = logging.MustGetLogger("dmr/homebrew")
-
 type AuthStatus uint8
 
 func (a *AuthStatus) String() string {
@@ -51,66 +51,267 @@ var (
 	MasterACK       = []byte("MSTACK")
 	RepeaterLogin   = []byte("RPTL")
 	RepeaterKey     = []byte("RPTK")
+	RepeaterConfig  = []byte("RPTC")
 	MasterPing      = []byte("MSTPING")
 	RepeaterPong    = []byte("RPTPONG")
 	MasterClosing   = []byte("MSTCL")
 	RepeaterClosing = []byte("RPTCL")
+	RepeaterOptions = []byte("RPTO") // Options, as used by FreeDMR and Brandmeister
+)
+
+// Messages of the dialect spoken by MMDVMHost and Brandmeister, where the
+// repeater pings the master.
+var (
+	RepeaterACK    = []byte("RPTACK")
+	RepeaterPing   = []byte("RPTPING")
+	MasterPong     = []byte("MSTPONG")
+	RepeaterBeacon = []byte("RPTSBKN")
 )
 
-// We ping the peers every minute
+// We ping the peers every minute.
 var (
-	AuthTimeout  = time.Second * 5
 	PingInterval = time.Second * 5
 	PingTimeout  = time.Second * 15
 	SendInterval = time.Millisecond * 30
 )
 
+// DefaultStreamTimeout is the default time without frames after which a stream is considered ended.
+const DefaultStreamTimeout = time.Millisecond * 180
+
+// Default time to wait for the answer to our login and key response, see
+// Homebrew.LoginTimeout, and default login retries, see
+// Homebrew.LoginRetryInterval.
+const (
+	DefaultLoginTimeout       = time.Second * 30
+	DefaultKeyTimeout         = time.Second * 10
+	DefaultLoginRetryInterval = time.Second * 2
+	DefaultLoginRetries       = 10
+)
+
+// DefaultResolveTimeout is the default time a lookup of a peer Host may take,
+// see Homebrew.ResolveTimeout.
+const DefaultResolveTimeout = time.Second * 5
+
+// DefaultQueueSize is the default number of received frames queued for the PacketFunc.
+const DefaultQueueSize = 64
+
 // Homebrew is implements the Homebrew IPSC DMR Air Interface protocol
 type Homebrew struct {
 	Config *RepeaterConfiguration
 	Peer   map[string]*Peer
 	PeerID map[uint32]*Peer
 
-	pf     dmr.PacketFunc
-	conn   *net.UDPConn
-	closed bool
-	id     []byte
-	last   time.Time   // Record last received frame time
-	mutex  *sync.Mutex // Mutex for manipulating peer list or send queue
-	rxtx   *sync.Mutex // Mutex for when receiving data or sending data
-	stop   chan bool
-	queue  []*dmr.Packet
+	// StreamTimeout is the time without frames after which a stream is
+	// considered ended, as the protocol has no explicit end of stream.
+	StreamTimeout time.Duration
+	// QueueSize is the number of received frames ListenAndServe queues for
+	// the PacketFunc. Frames received while the queue is full are dropped and
+	// counted, so a slow PacketFunc doesn't block reading from the socket.
+	QueueSize int
+	// Options are sent to outgoing peers after the configuration, masters
+	// such as FreeDMR use them to set up static talkgroups, for example
+	// "TS2_1=91;TS2_2=2621". Use SetOptions to change them while linked.
+	Options string
+	// AcceptFunc decides which received frames are passed on, before they
+	// are queued, so unwanted traffic is dropped early. Private calls to our
+	// own ID are always accepted. If nil all frames are accepted.
+	AcceptFunc func(p *dmr.Packet) bool
+	// ControlFunc is called with the control messages of linked peers, such
+	// as a master refusing a transmission on a busy talkgroup (TGBusy) or
+	// requesting a beacon (Beacon). Messages with an unknown opcode are
+	// passed as Unknown.
+	ControlFunc func(peer *Peer, event ControlEvent)
+	// OnStreamEnd is called when a stream ended.
+	OnStreamEnd func(streamID uint32)
+	// OnLink is called when an outgoing peer acknowledged our configuration,
+	// after every (re)login.
+	OnLink func(peer *Peer)
+	// OnIDConflict is called when an outgoing peer refused our login or
+	// configuration because another repeater is linked with our ID, see
+	// NAKReasonIDConflict. The login is not retried on the same master.
+	OnIDConflict func(peer *Peer)
+	// OnEmergency is called once per stream, with the first packet of which
+	// the Link Control has the emergency service option set.
+	OnEmergency func(p *dmr.Packet, lc *dmr.LC)
+	// OnSlotChange is called when a timeslot becomes busy or idle, see
+	// Slot.
+	OnSlotChange func(slot *Slot, busy bool)
+	// OnCallStart is called when a call on a timeslot started, as soon as
+	// its Link Control is known. That is with the voice LC header, or with
+	// the first embedded LC of the voice bursts if the header was missed,
+	// the call is then flagged LateEntry.
+	OnCallStart func(slot *Slot, call ReceivedCall)
+	// OnSlotContention is called with frames received on a timeslot that
+	// already receives another stream. The frames are passed on, but don't
+	// change the stream of the slot.
+	OnSlotContention func(p *dmr.Packet, streamID uint32)
+	// OnReverseChannel is called with the reverse channel commands received
+	// on a timeslot, such as a request to the transmitting radio to cease its
+	// transmission for preemption, see dmr.ParseReverseChannel.
+	OnReverseChannel func(slot *Slot, p *dmr.Packet, command uint8)
+	// MaxBER is the highest estimated bit error rate of received bursts, as
+	// a fraction, see dmr.BurstQuality. Worse bursts and bursts with bits
+	// that can't be corrected are dropped before OnEmergency, the middleware
+	// and the PacketFunc, but still count for the call received on the slot.
+	// If zero all bursts are passed on.
+	MaxBER float64
+	// VoiceCodec decodes the AMBE+2 frames of received voice bursts to PCM
+	// audio in Packet.PCM, before they are passed to the PacketFunc. If nil
+	// voice bursts are passed on as is.
+	VoiceCodec dmr.VoiceCodec
+
+	// AllowPortMismatch accepts packets from a peer IP address on any port,
+	// for peers behind NAT that send from another port than they are linked
+	// on. By default packets are only accepted from the exact peer address.
+	AllowPortMismatch bool
+
+	// Resolver resolves the Host of peers, if nil net.DefaultResolver is used,
+	// preferring IPv6 addresses if the link listens dual stack. A Resolver
+	// has to bound the time of its lookups itself.
+	Resolver func(network, address string) (*net.UDPAddr, error)
+	// ResolveInterval is the interval at which the Host of linked peers is
+	// resolved again, the link is re-established if the address changed. The
+	// Host is always resolved before a login attempt. Zero disables the timer.
+	// Peers are resolved by Link and the keepalive loop, never while
+	// handling received packets.
+	ResolveInterval time.Duration
+	// ResolveTimeout bounds the lookups of the default resolver, zero or less
+	// uses DefaultResolveTimeout.
+	ResolveTimeout time.Duration
+	// FailoverDelay is the time to wait before logging in to the next of the
+	// Hosts of a peer, after a refused login or a dropped link. Zero logs in
+	// right away.
+	FailoverDelay time.Duration
+	// LoginTimeout is the time to wait for an outgoing peer to answer our
+	// login, KeyTimeout the time to wait for it to accept our key response.
+	// The login failed after that, it is retried unless the peer has
+	// UnlinkOnAuthFailure set, then the peer is unlinked. Zero or less uses
+	// DefaultLoginTimeout and DefaultKeyTimeout.
+	LoginTimeout time.Duration
+	KeyTimeout   time.Duration
+	// LoginRetryInterval is the interval at which our login is sent again
+	// while an outgoing peer doesn't answer it, at most LoginRetries times
+	// within the LoginTimeout, so a lost datagram doesn't stall the login.
+	// The interval grows by the LoginRetryBackoff factor after every retry,
+	// 1 or less keeps it fixed. The retries are counted in PeerStats.
+	LoginRetryInterval time.Duration
+	LoginRetries       int
+	LoginRetryBackoff  float64
+	// NATKeepalive is the interval at which an empty datagram is sent to
+	// outgoing peers we're not logged in to, which keeps the mapping of a
+	// NAT such as CGNAT open while waiting for the login or a retry. Masters
+	// ignore the datagram, logged in peers are kept open by the pings. Zero
+	// disables it.
+	NATKeepalive time.Duration
+
+	// ReadBufferSize and WriteBufferSize set the socket buffer sizes when
+	// ListenAndServe starts, zero keeps the operating system default. A
+	// hotspot is fine with the default, a link carrying the traffic of a
+	// busy master should use 1 MiB or more to ride out scheduling delays.
+	// On Linux the sizes are capped by net.core.rmem_max and wmem_max.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// DSCP sets the Differentiated Services Code Point of sent packets when
+	// ListenAndServe starts, for QoS on the path to the master. Voice is
+	// usually marked 46 (EF), 34 (AF41) suits networks that reserve EF for
+	// telephony. Zero keeps the default best effort marking.
+	DSCP uint8
+
+	// Logger receives the log messages, if nil slog.Default() is used.
+	Logger *slog.Logger
+
+	network    string // Address family of the socket and of resolved peers
+	stats      *Stats // Allocated separately to keep the 64-bit counters aligned
+	pf         dmr.PacketFunc
+	tap        TapFunc
+	middleware []dmr.PacketMiddleware
+	conn       *net.UDPConn
+	closed     uint32 // Set atomically by Close
+	id         []byte
+	last       time.Time   // Record last received frame time
+	mutex      *sync.Mutex // Mutex for manipulating peer list or send queue
+	rxtx       *sync.Mutex // Mutex for when receiving data or sending data
+	stop       chan bool
+	wake       chan struct{} // Runs the keepalive loop right away
+	queue      []*dmr.Packet
+	rx         chan receivedPacket // Received frames, nil if not serving
+
+	streams     map[streamKey]*time.Timer // Active streams
+	streamMutex *sync.Mutex               // Mutex for manipulating active streams
+	emergency   *emergencyTracker
+	slots       [2]*Slot
 }
 
 // New creates a new Homebrew repeater
 func New(config *RepeaterConfiguration, addr *net.UDPAddr) (*Homebrew, error) {
+	return NewNetwork("udp", config, addr)
+}
+
+// NewNetwork creates a new Homebrew repeater listening on the network, which
+// is "udp", "udp4" or "udp6". Peer hosts are resolved in the same network, so
+// "udp6" links to IPv6 only masters.
+func NewNetwork(network string, config *RepeaterConfiguration, addr *net.UDPAddr) (*Homebrew, error) {
 	var err error
 
+	switch network {
+	case "udp", "udp4", "udp6":
+		break
+	default:
+		return nil, fmt.Errorf("homebrew: unsupported network %q", network)
+	}
 	if config == nil {
 		return nil, errors.New("homebrew: RepeaterConfiguration can't be nil")
 	}
 	if addr == nil {
 		return nil, errors.New("homebrew: addr can't be nil")
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	h := &Homebrew{
-		Config: config,
-		Peer:   make(map[string]*Peer),
-		PeerID: make(map[uint32]*Peer),
-		id:     packRepeaterID(config.ID),
-		mutex:  &sync.Mutex{},
-		rxtx:   &sync.Mutex{},
-		queue:  make([]*dmr.Packet, 0),
-	}
-	if h.conn, err = net.ListenUDP("udp", addr); err != nil {
+		Config:        config,
+		Peer:          make(map[string]*Peer),
+		PeerID:        make(map[uint32]*Peer),
+		StreamTimeout: DefaultStreamTimeout,
+		QueueSize:     DefaultQueueSize,
+		LoginTimeout:  DefaultLoginTimeout,
+		KeyTimeout:    DefaultKeyTimeout,
+		network:       network,
+		stats:         &Stats{},
+		id:            packRepeaterID(config.ID),
+		mutex:         &sync.Mutex{},
+		rxtx:          &sync.Mutex{},
+		wake:          make(chan struct{}, 1),
+		queue:         make([]*dmr.Packet, 0),
+		streams:       make(map[streamKey]*time.Timer),
+		streamMutex:   &sync.Mutex{},
+		emergency:     newEmergencyTracker(),
+
+		LoginRetryInterval: DefaultLoginRetryInterval,
+		LoginRetries:       DefaultLoginRetries,
+		ResolveTimeout:     DefaultResolveTimeout,
+	}
+	for i := range h.slots {
+		h.slots[i] = newSlot(h, i+1)
+	}
+	if h.conn, err = net.ListenUDP(network, addr); err != nil {
 		return nil, errors.New("homebrew: " + err.Error())
 	}
 
 	return h, nil
 }
 
+// logger returns the configured logger, or the default logger.
+func (h *Homebrew) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
+
 func (h *Homebrew) Active() bool {
-	return !h.closed && h.conn != nil
+	return atomic.LoadUint32(&h.closed) == 0 && h.conn != nil
 }
 
 // Close stops the active listeners
@@ -122,12 +323,12 @@ func (h *Homebrew) Close() error {
 		return nil
 	}
 
-	log.Info("closing")
+	h.logger().Info("closing")
 
 	// Tell peers we're closing
 closing:
 	for _, peer := range h.Peer {
-		if peer.Status == AuthDone {
+		if peer.status() == AuthDone {
 			if err := h.WriteToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
 				break closing
 			}
@@ -140,35 +341,77 @@ closing:
 		h.stop = nil
 	}
 
+	// Stop stream timers
+	h.streamMutex.Lock()
+	for key, timer := range h.streams {
+		timer.Stop()
+		delete(h.streams, key)
+		h.emergency.end(key.streamID)
+	}
+	h.streamMutex.Unlock()
+	for _, slot := range h.slots {
+		slot.reset()
+	}
+
 	// Kill listening socket
-	h.closed = true
+	atomic.StoreUint32(&h.closed, 1)
 	return h.conn.Close()
 }
 
+// Addr returns the local address of the socket.
+func (h *Homebrew) Addr() *net.UDPAddr {
+	return h.conn.LocalAddr().(*net.UDPAddr)
+}
+
 // Link establishes a new link with a peer
 func (h *Homebrew) Link(peer *Peer) error {
 	if peer == nil {
 		return errors.New("homebrew: peer can't be nil")
 	}
-	if peer.Addr == nil {
-		return errors.New("homebrew: peer Addr can't be nil")
+	if len(peer.AuthKey) == 0 && (!peer.NoAuth || peer.Incoming) {
+		return errors.New("homebrew: peer AuthKey can't be empty")
 	}
-	if peer.AuthKey == nil || len(peer.AuthKey) == 0 {
-		return errors.New("homebrew: peer AuthKey can't be nil")
+	var (
+		addr     = peer.addr()
+		index    int
+		resolved time.Time
+		err      error
+	)
+	if len(peer.Hosts) > 0 {
+		// Link on the first host that resolves
+		for index = range peer.Hosts {
+			if addr, err = h.resolve(peer.Hosts[index]); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+		resolved = time.Now()
+	} else if peer.Host != "" {
+		if addr, err = h.resolve(peer.Host); err != nil {
+			return err
+		}
+		resolved = time.Now()
+	}
+	if addr == nil {
+		return errors.New("homebrew: peer Addr can't be nil")
 	}
-
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
 	// Reset state
+	peer.mutex.Lock()
+	peer.Addr, peer.hostIndex, peer.resolved, peer.retry = addr, index, resolved, time.Time{}
 	peer.Last.PacketSent = time.Time{}
 	peer.Last.PacketReceived = time.Time{}
 	peer.Last.PingSent = time.Time{}
 	peer.Last.PongReceived = time.Time{}
+	peer.mutex.Unlock()
 
 	// Register our peer
 	peer.id = packRepeaterID(peer.ID)
-	h.Peer[peer.Addr.String()] = peer
+	h.Peer[addr.String()] = peer
 	h.PeerID[peer.ID] = peer
 
 	return h.handleAuth(peer)
@@ -189,26 +432,77 @@ func (h *Homebrew) Unlink(id uint32) error {
 }
 
 func (h *Homebrew) ListenAndServe() error {
-	var data = make([]byte, 53)
+	// Large enough for any packet, longer DMR data is rejected by ParseData
+	var data = make([]byte, 512)
 
-	h.stop = make(chan bool)
-	go h.keepalive(h.stop)
+	if err := h.setSocketOptions(); err != nil {
+		return err
+	}
 
-	h.closed = false
-	for !h.closed {
+	var stop = make(chan bool)
+	h.mutex.Lock()
+	h.stop = stop
+	h.mutex.Unlock()
+	go h.keepalive(stop)
+
+	var size = h.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	var rx = make(chan receivedPacket, size)
+	h.rx = rx
+	go h.receive(rx)
+	defer func() {
+		h.rx = nil
+		close(rx)
+	}()
+
+	atomic.StoreUint32(&h.closed, 0)
+	for atomic.LoadUint32(&h.closed) == 0 {
 		n, peer, err := h.conn.ReadFromUDP(data)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
 			return err
 		}
+		atomic.AddUint64(&h.stats.BytesReceived, uint64(n))
+		if h.tap != nil {
+			h.tap(Received, peer, data[:n])
+		}
 		if err := h.handle(peer, data[:n]); err != nil {
-			if h.closed && strings.HasSuffix(err.Error(), "use of closed network connection") {
+			if errors.Is(err, net.ErrClosed) {
 				break
 			}
-			return err
+			// A bad packet or a failing PacketFunc must not stop the listener
+			h.logger().Warn("packet handling failed", "addr", peer, "error", err)
 		}
 	}
 
-	log.Info("listener closed")
+	h.logger().Info("listener closed")
+	return nil
+}
+
+// setSocketOptions applies the buffer sizes and DSCP to the socket.
+func (h *Homebrew) setSocketOptions() error {
+	if h.ReadBufferSize > 0 {
+		if err := h.conn.SetReadBuffer(h.ReadBufferSize); err != nil {
+			return fmt.Errorf("homebrew: set read buffer failed: %v", err)
+		}
+	}
+	if h.WriteBufferSize > 0 {
+		if err := h.conn.SetWriteBuffer(h.WriteBufferSize); err != nil {
+			return fmt.Errorf("homebrew: set write buffer failed: %v", err)
+		}
+	}
+	if h.DSCP > 0 {
+		if h.DSCP > 63 {
+			return fmt.Errorf("homebrew: DSCP %d out of range 0-63", h.DSCP)
+		}
+		if err := setDSCP(h.conn, h.DSCP); err != nil {
+			return fmt.Errorf("homebrew: set DSCP failed: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -235,6 +529,50 @@ func (h *Homebrew) SetPacketFunc(f dmr.PacketFunc) {
 	h.pf = f
 }
 
+// SetOptions changes the Options and sends them to the linked outgoing peers.
+func (h *Homebrew) SetOptions(options string) error {
+	h.mutex.Lock()
+	h.Options = options
+	h.mutex.Unlock()
+
+	for _, peer := range h.getPeers() {
+		peer.mutex.Lock()
+		var linked = !peer.Incoming && peer.Status == AuthDone && peer.linked
+		peer.mutex.Unlock()
+		if !linked {
+			continue
+		}
+		if err := h.sendOptions(peer, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Homebrew) sendOptions(peer *Peer, options string) error {
+	peer.mutex.Lock()
+	peer.optionsSent = true
+	peer.mutex.Unlock()
+	return h.WriteToPeer(append(append(RepeaterOptions, h.id...), options...), peer)
+}
+
+// SetTap sets the function that is called with every datagram sent and
+// received, for example to capture traffic with a PcapWriter. A nil f
+// removes the tap.
+func (h *Homebrew) SetTap(f TapFunc) {
+	h.tap = f
+}
+
+// Use adds middleware that is executed in registration order for each
+// received packet, before it is passed to the PacketFunc.
+func (h *Homebrew) Use(mw ...dmr.PacketMiddleware) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// Copy, so handlePacket can use the old slice without locking
+	h.middleware = append(append([]dmr.PacketMiddleware{}, h.middleware...), mw...)
+}
+
 func (h *Homebrew) WritePacketToPeer(p *dmr.Packet, peer *Peer) error {
 	return h.WriteToPeer(h.parsePacket(p), peer)
 }
@@ -244,9 +582,32 @@ func (h *Homebrew) WriteToPeer(b []byte, peer *Peer) error {
 		return errors.New("homebrew: can't write to nil peer")
 	}
 
-	peer.Last.PacketSent = time.Now()
-	_, err := h.conn.WriteTo(b, peer.Addr)
-	return err
+	return h.writeTo(b, peer.sent(time.Now()))
+}
+
+// writeTo sends the datagram to the address and counts it.
+func (h *Homebrew) writeTo(b []byte, addr *net.UDPAddr) error {
+	n, err := h.conn.WriteTo(b, addr)
+	if err != nil {
+		return err
+	}
+	if h.tap != nil {
+		h.tap(Sent, addr, b)
+	}
+
+	atomic.AddUint64(&h.stats.BytesSent, uint64(n))
+	switch {
+	case bytes.HasPrefix(b, DMRData):
+		atomic.AddUint64(&h.stats.FramesSent, 1)
+		break
+	case bytes.HasPrefix(b, MasterPing):
+		atomic.AddUint64(&h.stats.KeepalivesSent, 1)
+		break
+	case bytes.HasPrefix(b, RepeaterLogin):
+		atomic.AddUint64(&h.stats.LoginAttempts, 1)
+		break
+	}
+	return nil
 }
 
 func (h *Homebrew) WriteToPeerWithID(b []byte, id uint32) error {
@@ -279,6 +640,41 @@ func (h *Homebrew) getPeerByAddr(addr *net.UDPAddr) *Peer {
 	return nil
 }
 
+// getPeerByIP returns a peer with the IP address on any port, if there is
+// exactly one.
+func (h *Homebrew) getPeerByIP(ip net.IP) *Peer {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var found *Peer
+	for _, peer := range h.Peer {
+		if peer.Addr.IP.Equal(ip) {
+			if found != nil {
+				return nil
+			}
+			found = peer
+		}
+	}
+	return found
+}
+
+// idConflict returns the linked incoming peer of which the datagram, from
+// another address, is a login with the ID, or nil.
+func (h *Homebrew) idConflict(data []byte) *Peer {
+	kind, payload, _ := ClassifyPacket(data)
+	if kind != PacketTypeRepeaterLogin || len(payload) != 8 {
+		return nil
+	}
+	id, err := strconv.ParseUint(string(payload), 16, 32)
+	if err != nil {
+		return nil
+	}
+	if peer := h.getPeer(uint32(id)); peer != nil && peer.Incoming && peer.status() == AuthDone {
+		return peer
+	}
+	return nil
+}
+
 func (h *Homebrew) getPeers() []*Peer {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -293,41 +689,57 @@ func (h *Homebrew) getPeers() []*Peer {
 
 func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 	peer := h.getPeerByAddr(remote)
+	if peer == nil && h.AllowPortMismatch {
+		peer = h.getPeerByIP(remote.IP)
+	}
 	if peer == nil {
-		log.Debugf("ignored packet from unknown peer %s\n", remote)
+		atomic.AddUint64(&h.stats.PacketsDropped, 1)
+		if conflict := h.idConflict(data); conflict != nil {
+			h.logger().Warn("peer login from another address refused; ID already linked", "peer", conflict.ID, "addr", remote, "linked_addr", conflict.addr())
+			return h.writeTo(append(append(MasterNAK, h.id...), byte(NAKReasonIDConflict)), remote)
+		}
+		h.logger().Debug("dropped packet from unknown peer", "addr", remote)
 		return nil
 	}
 
-	// Ignore packet that are clearly invalid, this is the minimum packet length for any Homebrew protocol frame
-	if len(data) < 14 {
+	// Ignore packet that are clearly invalid, this is the minimum packet length for any Homebrew protocol frame (RPTL)
+	if len(data) < 12 {
 		return nil
 	}
+	// Unknown packets are handled as unexpected packets below
+	kind, payload, _ := ClassifyPacket(data)
 
-	if peer.Status != AuthDone {
+	var status = peer.status()
+	if status != AuthDone {
 		// Ignore DMR data at this stage
-		if bytes.Equal(data[:4], DMRData) {
+		if kind == PacketTypeDMRData {
 			return nil
 		}
 
 		if peer.Incoming {
-			switch peer.Status {
+			switch status {
 			case AuthNone:
 				switch {
-				case bytes.Equal(data[:4], RepeaterLogin):
-					if !peer.CheckRepeaterID(data[4:]) {
-						log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:]))
+				case kind == PacketTypeRepeaterLogin:
+					if !peer.CheckRepeaterID(payload) {
+						h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload))
+						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
+					}
+					if len(peer.AuthKey) == 0 {
+						// Incoming peers always authenticate, see Peer.NoAuth
+						h.logger().Error("peer has no auth key, login refused", "peer", peer.ID, "addr", remote)
 						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
 					}
 
 					// Peer is verified, generate a nonce
 					nonce := make([]byte, 4)
 					if _, err := rand.Read(nonce); err != nil {
-						log.Errorf("peer %d@%s nonce generation failed: %v\n", peer.ID, remote, err)
+						h.logger().Error("peer nonce generation failed", "peer", peer.ID, "addr", remote, "error", err)
 						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
 					}
 
 					peer.UpdateToken(nonce)
-					peer.Status = AuthBegin
+					peer.setStatus(AuthBegin)
 					return h.WriteToPeer(append(append(MasterACK, h.id...), nonce...), peer)
 
 				default:
@@ -341,75 +753,71 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 
 			case AuthBegin:
 				switch {
-				case bytes.Equal(data[:4], RepeaterKey):
-					if !peer.CheckRepeaterID(data[4:]) {
-						log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[4:]))
+				case kind == PacketTypeRepeaterKey:
+					if len(payload) != 72 {
+						peer.setStatus(AuthNone)
 						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
 					}
-					if len(data) != 76 {
-						peer.Status = AuthNone
+					if !peer.CheckRepeaterID(payload[:8]) {
+						h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload[:8]))
 						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
 					}
-					if !bytes.Equal(data[12:], peer.Token) {
-						log.Errorf("peer %d@%s sent invalid key challenge token\n", peer.ID, remote)
-						peer.Status = AuthNone
+					if subtle.ConstantTimeCompare(payload[8:], peer.token()) != 1 {
+						h.logger().Error("peer sent invalid key challenge token", "peer", peer.ID, "addr", remote)
+						peer.setStatus(AuthNone)
 						return h.WriteToPeer(append(MasterNAK, h.id...), peer)
 					}
 
+					h.logger().Info("peer logged in", "peer", peer.ID, "addr", remote)
+					peer.mutex.Lock()
 					peer.Last.PingSent = time.Now()
 					peer.Last.PongReceived = time.Now()
 					peer.Status = AuthDone
+					peer.mutex.Unlock()
 					return h.WriteToPeer(append(MasterACK, h.id...), peer)
 				}
 			}
 		} else {
 			// Verify we have a matching peer ID
-			if !h.checkRepeaterID(data[6:14]) {
-				log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
+			if len(payload) < 8 || !h.checkRepeaterID(payload[:8]) {
+				h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload))
 				return nil
 			}
 
-			switch peer.Status {
+			switch status {
 			case AuthNone:
 				switch {
-				case bytes.Equal(data[:6], MasterACK):
-					log.Debugf("peer %d@%s sent nonce\n", peer.ID, remote)
-					peer.Status = AuthBegin
-					peer.UpdateToken(data[14:])
+				case kind == PacketTypeMasterACK && len(payload) == 8:
+					// Masters with authentication disabled accept the
+					// login without a nonce, skip the key exchange
+					h.logger().Info("peer accepted login without key exchange", "peer", peer.ID, "addr", remote)
+					return h.sendConfig(peer, remote)
+
+				case kind == PacketTypeMasterACK:
+					h.logger().Debug("peer sent nonce", "peer", peer.ID, "addr", remote)
+					peer.setStatus(AuthBegin)
+					peer.UpdateToken(payload[8:])
 					return h.handleAuth(peer)
 
-				case bytes.Equal(data[:6], MasterNAK):
-					log.Errorf("peer %d@%s refused login\n", peer.ID, remote)
-					peer.Status = AuthFailed
-					if peer.UnlinkOnAuthFailure {
-						h.Unlink(peer.ID)
-					}
-					break
+				case kind == PacketTypeMasterNAK:
+					return h.refused(peer, remote, payload)
 
 				default:
-					log.Warningf("peer %d@%s sent unexpected login reply (ignored)\n", peer.ID, remote)
+					h.logger().Warn("peer sent unexpected login reply (ignored)", "peer", peer.ID, "addr", remote)
 					break
 				}
 
 			case AuthBegin:
 				switch {
-				case bytes.Equal(data[:6], MasterACK):
-					log.Infof("peer %d@%s accepted login\n", peer.ID, remote)
-					peer.Status = AuthDone
-					peer.Last.PingSent = time.Now()
-					peer.Last.PongReceived = time.Now()
-					return h.WriteToPeer(h.Config.Bytes(), peer)
+				case kind == PacketTypeMasterACK:
+					h.logger().Info("peer accepted login", "peer", peer.ID, "addr", remote)
+					return h.sendConfig(peer, remote)
 
-				case bytes.Equal(data[:6], MasterNAK):
-					log.Errorf("peer %d@%s refused login\n", peer.ID, remote)
-					peer.Status = AuthFailed
-					if peer.UnlinkOnAuthFailure {
-						h.Unlink(peer.ID)
-					}
-					break
+				case kind == PacketTypeMasterNAK:
+					return h.refused(peer, remote, payload)
 
 				default:
-					log.Warningf("peer %d@%s sent unexpected login reply (ignored)\n", peer.ID, remote)
+					h.logger().Warn("peer sent unexpected login reply (ignored)", "peer", peer.ID, "addr", remote)
 					break
 				}
 			}
@@ -418,71 +826,133 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 		// Authentication is done
 		if peer.Incoming {
 			switch {
-			case bytes.Equal(data[:4], DMRData):
+			case kind == PacketTypeDMRData:
 				p, err := h.parseData(data)
 				if err != nil {
 					return err
 				}
-				return h.handlePacket(p, peer)
+				return h.enqueue(p, peer)
 
-			case bytes.Equal(data[:6], MasterACK):
+			case kind == PacketTypeMasterACK:
 				break
 
-			case len(data) == 15 && bytes.Equal(data[:7], MasterPing):
-				return h.WriteToPeer(append(RepeaterPong, data[7:]...), peer)
+			case kind == PacketTypeMasterPing && len(payload) == 8:
+				return h.WriteToPeer(append(RepeaterPong, payload...), peer)
+
+			case kind == PacketTypeUnknown:
+				h.control(peer, parseUnknown(data))
+				break
 
 			default:
-				log.Warningf("peer %d@%s sent unexpected packet (status=%s):\n", peer.ID, remote, peer.Status.String())
-				log.Debug(hex.Dump(data))
+				h.logger().Warn("peer sent unexpected packet", "peer", peer.ID, "addr", remote, "status", status.String())
+				h.logger().Debug("unexpected packet dump", "peer", peer.ID, "data", hex.EncodeToString(data))
 				break
 			}
 		} else {
 			switch {
-			case bytes.Equal(data[:4], DMRData):
+			case kind == PacketTypeDMRData:
 				p, err := h.parseData(data)
 				if err != nil {
 					return err
 				}
-				return h.handlePacket(p, peer)
+				return h.enqueue(p, peer)
 
-			case bytes.Equal(data[:6], MasterACK):
-				if !h.checkRepeaterID(data[6:]) {
-					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
+			case kind == PacketTypeMasterACK:
+				if !h.checkRepeaterID(payload) {
+					h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload))
+					return nil
+				}
+				peer.mutex.Lock()
+				var (
+					optionsSent = peer.optionsSent
+					linked      = peer.linked
+				)
+				if optionsSent {
+					peer.optionsSent = false
+				} else {
+					peer.Last.PingSent = time.Now()
+					peer.linked = true
+				}
+				peer.mutex.Unlock()
+				if optionsSent {
+					h.logger().Info("peer accepted options", "peer", peer.ID, "addr", remote)
 					return nil
 				}
-				peer.Last.PingSent = time.Now()
-				return h.WriteToPeer(append(MasterPing, h.id...), peer)
+				if err := h.WriteToPeer(append(MasterPing, h.id...), peer); err != nil {
+					return err
+				}
+				if !linked {
+					// The first ACK after login acknowledges our configuration
+					h.mutex.Lock()
+					var options = h.Options
+					h.mutex.Unlock()
+					if options != "" {
+						if err := h.sendOptions(peer, options); err != nil {
+							return err
+						}
+					}
+					if h.OnLink != nil {
+						h.OnLink(peer)
+					}
+				}
+				return nil
 
-			case bytes.Equal(data[:6], MasterNAK):
-				if !h.checkRepeaterID(data[6:]) {
-					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
+			case kind == PacketTypeMasterNAK:
+				if busy, ok := h.parseTGBusy(payload); ok {
+					h.control(peer, busy)
+					return nil
+				}
+				peer.mutex.Lock()
+				var linked = peer.linked
+				peer.mutex.Unlock()
+				if !linked && h.parseNAKReason(payload) == NAKReasonIDConflict {
+					// The configuration was refused
+					return h.refused(peer, remote, payload)
+				}
+				if !h.checkRepeaterID(payload) {
+					h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload))
+					return nil
+				}
+				peer.mutex.Lock()
+				var optionsSent = peer.optionsSent
+				peer.optionsSent = false
+				peer.mutex.Unlock()
+				if optionsSent {
+					// The link stays up with the options the master had
+					h.logger().Error("peer refused options", "peer", peer.ID, "addr", remote)
 					return nil
 				}
 
-				log.Errorf("peer %d@%s deauthenticated us; re-authenticating\n", peer.ID, remote)
-				peer.Status = AuthNone
-				return h.handleAuth(peer)
+				h.logger().Error("peer deauthenticated us; re-authenticating", "peer", peer.ID, "addr", remote)
+				peer.setStatus(AuthNone)
+				return h.relogin(peer)
 
-			case len(data) == 15 && bytes.Equal(data[:7], RepeaterPong):
-				if !h.checkRepeaterID(data[7:]) {
-					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
+			case kind == PacketTypeRepeaterPong && len(payload) == 8:
+				if !h.checkRepeaterID(payload) {
+					h.logger().Warn("peer sent invalid repeater ID (ignored)", "peer", peer.ID, "addr", remote, "id", string(payload))
 					return nil
 				}
+				h.logger().Debug("peer sent pong", "peer", peer.ID, "addr", remote)
+				peer.mutex.Lock()
 				peer.Last.PongReceived = time.Now()
+				peer.rtt = peer.Last.PongReceived.Sub(peer.Last.PingSent)
+				var rtt = peer.rtt
+				peer.mutex.Unlock()
+				atomic.AddUint64(&h.stats.KeepalivesAcked, 1)
+				atomic.StoreInt64((*int64)(&h.stats.KeepaliveRTT), int64(rtt))
 				break
 
-			case len(data) == 10 && bytes.Equal(data[:6], MasterNAK):
-				if !h.checkRepeaterID(data[6:]) {
-					log.Warningf("peer %d@%s sent invalid repeater ID %q (ignored)\n", peer.ID, remote, string(data[6:14]))
-					return nil
-				}
-				log.Errorf("peer %d@%s sent NAK; re-establishing link\n", peer.ID, remote)
-				peer.Status = AuthNone
-				return h.handleAuth(peer)
+			case kind == PacketTypeRepeaterBeacon:
+				h.control(peer, Beacon{})
+				break
+
+			case kind == PacketTypeUnknown:
+				h.control(peer, parseUnknown(data))
+				break
 
 			default:
-				log.Warningf("peer %d@%s sent unexpected packet (status=%s):\n", peer.ID, remote, peer.Status.String())
-				log.Debug(hex.Dump(data))
+				h.logger().Warn("peer sent unexpected packet", "peer", peer.ID, "addr", remote, "status", status.String())
+				h.logger().Debug("unexpected packet dump", "peer", peer.ID, "data", hex.EncodeToString(data))
 				break
 			}
 		}
@@ -491,102 +961,589 @@ func (h *Homebrew) handle(remote *net.UDPAddr, data []byte) error {
 	return nil
 }
 
+// refused handles an outgoing peer refusing our login or configuration.
+func (h *Homebrew) refused(peer *Peer, remote *net.UDPAddr, payload []byte) error {
+	var reason = h.parseNAKReason(payload)
+	h.logger().Error("peer refused login", "peer", peer.ID, "addr", remote, "reason", reason.String())
+	atomic.AddUint64(&h.stats.LoginFailures, 1)
+	peer.setStatus(AuthFailed)
+	if reason == NAKReasonIDConflict && h.OnIDConflict != nil {
+		h.OnIDConflict(peer)
+	}
+	if peer.UnlinkOnAuthFailure {
+		h.Unlink(peer.ID)
+	} else if peer.hasNextHost() {
+		return h.failover(peer)
+	}
+	return nil
+}
+
 func (h *Homebrew) handleAuth(peer *Peer) error {
 	if !peer.Incoming {
-		switch peer.Status {
+		switch peer.status() {
 		case AuthNone:
 			// Send login packet
+			var now = time.Now()
+			peer.mutex.Lock()
+			peer.linked = false
+			peer.loginSent, peer.loginRetries = now, 0
+			peer.loginRetryAt = now.Add(h.LoginRetryInterval)
+			peer.mutex.Unlock()
 			return h.WriteToPeer(append(RepeaterLogin, h.id...), peer)
 
 		case AuthBegin:
 			// Send repeater key exchange packet
-			return h.WriteToPeer(append(append(RepeaterKey, h.id...), peer.Token...), peer)
+			peer.mutex.Lock()
+			peer.loginSent = time.Now()
+			peer.mutex.Unlock()
+			return h.WriteToPeer(append(append(RepeaterKey, h.id...), peer.token()...), peer)
 		}
 	}
 	return nil
 }
 
+// retryLogin sends our login again, if a retry of the login the peer didn't
+// answer is due.
+func (h *Homebrew) retryLogin(peer *Peer, now time.Time) error {
+	peer.mutex.Lock()
+	if h.LoginRetryInterval <= 0 || peer.loginRetries >= h.LoginRetries || now.Before(peer.loginRetryAt) {
+		peer.mutex.Unlock()
+		return nil
+	}
+	peer.loginRetries++
+	var interval = h.LoginRetryInterval
+	for i := 0; i < peer.loginRetries && h.LoginRetryBackoff > 1; i++ {
+		interval = time.Duration(float64(interval) * h.LoginRetryBackoff)
+	}
+	peer.loginRetryAt = now.Add(interval)
+	var retries = peer.loginRetries
+	peer.mutex.Unlock()
+
+	h.logger().Debug("peer not answering login; sending it again", "peer", peer.ID, "retry", retries)
+	return h.WriteToPeer(append(RepeaterLogin, h.id...), peer)
+}
+
+// natKeepalive sends an empty datagram to the peer we're logging in to, if
+// nothing was sent to it for the NATKeepalive interval.
+func (h *Homebrew) natKeepalive(peer *Peer, now time.Time) error {
+	peer.mutex.Lock()
+	var due = h.NATKeepalive > 0 && (peer.Status == AuthNone || peer.Status == AuthBegin) &&
+		now.Sub(peer.Last.PacketSent) > h.NATKeepalive
+	peer.mutex.Unlock()
+	if !due {
+		return nil
+	}
+	return h.WriteToPeer([]byte{}, peer)
+}
+
+// sendConfig sends our configuration after the peer accepted the login.
+func (h *Homebrew) sendConfig(peer *Peer, remote *net.UDPAddr) error {
+	if err := h.Config.Validate(); err != nil {
+		h.logger().Error("peer can't be sent our configuration", "peer", peer.ID, "addr", remote, "error", err)
+		peer.setStatus(AuthFailed)
+		return err
+	}
+	peer.mutex.Lock()
+	peer.Status = AuthDone
+	peer.Last.PingSent = time.Now()
+	peer.Last.PongReceived = time.Now()
+	peer.mutex.Unlock()
+	return h.WriteToPeer(h.Config.Bytes(), peer)
+}
+
+// relogin starts a login. A peer with a Host is resolved again first, that is
+// left to the keepalive loop so a slow lookup doesn't stall the read loop.
+func (h *Homebrew) relogin(peer *Peer) error {
+	if peer.activeHost() != "" {
+		peer.mutex.Lock()
+		peer.retry = time.Now()
+		peer.mutex.Unlock()
+		select {
+		case h.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	return h.handleAuth(peer)
+}
+
+// resolveAndLogin resolves the Host of the peer again, if set, and starts a
+// login. If resolving fails, the last known address is used.
+func (h *Homebrew) resolveAndLogin(peer *Peer) error {
+	if host := peer.activeHost(); host != "" {
+		if _, err := h.resolvePeer(peer); err != nil {
+			h.logger().Error("peer resolve failed; using last address", "peer", peer.ID, "host", host, "addr", peer.addr(), "error", err)
+		}
+	}
+	return h.handleAuth(peer)
+}
+
+// failover moves the peer to the next of its Hosts, if any, and logs in
+// again. The login on another host waits for the FailoverDelay.
+func (h *Homebrew) failover(peer *Peer) error {
+	peer.setStatus(AuthNone)
+	if !peer.hasNextHost() {
+		return h.relogin(peer)
+	}
+
+	peer.nextHost()
+	h.logger().Warn("failing over to next master", "peer", peer.ID, "host", peer.activeHost())
+	if h.FailoverDelay > 0 {
+		// The keepalive loop logs in once the delay passed
+		peer.mutex.Lock()
+		peer.retry = time.Now().Add(h.FailoverDelay)
+		peer.mutex.Unlock()
+		return nil
+	}
+	return h.relogin(peer)
+}
+
+// ActiveMaster returns the host, or the address if the peer has no Host, that
+// the peer with the ID is linked on.
+func (h *Homebrew) ActiveMaster(id uint32) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	peer, ok := h.PeerID[id]
+	if !ok {
+		return ""
+	}
+	if host := peer.activeHost(); host != "" {
+		return host
+	}
+	if addr := peer.addr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+func (h *Homebrew) resolve(host string) (*net.UDPAddr, error) {
+	var (
+		addr *net.UDPAddr
+		err  error
+	)
+	if h.Resolver != nil {
+		addr, err = h.Resolver(h.network, host)
+	} else {
+		var timeout = h.ResolveTimeout
+		if timeout <= 0 {
+			timeout = DefaultResolveTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		addr, err = resolveUDPAddr(ctx, h.network, host, h.dualStack())
+		cancel()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("homebrew: resolve %q failed: %v", host, err)
+	}
+	return addr, nil
+}
+
+// dualStack returns true if the socket can send to IPv6 addresses.
+func (h *Homebrew) dualStack() bool {
+	addr, ok := h.conn.LocalAddr().(*net.UDPAddr)
+	return ok && addr.IP.To4() == nil
+}
+
+// resolveUDPAddr resolves address like net.ResolveUDPAddr using the context,
+// but if ipv6 is set it prefers the IPv6 address of hosts in the "udp"
+// network that have both.
+func resolveUDPAddr(ctx context.Context, network, address string, ipv6 bool) (*net.UDPAddr, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.DefaultResolver.LookupPort(ctx, network, service)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return &net.UDPAddr{Port: port}, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *net.IPAddr
+	for i := range ips {
+		var v4 = ips[i].IP.To4() != nil
+		if (network == "udp4" && !v4) || (network == "udp6" && v4) {
+			continue
+		}
+		if found == nil {
+			found = &ips[i]
+		}
+		// In the "udp" network look for an address of the preferred family
+		if network != "udp" || v4 != ipv6 {
+			found = &ips[i]
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no suitable address found for %q in network %s", host, network)
+	}
+	return &net.UDPAddr{IP: found.IP, Port: port, Zone: found.Zone}, nil
+}
+
+// resolvePeer resolves the Host of the peer and moves the peer to the new
+// address, it returns true if the address changed.
+func (h *Homebrew) resolvePeer(peer *Peer) (bool, error) {
+	addr, err := h.resolve(peer.activeHost())
+	if err != nil {
+		return false, err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	peer.mutex.Lock()
+	var old = peer.Addr
+	peer.Addr, peer.resolved = addr, time.Now()
+	peer.mutex.Unlock()
+	if old != nil && old.String() == addr.String() {
+		return false, nil
+	}
+	if old != nil && h.Peer[old.String()] == peer {
+		delete(h.Peer, old.String())
+	}
+	if _, ok := h.PeerID[peer.ID]; ok {
+		h.Peer[addr.String()] = peer
+	}
+	return true, nil
+}
+
+type receivedPacket struct {
+	packet *dmr.Packet
+	peer   *Peer
+}
+
+// enqueue queues a received frame for the PacketFunc, or drops it if the
+// queue is full. Without queue the frame is handled right away.
+func (h *Homebrew) enqueue(p *dmr.Packet, peer *Peer) error {
+	if h.AcceptFunc != nil {
+		if !h.accept(p) {
+			atomic.AddUint64(&h.stats.FramesFiltered, 1)
+			return nil
+		}
+		atomic.AddUint64(&h.stats.FramesAccepted, 1)
+	}
+	if h.rx == nil {
+		return h.handlePacket(p, peer)
+	}
+	select {
+	case h.rx <- receivedPacket{p, peer}:
+		return nil
+	default:
+		atomic.AddUint64(&h.stats.FramesDropped, 1)
+		h.logger().Debug("receive queue full; frame dropped", "peer", peer.ID, "stream", p.StreamID)
+		return nil
+	}
+}
+
+func (h *Homebrew) accept(p *dmr.Packet) bool {
+	if p.CallType == dmr.CallTypePrivate && p.DstID == h.Config.ID {
+		return true
+	}
+	return h.AcceptFunc(p)
+}
+
+// receive passes queued frames to the PacketFunc until the queue is closed.
+func (h *Homebrew) receive(rx <-chan receivedPacket) {
+	for r := range rx {
+		if err := h.handlePacket(r.packet, r.peer); err != nil {
+			h.logger().Warn("packet handling failed", "peer", r.peer.ID, "stream", r.packet.StreamID, "error", err)
+		}
+	}
+}
+
 func (h *Homebrew) handlePacket(p *dmr.Packet, peer *Peer) error {
 	h.rxtx.Lock()
 	defer h.rxtx.Unlock()
 
 	// Record last received time
 	h.last = time.Now()
+	h.trackStream(p.StreamID, p.Timeslot)
+	atomic.AddUint64(&h.stats.FramesReceived, 1)
+	p.Quality = measureQuality(p)
+
+	if slot := h.slots[p.Timeslot&0x01]; !slot.receive(p, h.last) {
+		active, _ := slot.Stream()
+		atomic.AddUint64(&h.stats.SlotContentions, 1)
+		h.logger().Debug("slot contention", "slot", slot.Number(), "stream", p.StreamID, "active", active)
+		if h.OnSlotContention != nil {
+			h.OnSlotContention(p, active)
+		}
+	}
+
+	if h.MaxBER > 0 && (p.Quality.Uncorrectable || p.Quality.BER() > h.MaxBER) {
+		atomic.AddUint64(&h.stats.FramesPoor, 1)
+		h.logger().Debug("poor frame dropped", "stream", p.StreamID, "ber", p.Quality.BER(), "uncorrectable", p.Quality.Uncorrectable)
+		return nil
+	}
+
+	if h.OnEmergency != nil {
+		if lc := h.emergency.add(p); lc != nil {
+			h.logger().Warn("emergency call", "stream", p.StreamID, "src", p.SrcID, "dst", p.DstID)
+			h.OnEmergency(p, lc)
+		}
+	}
 
 	// Offload packet to handle callback
+	var pf = h.pf
 	if peer.PacketReceived != nil {
-		return peer.PacketReceived(h, p)
+		pf = peer.PacketReceived
 	}
-	if h.pf == nil {
+	if pf == nil {
 		return errors.New("homebrew: no PacketReceived func defined to handle DMR packet")
 	}
 
-	return h.pf(h, p)
+	h.mutex.Lock()
+	var mw = h.middleware
+	h.mutex.Unlock()
+
+	// The middleware and the PacketFunc get their own copy, so the slots
+	// and trackers are not affected by changes to the packet
+	var err error
+	dmr.RunMiddleware(mw, p.Clone(), func(p *dmr.Packet) {
+		if h.VoiceCodec != nil {
+			h.decodeVoice(p)
+		}
+		err = pf(h, p)
+	})
+	return err
+}
+
+// measureQuality measures the FEC quality of the burst, including the BPTC of
+// the info bits of data sync bursts other than rate ¾ data and the
+// Reed-Solomon code of the full LC of voice LC headers and terminators.
+func measureQuality(p *dmr.Packet) *dmr.BurstQuality {
+	var q = dmr.MeasureBurstQuality(p)
+	if len(p.Bits) < dmr.PayloadBits || p.FrameType() != dmr.FrameTypeDataSync || p.DataType > dmr.Idle {
+		return q
+	}
+	if p.DataType != dmr.Rate34Data {
+		var data = make([]byte, dmr.InfoSize)
+		n, err := bptc.DecodeCorrected(p.InfoBits(), data)
+		q.AddInfo(n, err)
+		switch {
+		case err != nil:
+			break
+		case p.DataType == dmr.VoiceLC:
+			q.AddFullLC(data, dmr.VoiceLCHeaderMask)
+			break
+		case p.DataType == dmr.TerminatorWithLC:
+			q.AddFullLC(data, dmr.TerminatorWithLCMask)
+			break
+		}
+	}
+	return q
+}
+
+// decodeVoice decodes the PCM audio of a voice burst, the burst is passed on
+// without audio if decoding fails.
+func (h *Homebrew) decodeVoice(p *dmr.Packet) {
+	if p.DataType < dmr.VoiceBurstA || p.DataType > dmr.VoiceBurstF {
+		return
+	}
+	pcm, err := dmr.DecodeVoiceBurst(h.VoiceCodec, p)
+	if err != nil {
+		h.logger().Warn("voice decoding failed", "stream", p.StreamID, "error", err)
+		return
+	}
+	p.PCM = pcm
+}
+
+// Emergency returns true if the active stream is an emergency call. Streams
+// are only checked if OnEmergency is set.
+func (h *Homebrew) Emergency(streamID uint32) bool {
+	return h.emergency.active(streamID)
+}
+
+// trackStream (re)starts the timeout timer of a stream on the timeslot.
+// loginTimeout returns the LoginTimeout, or the default.
+func (h *Homebrew) loginTimeout() time.Duration {
+	if h.LoginTimeout <= 0 {
+		return DefaultLoginTimeout
+	}
+	return h.LoginTimeout
+}
+
+// keyTimeout returns the KeyTimeout, or the default.
+func (h *Homebrew) keyTimeout() time.Duration {
+	if h.KeyTimeout <= 0 {
+		return DefaultKeyTimeout
+	}
+	return h.KeyTimeout
+}
+
+func (h *Homebrew) trackStream(streamID uint32, slot uint8) {
+	h.streamMutex.Lock()
+	defer h.streamMutex.Unlock()
+
+	var timeout = h.StreamTimeout
+	if timeout <= 0 {
+		timeout = DefaultStreamTimeout
+	}
+	var key = streamKey{slot, streamID}
+	if timer, ok := h.streams[key]; ok && timer.Stop() {
+		timer.Reset(timeout)
+		return
+	}
+
+	atomic.AddUint64(&h.stats.CallsObserved, 1)
+	if slot == 0 {
+		atomic.AddUint64(&h.stats.Slot1Calls, 1)
+	} else {
+		atomic.AddUint64(&h.stats.Slot2Calls, 1)
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		h.streamMutex.Lock()
+		if h.streams[key] != timer {
+			// Stream was restarted or closed
+			h.streamMutex.Unlock()
+			return
+		}
+		delete(h.streams, key)
+		h.streamMutex.Unlock()
+
+		h.slots[slot&0x01].end(streamID)
+		h.emergency.end(streamID)
+		h.logger().Debug("stream ended", "stream", streamID)
+		if h.OnStreamEnd != nil {
+			h.OnStreamEnd(streamID)
+		}
+	})
+	h.streams[key] = timer
 }
 
 func (h *Homebrew) keepalive(stop <-chan bool) {
 	for {
 		select {
+		case <-stop:
+			return
 		case <-time.After(time.Second):
-			now := time.Now()
-
-			for _, peer := range h.getPeers() {
-				// Ping protocol only applies to outgoing links, and also the auth retries
-				// are entirely up to the peer.
-				if peer.Incoming {
-					switch peer.Status {
-					case AuthDone:
-						switch {
-						case now.Sub(peer.Last.PingReceived) > PingTimeout:
-							peer.Status = AuthNone
-							log.Errorf("peer %d@%s not requesting to ping; dropping connection", peer.ID, peer.Addr)
-							if err := h.WriteToPeer(append(MasterClosing, h.id...), peer); err != nil {
-								log.Errorf("peer %d@%s close failed: %v\n", peer.ID, peer.Addr, err)
-							}
-							break
+		case <-h.wake:
+			// A peer has to log in again
+		}
+
+		now := time.Now()
+
+		for _, peer := range h.getPeers() {
+			peer.mutex.Lock()
+			var (
+				status    = peer.Status
+				last      = peer.Last
+				retry     = peer.retry
+				addr      = peer.Addr
+				loginSent = peer.loginSent
+				host      = peer.host()
+				resolved  = peer.resolved
+			)
+			peer.mutex.Unlock()
+
+			// Ping protocol only applies to outgoing links, and also the auth retries
+			// are entirely up to the peer.
+			if peer.Incoming {
+				switch status {
+				case AuthDone:
+					switch {
+					case now.Sub(last.PingReceived) > PingTimeout:
+						peer.setStatus(AuthNone)
+						h.logger().Error("peer not requesting to ping; dropping connection", "peer", peer.ID, "addr", addr)
+						if err := h.WriteToPeer(append(MasterClosing, h.id...), peer); err != nil {
+							h.logger().Error("peer close failed", "peer", peer.ID, "addr", addr, "error", err)
 						}
 						break
 					}
-				} else {
-					switch peer.Status {
-					case AuthNone, AuthBegin:
-						switch {
-						case now.Sub(peer.Last.PacketReceived) > AuthTimeout:
-							peer.Status = AuthNone
-							log.Errorf("peer %d@%s not responding to login; retrying\n", peer.ID, peer.Addr)
-							if err := h.handleAuth(peer); err != nil {
-								log.Errorf("peer %d@%s retry failed: %v\n", peer.ID, peer.Addr, err)
-							}
+					break
+				}
+			} else {
+				switch status {
+				case AuthNone, AuthBegin:
+					switch {
+					case now.Before(retry):
+						// Waiting for the failover delay
+						break
+
+					case !retry.IsZero():
+						peer.mutex.Lock()
+						peer.retry = time.Time{}
+						peer.mutex.Unlock()
+						if err := h.resolveAndLogin(peer); err != nil {
+							h.logger().Error("peer retry failed", "peer", peer.ID, "addr", addr, "error", err)
+						}
+						break
+
+					case status == AuthNone && now.Sub(loginSent) > h.loginTimeout(),
+						status == AuthBegin && now.Sub(loginSent) > h.keyTimeout():
+						h.logger().Error("peer not responding to login", "peer", peer.ID, "addr", addr, "status", status.String())
+						atomic.AddUint64(&h.stats.LoginFailures, 1)
+						peer.setStatus(AuthFailed)
+						if peer.UnlinkOnAuthFailure {
+							h.Unlink(peer.ID)
 							break
 						}
+						if err := h.failover(peer); err != nil {
+							h.logger().Error("peer retry failed", "peer", peer.ID, "addr", addr, "error", err)
+						}
+						break
 
-					case AuthDone:
-						switch {
-						case now.Sub(peer.Last.PongReceived) > PingTimeout:
-							peer.Status = AuthNone
-							log.Errorf("peer %d@%s not responding to ping; trying to re-establish connection", peer.ID, peer.Addr)
-							if err := h.WriteToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
-								log.Errorf("peer %d@%s close failed: %v\n", peer.ID, peer.Addr, err)
-							}
+					case status == AuthNone:
+						if err := h.retryLogin(peer, now); err != nil {
+							h.logger().Error("peer login retry failed", "peer", peer.ID, "addr", addr, "error", err)
+						}
+						break
+					}
+					if err := h.natKeepalive(peer, now); err != nil {
+						h.logger().Error("peer NAT keepalive failed", "peer", peer.ID, "addr", addr, "error", err)
+					}
+
+				case AuthDone:
+					switch {
+					case now.Sub(last.PongReceived) > PingTimeout:
+						peer.setStatus(AuthNone)
+						h.logger().Error("peer not responding to ping; trying to re-establish connection", "peer", peer.ID, "addr", addr)
+						if err := h.WriteToPeer(append(RepeaterClosing, h.id...), peer); err != nil {
+							h.logger().Error("peer close failed", "peer", peer.ID, "addr", addr, "error", err)
+						}
+						if err := h.failover(peer); err != nil {
+							h.logger().Error("peer retry failed", "peer", peer.ID, "addr", addr, "error", err)
+						}
+						break
+
+					case host != "" && h.ResolveInterval > 0 && now.Sub(resolved) > h.ResolveInterval:
+						changed, err := h.resolvePeer(peer)
+						if err != nil {
+							h.logger().Error("peer resolve failed", "peer", peer.ID, "host", host, "error", err)
+							break
+						}
+						if changed {
+							addr = peer.addr()
+							h.logger().Warn("peer address changed; re-establishing link", "peer", peer.ID, "host", host, "addr", addr)
+							peer.setStatus(AuthNone)
 							if err := h.handleAuth(peer); err != nil {
-								log.Errorf("peer %d@%s retry failed: %v\n", peer.ID, peer.Addr, err)
+								h.logger().Error("peer retry failed", "peer", peer.ID, "addr", addr, "error", err)
 							}
-							break
+						}
+						break
 
-						case now.Sub(peer.Last.PingSent) > PingInterval:
-							peer.Last.PingSent = now
-							if err := h.WriteToPeer(append(MasterPing, h.id...), peer); err != nil {
-								log.Errorf("peer %d@%s ping failed: %v\n", peer.ID, peer.Addr, err)
-							}
-							break
+					case now.Sub(last.PingSent) > PingInterval:
+						h.logger().Debug("sending ping to peer", "peer", peer.ID, "addr", addr)
+						peer.mutex.Lock()
+						peer.Last.PingSent = now
+						peer.mutex.Unlock()
+						if err := h.WriteToPeer(append(MasterPing, h.id...), peer); err != nil {
+							h.logger().Error("peer ping failed", "peer", peer.ID, "addr", addr, "error", err)
 						}
+						break
 					}
 				}
 			}
-
-		case <-stop:
-			return
 		}
+
 	}
 }
 
@@ -601,48 +1558,7 @@ func (h *Homebrew) parseData(data []byte) (*dmr.Packet, error) {
 
 // parsePacket converts DMR packet format to Homebrew packet format suitable for sending on the wire
 func (h *Homebrew) parsePacket(p *dmr.Packet) []byte {
-	var d = make([]byte, 53)
-
-	// Signature, 4 bytes, "DMRD"
-	copy(d[0:], DMRData)
-
-	// Seq No, 1 byte
-	d[4] = p.Sequence
-
-	// Src ID, 3 bytes
-	d[5] = uint8((p.SrcID >> 16) & 0xff)
-	d[6] = uint8((p.SrcID >> 8) & 0xff)
-	d[7] = uint8((p.SrcID & 0xff))
-
-	// Dst ID, 3 bytes
-	d[8] = uint8((p.DstID >> 16) & 0xff)
-	d[9] = uint8((p.DstID >> 8) & 0xff)
-	d[10] = uint8((p.DstID & 0xff))
-
-	// RptrID, 4 bytes
-	binary.LittleEndian.PutUint32(d[11:], p.RepeaterID)
-
-	var s byte
-	s |= (p.Timeslot & 0x01)      // Slot no, 1 bit
-	s |= (p.CallType & 0x01) << 1 // Call Type, 1 bit
-	switch p.DataType {           // Frame Type, 2 bits and Data Type or Voice Seq, 4 bits
-	case dmr.VoiceBurstA:
-		s |= 0x01 << 2 // Voice sync
-		s |= (p.DataType - dmr.VoiceBurstA) << 4
-	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
-		s |= 0x00 << 2 // Voice (no-op)
-		s |= (p.DataType - dmr.VoiceBurstA) << 4
-	default:
-		s |= 0x02 << 2 // Data
-		s |= p.DataType << 4
-	}
-
-	// StreamID, 4 bytes
-	binary.BigEndian.PutUint32(d[16:], p.StreamID)
-
-	// DMR Data, 33 bytes
-	copy(d[20:], p.Data)
-	return d
+	return BuildData(p, p.RepeaterID)
 }
 
 func (h *Homebrew) parseRepeaterID(data []byte) (uint32, error) {
@@ -660,9 +1576,20 @@ func packRepeaterID(id uint32) []byte {
 	return []byte(fmt.Sprintf("%08X", id))
 }
 
-// BuildData converts DMR packet format to Homebrew packet format.
+// Sizes of DMR data packets, MMDVM hosts append the BER and RSSI.
+const (
+	DataSize     = 53
+	DataMetaSize = 55
+)
+
+// BuildData converts DMR packet format to Homebrew packet format. The BER and
+// RSSI are only appended if the packet HasMeta.
 func BuildData(p *dmr.Packet, repeaterID uint32) []byte {
-	var data = make([]byte, 53)
+	var size = DataSize
+	if p.HasMeta {
+		size = DataMetaSize
+	}
+	var data = make([]byte, size)
 	copy(data[:4], DMRData)
 	data[4] = p.Sequence
 	data[5] = uint8(p.SrcID >> 16)
@@ -675,24 +1602,15 @@ func BuildData(p *dmr.Packet, repeaterID uint32) []byte {
 	data[12] = uint8(repeaterID >> 16)
 	data[13] = uint8(repeaterID >> 8)
 	data[14] = uint8(repeaterID)
-	data[15] = p.Timeslot | (p.CallType << 1)
+	data[15] = uint8(PacketFlags(p))
 	data[16] = uint8(p.StreamID >> 24)
 	data[17] = uint8(p.StreamID >> 16)
 	data[18] = uint8(p.StreamID >> 8)
 	data[19] = uint8(p.StreamID)
-	copy(data[20:], p.Data)
-
-	switch p.DataType {
-	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
-		data[15] |= (0x00 << 2)
-		data[15] |= (p.DataType - dmr.VoiceBurstA) << 4
-		break
-	case dmr.VoiceBurstA:
-		data[15] |= (0x01 << 2)
-		break
-	default:
-		data[15] |= (0x02 << 2)
-		data[15] |= (p.DataType) << 4
+	copy(data[20:DataSize], p.Data)
+	if p.HasMeta {
+		data[53] = p.BER
+		data[54] = p.RSSI
 	}
 
 	return data
@@ -700,27 +1618,33 @@ func BuildData(p *dmr.Packet, repeaterID uint32) []byte {
 
 // ParseData converts Homebrew packet format to DMR packet format.
 func ParseData(data []byte) (*dmr.Packet, error) {
-	if len(data) != 53 {
-		return nil, fmt.Errorf("homebrew: expected 53 data bytes, got %d", len(data))
+	if len(data) != DataSize && len(data) != DataMetaSize {
+		return nil, fmt.Errorf("homebrew: expected %d or %d data bytes, got %d", DataSize, DataMetaSize, len(data))
 	}
 
-	var p = &dmr.Packet{
-		Sequence:   data[4],
-		SrcID:      uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
-		DstID:      uint32(data[8])<<16 | uint32(data[9])<<8 | uint32(data[10]),
-		RepeaterID: uint32(data[11])<<24 | uint32(data[12])<<16 | uint32(data[13])<<8 | uint32(data[14]),
-		Timeslot:   (data[15] >> 0) & 0x01,
-		CallType:   (data[15] >> 1) & 0x01,
-		StreamID:   uint32(data[16])<<24 | uint32(data[17])<<16 | uint32(data[18])<<8 | uint32(data[19]),
+	var (
+		flags = Flags(data[15])
+		p     = &dmr.Packet{
+			Sequence:   data[4],
+			SrcID:      uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
+			DstID:      uint32(data[8])<<16 | uint32(data[9])<<8 | uint32(data[10]),
+			RepeaterID: uint32(data[11])<<24 | uint32(data[12])<<16 | uint32(data[13])<<8 | uint32(data[14]),
+			Timeslot:   flags.Timeslot(),
+			CallType:   flags.CallType(),
+			StreamID:   uint32(data[16])<<24 | uint32(data[17])<<16 | uint32(data[18])<<8 | uint32(data[19]),
+		}
+	)
+	p.SetData(append([]byte{}, data[20:DataSize]...)) // The data may be a reused read buffer
+	if len(data) == DataMetaSize {
+		p.BER, p.RSSI, p.HasMeta = data[53], data[54], true
 	}
-	p.SetData(data[20:])
 
-	switch (data[15] >> 2) & 0x03 {
-	case 0x00, 0x01: // voice (B-F), voice sync (A)
-		p.DataType = dmr.VoiceBurstA + (data[15] >> 4)
+	switch flags.FrameType() {
+	case FrameTypeVoice, FrameTypeVoiceSync:
+		p.DataType = dmr.VoiceBurstA + flags.DataType()
 		break
-	case 0x02: // data sync
-		p.DataType = (data[15] >> 4)
+	case FrameTypeDataSync:
+		p.DataType = flags.DataType()
 		break
 	default: // unknown/unused
 		return nil, errors.New("homebrew: unexpected frame type 0b11")
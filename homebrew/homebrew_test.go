@@ -0,0 +1,699 @@
+package homebrew
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func testHomebrew(t *testing.T) *Homebrew {
+	h, err := New(&RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		ColorCode: 1,
+	}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	return h
+}
+
+func TestStreamTimeout(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var ended = make(chan uint32, 2)
+	h.StreamTimeout = time.Millisecond * 20
+	h.OnStreamEnd = func(streamID uint32) { ended <- streamID }
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var peer = &Peer{ID: 2043044}
+	for i := 0; i < 5; i++ {
+		if err := h.handlePacket(&dmr.Packet{StreamID: 0x1234}, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+		time.Sleep(h.StreamTimeout / 4)
+	}
+	select {
+	case streamID := <-ended:
+		if streamID != 0x1234 {
+			t.Fatalf("expected stream %#x to end, got %#x", 0x1234, streamID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end")
+	}
+
+	select {
+	case streamID := <-ended:
+		t.Fatalf("stream %#x ended twice", streamID)
+	case <-time.After(h.StreamTimeout * 2):
+	}
+
+	h.streamMutex.Lock()
+	defer h.streamMutex.Unlock()
+	if len(h.streams) != 0 {
+		t.Fatalf("expected no active streams, got %d", len(h.streams))
+	}
+}
+
+func TestStats(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var peer = &Peer{ID: 2043044, Addr: h.conn.LocalAddr().(*net.UDPAddr)}
+	for _, p := range []*dmr.Packet{{StreamID: 1}, {StreamID: 1}, {StreamID: 2, Timeslot: 1}} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	if err := h.WritePacketToPeer(&dmr.Packet{StreamID: 1}, peer); err != nil {
+		t.Fatalf("write packet failed: %v", err)
+	}
+	if err := h.WriteToPeer(append(MasterPing, h.id...), peer); err != nil {
+		t.Fatalf("write ping failed: %v", err)
+	}
+
+	var s = h.Stats()
+	switch {
+	case s.FramesReceived != 3:
+		t.Fatalf("expected 3 frames received, got %d", s.FramesReceived)
+
+	case s.CallsObserved != 2:
+		t.Fatalf("expected 2 calls observed, got %d", s.CallsObserved)
+
+	case s.FramesSent != 1:
+		t.Fatalf("expected 1 frame sent, got %d", s.FramesSent)
+
+	case s.KeepalivesSent != 1:
+		t.Fatalf("expected 1 keepalive sent, got %d", s.KeepalivesSent)
+
+	case s.BytesSent != 53+uint64(len(MasterPing))+8:
+		t.Fatalf("expected %d bytes sent, got %d", 53+len(MasterPing)+8, s.BytesSent)
+
+	case s.Slot1Calls != 1 || s.Slot2Calls != 1:
+		t.Fatalf("expected 1 call per slot, got %d/%d", s.Slot1Calls, s.Slot2Calls)
+	}
+
+	// A pong updates the round trip time, a NAK on login is a login failure
+	var (
+		linked  = &Peer{ID: 1, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Status: AuthDone}
+		pending = &Peer{ID: 2, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}}
+	)
+	linked.Last.PingSent = time.Now().Add(-time.Millisecond * 50)
+	for _, peer := range []*Peer{linked, pending} {
+		h.Peer[peer.Addr.String()] = peer
+		h.PeerID[peer.ID] = peer
+	}
+	if err := h.handle(linked.Addr, append(RepeaterPong, h.id...)); err != nil {
+		t.Fatalf("handle pong failed: %v", err)
+	}
+	if err := h.handle(pending.Addr, append(MasterNAK, h.id...)); err != nil {
+		t.Fatalf("handle NAK failed: %v", err)
+	}
+	switch s = h.Stats(); {
+	case s.KeepalivesAcked != 1 || s.KeepaliveRTT < time.Millisecond*50:
+		t.Fatalf("expected 1 keepalive acked with a 50ms round trip, got %d in %s", s.KeepalivesAcked, s.KeepaliveRTT)
+
+	case s.LoginFailures != 1:
+		t.Fatalf("expected 1 login failure, got %d", s.LoginFailures)
+
+	case len(s.Peers) != 2 || s.Peers[0].ID != 1 || s.Peers[0].RTT != s.KeepaliveRTT || s.Peers[1].Status != AuthFailed:
+		t.Fatalf("unexpected peers %+v", s.Peers)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var buf bytes.Buffer
+	h.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := h.handle(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 62031}, []byte("RPTL")); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "unknown peer") || !strings.Contains(buf.String(), "127.0.0.2:62031") {
+		t.Fatalf("expected unknown peer to be logged, got %q", buf.String())
+	}
+}
+
+func TestUse(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var got []uint32
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		got = append(got, p.DstID)
+		return nil
+	})
+	h.Use(dmr.AllowTalkgroup(204))
+
+	var peer = &Peer{ID: 2043044}
+	for _, dstID := range []uint32{204, 91} {
+		if err := h.handlePacket(&dmr.Packet{CallType: dmr.CallTypeGroup, DstID: dstID}, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	if len(got) != 1 || got[0] != 204 {
+		t.Fatalf("expected only talkgroup 204 to pass, got %v", got)
+	}
+}
+
+// testCodec decodes every frame to silence.
+type testCodec struct{}
+
+func (testCodec) Decode(ambe []byte) ([]int16, error) {
+	return make([]int16, dmr.AMBEFrameSamples), nil
+}
+
+func (testCodec) Encode(pcm []int16) ([]byte, error) {
+	return make([]byte, 9), nil
+}
+
+func TestVoiceCodec(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var got []*dmr.Packet
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		got = append(got, p)
+		return nil
+	})
+
+	var (
+		peer  = &Peer{ID: 2043044}
+		burst = &dmr.Packet{StreamID: 1, DataType: dmr.VoiceBurstB}
+		lc    = &dmr.Packet{StreamID: 1, DataType: dmr.VoiceLC}
+	)
+	burst.SetData(make([]byte, 33))
+	lc.SetData(make([]byte, 33))
+	if err := h.handlePacket(burst, peer); err != nil {
+		t.Fatalf("handle packet failed: %v", err)
+	}
+	if got[0].PCM != nil {
+		t.Fatal("expected no PCM audio without codec")
+	}
+
+	h.VoiceCodec = testCodec{}
+	for _, p := range []*dmr.Packet{burst, lc} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	switch {
+	case len(got[1].PCM) != dmr.AMBEBurstFrame*dmr.AMBEFrameSamples:
+		t.Fatalf("expected %d samples, got %d", dmr.AMBEBurstFrame*dmr.AMBEFrameSamples, len(got[1].PCM))
+	case got[2].PCM != nil:
+		t.Fatal("expected no PCM audio for the voice LC header")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var masters [2]*Master
+	var registered = make(chan int, 2)
+	for i := range masters {
+		var i = i
+		masters[i] = testMaster(t)
+		defer masters[i].Close()
+		masters[i].AddRepeater(2042214, []byte("passw0rd"))
+		masters[i].OnRegister = func(uint32, *RepeaterConfiguration) { registered <- i }
+		go masters[i].ListenAndServe()
+	}
+
+	var (
+		h       = testHomebrew(t)
+		current = 0
+		lookups = make(chan string, 4)
+	)
+	defer h.Close()
+	h.Resolver = func(network, address string) (*net.UDPAddr, error) {
+		lookups <- network + " " + address
+		return masters[current].Addr(), nil
+	}
+	go h.ListenAndServe()
+
+	var peer = &Peer{ID: 1, Host: "master.example.org:62031", AuthKey: []byte("passw0rd")}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if lookup := <-lookups; lookup != "udp master.example.org:62031" {
+		t.Fatalf("unexpected lookup %q", lookup)
+	}
+	select {
+	case i := <-registered:
+		if i != 0 {
+			t.Fatalf("expected login on master 0, got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link did not log in")
+	}
+
+	// The dynamic DNS entry changed and the old master drops us, the new
+	// login goes to the new address. It is resolved by the keepalive loop,
+	// not while handling the NAK.
+	h.mutex.Lock()
+	current = 1
+	h.mutex.Unlock()
+	if err := masters[0].write(append(MasterNAK, h.id...), h.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatalf("NAK failed: %v", err)
+	}
+	select {
+	case <-lookups:
+	case <-time.After(time.Second * 3):
+		t.Fatal("host not resolved again")
+	}
+	select {
+	case i := <-registered:
+		if i != 1 {
+			t.Fatalf("expected login on master 1, got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link did not log in again")
+	}
+	if p := h.getPeerByAddr(masters[1].Addr()); p != peer {
+		t.Fatal("peer not moved to the new address")
+	}
+	if p := h.getPeerByAddr(masters[0].Addr()); p != nil {
+		t.Fatal("peer still registered at the old address")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var (
+		masters    [2]*Master
+		registered = make(chan int, 2)
+	)
+	for i := range masters {
+		var i = i
+		masters[i] = testMaster(t)
+		defer masters[i].Close()
+		masters[i].OnRegister = func(uint32, *RepeaterConfiguration) { registered <- i }
+		go masters[i].ListenAndServe()
+	}
+	// The primary master doesn't know us and refuses the login
+	masters[1].AddRepeater(2042214, []byte("passw0rd"))
+
+	h := testHomebrew(t)
+	defer h.Close()
+	h.Resolver = func(network, address string) (*net.UDPAddr, error) {
+		switch address {
+		case "primary:62031":
+			return masters[0].Addr(), nil
+		case "secondary:62031":
+			return masters[1].Addr(), nil
+		}
+		return nil, errors.New("no such host")
+	}
+	go h.ListenAndServe()
+
+	var peer = &Peer{ID: 1, Hosts: []string{"unknown:62031", "primary:62031", "secondary:62031"}, AuthKey: []byte("passw0rd")}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case i := <-registered:
+		if i != 1 {
+			t.Fatalf("expected login on master 1, got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link did not fail over")
+	}
+	if host := h.ActiveMaster(1); host != "secondary:62031" {
+		t.Fatalf("expected active master secondary:62031, got %q", host)
+	}
+	if peer.hasNextHost() {
+		t.Fatal("peer on the last host can fail over without RotateHosts")
+	}
+	peer.RotateHosts = true
+	if !peer.hasNextHost() {
+		t.Fatal("peer on the last host can't fail over with RotateHosts")
+	}
+	if host := h.ActiveMaster(2); host != "" {
+		t.Fatalf("expected no active master for unknown peer, got %q", host)
+	}
+}
+
+func TestFailoverConcurrent(t *testing.T) {
+	var (
+		masters    [2]*Master
+		registered = make(chan int, 4)
+	)
+	for i := range masters {
+		var i = i
+		masters[i] = testMaster(t)
+		defer masters[i].Close()
+		masters[i].AddRepeater(2042214, []byte("passw0rd"))
+		masters[i].OnRegister = func(uint32, *RepeaterConfiguration) { registered <- i }
+		go masters[i].ListenAndServe()
+	}
+
+	h := testHomebrew(t)
+	defer h.Close()
+	h.ResolveInterval = time.Minute
+	h.Resolver = func(network, address string) (*net.UDPAddr, error) {
+		switch address {
+		case "primary:62031":
+			return masters[0].Addr(), nil
+		case "secondary:62031":
+			return masters[1].Addr(), nil
+		}
+		return nil, errors.New("no such host")
+	}
+	go h.ListenAndServe()
+
+	// The active master and the stats are read while the link fails over
+	var done = make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				h.ActiveMaster(1)
+				h.Stats()
+			}
+		}
+	}()
+
+	var peer = &Peer{ID: 1, Hosts: []string{"primary:62031", "secondary:62031"}, AuthKey: []byte("passw0rd")}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case i := <-registered:
+		if i != 0 {
+			t.Fatalf("expected login on master 0, got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link did not log in")
+	}
+	// Let the keepalive loop run on the link
+	time.Sleep(time.Millisecond * 1100)
+
+	// The primary master forgets us and deauthenticates the link, which
+	// logs in again and fails over from the receiving goroutine
+	masters[0].RemoveRepeater(2042214)
+	if err := masters[0].write(append(MasterNAK, h.id...), h.Addr()); err != nil {
+		t.Fatalf("NAK failed: %v", err)
+	}
+	select {
+	case i := <-registered:
+		if i != 1 {
+			t.Fatalf("expected login on master 1, got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link did not fail over")
+	}
+	if host := h.ActiveMaster(1); host != "secondary:62031" {
+		t.Fatalf("expected active master secondary:62031, got %q", host)
+	}
+	time.Sleep(time.Millisecond * 1100)
+}
+
+func TestFailoverDelay(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.FailoverDelay = time.Minute
+	h.Resolver = func(network, address string) (*net.UDPAddr, error) {
+		return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}, nil
+	}
+
+	var peer = &Peer{ID: 1, Hosts: []string{"primary:62031", "secondary:62031"}, AuthKey: []byte("passw0rd")}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	var sent = peer.Last.PacketSent
+	if err := h.failover(peer); err != nil {
+		t.Fatalf("failover failed: %v", err)
+	}
+	switch {
+	case h.ActiveMaster(1) != "secondary:62031":
+		t.Fatalf("expected active master secondary:62031, got %q", h.ActiveMaster(1))
+	case peer.Status != AuthNone:
+		t.Fatalf("expected status %d, got %d", AuthNone, peer.Status)
+	case !peer.Last.PacketSent.Equal(sent):
+		t.Fatal("login sent before the failover delay")
+	case time.Until(peer.retry) < time.Second*59:
+		t.Fatalf("expected retry after a minute, got %s", time.Until(peer.retry))
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.ReadBufferSize = 1 << 20
+	h.WriteBufferSize = 1 << 18
+	h.DSCP = 46
+	if err := h.setSocketOptions(); err != nil {
+		t.Fatalf("set socket options failed: %v", err)
+	}
+
+	h.DSCP = 64
+	if err := h.setSocketOptions(); err == nil {
+		t.Fatal("set socket options with DSCP 64 succeeded")
+	}
+}
+
+func TestNewNetwork(t *testing.T) {
+	var config = &RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}
+	if _, err := NewNetwork("tcp", config, &net.UDPAddr{}); err == nil {
+		t.Fatal("new with tcp network succeeded")
+	}
+
+	h, err := NewNetwork("udp6", config, &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 not available: %v", err)
+	}
+	defer h.Close()
+	if ip := h.conn.LocalAddr().(*net.UDPAddr).IP; ip.To4() != nil {
+		t.Fatalf("expected IPv6 socket, got %s", ip)
+	}
+	if _, err := h.resolve("127.0.0.1:62031"); err == nil {
+		t.Fatal("resolve of IPv4 address on udp6 succeeded")
+	}
+}
+
+func TestDropUnknownPeer(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var received int
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error {
+		received++
+		return nil
+	})
+
+	var (
+		master   = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 62031}
+		attacker = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 62032}
+		peer     = &Peer{ID: 1, Addr: master, AuthKey: []byte("passw0rd")}
+		data     = BuildData(&dmr.Packet{StreamID: 1, DstID: 204}, 1)
+	)
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	peer.Status = AuthDone
+
+	for _, b := range [][]byte{append(MasterNAK, h.id...), data} {
+		if err := h.handle(attacker, b); err != nil {
+			t.Fatalf("handle failed: %v", err)
+		}
+	}
+	switch s := h.Stats(); {
+	case peer.Status != AuthDone:
+		t.Fatalf("NAK from unknown address changed status to %s", peer.Status.String())
+	case received != 0:
+		t.Fatalf("expected no packets from unknown address, got %d", received)
+	case s.PacketsDropped != 2:
+		t.Fatalf("expected 2 packets dropped, got %d", s.PacketsDropped)
+	}
+
+	// Behind NAT the master may send from another port
+	h.AllowPortMismatch = true
+	if err := h.handle(attacker, data); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if received != 1 {
+		t.Fatalf("expected packet from other port with AllowPortMismatch, got %d", received)
+	}
+	if err := h.handle(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 62031}, data); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if s := h.Stats(); received != 1 || s.PacketsDropped != 3 {
+		t.Fatalf("expected packet from other IP to be dropped, got %d received, %d dropped", received, s.PacketsDropped)
+	}
+}
+
+func TestIncomingLogin(t *testing.T) {
+	repeater, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer repeater.Close()
+
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var (
+		addr = repeater.LocalAddr().(*net.UDPAddr)
+		peer = &Peer{ID: 2043044, Addr: addr, AuthKey: []byte("passw0rd"), Incoming: true}
+		id   = packRepeaterID(peer.ID)
+		data = make([]byte, 512)
+		send = func(b []byte) {
+			if err := h.handle(addr, b); err != nil {
+				t.Fatalf("handle failed: %v", err)
+			}
+		}
+		expect = func(prefix []byte) []byte {
+			repeater.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := repeater.ReadFromUDP(data)
+			if err != nil {
+				t.Fatalf("expected %s: %v", prefix, err)
+			}
+			if !bytes.HasPrefix(data[:n], prefix) {
+				t.Fatalf("expected %s, got %q", prefix, data[:n])
+			}
+			return data[:n]
+		}
+	)
+	if err := h.Link(&Peer{ID: peer.ID, Addr: addr, Incoming: true, NoAuth: true}); err == nil {
+		t.Fatal("link of incoming peer with empty key succeeded")
+	}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	send(append(RepeaterLogin, id...))
+	var (
+		ack   = expect(MasterACK)
+		nonce = append([]byte{}, ack[len(MasterACK)+8:]...)
+	)
+	if len(nonce) != 4 {
+		t.Fatalf("expected 4 byte nonce, got %x", nonce)
+	}
+
+	// A wrong token is refused
+	send(append(append(RepeaterKey, id...), bytes.Repeat([]byte("0"), 64)...))
+	expect(MasterNAK)
+	if peer.Status != AuthNone {
+		t.Fatalf("expected status none after wrong token, got %s", peer.Status.String())
+	}
+
+	send(append(RepeaterLogin, id...))
+	ack = expect(MasterACK)
+	var hash = sha256.Sum256(append(append([]byte{}, ack[len(MasterACK)+8:]...), peer.AuthKey...))
+	send(append(append(RepeaterKey, id...), hex.EncodeToString(hash[:])...))
+	expect(MasterACK)
+	if peer.Status != AuthDone {
+		t.Fatalf("expected status done, got %s", peer.Status.String())
+	}
+
+	send(append(MasterPing, id...))
+	if pong := expect(RepeaterPong); !bytes.Equal(pong[len(RepeaterPong):], id) {
+		t.Fatalf("expected pong with ID %s, got %q", id, pong)
+	}
+
+	// Another repeater with the same ID is refused
+	other, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer other.Close()
+	if err := h.handle(other.LocalAddr().(*net.UDPAddr), append(RepeaterLogin, id...)); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	other.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := other.ReadFromUDP(data)
+	switch {
+	case err != nil:
+		t.Fatalf("expected %s: %v", MasterNAK, err)
+	case h.parseNAKReason(data[len(MasterNAK):n]) != NAKReasonIDConflict:
+		t.Fatalf("expected NAK for an ID conflict, got %q", data[:n])
+	case peer.Status != AuthDone || peer.Addr != addr:
+		t.Fatalf("expected peer to stay linked on %s, got %s on %s", addr, peer.Status.String(), peer.Addr)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var (
+		release = make(chan struct{})
+		handled = make(chan uint32, 8)
+	)
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		<-release
+		handled <- p.StreamID
+		return nil
+	})
+
+	// Queue of two frames, the receiver is blocked in the PacketFunc
+	var rx = make(chan receivedPacket, 2)
+	h.rx = rx
+	var peer = &Peer{ID: 2043044}
+	for streamID := uint32(1); streamID <= 5; streamID++ {
+		if err := h.enqueue(&dmr.Packet{StreamID: streamID}, peer); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	if s := h.Stats(); s.FramesDropped != 3 {
+		t.Fatalf("expected 3 frames dropped, got %d", s.FramesDropped)
+	}
+
+	h.rx = nil
+	close(rx)
+	close(release)
+	h.receive(rx)
+	for _, want := range []uint32{1, 2} {
+		if got := <-handled; got != want {
+			t.Fatalf("expected stream %d, got %d", want, got)
+		}
+	}
+}
+
+// BenchmarkSlowPacketFunc shows a slow PacketFunc doesn't block reading, the
+// frames that don't fit in the queue are counted as dropped.
+func BenchmarkSlowPacketFunc(b *testing.B) {
+	h, err := New(&RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatalf("new failed: %v", err)
+	}
+	defer h.Close()
+	h.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	var (
+		rx   = make(chan receivedPacket, DefaultQueueSize)
+		peer = &Peer{ID: 2043044, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 62031}, Status: AuthDone}
+		data = BuildData(&dmr.Packet{StreamID: 1}, 1)
+	)
+	h.Peer[peer.Addr.String()] = peer
+	h.rx = rx
+	go h.receive(rx)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := h.handle(peer.Addr, data); err != nil {
+			b.Fatalf("handle failed: %v", err)
+		}
+	}
+	b.StopTimer()
+
+	h.rx = nil
+	close(rx)
+	b.ReportMetric(float64(h.Stats().FramesDropped), "dropped")
+}
@@ -0,0 +1,312 @@
+// Package homebrewtest implements a Homebrew master for testing repeaters and
+// the applications built on the homebrew package, in the way of
+// net/http/httptest.
+package homebrewtest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+// Master is a homebrew.Master on a loopback port for a single repeater. It
+// performs the real login with the Key, answers the options and pings and
+// records every datagram the repeater sent. Replies can be refused, dropped
+// or delayed to test how the repeater copes with a misbehaving master.
+type Master struct {
+	// Key is the auth key of the repeater.
+	Key []byte
+	// NoAuth accepts the login without a nonce, the repeater then sends its
+	// configuration without the key exchange. It must be set before Start.
+	NoAuth bool
+
+	master     *homebrew.Master
+	mutex      sync.Mutex
+	addr       *net.UDPAddr // Address of the repeater
+	repeaterID uint32       // ID of the last login
+	reason     homebrew.NAKReason
+	received   [][]byte
+	expected   int           // Datagrams before this index were passed by Expect
+	notify     chan struct{} // Closed when a datagram was received or the repeater registered
+	started    bool
+	done       chan struct{}
+}
+
+// NewUnstartedMaster returns a master listening on a port chosen by the
+// system, which doesn't handle any datagrams before Start is called.
+func NewUnstartedMaster() (*Master, error) {
+	master, err := homebrew.NewMaster(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, errors.New("homebrewtest: " + err.Error())
+	}
+	var m = &Master{
+		master: master,
+		notify: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	master.KeyFunc = func(uint32) []byte {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		return m.Key
+	}
+	master.OnRegister = func(uint32, *homebrew.RepeaterConfiguration) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		m.wake()
+	}
+	master.SetTap(m.tap)
+	return m, nil
+}
+
+// NewMaster returns a started master accepting the login with the key.
+func NewMaster(key []byte) (*Master, error) {
+	m, err := NewUnstartedMaster()
+	if err != nil {
+		return nil, err
+	}
+	m.Key = key
+	m.Start()
+	return m, nil
+}
+
+// Master returns the underlying master, for example to set its Logger or
+// Timeout before Start.
+func (m *Master) Master() *homebrew.Master {
+	return m.master
+}
+
+// Start starts handling the datagrams of the repeater.
+func (m *Master) Start() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.started {
+		return
+	}
+	m.started = true
+	m.master.NoAuth = m.NoAuth
+	go func() {
+		defer close(m.done)
+		m.master.ListenAndServe()
+	}()
+}
+
+// Close stops the master, a logged in repeater is told the master is
+// closing.
+func (m *Master) Close() error {
+	var err = m.master.Close()
+	m.mutex.Lock()
+	var started = m.started
+	m.mutex.Unlock()
+	if started {
+		<-m.done
+	}
+	return err
+}
+
+// Addr returns the address to link the repeater to.
+func (m *Master) Addr() *net.UDPAddr {
+	return m.master.Addr()
+}
+
+// Refuse makes the master reply to the packets of the kind with a NAK, see
+// homebrew.Master.Refuse.
+func (m *Master) Refuse(kind homebrew.PacketType, refuse bool) {
+	m.master.Refuse(kind, refuse)
+}
+
+// Drop makes the master ignore the next n packets of the kind, or all of them
+// if n is negative. Dropped packets are still recorded.
+func (m *Master) Drop(kind homebrew.PacketType, n int) {
+	m.master.Drop(kind, n)
+}
+
+// Delay delays the replies to the packets of the kind, such as
+// PacketTypeMasterPing for late pongs.
+func (m *Master) Delay(kind homebrew.PacketType, d time.Duration) {
+	m.master.Delay(kind, d)
+}
+
+// SetNAKReason sets the reason sent with the NAKs of refused packets and
+// with NAK, NAKReasonNone sends plain NAKs.
+func (m *Master) SetNAKReason(reason homebrew.NAKReason) {
+	m.master.SetNAKReason(reason)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reason = reason
+}
+
+// LoggedIn returns true if the repeater sent its configuration.
+func (m *Master) LoggedIn() bool {
+	return len(m.master.Repeaters()) > 0
+}
+
+// Config returns the configuration sent by the repeater, or nil.
+func (m *Master) Config() *homebrew.RepeaterConfiguration {
+	for _, id := range m.master.Repeaters() {
+		return m.master.Config(id)
+	}
+	return nil
+}
+
+// Options returns the options sent by the repeater.
+func (m *Master) Options() string {
+	for _, id := range m.master.Repeaters() {
+		return m.master.Options(id)
+	}
+	return ""
+}
+
+// Received returns the datagrams the repeater sent of the kinds, or all of
+// them if no kinds are given.
+func (m *Master) Received(kinds ...homebrew.PacketType) [][]byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var received [][]byte
+	for _, data := range m.received {
+		if matches(data, kinds) {
+			received = append(received, data)
+		}
+	}
+	return received
+}
+
+// Expect returns the next datagram of the kind the repeater sent, after the
+// datagrams returned by earlier calls, waiting up to the timeout for it.
+func (m *Master) Expect(kind homebrew.PacketType, timeout time.Duration) ([]byte, error) {
+	var deadline = time.After(timeout)
+	for {
+		m.mutex.Lock()
+		for i := m.expected; i < len(m.received); i++ {
+			if data := m.received[i]; matches(data, []homebrew.PacketType{kind}) {
+				m.expected = i + 1
+				m.mutex.Unlock()
+				return data, nil
+			}
+		}
+		var notify = m.notify
+		m.mutex.Unlock()
+
+		select {
+		case <-notify:
+			break
+		case <-deadline:
+			return nil, fmt.Errorf("homebrewtest: no %s received within %s", kind, timeout)
+		}
+	}
+}
+
+// WaitLogin waits up to the timeout for the repeater to log in.
+func (m *Master) WaitLogin(timeout time.Duration) error {
+	var deadline = time.After(timeout)
+	for {
+		m.mutex.Lock()
+		var notify = m.notify
+		m.mutex.Unlock()
+		if m.LoggedIn() {
+			return nil
+		}
+
+		select {
+		case <-notify:
+			break
+		case <-deadline:
+			return fmt.Errorf("homebrewtest: repeater did not log in within %s", timeout)
+		}
+	}
+}
+
+// Send sends a frame to the logged in repeater.
+func (m *Master) Send(p *dmr.Packet) error {
+	m.mutex.Lock()
+	var repeaterID = m.repeaterID
+	m.mutex.Unlock()
+	if !m.LoggedIn() {
+		return errors.New("homebrewtest: repeater not logged in")
+	}
+	return m.master.SendTo(repeaterID, p)
+}
+
+// ACK sends an unsolicited ACK to the repeater.
+func (m *Master) ACK() error {
+	return m.reply(homebrew.MasterACK)
+}
+
+// NAK sends an unsolicited NAK to the repeater, which makes a logged in
+// repeater log in again.
+func (m *Master) NAK() error {
+	m.mutex.Lock()
+	var reason = m.reason
+	m.mutex.Unlock()
+	if reason != homebrew.NAKReasonNone {
+		return m.reply(homebrew.MasterNAK, byte(reason))
+	}
+	return m.reply(homebrew.MasterNAK)
+}
+
+// Write sends a datagram to the repeater, which must have sent a datagram
+// before.
+func (m *Master) Write(data []byte) error {
+	m.mutex.Lock()
+	var addr = m.addr
+	m.mutex.Unlock()
+	if addr == nil {
+		return errors.New("homebrewtest: repeater address unknown")
+	}
+	return m.master.WriteTo(data, addr)
+}
+
+// reply sends the opcode followed by the ID of the repeater and the data.
+func (m *Master) reply(opcode []byte, data ...byte) error {
+	m.mutex.Lock()
+	var id = []byte(fmt.Sprintf("%08X", m.repeaterID))
+	m.mutex.Unlock()
+	return m.Write(append(append(append([]byte{}, opcode...), id...), data...))
+}
+
+// tap records the datagrams of the repeater, before the master handles them.
+func (m *Master) tap(direction homebrew.Direction, addr *net.UDPAddr, data []byte) {
+	if direction != homebrew.Received {
+		return
+	}
+	data = append([]byte{}, data...)
+	kind, payload, _ := homebrew.ClassifyPacket(data)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.received = append(m.received, data)
+	m.addr = addr
+	if kind == homebrew.PacketTypeRepeaterLogin && len(payload) >= 8 {
+		if id, err := strconv.ParseUint(string(payload[:8]), 16, 32); err == nil {
+			m.repeaterID = uint32(id)
+		}
+	}
+	m.wake()
+}
+
+// wake wakes up Expect and WaitLogin. The caller must hold the mutex.
+func (m *Master) wake() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// matches returns true if the datagram is of one of the kinds, or if no kinds
+// are given.
+func matches(data []byte, kinds []homebrew.PacketType) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	kind, _, _ := homebrew.ClassifyPacket(data)
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package homebrewtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+func TestMaster(t *testing.T) {
+	m, err := NewMaster([]byte("passw0rd"))
+	if err != nil {
+		t.Fatalf("new master failed: %v", err)
+	}
+	defer m.Close()
+
+	conn, err := net.DialUDP("udp", nil, m.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	var (
+		id      = []byte("001F2966")
+		data    = make([]byte, 512)
+		request = func(b []byte, prefix []byte) []byte {
+			if _, err := conn.Write(b); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(data)
+			if err != nil {
+				t.Fatalf("expected %s: %v", prefix, err)
+			}
+			if !bytes.HasPrefix(data[:n], append(append([]byte{}, prefix...), id...)) {
+				t.Fatalf("expected %s, got %q", prefix, data[:n])
+			}
+			return data[len(prefix)+len(id) : n]
+		}
+	)
+
+	switch {
+	case m.Write([]byte("MSTCL")) == nil:
+		t.Fatal("write before the repeater sent anything succeeded")
+	case m.Send(&dmr.Packet{}) == nil:
+		t.Fatal("send before login succeeded")
+	}
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterLogin, time.Millisecond*10); err == nil {
+		t.Fatal("expected a timeout")
+	}
+
+	// A wrong key is refused, the right key logs in
+	var nonce = append([]byte{}, request(append(homebrew.RepeaterLogin, id...), homebrew.MasterACK)...)
+	request(append(append(homebrew.RepeaterKey, id...), bytes.Repeat([]byte{'0'}, 64)...), homebrew.MasterNAK)
+	nonce = append([]byte{}, request(append(homebrew.RepeaterLogin, id...), homebrew.MasterACK)...)
+	hash := sha256.New()
+	hash.Write(nonce)
+	hash.Write([]byte("passw0rd"))
+	request(append(append(homebrew.RepeaterKey, id...), hex.EncodeToString(hash.Sum(nil))...), homebrew.MasterACK)
+
+	config := (&homebrew.RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}).Bytes()
+	request(config, homebrew.MasterACK)
+	if !m.LoggedIn() || m.Config().Callsign != "PD0MZ" {
+		t.Fatalf("expected repeater logged in, got configuration %+v", m.Config())
+	}
+
+	// Pings are answered, unless refused
+	request(append(homebrew.MasterPing, id...), homebrew.RepeaterPong)
+	m.Refuse(homebrew.PacketTypeMasterPing, true)
+	request(append(homebrew.MasterPing, id...), homebrew.MasterNAK)
+
+	switch {
+	case len(m.Received()) != 7:
+		t.Fatalf("expected 7 datagrams received, got %d", len(m.Received()))
+	case len(m.Received(homebrew.PacketTypeRepeaterLogin, homebrew.PacketTypeRepeaterKey)) != 4:
+		t.Fatalf("expected 4 logins and keys, got %q", m.Received(homebrew.PacketTypeRepeaterLogin, homebrew.PacketTypeRepeaterKey))
+	}
+	for _, kind := range []homebrew.PacketType{homebrew.PacketTypeRepeaterKey, homebrew.PacketTypeMasterPing} {
+		if _, err := m.Expect(kind, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterKey, time.Millisecond*10); err == nil {
+		t.Fatal("expected no key after the ping")
+	}
+
+	// Frames are sent to the repeater
+	if err := m.Send(&dmr.Packet{SrcID: 2043044, DstID: 204, StreamID: 1}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(data)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	p, err := homebrew.ParseData(data[:n])
+	switch {
+	case err != nil:
+		t.Fatalf("parse failed: %v", err)
+	case p.SrcID != 2043044 || p.DstID != 204 || p.RepeaterID != 0x001f2966:
+		t.Fatalf("unexpected packet %s", p)
+	}
+}
@@ -0,0 +1,471 @@
+package homebrew_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/homebrew"
+	"github.com/pd0mz/go-dmr/homebrew/homebrewtest"
+)
+
+func testMaster(t *testing.T, key string) *homebrewtest.Master {
+	m, err := homebrewtest.NewMaster([]byte(key))
+	if err != nil {
+		t.Fatalf("new master failed: %v", err)
+	}
+	return m
+}
+
+// testLink returns a listening link to the master, which isn't linked yet.
+func testLink(t *testing.T) *homebrew.Homebrew {
+	h, err := homebrew.New(&homebrew.RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		ColorCode: 1,
+	}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	go h.ListenAndServe()
+	return h
+}
+
+// waitStats waits for the stats of the link to satisfy ok, the keepalive
+// loop of the link runs every second.
+func waitStats(t *testing.T, h *homebrew.Homebrew, ok func(homebrew.Stats) bool) homebrew.Stats {
+	var deadline = time.Now().Add(time.Second * 3)
+	for {
+		var s = h.Stats()
+		if ok(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected stats %s, peers %+v", s, s.Peers)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestLinkLogin(t *testing.T) {
+	for _, noAuth := range []bool{false, true} {
+		m, err := homebrewtest.NewUnstartedMaster()
+		if err != nil {
+			t.Fatalf("new master failed: %v", err)
+		}
+		m.Key, m.NoAuth = []byte("passw0rd"), noAuth
+		m.Start()
+		h := testLink(t)
+
+		if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+			t.Fatalf("link failed: %v", err)
+		}
+		if err := m.WaitLogin(time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			keys   = m.Received(homebrew.PacketTypeRepeaterKey)
+			s      = waitStats(t, h, func(s homebrew.Stats) bool { return s.KeepalivesAcked == 1 })
+			config = m.Config()
+		)
+		switch {
+		case config == nil || config.Callsign != "PD0MZ" || config.ID != 2042214:
+			t.Fatalf("noauth %t: unexpected configuration %+v", noAuth, config)
+		case noAuth && len(keys) != 0:
+			t.Fatalf("noauth %t: expected no key exchange, got %q", noAuth, keys)
+		case !noAuth && len(keys) != 1:
+			t.Fatalf("noauth %t: expected a key exchange, got %q", noAuth, keys)
+		case len(s.Peers) != 1 || s.Peers[0].Status != homebrew.AuthDone:
+			t.Fatalf("noauth %t: unexpected peers %+v", noAuth, s.Peers)
+		case s.LoginFailures != 0:
+			t.Fatalf("noauth %t: expected no login failures, got %d", noAuth, s.LoginFailures)
+		}
+
+		h.Close()
+		if _, err := m.Expect(homebrew.PacketTypeRepeaterClosing, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		m.Close()
+	}
+}
+
+func TestLinkRefused(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		refuse []homebrew.PacketType
+		key    string
+	}{
+		{"login", []homebrew.PacketType{homebrew.PacketTypeRepeaterLogin}, "passw0rd"},
+		{"key", []homebrew.PacketType{homebrew.PacketTypeRepeaterKey}, "passw0rd"},
+		{"wrong key", nil, "wrong"},
+	} {
+		m := testMaster(t, "passw0rd")
+		for _, kind := range test.refuse {
+			m.Refuse(kind, true)
+		}
+		h := testLink(t)
+
+		if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte(test.key)}); err != nil {
+			t.Fatalf("link failed: %v", err)
+		}
+		waitStats(t, h, func(s homebrew.Stats) bool {
+			return s.LoginFailures == 1 && len(s.Peers) == 1 && s.Peers[0].Status == homebrew.AuthFailed
+		})
+		if m.LoggedIn() || len(m.Received(homebrew.PacketTypeRepeaterConfig)) != 0 {
+			t.Fatalf("%s: repeater sent its configuration", test.name)
+		}
+		h.Close()
+		m.Close()
+	}
+}
+
+func TestLinkIDConflict(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	m.Refuse(homebrew.PacketTypeRepeaterConfig, true)
+	m.SetNAKReason(homebrew.NAKReasonIDConflict)
+	h := testLink(t)
+	defer h.Close()
+
+	var conflicts = make(chan *homebrew.Peer, 1)
+	h.OnIDConflict = func(peer *homebrew.Peer) { conflicts <- peer }
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case <-conflicts:
+	case <-time.After(time.Second):
+		t.Fatal("ID conflict not detected")
+	}
+	waitStats(t, h, func(s homebrew.Stats) bool {
+		return s.LoginFailures == 1 && len(s.Peers) == 1 && s.Peers[0].Status == homebrew.AuthFailed
+	})
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Millisecond*100); err == nil {
+		t.Fatal("repeater pinged after the refused configuration")
+	}
+}
+
+func TestLinkLoginTimeout(t *testing.T) {
+	for _, kind := range []homebrew.PacketType{homebrew.PacketTypeRepeaterLogin, homebrew.PacketTypeRepeaterKey} {
+		// A silent master fails the login, which is retried
+		m := testMaster(t, "passw0rd")
+		m.Drop(kind, -1)
+		h := testLink(t)
+		h.LoginTimeout, h.KeyTimeout = time.Millisecond*100, time.Millisecond*100
+
+		if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+			t.Fatalf("link failed: %v", err)
+		}
+		waitStats(t, h, func(s homebrew.Stats) bool { return s.LoginFailures == 1 })
+		if _, err := m.Expect(homebrew.PacketTypeRepeaterLogin, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Expect(homebrew.PacketTypeRepeaterLogin, time.Second*2); err != nil {
+			t.Fatalf("%s dropped: login not retried: %v", kind, err)
+		}
+		h.Close()
+
+		// Unless the peer is unlinked on failure
+		h = testLink(t)
+		h.LoginTimeout, h.KeyTimeout = time.Millisecond*100, time.Millisecond*100
+		if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd"), UnlinkOnAuthFailure: true}); err != nil {
+			t.Fatalf("link failed: %v", err)
+		}
+		waitStats(t, h, func(s homebrew.Stats) bool { return s.LoginFailures == 1 && len(s.Peers) == 0 })
+		h.Close()
+		m.Close()
+	}
+
+	// Zero timeouts fall back to the defaults, instead of failing every tick
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	m.Drop(homebrew.PacketTypeRepeaterLogin, -1)
+	h := testLink(t)
+	defer h.Close()
+	h.LoginTimeout, h.KeyTimeout = 0, 0
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterLogin, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 1500)
+	if s := h.Stats(); s.LoginFailures != 0 {
+		t.Fatalf("expected no login failures, got %s", s)
+	}
+}
+
+func TestLinkLoginRetry(t *testing.T) {
+	// A lost login is sent again before the login times out
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	m.Drop(homebrew.PacketTypeRepeaterLogin, 1)
+	h := testLink(t)
+	h.LoginRetryInterval = time.Millisecond * 100
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if err := m.WaitLogin(time.Second * 3); err != nil {
+		t.Fatal(err)
+	}
+	var s = waitStats(t, h, func(s homebrew.Stats) bool { return len(s.Peers) == 1 && s.Peers[0].Status == homebrew.AuthDone })
+	if s.Peers[0].LoginRetries != 1 || s.LoginFailures != 0 {
+		t.Fatalf("expected 1 login retry and no failures, got %s, peers %+v", s, s.Peers)
+	}
+	h.Close()
+
+	// Up to LoginRetries times, while keeping the NAT mapping open
+	m.Drop(homebrew.PacketTypeRepeaterLogin, -1)
+	h = testLink(t)
+	defer h.Close()
+	h.LoginRetryInterval, h.LoginRetries, h.NATKeepalive = time.Millisecond*100, 1, time.Millisecond*100
+	var logins = len(m.Received(homebrew.PacketTypeRepeaterLogin))
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	waitStats(t, h, func(s homebrew.Stats) bool { return len(s.Peers) == 1 && s.Peers[0].LoginRetries == 1 })
+	time.Sleep(time.Millisecond * 1500)
+	switch {
+	case len(m.Received(homebrew.PacketTypeRepeaterLogin)) != logins+2:
+		t.Fatalf("expected 2 logins, got %d", len(m.Received(homebrew.PacketTypeRepeaterLogin))-logins)
+	case len(m.Received(homebrew.PacketTypeUnknown)) == 0:
+		t.Fatal("expected NAT keepalives")
+	}
+}
+
+func TestLinkDeauthenticated(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	h := testLink(t)
+	defer h.Close()
+
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if err := m.WaitLogin(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A NAK after login makes the repeater log in again
+	if err := m.NAK(); err != nil {
+		t.Fatalf("NAK failed: %v", err)
+	}
+	for _, kind := range []homebrew.PacketType{
+		homebrew.PacketTypeRepeaterLogin,
+		homebrew.PacketTypeRepeaterKey,
+		homebrew.PacketTypeRepeaterConfig,
+		homebrew.PacketTypeMasterPing,
+	} {
+		if _, err := m.Expect(kind, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(m.Received(homebrew.PacketTypeRepeaterLogin)); n != 2 {
+		t.Fatalf("expected 2 logins, got %d", n)
+	}
+}
+
+func TestLinkOptions(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	h := testLink(t)
+	defer h.Close()
+
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A refused change keeps the link up
+	m.Refuse(homebrew.PacketTypeRepeaterOptions, true)
+	if err := h.SetOptions("TS1_1=91"); err != nil {
+		t.Fatalf("set options failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterOptions, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	m.Refuse(homebrew.PacketTypeRepeaterOptions, false)
+	if err := h.SetOptions("TS2_1=204"); err != nil {
+		t.Fatalf("set options failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterOptions, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case m.Options() != "TS2_1=204":
+		t.Fatalf("expected options TS2_1=204, got %q", m.Options())
+	case len(m.Received(homebrew.PacketTypeRepeaterLogin)) != 1:
+		t.Fatal("refused options made the repeater log in again")
+	}
+}
+
+func TestLinkKeepalive(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	m.Delay(homebrew.PacketTypeMasterPing, time.Millisecond*50)
+	h := testLink(t)
+	defer h.Close()
+
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	var s = waitStats(t, h, func(s homebrew.Stats) bool { return s.KeepalivesAcked == 1 })
+	switch {
+	case s.KeepaliveRTT < time.Millisecond*50:
+		t.Fatalf("expected a round trip of at least 50ms, got %s", s.KeepaliveRTT)
+	case len(s.Peers) != 1 || s.Peers[0].RTT != s.KeepaliveRTT:
+		t.Fatalf("unexpected peers %+v", s.Peers)
+	}
+
+	// Pings the master drops are not acknowledged
+	m.Drop(homebrew.PacketTypeMasterPing, -1)
+	if err := m.ACK(); err != nil {
+		t.Fatalf("ACK failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if s = h.Stats(); s.KeepalivesAcked != 1 {
+		t.Fatalf("expected 1 keepalive acked, got %d", s.KeepalivesAcked)
+	}
+}
+
+func TestLinkData(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	h := testLink(t)
+	defer h.Close()
+
+	var received = make(chan *dmr.Packet, 8)
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		received <- p
+		return nil
+	})
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if err := m.WaitLogin(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint8(0); i < 3; i++ {
+		var p = &dmr.Packet{Sequence: i, SrcID: 2043044, DstID: 204, StreamID: 0x1234, Timeslot: 1, CallType: dmr.CallTypeGroup}
+		p.SetData(bytes.Repeat([]byte{0x55}, 33))
+		if err := m.Send(p); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+		select {
+		case got := <-received:
+			switch {
+			case got.Sequence != i || got.SrcID != p.SrcID || got.DstID != p.DstID || got.StreamID != p.StreamID:
+				t.Fatalf("unexpected packet %s", got)
+			case got.Timeslot != p.Timeslot || got.CallType != p.CallType || !bytes.Equal(got.Data, p.Data):
+				t.Fatalf("unexpected packet %s", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("repeater did not receive packet")
+		}
+	}
+
+	var p = &dmr.Packet{SrcID: 2042214, DstID: 2043044, StreamID: 0x4321, CallType: dmr.CallTypePrivate}
+	p.SetData(bytes.Repeat([]byte{0xaa}, 33))
+	if err := h.Send(p); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	data, err := m.Expect(homebrew.PacketTypeDMRData, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := homebrew.ParseData(data)
+	switch {
+	case err != nil:
+		t.Fatalf("parse failed: %v", err)
+	case got.SrcID != p.SrcID || got.DstID != p.DstID || got.RepeaterID != 2042214 || got.CallType != p.CallType:
+		t.Fatalf("unexpected packet %s", got)
+	case !bytes.Equal(got.Data, p.Data):
+		t.Fatalf("expected data %x, got %x", p.Data, got.Data)
+	}
+}
+
+func TestListenAndServeRecovers(t *testing.T) {
+	m := testMaster(t, "passw0rd")
+	defer m.Close()
+	m.Delay(homebrew.PacketTypeRepeaterLogin, time.Millisecond*50)
+
+	h, err := homebrew.New(&homebrew.RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		ColorCode: 1,
+	}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	defer h.Close()
+	var received = make(chan *dmr.Packet, 4)
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		received <- p
+		return errors.New("test: packet func failed")
+	})
+	var done = make(chan error, 1)
+	go func() { done <- h.ListenAndServe() }()
+
+	var dmrd = homebrew.BuildData(&dmr.Packet{StreamID: 1, DstID: 204}, 2042214)
+	if err := h.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	// DMR data before the login completed is ignored
+	if _, err := m.Expect(homebrew.PacketTypeRepeaterLogin, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write(dmrd); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither malformed data nor a failing PacketFunc stops the listener
+	for _, data := range [][]byte{dmrd[:30], dmrd} {
+		if err := m.Write(data); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := m.ACK(); err != nil {
+		t.Fatalf("ACK failed: %v", err)
+	}
+	if _, err := m.Expect(homebrew.PacketTypeMasterPing, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not receive packet")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if n := len(received); n != 0 {
+		t.Fatalf("expected 1 packet, got %d more", n)
+	}
+
+	h.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected listener to stop without error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listener did not stop")
+	}
+}
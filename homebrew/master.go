@@ -0,0 +1,678 @@
+package homebrew
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// Master implements the master side of the Homebrew protocol, repeaters and
+// hotspots log in with their own auth key and send their configuration,
+// after which packets are exchanged. A login with the ID of a repeater that
+// is logged in from another address is refused with NAKReasonIDConflict,
+// until that repeater timed out.
+type Master struct {
+	// Timeout is the time without packets after which a repeater is
+	// deregistered, unless SetRepeaterTimeout set another timeout for it.
+	Timeout time.Duration
+	// NoAuth disables authentication, any repeater may log in. The login is
+	// accepted without a nonce and the repeater sends its configuration
+	// without the key exchange.
+	NoAuth bool
+
+	// OnPacket is called for every packet from a logged in repeater.
+	OnPacket func(repeaterID uint32, p *dmr.Packet)
+	// OnRegister is called when a repeater has sent its configuration.
+	OnRegister func(repeaterID uint32, config *RepeaterConfiguration)
+	// OnDeregister is called when a repeater closed its link or timed out.
+	OnDeregister func(repeaterID uint32)
+	// OnOptions is called when a repeater has sent its options.
+	OnOptions func(repeaterID uint32, options string)
+	// KeyFunc returns the auth key of repeaters that were not added with
+	// AddRepeater, for example from a database. Repeaters for which it
+	// returns an empty key are refused, unless NoAuth is set.
+	KeyFunc func(repeaterID uint32) []byte
+
+	// Logger receives the log messages, if nil slog.Default() is used.
+	Logger *slog.Logger
+
+	conn      *net.UDPConn
+	mutex     *sync.Mutex
+	keys      map[uint32][]byte
+	timeouts  map[uint32]time.Duration
+	repeaters map[uint32]*masterRepeater
+	addrs     map[string]*masterRepeater // Index of repeaters by address
+	stop      chan struct{}
+	closed    bool
+	tap       TapFunc
+
+	// Fault injection, see Refuse, Drop and Delay
+	refuse map[PacketType]bool
+	drop   map[PacketType]int
+	delay  map[PacketType]time.Duration
+	reason NAKReason
+}
+
+type masterRepeater struct {
+	id         []byte
+	repeaterID uint32
+	addr       *net.UDPAddr
+	status     AuthStatus
+	keyed      bool // Key challenge accepted, waiting for the configuration
+	token      []byte
+	config     *RepeaterConfiguration
+	options    string
+	last       time.Time
+}
+
+// NewMaster creates a master listening on addr.
+func NewMaster(addr *net.UDPAddr) (*Master, error) {
+	if addr == nil {
+		return nil, errors.New("homebrew: addr can't be nil")
+	}
+
+	m := &Master{
+		Timeout:   PingTimeout,
+		mutex:     &sync.Mutex{},
+		keys:      make(map[uint32][]byte),
+		timeouts:  make(map[uint32]time.Duration),
+		repeaters: make(map[uint32]*masterRepeater),
+		addrs:     make(map[string]*masterRepeater),
+		refuse:    make(map[PacketType]bool),
+		drop:      make(map[PacketType]int),
+		delay:     make(map[PacketType]time.Duration),
+	}
+
+	var err error
+	if m.conn, err = net.ListenUDP("udp", addr); err != nil {
+		return nil, errors.New("homebrew: " + err.Error())
+	}
+	return m, nil
+}
+
+// logger returns the configured logger, or the default logger.
+func (m *Master) logger() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return slog.Default()
+}
+
+// Addr returns the local address of the master.
+func (m *Master) Addr() *net.UDPAddr {
+	return m.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// AddRepeater allows the repeater to log in with the auth key. The key can
+// only be empty with NoAuth set.
+func (m *Master) AddRepeater(id uint32, authKey []byte) error {
+	if id == 0 {
+		return errors.New("homebrew: repeater ID can't be 0")
+	}
+	if len(authKey) == 0 && !m.NoAuth {
+		return errors.New("homebrew: AuthKey can't be empty")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.keys[id] = authKey
+	return nil
+}
+
+// SetRepeaterTimeout sets the time without packets after which the repeater
+// is deregistered, a timeout of zero or less restores Timeout.
+func (m *Master) SetRepeaterTimeout(id uint32, timeout time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if timeout <= 0 {
+		delete(m.timeouts, id)
+	} else {
+		m.timeouts[id] = timeout
+	}
+}
+
+// RemoveRepeater revokes the auth key of the repeater and closes its link.
+func (m *Master) RemoveRepeater(id uint32) {
+	m.mutex.Lock()
+	delete(m.keys, id)
+	r, ok := m.repeaters[id]
+	m.remove(id)
+	var registered = ok && r.status == AuthDone
+	m.mutex.Unlock()
+
+	if ok {
+		m.write(append(MasterClosing, r.id...), r.addr)
+		if registered && m.OnDeregister != nil {
+			m.OnDeregister(id)
+		}
+	}
+}
+
+// Repeaters returns the IDs of the logged in repeaters.
+func (m *Master) Repeaters() []uint32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var ids = make([]uint32, 0, len(m.repeaters))
+	for id, r := range m.repeaters {
+		if r.status == AuthDone {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Config returns the configuration sent by a logged in repeater.
+func (m *Master) Config(repeaterID uint32) *RepeaterConfiguration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if r, ok := m.repeaters[repeaterID]; ok {
+		return r.config
+	}
+	return nil
+}
+
+// Options returns the options sent by a logged in repeater.
+func (m *Master) Options(repeaterID uint32) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if r, ok := m.repeaters[repeaterID]; ok {
+		return r.options
+	}
+	return ""
+}
+
+// SetTap sets the function that is called with every datagram sent and
+// received, also the ones dropped by Drop. A nil f removes the tap. SetTap
+// must be called before ListenAndServe.
+func (m *Master) SetTap(f TapFunc) {
+	m.tap = f
+}
+
+// Refuse makes the master reply to the packets of the kind with a NAK, such
+// as PacketTypeRepeaterLogin to refuse all logins. Refuse it with false to
+// handle them again. Refuse, Drop and Delay inject faults, to test how
+// repeaters cope with a misbehaving master.
+func (m *Master) Refuse(kind PacketType, refuse bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.refuse[kind] = refuse
+}
+
+// Drop makes the master ignore the next n packets of the kind, or all of them
+// if n is negative. Zero handles them again.
+func (m *Master) Drop(kind PacketType, n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.drop[kind] = n
+}
+
+// Delay delays the handling of the packets of the kind, and so the replies,
+// such as PacketTypeMasterPing for late pongs. Zero or less handles them
+// right away again.
+func (m *Master) Delay(kind PacketType, d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.delay[kind] = d
+}
+
+// SetNAKReason sets the reason sent with the NAKs of refused packets,
+// NAKReasonNone sends plain NAKs.
+func (m *Master) SetNAKReason(reason NAKReason) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reason = reason
+}
+
+// WriteTo sends a raw datagram to addr, for example to send a repeater
+// unexpected packets.
+func (m *Master) WriteTo(b []byte, addr *net.UDPAddr) error {
+	if addr == nil {
+		return errors.New("homebrew: addr can't be nil")
+	}
+	return m.write(b, addr)
+}
+
+// SendTo sends a packet to a logged in repeater.
+func (m *Master) SendTo(repeaterID uint32, p *dmr.Packet) error {
+	m.mutex.Lock()
+	r, ok := m.repeaters[repeaterID]
+	ok = ok && r.status == AuthDone
+	m.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("homebrew: repeater %d not logged in", repeaterID)
+	}
+	return m.write(BuildData(p, repeaterID), r.addr)
+}
+
+// ListenAndServe handles packets until the master is closed.
+func (m *Master) ListenAndServe() error {
+	var data = make([]byte, 512)
+
+	m.mutex.Lock()
+	m.stop = make(chan struct{})
+	go m.expire(m.stop)
+	m.mutex.Unlock()
+
+	for {
+		n, addr, err := m.conn.ReadFromUDP(data)
+		if err != nil {
+			m.mutex.Lock()
+			closed := m.closed
+			m.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if m.tap != nil {
+			m.tap(Received, addr, data[:n])
+		}
+		m.handle(addr, data[:n])
+	}
+}
+
+// Close tells the repeaters the master is closing and stops the listener.
+func (m *Master) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	if m.stop != nil {
+		close(m.stop)
+	}
+	for _, r := range m.repeaters {
+		if r.status == AuthDone {
+			m.write(append(MasterClosing, r.id...), r.addr)
+		}
+	}
+	return m.conn.Close()
+}
+
+// add adds the repeater, replacing a repeater with the same ID. The caller
+// must hold the mutex.
+func (m *Master) add(r *masterRepeater) {
+	m.remove(r.repeaterID)
+	m.repeaters[r.repeaterID] = r
+	m.addrs[r.addr.String()] = r
+}
+
+// remove removes the repeater with the ID, if any. The caller must hold the
+// mutex.
+func (m *Master) remove(id uint32) {
+	r, ok := m.repeaters[id]
+	if !ok {
+		return
+	}
+	delete(m.repeaters, id)
+	// Another repeater ID may have logged in from the same address since
+	if m.addrs[r.addr.String()] == r {
+		delete(m.addrs, r.addr.String())
+	}
+}
+
+// timeout returns the timeout of the repeater. The caller must hold the
+// mutex.
+func (m *Master) timeout(id uint32) time.Duration {
+	if timeout, ok := m.timeouts[id]; ok {
+		return timeout
+	}
+	return m.defaultTimeout()
+}
+
+func (m *Master) defaultTimeout() time.Duration {
+	if m.Timeout <= 0 {
+		return PingTimeout
+	}
+	return m.Timeout
+}
+
+func (m *Master) write(b []byte, addr *net.UDPAddr) error {
+	if _, err := m.conn.WriteToUDP(b, addr); err != nil {
+		return err
+	}
+	if m.tap != nil {
+		m.tap(Sent, addr, b)
+	}
+	return nil
+}
+
+func (m *Master) nak(id []byte, addr *net.UDPAddr) {
+	if err := m.write(append(MasterNAK, id...), addr); err != nil {
+		m.logger().Error("NAK failed", "addr", addr, "error", err)
+	}
+}
+
+// handle applies the injected faults before the datagram is processed.
+func (m *Master) handle(addr *net.UDPAddr, data []byte) {
+	kind, _, _ := ClassifyPacket(data)
+
+	m.mutex.Lock()
+	if n := m.drop[kind]; n != 0 {
+		if n > 0 {
+			m.drop[kind] = n - 1
+		}
+		m.mutex.Unlock()
+		return
+	}
+	var (
+		refuse = m.refuse[kind]
+		delay  = m.delay[kind]
+	)
+	m.mutex.Unlock()
+
+	if delay > 0 {
+		// The read buffer is reused
+		data = append([]byte{}, data...)
+		time.AfterFunc(delay, func() { m.process(addr, data, refuse) })
+		return
+	}
+	m.process(addr, data, refuse)
+}
+
+func (m *Master) process(addr *net.UDPAddr, data []byte, refuse bool) {
+	kind, payload, _ := ClassifyPacket(data)
+	if kind == PacketTypeDMRData {
+		m.handleData(addr, data)
+		return
+	}
+
+	var expected bool
+	switch kind {
+	case PacketTypeRepeaterLogin, PacketTypeRepeaterKey, PacketTypeRepeaterClosing,
+		PacketTypeRepeaterConfig, PacketTypeRepeaterOptions, PacketTypeMasterPing:
+		expected = true
+	}
+	// The configuration starts with the callsign, followed by the ID
+	var offset int
+	if kind == PacketTypeRepeaterConfig {
+		offset = 8
+	}
+	if !expected || len(payload) < offset+8 {
+		m.logger().Debug("ignored unexpected packet", "addr", addr, "data", hex.EncodeToString(data))
+		return
+	}
+	var id = payload[offset : offset+8]
+
+	repeaterID, err := strconv.ParseUint(string(id), 16, 32)
+	if err != nil {
+		m.logger().Warn("invalid repeater ID (ignored)", "addr", addr, "id", string(id))
+		return
+	}
+	// Reply with the ID as the repeater expects it, the configuration uses lower case
+	id = packRepeaterID(uint32(repeaterID))
+
+	if refuse {
+		m.mutex.Lock()
+		var reason = m.reason
+		m.mutex.Unlock()
+		var nak = append(MasterNAK, id...)
+		if reason != NAKReasonNone {
+			nak = append(nak, byte(reason))
+		}
+		if err := m.write(nak, addr); err != nil {
+			m.logger().Error("NAK failed", "addr", addr, "error", err)
+		}
+		return
+	}
+
+	m.mutex.Lock()
+	key, known := m.keys[uint32(repeaterID)]
+	r, ok := m.repeaters[uint32(repeaterID)]
+	if ok && r.addr.String() != addr.String() && kind != PacketTypeRepeaterLogin {
+		// Only a new login may move a repeater to another address
+		m.mutex.Unlock()
+		m.logger().Warn("repeater sent packet from another address (ignored)", "repeater", repeaterID, "addr", addr)
+		return
+	}
+	m.mutex.Unlock()
+	if !known && m.KeyFunc != nil {
+		key = m.KeyFunc(uint32(repeaterID))
+		known = len(key) > 0 || m.NoAuth
+	}
+
+	switch kind {
+	case PacketTypeRepeaterLogin:
+		if m.conflict(r, addr) {
+			m.logger().Warn("repeater login refused; ID linked from another address", "repeater", repeaterID, "addr", addr, "linked_addr", r.addr)
+			if err := m.write(append(append(MasterNAK, id...), byte(NAKReasonIDConflict)), addr); err != nil {
+				m.logger().Error("NAK failed", "addr", addr, "error", err)
+			}
+			return
+		}
+		if m.NoAuth {
+			m.mutex.Lock()
+			m.add(&masterRepeater{
+				id:         id,
+				repeaterID: uint32(repeaterID),
+				addr:       addr,
+				status:     AuthBegin,
+				keyed:      true,
+				last:       time.Now(),
+			})
+			m.mutex.Unlock()
+			m.write(append(MasterACK, id...), addr)
+			return
+		}
+		if !known {
+			m.logger().Warn("unknown repeater tried to log in", "repeater", repeaterID, "addr", addr)
+			m.nak(id, addr)
+			return
+		}
+
+		nonce := make([]byte, 4)
+		if _, err := rand.Read(nonce); err != nil {
+			m.logger().Error("nonce generation failed", "repeater", repeaterID, "error", err)
+			m.nak(id, addr)
+			return
+		}
+		hash := sha256.New()
+		hash.Write(nonce)
+		hash.Write(key)
+
+		m.mutex.Lock()
+		m.add(&masterRepeater{
+			id:         id,
+			repeaterID: uint32(repeaterID),
+			addr:       addr,
+			status:     AuthBegin,
+			token:      []byte(hex.EncodeToString(hash.Sum(nil))),
+			last:       time.Now(),
+		})
+		m.mutex.Unlock()
+		m.write(append(append(MasterACK, id...), nonce...), addr)
+
+	case PacketTypeRepeaterKey:
+		m.mutex.Lock()
+		var valid = ok && r.status == AuthBegin && r.token != nil && subtle.ConstantTimeCompare(payload[8:], r.token) == 1
+		if valid {
+			r.keyed = true
+			r.last = time.Now()
+		} else if ok {
+			m.remove(uint32(repeaterID))
+		}
+		m.mutex.Unlock()
+
+		if !valid {
+			m.logger().Error("repeater sent invalid key challenge token", "repeater", repeaterID, "addr", addr)
+			m.nak(id, addr)
+			return
+		}
+		m.write(append(MasterACK, id...), addr)
+
+	case PacketTypeRepeaterConfig:
+		config, err := ParseRepeaterConfiguration(data)
+		m.mutex.Lock()
+		if err != nil || !ok || !r.keyed {
+			m.mutex.Unlock()
+			m.logger().Error("repeater sent invalid configuration", "repeater", repeaterID, "addr", addr, "error", err)
+			m.nak(id, addr)
+			return
+		}
+		var registered = r.status == AuthDone
+		r.config = config
+		r.status = AuthDone
+		r.last = time.Now()
+		m.mutex.Unlock()
+
+		m.logger().Info("repeater logged in", "repeater", repeaterID, "addr", addr, "callsign", config.Callsign)
+		m.write(append(MasterACK, id...), addr)
+		if !registered && m.OnRegister != nil {
+			m.OnRegister(uint32(repeaterID), config)
+		}
+
+	case PacketTypeRepeaterOptions:
+		m.mutex.Lock()
+		var (
+			valid   = ok && r.status == AuthDone
+			options = string(bytes.TrimRight(payload[8:], "\x00"))
+		)
+		if valid {
+			r.options = options
+			r.last = time.Now()
+		}
+		m.mutex.Unlock()
+		if !valid {
+			m.nak(id, addr)
+			return
+		}
+
+		m.logger().Info("repeater sent options", "repeater", repeaterID, "addr", addr, "options", options)
+		m.write(append(MasterACK, id...), addr)
+		if m.OnOptions != nil {
+			m.OnOptions(uint32(repeaterID), options)
+		}
+
+	case PacketTypeMasterPing:
+		m.mutex.Lock()
+		var valid = ok && r.status == AuthDone
+		if valid {
+			r.last = time.Now()
+		}
+		m.mutex.Unlock()
+		if !valid {
+			m.nak(id, addr)
+			return
+		}
+		m.write(append(RepeaterPong, id...), addr)
+
+	case PacketTypeRepeaterClosing:
+		if !ok {
+			return
+		}
+		m.mutex.Lock()
+		m.remove(uint32(repeaterID))
+		var registered = r.status == AuthDone
+		m.mutex.Unlock()
+
+		m.logger().Info("repeater closed link", "repeater", repeaterID, "addr", addr)
+		if registered && m.OnDeregister != nil {
+			m.OnDeregister(uint32(repeaterID))
+		}
+	}
+}
+
+// conflict returns true if the repeater is logged in from another address
+// than addr and didn't time out, a login from addr then uses the same ID.
+func (m *Master) conflict(r *masterRepeater, addr *net.UDPAddr) bool {
+	if r == nil {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return r.status == AuthDone && r.addr.String() != addr.String() && time.Since(r.last) <= m.timeout(r.repeaterID)
+}
+
+func (m *Master) handleData(addr *net.UDPAddr, data []byte) {
+	p, err := ParseData(data)
+	if err != nil {
+		m.logger().Warn("invalid DMR data (ignored)", "addr", addr, "error", err)
+		return
+	}
+
+	m.mutex.Lock()
+	var (
+		found, ok  = m.addrs[addr.String()]
+		valid      = ok && found.status == AuthDone
+		repeaterID uint32
+	)
+	if valid {
+		repeaterID = found.repeaterID
+		found.last = time.Now()
+	}
+	m.mutex.Unlock()
+
+	if !valid {
+		// Ask the repeater to log in again
+		if ok {
+			m.nak(found.id, addr)
+		}
+		return
+	}
+
+	p.RepeaterID = repeaterID
+	if m.OnPacket != nil {
+		m.OnPacket(repeaterID, p)
+	}
+}
+
+// expire deregisters repeaters that didn't send anything for their timeout.
+func (m *Master) expire(stop <-chan struct{}) {
+	for {
+		// Check as often as the shortest timeout requires
+		m.mutex.Lock()
+		var interval = m.defaultTimeout()
+		for _, timeout := range m.timeouts {
+			if timeout < interval {
+				interval = timeout
+			}
+		}
+		m.mutex.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval / 4):
+		}
+
+		var (
+			now     = time.Now()
+			expired []uint32
+		)
+		m.mutex.Lock()
+		for id, r := range m.repeaters {
+			if now.Sub(r.last) > m.timeout(id) {
+				m.remove(id)
+				if r.status == AuthDone {
+					expired = append(expired, id)
+				}
+			}
+		}
+		m.mutex.Unlock()
+
+		for _, id := range expired {
+			m.logger().Error("repeater timed out", "repeater", id)
+			if m.OnDeregister != nil {
+				m.OnDeregister(id)
+			}
+		}
+	}
+}
@@ -0,0 +1,617 @@
+package homebrew
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func testMaster(t *testing.T) *Master {
+	m, err := NewMaster(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("new master failed: %v", err)
+	}
+	return m
+}
+
+func TestMaster(t *testing.T) {
+	var (
+		m          = testMaster(t)
+		registered = make(chan *RepeaterConfiguration, 1)
+		closed     = make(chan uint32, 1)
+		received   = make(chan *dmr.Packet, 1)
+		sent       = make(chan *dmr.Packet, 1)
+	)
+	defer m.Close()
+	m.OnRegister = func(id uint32, config *RepeaterConfiguration) { registered <- config }
+	m.OnDeregister = func(id uint32) { closed <- id }
+	m.OnPacket = func(id uint32, p *dmr.Packet) {
+		if id == 2042214 {
+			received <- p
+		}
+	}
+	if err := m.AddRepeater(2042214, []byte("passw0rd")); err != nil {
+		t.Fatalf("add repeater failed: %v", err)
+	}
+	go m.ListenAndServe()
+
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		sent <- p
+		return nil
+	})
+	go h.ListenAndServe()
+
+	if err := h.Link(&Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	select {
+	case config := <-registered:
+		if config.Callsign != "PD0MZ" || config.ID != 2042214 || config.ColorCode != 1 {
+			t.Fatalf("unexpected configuration %+v", config)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not log in")
+	}
+	if ids := m.Repeaters(); len(ids) != 1 || ids[0] != 2042214 {
+		t.Fatalf("expected repeater 2042214, got %v", ids)
+	}
+
+	var p = &dmr.Packet{
+		SrcID:    2042214,
+		DstID:    204,
+		StreamID: 0x1234,
+		Data:     bytes.Repeat([]byte{0x55}, 33),
+	}
+	if err := h.Send(p); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got.SrcID != p.SrcID || got.StreamID != p.StreamID || got.RepeaterID != 2042214 {
+			t.Fatalf("unexpected packet %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("master did not receive packet")
+	}
+
+	if err := m.SendTo(2042214, p); err != nil {
+		t.Fatalf("send to failed: %v", err)
+	}
+	select {
+	case got := <-sent:
+		if got.DstID != p.DstID || !bytes.Equal(got.Data, p.Data) {
+			t.Fatalf("unexpected packet %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not receive packet")
+	}
+	if err := m.SendTo(2043044, p); err == nil {
+		t.Fatal("send to unknown repeater succeeded")
+	}
+
+	if err := h.WriteToPeerWithID(append(RepeaterClosing, h.id...), 1); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	select {
+	case id := <-closed:
+		if id != 2042214 {
+			t.Fatalf("expected repeater 2042214 to close, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("repeater was not deregistered")
+	}
+}
+
+func TestMasterIPv6(t *testing.T) {
+	var loopback = &net.UDPAddr{IP: net.IPv6loopback}
+	m, err := NewMaster(loopback)
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	defer m.Close()
+	var registered = make(chan uint32, 1)
+	m.OnRegister = func(id uint32, _ *RepeaterConfiguration) { registered <- id }
+	if err := m.AddRepeater(2042214, []byte("passw0rd")); err != nil {
+		t.Fatalf("add repeater failed: %v", err)
+	}
+	go m.ListenAndServe()
+
+	h, err := New(&RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}, loopback)
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	defer h.Close()
+	go h.ListenAndServe()
+
+	var host = m.Addr().String()
+	if err := h.Link(&Peer{ID: 1, Host: host, AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case id := <-registered:
+		if id != 2042214 {
+			t.Fatalf("expected repeater 2042214, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("repeater did not log in to %s", host)
+	}
+}
+
+func TestMasterRefused(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+	m.AddRepeater(2042214, []byte("passw0rd"))
+	go m.ListenAndServe()
+
+	conn, err := net.DialUDP("udp", nil, m.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var reply = make([]byte, 64)
+	for _, test := range []struct {
+		Send []byte
+		Want []byte
+	}{
+		{append(RepeaterLogin, packRepeaterID(2043044)...), append(MasterNAK, packRepeaterID(2043044)...)},
+		{append(MasterPing, packRepeaterID(2042214)...), append(MasterNAK, packRepeaterID(2042214)...)},
+		{append(append(RepeaterKey, packRepeaterID(2042214)...), bytes.Repeat([]byte{'0'}, 64)...), append(MasterNAK, packRepeaterID(2042214)...)},
+	} {
+		conn.Write(test.Send)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(reply)
+		if err != nil {
+			t.Fatalf("%s: read failed: %v", test.Send[:4], err)
+		}
+		if !bytes.Equal(reply[:n], test.Want) {
+			t.Fatalf("%s: expected %q, got %q", test.Send[:4], test.Want, reply[:n])
+		}
+	}
+}
+
+func TestMasterFaults(t *testing.T) {
+	var (
+		m      = testMaster(t)
+		tapped = make(chan Direction, 16)
+	)
+	defer m.Close()
+	m.KeyFunc = func(id uint32) []byte {
+		if id == 2042214 {
+			return []byte("passw0rd")
+		}
+		return nil
+	}
+	m.SetTap(func(direction Direction, _ *net.UDPAddr, _ []byte) { tapped <- direction })
+	m.Refuse(PacketTypeRepeaterLogin, true)
+	m.SetNAKReason(NAKReasonIDConflict)
+	m.Drop(PacketTypeMasterPing, 1)
+	go m.ListenAndServe()
+
+	conn, err := net.DialUDP("udp", nil, m.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var (
+		reply   = make([]byte, 64)
+		request = func(send []byte, timeout time.Duration) []byte {
+			conn.Write(send)
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			n, err := conn.Read(reply)
+			if err != nil {
+				return nil
+			}
+			return reply[:n]
+		}
+		id = packRepeaterID(2042214)
+	)
+
+	// Refused logins are NAKed with the reason
+	if got := request(append(RepeaterLogin, id...), time.Second); !bytes.Equal(got, append(append(MasterNAK, id...), byte(NAKReasonIDConflict))) {
+		t.Fatalf("expected NAK with reason, got %q", got)
+	}
+	m.Refuse(PacketTypeRepeaterLogin, false)
+
+	// The key comes from KeyFunc, unknown repeaters are refused
+	if got := request(append(RepeaterLogin, id...), time.Second); !bytes.HasPrefix(got, append(MasterACK, id...)) || len(got) != len(MasterACK)+len(id)+4 {
+		t.Fatalf("expected ACK with nonce, got %q", got)
+	}
+	if got := request(append(RepeaterLogin, packRepeaterID(2043044)...), time.Second); !bytes.Equal(got, append(MasterNAK, packRepeaterID(2043044)...)) {
+		t.Fatalf("expected NAK, got %q", got)
+	}
+
+	// Dropped packets are not answered, delayed ones late
+	if got := request(append(MasterPing, id...), time.Millisecond*100); got != nil {
+		t.Fatalf("expected no reply to a dropped ping, got %q", got)
+	}
+	m.Delay(PacketTypeMasterPing, time.Millisecond*50)
+	var start = time.Now()
+	if got := request(append(MasterPing, id...), time.Second); !bytes.Equal(got, append(MasterNAK, id...)) {
+		t.Fatalf("expected NAK, got %q", got)
+	}
+	if time.Since(start) < time.Millisecond*50 {
+		t.Fatalf("reply not delayed, got it after %s", time.Since(start))
+	}
+
+	// The tap sees the dropped ping too, 5 received and 4 sent
+	var counts [2]int
+	for len(tapped) > 0 {
+		counts[<-tapped]++
+	}
+	if counts[Received] != 5 || counts[Sent] != 4 {
+		t.Fatalf("expected 5 received and 4 sent datagrams tapped, got %v", counts)
+	}
+}
+
+func TestMasterIDConflict(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+	var registered = make(chan uint32, 2)
+	m.OnRegister = func(id uint32, _ *RepeaterConfiguration) { registered <- id }
+	m.AddRepeater(2042214, []byte("passw0rd"))
+	go m.ListenAndServe()
+
+	var links [2]*Homebrew
+	for i := range links {
+		links[i] = testHomebrew(t)
+		defer links[i].Close()
+		go links[i].ListenAndServe()
+	}
+	var conflicts = make(chan *Peer, 1)
+	links[1].OnIDConflict = func(peer *Peer) { conflicts <- peer }
+
+	if err := links[0].Link(&Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not log in")
+	}
+
+	// The second repeater with the same ID is refused, the first stays linked
+	var peer = &Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}
+	if err := links[1].Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case p := <-conflicts:
+		if p != peer {
+			t.Fatalf("expected conflict on peer %d, got %d", peer.ID, p.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ID conflict not detected")
+	}
+	switch s := links[1].Stats(); {
+	case s.LoginFailures != 1:
+		t.Fatalf("expected 1 login failure, got %d", s.LoginFailures)
+	case peer.status() != AuthFailed:
+		t.Fatalf("expected status failed, got %d", peer.status())
+	case len(registered) != 0:
+		t.Fatal("second repeater registered")
+	}
+	if ids := m.Repeaters(); len(ids) != 1 || links[0].Stats().Peers[0].Status != AuthDone {
+		t.Fatalf("expected first repeater to stay linked, got %v", ids)
+	}
+
+	// A plain NAK isn't a conflict
+	if reason := links[1].parseNAKReason(packRepeaterID(2042214)); reason != NAKReasonNone {
+		t.Fatalf("expected no reason, got %s", reason)
+	}
+}
+
+func TestMasterAuth(t *testing.T) {
+	for _, test := range []struct {
+		Name       string
+		MasterKey  []byte
+		PeerKey    []byte
+		NoAuth     bool
+		PeerNoAuth bool
+		Login      bool
+	}{
+		{"key", []byte("passw0rd"), []byte("passw0rd"), false, false, true},
+		{"no auth", nil, nil, true, true, true},
+		{"no auth with key", nil, []byte("passw0rd"), true, false, true},
+		{"wrong key", []byte("passw0rd"), []byte("password"), false, false, false},
+		{"missing key", []byte("passw0rd"), nil, false, true, false},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			var (
+				m          = testMaster(t)
+				registered = make(chan uint32, 1)
+			)
+			defer m.Close()
+			m.NoAuth = test.NoAuth
+			m.OnRegister = func(id uint32, _ *RepeaterConfiguration) { registered <- id }
+			if !test.NoAuth {
+				m.AddRepeater(2042214, test.MasterKey)
+			}
+			go m.ListenAndServe()
+
+			h := testHomebrew(t)
+			defer h.Close()
+			go h.ListenAndServe()
+			var peer = &Peer{ID: 1, Addr: m.Addr(), AuthKey: test.PeerKey, NoAuth: test.PeerNoAuth, UnlinkOnAuthFailure: true}
+			if err := h.Link(peer); err != nil {
+				t.Fatalf("link failed: %v", err)
+			}
+
+			select {
+			case id := <-registered:
+				if !test.Login {
+					t.Fatalf("repeater %d logged in", id)
+				}
+			case <-time.After(time.Millisecond * 250):
+				if test.Login {
+					t.Fatal("repeater did not log in")
+				}
+			}
+			if s := h.Stats(); !test.Login && s.LoginFailures == 0 {
+				t.Fatal("expected a login failure")
+			}
+		})
+	}
+
+	// Empty keys are only accepted with NoAuth
+	m := testMaster(t)
+	defer m.Close()
+	if err := m.AddRepeater(2042214, nil); err == nil {
+		t.Fatal("add repeater with empty key succeeded")
+	}
+	h := testHomebrew(t)
+	defer h.Close()
+	if err := h.Link(&Peer{ID: 1, Addr: m.Addr()}); err == nil {
+		t.Fatal("link with empty key succeeded")
+	}
+}
+
+func TestMasterTimeout(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+	m.Timeout = time.Millisecond * 40
+
+	var closed = make(chan uint32, 2)
+	m.OnDeregister = func(id uint32) { closed <- id }
+	// Repeater 2043044 has a timeout of its own, it times out first
+	m.SetRepeaterTimeout(2043044, time.Millisecond*10)
+	for i, id := range []uint32{2042214, 2043044} {
+		m.add(&masterRepeater{
+			id:         packRepeaterID(id),
+			repeaterID: id,
+			addr:       &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9 + i},
+			status:     AuthDone,
+			last:       time.Now(),
+		})
+	}
+	go m.ListenAndServe()
+
+	for _, want := range []uint32{2043044, 2042214} {
+		select {
+		case id := <-closed:
+			if id != want {
+				t.Fatalf("expected repeater %d to time out, got %d", want, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("repeater %d did not time out", want)
+		}
+	}
+	if ids := m.Repeaters(); len(ids) != 0 {
+		t.Fatalf("expected no repeaters, got %v", ids)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.addrs) != 0 {
+		t.Fatalf("expected empty address index, got %d entries", len(m.addrs))
+	}
+}
+
+func TestMasterAddRepeater(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+	if err := m.AddRepeater(0, []byte("passw0rd")); err == nil {
+		t.Fatal("add repeater with ID 0 succeeded")
+	}
+}
+
+func TestMasterAddressIndex(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+
+	var (
+		addr  = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+		first = &masterRepeater{repeaterID: 2042214, addr: addr, status: AuthDone}
+		other = &masterRepeater{repeaterID: 2043044, addr: addr, status: AuthDone}
+		moved = &masterRepeater{repeaterID: 2042214, addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10}, status: AuthDone}
+	)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Another ID from the same address takes over the address
+	m.add(first)
+	m.add(other)
+	if m.addrs[addr.String()] != other {
+		t.Fatal("expected address to map to the last login")
+	}
+	// The first ID moves, the address stays with the other ID
+	m.add(moved)
+	switch {
+	case m.addrs[addr.String()] != other:
+		t.Fatal("move removed the address of another repeater")
+	case m.addrs[moved.addr.String()] != moved:
+		t.Fatal("expected new address to be indexed")
+	}
+	m.remove(2043044)
+	m.remove(2042214)
+	if len(m.addrs) != 0 {
+		t.Fatalf("expected empty address index, got %d entries", len(m.addrs))
+	}
+}
+
+func TestParseRepeaterConfiguration(t *testing.T) {
+	r := &RepeaterConfiguration{
+		Callsign:    "PD0MZ",
+		ID:          2042214,
+		RXFreq:      438800000,
+		TXFreq:      431200000,
+		TXPower:     25,
+		ColorCode:   1,
+		Latitude:    52.3676,
+		Longitude:   -4.9041,
+		Height:      12,
+		Location:    "Amsterdam",
+		Description: "Test",
+		URL:         "https://example.org/",
+	}
+	got, err := ParseRepeaterConfiguration(r.Bytes())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got.SoftwareID != dmr.SoftwareID || got.PackageID != dmr.PackageID {
+		t.Fatalf("unexpected software %q, package %q", got.SoftwareID, got.PackageID)
+	}
+	got.SoftwareID, got.PackageID = "", ""
+	if *got != *r {
+		t.Fatalf("expected %+v, got %+v", r, got)
+	}
+
+	if _, err := ParseRepeaterConfiguration(r.Bytes()[:100]); err == nil {
+		t.Fatal("parse of short configuration succeeded")
+	}
+	var invalid = r.Bytes()
+	copy(invalid[12:20], "zzzzzzzz")
+	if _, err := ParseRepeaterConfiguration(invalid); err == nil {
+		t.Fatal("parse of invalid ID succeeded")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var (
+		m       = testMaster(t)
+		options = make(chan string, 2)
+	)
+	defer m.Close()
+	m.OnOptions = func(id uint32, o string) { options <- o }
+	m.AddRepeater(2042214, []byte("passw0rd"))
+	go m.ListenAndServe()
+
+	h := testHomebrew(t)
+	defer h.Close()
+	h.Options = "TS2_1=91"
+	go h.ListenAndServe()
+
+	var peer = &Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}
+	if err := h.Link(peer); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	for _, want := range []string{"TS2_1=91", "TS2_1=91;TS2_2=2621"} {
+		select {
+		case got := <-options:
+			if got != want {
+				t.Fatalf("expected options %q, got %q", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("options %q not received", want)
+		}
+		if want == "TS2_1=91" {
+			if err := h.SetOptions("TS2_1=91;TS2_2=2621"); err != nil {
+				t.Fatalf("set options failed: %v", err)
+			}
+		}
+	}
+	if got := m.Options(2042214); got != "TS2_1=91;TS2_2=2621" {
+		t.Fatalf("expected master to keep options, got %q", got)
+	}
+
+	// A refused option doesn't drop the link
+	h.mutex.Lock()
+	peer.optionsSent = true
+	h.mutex.Unlock()
+	if err := h.handle(m.Addr(), append(MasterNAK, h.id...)); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	if peer.Status != AuthDone || peer.optionsSent {
+		t.Fatalf("expected link to stay up after options NAK, status %d", peer.Status)
+	}
+}
+
+// TestMasterConcurrent exchanges frames in both directions while the stats
+// are read and the link closes, run it with -race.
+func TestMasterConcurrent(t *testing.T) {
+	var (
+		m          = testMaster(t)
+		registered = make(chan *RepeaterConfiguration, 1)
+		received   = make(chan *dmr.Packet, 512)
+	)
+	defer m.Close()
+	m.OnRegister = func(id uint32, config *RepeaterConfiguration) { registered <- config }
+	if err := m.AddRepeater(2042214, []byte("passw0rd")); err != nil {
+		t.Fatalf("add repeater failed: %v", err)
+	}
+	go m.ListenAndServe()
+
+	h := testHomebrew(t)
+	h.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		received <- p
+		return nil
+	})
+	go h.ListenAndServe()
+
+	if err := h.Link(&Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not log in")
+	}
+
+	var (
+		frames = 300
+		done   = make(chan bool)
+	)
+	go func() {
+		defer close(done)
+		for i := 0; i < frames; i++ {
+			h.Stats()
+			h.ActiveMaster(1)
+			h.Active()
+		}
+	}()
+	for i := 0; i < frames; i++ {
+		var p = &dmr.Packet{
+			SrcID:    2042214,
+			DstID:    204,
+			StreamID: 0x1234,
+			Sequence: uint8(i),
+			Data:     bytes.Repeat([]byte{0x55}, 33),
+		}
+		if err := h.Send(p); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+		if err := m.SendTo(2042214, p); err != nil {
+			t.Fatalf("send to failed: %v", err)
+		}
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("repeater did not receive packets")
+	}
+	<-done
+
+	go h.Stats()
+	if err := h.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if h.Active() {
+		t.Fatal("link still active after close")
+	}
+}
@@ -0,0 +1,109 @@
+// Package metrics exposes Homebrew link statistics as Prometheus metrics
+package metrics
+
+import (
+	"github.com/pd0mz/go-dmr/homebrew"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	Namespace = "dmr"
+	Subsystem = "homebrew"
+)
+
+// StatsSource is implemented by homebrew.Homebrew.
+type StatsSource interface {
+	Stats() homebrew.Stats
+}
+
+var _ StatsSource = (*homebrew.Homebrew)(nil)
+
+var counters = []struct {
+	name, help string
+	value      func(homebrew.Stats) uint64
+}{
+	{"bytes_sent_total", "Number of bytes sent to peers.", func(s homebrew.Stats) uint64 { return s.BytesSent }},
+	{"bytes_received_total", "Number of bytes received from peers.", func(s homebrew.Stats) uint64 { return s.BytesReceived }},
+	{"frames_sent_total", "Number of DMR data frames sent to peers.", func(s homebrew.Stats) uint64 { return s.FramesSent }},
+	{"frames_received_total", "Number of DMR data frames received from peers.", func(s homebrew.Stats) uint64 { return s.FramesReceived }},
+	{"keepalives_sent_total", "Number of keepalive pings sent to peers.", func(s homebrew.Stats) uint64 { return s.KeepalivesSent }},
+	{"keepalives_acked_total", "Number of keepalive pings acknowledged by peers.", func(s homebrew.Stats) uint64 { return s.KeepalivesAcked }},
+	{"login_attempts_total", "Number of login attempts sent to peers.", func(s homebrew.Stats) uint64 { return s.LoginAttempts }},
+	{"login_failures_total", "Number of logins refused or not answered by peers.", func(s homebrew.Stats) uint64 { return s.LoginFailures }},
+	{"calls_observed_total", "Number of streams observed.", func(s homebrew.Stats) uint64 { return s.CallsObserved }},
+	{"slot1_calls_total", "Number of streams observed on timeslot 1.", func(s homebrew.Stats) uint64 { return s.Slot1Calls }},
+	{"slot2_calls_total", "Number of streams observed on timeslot 2.", func(s homebrew.Stats) uint64 { return s.Slot2Calls }},
+	{"packets_dropped_total", "Number of packets dropped from unknown addresses.", func(s homebrew.Stats) uint64 { return s.PacketsDropped }},
+	{"frames_dropped_total", "Number of received DMR data frames dropped because the queue was full.", func(s homebrew.Stats) uint64 { return s.FramesDropped }},
+	{"frames_accepted_total", "Number of received DMR data frames passed by the accept filter.", func(s homebrew.Stats) uint64 { return s.FramesAccepted }},
+	{"frames_filtered_total", "Number of received DMR data frames rejected by the accept filter.", func(s homebrew.Stats) uint64 { return s.FramesFiltered }},
+	{"slot_contentions_total", "Number of received DMR data frames for a timeslot receiving another stream.", func(s homebrew.Stats) uint64 { return s.SlotContentions }},
+	{"frames_poor_total", "Number of received DMR data frames dropped for a bit error rate above the maximum.", func(s homebrew.Stats) uint64 { return s.FramesPoor }},
+}
+
+var gauges = []struct {
+	name, help string
+	value      func(homebrew.Stats) float64
+}{
+	{"keepalive_rtt_seconds", "Round trip time of the last acknowledged keepalive ping.", func(s homebrew.Stats) float64 { return s.KeepaliveRTT.Seconds() }},
+}
+
+// Collectors returns the collectors for all Stats fields, under the
+// dmr_homebrew_ namespace. Each collector takes a Stats snapshot when
+// collected.
+func Collectors(src StatsSource, labels prometheus.Labels) []prometheus.Collector {
+	var cs = make([]prometheus.Collector, 0, len(counters)+len(gauges))
+	for _, c := range counters {
+		var value = c.value
+		cs = append(cs, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   Namespace,
+			Subsystem:   Subsystem,
+			Name:        c.name,
+			Help:        c.help,
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(value(src.Stats()))
+		}))
+	}
+	for _, g := range gauges {
+		var value = g.value
+		cs = append(cs, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   Namespace,
+			Subsystem:   Subsystem,
+			Name:        g.name,
+			Help:        g.help,
+			ConstLabels: labels,
+		}, func() float64 {
+			return value(src.Stats())
+		}))
+	}
+	return cs
+}
+
+// RegisterMetrics registers the link statistics with reg. If any of the
+// collectors fails to register, the already registered ones are unregistered.
+func RegisterMetrics(reg prometheus.Registerer, src StatsSource) error {
+	return RegisterMetricsWithLabels(reg, src, nil)
+}
+
+// RegisterMetricsWithLabels is like RegisterMetrics, with constant labels
+// added to each metric, for example to tell multiple links apart.
+func RegisterMetricsWithLabels(reg prometheus.Registerer, src StatsSource, labels prometheus.Labels) error {
+	var cs = Collectors(src, labels)
+	for i, c := range cs {
+		if err := reg.Register(c); err != nil {
+			for _, r := range cs[:i] {
+				reg.Unregister(r)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegisterMetrics is like RegisterMetrics, but panics on error.
+func MustRegisterMetrics(reg prometheus.Registerer, src StatsSource) {
+	if err := RegisterMetrics(reg, src); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pd0mz/go-dmr/homebrew"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type testStats homebrew.Stats
+
+func (s testStats) Stats() homebrew.Stats { return homebrew.Stats(s) }
+
+type testRegisterer struct {
+	collectors []prometheus.Collector
+	limit      int
+}
+
+func (r *testRegisterer) Register(c prometheus.Collector) error {
+	if len(r.collectors) == r.limit {
+		return errors.New("registry full")
+	}
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+func (r *testRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *testRegisterer) Unregister(c prometheus.Collector) bool {
+	for i, rc := range r.collectors {
+		if rc == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	var reg = &testRegisterer{limit: -1}
+	if err := RegisterMetrics(reg, testStats{BytesSent: 42}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if len(reg.collectors) != len(counters)+len(gauges) {
+		t.Fatalf("expected %d collectors, got %d", len(counters)+len(gauges), len(reg.collectors))
+	}
+
+	var ch = make(chan *prometheus.Desc, 1)
+	reg.collectors[0].Describe(ch)
+	if desc := (<-ch).String(); !strings.Contains(desc, "dmr_homebrew_bytes_sent_total") {
+		t.Fatalf("expected dmr_homebrew_bytes_sent_total, got %s", desc)
+	}
+
+	// Failing registration must not leave any collectors behind
+	reg = &testRegisterer{limit: 3}
+	if err := RegisterMetrics(reg, testStats{}); err == nil {
+		t.Fatal("expected register to fail")
+	}
+	if len(reg.collectors) != 0 {
+		t.Fatalf("expected no collectors after failure, got %d", len(reg.collectors))
+	}
+}
@@ -0,0 +1,302 @@
+package homebrew
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// VoiceBurstInterval is the time between the frames of a voice call, a voice
+// burst carries three 20 ms AMBE+2 frames.
+const VoiceBurstInterval = time.Millisecond * 60
+
+// MaxSilenceBursts is the most silence bursts an OutboundCall sends in place
+// of the voice bursts the application didn't write in time, a superframe.
+const MaxSilenceBursts = 6
+
+// OutboundCall originates a voice call on a link, for playing a recorded or
+// generated call to the network. Start sends the voice LC header,
+// WriteVoiceBurst sends the voice bursts of the call and End sends the
+// terminator. The call takes care of the stream ID, sequence numbers, the
+// data types of the bursts A to F of each superframe, the embedded signalling
+// and the pacing of the frames. If the application underruns, silence bursts
+// fill in for the missed voice bursts. Only one call at a time can be active per
+// timeslot of a link. The methods can be called from several goroutines, End
+// waits for a WriteVoiceBurst in progress.
+type OutboundCall struct {
+	h     *Homebrew
+	mutex *sync.Mutex
+
+	active    bool
+	lc        *dmr.LC
+	timeslot  uint8
+	streamID  uint32
+	sequence  uint8
+	burst     int
+	fragments [][]byte
+	last      time.Time // Time the last frame was sent
+
+	send  func(*dmr.Packet) error
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewOutboundCall returns a call sending on the link h.
+func NewOutboundCall(h *Homebrew) *OutboundCall {
+	return &OutboundCall{
+		h:     h,
+		mutex: &sync.Mutex{},
+		send:  h.Send,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+}
+
+// Start starts a call from src to dst on timeslot 1 or 2, as numbered by
+// Homebrew.Slot, and sends the voice LC header. The call type is
+// dmr.CallTypeGroup or dmr.CallTypePrivate. Start fails if the call was
+// already started, or if another call is active on the timeslot.
+func (c *OutboundCall) Start(src, dst uint32, slot int, callType uint8) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.active {
+		return errors.New("homebrew: call already started")
+	}
+	if slot != 1 && slot != 2 {
+		return fmt.Errorf("homebrew: timeslot %d out of range", slot)
+	}
+	switch callType {
+	case dmr.CallTypeGroup, dmr.CallTypePrivate:
+		break
+	default:
+		return fmt.Errorf("homebrew: call type %d not supported", callType)
+	}
+
+	var lc = &dmr.LC{CallType: callType, DstID: dst, SrcID: src}
+	fragments, err := dmr.BuildEmbeddedLCFragments(lc)
+	if err != nil {
+		return err
+	}
+	var id = make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	if err := c.h.slots[slot-1].start(c); err != nil {
+		return err
+	}
+
+	c.active = true
+	c.lc = lc
+	c.timeslot = uint8(slot - 1)
+	c.streamID = binary.BigEndian.Uint32(id)
+	c.sequence = 0
+	c.burst = 0
+	c.fragments = fragments
+	c.last = time.Time{}
+
+	p, err := c.lcPacket(dmr.VoiceLC)
+	if err == nil {
+		err = c.write(p)
+	}
+	if err != nil {
+		c.release()
+	}
+	return err
+}
+
+// StreamID returns the stream ID of the call, a random number picked by
+// Start.
+func (c *OutboundCall) StreamID() uint32 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.streamID
+}
+
+// WriteVoiceBurst sends the next voice burst of the call, 60 ms after the
+// previous frame. The SYNC bits of the burst are replaced with the voice
+// sync for burst A and with the embedded signalling of the call for the
+// other bursts, the voice bits are sent as is. If the burst is written more
+// than VoiceBurstInterval late, up to MaxSilenceBursts silence bursts are sent
+// first for the missed bursts, so receivers keep the timing of the call.
+func (c *OutboundCall) WriteVoiceBurst(data [33]byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.active {
+		return errors.New("homebrew: call not started")
+	}
+	if err := c.underrun(); err != nil {
+		return err
+	}
+	return c.writeVoiceBurst(data)
+}
+
+// underrun sends a silence burst for every VoiceBurstInterval missed since the
+// last frame, without waiting, as the bursts are overdue. The caller must hold
+// the mutex.
+func (c *OutboundCall) underrun() error {
+	if c.last.IsZero() {
+		return nil
+	}
+	var missed = int(c.now().Sub(c.last)/VoiceBurstInterval) - 1
+	if missed <= 0 {
+		return nil
+	}
+	if missed > MaxSilenceBursts {
+		missed = MaxSilenceBursts
+	}
+
+	bits, err := dmr.SilenceBurst(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedVoice))
+	if err != nil {
+		return err
+	}
+	var silence [33]byte
+	copy(silence[:], dmr.BitsToBytes(bits))
+	for i := 0; i < missed; i++ {
+		var last = c.last
+		if err := c.writeVoiceBurst(silence); err != nil {
+			return err
+		}
+		c.last = last.Add(VoiceBurstInterval)
+	}
+	return nil
+}
+
+// writeVoiceBurst sends the next voice burst of the call. The caller must hold
+// the mutex.
+func (c *OutboundCall) writeVoiceBurst(data [33]byte) error {
+	var p = c.packet(dmr.VoiceBurstA + uint8(c.burst))
+	p.SetData(append([]byte{}, data[:]...))
+	switch c.burst {
+	case 0:
+		p.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedVoice))
+		break
+	default:
+		var (
+			emb      = &dmr.EMB{ColorCode: c.h.Config.ColorCode}
+			fragment = make([]byte, dmr.EMBSignallingLCFragmentBits)
+		)
+		switch c.burst {
+		case 1:
+			emb.LCSS = dmr.FirstFragment
+		case 2, 3:
+			emb.LCSS = dmr.Continuation
+		case 4:
+			emb.LCSS = dmr.LastFragment
+		case 5:
+			emb.LCSS = dmr.SingleFragment // Null embedded LC
+		}
+		if c.burst <= dmr.EmbeddedLCFragments {
+			fragment = c.fragments[c.burst-1]
+		}
+		embBits, err := emb.Bits()
+		if err != nil {
+			return err
+		}
+		sync, err := dmr.BuildSyncBitsFromEMB(embBits, fragment)
+		if err != nil {
+			return err
+		}
+		p.SetSyncBits(sync)
+		break
+	}
+
+	if err := c.write(p); err != nil {
+		return err
+	}
+	c.burst = (c.burst + 1) % 6
+	return nil
+}
+
+// End sends the terminator with LC and ends the call, after which the
+// timeslot is free for another call. The call can be started again.
+func (c *OutboundCall) End() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.active {
+		return errors.New("homebrew: call not started")
+	}
+	defer c.release()
+
+	p, err := c.lcPacket(dmr.TerminatorWithLC)
+	if err != nil {
+		return err
+	}
+	return c.write(p)
+}
+
+// release frees the timeslot. The caller must hold the mutex.
+func (c *OutboundCall) release() {
+	c.h.slots[c.timeslot].stop(c)
+	c.active = false
+}
+
+// packet returns the next frame of the call.
+func (c *OutboundCall) packet(dataType uint8) *dmr.Packet {
+	return &dmr.Packet{
+		Timeslot:   c.timeslot,
+		SrcID:      c.lc.SrcID,
+		DstID:      c.lc.DstID,
+		RepeaterID: c.h.Config.ID,
+		StreamID:   c.streamID,
+		DataType:   dataType,
+		CallType:   c.lc.CallType,
+	}
+}
+
+// lcPacket returns the voice LC header or terminator of the call.
+func (c *OutboundCall) lcPacket(dataType uint8) (*dmr.Packet, error) {
+	var mask = dmr.VoiceLCHeaderMask
+	if dataType == dmr.TerminatorWithLC {
+		mask = dmr.TerminatorWithLCMask
+	}
+	data, err := dmr.BuildFullLC(c.lc, mask)
+	if err != nil {
+		return nil, err
+	}
+	var info = make([]byte, dmr.InfoBits)
+	if err := bptc.Encode(data, info); err != nil {
+		return nil, err
+	}
+	slotType, err := dmr.BuildSlotType(c.h.Config.ColorCode, dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = c.packet(dataType)
+	p.SetInfoBits(info)
+	p.SetSlotTypeBits(slotType)
+	p.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedData))
+	return p, nil
+}
+
+// write sends the frame VoiceBurstInterval after the previous frame, the
+// sequence number increments for every frame sent.
+func (c *OutboundCall) write(p *dmr.Packet) error {
+	var now = c.now()
+	if !c.last.IsZero() {
+		var next = c.last.Add(VoiceBurstInterval)
+		if wait := next.Sub(now); wait > 0 {
+			c.sleep(wait)
+			now = next
+		}
+	}
+	c.last = now
+
+	p.Sequence = c.sequence
+	if err := c.send(p); err != nil {
+		return err
+	}
+	c.h.slots[c.timeslot].sent(c, now)
+	c.sequence++
+	return nil
+}
@@ -0,0 +1,248 @@
+package homebrew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+func TestOutboundCall(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var (
+		sent   []*dmr.Packet
+		clock  = time.Unix(1451736000, 0)
+		sleeps []time.Duration
+		c      = NewOutboundCall(h)
+	)
+	c.send = func(p *dmr.Packet) error {
+		sent = append(sent, p)
+		return nil
+	}
+	c.now = func() time.Time { return clock }
+	c.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		clock = clock.Add(d)
+	}
+
+	if err := c.WriteVoiceBurst([33]byte{}); err == nil {
+		t.Fatal("write before start succeeded")
+	}
+	for _, slot := range []int{0, 3} {
+		if err := c.Start(2042214, 204, slot, dmr.CallTypeGroup); err == nil {
+			t.Fatalf("start on timeslot %d succeeded", slot)
+		}
+	}
+	if err := c.Start(2042214, 204, 2, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if err := c.Start(2042214, 204, 2, dmr.CallTypeGroup); err == nil {
+		t.Fatal("second start succeeded")
+	}
+	if err := NewOutboundCall(h).Start(2042215, 91, 2, dmr.CallTypeGroup); err == nil {
+		t.Fatal("start of concurrent call on the same timeslot succeeded")
+	}
+	var other = NewOutboundCall(h)
+	other.send = c.send
+	if err := other.Start(2042215, 91, 1, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start on the other timeslot failed: %v", err)
+	}
+	other.End()
+	sent = sent[:1]
+
+	var voice [33]byte
+	for i := range voice {
+		voice[i] = 0xa5
+	}
+	for i := 0; i < 7; i++ {
+		if err := c.WriteVoiceBurst(voice); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+	if err := c.End(); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	if err := c.End(); err == nil {
+		t.Fatal("second end succeeded")
+	}
+
+	var dataTypes = []uint8{
+		dmr.VoiceLC,
+		dmr.VoiceBurstA, dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF,
+		dmr.VoiceBurstA,
+		dmr.TerminatorWithLC,
+	}
+	if len(sent) != len(dataTypes) {
+		t.Fatalf("expected %d frames, got %d", len(dataTypes), len(sent))
+	}
+	var (
+		assembler = dmr.NewEmbeddedLCAssembler()
+		embedded  *dmr.LC
+	)
+	for i, p := range sent {
+		switch {
+		case p.DataType != dataTypes[i]:
+			t.Fatalf("frame %d: expected data type %d, got %d", i, dataTypes[i], p.DataType)
+		case p.Sequence != uint8(i):
+			t.Fatalf("frame %d: expected sequence %d, got %d", i, i, p.Sequence)
+		case p.StreamID != c.StreamID():
+			t.Fatalf("frame %d: expected stream %#08x, got %#08x", i, c.StreamID(), p.StreamID)
+		case p.Timeslot != 1 || p.SrcID != 2042214 || p.DstID != 204 || p.CallType != dmr.CallTypeGroup:
+			t.Fatalf("frame %d: unexpected packet %s", i, p)
+		case p.RepeaterID != h.Config.ID:
+			t.Fatalf("frame %d: expected repeater %d, got %d", i, h.Config.ID, p.RepeaterID)
+		}
+
+		switch p.DataType {
+		case dmr.VoiceLC, dmr.TerminatorWithLC:
+			var data = make([]byte, 12)
+			if err := bptc.Decode(p.InfoBits(), data); err != nil {
+				t.Fatalf("frame %d: bptc decode failed: %v", i, err)
+			}
+			break
+		case dmr.VoiceBurstA:
+			if pattern := dmr.SyncPattern(p.SyncBits()); pattern != dmr.SyncPatternBSSourcedVoice {
+				t.Fatalf("frame %d: expected voice sync, got %s", i, dmr.SyncPatternName[pattern])
+			}
+			break
+		default:
+			emb, err := dmr.ParseEMB(p.EMBBits())
+			if err != nil {
+				t.Fatalf("frame %d: parse EMB failed: %v", i, err)
+			}
+			if emb.ColorCode != h.Config.ColorCode {
+				t.Fatalf("frame %d: expected color code %d, got %d", i, h.Config.ColorCode, emb.ColorCode)
+			}
+			fragment, _ := dmr.ParseEmbeddedSignallingLCFromSyncBits(p.SyncBits())
+			lc, err := assembler.AddFragment(emb.LCSS, fragment)
+			if err != nil {
+				t.Fatalf("frame %d: add fragment failed: %v", i, err)
+			}
+			if lc != nil {
+				embedded = lc
+			}
+			break
+		}
+		if p.DataType >= dmr.VoiceBurstA && p.DataType <= dmr.VoiceBurstF {
+			if voice := p.VoiceBits(); voice[0] != 1 || voice[1] != 0 || voice[2] != 1 {
+				t.Fatalf("frame %d: voice bits changed", i)
+			}
+		}
+	}
+	switch {
+	case embedded == nil:
+		t.Fatal("embedded LC not decoded")
+	case embedded.SrcID != 2042214 || embedded.DstID != 204:
+		t.Fatalf("unexpected embedded LC %+v", embedded)
+	}
+
+	if len(sleeps) != len(sent)-1 {
+		t.Fatalf("expected %d waits, got %d", len(sent)-1, len(sleeps))
+	}
+	for i, d := range sleeps {
+		if d != VoiceBurstInterval {
+			t.Fatalf("wait %d: expected %s, got %s", i, VoiceBurstInterval, d)
+		}
+	}
+
+	// The timeslot is free after the terminator.
+	var next = NewOutboundCall(h)
+	next.send = c.send
+	if err := next.Start(2042215, 91, 2, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start after end failed: %v", err)
+	}
+	if next.StreamID() == c.StreamID() {
+		t.Fatal("expected a new stream ID")
+	}
+}
+
+func TestOutboundCallUnderrun(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var (
+		sent   []*dmr.Packet
+		clock  = time.Unix(1451736000, 0)
+		sleeps []time.Duration
+		c      = NewOutboundCall(h)
+	)
+	c.send = func(p *dmr.Packet) error {
+		sent = append(sent, p)
+		return nil
+	}
+	c.now = func() time.Time { return clock }
+	c.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		clock = clock.Add(d)
+	}
+	if err := c.Start(2042214, 204, 1, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	var voice [33]byte
+	for i := range voice {
+		voice[i] = 0xa5
+	}
+	// Two bursts missed, then a long underrun
+	for _, late := range []time.Duration{0, VoiceBurstInterval*3 + time.Millisecond*10, VoiceBurstInterval * 20} {
+		clock = clock.Add(late)
+		if err := c.WriteVoiceBurst(voice); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	var expect = 1 + 1 + 2 + 1 + MaxSilenceBursts + 1
+	if len(sent) != expect {
+		t.Fatalf("expected %d frames, got %d", expect, len(sent))
+	}
+	for i, p := range sent[1:] {
+		var silence = (i >= 1 && i < 3) || (i >= 4 && i < 4+MaxSilenceBursts)
+		switch {
+		case p.DataType != dmr.VoiceBurstA+uint8(i%6):
+			t.Fatalf("frame %d: expected burst %d, got data type %d", i+1, i%6, p.DataType)
+		case p.Sequence != uint8(i+1):
+			t.Fatalf("frame %d: expected sequence %d, got %d", i+1, i+1, p.Sequence)
+		case silence != (p.Data[0] != 0xa5):
+			t.Fatalf("frame %d: expected silence %t, got %x", i+1, silence, p.Data[0])
+		}
+	}
+	if len(sleeps) != 1 {
+		t.Fatalf("expected only the first burst to wait, got waits %v", sleeps)
+	}
+}
+
+// TestOutboundCallConcurrent ends a call while another goroutine writes voice
+// bursts, run with -race.
+func TestOutboundCallConcurrent(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+
+	var c = NewOutboundCall(h)
+	c.send = func(*dmr.Packet) error { return nil }
+	c.sleep = func(time.Duration) {}
+	if err := c.Start(2042214, 204, 2, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for c.WriteVoiceBurst([33]byte{}) == nil {
+		}
+	}()
+	time.Sleep(time.Millisecond * 10)
+	if err := c.End(); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write did not fail after end")
+	}
+	if h.Slot(2).Busy() {
+		t.Fatal("expected slot 2 idle after end")
+	}
+}
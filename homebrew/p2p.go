@@ -0,0 +1,202 @@
+package homebrew
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// P2PLink is a direct link between two repeaters, without a master. One side
+// listens with ListenAndAccept and takes the role of the master in the
+// Homebrew login, the other side connects with Dial. Both sides use the same
+// auth key for the SHA-256 challenge of the login. Once linked, both sides
+// send with SendFrame and receive with the PacketFunc.
+type P2PLink struct {
+	master *Master   // Set on the accepting side
+	link   *Homebrew // Set on the dialing side
+	peerID uint32    // Repeater ID of the dialing side
+
+	mutex *sync.Mutex
+	pf    dmr.PacketFunc
+	done  chan struct{}
+	once  *sync.Once
+}
+
+var _ (dmr.Repeater) = (*P2PLink)(nil)
+
+func newP2PLink() *P2PLink {
+	return &P2PLink{
+		mutex: &sync.Mutex{},
+		done:  make(chan struct{}),
+		once:  &sync.Once{},
+	}
+}
+
+// ListenAndAccept listens on addr and waits until the repeater with peerID
+// logged in with the auth key, or until ctx is done, in which case the socket
+// is closed again.
+func ListenAndAccept(ctx context.Context, addr *net.UDPAddr, peerID uint32, authKey []byte) (*P2PLink, error) {
+	master, err := NewMaster(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := master.AddRepeater(peerID, authKey); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	var (
+		l          = newP2PLink()
+		registered = make(chan struct{})
+		once       = &sync.Once{}
+	)
+	l.master, l.peerID = master, peerID
+	master.OnRegister = func(id uint32, _ *RepeaterConfiguration) {
+		if id == peerID {
+			once.Do(func() { close(registered) })
+		}
+	}
+	master.OnPacket = func(id uint32, p *dmr.Packet) {
+		if id == peerID {
+			l.receive(p)
+		}
+	}
+	go func() {
+		master.ListenAndServe()
+		l.Close()
+	}()
+
+	select {
+	case <-registered:
+		return l, nil
+	case <-l.done:
+		return nil, errors.New("homebrew: link closed before the peer logged in")
+	case <-ctx.Done():
+		l.Close()
+		return nil, fmt.Errorf("homebrew: peer %d did not log in: %v", peerID, ctx.Err())
+	}
+}
+
+// Dial connects to a repeater that is waiting in ListenAndAccept at raddr and
+// logs in with the configuration and auth key. It waits for the login until
+// ctx is done, or at most the LoginTimeout and KeyTimeout of the link.
+func Dial(ctx context.Context, config *RepeaterConfiguration, raddr *net.UDPAddr, authKey []byte) (*P2PLink, error) {
+	if raddr == nil {
+		return nil, errors.New("homebrew: raddr can't be nil")
+	}
+	var laddr = &net.UDPAddr{}
+	if raddr.IP.IsLoopback() {
+		laddr.IP = raddr.IP
+	}
+	link, err := New(config, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		l      = newP2PLink()
+		linked = make(chan struct{})
+		once   = &sync.Once{}
+	)
+	l.link, l.peerID = link, config.ID
+	link.OnLink = func(*Peer) { once.Do(func() { close(linked) }) }
+	link.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+		return l.receive(p)
+	})
+	go func() {
+		link.ListenAndServe()
+		l.Close()
+	}()
+
+	if err := link.Link(&Peer{Addr: raddr, AuthKey: authKey}); err != nil {
+		l.Close()
+		return nil, err
+	}
+	select {
+	case <-linked:
+		return l, nil
+	case <-l.done:
+		return nil, errors.New("homebrew: link closed before login")
+	case <-ctx.Done():
+		l.Close()
+		return nil, fmt.Errorf("homebrew: login to %s failed: %v", raddr, ctx.Err())
+	case <-time.After(link.loginTimeout() + link.keyTimeout()):
+		l.Close()
+		return nil, fmt.Errorf("homebrew: login to %s timed out", raddr)
+	}
+}
+
+func (l *P2PLink) receive(p *dmr.Packet) error {
+	var pf = l.GetPacketFunc()
+	if pf == nil {
+		return nil
+	}
+	return pf(l, p)
+}
+
+// Active returns true if the peer is logged in.
+func (l *P2PLink) Active() bool {
+	if l.master != nil {
+		for _, id := range l.master.Repeaters() {
+			if id == l.peerID {
+				return true
+			}
+		}
+		return false
+	}
+	var peers = l.link.getPeers()
+	return l.link.Active() && len(peers) == 1 && peers[0].status() == AuthDone
+}
+
+// Close closes the link.
+func (l *P2PLink) Close() error {
+	var err error
+	l.once.Do(func() {
+		if l.master != nil {
+			err = l.master.Close()
+		} else {
+			err = l.link.Close()
+		}
+		close(l.done)
+	})
+	return err
+}
+
+// ListenAndServe waits until the link is closed, the link is served since it
+// was set up by ListenAndAccept or Dial.
+func (l *P2PLink) ListenAndServe() error {
+	<-l.done
+	return nil
+}
+
+// Send sends a packet to the peer, see SendFrame.
+func (l *P2PLink) Send(p *dmr.Packet) error {
+	return l.SendFrame(p)
+}
+
+// SendFrame sends a packet to the peer.
+func (l *P2PLink) SendFrame(p *dmr.Packet) error {
+	if l.master != nil {
+		return l.master.SendTo(l.peerID, p)
+	}
+	return l.link.Send(p)
+}
+
+// GetPacketFunc returns the function receiving the packets of the peer.
+func (l *P2PLink) GetPacketFunc() dmr.PacketFunc {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.pf
+}
+
+// SetPacketFunc sets the function receiving the packets of the peer.
+func (l *P2PLink) SetPacketFunc(f dmr.PacketFunc) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.pf = f
+}
@@ -0,0 +1,148 @@
+package homebrew
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestP2PLink(t *testing.T) {
+	// Find a free port for the accepting side
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	var addr = conn.LocalAddr().(*net.UDPAddr)
+	conn.Close()
+
+	type accepted struct {
+		Link *P2PLink
+		Err  error
+	}
+	var accept = make(chan accepted, 1)
+	go func() {
+		l, err := ListenAndAccept(context.Background(), addr, 2042214, []byte("s3cr3t"))
+		accept <- accepted{l, err}
+	}()
+
+	// Wait until the accepting side is listening, so the login isn't lost
+	for i := 0; ; i++ {
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 100 {
+			t.Fatal("accepting side not listening")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	client, err := Dial(context.Background(), &RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}, addr, []byte("s3cr3t"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+
+	var server *P2PLink
+	select {
+	case a := <-accept:
+		if a.Err != nil {
+			t.Fatalf("accept failed: %v", a.Err)
+		}
+		server = a.Link
+	case <-time.After(time.Second):
+		t.Fatal("peer not accepted")
+	}
+	defer server.Close()
+	if !server.Active() || !client.Active() {
+		t.Fatalf("expected active links, got server %t, client %t", server.Active(), client.Active())
+	}
+
+	for _, test := range []struct {
+		Name     string
+		From, To *P2PLink
+	}{
+		{"client to server", client, server},
+		{"server to client", server, client},
+	} {
+		var received = make(chan *dmr.Packet, 1)
+		test.To.SetPacketFunc(func(_ dmr.Repeater, p *dmr.Packet) error {
+			received <- p
+			return nil
+		})
+		var p = &dmr.Packet{
+			SrcID:    2042214,
+			DstID:    2043044,
+			CallType: dmr.CallTypePrivate,
+			StreamID: 0x1234,
+			Data:     bytes.Repeat([]byte{0x5a}, 33),
+		}
+		if err := test.From.SendFrame(p); err != nil {
+			t.Fatalf("%s: send failed: %v", test.Name, err)
+		}
+		select {
+		case got := <-received:
+			if got.DstID != p.DstID || got.StreamID != p.StreamID || !bytes.Equal(got.Data, p.Data) {
+				t.Fatalf("%s: unexpected packet %+v", test.Name, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: packet not received", test.Name)
+		}
+	}
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := server.ListenAndServe(); err != nil {
+		t.Fatalf("listen and serve after close failed: %v", err)
+	}
+}
+
+func TestP2PLinkRefused(t *testing.T) {
+	m := testMaster(t)
+	defer m.Close()
+	go m.ListenAndServe()
+
+	// The master doesn't know the repeater, so the login is refused and
+	// Dial gives up when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if _, err := Dial(ctx, &RepeaterConfiguration{Callsign: "PD0MZ", ID: 2042214, ColorCode: 1}, m.Addr(), []byte("s3cr3t")); err == nil {
+		t.Fatal("dial with unknown repeater succeeded")
+	}
+}
+
+func TestP2PLinkAcceptCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	var addr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr = conn.LocalAddr().(*net.UDPAddr)
+	conn.Close()
+
+	if _, err := ListenAndAccept(ctx, addr, 2042214, []byte("s3cr3t")); err == nil {
+		t.Fatal("accept without peer succeeded")
+	}
+
+	// The socket is closed, so the address can be used again
+	for i := 0; ; i++ {
+		conn, err := net.ListenUDP("udp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 100 {
+			t.Fatalf("socket not closed after cancel: %v", err)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
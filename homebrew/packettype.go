@@ -0,0 +1,75 @@
+package homebrew
+
+import (
+	"bytes"
+	"errors"
+)
+
+// PacketType is the type of a protocol packet, as given by its opcode.
+type PacketType uint8
+
+// Packet types of both protocol dialects.
+const (
+	PacketTypeUnknown PacketType = iota
+	PacketTypeDMRData
+	PacketTypeMasterNAK
+	PacketTypeMasterACK
+	PacketTypeRepeaterLogin
+	PacketTypeRepeaterKey
+	PacketTypeRepeaterConfig
+	PacketTypeMasterPing
+	PacketTypeRepeaterPong
+	PacketTypeMasterClosing
+	PacketTypeRepeaterClosing
+	PacketTypeRepeaterOptions
+	PacketTypeRepeaterACK
+	PacketTypeRepeaterPing
+	PacketTypeMasterPong
+	PacketTypeRepeaterBeacon
+)
+
+// packetTypes maps the opcodes to packet types. Opcodes that share a prefix
+// are listed longest first, such as RPTCL before RPTC.
+var packetTypes = []struct {
+	opcode []byte
+	kind   PacketType
+}{
+	{DMRData, PacketTypeDMRData},
+	{MasterNAK, PacketTypeMasterNAK},
+	{MasterACK, PacketTypeMasterACK},
+	{MasterPing, PacketTypeMasterPing},
+	{MasterPong, PacketTypeMasterPong},
+	{MasterClosing, PacketTypeMasterClosing},
+	{RepeaterLogin, PacketTypeRepeaterLogin},
+	{RepeaterKey, PacketTypeRepeaterKey},
+	{RepeaterClosing, PacketTypeRepeaterClosing},
+	{RepeaterConfig, PacketTypeRepeaterConfig},
+	{RepeaterPong, PacketTypeRepeaterPong},
+	{RepeaterPing, PacketTypeRepeaterPing},
+	{RepeaterACK, PacketTypeRepeaterACK},
+	{RepeaterBeacon, PacketTypeRepeaterBeacon},
+	{RepeaterOptions, PacketTypeRepeaterOptions},
+}
+
+// String returns the opcode of the packet type.
+func (t PacketType) String() string {
+	for _, pt := range packetTypes {
+		if pt.kind == t {
+			return string(pt.opcode)
+		}
+	}
+	return "unknown"
+}
+
+// ClassifyPacket returns the type of the datagram and its payload, the data
+// following the opcode. That is the repeater ID, followed by the salt, key,
+// options or ping ID for the login and keepalive messages, the callsign and
+// the rest of the configuration for RPTC and the frame for DMRD.
+func ClassifyPacket(data []byte) (PacketType, []byte, error) {
+	for _, pt := range packetTypes {
+		if bytes.HasPrefix(data, pt.opcode) {
+			return pt.kind, data[len(pt.opcode):], nil
+		}
+	}
+	return PacketTypeUnknown, nil, errors.New("homebrew: unknown packet type")
+}
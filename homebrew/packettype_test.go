@@ -0,0 +1,51 @@
+package homebrew
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClassifyPacket(t *testing.T) {
+	var id = []byte("001f2966")
+	var tests = []struct {
+		data    []byte
+		kind    PacketType
+		payload []byte
+	}{
+		{append([]byte("DMRD"), 0x01, 0x02), PacketTypeDMRData, []byte{0x01, 0x02}},
+		{append([]byte("MSTNAK"), id...), PacketTypeMasterNAK, id},
+		{append([]byte("MSTACK"), id...), PacketTypeMasterACK, id},
+		{append([]byte("RPTL"), id...), PacketTypeRepeaterLogin, id},
+		{append([]byte("RPTK"), id...), PacketTypeRepeaterKey, id},
+		{append([]byte("RPTCPD0MZ   "), id...), PacketTypeRepeaterConfig, append([]byte("PD0MZ   "), id...)},
+		{append([]byte("MSTPING"), id...), PacketTypeMasterPing, id},
+		{append([]byte("RPTPONG"), id...), PacketTypeRepeaterPong, id},
+		{append([]byte("MSTCL"), id...), PacketTypeMasterClosing, id},
+		{append([]byte("RPTCL"), id...), PacketTypeRepeaterClosing, id},
+		{append([]byte("RPTO"), id...), PacketTypeRepeaterOptions, id},
+		{append([]byte("RPTACK"), id...), PacketTypeRepeaterACK, id},
+		{append([]byte("RPTPING"), id...), PacketTypeRepeaterPing, id},
+		{append([]byte("MSTPONG"), id...), PacketTypeMasterPong, id},
+		{append([]byte("RPTSBKN"), id...), PacketTypeRepeaterBeacon, id},
+	}
+
+	for _, test := range tests {
+		kind, payload, err := ClassifyPacket(test.data)
+		switch {
+		case err != nil:
+			t.Fatalf("classify %q failed: %v", test.data, err)
+		case kind != test.kind:
+			t.Fatalf("classify %q: expected %s, got %s", test.data, test.kind, kind)
+		case !bytes.Equal(payload, test.payload):
+			t.Fatalf("classify %q: expected payload %q, got %q", test.data, test.payload, payload)
+		case !bytes.HasPrefix(test.data, []byte(kind.String())):
+			t.Fatalf("classify %q: unexpected opcode %s", test.data, kind)
+		}
+	}
+
+	for _, data := range [][]byte{nil, []byte("RPT"), []byte("XXXX001f2966")} {
+		if kind, _, err := ClassifyPacket(data); err == nil || kind != PacketTypeUnknown {
+			t.Fatalf("classify %q: expected unknown, got %s", data, kind)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package homebrew
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pcap file format constants, the datagrams are written as raw IP packets
+// with a synthesized IP and UDP header, so captures open in Wireshark.
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapSnapLen    = 0xffff
+	pcapLinkRaw    = 101 // LINKTYPE_RAW, IPv4 or IPv6 without link layer
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+	protocolUDP    = 17
+)
+
+// PcapWriter writes the datagrams passed to its Tap to a pcap capture.
+type PcapWriter struct {
+	w     io.Writer
+	local *net.UDPAddr
+	mutex *sync.Mutex
+	err   error
+}
+
+// NewPcapWriter writes the pcap file header to w and returns a writer for
+// the traffic of a link with the local address. An unspecified local IP is
+// written as the loopback address.
+func NewPcapWriter(w io.Writer, local *net.UDPAddr) (*PcapWriter, error) {
+	var header = make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2) // Version 2.4
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	if local == nil {
+		local = &net.UDPAddr{}
+	}
+	return &PcapWriter{
+		w:     w,
+		local: local,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+// CreatePcap creates a pcap file at path, see NewPcapWriter.
+func CreatePcap(path string, local *net.UDPAddr) (*PcapWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewPcapWriter(f, local)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Tap writes a datagram to the capture, it can be passed to SetTap. Write
+// errors are kept and returned by Err and Close.
+func (w *PcapWriter) Tap(direction Direction, addr *net.UDPAddr, data []byte) {
+	var src, dst = w.local, addr
+	if direction == Received {
+		src, dst = addr, w.local
+	}
+	var packet = buildUDP(src, dst, data)
+
+	var (
+		now    = time.Now()
+		record = make([]byte, 16, 16+len(packet))
+	)
+	binary.LittleEndian.PutUint32(record[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	record = append(record, packet...)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(record)
+}
+
+// Err returns the first write error.
+func (w *PcapWriter) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+// Close closes the underlying writer, if it is an io.Closer, and returns the
+// first write error.
+func (w *PcapWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if c, ok := w.w.(io.Closer); ok {
+		if err := c.Close(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	return w.err
+}
+
+// buildUDP builds an IPv4 packet, or an IPv6 packet if either address is not
+// an IPv4 address, carrying data in a UDP datagram from src to dst.
+func buildUDP(src, dst *net.UDPAddr, data []byte) []byte {
+	var srcIP, dstIP = src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+	if srcIP == nil || src.IP.IsUnspecified() {
+		srcIP = loopback(len(dstIP))
+	}
+	if dstIP == nil || dst.IP.IsUnspecified() {
+		dstIP = loopback(len(srcIP))
+	}
+
+	var udp = make([]byte, udpHeaderSize, udpHeaderSize+len(data))
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderSize+len(data)))
+	udp = append(udp, data...)
+
+	// The UDP checksum covers a pseudo header with the addresses
+	var pseudo = make([]byte, 0, 2*len(srcIP)+8)
+	pseudo = append(pseudo, srcIP...)
+	pseudo = append(pseudo, dstIP...)
+	pseudo = append(pseudo, 0, 0, byte(len(udp)>>8), byte(len(udp)), 0, 0, 0, protocolUDP)
+	var sum = checksum(append(pseudo, udp...))
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+
+	var ip []byte
+	if len(srcIP) == net.IPv4len {
+		ip = make([]byte, ipv4HeaderSize, ipv4HeaderSize+len(udp))
+		ip[0] = 0x45 // Version 4, 5 words
+		binary.BigEndian.PutUint16(ip[2:], uint16(ipv4HeaderSize+len(udp)))
+		ip[6] = 0x40 // Don't fragment
+		ip[8] = 64   // TTL
+		ip[9] = protocolUDP
+		copy(ip[12:], srcIP)
+		copy(ip[16:], dstIP)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+	} else {
+		ip = make([]byte, ipv6HeaderSize, ipv6HeaderSize+len(udp))
+		ip[0] = 0x60 // Version 6
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+		ip[6] = protocolUDP
+		ip[7] = 64 // Hop limit
+		copy(ip[8:], srcIP)
+		copy(ip[24:], dstIP)
+	}
+	return append(ip, udp...)
+}
+
+func loopback(size int) net.IP {
+	if size == net.IPv6len {
+		return net.IPv6loopback
+	}
+	return net.IPv4(127, 0, 0, 1).To4()
+}
+
+// checksum returns the internet checksum (RFC 1071) of data.
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
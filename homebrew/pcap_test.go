@@ -0,0 +1,133 @@
+package homebrew
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPcapWriter(t *testing.T) {
+	var (
+		buf    = new(bytes.Buffer)
+		local  = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 62032}
+		remote = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 62031}
+	)
+	w, err := NewPcapWriter(buf, local)
+	if err != nil {
+		t.Fatalf("new pcap writer failed: %v", err)
+	}
+	var header = buf.Bytes()[:24]
+	switch {
+	case binary.LittleEndian.Uint32(header) != pcapMagic:
+		t.Fatalf("unexpected magic %x", header[:4])
+	case binary.LittleEndian.Uint32(header[20:]) != pcapLinkRaw:
+		t.Fatalf("unexpected link type %d", binary.LittleEndian.Uint32(header[20:]))
+	}
+
+	w.Tap(Sent, remote, append(RepeaterLogin, packRepeaterID(2042214)...))
+	w.Tap(Received, &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 62031}, []byte("MSTNAK0000000"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	var data = buf.Bytes()[24:]
+	for i, test := range []struct {
+		Version  byte
+		Src, Dst net.IP
+		SrcPort  uint16
+		DstPort  uint16
+		Payload  string
+	}{
+		{4, local.IP, remote.IP, 62032, 62031, "RPTL001F2966"},
+		{6, net.ParseIP("2001:db8::1"), local.IP, 62031, 62032, "MSTNAK0000000"}, // Local IP is IPv4-mapped
+	} {
+		if len(data) < 16 {
+			t.Fatalf("record %d: short capture", i)
+		}
+		var size = int(binary.LittleEndian.Uint32(data[8:]))
+		if int(binary.LittleEndian.Uint32(data[12:])) != size || len(data) < 16+size {
+			t.Fatalf("record %d: invalid length %d", i, size)
+		}
+		var packet = data[16 : 16+size]
+		data = data[16+size:]
+
+		if packet[0]>>4 != test.Version {
+			t.Fatalf("record %d: expected IPv%d, got IPv%d", i, test.Version, packet[0]>>4)
+		}
+		var (
+			src, dst net.IP
+			udp      []byte
+		)
+		if test.Version == 4 {
+			if checksum(packet[:ipv4HeaderSize]) != 0 {
+				t.Fatalf("record %d: invalid IPv4 header checksum", i)
+			}
+			src, dst, udp = packet[12:16], packet[16:20], packet[ipv4HeaderSize:]
+		} else {
+			src, dst, udp = packet[8:24], packet[24:40], packet[ipv6HeaderSize:]
+		}
+		switch {
+		case !src.Equal(test.Src) || !dst.Equal(test.Dst):
+			t.Fatalf("record %d: expected %s > %s, got %s > %s", i, test.Src, test.Dst, src, dst)
+		case binary.BigEndian.Uint16(udp) != test.SrcPort || binary.BigEndian.Uint16(udp[2:]) != test.DstPort:
+			t.Fatalf("record %d: unexpected ports %d > %d", i, binary.BigEndian.Uint16(udp), binary.BigEndian.Uint16(udp[2:]))
+		case int(binary.BigEndian.Uint16(udp[4:])) != len(udp):
+			t.Fatalf("record %d: invalid UDP length %d", i, binary.BigEndian.Uint16(udp[4:]))
+		case string(udp[udpHeaderSize:]) != test.Payload:
+			t.Fatalf("record %d: expected payload %q, got %q", i, test.Payload, udp[udpHeaderSize:])
+		}
+	}
+	if len(data) != 0 {
+		t.Fatalf("%d trailing bytes", len(data))
+	}
+}
+
+func TestTap(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer conn.Close()
+
+	type tapped struct {
+		Direction Direction
+		Data      string
+	}
+	var taps = make(chan tapped, 4)
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetTap(func(direction Direction, addr *net.UDPAddr, data []byte) {
+		if addr.String() == conn.LocalAddr().String() {
+			taps <- tapped{direction, string(data)}
+		}
+	})
+	go h.ListenAndServe()
+
+	if err := h.Link(&Peer{ID: 1, Addr: conn.LocalAddr().(*net.UDPAddr), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	var data = make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, addr, err := conn.ReadFromUDP(data)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var reply = string(append(MasterNAK, h.id...))
+	conn.WriteToUDP([]byte(reply), addr)
+
+	for _, want := range []tapped{
+		{Sent, string(append(RepeaterLogin, h.id...))},
+		{Received, reply},
+	} {
+		select {
+		case got := <-taps:
+			if got != want {
+				t.Fatalf("expected %s %q, got %s %q", want.Direction, want.Data, got.Direction, got.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s datagram not tapped", want.Direction)
+		}
+	}
+}
@@ -5,21 +5,30 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/pd0mz/go-dmr"
 )
 
-// Peer is a remote repeater that also speaks the Homebrew protocol
+// Peer is a remote repeater that also speaks the Homebrew protocol. Once
+// linked, the state of the peer is shared by the goroutines of the link and
+// guarded by its mutex: Addr, Status, Nonce, Token and Last must not be read
+// or written directly while the peer is linked, use Homebrew.Stats and
+// Homebrew.ActiveMaster to read them.
 type Peer struct {
 	ID                  uint32
 	Addr                *net.UDPAddr
-	AuthKey             []byte
+	Host                string   // Host and port, resolved to Addr before every login if set
+	Hosts               []string // Hosts tried in order when the link fails, takes precedence over Host
+	RotateHosts         bool     // Start over at the first of Hosts after the last one failed
+	AuthKey             []byte   // Shared secret, can only be empty with NoAuth
+	NoAuth              bool     // Allow an empty AuthKey, for outgoing peers with authentication disabled
 	Status              AuthStatus
 	Nonce               []byte
 	Token               []byte
 	Incoming            bool
-	UnlinkOnAuthFailure bool
+	UnlinkOnAuthFailure bool // Unlink when the login is refused or times out
 	PacketReceived      dmr.PacketFunc
 	Last                struct {
 		PacketSent     time.Time
@@ -31,6 +40,29 @@ type Peer struct {
 
 	// Packed repeater ID
 	id []byte
+	// Last time Host was resolved
+	resolved time.Time
+	// Index of the active host in Hosts
+	hostIndex int
+	// Login to the next host is delayed until
+	retry time.Time
+	// Configuration acknowledged since the last login
+	linked bool
+	// Options sent, waiting for the ACK or NAK
+	optionsSent bool
+	// Round trip time of the last ping
+	rtt time.Duration
+	// Time our last login or key response was sent, not counting retries
+	loginSent time.Time
+	// Logins sent again since, and when the next retry is due
+	loginRetries int
+	loginRetryAt time.Time
+
+	// Guards Addr, Status, Nonce, Token, Last and the state of the link,
+	// including the active host, which the receiving and keepalive
+	// goroutines, Send, Stats and Close share. The mutex is never held while
+	// calling out of the package.
+	mutex sync.Mutex
 }
 
 func (p *Peer) CheckRepeaterID(id []byte) bool {
@@ -38,9 +70,78 @@ func (p *Peer) CheckRepeaterID(id []byte) bool {
 }
 
 func (p *Peer) UpdateToken(nonce []byte) {
-	p.Nonce = nonce
 	hash := sha256.New()
-	hash.Write(p.Nonce)
+	hash.Write(nonce)
 	hash.Write(p.AuthKey)
-	p.Token = []byte(hex.EncodeToString(hash.Sum(nil)))
+	var token = []byte(hex.EncodeToString(hash.Sum(nil)))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Nonce, p.Token = nonce, token
+}
+
+// status returns the authentication status.
+func (p *Peer) status() AuthStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.Status
+}
+
+// setStatus changes the authentication status.
+func (p *Peer) setStatus(status AuthStatus) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Status = status
+}
+
+// token returns the token of the key exchange.
+func (p *Peer) token() []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.Token
+}
+
+// addr returns the address of the peer.
+func (p *Peer) addr() *net.UDPAddr {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.Addr
+}
+
+// sent records a datagram sent at now and returns the address to send it to.
+func (p *Peer) sent(now time.Time) *net.UDPAddr {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Last.PacketSent = now
+	return p.Addr
+}
+
+// activeHost returns the host the peer is linked on, or an empty string if
+// the peer has no Host.
+func (p *Peer) activeHost() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.host()
+}
+
+// host returns the active host, the caller must hold the mutex.
+func (p *Peer) host() string {
+	if len(p.Hosts) > 0 {
+		return p.Hosts[p.hostIndex%len(p.Hosts)]
+	}
+	return p.Host
+}
+
+// hasNextHost returns true if the peer can fail over to another host.
+func (p *Peer) hasNextHost() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.hostIndex+1 < len(p.Hosts) || (p.RotateHosts && len(p.Hosts) > 1)
+}
+
+// nextHost moves the peer to the next of its Hosts.
+func (p *Peer) nextHost() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.hostIndex = (p.hostIndex + 1) % len(p.Hosts)
 }
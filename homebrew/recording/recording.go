@@ -0,0 +1,274 @@
+// Package recording records Homebrew links to disk and plays them back, for
+// regression tests, last heard replay and debugging.
+//
+// A recording starts with Magic and the Version as a big endian uint16,
+// followed by a record per datagram. Each record is the time in nanoseconds
+// since the Unix epoch as a big endian int64, the direction byte, the length
+// of the datagram as a big endian uint16 and the datagram. A Recorder either
+// records the DMR data frames passed to its PacketFunc, as received
+// datagrams in the Homebrew DMRD wire format, or, through its Tap, all
+// datagrams of a link in both directions.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+// Magic and version of the recording format.
+const (
+	Magic      = "DMRCAP"
+	Version    = 1
+	headerSize = 11 // Timestamp, direction and length
+)
+
+// Frame is a recorded frame.
+type Frame struct {
+	Time   time.Time
+	Packet *dmr.Packet
+}
+
+// Datagram is a recorded datagram.
+type Datagram struct {
+	Time      time.Time
+	Direction homebrew.Direction
+	Data      []byte
+}
+
+// Recorder appends datagrams to a recording. After the first error nothing
+// is recorded anymore, the error is returned by Err and Close.
+type Recorder struct {
+	w     io.Writer
+	mutex *sync.Mutex
+	err   error
+	now   func() time.Time
+}
+
+// NewRecorder writes the header to w and returns a recorder writing to w.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	var header = make([]byte, len(Magic)+2)
+	copy(header, Magic)
+	binary.BigEndian.PutUint16(header[len(Magic):], Version)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		w:     w,
+		mutex: &sync.Mutex{},
+		now:   time.Now,
+	}, nil
+}
+
+// Create creates a recording at path, see NewRecorder.
+func Create(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRecorder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// PacketFunc records the packet, it can be installed as the PacketFunc of a
+// Repeater.
+func (r *Recorder) PacketFunc(_ dmr.Repeater, p *dmr.Packet) error {
+	return r.Record(p)
+}
+
+// Tap records a datagram with the current time, it can be passed to SetTap.
+// As a TapFunc can't return errors, see Err.
+func (r *Recorder) Tap(direction homebrew.Direction, _ *net.UDPAddr, data []byte) {
+	r.RecordDatagram(r.now(), direction, data)
+}
+
+// Record records the packet as received with the current time.
+func (r *Recorder) Record(p *dmr.Packet) error {
+	return r.RecordAt(r.now(), p)
+}
+
+// RecordAt records the packet as received at time t.
+func (r *Recorder) RecordAt(t time.Time, p *dmr.Packet) error {
+	if p == nil {
+		return errors.New("recording: packet can't be nil")
+	}
+	return r.RecordDatagram(t, homebrew.Received, homebrew.BuildData(p, p.RepeaterID))
+}
+
+// RecordDatagram records a datagram sent or received at time t.
+func (r *Recorder) RecordDatagram(t time.Time, direction homebrew.Direction, data []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if len(data) > 0xffff {
+		r.err = fmt.Errorf("recording: datagram of %d bytes is too large", len(data))
+		return r.err
+	}
+	var record = make([]byte, headerSize, headerSize+len(data))
+	binary.BigEndian.PutUint64(record[0:], uint64(t.UnixNano()))
+	record[8] = byte(direction)
+	binary.BigEndian.PutUint16(record[9:], uint16(len(data)))
+	record = append(record, data...)
+
+	_, r.err = r.w.Write(record)
+	return r.err
+}
+
+// Err returns the first error.
+func (r *Recorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// Close closes the underlying writer, if it is an io.Closer, and returns the
+// first error.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if c, ok := r.w.(io.Closer); ok {
+		if err := c.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	return r.err
+}
+
+// Player reads a recording.
+type Player struct {
+	// Realtime plays frames with the original time between frames, by
+	// default frames are played as fast as possible.
+	Realtime bool
+	// Speed divides the original time between frames when playing in
+	// Realtime, 2 plays twice as fast. Zero or less plays at the original
+	// speed.
+	Speed float64
+
+	r     *bufio.Reader
+	c     io.Closer
+	sleep func(time.Duration)
+}
+
+// NewPlayer reads the header from r and returns a player reading from r.
+func NewPlayer(r io.Reader) (*Player, error) {
+	var (
+		br     = bufio.NewReader(r)
+		header = make([]byte, len(Magic)+2)
+	)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(Magic)]) != Magic {
+		return nil, errors.New("recording: not a recording")
+	}
+	if version := binary.BigEndian.Uint16(header[len(Magic):]); version != Version {
+		return nil, fmt.Errorf("recording: unsupported version %d", version)
+	}
+	var p = &Player{r: br, sleep: time.Sleep}
+	if c, ok := r.(io.Closer); ok {
+		p.c = c
+	}
+	return p, nil
+}
+
+// Open opens the recording at path, see NewPlayer.
+func Open(path string) (*Player, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPlayer(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recording: %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// NextDatagram returns the next datagram, or io.EOF at the end of the
+// recording.
+func (p *Player) NextDatagram() (*Datagram, error) {
+	var header = make([]byte, headerSize)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("recording: truncated record")
+		}
+		return nil, err
+	}
+	var data = make([]byte, binary.BigEndian.Uint16(header[9:]))
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, errors.New("recording: truncated record")
+	}
+	return &Datagram{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(header))),
+		Direction: homebrew.Direction(header[8]),
+		Data:      data,
+	}, nil
+}
+
+// Next returns the next received DMR data frame, or io.EOF at the end of the
+// recording. Other datagrams are skipped.
+func (p *Player) Next() (*Frame, error) {
+	for {
+		datagram, err := p.NextDatagram()
+		if err != nil {
+			return nil, err
+		}
+		if datagram.Direction != homebrew.Received || !bytes.HasPrefix(datagram.Data, homebrew.DMRData) {
+			continue
+		}
+		packet, err := homebrew.ParseData(datagram.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &Frame{Time: datagram.Time, Packet: packet}, nil
+	}
+}
+
+// Play passes every received frame to f, until the end of the recording or
+// until f returns an error. The Repeater passed to f is nil.
+func (p *Player) Play(f dmr.PacketFunc) error {
+	var speed = p.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	var last time.Time
+	for {
+		frame, err := p.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if p.Realtime && !last.IsZero() && frame.Time.After(last) {
+			p.sleep(time.Duration(float64(frame.Time.Sub(last)) / speed))
+		}
+		last = frame.Time
+		if err := f(nil, frame.Packet); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the underlying reader, if it is an io.Closer.
+func (p *Player) Close() error {
+	if p.c != nil {
+		return p.c.Close()
+	}
+	return nil
+}
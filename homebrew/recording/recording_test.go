@@ -0,0 +1,270 @@
+package recording
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf = new(bytes.Buffer)
+	r, err := NewRecorder(buf)
+	if err != nil {
+		t.Fatalf("new recorder failed: %v", err)
+	}
+	var (
+		start = time.Unix(1451736000, 0)
+		want  = []*dmr.Packet{
+			{Sequence: 1, SrcID: 2042214, DstID: 204, RepeaterID: 204221401, Timeslot: 1, CallType: dmr.CallTypeGroup, StreamID: 1, DataType: dmr.VoiceLC},
+			{Sequence: 2, SrcID: 2042214, DstID: 2043044, RepeaterID: 204221401, CallType: dmr.CallTypePrivate, StreamID: 1, DataType: dmr.VoiceBurstC},
+		}
+	)
+	for i, p := range want {
+		p.SetData(bytes.Repeat([]byte{byte(i)}, 33))
+		if err := r.RecordAt(start.Add(time.Duration(i)*time.Second), p); err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+	}
+
+	var slept []time.Duration
+	p, err := NewPlayer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("new player failed: %v", err)
+	}
+	p.Realtime = true
+	p.sleep = func(d time.Duration) { slept = append(slept, d) }
+	var got []*dmr.Packet
+	if err := p.Play(func(_ dmr.Repeater, p *dmr.Packet) error {
+		got = append(got, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("play failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d frames, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].String() != want[i].String() || got[i].RepeaterID != want[i].RepeaterID || !bytes.Equal(got[i].Data, want[i].Data) {
+			t.Fatalf("expected %v, got %v", want[i], got[i])
+		}
+	}
+	if len(slept) != 1 || slept[0] != time.Second {
+		t.Fatalf("expected a 1s pause, got %v", slept)
+	}
+
+	for _, data := range [][]byte{
+		[]byte("DMRD"),
+		[]byte("DMRREC1\n"),
+		append([]byte(Magic), 0, 2),
+		buf.Bytes()[:len(buf.Bytes())-1],
+	} {
+		p, err := NewPlayer(bytes.NewReader(data))
+		if err == nil {
+			err = p.Play(func(dmr.Repeater, *dmr.Packet) error { return nil })
+		}
+		if err == nil {
+			t.Fatalf("play of %d bytes succeeded", len(data))
+		}
+	}
+}
+
+func TestRecorderTap(t *testing.T) {
+	var buf = new(bytes.Buffer)
+	r, err := NewRecorder(buf)
+	if err != nil {
+		t.Fatalf("new recorder failed: %v", err)
+	}
+	var (
+		start = time.Unix(1451736000, 0)
+		frame = &dmr.Packet{Sequence: 7, SrcID: 2042214, DstID: 204, RepeaterID: 2042214, CallType: dmr.CallTypeGroup, StreamID: 1, DataType: dmr.VoiceBurstB}
+	)
+	frame.SetData(bytes.Repeat([]byte{0x55}, 33))
+	for i, datagram := range []Datagram{
+		{start, homebrew.Sent, []byte("MSTPING001F2966")},
+		{start.Add(time.Millisecond * 100), homebrew.Received, []byte("RPTPONG001F2966")},
+		{start.Add(time.Millisecond * 160), homebrew.Received, homebrew.BuildData(frame, 2042214)},
+		{start.Add(time.Millisecond * 220), homebrew.Sent, homebrew.BuildData(frame, 2042214)},
+		{start.Add(time.Millisecond * 280), homebrew.Received, homebrew.BuildData(frame, 2042214)},
+	} {
+		if err := r.RecordDatagram(datagram.Time, datagram.Direction, datagram.Data); err != nil {
+			t.Fatalf("record %d failed: %v", i, err)
+		}
+	}
+	r.Tap(homebrew.Received, nil, []byte("MSTCL001F2966"))
+	if err := r.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// Only received frames are played, with the time between them
+	p, err := NewPlayer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("new player failed: %v", err)
+	}
+	p.Realtime, p.Speed = true, 2
+	var (
+		slept []time.Duration
+		got   []*dmr.Packet
+	)
+	p.sleep = func(d time.Duration) { slept = append(slept, d) }
+	if err := p.Play(func(_ dmr.Repeater, p *dmr.Packet) error {
+		got = append(got, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("play failed: %v", err)
+	}
+	switch {
+	case len(got) != 2 || got[0].String() != frame.String() || !bytes.Equal(got[0].Data, frame.Data):
+		t.Fatalf("expected %v twice, got %v", frame, got)
+	case len(slept) != 1 || slept[0] != time.Millisecond*60:
+		t.Fatalf("expected a 60ms pause, got %v", slept)
+	}
+
+	p, _ = NewPlayer(bytes.NewReader(buf.Bytes()))
+	datagram, err := p.NextDatagram()
+	switch {
+	case err != nil:
+		t.Fatalf("next datagram failed: %v", err)
+	case !datagram.Time.Equal(start) || datagram.Direction != homebrew.Sent || string(datagram.Data) != "MSTPING001F2966":
+		t.Fatalf("unexpected datagram %+v", datagram)
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(data), nil
+}
+
+// TestRecorderTapError checks that errors of a Tap, which can't return them,
+// are kept.
+func TestRecorderTapError(t *testing.T) {
+	r, err := NewRecorder(&failingWriter{n: 2})
+	if err != nil {
+		t.Fatalf("new recorder failed: %v", err)
+	}
+	r.Tap(homebrew.Sent, nil, []byte("MSTPING001F2966"))
+	if err := r.Err(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	r.Tap(homebrew.Sent, nil, []byte("MSTPING001F2966"))
+	if r.Err() == nil {
+		t.Fatal("write error not kept")
+	}
+
+	if r, err = NewRecorder(new(bytes.Buffer)); err != nil {
+		t.Fatalf("new recorder failed: %v", err)
+	}
+	r.Tap(homebrew.Received, nil, make([]byte, 0x10000))
+	if r.Err() == nil {
+		t.Fatal("error for too large datagram not kept")
+	}
+}
+
+// TestVoiceCall plays a recorded call, in which the frame with sequence 5
+// was lost, through the stream trackers.
+func TestVoiceCall(t *testing.T) {
+	p, err := Open(filepath.Join("testdata", "voice.rec"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer p.Close()
+
+	var (
+		cdrs    = dmr.NewCDRWriter()
+		seq     = dmr.NewSequenceChecker()
+		gaps    int
+		start   time.Time
+		records []*dmr.CDR
+	)
+	cdrs.OnCDR = func(cdr *dmr.CDR) { records = append(records, cdr) }
+	seq.OnOutOfOrder = func(uint32, byte, byte) { gaps++ }
+	for {
+		frame, err := p.Next()
+		if err != nil {
+			break
+		}
+		if start.IsZero() {
+			start = frame.Time
+		}
+		seq.Check(frame.Packet)
+		cdrs.AddPacket(frame.Packet)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 CDR, got %d", len(records))
+	}
+	var cdr = records[0]
+	switch {
+	case cdr.SrcID != 2042214 || cdr.DstID != 204 || cdr.CallType != dmr.CallTypeGroup || cdr.Slot != 1:
+		t.Fatalf("unexpected CDR %+v", cdr)
+	case cdr.FrameCount != 13 || cdr.LostFrames != 1 || gaps != 1:
+		t.Fatalf("expected 13 frames and 1 lost, got %d and %d", cdr.FrameCount, cdr.LostFrames)
+	case !start.Equal(time.Date(2016, 1, 2, 12, 0, 0, 0, time.UTC)):
+		t.Fatalf("unexpected start time %s", start)
+	}
+}
+
+func TestAMBRecorder(t *testing.T) {
+	p, err := Open(filepath.Join("testdata", "voice.rec"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer p.Close()
+
+	var (
+		r       = dmr.NewAMBRecorder(t.TempDir())
+		written []string
+	)
+	r.OnWrite = func(path string, err error) {
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		written = append(written, path)
+	}
+	if err := p.Play(r.PacketFunc); err != nil {
+		t.Fatalf("play failed: %v", err)
+	}
+	if len(written) != 1 || !strings.HasSuffix(written[0], "_2042214_204_TS2.amb") {
+		t.Fatalf("expected a file for the call, got %v", written)
+	}
+
+	data, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	// 12 voice bursts of 3 frames, the fifth burst with sequence 5 was lost
+	if len(data) != len(dmr.AMBMagic)+12*3*dmr.AMBFrameSize || !bytes.Equal(data[:4], dmr.AMBMagic) {
+		t.Fatalf("unexpected file of %d bytes", len(data))
+	}
+	var frame = func(i int) []byte {
+		var o = len(dmr.AMBMagic) + i*dmr.AMBFrameSize
+		return data[o : o+dmr.AMBFrameSize]
+	}
+	var want = make([]byte, dmr.AMBEDataBits)
+	for j := range want {
+		want[j] = byte((3+j)%3) & 1
+	}
+	if got, _ := dmr.AppendAMBFrame(nil, want, 0); !bytes.Equal(frame(0), got) {
+		t.Fatalf("expected first frame %x, got %x", got, frame(0))
+	}
+	var silence = frame(12)
+	for i := 13; i < 15; i++ {
+		if !bytes.Equal(frame(i), silence) {
+			t.Fatalf("expected silence in frame %d, got %x", i, frame(i))
+		}
+	}
+	if silence[1] != 0xf8 || bytes.Equal(frame(11), silence) || bytes.Equal(frame(15), silence) {
+		t.Fatal("received frames written as silence")
+	}
+}
@@ -1,29 +1,41 @@
 package homebrew
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/pd0mz/go-dmr"
 )
 
+// Frequency bands (in Hz) DMR equipment is commonly licensed for.
+var frequencyBands = [][2]uint32{
+	{66000000, 88000000},   // Low VHF
+	{136000000, 174000000}, // VHF
+	{400000000, 527000000}, // UHF
+	{806000000, 941000000}, // 800/900 MHz
+}
+
 // RepeaterConfiguration holds information about the current repeater. It
 // should be returned by a callback in the implementation, returning actual
 // information about the current repeater status.
 type RepeaterConfiguration struct {
-	Callsign    string
-	ID          uint32 // Our RepeaterID
-	RXFreq      uint32
-	TXFreq      uint32
-	TXPower     uint8
-	ColorCode   uint8
-	Latitude    float32
-	Longitude   float32
-	Height      uint16
-	Location    string
-	Description string
-	URL         string
-	SoftwareID  string
-	PackageID   string
+	Callsign    string  `json:"callsign"`
+	ID          uint32  `json:"id"` // Our RepeaterID
+	RXFreq      uint32  `json:"rx_freq"`
+	TXFreq      uint32  `json:"tx_freq"`
+	TXPower     uint8   `json:"tx_power"`
+	ColorCode   uint8   `json:"color_code"`
+	Latitude    float32 `json:"latitude"`
+	Longitude   float32 `json:"longitude"`
+	Height      uint16  `json:"height"`
+	Location    string  `json:"location,omitempty"`
+	Description string  `json:"description,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	SoftwareID  string  `json:"software_id,omitempty"`
+	PackageID   string  `json:"package_id,omitempty"`
 }
 
 // Bytes returns the configuration as bytes.
@@ -31,32 +43,21 @@ func (r *RepeaterConfiguration) Bytes() []byte {
 	return []byte(r.String())
 }
 
-// String returns the configuration as string.
+// String returns the configuration as string. The configuration is not
+// checked, use Validate to make sure the master will accept it.
 func (r *RepeaterConfiguration) String() string {
-	if r.ColorCode < 1 {
-		r.ColorCode = 1
-	}
-	if r.ColorCode > 15 {
-		r.ColorCode = 15
-	}
-	if r.TXPower > 99 {
-		r.TXPower = 99
-	}
-	if r.SoftwareID == "" {
-		r.SoftwareID = dmr.SoftwareID
+	var softwareID, packageID = r.SoftwareID, r.PackageID
+	if softwareID == "" {
+		softwareID = dmr.SoftwareID
 	}
-	if r.PackageID == "" {
-		r.PackageID = dmr.PackageID
+	if packageID == "" {
+		packageID = dmr.PackageID
 	}
 
-	var lat = fmt.Sprintf("%-08f", r.Latitude)
-	if len(lat) > 8 {
-		lat = lat[:8]
-	}
-	var lon = fmt.Sprintf("%-09f", r.Longitude)
-	if len(lon) > 9 {
-		lon = lon[:9]
-	}
+	var (
+		lat = formatCoordinate(r.Latitude, 8)
+		lon = formatCoordinate(r.Longitude, 9)
+	)
 
 	var b = "RPTC"
 	b += fmt.Sprintf("%-8s", r.Callsign)
@@ -71,11 +72,177 @@ func (r *RepeaterConfiguration) String() string {
 	b += fmt.Sprintf("%-20s", r.Location)
 	b += fmt.Sprintf("%-20s", r.Description)
 	b += fmt.Sprintf("%-124s", r.URL)
-	b += fmt.Sprintf("%-40s", r.SoftwareID)
-	b += fmt.Sprintf("%-40s", r.PackageID)
+	b += fmt.Sprintf("%-40s", softwareID)
+	b += fmt.Sprintf("%-40s", packageID)
 	return b
 }
 
+// ParseRepeaterConfiguration parses a configuration packet, see
+// RepeaterConfiguration.String for the layout.
+func ParseRepeaterConfiguration(data []byte) (*RepeaterConfiguration, error) {
+	const size = 4 + 8 + 8 + 9 + 9 + 2 + 2 + 8 + 9 + 3 + 20 + 20 + 124 + 40 + 40
+	if len(data) != size || !bytes.HasPrefix(data, RepeaterConfig) {
+		return nil, fmt.Errorf("homebrew: expected %d configuration bytes, got %d", size, len(data))
+	}
+
+	var (
+		offset = 4
+		field  = func(n int) string {
+			s := string(data[offset : offset+n])
+			offset += n
+			return strings.TrimSpace(s)
+		}
+		number = func(name string, n, base, bits int) (uint64, error) {
+			s := field(n)
+			v, err := strconv.ParseUint(s, base, bits)
+			if err != nil {
+				return 0, fmt.Errorf("homebrew: invalid %s %q", name, s)
+			}
+			return v, nil
+		}
+		coordinate = func(name string, n int) (float32, error) {
+			s := field(n)
+			v, err := strconv.ParseFloat(s, 32)
+			if err != nil {
+				return 0, fmt.Errorf("homebrew: invalid %s %q", name, s)
+			}
+			return float32(v), nil
+		}
+		config = &RepeaterConfiguration{Callsign: field(8)}
+		v      uint64
+		err    error
+	)
+	if v, err = number("ID", 8, 16, 32); err != nil {
+		return nil, err
+	}
+	config.ID = uint32(v)
+	if v, err = number("RX frequency", 9, 10, 32); err != nil {
+		return nil, err
+	}
+	config.RXFreq = uint32(v)
+	if v, err = number("TX frequency", 9, 10, 32); err != nil {
+		return nil, err
+	}
+	config.TXFreq = uint32(v)
+	if v, err = number("TX power", 2, 10, 8); err != nil {
+		return nil, err
+	}
+	config.TXPower = uint8(v)
+	if v, err = number("color code", 2, 10, 8); err != nil {
+		return nil, err
+	}
+	config.ColorCode = uint8(v)
+	if config.Latitude, err = coordinate("latitude", 8); err != nil {
+		return nil, err
+	}
+	if config.Longitude, err = coordinate("longitude", 9); err != nil {
+		return nil, err
+	}
+	if v, err = number("height", 3, 10, 16); err != nil {
+		return nil, err
+	}
+	config.Height = uint16(v)
+	config.Location = field(20)
+	config.Description = field(20)
+	config.URL = field(124)
+	config.SoftwareID = field(40)
+	config.PackageID = field(40)
+	return config, nil
+}
+
+// Validate checks if all fields fit in the configuration packet and contain
+// sane values.
+func (r *RepeaterConfiguration) Validate() error {
+	switch {
+	case r.Callsign == "":
+		return errors.New("homebrew: callsign can't be empty")
+	case len(r.Callsign) > 8:
+		return fmt.Errorf("homebrew: callsign %q exceeds 8 characters", r.Callsign)
+	}
+	for _, c := range r.Callsign {
+		if !(c >= 'A' && c <= 'Z') && !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') {
+			return fmt.Errorf("homebrew: callsign %q contains invalid character %q", r.Callsign, c)
+		}
+	}
+	if r.ID == 0 {
+		return errors.New("homebrew: repeater ID can't be 0")
+	}
+	if err := validateFrequency("RX", r.RXFreq); err != nil {
+		return err
+	}
+	if err := validateFrequency("TX", r.TXFreq); err != nil {
+		return err
+	}
+	if r.TXPower > 99 {
+		return fmt.Errorf("homebrew: TX power %d exceeds 99", r.TXPower)
+	}
+	if r.ColorCode < 1 || r.ColorCode > 15 {
+		return fmt.Errorf("homebrew: color code %d out of range 1-15", r.ColorCode)
+	}
+	if r.Latitude < -90 || r.Latitude > 90 {
+		return fmt.Errorf("homebrew: latitude %f out of range -90-90", r.Latitude)
+	}
+	if r.Longitude < -180 || r.Longitude > 180 {
+		return fmt.Errorf("homebrew: longitude %f out of range -180-180", r.Longitude)
+	}
+	if r.Height > 999 {
+		return fmt.Errorf("homebrew: height %d exceeds 999", r.Height)
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		size  int
+	}{
+		{"location", r.Location, 20},
+		{"description", r.Description, 20},
+		{"URL", r.URL, 124},
+		{"software ID", r.SoftwareID, 40},
+		{"package ID", r.PackageID, 40},
+	} {
+		if len(field.value) > field.size {
+			return fmt.Errorf("homebrew: %s exceeds %d characters", field.name, field.size)
+		}
+	}
+
+	return nil
+}
+
+// formatCoordinate formats a coordinate in exactly size characters, using the
+// highest precision that fits while keeping the sign and integer part intact.
+func formatCoordinate(v float32, size int) string {
+	// Shortest representation first, this avoids float32 rounding noise.
+	s := strconv.FormatFloat(float64(v), 'f', -1, 32)
+	if !strings.Contains(s, ".") {
+		s += "."
+	}
+	if len(s) <= size {
+		return s + strings.Repeat("0", size-len(s))
+	}
+
+	for prec := size; prec >= 0; prec-- {
+		s = strconv.FormatFloat(float64(v), 'f', prec, 32)
+		if len(s) <= size {
+			return fmt.Sprintf("%*s", size, s)
+		}
+	}
+	// Integer part doesn't fit, this is refused by Validate.
+	return s[:size]
+}
+
+func validateFrequency(name string, freq uint32) error {
+	// Zero means not reported, for example for network only repeaters.
+	if freq == 0 {
+		return nil
+	}
+	for _, band := range frequencyBands {
+		if freq >= band[0] && freq <= band[1] {
+			return nil
+		}
+	}
+	return fmt.Errorf("homebrew: %s frequency %d Hz is outside of the DMR bands", name, freq)
+}
+
 // ConfigFunc returns an actual RepeaterConfiguration instance when called.
 // This is used by the DMR repeater to poll for current configuration,
 // statistics and metrics.
@@ -0,0 +1,165 @@
+package homebrew
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatCoordinate(t *testing.T) {
+	var tests = []struct {
+		Test float32
+		Size int
+		Want string
+	}{
+		{0, 8, "0.000000"},
+		{0, 9, "0.0000000"},
+		{52.3731, 8, "52.37310"},
+		{4.8952, 9, "4.8952000"},
+		{-0.12345, 8, "-0.12345"},
+		{-10.123456, 9, "-10.12346"},
+		{-33.8688, 8, "-33.8688"},
+		{90, 8, "90.00000"},
+		{-90, 8, "-90.0000"},
+		{180, 9, "180.00000"},
+		{-179.99999, 9, "-180.0000"},
+		{151.2093, 9, "151.20930"},
+	}
+
+	for _, test := range tests {
+		got := formatCoordinate(test.Test, test.Size)
+		if len(got) != test.Size {
+			t.Fatalf("format %f failed: expected %d characters, got %q", test.Test, test.Size, got)
+		}
+		if got != test.Want {
+			t.Fatalf("format %f failed: %q != %q", test.Test, got, test.Want)
+		}
+	}
+}
+
+func TestRepeaterConfigurationString(t *testing.T) {
+	r := &RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		ColorCode: 1,
+		Latitude:  -33.8688,
+		Longitude: -179.99999,
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	s := r.String()
+	if want := 306; len(s) != want {
+		t.Fatalf("expected %d bytes, got %d", want, len(s))
+	}
+	if lat := s[42:50]; lat != "-33.8688" {
+		t.Fatalf("latitude wrong: %q", lat)
+	}
+	if lon := s[50:59]; lon != "-180.0000" {
+		t.Fatalf("longitude wrong: %q", lon)
+	}
+}
+
+func TestRepeaterConfigurationValidate(t *testing.T) {
+	var valid = func() *RepeaterConfiguration {
+		return &RepeaterConfiguration{
+			Callsign:  "PD0MZ",
+			ID:        2042214,
+			RXFreq:    438800000,
+			TXFreq:    431200000,
+			TXPower:   25,
+			ColorCode: 1,
+			Latitude:  52.3731,
+			Longitude: 4.8952,
+			Height:    30,
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	var long = strings.Repeat("x", 125)
+	for _, test := range []struct {
+		Name   string
+		Change func(*RepeaterConfiguration)
+	}{
+		{"empty callsign", func(r *RepeaterConfiguration) { r.Callsign = "" }},
+		{"callsign too long", func(r *RepeaterConfiguration) { r.Callsign = "PD0MZPD0MZ" }},
+		{"callsign with space", func(r *RepeaterConfiguration) { r.Callsign = "PD0 MZ" }},
+		{"callsign with slash", func(r *RepeaterConfiguration) { r.Callsign = "PD0MZ/P" }},
+		{"callsign not ASCII", func(r *RepeaterConfiguration) { r.Callsign = "PDØMZ" }},
+		{"ID 0", func(r *RepeaterConfiguration) { r.ID = 0 }},
+		{"RX below low VHF", func(r *RepeaterConfiguration) { r.RXFreq = 50000000 }},
+		{"RX between VHF and UHF", func(r *RepeaterConfiguration) { r.RXFreq = 300000000 }},
+		{"TX between UHF and 800 MHz", func(r *RepeaterConfiguration) { r.TXFreq = 600000000 }},
+		{"TX above 900 MHz", func(r *RepeaterConfiguration) { r.TXFreq = 1296000000 }},
+		{"TX power", func(r *RepeaterConfiguration) { r.TXPower = 100 }},
+		{"color code 0", func(r *RepeaterConfiguration) { r.ColorCode = 0 }},
+		{"color code 16", func(r *RepeaterConfiguration) { r.ColorCode = 16 }},
+		{"latitude below -90", func(r *RepeaterConfiguration) { r.Latitude = -90.5 }},
+		{"latitude above 90", func(r *RepeaterConfiguration) { r.Latitude = 91 }},
+		{"longitude below -180", func(r *RepeaterConfiguration) { r.Longitude = -180.5 }},
+		{"longitude above 180", func(r *RepeaterConfiguration) { r.Longitude = 181 }},
+		{"height", func(r *RepeaterConfiguration) { r.Height = 1000 }},
+		{"location", func(r *RepeaterConfiguration) { r.Location = long[:21] }},
+		{"description", func(r *RepeaterConfiguration) { r.Description = long[:21] }},
+		{"URL", func(r *RepeaterConfiguration) { r.URL = long }},
+		{"software ID", func(r *RepeaterConfiguration) { r.SoftwareID = long[:41] }},
+		{"package ID", func(r *RepeaterConfiguration) { r.PackageID = long[:41] }},
+	} {
+		var r = valid()
+		test.Change(r)
+		if err := r.Validate(); err == nil {
+			t.Fatalf("validate with %s succeeded", test.Name)
+		}
+	}
+
+	// Each band edge and unreported frequencies are accepted
+	for _, freq := range []uint32{0, 66000000, 88000000, 136000000, 174000000, 400000000, 527000000, 806000000, 941000000} {
+		var r = valid()
+		r.RXFreq, r.TXFreq = freq, freq
+		if err := r.Validate(); err != nil {
+			t.Fatalf("validate with frequency %d failed: %v", freq, err)
+		}
+	}
+	// Fields at their maximum length are accepted
+	var r = valid()
+	r.Callsign, r.Location, r.Description, r.URL = "PD0MZABC", long[:20], long[:20], long[:124]
+	if err := r.Validate(); err != nil {
+		t.Fatalf("validate with fields at their maximum length failed: %v", err)
+	}
+}
+
+// TestRepeaterConfigurationJSON pins the field names, they use the same
+// snake_case convention as the packet and CDR encodings.
+func TestRepeaterConfigurationJSON(t *testing.T) {
+	r := &RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		RXFreq:    438800000,
+		TXFreq:    431200000,
+		TXPower:   25,
+		ColorCode: 1,
+		Latitude:  52.5,
+		Longitude: 4.75,
+		Height:    30,
+		Location:  "Amsterdam",
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	const want = `{"callsign":"PD0MZ","id":2042214,"rx_freq":438800000,"tx_freq":431200000,"tx_power":25,"color_code":1,"latitude":52.5,"longitude":4.75,"height":30,"location":"Amsterdam"}`
+	if string(data) != want {
+		t.Fatalf("expected %s, got %s", want, data)
+	}
+
+	var got RepeaterConfiguration
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got != *r {
+		t.Fatalf("expected %+v, got %+v", r, got)
+	}
+}
@@ -0,0 +1,382 @@
+package homebrew
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// ReceivedCall is a call received on a slot.
+type ReceivedCall struct {
+	StreamID uint32
+	SrcID    uint32
+	DstID    uint32
+	CallType uint8
+	Start    time.Time
+	// LateEntry is set if the addressing of the call was taken from the
+	// embedded LC, as the voice LC header of the call wasn't received.
+	LateEntry bool
+	// PI is the privacy indicator header of an encrypted call, or nil if the
+	// call is clear or its PI header wasn't received. The PI header follows
+	// the voice LC header, so it is not yet known to OnCallStart.
+	PI *dmr.PIHeader
+
+	// Bursts of the call of which the quality was measured, with the sums
+	// of their dmr.BurstQuality, and how many had uncorrectable bits.
+	Bursts        int
+	CorrectedBits int
+	CheckedBits   int
+	Uncorrectable int
+}
+
+// BER returns the estimated bit error rate of the call, the bits corrected
+// by the FEC as a fraction of the checked bits.
+func (c ReceivedCall) BER() float64 {
+	if c.CheckedBits == 0 {
+		return 0
+	}
+	return float64(c.CorrectedBits) / float64(c.CheckedBits)
+}
+
+// Source of the Link Control of a received call.
+const (
+	lcNone uint8 = iota
+	lcHeader
+	lcEmbedded
+)
+
+// Slot is the state of one of the two TDMA timeslots of a link. A slot is
+// busy while it receives a stream or while an outbound call is active on it.
+// Stream IDs are only unique per slot, so each slot tracks its own stream.
+type Slot struct {
+	h         *Homebrew
+	number    int
+	mutex     *sync.Mutex
+	receiving bool
+	streamID  uint32       // Stream being received
+	rx        ReceivedCall // Call being received
+	rxLC      uint8        // Source of the LC of the call
+	assembler *dmr.EmbeddedLCAssembler
+	call      *OutboundCall // Active outbound call
+	last      time.Time     // Time of the last frame received or sent
+}
+
+// streamKey identifies a stream, as stream IDs are only unique per slot.
+type streamKey struct {
+	slot     uint8
+	streamID uint32
+}
+
+func newSlot(h *Homebrew, number int) *Slot {
+	return &Slot{
+		h:         h,
+		number:    number,
+		mutex:     &sync.Mutex{},
+		assembler: dmr.NewEmbeddedLCAssembler(),
+	}
+}
+
+// Slot returns timeslot 1 or 2 of the link, or nil for other numbers.
+func (h *Homebrew) Slot(number int) *Slot {
+	if number < 1 || number > len(h.slots) {
+		return nil
+	}
+	return h.slots[number-1]
+}
+
+// Number returns the number of the slot, 1 or 2.
+func (s *Slot) Number() int {
+	return s.number
+}
+
+// Busy returns true if the slot receives a stream or has an active outbound
+// call.
+func (s *Slot) Busy() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.busy()
+}
+
+// Stream returns the ID of the stream received on the slot, or false if the
+// slot doesn't receive a stream.
+func (s *Slot) Stream() (uint32, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.streamID, s.receiving
+}
+
+// Received returns the call received on the slot, or false if the slot
+// doesn't receive a call.
+func (s *Slot) Received() (ReceivedCall, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rx, s.receiving
+}
+
+// Call returns the active outbound call on the slot, or nil.
+func (s *Slot) Call() *OutboundCall {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.call
+}
+
+// LastActivity returns the time the last frame was received or sent on the
+// slot.
+func (s *Slot) LastActivity() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last
+}
+
+func (s *Slot) String() string {
+	return fmt.Sprintf("TS%d", s.number)
+}
+
+// busy returns the busy state, the caller must hold the mutex.
+func (s *Slot) busy() bool {
+	return s.receiving || s.call != nil
+}
+
+// receive tracks a received frame. It returns false if the slot already
+// receives another stream, the frame is then not counted as activity of the
+// slot. A terminator ends the stream.
+func (s *Slot) receive(p *dmr.Packet, now time.Time) bool {
+	s.mutex.Lock()
+	if s.receiving && s.streamID != p.StreamID {
+		s.mutex.Unlock()
+		return false
+	}
+	var was = s.busy()
+	if !s.receiving {
+		s.rx = ReceivedCall{
+			StreamID: p.StreamID,
+			SrcID:    p.SrcID,
+			DstID:    p.DstID,
+			CallType: p.CallType,
+			Start:    now,
+		}
+		s.rxLC = lcNone
+		s.assembler.Reset()
+	}
+	var started = s.link(p)
+	if p.DataType == dmr.PrivacyIndicator {
+		s.privacy(p)
+	}
+	if q := p.Quality; q != nil {
+		s.rx.Bursts++
+		s.rx.CorrectedBits += q.Corrected()
+		s.rx.CheckedBits += q.Bits
+		if q.Uncorrectable {
+			s.rx.Uncorrectable++
+		}
+	}
+	var call = s.rx
+	s.receiving = p.DataType != dmr.TerminatorWithLC
+	s.streamID = p.StreamID
+	s.last = now
+	var busy = s.busy()
+	s.mutex.Unlock()
+
+	s.changed(was, busy)
+	if started && s.h.OnCallStart != nil {
+		s.h.OnCallStart(s, call)
+	}
+	if s.h.OnReverseChannel != nil {
+		if command, ok := reverseChannel(p); ok {
+			s.h.OnReverseChannel(s, p, command)
+		}
+	}
+	return true
+}
+
+// reverseChannel returns the reverse channel command of a voice burst with an
+// EMB LCSS of SingleFragment, or false if the burst carries none. A null
+// embedded LC carries RCCommandNone.
+func reverseChannel(p *dmr.Packet) (uint8, bool) {
+	if len(p.Bits) < dmr.PayloadBits {
+		return 0, false
+	}
+	switch p.DataType {
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		break
+	default:
+		return 0, false
+	}
+
+	emb, _, err := dmr.ParseEMBCorrecting(p.EMBBits())
+	if err != nil || emb.LCSS != dmr.SingleFragment {
+		return 0, false
+	}
+	bits, err := dmr.ParseEmbeddedSignallingLCFromSyncBits(p.SyncBits())
+	if err != nil {
+		return 0, false
+	}
+	command, err := dmr.ParseReverseChannel(bits)
+	if err != nil || command == dmr.RCCommandNone {
+		return 0, false
+	}
+	return command, true
+}
+
+// link updates the received call with the Link Control of the voice LC
+// header or the embedded LC of the voice bursts. It returns true if the call
+// started, which is when its LC is first known. The header takes precedence
+// over the embedded LC. The caller must hold the mutex.
+func (s *Slot) link(p *dmr.Packet) bool {
+	if len(p.Bits) < dmr.PayloadBits {
+		return false
+	}
+
+	var (
+		lc     *dmr.LC
+		source uint8
+	)
+	switch p.DataType {
+	case dmr.VoiceLC:
+		var data = make([]byte, 12)
+		if err := bptc.Decode(p.InfoBits(), data); err != nil {
+			return false
+		}
+		var err error
+		if lc, err = dmr.ParseFullLCWithMask(data, dmr.VoiceLCHeaderMask); err != nil {
+			return false
+		}
+		source = lcHeader
+		break
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		emb, _, err := dmr.ParseEMBCorrecting(p.EMBBits())
+		if err != nil {
+			return false
+		}
+		fragment, err := dmr.ParseEmbeddedSignallingLCFromSyncBits(p.SyncBits())
+		if err != nil {
+			return false
+		}
+		if lc, err = s.assembler.AddFragment(emb.LCSS, fragment); err != nil || lc == nil {
+			return false
+		}
+		source = lcEmbedded
+		break
+	default:
+		return false
+	}
+	if lc.Data != nil {
+		// Not a voice channel user LC, such as talker alias
+		return false
+	}
+
+	var mismatch = lc.SrcID != s.rx.SrcID || lc.DstID != s.rx.DstID || lc.CallType != s.rx.CallType
+	switch {
+	case s.rxLC == lcNone:
+		break
+	case s.rxLC == lcHeader && source == lcEmbedded:
+		if mismatch {
+			s.h.logger().Warn("embedded LC doesn't match the voice LC header", "slot", s.number, "stream", p.StreamID,
+				"src", s.rx.SrcID, "dst", s.rx.DstID, "embedded_src", lc.SrcID, "embedded_dst", lc.DstID)
+		}
+		return false
+	case s.rxLC == lcEmbedded && source == lcHeader:
+		if mismatch {
+			s.h.logger().Warn("voice LC header doesn't match the embedded LC", "slot", s.number, "stream", p.StreamID,
+				"src", lc.SrcID, "dst", lc.DstID, "embedded_src", s.rx.SrcID, "embedded_dst", s.rx.DstID)
+		}
+	}
+
+	var started = s.rxLC == lcNone
+	s.rx.SrcID, s.rx.DstID, s.rx.CallType = lc.SrcID, lc.DstID, lc.CallType
+	s.rx.LateEntry = source == lcEmbedded
+	s.rxLC = source
+	return started
+}
+
+// privacy records the PI header of the received call, the caller must hold
+// the mutex.
+func (s *Slot) privacy(p *dmr.Packet) {
+	if len(p.Bits) < dmr.PayloadBits {
+		return
+	}
+	var data = make([]byte, dmr.InfoSize)
+	if err := bptc.Decode(p.InfoBits(), data); err != nil {
+		return
+	}
+	pi, err := dmr.ParsePIHeader(data)
+	if err != nil {
+		s.h.logger().Debug("invalid PI header", "slot", s.number, "stream", p.StreamID, "error", err)
+		return
+	}
+	s.rx.PI = pi
+}
+
+// end ends the received stream, if it is the stream received on the slot.
+func (s *Slot) end(streamID uint32) {
+	s.mutex.Lock()
+	if !s.receiving || s.streamID != streamID {
+		s.mutex.Unlock()
+		return
+	}
+	var was = s.busy()
+	s.receiving = false
+	var busy = s.busy()
+	s.mutex.Unlock()
+
+	s.changed(was, busy)
+}
+
+// reset forgets the received stream when the link closes, without calling
+// OnSlotChange.
+func (s *Slot) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.receiving = false
+}
+
+// start makes the outbound call the active call of the slot.
+func (s *Slot) start(c *OutboundCall) error {
+	s.mutex.Lock()
+	if s.call != nil {
+		s.mutex.Unlock()
+		return fmt.Errorf("homebrew: a call is already active on timeslot %d", s.number)
+	}
+	var was = s.busy()
+	s.call = c
+	s.last = time.Now()
+	s.mutex.Unlock()
+
+	s.changed(was, true)
+	return nil
+}
+
+// sent records the activity of the outbound call.
+func (s *Slot) sent(c *OutboundCall, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.call == c {
+		s.last = now
+	}
+}
+
+// stop frees the slot of the outbound call, if it is the active call.
+func (s *Slot) stop(c *OutboundCall) {
+	s.mutex.Lock()
+	if s.call != c {
+		s.mutex.Unlock()
+		return
+	}
+	var was = s.busy()
+	s.call = nil
+	var busy = s.busy()
+	s.mutex.Unlock()
+
+	s.changed(was, busy)
+}
+
+// changed calls OnSlotChange if the busy state changed, the caller must not
+// hold the mutex.
+func (s *Slot) changed(was, busy bool) {
+	if was != busy && s.h.OnSlotChange != nil {
+		s.h.OnSlotChange(s, busy)
+	}
+}
@@ -0,0 +1,346 @@
+package homebrew
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+func TestSlot(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.StreamTimeout = time.Millisecond * 50
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	type change struct {
+		slot int
+		busy bool
+	}
+	var (
+		changes    = make(chan change, 8)
+		contention []uint32
+		peer       = &Peer{ID: 2043044}
+	)
+	h.OnSlotChange = func(slot *Slot, busy bool) {
+		changes <- change{slot.Number(), busy}
+	}
+	h.OnSlotContention = func(p *dmr.Packet, streamID uint32) {
+		if streamID != 1 {
+			t.Fatalf("expected contention with stream 1, got %d", streamID)
+		}
+		contention = append(contention, p.StreamID)
+	}
+	var expect = func(slot int, busy bool) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if got.slot != slot || got.busy != busy {
+				t.Fatalf("expected slot %d busy %t, got slot %d busy %t", slot, busy, got.slot, got.busy)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected slot %d busy %t, got no change", slot, busy)
+		}
+	}
+
+	if h.Slot(0) != nil || h.Slot(3) != nil {
+		t.Fatal("expected only slots 1 and 2")
+	}
+	var slot1, slot2 = h.Slot(1), h.Slot(2)
+
+	for _, p := range []*dmr.Packet{
+		{StreamID: 1, Timeslot: 1, DataType: dmr.VoiceLC},
+		{StreamID: 1, Timeslot: 1, DataType: dmr.VoiceBurstA},
+		{StreamID: 2, Timeslot: 1, DataType: dmr.VoiceLC},
+		{StreamID: 1, Timeslot: 0, DataType: dmr.VoiceLC}, // Same stream ID on the other slot
+	} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	expect(2, true)
+	expect(1, true)
+	if streamID, ok := slot2.Stream(); !ok || streamID != 1 {
+		t.Fatalf("expected slot 2 to receive stream 1, got %d (%t)", streamID, ok)
+	}
+	switch s := h.Stats(); {
+	case len(contention) != 1 || contention[0] != 2:
+		t.Fatalf("expected contention of stream 2, got %v", contention)
+	case s.SlotContentions != 1:
+		t.Fatalf("expected 1 contention, got %d", s.SlotContentions)
+	case slot2.LastActivity().IsZero():
+		t.Fatal("expected slot 2 activity")
+	}
+
+	// The terminator ends the stream on slot 2, slot 1 times out.
+	if err := h.handlePacket(&dmr.Packet{StreamID: 1, Timeslot: 1, DataType: dmr.TerminatorWithLC}, peer); err != nil {
+		t.Fatalf("handle packet failed: %v", err)
+	}
+	expect(2, false)
+	if slot2.Busy() {
+		t.Fatal("expected slot 2 idle after terminator")
+	}
+	expect(1, false)
+	if slot1.Busy() {
+		t.Fatal("expected slot 1 idle after stream timeout")
+	}
+
+	// An outbound call makes the slot busy.
+	var c = NewOutboundCall(h)
+	c.send = func(*dmr.Packet) error { return nil }
+	if err := c.Start(2042214, 204, 1, dmr.CallTypeGroup); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	expect(1, true)
+	if slot1.Call() != c {
+		t.Fatal("expected the call on slot 1")
+	}
+	if err := c.End(); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	expect(1, false)
+	if slot1.Call() != nil {
+		t.Fatal("expected no call on slot 1 after end")
+	}
+}
+
+func TestLateEntry(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var (
+		started []ReceivedCall
+		peer    = &Peer{ID: 2043044}
+		lc      = &dmr.LC{CallType: dmr.CallTypeGroup, DstID: 204, SrcID: 2042215}
+		other   = &dmr.LC{CallType: dmr.CallTypeGroup, DstID: 91, SrcID: 2042001}
+	)
+	h.OnCallStart = func(slot *Slot, call ReceivedCall) {
+		if slot.Number() != 2 {
+			t.Fatalf("expected call on slot 2, got %d", slot.Number())
+		}
+		started = append(started, call)
+	}
+
+	var header = func(streamID uint32, lc *dmr.LC) *dmr.Packet {
+		data, err := dmr.BuildFullLC(lc, dmr.VoiceLCHeaderMask)
+		if err != nil {
+			t.Fatalf("encode lc failed: %v", err)
+		}
+		var info = make([]byte, dmr.InfoBits)
+		if err := bptc.Encode(data, info); err != nil {
+			t.Fatalf("encode bptc failed: %v", err)
+		}
+		var p = &dmr.Packet{StreamID: streamID, Timeslot: 1, DataType: dmr.VoiceLC}
+		p.SetInfoBits(info)
+		return p
+	}
+	var superframe = func(streamID uint32, lc *dmr.LC) []*dmr.Packet {
+		fragments, err := dmr.BuildEmbeddedLCFragments(lc)
+		if err != nil {
+			t.Fatalf("encode embedded lc failed: %v", err)
+		}
+		var (
+			lcss    = []uint8{dmr.FirstFragment, dmr.Continuation, dmr.Continuation, dmr.LastFragment}
+			packets = []*dmr.Packet{{StreamID: streamID, Timeslot: 1, DataType: dmr.VoiceBurstA}}
+		)
+		for i, dt := range []uint8{dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE} {
+			emb, err := dmr.BuildEMB(&dmr.EMB{ColorCode: 1, LCSS: lcss[i]})
+			if err != nil {
+				t.Fatalf("encode emb failed: %v", err)
+			}
+			sync, err := dmr.BuildSyncBitsFromEMB(emb, fragments[i])
+			if err != nil {
+				t.Fatalf("build sync failed: %v", err)
+			}
+			var p = &dmr.Packet{StreamID: streamID, Timeslot: 1, DataType: dt}
+			p.SetSyncBits(sync)
+			packets = append(packets, p)
+		}
+		return packets
+	}
+	var handle = func(packets ...*dmr.Packet) {
+		for _, p := range packets {
+			if err := h.handlePacket(p, peer); err != nil {
+				t.Fatalf("handle packet failed: %v", err)
+			}
+		}
+	}
+	var end = func(streamID uint32) {
+		handle(&dmr.Packet{StreamID: streamID, Timeslot: 1, DataType: dmr.TerminatorWithLC})
+	}
+
+	// Joined mid-stream, the call starts with the embedded LC.
+	handle(superframe(1, lc)...)
+	switch {
+	case len(started) != 1:
+		t.Fatalf("expected 1 call start, got %d", len(started))
+	case !started[0].LateEntry || started[0].StreamID != 1:
+		t.Fatalf("expected late entry of stream 1, got %+v", started[0])
+	case started[0].SrcID != lc.SrcID || started[0].DstID != lc.DstID || started[0].CallType != lc.CallType:
+		t.Fatalf("expected addressing from embedded LC, got %+v", started[0])
+	}
+	if call, ok := h.Slot(2).Received(); !ok || call.SrcID != lc.SrcID {
+		t.Fatalf("expected received call from %d, got %+v (%t)", lc.SrcID, call, ok)
+	}
+	end(1)
+	if _, ok := h.Slot(2).Received(); ok {
+		t.Fatal("expected no received call after terminator")
+	}
+
+	// The header starts the call, a mismatching embedded LC is ignored.
+	handle(header(2, lc))
+	handle(superframe(2, other)...)
+	switch {
+	case len(started) != 2:
+		t.Fatalf("expected 2 call starts, got %d", len(started))
+	case started[1].LateEntry || started[1].SrcID != lc.SrcID:
+		t.Fatalf("expected call from header, got %+v", started[1])
+	}
+	if call, _ := h.Slot(2).Received(); call.SrcID != lc.SrcID || call.DstID != lc.DstID {
+		t.Fatalf("expected header addressing to be kept, got %+v", call)
+	}
+	end(2)
+
+	// A header after the embedded LC amends the call.
+	handle(superframe(3, other)...)
+	handle(header(3, lc))
+	if call, _ := h.Slot(2).Received(); call.LateEntry || call.SrcID != lc.SrcID {
+		t.Fatalf("expected call amended by the header, got %+v", call)
+	}
+	if len(started) != 3 {
+		t.Fatalf("expected 3 call starts, got %d", len(started))
+	}
+}
+
+func TestMaxBER(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.MaxBER = 0.02
+
+	var passed int
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error {
+		passed++
+		return nil
+	})
+
+	var burst = func(bitErrors int) *dmr.Packet {
+		// Voice burst A with the AMBE+2 silence frame
+		data, _ := hex.DecodeString("b9e881526173002a6bb9e881526755fd7df75f7173002a6bb9e881526173002a6b")
+		var p = &dmr.Packet{StreamID: 1, Timeslot: 1, DataType: dmr.VoiceBurstA}
+		p.SetData(data)
+		// A bit error in each of the AMBE+2 frames, around the voice sync
+		for _, i := range []int{1, 80, 200}[:bitErrors] {
+			p.Bits[i] ^= 1
+		}
+		return p
+	}
+
+	var peer = &Peer{ID: 2043044}
+	for _, p := range []*dmr.Packet{burst(0), burst(3), burst(1)} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	call, ok := h.Slot(2).Received()
+	switch {
+	case passed != 2:
+		t.Fatalf("expected 2 bursts passed, got %d", passed)
+	case h.Stats().FramesPoor != 1:
+		t.Fatalf("expected 1 poor frame, got %d", h.Stats().FramesPoor)
+	case !ok || call.Bursts != 3 || call.CorrectedBits != 4:
+		t.Fatalf("expected 3 bursts with 4 corrected bits, got %+v (%t)", call, ok)
+	case call.BER() <= 0 || call.Uncorrectable != 0:
+		t.Fatalf("unexpected call quality %+v", call)
+	}
+}
+
+func TestReverseChannel(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var (
+		commands []uint8
+		peer     = &Peer{ID: 2043044}
+	)
+	h.OnReverseChannel = func(slot *Slot, p *dmr.Packet, command uint8) {
+		if slot.Number() != 1 || p.StreamID != 1 {
+			t.Fatalf("expected stream 1 on slot 1, got stream %d on slot %d", p.StreamID, slot.Number())
+		}
+		commands = append(commands, command)
+	}
+
+	var burst = func(lcss, command uint8) *dmr.Packet {
+		emb, err := dmr.BuildEMB(&dmr.EMB{ColorCode: 1, LCSS: lcss})
+		if err != nil {
+			t.Fatalf("encode emb failed: %v", err)
+		}
+		rc, err := dmr.BuildReverseChannel(command)
+		if err != nil {
+			t.Fatalf("encode reverse channel failed: %v", err)
+		}
+		sync, err := dmr.BuildSyncBitsFromEMB(emb, rc)
+		if err != nil {
+			t.Fatalf("build sync failed: %v", err)
+		}
+		var p = &dmr.Packet{StreamID: 1, Timeslot: 0, DataType: dmr.VoiceBurstF}
+		p.SetSyncBits(sync)
+		return p
+	}
+
+	for _, p := range []*dmr.Packet{
+		burst(dmr.SingleFragment, 5),
+		burst(dmr.SingleFragment, dmr.RCCommandNone), // Null embedded LC
+		burst(dmr.Continuation, 5),                   // Embedded LC fragment
+	} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	if len(commands) != 1 || commands[0] != 5 {
+		t.Fatalf("expected command 5, got %v", commands)
+	}
+}
+
+func TestPIHeader(t *testing.T) {
+	h := testHomebrew(t)
+	defer h.Close()
+	h.SetPacketFunc(func(dmr.Repeater, *dmr.Packet) error { return nil })
+
+	var burst = func(dataType uint8, data []byte) *dmr.Packet {
+		var info = make([]byte, dmr.InfoBits)
+		if err := bptc.Encode(data, info); err != nil {
+			t.Fatalf("encode bptc failed: %v", err)
+		}
+		var p = &dmr.Packet{StreamID: 1, Timeslot: 0, DataType: dataType}
+		p.SetInfoBits(info)
+		return p
+	}
+	lc, err := dmr.BuildFullLC(&dmr.LC{CallType: dmr.CallTypeGroup, DstID: 91, SrcID: 2042214}, dmr.VoiceLCHeaderMask)
+	if err != nil {
+		t.Fatalf("encode lc failed: %v", err)
+	}
+	pi, err := (&dmr.PIHeader{AlgID: dmr.AlgIDAES256, KeyID: 5, MI: 0x5f3a91c4, DstID: 91}).Bytes()
+	if err != nil {
+		t.Fatalf("encode pi header failed: %v", err)
+	}
+
+	var peer = &Peer{ID: 2043044}
+	for _, p := range []*dmr.Packet{burst(dmr.VoiceLC, lc), burst(dmr.PrivacyIndicator, pi)} {
+		if err := h.handlePacket(p, peer); err != nil {
+			t.Fatalf("handle packet failed: %v", err)
+		}
+	}
+	call, ok := h.Slot(1).Received()
+	switch {
+	case !ok:
+		t.Fatal("expected a received call")
+	case call.PI == nil:
+		t.Fatal("expected the PI header of the call")
+	case call.PI.AlgID != dmr.AlgIDAES256 || call.PI.KeyID != 5 || call.PI.MI != 0x5f3a91c4:
+		t.Fatalf("unexpected PI header %s", call.PI)
+	}
+}
@@ -0,0 +1,108 @@
+package homebrew
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains the operational counters of a Homebrew link.
+type Stats struct {
+	BytesSent       uint64
+	BytesReceived   uint64
+	FramesReceived  uint64
+	FramesSent      uint64
+	KeepalivesSent  uint64
+	KeepalivesAcked uint64
+	LoginAttempts   uint64
+	LoginFailures   uint64 // Logins refused or not answered
+	CallsObserved   uint64
+	Slot1Calls      uint64 // Calls observed on timeslot 1
+	Slot2Calls      uint64 // Calls observed on timeslot 2
+	PacketsDropped  uint64 // Packets from unknown addresses
+	FramesDropped   uint64 // Frames dropped because the receive queue was full
+	FramesAccepted  uint64 // Frames passed by the AcceptFunc
+	FramesFiltered  uint64 // Frames rejected by the AcceptFunc
+	SlotContentions uint64 // Frames received for a timeslot receiving another stream
+	FramesPoor      uint64 // Frames dropped for a bit error rate above MaxBER
+
+	KeepaliveRTT time.Duration // Round trip time of the last acknowledged ping
+	Peers        []PeerStats
+}
+
+// PeerStats contains the keepalive state of a peer.
+type PeerStats struct {
+	ID                 uint32
+	Addr               string
+	Status             AuthStatus
+	LastPacketSent     time.Time
+	LastPacketReceived time.Time
+	LastPingSent       time.Time
+	LastPingReceived   time.Time
+	LastPongReceived   time.Time
+	RTT                time.Duration // Round trip time of the last ping
+	LoginRetries       int           // Logins sent again since the last login
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("bytes %d/%d, frames %d/%d, keepalives %d/%d, logins %d/%d, calls %d (%d/%d), dropped %d/%d/%d, accepted %d/%d, contentions %d, rtt %s",
+		s.BytesSent, s.BytesReceived, s.FramesSent, s.FramesReceived,
+		s.KeepalivesSent, s.KeepalivesAcked, s.LoginAttempts, s.LoginFailures,
+		s.CallsObserved, s.Slot1Calls, s.Slot2Calls, s.PacketsDropped, s.FramesDropped, s.FramesPoor,
+		s.FramesAccepted, s.FramesFiltered, s.SlotContentions, s.KeepaliveRTT)
+}
+
+// snapshot returns a copy of the counters, loaded atomically.
+func (s *Stats) snapshot() Stats {
+	return Stats{
+		BytesSent:       atomic.LoadUint64(&s.BytesSent),
+		BytesReceived:   atomic.LoadUint64(&s.BytesReceived),
+		FramesReceived:  atomic.LoadUint64(&s.FramesReceived),
+		FramesSent:      atomic.LoadUint64(&s.FramesSent),
+		KeepalivesSent:  atomic.LoadUint64(&s.KeepalivesSent),
+		KeepalivesAcked: atomic.LoadUint64(&s.KeepalivesAcked),
+		LoginAttempts:   atomic.LoadUint64(&s.LoginAttempts),
+		LoginFailures:   atomic.LoadUint64(&s.LoginFailures),
+		CallsObserved:   atomic.LoadUint64(&s.CallsObserved),
+		Slot1Calls:      atomic.LoadUint64(&s.Slot1Calls),
+		Slot2Calls:      atomic.LoadUint64(&s.Slot2Calls),
+		PacketsDropped:  atomic.LoadUint64(&s.PacketsDropped),
+		FramesDropped:   atomic.LoadUint64(&s.FramesDropped),
+		FramesAccepted:  atomic.LoadUint64(&s.FramesAccepted),
+		FramesFiltered:  atomic.LoadUint64(&s.FramesFiltered),
+		SlotContentions: atomic.LoadUint64(&s.SlotContentions),
+		FramesPoor:      atomic.LoadUint64(&s.FramesPoor),
+		KeepaliveRTT:    time.Duration(atomic.LoadInt64((*int64)(&s.KeepaliveRTT))),
+	}
+}
+
+// Stats returns a snapshot of the link statistics, including the keepalive
+// state of the peers.
+func (h *Homebrew) Stats() Stats {
+	var s = h.stats.snapshot()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, peer := range h.Peer {
+		peer.mutex.Lock()
+		var ps = PeerStats{
+			ID:                 peer.ID,
+			Status:             peer.Status,
+			LastPacketSent:     peer.Last.PacketSent,
+			LastPacketReceived: peer.Last.PacketReceived,
+			LastPingSent:       peer.Last.PingSent,
+			LastPingReceived:   peer.Last.PingReceived,
+			LastPongReceived:   peer.Last.PongReceived,
+			RTT:                peer.rtt,
+			LoginRetries:       peer.loginRetries,
+		}
+		if peer.Addr != nil {
+			ps.Addr = peer.Addr.String()
+		}
+		peer.mutex.Unlock()
+		s.Peers = append(s.Peers, ps)
+	}
+	sort.Slice(s.Peers, func(i, j int) bool { return s.Peers[i].ID < s.Peers[j].ID })
+	return s
+}
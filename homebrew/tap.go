@@ -0,0 +1,27 @@
+package homebrew
+
+import "net"
+
+// Direction of a datagram passed to a TapFunc.
+type Direction uint8
+
+// Directions
+const (
+	Received Direction = iota
+	Sent
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Received:
+		return "received"
+	case Sent:
+		return "sent"
+	}
+	return "unknown"
+}
+
+// TapFunc is called with every datagram a link sends or receives, addr is
+// the remote address. The data is only valid during the call, it must be
+// copied to be retained.
+type TapFunc func(direction Direction, addr *net.UDPAddr, data []byte)
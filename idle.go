@@ -0,0 +1,34 @@
+package dmr
+
+// IdleBurst returns the payload bits of an idle burst, which a repeater
+// sends on a timeslot without traffic to keep the TDMA structure alive. The
+// info carries the null message, of which the BPTC (196, 96) codeword has all
+// bits zero, the Slot Type has the color code and data type Idle and the
+// SYNC is the BS sourced data sync.
+func IdleBurst(colorCode uint8) ([]byte, error) {
+	slotType, err := BuildSlotType(colorCode, Idle)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &Packet{DataType: Idle}
+	p.SetInfoBits(make([]byte, InfoBits))
+	p.SetSlotTypeBits(slotType)
+	p.SetSyncBits(SyncPatternBits(SyncPatternBSSourcedData))
+	return p.Bits, nil
+}
+
+// SilenceBurst returns the payload bits of a voice burst with three AMBE+2
+// silence frames around the 48 center bits, which are either a voice sync or
+// the EMB with an embedded signalling fragment, see BuildVoiceBurst. It fills
+// in for voice bursts lost or not available in time mid-call.
+func SilenceBurst(center []byte) ([]byte, error) {
+	var (
+		frame  = BytesToBits(ambeSilence)[:AMBEFrameBits]
+		frames [AMBEBurstFrame][]byte
+	)
+	for i := range frames {
+		frames[i] = frame
+	}
+	return BuildVoiceBurst(frames, center)
+}
@@ -0,0 +1,68 @@
+package dmr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestIdleBurst(t *testing.T) {
+	bits, err := IdleBurst(7)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if len(bits) != PayloadBits {
+		t.Fatalf("expected %d bits, got %d", PayloadBits, len(bits))
+	}
+
+	var p = &Packet{DataType: Idle, Bits: bits}
+	st, err := ParseSlotType(p.SlotTypeBits())
+	switch {
+	case err != nil:
+		t.Fatalf("parse slot type failed: %v", err)
+	case st.ColorCode != 7 || st.DataType != Idle:
+		t.Fatalf("expected color code 7 and idle, got %+v", st)
+	case SyncPattern(p.SyncBits()) != SyncPatternBSSourcedData:
+		t.Fatalf("expected BS sourced data sync, got %s", SyncPatternName[SyncPattern(p.SyncBits())])
+	case !bytes.Equal(p.InfoBits(), make([]byte, InfoBits)):
+		t.Fatal("expected null info bits")
+	}
+	if q := MeasureBurstQuality(p); q.Corrected() != 0 || q.Uncorrectable {
+		t.Fatalf("expected a clean burst, got %+v", q)
+	}
+
+	if _, err := IdleBurst(16); err == nil {
+		t.Fatal("build with color code 16 succeeded")
+	}
+}
+
+func TestSilenceBurst(t *testing.T) {
+	bits, err := SilenceBurst(SyncPatternBits(SyncPatternBSSourcedVoice))
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if burst, _ := hex.DecodeString(testSilenceBurst); !bytes.Equal(BitsToBytes(bits), burst) {
+		t.Fatalf("expected %x, got %x", burst, BitsToBytes(bits))
+	}
+
+	var p = &Packet{DataType: VoiceBurstA, Bits: bits}
+	frames, err := SplitAMBEFrames(p.VoiceBits())
+	if err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	for i, frame := range frames {
+		data, n, err := DecodeAMBEFrame(frame)
+		switch {
+		case err != nil:
+			t.Fatalf("decode frame %d failed: %v", i, err)
+		case n != 0:
+			t.Fatalf("decode frame %d: corrected %d bits", i, n)
+		case !bytes.Equal(BitsToBytes(append(data, make([]byte, 7)...)), testSilenceData):
+			t.Fatalf("decode frame %d: got %x", i, BitsToBytes(data))
+		}
+	}
+
+	if _, err := SilenceBurst(make([]byte, 47)); err == nil {
+		t.Fatal("build with 47 center bits succeeded")
+	}
+}
@@ -195,8 +195,6 @@ func (c *IPSC) Run() error {
 
 		go c.parse(peer, c.payload(b[:n]))
 	}
-
-	return nil
 }
 
 func (c *IPSC) authenticate(data []byte) bool {
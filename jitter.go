@@ -0,0 +1,159 @@
+package dmr
+
+import (
+	"sync"
+	"time"
+)
+
+// Jitter buffer defaults.
+const (
+	DefaultJitterDepth    = 4                     // Frames
+	DefaultJitterInterval = time.Millisecond * 60 // A voice burst carries three 20 ms AMBE+2 frames
+)
+
+// JitterBuffer smooths the variable timing of frames received from the
+// network, it delivers the frames to OnFrame at a steady Interval. The buffer
+// holds up to Depth frames, delivery starts when it is half full. If the
+// buffer is full the oldest frame is dropped, if it runs empty before the
+// terminator of a stream OnUnderrun is called and the buffer fills up again
+// before delivery resumes.
+type JitterBuffer struct {
+	Depth    int
+	Interval time.Duration
+
+	// OnFrame is called with each frame, at the Interval.
+	OnFrame func(p *Packet)
+	// OnUnderrun is called if the buffer ran empty during a stream.
+	OnUnderrun func(streamID uint32)
+
+	mutex    *sync.Mutex
+	queue    []*Packet
+	playing  bool   // Delivering frames, until an underrun or the terminator
+	streamID uint32 // Stream of the last delivered frame, while playing
+	dropped  int
+	stop     chan struct{}
+}
+
+// NewJitterBuffer returns a jitter buffer with the default depth and
+// interval. Delivery starts after Start.
+func NewJitterBuffer() *JitterBuffer {
+	return &JitterBuffer{
+		Depth:    DefaultJitterDepth,
+		Interval: DefaultJitterInterval,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// PacketFunc can be installed as the PacketFunc of a Repeater.
+func (j *JitterBuffer) PacketFunc(_ Repeater, p *Packet) error {
+	j.Push(p)
+	return nil
+}
+
+// Push adds a copy of the frame to the buffer, if the buffer is full the
+// oldest frame is dropped.
+func (j *JitterBuffer) Push(p *Packet) {
+	if p == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if len(j.queue) >= j.depth() {
+		j.queue = j.queue[1:]
+		j.dropped++
+	}
+	j.queue = append(j.queue, p.Clone())
+}
+
+// Len returns the number of buffered frames.
+func (j *JitterBuffer) Len() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.queue)
+}
+
+// Dropped returns the number of frames dropped because the buffer was full.
+func (j *JitterBuffer) Dropped() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.dropped
+}
+
+// Start starts delivering frames, it does nothing if the buffer already
+// started.
+func (j *JitterBuffer) Start() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.stop != nil {
+		return
+	}
+	var interval = j.Interval
+	if interval <= 0 {
+		interval = DefaultJitterInterval
+	}
+	j.stop = make(chan struct{})
+
+	go func(stop <-chan struct{}) {
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				j.tick()
+			case <-stop:
+				return
+			}
+		}
+	}(j.stop)
+}
+
+// Stop stops delivering frames, buffered frames are kept.
+func (j *JitterBuffer) Stop() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.stop != nil {
+		close(j.stop)
+		j.stop = nil
+	}
+}
+
+// tick delivers the next frame.
+func (j *JitterBuffer) tick() {
+	j.mutex.Lock()
+	if !j.playing {
+		if len(j.queue) == 0 || len(j.queue) < (j.depth()+1)/2 {
+			j.mutex.Unlock()
+			return
+		}
+		j.playing = true
+	}
+	if len(j.queue) == 0 {
+		var streamID = j.streamID
+		j.playing = false
+		j.mutex.Unlock()
+		if j.OnUnderrun != nil {
+			j.OnUnderrun(streamID)
+		}
+		return
+	}
+
+	var p = j.queue[0]
+	j.queue[0] = nil
+	j.queue = j.queue[1:]
+	j.streamID = p.StreamID
+	if p.DataType == TerminatorWithLC {
+		j.playing = len(j.queue) > 0
+	}
+	j.mutex.Unlock()
+
+	if j.OnFrame != nil {
+		j.OnFrame(p)
+	}
+}
+
+func (j *JitterBuffer) depth() int {
+	if j.Depth <= 0 {
+		return DefaultJitterDepth
+	}
+	return j.Depth
+}
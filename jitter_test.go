@@ -0,0 +1,78 @@
+package dmr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterBuffer(t *testing.T) {
+	var (
+		j         = NewJitterBuffer()
+		delivered []uint8
+		underrun  []uint32
+	)
+	j.OnFrame = func(p *Packet) { delivered = append(delivered, p.Sequence) }
+	j.OnUnderrun = func(streamID uint32) { underrun = append(underrun, streamID) }
+	var push = func(seqs ...uint8) {
+		for _, seq := range seqs {
+			j.Push(&Packet{StreamID: 1, Sequence: seq, DataType: VoiceBurstA})
+		}
+	}
+
+	// Delivery starts when the buffer is half full
+	push(0)
+	j.tick()
+	if len(delivered) != 0 {
+		t.Fatalf("expected no frames before the buffer filled, got %v", delivered)
+	}
+	push(1)
+	j.tick()
+	j.tick()
+	j.tick()
+	switch {
+	case len(delivered) != 2 || delivered[0] != 0 || delivered[1] != 1:
+		t.Fatalf("expected frames 0 and 1, got %v", delivered)
+	case len(underrun) != 1 || underrun[0] != 1:
+		t.Fatalf("expected an underrun of stream 1, got %v", underrun)
+	}
+
+	// The oldest frames are dropped when the buffer is full
+	delivered = nil
+	push(2, 3, 4, 5, 6, 7)
+	if j.Len() != 4 || j.Dropped() != 2 {
+		t.Fatalf("expected 4 buffered and 2 dropped frames, got %d and %d", j.Len(), j.Dropped())
+	}
+	// The buffered frame is a copy
+	var terminator = &Packet{StreamID: 1, Sequence: 8, DataType: TerminatorWithLC}
+	j.Push(terminator)
+	terminator.Sequence = 9
+	for i := 0; i < 6; i++ {
+		j.tick()
+	}
+	if len(delivered) != 4 || delivered[0] != 5 || delivered[3] != 8 {
+		t.Fatalf("expected frames 5 to 8, got %v", delivered)
+	}
+	if len(underrun) != 1 {
+		t.Fatalf("expected no underrun after the terminator, got %v", underrun)
+	}
+
+	// Frames are delivered at the interval
+	var ch = make(chan time.Time, 4)
+	j.OnFrame = func(*Packet) { ch <- time.Now() }
+	j.Interval = time.Millisecond * 10
+	j.Start()
+	j.Start()
+	defer j.Stop()
+	var start = time.Now()
+	push(9, 10)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("frame not delivered")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*10 {
+		t.Fatalf("frames delivered in %s", elapsed)
+	}
+}
@@ -0,0 +1,584 @@
+package dmr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pd0mz/go-dmr/fec/rs"
+)
+
+// Priority Levels
+const (
+	NoPriority uint8 = iota
+	Priority1
+	Priority2
+	Priority3
+)
+
+// PriorityName is a map of priority level to string.
+var PriorityName = map[uint8]string{
+	NoPriority: "no priority",
+	Priority1:  "priority 1",
+	Priority2:  "priority 2",
+	Priority3:  "priority 3",
+}
+
+// ServiceOptions as per DMR part 2, section 7.2.1.
+type ServiceOptions struct {
+	// Emergency service
+	Emergency bool
+	// Not defined in document
+	Privacy bool
+	// Broadcast service (only defined in group calls)
+	Broadcast bool
+	// Open Voice Call Mode
+	OpenVoiceCallMode bool
+	// Priority 3 (0b11) is the highest priority
+	Priority uint8
+}
+
+// Byte packs the service options to a single byte.
+func (so *ServiceOptions) Byte() byte {
+	var b byte
+	if so.Emergency {
+		b |= B00000001
+	}
+	if so.Privacy {
+		b |= B00000010
+	}
+	if so.Broadcast {
+		b |= B00010000
+	}
+	if so.OpenVoiceCallMode {
+		b |= B00100000
+	}
+	b |= (so.Priority << 6)
+	return b
+}
+
+// String representatation of the service options.
+func (so *ServiceOptions) String() string {
+	var part = []string{}
+	if so.Emergency {
+		part = append(part, "emergency")
+	}
+	if so.Privacy {
+		part = append(part, "privacy")
+	}
+	if so.Broadcast {
+		part = append(part, "broadcast")
+	}
+	if so.OpenVoiceCallMode {
+		part = append(part, "Open Voice Call Mode")
+	}
+	part = append(part, fmt.Sprintf("%s (%d)", PriorityName[so.Priority], so.Priority))
+	return strings.Join(part, ", ")
+}
+
+// ParseServiceOptions parses the service options byte.
+func ParseServiceOptions(data byte) ServiceOptions {
+	return ServiceOptions{
+		Emergency:         (data & B00000001) > 0,
+		Privacy:           (data & B00000010) > 0,
+		Broadcast:         (data & B00010000) > 0,
+		OpenVoiceCallMode: (data & B00100000) > 0,
+		Priority:          (data & B11000000) >> 6,
+	}
+}
+
+// Full Link Control Opcode
+const (
+	GroupVoiceChannelUser      uint8 = 0x00 // B000000
+	UnitToUnitVoiceChannelUser uint8 = 0x03 // B000011
+	TalkerAliasHeader          uint8 = 0x04 // B000100
+	TalkerAliasBlock1          uint8 = 0x05 // B000101
+	TalkerAliasBlock2          uint8 = 0x06 // B000110
+	TalkerAliasBlock3          uint8 = 0x07 // B000111
+	GPSInfo                    uint8 = 0x08 // B001000
+)
+
+// FLCOName is a map of Full Link Control Opcode to string.
+var FLCOName = map[uint8]string{
+	GroupVoiceChannelUser:      "group voice channel user",
+	UnitToUnitVoiceChannelUser: "unit to unit voice channel user",
+	TalkerAliasHeader:          "talker alias header",
+	TalkerAliasBlock1:          "talker alias block 1",
+	TalkerAliasBlock2:          "talker alias block 2",
+	TalkerAliasBlock3:          "talker alias block 3",
+	GPSInfo:                    "gps info",
+}
+
+// StandardFeatureSetID is the Feature Set ID of the ETSI standardised
+// opcodes, other values are manufacturer specific.
+const StandardFeatureSetID uint8 = 0x00
+
+// lcCallType maps the voice channel user opcodes to their call type.
+var lcCallType = map[uint8]uint8{
+	GroupVoiceChannelUser:      CallTypeGroup,
+	UnitToUnitVoiceChannelUser: CallTypePrivate,
+}
+
+// lcData maps the other standardised opcodes to their LCData parser.
+var lcData = map[uint8]func() LCData{
+	TalkerAliasHeader: func() LCData { return &TalkerAliasHeaderLC{} },
+	TalkerAliasBlock1: func() LCData { return &TalkerAliasBlockLC{} },
+	TalkerAliasBlock2: func() LCData { return &TalkerAliasBlockLC{} },
+	TalkerAliasBlock3: func() LCData { return &TalkerAliasBlockLC{} },
+	GPSInfo:           func() LCData { return &GPSInfoLC{} },
+}
+
+// LCSize is the size of a packed Link Control message in bytes.
+const LCSize = 9
+
+// LC is a Link Control message. For the voice channel user opcodes the call
+// is described by the CallType, ServiceOptions, DstID and SrcID fields, all
+// other opcodes carry their content in Data.
+type LC struct {
+	CallType       uint8
+	Opcode         uint8
+	FeatureSetID   uint8
+	ServiceOptions ServiceOptions
+	DstID          uint32
+	SrcID          uint32
+	Data           LCData
+}
+
+// LCData is the opcode specific content of a Link Control message that does
+// not describe a voice channel user.
+type LCData interface {
+	String() string
+	Write([]byte) error
+	Parse([]byte) error
+}
+
+// Bytes packs the Link Control message to bytes. It returns nil if the
+// message can't be packed, use MarshalBinary to get the reason.
+func (lc *LC) Bytes() []byte {
+	data, err := lc.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// MarshalBinary packs the Link Control message to bytes.
+func (lc *LC) MarshalBinary() ([]byte, error) {
+	var data = make([]byte, LCSize)
+
+	if lc.Data != nil {
+		if err := lc.Data.Write(data); err != nil {
+			return nil, err
+		}
+		data[1] = lc.FeatureSetID
+		return data, nil
+	}
+
+	switch lc.CallType {
+	case CallTypeGroup:
+		data[0] = GroupVoiceChannelUser
+		break
+	case CallTypePrivate:
+		data[0] = UnitToUnitVoiceChannelUser
+		break
+	default:
+		return nil, fmt.Errorf("dmr/lc: unsupported call type %d", lc.CallType)
+	}
+
+	data[1] = lc.FeatureSetID
+	data[2] = lc.ServiceOptions.Byte()
+	data[3] = uint8(lc.DstID >> 16)
+	data[4] = uint8(lc.DstID >> 8)
+	data[5] = uint8(lc.DstID)
+	data[6] = uint8(lc.SrcID >> 16)
+	data[7] = uint8(lc.SrcID >> 8)
+	data[8] = uint8(lc.SrcID)
+	return data, nil
+}
+
+func (lc *LC) String() string {
+	if lc.Data != nil {
+		return fmt.Sprintf("%s, feature set id %d (opcode %d)",
+			lc.Data.String(), lc.FeatureSetID, lc.Opcode)
+	}
+	return fmt.Sprintf("call type %s, feature set id %d, %d->%d, service options %s",
+		CallTypeName[lc.CallType], lc.FeatureSetID, lc.SrcID, lc.DstID, lc.ServiceOptions.String())
+}
+
+// GPS position error
+const (
+	PositionErrorLessThan2m uint8 = iota
+	PositionErrorLessThan20m
+	PositionErrorLessThan200m
+	PositionErrorLessThan2km
+	PositionErrorLessThan20km
+	PositionErrorLessThan200km
+	PositionErrorMoreThan200km
+	PositionErrorUnknown
+)
+
+// PositionErrorName is a map of GPS position error to string.
+var PositionErrorName = map[uint8]string{
+	PositionErrorLessThan2m:    "< 2 m",
+	PositionErrorLessThan20m:   "< 20 m",
+	PositionErrorLessThan200m:  "< 200 m",
+	PositionErrorLessThan2km:   "< 2 km",
+	PositionErrorLessThan20km:  "< 20 km",
+	PositionErrorLessThan200km: "<= 200 km",
+	PositionErrorMoreThan200km: "> 200 km",
+	PositionErrorUnknown:       "not known",
+}
+
+// GPSInfoLC is the GPS Info LC, see DMR part 2, section 7.1.1.3.
+type GPSInfoLC struct {
+	PositionError uint8
+	// Longitude in degrees, positive is east.
+	Longitude float64
+	// Latitude in degrees, positive is north.
+	Latitude float64
+}
+
+func (d *GPSInfoLC) String() string {
+	return fmt.Sprintf("gps info, latitude %.5f, longitude %.5f, position error %s",
+		d.Latitude, d.Longitude, PositionErrorName[d.PositionError])
+}
+
+func (d *GPSInfoLC) Parse(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+
+	// 4 reserved bits, 3 bits position error, 25 bits longitude, 24 bits latitude
+	var v uint64
+	for _, b := range data[2:] {
+		v = v<<8 | uint64(b)
+	}
+
+	var (
+		lon = int32(v>>24) << 7 >> 7 // sign extend 25 bits
+		lat = int32(v) << 8 >> 8     // sign extend 24 bits
+	)
+	d.PositionError = uint8(v>>49) & 0x07
+	d.Longitude = float64(lon) * 360 / (1 << 25)
+	d.Latitude = float64(lat) * 180 / (1 << 24)
+	return nil
+}
+
+func (d *GPSInfoLC) Write(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	if d.PositionError > PositionErrorUnknown {
+		return fmt.Errorf("dmr/lc: position error %d out of range", d.PositionError)
+	}
+	if d.Longitude < -180 || d.Longitude >= 180 {
+		return fmt.Errorf("dmr/lc: longitude %f out of range", d.Longitude)
+	}
+	if d.Latitude < -90 || d.Latitude >= 90 {
+		return fmt.Errorf("dmr/lc: latitude %f out of range", d.Latitude)
+	}
+
+	var (
+		lon = uint64(int32(d.Longitude*(1<<25)/360)) & 0x1ffffff
+		lat = uint64(int32(d.Latitude*(1<<24)/180)) & 0xffffff
+		v   = uint64(d.PositionError)<<49 | lon<<24 | lat
+	)
+	data[0] |= GPSInfo
+	for i := 8; i > 1; i-- {
+		data[i] = uint8(v)
+		v >>= 8
+	}
+	return nil
+}
+
+// APRSToCall is the APRS destination used for position reports.
+const APRSToCall = "APZDMR"
+
+// ToAPRS formats the position as an APRS-IS position report without timestamp
+// from callsign, with the position error as comment.
+func (d *GPSInfoLC) ToAPRS(callsign string) string {
+	return fmt.Sprintf("%s>%s,TCPIP*:!%s/%s[DMR, position error %s",
+		callsign, APRSToCall,
+		aprsCoordinate(d.Latitude, 2, 'N', 'S'),
+		aprsCoordinate(d.Longitude, 3, 'E', 'W'),
+		PositionErrorName[d.PositionError])
+}
+
+// aprsCoordinate formats degrees as APRS degrees and minutes with hundredths.
+func aprsCoordinate(v float64, digits int, pos, neg byte) string {
+	var hemisphere = pos
+	if v < 0 {
+		v, hemisphere = -v, neg
+	}
+	var hundredths = int(v*6000 + 0.5) // minutes * 100
+	return fmt.Sprintf("%0*d%02d.%02d%c", digits, hundredths/6000, hundredths%6000/100, hundredths%100, hemisphere)
+}
+
+var _ (LCData) = (*GPSInfoLC)(nil)
+
+// Talker alias data format
+const (
+	TalkerAlias7Bit uint8 = iota
+	TalkerAliasISO8Bit
+	TalkerAliasUTF8
+	TalkerAliasUTF16
+)
+
+// TalkerAliasFormatName is a map of talker alias data format to string.
+var TalkerAliasFormatName = map[uint8]string{
+	TalkerAlias7Bit:    "7 bit",
+	TalkerAliasISO8Bit: "ISO 8 bit",
+	TalkerAliasUTF8:    "unicode utf-8",
+	TalkerAliasUTF16:   "unicode utf-16be",
+}
+
+// Talker alias data bits carried by the header and block LCs.
+const (
+	TalkerAliasHeaderBits = 49
+	TalkerAliasBlockBits  = 56
+)
+
+// TalkerAliasHeaderLC is the Talker Alias header LC, see DMR part 2, section 7.1.1.4.
+type TalkerAliasHeaderLC struct {
+	Format uint8
+	// Length of the alias in characters.
+	Length uint8
+	// Data contains the first TalkerAliasHeaderBits bits of the alias.
+	Data []byte
+}
+
+func (d *TalkerAliasHeaderLC) String() string {
+	return fmt.Sprintf("talker alias header, format %s, length %d",
+		TalkerAliasFormatName[d.Format], d.Length)
+}
+
+func (d *TalkerAliasHeaderLC) Parse(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	d.Format = (data[2] & B11000000) >> 6
+	d.Length = (data[2] & B00111110) >> 1
+	d.Data = BytesToBits(data[2:])[7:]
+	return nil
+}
+
+func (d *TalkerAliasHeaderLC) Write(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	if len(d.Data) != TalkerAliasHeaderBits {
+		return fmt.Errorf("dmr/lc: expected %d talker alias bits, got %d", TalkerAliasHeaderBits, len(d.Data))
+	}
+	if d.Format > TalkerAliasUTF16 {
+		return fmt.Errorf("dmr/lc: talker alias format %d out of range", d.Format)
+	}
+	if d.Length > 31 {
+		return fmt.Errorf("dmr/lc: talker alias length %d out of range", d.Length)
+	}
+
+	var bits = make([]byte, 7)
+	bits[0] = (d.Format >> 1) & 0x01
+	bits[1] = d.Format & 0x01
+	for i := 0; i < 5; i++ {
+		bits[2+i] = (d.Length >> uint(4-i)) & 0x01
+	}
+	data[0] |= TalkerAliasHeader
+	copy(data[2:], BitsToBytes(append(bits, d.Data...)))
+	return nil
+}
+
+var _ (LCData) = (*TalkerAliasHeaderLC)(nil)
+
+// TalkerAliasBlockLC is one of the Talker Alias block LCs, see DMR part 2, section 7.1.1.5.
+type TalkerAliasBlockLC struct {
+	// Block number, 1 to 3.
+	Block uint8
+	// Data contains TalkerAliasBlockBits bits of the alias.
+	Data []byte
+}
+
+func (d *TalkerAliasBlockLC) String() string {
+	return fmt.Sprintf("talker alias block %d", d.Block)
+}
+
+func (d *TalkerAliasBlockLC) Parse(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	d.Block = (data[0] & B00111111) - TalkerAliasHeader
+	d.Data = BytesToBits(data[2:])
+	return nil
+}
+
+func (d *TalkerAliasBlockLC) Write(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	if len(d.Data) != TalkerAliasBlockBits {
+		return fmt.Errorf("dmr/lc: expected %d talker alias bits, got %d", TalkerAliasBlockBits, len(d.Data))
+	}
+	if d.Block < 1 || d.Block > 3 {
+		return fmt.Errorf("dmr/lc: talker alias block %d out of range", d.Block)
+	}
+	data[0] |= TalkerAliasHeader + d.Block
+	copy(data[2:], BitsToBytes(d.Data))
+	return nil
+}
+
+var _ (LCData) = (*TalkerAliasBlockLC)(nil)
+
+// RawLC contains the content of a Link Control message with an opcode that
+// is not supported by this package.
+type RawLC struct {
+	Opcode uint8
+	Data   []byte
+}
+
+func (d *RawLC) String() string {
+	return fmt.Sprintf("unknown, data %x", d.Data)
+}
+
+func (d *RawLC) Parse(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	d.Opcode = data[0] & B00111111
+	d.Data = make([]byte, LCSize-2)
+	copy(d.Data, data[2:])
+	return nil
+}
+
+func (d *RawLC) Write(data []byte) error {
+	if len(data) != LCSize {
+		return fmt.Errorf("dmr/lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+	if len(d.Data) != LCSize-2 {
+		return fmt.Errorf("dmr/lc: expected %d raw LC bytes, got %d", LCSize-2, len(d.Data))
+	}
+	data[0] |= d.Opcode & B00111111
+	copy(data[2:], d.Data)
+	return nil
+}
+
+var _ (LCData) = (*RawLC)(nil)
+
+// ParseLC parses a packed Link Control message. If the Reed-Solomon (12, 9)
+// parity is included, with the mask for the burst type already removed, it
+// is checked and a mismatch is rejected; use ParseFullLCCorrecting to correct
+// errors instead.
+func ParseLC(data []byte) (*LC, error) {
+	if data == nil {
+		return nil, errors.New("dmr/lc: data can't be nil")
+	}
+	switch len(data) {
+	case LCSize:
+		break
+	case rs.CodewordSize:
+		codeword, err := rs.Encode(data[:LCSize])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(codeword[LCSize:], data[LCSize:]) {
+			return nil, errors.New("dmr/lc: Reed-Solomon parity mismatch")
+		}
+		data = data[:LCSize]
+		break
+	default:
+		return nil, fmt.Errorf("dmr/lc: expected %d or %d LC bytes, got %d",
+			LCSize, rs.CodewordSize, len(data))
+	}
+
+	if data[0]&B10000000 > 0 {
+		return nil, errors.New("dmr/lc: protect flag is not 0")
+	}
+
+	var lc = &LC{
+		Opcode:       data[0] & B00111111,
+		FeatureSetID: data[1],
+	}
+	if ct, ok := lcCallType[lc.Opcode]; ok {
+		lc.CallType = ct
+	} else if fn, ok := lcData[lc.Opcode]; ok && lc.FeatureSetID == StandardFeatureSetID {
+		lc.Data = fn()
+	} else {
+		lc.Data = &RawLC{}
+	}
+
+	if lc.Data != nil {
+		if err := lc.Data.Parse(data); err != nil {
+			return nil, err
+		}
+		return lc, nil
+	}
+
+	lc.ServiceOptions = ParseServiceOptions(data[2])
+	lc.DstID = uint32(data[3])<<16 | uint32(data[4])<<8 | uint32(data[5])
+	lc.SrcID = uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8])
+	return lc, nil
+}
+
+// Full Link Control Reed-Solomon parity masks, see DMR AI. spec. page 143.
+const (
+	VoiceLCHeaderMask    = rs.VoiceLCHeaderMask
+	TerminatorWithLCMask = rs.TerminatorWithLCMask
+)
+
+// BuildFullLC packs the Link Control message and appends the Reed-Solomon
+// (12, 9) parity with the mask for the burst type applied.
+func BuildFullLC(lc *LC, mask uint8) ([]byte, error) {
+	if lc == nil {
+		return nil, errors.New("dmr/full lc: lc can't be nil")
+	}
+
+	data, err := lc.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = rs.Encode(data); err != nil {
+		return nil, err
+	}
+	for i := rs.DataSize; i < rs.CodewordSize; i++ {
+		data[i] ^= mask
+	}
+	return data, nil
+}
+
+// ParseFullLCWithMask removes the parity mask for the burst type and parses
+// the packed Link Control message. The passed data is left untouched.
+func ParseFullLCWithMask(data []byte, mask uint8) (*LC, error) {
+	lc, _, err := ParseFullLCCorrecting(data, mask)
+	return lc, err
+}
+
+// ParseFullLC parses a packed Link Control message and checks/corrects the
+// Reed-Solomon check data. The parity mask must already be removed.
+func ParseFullLC(data []byte) (*LC, error) {
+	lc, _, err := ParseFullLCCorrecting(data, 0)
+	return lc, err
+}
+
+// ParseFullLCCorrecting is like ParseFullLCWithMask, it also returns the
+// number of symbols corrected by the Reed-Solomon (12, 9) code.
+func ParseFullLCCorrecting(data []byte, mask uint8) (*LC, int, error) {
+	if data == nil {
+		return nil, -1, errors.New("dmr/full lc: data can't be nil")
+	}
+	if len(data) != rs.CodewordSize {
+		return nil, -1, fmt.Errorf("dmr/full lc: expected %d bytes, got %d", rs.CodewordSize, len(data))
+	}
+
+	var codeword = append([]byte{}, data...)
+	for i := rs.DataSize; i < rs.CodewordSize; i++ {
+		codeword[i] ^= mask
+	}
+	lcData, n, err := rs.Decode(codeword)
+	if err != nil {
+		return nil, -1, err
+	}
+	lc, err := ParseLC(lcData)
+	if err != nil {
+		return nil, -1, err
+	}
+	return lc, n, nil
+}
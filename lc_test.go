@@ -0,0 +1,233 @@
+package dmr
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLC(t *testing.T) {
+	var tests = []*LC{
+		&LC{
+			CallType:       CallTypeGroup,
+			Opcode:         GroupVoiceChannelUser,
+			ServiceOptions: ServiceOptions{Emergency: true, Priority: Priority2},
+			DstID:          2042214,
+			SrcID:          2043044,
+		},
+		&LC{
+			CallType:     CallTypePrivate,
+			Opcode:       UnitToUnitVoiceChannelUser,
+			FeatureSetID: 0x10,
+			DstID:        0xffffff,
+			SrcID:        1,
+		},
+		&LC{
+			Opcode: TalkerAliasHeader,
+			Data: &TalkerAliasHeaderLC{
+				Format: TalkerAliasISO8Bit,
+				Length: 12,
+				Data:   BytesToBits([]byte("PD0MZ  "))[:TalkerAliasHeaderBits],
+			},
+		},
+		&LC{
+			Opcode: TalkerAliasBlock2,
+			Data: &TalkerAliasBlockLC{
+				Block: 2,
+				Data:  BytesToBits([]byte("go-dmr!")),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := test.MarshalBinary()
+		if err != nil {
+			t.Fatalf("encode %s failed: %v", test, err)
+		}
+		lc, err := ParseLC(data)
+		if err != nil {
+			t.Fatalf("decode %s failed: %v", test, err)
+		}
+		if !reflect.DeepEqual(lc, test) {
+			t.Fatalf("decode failed: expected %s, got %s", test, lc)
+		}
+	}
+}
+
+func TestLCGPSInfo(t *testing.T) {
+	var want = &GPSInfoLC{
+		PositionError: PositionErrorLessThan20m,
+		Longitude:     5.47,
+		Latitude:      -51.43,
+	}
+
+	data := make([]byte, LCSize)
+	if err := want.Write(data); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	lc, err := ParseLC(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	test, ok := lc.Data.(*GPSInfoLC)
+	if !ok {
+		t.Fatalf("decode failed: expected GPS info, got %s", lc)
+	}
+	if test.PositionError != want.PositionError ||
+		math.Abs(test.Longitude-want.Longitude) > 1e-4 ||
+		math.Abs(test.Latitude-want.Latitude) > 1e-4 {
+		t.Fatalf("decode failed: expected %s, got %s", want, test)
+	}
+}
+
+func TestLCRaw(t *testing.T) {
+	var tests = [][]byte{
+		// Unknown opcode
+		[]byte{0x30, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
+		// GPS info opcode with a manufacturer specific feature set
+		[]byte{0x08, 0x10, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07},
+	}
+
+	for _, data := range tests {
+		lc, err := ParseLC(data)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if _, ok := lc.Data.(*RawLC); !ok {
+			t.Fatalf("decode failed: expected raw LC, got %s", lc)
+		}
+		test, err := lc.MarshalBinary()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(test, data) {
+			t.Fatalf("encode failed: expected %x, got %x", data, test)
+		}
+	}
+}
+
+func TestFullLC(t *testing.T) {
+	var tests = []struct {
+		Mask uint8
+		Data []byte
+		Want *LC
+	}{
+		{
+			VoiceLCHeaderMask,
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x09, 0x1f, 0x29, 0x66, 0x25, 0x35, 0x3b},
+			&LC{CallType: CallTypeGroup, Opcode: GroupVoiceChannelUser, DstID: 9, SrcID: 2042214},
+		},
+		{
+			TerminatorWithLCMask,
+			[]byte{0x03, 0x00, 0x20, 0x1f, 0x29, 0x66, 0x1f, 0x2c, 0xa4, 0x6d, 0x9d, 0xd3},
+			&LC{CallType: CallTypePrivate, Opcode: UnitToUnitVoiceChannelUser,
+				ServiceOptions: ServiceOptions{OpenVoiceCallMode: true}, DstID: 2042214, SrcID: 2043044},
+		},
+		{
+			VoiceLCHeaderMask,
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xcc, 0x1f, 0x29, 0x66, 0x43, 0x49, 0x51},
+			&LC{CallType: CallTypeGroup, Opcode: GroupVoiceChannelUser, DstID: 204, SrcID: 2042214},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := BuildFullLC(test.Want, test.Mask)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(data, test.Data) {
+			t.Fatalf("encode failed: expected %x, got %x", test.Data, data)
+		}
+
+		if _, n, err := ParseFullLCCorrecting(test.Data, test.Mask); err != nil || n != 0 {
+			t.Fatalf("decode failed: %d symbols corrected, %v", n, err)
+		}
+
+		// Every single symbol error must be corrected
+		for i := range test.Data {
+			var corrupt = make([]byte, len(test.Data))
+			copy(corrupt, test.Data)
+			corrupt[i] ^= 0x5a
+
+			lc, n, err := ParseFullLCCorrecting(corrupt, test.Mask)
+			if err != nil || n != 1 {
+				t.Fatalf("decode with error in symbol %d failed: %d symbols corrected, %v", i, n, err)
+			}
+			if !reflect.DeepEqual(lc, test.Want) {
+				t.Fatalf("decode with error in symbol %d failed: expected %s, got %s", i, test.Want, lc)
+			}
+		}
+
+		// Two symbol errors must be detected
+		var corrupt = make([]byte, len(test.Data))
+		copy(corrupt, test.Data)
+		corrupt[2] ^= 0x01
+		corrupt[7] ^= 0x80
+		if _, err := ParseFullLCWithMask(corrupt, test.Mask); err == nil {
+			t.Fatal("decode with two symbol errors did not fail")
+		}
+	}
+}
+
+func TestGPSInfoToAPRS(t *testing.T) {
+	var tests = []struct {
+		Test *GPSInfoLC
+		Want string
+	}{
+		{
+			&GPSInfoLC{PositionError: PositionErrorLessThan20m, Latitude: 52.3676, Longitude: 4.9041},
+			"PD0MZ-9>APZDMR,TCPIP*:!5222.06N/00454.25E[DMR, position error < 20 m",
+		},
+		{
+			&GPSInfoLC{PositionError: PositionErrorUnknown, Latitude: -33.8688, Longitude: -70.66},
+			"PD0MZ-9>APZDMR,TCPIP*:!3352.13S/07039.60W[DMR, position error not known",
+		},
+		{
+			// Rounds up to the next degree
+			&GPSInfoLC{Latitude: 51.99999, Longitude: 179.99999},
+			"PD0MZ-9>APZDMR,TCPIP*:!5200.00N/18000.00E[DMR, position error < 2 m",
+		},
+	}
+	for _, test := range tests {
+		if got := test.Test.ToAPRS("PD0MZ-9"); got != test.Want {
+			t.Fatalf("APRS %s failed: got %q, expected %q", test.Test, got, test.Want)
+		}
+	}
+}
+
+func TestLCBytes(t *testing.T) {
+	var lc = &LC{CallType: CallTypeGroup, Opcode: GroupVoiceChannelUser, DstID: 9, SrcID: 2042214}
+	want, err := lc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if test := lc.Bytes(); !bytes.Equal(test, want) {
+		t.Fatalf("encode failed: expected %x, got %x", want, test)
+	}
+
+	lc.CallType = 0xff
+	if test := lc.Bytes(); test != nil {
+		t.Fatalf("encode of unsupported call type returned %x", test)
+	}
+}
+
+func TestParseLCParity(t *testing.T) {
+	var lc = &LC{CallType: CallTypeGroup, Opcode: GroupVoiceChannelUser, DstID: 9, SrcID: 2042214}
+	data, err := BuildFullLC(lc, 0)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	test, err := ParseLC(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(test, lc) {
+		t.Fatalf("decode failed: expected %s, got %s", lc, test)
+	}
+
+	data[5] ^= 0x01
+	if _, err := ParseLC(data); err == nil {
+		t.Fatal("decode of corrupted LC succeeded")
+	}
+}
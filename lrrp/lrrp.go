@@ -0,0 +1,300 @@
+// Package lrrp implements the Location Request and Response Protocol, used by
+// radios to request and report GPS positions over UDP/IP data calls.
+package lrrp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/packetdata"
+)
+
+// Port is the UDP port of LRRP.
+const Port = 4001
+
+// Message type
+const (
+	ImmediateLocationRequest       uint8 = 0x05
+	ImmediateLocationResponse      uint8 = 0x07
+	TriggeredLocationStartRequest  uint8 = 0x09
+	TriggeredLocationStartResponse uint8 = 0x0b
+	TriggeredLocationReport        uint8 = 0x0d
+	TriggeredLocationStopRequest   uint8 = 0x0f
+	TriggeredLocationStopResponse  uint8 = 0x11
+)
+
+var MessageTypeName = map[uint8]string{
+	ImmediateLocationRequest:       "immediate location request",
+	ImmediateLocationResponse:      "immediate location response",
+	TriggeredLocationStartRequest:  "triggered location start request",
+	TriggeredLocationStartResponse: "triggered location start response",
+	TriggeredLocationReport:        "triggered location report",
+	TriggeredLocationStopRequest:   "triggered location stop request",
+	TriggeredLocationStopResponse:  "triggered location stop response",
+}
+
+// Tokens of the message elements
+const (
+	tokenRequestID = 0x22 // Length and request ID
+	tokenTimestamp = 0x34 // Packed UTC time
+	tokenResult    = 0x37 // Result code
+	tokenCircle2D  = 0x51 // Latitude, longitude and radius
+	tokenCircle3D  = 0x54 // Latitude, longitude, radius and altitude
+	tokenPoint2D   = 0x66 // Latitude and longitude
+	tokenPoint3D   = 0x69 // Latitude, longitude and altitude
+)
+
+// Position is a reported GPS position.
+type Position struct {
+	Latitude    float64 // Degrees, positive north
+	Longitude   float64 // Degrees, positive east
+	Altitude    float64 // Meters, if HasAltitude is set
+	HasAltitude bool
+	Radius      float64   // Uncertainty in meters, zero if not reported
+	Timestamp   time.Time // Time of the fix, zero if not reported
+}
+
+func (p *Position) String() string {
+	return fmt.Sprintf("%.6f,%.6f", p.Latitude, p.Longitude)
+}
+
+// Message is an LRRP request or response.
+type Message struct {
+	Type      uint8
+	RequestID []byte
+	Result    uint8     // Result code of responses, zero for success
+	Position  *Position // Reported position, or nil
+}
+
+func (m *Message) String() string {
+	if m.Position == nil {
+		return fmt.Sprintf("%s (%#02x), result %d", MessageTypeName[m.Type], m.Type, m.Result)
+	}
+	return fmt.Sprintf("%s (%#02x), result %d, position %s", MessageTypeName[m.Type], m.Type, m.Result, m.Position)
+}
+
+// Parse parses an LRRP message, which is the message type, the size of the
+// elements and the elements, each starting with its token.
+func Parse(data []byte) (*Message, error) {
+	if len(data) < 2 {
+		return nil, errors.New("lrrp: message too short")
+	}
+	var size = int(data[1])
+	if size+2 > len(data) {
+		return nil, fmt.Errorf("lrrp: message size %d exceeds %d bytes", size, len(data)-2)
+	}
+
+	var (
+		m         = &Message{Type: data[0]}
+		timestamp time.Time
+	)
+	if _, ok := MessageTypeName[m.Type]; !ok {
+		return nil, fmt.Errorf("lrrp: unsupported message type %#02x", m.Type)
+	}
+	for data = data[2 : 2+size]; len(data) > 0; {
+		var (
+			token = data[0]
+			n     int
+		)
+		switch token {
+		case tokenRequestID:
+			if len(data) < 2 {
+				return nil, errors.New("lrrp: truncated request ID")
+			}
+			n = 2 + int(data[1])
+			break
+		case tokenTimestamp:
+			n = 6
+			break
+		case tokenResult:
+			n = 2
+			break
+		case tokenPoint2D:
+			n = 9
+			break
+		case tokenCircle2D, tokenPoint3D:
+			n = 11
+			break
+		case tokenCircle3D:
+			n = 13
+			break
+		default:
+			return nil, fmt.Errorf("lrrp: unsupported token %#02x", token)
+		}
+		if len(data) < n {
+			return nil, fmt.Errorf("lrrp: truncated element %#02x", token)
+		}
+
+		var field = data[1:n]
+		switch token {
+		case tokenRequestID:
+			m.RequestID = append([]byte{}, field[1:]...)
+			break
+		case tokenTimestamp:
+			timestamp = parseTimestamp(field)
+			break
+		case tokenResult:
+			m.Result = field[0]
+			break
+		case tokenPoint2D, tokenCircle2D, tokenPoint3D, tokenCircle3D:
+			var p = m.position()
+			p.Latitude = float64(int32(binary.BigEndian.Uint32(field))) * 90 / (1 << 31)
+			p.Longitude = float64(int32(binary.BigEndian.Uint32(field[4:]))) * 180 / (1 << 31)
+			field = field[8:]
+			if token == tokenCircle2D || token == tokenCircle3D {
+				p.Radius = float64(binary.BigEndian.Uint16(field))
+				field = field[2:]
+			}
+			if token == tokenPoint3D || token == tokenCircle3D {
+				p.Altitude = float64(int16(binary.BigEndian.Uint16(field)))
+				p.HasAltitude = true
+			}
+			break
+		}
+		data = data[n:]
+	}
+	if m.Position != nil {
+		m.Position.Timestamp = timestamp
+	}
+	return m, nil
+}
+
+// position returns the position of the message, adding it if missing.
+func (m *Message) position() *Position {
+	if m.Position == nil {
+		m.Position = &Position{}
+	}
+	return m.Position
+}
+
+// Bytes encodes the message.
+func (m *Message) Bytes() ([]byte, error) {
+	if _, ok := MessageTypeName[m.Type]; !ok {
+		return nil, fmt.Errorf("lrrp: unsupported message type %#02x", m.Type)
+	}
+	if len(m.RequestID) > 0xff {
+		return nil, fmt.Errorf("lrrp: request ID of %d bytes too long", len(m.RequestID))
+	}
+
+	var data = []byte{m.Type, 0}
+	if m.RequestID != nil {
+		data = append(data, tokenRequestID, uint8(len(m.RequestID)))
+		data = append(data, m.RequestID...)
+	}
+	if m.Type != ImmediateLocationRequest && m.Type != TriggeredLocationStartRequest && m.Type != TriggeredLocationStopRequest {
+		data = append(data, tokenResult, m.Result)
+	}
+	if p := m.Position; p != nil {
+		if !p.Timestamp.IsZero() {
+			data = append(append(data, tokenTimestamp), buildTimestamp(p.Timestamp)...)
+		}
+		var token uint8 = tokenPoint2D
+		switch {
+		case p.Radius > 0 && p.HasAltitude:
+			token = tokenCircle3D
+			break
+		case p.Radius > 0:
+			token = tokenCircle2D
+			break
+		case p.HasAltitude:
+			token = tokenPoint3D
+			break
+		}
+		data = append(data, token)
+		data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(p.Latitude*(1<<31)/90))))
+		data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(p.Longitude*(1<<31)/180))))
+		if p.Radius > 0 {
+			data = binary.BigEndian.AppendUint16(data, uint16(math.Min(math.Round(p.Radius), math.MaxUint16)))
+		}
+		if p.HasAltitude {
+			data = binary.BigEndian.AppendUint16(data, uint16(int16(math.Round(p.Altitude))))
+		}
+	}
+	if len(data)-2 > 0xff {
+		return nil, fmt.Errorf("lrrp: message of %d bytes too long", len(data)-2)
+	}
+	data[1] = uint8(len(data) - 2)
+	return data, nil
+}
+
+// parseTimestamp parses the 40 bits packed year (14 bits), month (4 bits), day
+// (5 bits), hour (5 bits), minute (6 bits) and second (6 bits).
+func parseTimestamp(data []byte) time.Time {
+	var v uint64
+	for _, b := range data[:5] {
+		v = v<<8 | uint64(b)
+	}
+	return time.Date(int(v>>26), time.Month(v>>22&0x0f), int(v>>17&0x1f),
+		int(v>>12&0x1f), int(v>>6&0x3f), int(v&0x3f), 0, time.UTC)
+}
+
+func buildTimestamp(t time.Time) []byte {
+	t = t.UTC()
+	var (
+		v = uint64(t.Year())<<26 | uint64(t.Month())<<22 | uint64(t.Day())<<17 |
+			uint64(t.Hour())<<12 | uint64(t.Minute())<<6 | uint64(t.Second())
+		data = make([]byte, 5)
+	)
+	for i := range data {
+		data[i] = uint8(v >> uint(32-i*8))
+	}
+	return data
+}
+
+// Parser decodes the LRRP messages sent over UDP/IP in the data calls
+// reassembled by a packetdata.DataReassembler, see AddCall.
+type Parser struct {
+	// OnPosition is called with the position of every location response or
+	// report, the source and destination are the addresses of the data
+	// header.
+	OnPosition func(src, dst uint32, pos *Position)
+	// OnLRRPError is called for LRRP datagrams that can't be parsed, and by
+	// Middleware for data calls that can't be reassembled.
+	OnLRRPError func(src, dst uint32, err error)
+}
+
+// NewParser returns a parser calling fn with every reported position.
+func NewParser(fn func(src, dst uint32, pos *Position)) *Parser {
+	return &Parser{OnPosition: fn}
+}
+
+// AddCall processes a completed data call, it has the signature of
+// packetdata.DataReassembler.OnData. Data calls with another SAP than IP based
+// packet data and datagrams on other UDP ports than Port are ignored.
+func (p *Parser) AddCall(call *dmr.DataCall) {
+	if call.ServiceAccessPoint() != dmr.ServiceAccessPointIPBasedPacketData {
+		return
+	}
+	srcPort, dstPort, payload, err := packetdata.ParseUDP(call.Data)
+	if err != nil || (srcPort != Port && dstPort != Port) {
+		return
+	}
+
+	m, err := Parse(payload)
+	if err != nil {
+		if p.OnLRRPError != nil {
+			p.OnLRRPError(call.SrcID, call.DstID, err)
+		}
+		return
+	}
+	if m.Position != nil && p.OnPosition != nil {
+		p.OnPosition(call.SrcID, call.DstID, m.Position)
+	}
+}
+
+// Middleware reassembles the data calls and decodes their LRRP messages, and
+// passes on every packet.
+func (p *Parser) Middleware() dmr.PacketMiddleware {
+	var r = packetdata.NewDataReassembler()
+	r.OnData = p.AddCall
+	r.OnDataError = func(src, dst uint32, err error) {
+		if p.OnLRRPError != nil {
+			p.OnLRRPError(src, dst, err)
+		}
+	}
+	return r.Middleware()
+}
@@ -0,0 +1,108 @@
+package lrrp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/packetdata"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		PDU       string
+		Type      uint8
+		RequestID string
+		Position  *Position
+	}{
+		// Immediate location request with request ID 1
+		{"0503220101", ImmediateLocationRequest, "01", nil},
+		// Immediate location response with a 2D point and the time of the fix
+		{"0715" + "22020102" + "3700" + "341f8044c000" + "66457c252c01ac3477", ImmediateLocationResponse, "0102",
+			&Position{Latitude: 48.8566, Longitude: 2.3522, Timestamp: time.Date(2016, 1, 2, 12, 0, 0, 0, time.UTC)}},
+		// Triggered location report with a 3D circle south and east
+		{"0d0f" + "3700" + "54cfd4bf0a6b86d022" + "0032" + "003a", TriggeredLocationReport, "",
+			&Position{Latitude: -33.8688, Longitude: 151.2093, Radius: 50, Altitude: 58, HasAltitude: true}},
+	}
+
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.PDU)
+		m, err := Parse(data)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", test.PDU, err)
+		}
+		switch {
+		case m.Type != test.Type:
+			t.Fatalf("parse %s: expected %s, got %s", test.PDU, MessageTypeName[test.Type], MessageTypeName[m.Type])
+		case hex.EncodeToString(m.RequestID) != test.RequestID:
+			t.Fatalf("parse %s: expected request ID %s, got %x", test.PDU, test.RequestID, m.RequestID)
+		case (m.Position == nil) != (test.Position == nil):
+			t.Fatalf("parse %s: expected position %v, got %v", test.PDU, test.Position, m.Position)
+		}
+		if p := m.Position; p != nil {
+			switch {
+			case math.Abs(p.Latitude-test.Position.Latitude) > 1e-6 || math.Abs(p.Longitude-test.Position.Longitude) > 1e-6:
+				t.Fatalf("parse %s: expected %s, got %s", test.PDU, test.Position, p)
+			case p.Radius != test.Position.Radius || p.Altitude != test.Position.Altitude || p.HasAltitude != test.Position.HasAltitude:
+				t.Fatalf("parse %s: expected %+v, got %+v", test.PDU, test.Position, p)
+			case !p.Timestamp.Equal(test.Position.Timestamp):
+				t.Fatalf("parse %s: expected time %s, got %s", test.PDU, test.Position.Timestamp, p.Timestamp)
+			}
+		}
+
+		encoded, err := m.Bytes()
+		if err != nil {
+			t.Fatalf("encode %s failed: %v", test.PDU, err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("encode: expected %s, got %x", test.PDU, encoded)
+		}
+	}
+
+	for _, pdu := range []string{"07", "0705370066", "1f00", "0702ff00"} {
+		data, _ := hex.DecodeString(pdu)
+		if _, err := Parse(data); err == nil {
+			t.Fatalf("parse %s succeeded", pdu)
+		}
+	}
+}
+
+func TestParser(t *testing.T) {
+	var (
+		positions []*Position
+		errs      []error
+		p         = NewParser(func(src, dst uint32, pos *Position) {
+			if src != 2042214 || dst != 2043044 {
+				t.Fatalf("unexpected addresses %d->%d", src, dst)
+			}
+			positions = append(positions, pos)
+		})
+	)
+	p.OnLRRPError = func(_, _ uint32, err error) { errs = append(errs, err) }
+
+	var datagram = func(sap uint8, port uint16, pdu string) *dmr.DataCall {
+		data, _ := hex.DecodeString(pdu)
+		return &dmr.DataCall{
+			SrcID:  2042214,
+			DstID:  2043044,
+			Header: &dmr.DataHeader{ServiceAccessPoint: sap},
+			Data:   packetdata.BuildUDP([]byte{12, 31, 41, 102}, []byte{13, 0, 0, 1}, port, port, data),
+		}
+	}
+	p.AddCall(datagram(dmr.ServiceAccessPointIPBasedPacketData, Port, "0d0b370066457c252c01ac3477"))
+	p.AddCall(datagram(dmr.ServiceAccessPointIPBasedPacketData, Port, "0503220101"))
+	p.AddCall(datagram(dmr.ServiceAccessPointIPBasedPacketData, Port, "0d0b3700"))
+	p.AddCall(datagram(dmr.ServiceAccessPointIPBasedPacketData, 4007, "0d0b370066457c252c01ac3477"))
+	p.AddCall(datagram(dmr.ServiceAccessPointShortData, Port, "0d0b370066457c252c01ac3477"))
+	switch {
+	case len(positions) != 1:
+		t.Fatalf("expected 1 position, got %d", len(positions))
+	case math.Abs(positions[0].Latitude-48.8566) > 1e-6:
+		t.Fatalf("unexpected position %s", positions[0])
+	case len(errs) != 1:
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+}
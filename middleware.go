@@ -0,0 +1,89 @@
+package dmr
+
+// PacketMiddleware processes a packet before it reaches the PacketFunc, the
+// packet is passed on by calling next, or dropped by not calling it.
+type PacketMiddleware func(p *Packet, next func(*Packet))
+
+// RunMiddleware passes the packet through the middleware in order, followed
+// by final.
+func RunMiddleware(mw []PacketMiddleware, p *Packet, final func(*Packet)) {
+	if len(mw) == 0 {
+		final(p)
+		return
+	}
+	mw[0](p, func(p *Packet) {
+		RunMiddleware(mw[1:], p, final)
+	})
+}
+
+// AllowTalkgroup only passes group calls to one of the talkgroups, private
+// calls are passed untouched.
+func AllowTalkgroup(ids ...uint32) PacketMiddleware {
+	var allow = make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		allow[id] = true
+	}
+	return func(p *Packet, next func(*Packet)) {
+		if p.CallType != CallTypeGroup || allow[p.DstID] {
+			next(p)
+		}
+	}
+}
+
+// AllowColorCode only passes packets with the color code. Voice sync bursts
+// don't carry a color code and are always passed.
+func AllowColorCode(cc uint8) PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		if pcc, ok := packetColorCode(p); !ok || pcc == cc {
+			next(p)
+		}
+	}
+}
+
+// AllowSlot only passes packets on the timeslot, 0 for slot 1 and 1 for slot
+// 2, as in Packet.Timeslot.
+func AllowSlot(slot int) PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		if int(p.Timeslot) == slot {
+			next(p)
+		}
+	}
+}
+
+// RewriteSrcID replaces the source ID from with to.
+func RewriteSrcID(from, to uint32) PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		if p.SrcID == from {
+			p.SrcID = to
+		}
+		next(p)
+	}
+}
+
+// packetColorCode returns the color code from the Slot Type or EMB, if the
+// packet has one. Packets of which the color code can't be decoded have color
+// code 0xff.
+func packetColorCode(p *Packet) (uint8, bool) {
+	if len(p.Bits) < PayloadBits {
+		return 0, false
+	}
+
+	switch p.DataType {
+	case VoiceBurstA:
+		return 0, false
+
+	case VoiceBurstB, VoiceBurstC, VoiceBurstD, VoiceBurstE, VoiceBurstF:
+		emb, err := ParseEMB(p.EMBBits())
+		if err != nil {
+			return 0xff, true
+		}
+		return emb.ColorCode, true
+
+	default:
+		st, err := ParseSlotType(p.SlotTypeBits())
+		if err != nil {
+			return 0xff, true
+		}
+		return st.ColorCode, true
+	}
+}
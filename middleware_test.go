@@ -0,0 +1,68 @@
+package dmr
+
+import "testing"
+
+func TestRunMiddleware(t *testing.T) {
+	var order []int
+	var mw = []PacketMiddleware{
+		func(p *Packet, next func(*Packet)) { order = append(order, 1); next(p) },
+		func(p *Packet, next func(*Packet)) { order = append(order, 2); next(p) },
+	}
+
+	var passed bool
+	RunMiddleware(mw, &Packet{}, func(*Packet) { passed = true })
+	if !passed || len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Fatalf("expected middleware 1, 2 and final to run, got %v, %t", order, passed)
+	}
+
+	passed = false
+	RunMiddleware([]PacketMiddleware{func(*Packet, func(*Packet)) {}}, &Packet{}, func(*Packet) { passed = true })
+	if passed {
+		t.Fatal("dropped packet reached final")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var run = func(mw PacketMiddleware, p *Packet) *Packet {
+		var out *Packet
+		mw(p, func(p *Packet) { out = p })
+		return out
+	}
+
+	if run(AllowTalkgroup(204, 2042), &Packet{CallType: CallTypeGroup, DstID: 2042}) == nil {
+		t.Fatal("allowed talkgroup was dropped")
+	}
+	if run(AllowTalkgroup(204, 2042), &Packet{CallType: CallTypeGroup, DstID: 91}) != nil {
+		t.Fatal("other talkgroup was passed")
+	}
+	if run(AllowTalkgroup(204), &Packet{CallType: CallTypePrivate, DstID: 2042214}) == nil {
+		t.Fatal("private call was dropped")
+	}
+
+	if run(AllowSlot(1), &Packet{Timeslot: 1}) == nil || run(AllowSlot(1), &Packet{Timeslot: 0}) != nil {
+		t.Fatal("slot filter failed")
+	}
+
+	if p := run(RewriteSrcID(2042214, 2043044), &Packet{SrcID: 2042214}); p == nil || p.SrcID != 2043044 {
+		t.Fatal("source ID was not rewritten")
+	}
+	if p := run(RewriteSrcID(2042214, 2043044), &Packet{SrcID: 1}); p == nil || p.SrcID != 1 {
+		t.Fatal("other source ID was rewritten")
+	}
+
+	bits, err := BuildSlotType(1, TerminatorWithLC)
+	if err != nil {
+		t.Fatalf("build slot type failed: %v", err)
+	}
+	var p = &Packet{DataType: TerminatorWithLC, Bits: make([]byte, PayloadBits)}
+	p.SetSlotTypeBits(bits)
+	if run(AllowColorCode(1), p) == nil {
+		t.Fatal("matching color code was dropped")
+	}
+	if run(AllowColorCode(2), p) != nil {
+		t.Fatal("other color code was passed")
+	}
+	if run(AllowColorCode(2), &Packet{DataType: VoiceBurstA, Bits: make([]byte, PayloadBits)}) == nil {
+		t.Fatal("voice sync burst was dropped")
+	}
+}
@@ -0,0 +1,261 @@
+// Package mmdvm implements the MMDVM host protocol, used to talk to MMDVM
+// modems and hotspots over a serial port
+package mmdvm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/crc"
+)
+
+// FrameStart is the first byte of every frame.
+const FrameStart = 0xe0
+
+// Commands as documented in the MMDVM specification.
+const (
+	GetVersion uint8 = 0x00
+	GetStatus  uint8 = 0x01
+	SetConfig  uint8 = 0x02
+	SetMode    uint8 = 0x03
+	DMRData1   uint8 = 0x18 // DMR data on timeslot 1
+	DMRLost1   uint8 = 0x19 // Timeslot 1 signal lost
+	DMRData2   uint8 = 0x1a // DMR data on timeslot 2
+	DMRLost2   uint8 = 0x1b // Timeslot 2 signal lost
+	DMRShortLC uint8 = 0x1c
+	DMRStart   uint8 = 0x1d
+	DMRAbort   uint8 = 0x1e
+	ACK        uint8 = 0x70
+	NAK        uint8 = 0x7f
+	SerialData uint8 = 0x80
+	Debug1     uint8 = 0xf1
+)
+
+const (
+	headerBytes = 3                   // Frame start, length and command
+	dataBytes   = dmr.PayloadBits / 8 // DMR burst in data frames
+)
+
+// CommandName maps commands to their names.
+var CommandName = map[uint8]string{
+	GetVersion: "get version",
+	GetStatus:  "get status",
+	SetConfig:  "set config",
+	SetMode:    "set mode",
+	DMRData1:   "DMR data 1",
+	DMRLost1:   "DMR lost 1",
+	DMRData2:   "DMR data 2",
+	DMRLost2:   "DMR lost 2",
+	DMRShortLC: "DMR short LC",
+	DMRStart:   "DMR start",
+	DMRAbort:   "DMR abort",
+	ACK:        "ACK",
+	NAK:        "NAK",
+	SerialData: "serial data",
+	Debug1:     "debug 1",
+}
+
+// Flags of the first payload byte of DMR data frames.
+const (
+	SyncData  uint8 = 0x40 // Data sync, the low nibble is the data type
+	SyncVoice uint8 = 0x20 // Voice sync, burst A
+	// Voice bursts B to F have no sync flag, the low nibble is the burst
+	// sequence 1 to 5.
+)
+
+// Frame is an MMDVM frame.
+type Frame struct {
+	Command uint8
+	Payload []byte
+}
+
+func (f *Frame) String() string {
+	var name, ok = CommandName[f.Command]
+	if !ok {
+		name = fmt.Sprintf("command %#02x", f.Command)
+	}
+	return fmt.Sprintf("%s, %d bytes", name, len(f.Payload))
+}
+
+// MMDVM reads and writes frames over a serial connection to a modem.
+type MMDVM struct {
+	// CRC appends a CRC-CCITT to every frame, which is included in the
+	// length. The stock MMDVM firmware doesn't use a CRC, only enable this
+	// for modems that expect one.
+	CRC bool
+
+	r     *bufio.Reader
+	w     io.Writer
+	mutex *sync.Mutex
+}
+
+// New returns an MMDVM using rw, which is typically a serial port.
+func New(rw io.ReadWriter) *MMDVM {
+	return &MMDVM{
+		r:     bufio.NewReader(rw),
+		w:     rw,
+		mutex: &sync.Mutex{},
+	}
+}
+
+// ReadFrame reads the next frame. Bytes before the frame start are skipped.
+func (m *MMDVM) ReadFrame() (*Frame, error) {
+	for {
+		b, err := m.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == FrameStart {
+			break
+		}
+	}
+
+	var header = make([]byte, headerBytes)
+	header[0] = FrameStart
+	if _, err := io.ReadFull(m.r, header[1:]); err != nil {
+		return nil, err
+	}
+
+	var size = int(header[1])
+	if m.CRC {
+		size -= 2
+	}
+	if size < headerBytes {
+		return nil, fmt.Errorf("mmdvm: frame length %d too short", header[1])
+	}
+
+	var data = make([]byte, int(header[1]))
+	copy(data, header)
+	if _, err := io.ReadFull(m.r, data[headerBytes:]); err != nil {
+		return nil, err
+	}
+	if m.CRC && !crc.Check16(data, 0) {
+		return nil, errors.New("mmdvm: frame CRC mismatch")
+	}
+
+	return &Frame{
+		Command: data[2],
+		Payload: data[headerBytes:size],
+	}, nil
+}
+
+// WriteFrame writes a frame.
+func (m *MMDVM) WriteFrame(f *Frame) error {
+	data, err := m.pack(f)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, err = m.w.Write(data)
+	return err
+}
+
+func (m *MMDVM) pack(f *Frame) ([]byte, error) {
+	if f == nil {
+		return nil, errors.New("mmdvm: frame can't be nil")
+	}
+
+	var size = headerBytes + len(f.Payload)
+	if m.CRC {
+		size += 2
+	}
+	if size > 0xff {
+		return nil, fmt.Errorf("mmdvm: payload of %d bytes too long", len(f.Payload))
+	}
+
+	var data = make([]byte, headerBytes, size)
+	data[0] = FrameStart
+	data[1] = uint8(size)
+	data[2] = f.Command
+	data = append(data, f.Payload...)
+	if m.CRC {
+		var sum = crc.CRC16(data, 0)
+		data = append(data, uint8(sum>>8), uint8(sum))
+	}
+	return data, nil
+}
+
+// ConvertToHomebrew converts an MMDVM DMR data frame to a packet. The modem
+// only passes the burst, so the source, destination and stream ID are not
+// set, they can be taken from the decoded voice LC header.
+func ConvertToHomebrew(f *Frame, repeaterID uint32) (*dmr.Packet, error) {
+	if f == nil {
+		return nil, errors.New("mmdvm: frame can't be nil")
+	}
+
+	var p = &dmr.Packet{RepeaterID: repeaterID}
+	switch f.Command {
+	case DMRData1:
+		p.Timeslot = 0
+		break
+	case DMRData2:
+		p.Timeslot = 1
+		break
+	default:
+		return nil, fmt.Errorf("mmdvm: %s is not a DMR data frame", f)
+	}
+	if len(f.Payload) != 1+dataBytes {
+		return nil, fmt.Errorf("mmdvm: expected %d DMR data bytes, got %d", 1+dataBytes, len(f.Payload))
+	}
+
+	var flags = f.Payload[0]
+	switch {
+	case flags&SyncData != 0:
+		p.DataType = flags & 0x0f
+		break
+	case flags&SyncVoice != 0:
+		p.DataType = dmr.VoiceBurstA
+		break
+	case flags&0x0f <= 5:
+		p.DataType = dmr.VoiceBurstA + flags&0x0f
+		break
+	default:
+		return nil, fmt.Errorf("mmdvm: voice sequence %d out of range", flags&0x0f)
+	}
+	p.SetData(append([]byte{}, f.Payload[1:]...))
+	return p, nil
+}
+
+// ConvertFromHomebrew converts a packet to an MMDVM DMR data frame.
+func ConvertFromHomebrew(p *dmr.Packet) (*Frame, error) {
+	if p == nil {
+		return nil, errors.New("mmdvm: packet can't be nil")
+	}
+	if len(p.Data) < dataBytes {
+		return nil, fmt.Errorf("mmdvm: expected %d data bytes, got %d", dataBytes, len(p.Data))
+	}
+
+	var f = &Frame{Command: DMRData1}
+	switch p.Timeslot {
+	case 0:
+		break
+	case 1:
+		f.Command = DMRData2
+		break
+	default:
+		return nil, fmt.Errorf("mmdvm: timeslot %d out of range", p.Timeslot)
+	}
+
+	var flags uint8
+	switch {
+	case p.DataType == dmr.VoiceBurstA:
+		flags = SyncVoice
+		break
+	case p.DataType > dmr.VoiceBurstA && p.DataType <= dmr.VoiceBurstF:
+		flags = p.DataType - dmr.VoiceBurstA
+		break
+	case p.DataType <= dmr.Idle:
+		flags = SyncData | p.DataType
+		break
+	default:
+		return nil, fmt.Errorf("mmdvm: data type %d can't be sent", p.DataType)
+	}
+	f.Payload = append([]byte{flags}, p.Data[:dataBytes]...)
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package mmdvm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+func TestFrame(t *testing.T) {
+	for _, withCRC := range []bool{false, true} {
+		var (
+			buf = &bytes.Buffer{}
+			m   = New(buf)
+			f   = &Frame{Command: DMRData2, Payload: append([]byte{SyncVoice}, bytes.Repeat([]byte{0x55}, dataBytes)...)}
+		)
+		m.CRC = withCRC
+		if err := m.WriteFrame(f); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		var want = 3 + 1 + dataBytes
+		if withCRC {
+			want += 2
+		}
+		switch data := buf.Bytes(); {
+		case len(data) != want:
+			t.Fatalf("crc %t: expected %d bytes, got %d", withCRC, want, len(data))
+		case data[0] != FrameStart || int(data[1]) != want || data[2] != DMRData2:
+			t.Fatalf("crc %t: unexpected header % x", withCRC, data[:3])
+		}
+
+		// Garbage before the frame start is skipped
+		var data = append([]byte{0x00, 0x42}, buf.Bytes()...)
+		buf.Reset()
+		buf.Write(data)
+
+		got, err := m.ReadFrame()
+		if err != nil {
+			t.Fatalf("crc %t: read failed: %v", withCRC, err)
+		}
+		if got.Command != f.Command || !bytes.Equal(got.Payload, f.Payload) {
+			t.Fatalf("crc %t: expected %s, got %s", withCRC, f, got)
+		}
+		if _, err := m.ReadFrame(); err != io.EOF {
+			t.Fatalf("crc %t: expected EOF, got %v", withCRC, err)
+		}
+	}
+}
+
+func TestFrameCRC(t *testing.T) {
+	var (
+		buf = &bytes.Buffer{}
+		m   = New(buf)
+	)
+	m.CRC = true
+	if err := m.WriteFrame(&Frame{Command: GetVersion}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var data = buf.Bytes()
+	data[len(data)-1] ^= 0x01
+	if _, err := m.ReadFrame(); err == nil {
+		t.Fatal("read of corrupt frame succeeded")
+	}
+
+	buf.Reset()
+	buf.Write([]byte{FrameStart, 0x02, GetVersion})
+	m.CRC = false
+	if _, err := m.ReadFrame(); err == nil {
+		t.Fatal("read of short frame succeeded")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var tests = []struct {
+		Timeslot uint8
+		DataType uint8
+		Command  uint8
+		Flags    uint8
+	}{
+		{0, dmr.VoiceLC, DMRData1, SyncData | dmr.VoiceLC},
+		{1, dmr.TerminatorWithLC, DMRData2, SyncData | dmr.TerminatorWithLC},
+		{0, dmr.VoiceBurstA, DMRData1, SyncVoice},
+		{1, dmr.VoiceBurstC, DMRData2, 0x02},
+		{0, dmr.VoiceBurstF, DMRData1, 0x05},
+	}
+
+	for _, test := range tests {
+		var p = &dmr.Packet{Timeslot: test.Timeslot, DataType: test.DataType}
+		p.SetData(bytes.Repeat([]byte{0xa5}, dataBytes))
+
+		f, err := ConvertFromHomebrew(p)
+		switch {
+		case err != nil:
+			t.Fatalf("%s: convert failed: %v", dmr.DataTypeName[test.DataType], err)
+		case f.Command != test.Command || f.Payload[0] != test.Flags:
+			t.Fatalf("%s: expected command %#02x flags %#02x, got %#02x %#02x",
+				dmr.DataTypeName[test.DataType], test.Command, test.Flags, f.Command, f.Payload[0])
+		}
+
+		got, err := ConvertToHomebrew(f, 2042214)
+		switch {
+		case err != nil:
+			t.Fatalf("%s: convert back failed: %v", dmr.DataTypeName[test.DataType], err)
+		case got.Timeslot != p.Timeslot || got.DataType != p.DataType || got.RepeaterID != 2042214:
+			t.Fatalf("%s: unexpected packet %+v", dmr.DataTypeName[test.DataType], got)
+		case !bytes.Equal(got.Data, p.Data) || len(got.Bits) != dmr.PayloadBits:
+			t.Fatalf("%s: data mismatch", dmr.DataTypeName[test.DataType])
+		}
+	}
+
+	if _, err := ConvertToHomebrew(&Frame{Command: GetStatus}, 1); err == nil {
+		t.Fatal("convert of status frame succeeded")
+	}
+	if _, err := ConvertToHomebrew(&Frame{Command: DMRData1, Payload: []byte{SyncVoice}}, 1); err == nil {
+		t.Fatal("convert of short frame succeeded")
+	}
+}
@@ -1,5 +1,12 @@
 package dmr
 
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
 // Data Type information element definitions, DMR Air Interface (AI) protocol, Table 6.1
 const (
 	PrivacyIndicator              uint8 = iota // Privacy Indicator information in a standalone burst
@@ -54,6 +61,40 @@ var CallTypeName = map[uint8]string{
 	CallTypeGroup:   "group",
 }
 
+// CallType is the call type of a packet, CallTypePrivate or CallTypeGroup.
+type CallType uint8
+
+func (ct CallType) String() string {
+	if name, ok := CallTypeName[uint8(ct)]; ok {
+		return name
+	}
+	return fmt.Sprintf("CallType(%d)", uint8(ct))
+}
+
+// FrameType is the frame type of a packet, as in the flags of the Homebrew
+// protocol.
+type FrameType uint8
+
+// Frame types
+const (
+	FrameTypeVoice FrameType = iota
+	FrameTypeVoiceSync
+	FrameTypeDataSync
+)
+
+func (ft FrameType) String() string {
+	switch ft {
+	case FrameTypeVoice:
+		return "Voice"
+	case FrameTypeVoiceSync:
+		return "VoiceSync"
+	case FrameTypeDataSync:
+		return "DataSync"
+	default:
+		return fmt.Sprintf("FrameType(%d)", uint8(ft))
+	}
+}
+
 // Packet represents a frame transported by the Air Interface
 type Packet struct {
 	// 0 for slot 1, 1 for slot 2
@@ -75,12 +116,39 @@ type Packet struct {
 	// Data Type or Slot type
 	DataType uint8
 
-	// 0 for group call, 1 for unit to unit
+	// CallTypeGroup or CallTypePrivate. This is not the call type bit of the
+	// Homebrew flags, which is set for private calls, the homebrew package
+	// converts between the two.
 	CallType uint8
 
+	// Signal report MMDVM hosts append to the frame, only valid if HasMeta is set
+	BER     uint8 // Bit error rate in percent
+	RSSI    uint8 // Received signal strength in -dBm
+	HasMeta bool
+
 	// The on-air DMR data with possible FEC fixes to the AMBE data and/or Slot Type and/or EMB, etc
 	Data []byte // 34 bytes
 	Bits []byte // 264 bits
+
+	// PCM audio of a voice burst, only set if the link has a VoiceCodec
+	PCM []int16
+
+	// Bits corrected by the FEC of the burst, set by receivers that measure it
+	Quality *BurstQuality
+}
+
+// NewPacket returns a group call packet on timeslot 1 of the stream, with an
+// all zero payload of PayloadBits.
+func NewPacket(src, dst, repeater, streamID uint32) *Packet {
+	var p = &Packet{
+		SrcID:      src,
+		DstID:      dst,
+		RepeaterID: repeater,
+		StreamID:   streamID,
+		CallType:   CallTypeGroup,
+	}
+	p.SetData(make([]byte, PayloadBits/8))
+	return p
 }
 
 // EMBBits returns the frame EMB bits from the SYNC bits
@@ -103,11 +171,22 @@ func (p *Packet) InfoBits() []byte {
 	return b
 }
 
+// SetInfoBits updates the frame Info bits
+func (p *Packet) SetInfoBits(bits []byte) {
+	p.setBits(bits, 0, InfoHalfBits)
+	p.setBits(bits[InfoHalfBits:], InfoHalfBits+SlotTypeBits+SignalBits, InfoHalfBits)
+}
+
 // SyncBits returns the frame SYNC bits
 func (p *Packet) SyncBits() []byte {
 	return p.Bits[SyncOffsetBits : SyncOffsetBits+SyncBits]
 }
 
+// SetSyncBits updates the frame SYNC bits
+func (p *Packet) SetSyncBits(bits []byte) {
+	p.setBits(bits, SyncOffsetBits, SyncBits)
+}
+
 // SlotType returns the frame Slot Type parsed from the Slot Type bits
 func (p *Packet) SlotType() []byte {
 	return BitsToBytes(p.SlotTypeBits())
@@ -115,8 +194,19 @@ func (p *Packet) SlotType() []byte {
 
 // SlotTypeBits returns the SloT Type bits
 func (p *Packet) SlotTypeBits() []byte {
-	var o = InfoHalfBits + SlotTypeHalfBits + SyncBits
-	return append(p.Bits[InfoHalfBits:InfoHalfBits+SlotTypeHalfBits], p.Bits[o:o+SlotTypeHalfBits]...)
+	var (
+		b = make([]byte, SlotTypeBits)
+		o = InfoHalfBits + SlotTypeHalfBits + SyncBits
+	)
+	copy(b[:SlotTypeHalfBits], p.Bits[InfoHalfBits:InfoHalfBits+SlotTypeHalfBits])
+	copy(b[SlotTypeHalfBits:], p.Bits[o:o+SlotTypeHalfBits])
+	return b
+}
+
+// SetSlotTypeBits updates the Slot Type bits
+func (p *Packet) SetSlotTypeBits(bits []byte) {
+	p.setBits(bits, InfoHalfBits, SlotTypeHalfBits)
+	p.setBits(bits[SlotTypeHalfBits:], InfoHalfBits+SlotTypeHalfBits+SyncBits, SlotTypeHalfBits)
 }
 
 // VoiceBits returns the bits containing voice data
@@ -132,5 +222,313 @@ func (p *Packet) SetData(data []byte) {
 	p.Bits = BytesToBits(data)
 }
 
-// PacketFunc is a callback function that handles DMR packets
+// setBits copies size bits to the frame at offset and updates the data.
+func (p *Packet) setBits(bits []byte, offset, size int) {
+	if len(p.Bits) < PayloadBits {
+		var b = make([]byte, PayloadBits)
+		copy(b, p.Bits)
+		p.Bits = b
+	}
+	copy(p.Bits[offset:offset+size], bits[:size])
+	p.Data = BitsToBytes(p.Bits)
+}
+
+// FrameType returns the frame type of the packet.
+func (p *Packet) FrameType() FrameType {
+	switch p.DataType {
+	case VoiceBurstA:
+		return FrameTypeVoiceSync
+	case VoiceBurstB, VoiceBurstC, VoiceBurstD, VoiceBurstE, VoiceBurstF:
+		return FrameTypeVoice
+	default:
+		return FrameTypeDataSync
+	}
+}
+
+// ColorCode returns the color code from the Slot Type of data sync bursts or
+// the EMB of voice bursts B to F. Voice sync bursts don't carry the color
+// code, it returns false for those and for bits that can't be corrected.
+func (p *Packet) ColorCode() (uint8, bool) {
+	if len(p.Bits) < PayloadBits {
+		return 0, false
+	}
+	switch p.FrameType() {
+	case FrameTypeVoice:
+		emb, _, err := ParseEMBCorrecting(p.EMBBits())
+		if err != nil {
+			return 0, false
+		}
+		return emb.ColorCode, true
+	case FrameTypeDataSync:
+		st, err := ParseSlotType(p.SlotTypeBits())
+		if err != nil {
+			return 0, false
+		}
+		return st.ColorCode, true
+	}
+	return 0, false
+}
+
+// Clone returns a deep copy of the packet, which shares no memory with p. A
+// packet passed to a PacketFunc, middleware or callback must be cloned to be
+// used after the call returns, or from another goroutine.
+func (p *Packet) Clone() *Packet {
+	var c = *p
+	if p.Data != nil {
+		c.Data = append([]byte{}, p.Data...)
+	}
+	if p.Bits != nil {
+		c.Bits = append([]byte{}, p.Bits...)
+	}
+	if p.PCM != nil {
+		c.PCM = append([]int16{}, p.PCM...)
+	}
+	if p.Quality != nil {
+		var q = *p.Quality
+		c.Quality = &q
+	}
+	return &c
+}
+
+// String returns a one line summary of the packet, for logging. The color
+// code is - if the packet doesn't carry it.
+func (p *Packet) String() string {
+	var cc = "-"
+	if v, ok := p.ColorCode(); ok {
+		cc = fmt.Sprintf("%d", v)
+	}
+	dataType, ok := DataTypeName[p.DataType]
+	if !ok {
+		dataType = fmt.Sprintf("%d", p.DataType)
+	}
+	return fmt.Sprintf("DMRD seq=0x%02x src=%d dst=%d rpt=%d slot=%d cc=%s call=%s type=%s data=%q stream=%08x",
+		p.Sequence, p.SrcID, p.DstID, p.RepeaterID, p.Timeslot+1, cc,
+		CallType(p.CallType), p.FrameType(), dataType, p.StreamID)
+}
+
+// Frame and call type names used in the JSON encoding of packets.
+const (
+	frameTypeVoice     = "voice"
+	frameTypeVoiceSync = "voice_sync"
+	frameTypeDataSync  = "data_sync"
+	callTypeGroup      = "group"
+	callTypeUnit       = "unit" // Unit to unit, a private call
+)
+
+// packetJSON is the JSON encoding of a packet. The flags are decoded, the
+// slot is numbered 1 and 2.
+type packetJSON struct {
+	Sequence   uint8           `json:"sequence"`
+	SrcID      uint32          `json:"src_id"`
+	DstID      uint32          `json:"dst_id"`
+	RepeaterID uint32          `json:"repeater_id"`
+	StreamID   uint32          `json:"stream_id"`
+	Flags      packetJSONFlags `json:"flags"`
+	Data       []byte          `json:"dmr"`
+	Meta       *packetJSONMeta `json:"meta,omitempty"`
+}
+
+type packetJSONFlags struct {
+	Slot int `json:"slot"`
+	// Call type: group or unit
+	CallType string `json:"call_type"`
+	// Frame type as in the Homebrew flags: voice, voice_sync or data_sync
+	FrameType string `json:"frame_type"`
+	DataType  uint8  `json:"data_type"`
+	// Name of the data type, informational
+	DataTypeName string `json:"data_type_name,omitempty"`
+}
+
+type packetJSONMeta struct {
+	BER  uint8 `json:"ber"`
+	RSSI uint8 `json:"rssi"`
+}
+
+// MarshalJSON encodes the packet with decoded flags and the DMR data in
+// base64.
+func (p *Packet) MarshalJSON() ([]byte, error) {
+	var frameType = frameTypeDataSync
+	switch p.FrameType() {
+	case FrameTypeVoiceSync:
+		frameType = frameTypeVoiceSync
+	case FrameTypeVoice:
+		frameType = frameTypeVoice
+	}
+	var callType string
+	switch p.CallType {
+	case CallTypeGroup:
+		callType = callTypeGroup
+		break
+	case CallTypePrivate:
+		callType = callTypeUnit
+		break
+	default:
+		return nil, fmt.Errorf("dmr: invalid call type %d", p.CallType)
+	}
+	var meta *packetJSONMeta
+	if p.HasMeta {
+		meta = &packetJSONMeta{BER: p.BER, RSSI: p.RSSI}
+	}
+	return json.Marshal(packetJSON{
+		Sequence:   p.Sequence,
+		SrcID:      p.SrcID,
+		DstID:      p.DstID,
+		RepeaterID: p.RepeaterID,
+		StreamID:   p.StreamID,
+		Flags: packetJSONFlags{
+			Slot:         int(p.Timeslot) + 1,
+			CallType:     callType,
+			FrameType:    frameType,
+			DataType:     p.DataType,
+			DataTypeName: DataTypeName[p.DataType],
+		},
+		Data: p.Data,
+		Meta: meta,
+	})
+}
+
+// UnmarshalJSON decodes a packet encoded by MarshalJSON.
+func (p *Packet) UnmarshalJSON(data []byte) error {
+	var v packetJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Flags.Slot < 1 || v.Flags.Slot > 2 {
+		return fmt.Errorf("dmr: invalid slot %d", v.Flags.Slot)
+	}
+	var callType uint8
+	switch v.Flags.CallType {
+	case callTypeUnit:
+		callType = CallTypePrivate
+		break
+	case callTypeGroup:
+		callType = CallTypeGroup
+		break
+	default:
+		return fmt.Errorf("dmr: invalid call type %q", v.Flags.CallType)
+	}
+	if _, ok := DataTypeName[v.Flags.DataType]; !ok {
+		return fmt.Errorf("dmr: invalid data type %d", v.Flags.DataType)
+	}
+
+	*p = Packet{
+		Timeslot:   uint8(v.Flags.Slot - 1),
+		Sequence:   v.Sequence,
+		SrcID:      v.SrcID,
+		DstID:      v.DstID,
+		RepeaterID: v.RepeaterID,
+		StreamID:   v.StreamID,
+		DataType:   v.Flags.DataType,
+		CallType:   callType,
+	}
+	if v.Data != nil {
+		p.SetData(v.Data)
+	}
+	if v.Meta != nil {
+		p.BER, p.RSSI, p.HasMeta = v.Meta.BER, v.Meta.RSSI, true
+	}
+	return nil
+}
+
+// Binary encoding of packets, see MarshalBinary.
+const (
+	packetBinaryHeaderSize = 17
+	packetBinaryMetaSize   = 2
+
+	packetBinarySlot2   = 0x01
+	packetBinaryPrivate = 0x02
+	packetBinaryMeta    = 0x04
+)
+
+// MarshalBinary encodes the packet in a compact binary format for storage.
+// The packet is encoded as the sequence number, the source and destination
+// ID in 3 bytes, the repeater ID and stream ID in 4 bytes, a flags byte, the
+// data type, the BER and RSSI if the packet has a signal report, and the DMR
+// data. Numbers are big endian.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	if p.SrcID > 0xffffff || p.DstID > 0xffffff {
+		return nil, fmt.Errorf("dmr: ID out of range in %s", p)
+	}
+	if p.Timeslot > 1 {
+		return nil, fmt.Errorf("dmr: invalid timeslot %d", p.Timeslot)
+	}
+	var flags byte
+	if p.Timeslot == 1 {
+		flags |= packetBinarySlot2
+	}
+	switch p.CallType {
+	case CallTypeGroup:
+		break
+	case CallTypePrivate:
+		flags |= packetBinaryPrivate
+		break
+	default:
+		return nil, fmt.Errorf("dmr: invalid call type %d", p.CallType)
+	}
+	if p.HasMeta {
+		flags |= packetBinaryMeta
+	}
+
+	var data = make([]byte, packetBinaryHeaderSize, packetBinaryHeaderSize+packetBinaryMetaSize+len(p.Data))
+	data[0] = p.Sequence
+	data[1] = uint8(p.SrcID >> 16)
+	data[2] = uint8(p.SrcID >> 8)
+	data[3] = uint8(p.SrcID)
+	data[4] = uint8(p.DstID >> 16)
+	data[5] = uint8(p.DstID >> 8)
+	data[6] = uint8(p.DstID)
+	binary.BigEndian.PutUint32(data[7:], p.RepeaterID)
+	binary.BigEndian.PutUint32(data[11:], p.StreamID)
+	data[15] = flags
+	data[16] = p.DataType
+	if p.HasMeta {
+		data = append(data, p.BER, p.RSSI)
+	}
+	return append(data, p.Data...), nil
+}
+
+// UnmarshalBinary decodes a packet encoded by MarshalBinary.
+func (p *Packet) UnmarshalBinary(data []byte) error {
+	if len(data) < packetBinaryHeaderSize {
+		return errors.New("dmr: binary packet too short")
+	}
+	var flags = data[15]
+	if flags&^(packetBinarySlot2|packetBinaryPrivate|packetBinaryMeta) != 0 {
+		return fmt.Errorf("dmr: invalid binary packet flags %#02x", flags)
+	}
+	if _, ok := DataTypeName[data[16]]; !ok {
+		return fmt.Errorf("dmr: invalid data type %d", data[16])
+	}
+
+	*p = Packet{
+		Sequence:   data[0],
+		SrcID:      uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]),
+		DstID:      uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6]),
+		RepeaterID: binary.BigEndian.Uint32(data[7:]),
+		StreamID:   binary.BigEndian.Uint32(data[11:]),
+		DataType:   data[16],
+		CallType:   CallTypeGroup,
+	}
+	if flags&packetBinarySlot2 != 0 {
+		p.Timeslot = 1
+	}
+	if flags&packetBinaryPrivate != 0 {
+		p.CallType = CallTypePrivate
+	}
+	data = data[packetBinaryHeaderSize:]
+	if flags&packetBinaryMeta != 0 {
+		if len(data) < packetBinaryMetaSize {
+			return errors.New("dmr: binary packet too short")
+		}
+		p.BER, p.RSSI, p.HasMeta = data[0], data[1], true
+		data = data[packetBinaryMetaSize:]
+	}
+	if len(data) > 0 {
+		p.SetData(append([]byte{}, data...))
+	}
+	return nil
+}
+
+// PacketFunc is a callback function that handles DMR packets. The packet
+// must not be retained after the function returns without Clone.
 type PacketFunc func(Repeater, *Packet) error
@@ -0,0 +1,240 @@
+package dmr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestPacketString(t *testing.T) {
+	for _, test := range []struct {
+		Packet *Packet
+		Want   string
+	}{
+		{&Packet{Sequence: 42, SrcID: 2042001, DstID: 91, RepeaterID: 204221401, CallType: CallTypeGroup, Timeslot: 1, DataType: VoiceBurstA, StreamID: 0x1a2b3c4d},
+			`DMRD seq=0x2a src=2042001 dst=91 rpt=204221401 slot=2 cc=- call=group type=VoiceSync data="voice (burst A)" stream=1a2b3c4d`},
+		{&Packet{Sequence: 43, SrcID: 2042001, DstID: 2042214, CallType: CallTypePrivate, DataType: VoiceBurstC, StreamID: 0x1a},
+			`DMRD seq=0x2b src=2042001 dst=2042214 rpt=0 slot=1 cc=- call=private type=Voice data="voice (burst C)" stream=0000001a`},
+		{&Packet{SrcID: 2042001, DstID: 91, CallType: CallTypeGroup, DataType: TerminatorWithLC, StreamID: 0x1a},
+			`DMRD seq=0x00 src=2042001 dst=91 rpt=0 slot=1 cc=- call=group type=DataSync data="terminator with LC" stream=0000001a`},
+	} {
+		if got := test.Packet.String(); got != test.Want {
+			t.Fatalf("expected %q, got %q", test.Want, got)
+		}
+	}
+
+	var p = &Packet{SrcID: 2042001, DstID: 91, CallType: CallTypeGroup, DataType: VoiceLC, StreamID: 0x1a}
+	slotType, _ := BuildSlotType(7, VoiceLC)
+	p.SetSlotTypeBits(slotType)
+	if cc, ok := p.ColorCode(); !ok || cc != 7 {
+		t.Fatalf("expected color code 7, got %d (%t)", cc, ok)
+	}
+	if want := `DMRD seq=0x00 src=2042001 dst=91 rpt=0 slot=1 cc=7 call=group type=DataSync data="voice LC" stream=0000001a`; p.String() != want {
+		t.Fatalf("expected %q, got %q", want, p.String())
+	}
+
+	var _, _ fmt.Stringer = CallType(0), FrameType(0)
+	switch {
+	case CallType(CallTypeGroup).String() != "group" || CallType(CallTypePrivate).String() != "private":
+		t.Fatal("unexpected call type names")
+	case FrameTypeVoice.String() != "Voice" || FrameTypeVoiceSync.String() != "VoiceSync" || FrameTypeDataSync.String() != "DataSync":
+		t.Fatal("unexpected frame type names")
+	case FrameType(3).String() != "FrameType(3)":
+		t.Fatalf("unexpected name %q for unknown frame type", FrameType(3).String())
+	}
+}
+
+func TestPacketJSON(t *testing.T) {
+	var p = &Packet{
+		Timeslot:   1,
+		Sequence:   42,
+		SrcID:      2042001,
+		DstID:      91,
+		RepeaterID: 204221401,
+		StreamID:   0x1a2b3c4d,
+		DataType:   VoiceBurstB,
+		CallType:   CallTypeGroup,
+	}
+	p.SetData(bytes.Repeat([]byte{0xa5}, 33))
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("unmarshal to map failed: %v", err)
+	}
+	var flags, _ = fields["flags"].(map[string]interface{})
+	switch {
+	case fields["src_id"] != 2042001.0 || fields["stream_id"] != float64(0x1a2b3c4d):
+		t.Fatalf("unexpected fields %s", data)
+	case flags["slot"] != 2.0 || flags["call_type"] != "group" || flags["frame_type"] != "voice":
+		t.Fatalf("unexpected flags %s", data)
+	case fields["dmr"] != base64.StdEncoding.EncodeToString(p.Data):
+		t.Fatalf("unexpected dmr data %s", data)
+	}
+
+	var got Packet
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got.String() != p.String() || got.RepeaterID != p.RepeaterID || !bytes.Equal(got.Data, p.Data) || !bytes.Equal(got.Bits, p.Bits) {
+		t.Fatalf("expected %+v, got %+v", p, got)
+	}
+
+	p.BER, p.RSSI, p.HasMeta = 3, 87, true
+	if data, err = json.Marshal(p); err != nil {
+		t.Fatalf("marshal with signal report failed: %v", err)
+	}
+	got = Packet{}
+	if err := json.Unmarshal(data, &got); err != nil || !got.HasMeta || got.BER != 3 || got.RSSI != 87 {
+		t.Fatalf("unmarshal with signal report failed: %s: %v", data, err)
+	}
+
+	for _, invalid := range []string{
+		`{"flags":{"slot":3,"call_type":"group"}}`,
+		`{"flags":{"slot":1,"call_type":"broadcast"}}`,
+		`{"flags":{"slot":1,"call_type":"private"}}`,
+		`{"flags":{"slot":1,"call_type":"group","data_type":99}}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &got); err == nil {
+			t.Fatalf("unmarshal of %s succeeded", invalid)
+		}
+	}
+}
+
+func TestPacketJSONRoundTrip(t *testing.T) {
+	for _, p := range []*Packet{
+		{Timeslot: 0, Sequence: 1, SrcID: 2042214, DstID: 2042001, StreamID: 1, DataType: VoiceLC, CallType: CallTypePrivate},
+		{Timeslot: 1, Sequence: 2, SrcID: 2042214, DstID: 204, StreamID: 2, DataType: VoiceBurstA, CallType: CallTypeGroup},
+		{Timeslot: 1, Sequence: 3, SrcID: 2042214, DstID: 204, StreamID: 2, DataType: TerminatorWithLC, CallType: CallTypeGroup},
+	} {
+		p.SetData(bytes.Repeat([]byte{p.Sequence}, 33))
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		var got Packet
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("unmarshal of %s failed: %v", data, err)
+		}
+		if got.String() != p.String() || got.CallType != p.CallType || !bytes.Equal(got.Data, p.Data) {
+			t.Fatalf("expected %s, got %s", p, &got)
+		}
+	}
+
+	var p = &Packet{DataType: VoiceLC, CallType: CallTypePrivate}
+	data, _ := json.Marshal(p)
+	if !bytes.Contains(data, []byte(`"call_type":"unit"`)) {
+		t.Fatalf("expected unit call type, got %s", data)
+	}
+}
+
+func TestPacketBinary(t *testing.T) {
+	var p = &Packet{
+		Timeslot:   1,
+		Sequence:   42,
+		SrcID:      2042001,
+		DstID:      2042214,
+		RepeaterID: 204221401,
+		StreamID:   0x1a2b3c4d,
+		DataType:   VoiceBurstC,
+		CallType:   CallTypePrivate,
+	}
+	p.SetData(bytes.Repeat([]byte{0xa5}, 33))
+
+	for _, meta := range []bool{false, true} {
+		p.BER, p.RSSI, p.HasMeta = 0, 0, meta
+		if meta {
+			p.BER, p.RSSI = 3, 87
+		}
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		var size = 17 + 33
+		if meta {
+			size += 2
+		}
+		if len(data) != size {
+			t.Fatalf("expected %d bytes, got %d", size, len(data))
+		}
+
+		var got Packet
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		switch {
+		case got.String() != p.String() || got.RepeaterID != p.RepeaterID || got.CallType != p.CallType:
+			t.Fatalf("expected %s, got %s", p, &got)
+		case !bytes.Equal(got.Data, p.Data) || !bytes.Equal(got.Bits, p.Bits):
+			t.Fatalf("expected data %x, got %x", p.Data, got.Data)
+		case got.HasMeta != meta || got.BER != p.BER || got.RSSI != p.RSSI:
+			t.Fatalf("expected signal report %v %d %d, got %v %d %d", meta, p.BER, p.RSSI, got.HasMeta, got.BER, got.RSSI)
+		}
+	}
+
+	if _, err := (&Packet{SrcID: 0x1000000}).MarshalBinary(); err == nil {
+		t.Fatal("marshal of 32 bit source ID succeeded")
+	}
+	data, _ := p.MarshalBinary()
+	for _, invalid := range [][]byte{
+		data[:16],
+		append(append([]byte{}, data[:15]...), 0x80, VoiceBurstC),
+		append(append([]byte{}, data[:15]...), 0x04, VoiceBurstC),
+		append(append([]byte{}, data[:16]...), 99),
+	} {
+		var got Packet
+		if err := got.UnmarshalBinary(invalid); err == nil {
+			t.Fatalf("unmarshal of %x succeeded", invalid)
+		}
+	}
+}
+
+func TestPacketClone(t *testing.T) {
+	var p = &Packet{SrcID: 2042214, DstID: 91, DataType: VoiceBurstB, PCM: []int16{1, 2, 3}, Quality: &BurstQuality{EMB: 1}}
+	p.SetData(bytes.Repeat([]byte{0xa5}, 33))
+
+	var c = p.Clone()
+	switch {
+	case c == p || c.SrcID != p.SrcID || c.DataType != p.DataType:
+		t.Fatalf("expected a copy, got %s", c)
+	case !bytes.Equal(c.Data, p.Data) || !bytes.Equal(c.Bits, p.Bits):
+		t.Fatal("expected the same data")
+	}
+
+	c.Data[0], c.Bits[0], c.PCM[0], c.Quality.EMB = 0, 0, 0, 0
+	switch {
+	case p.Data[0] != 0xa5 || p.Bits[0] != 1:
+		t.Fatal("clone shares the data")
+	case p.PCM[0] != 1:
+		t.Fatal("clone shares the PCM audio")
+	case p.Quality.EMB != 1:
+		t.Fatal("clone shares the quality")
+	}
+
+	if c = (&Packet{StreamID: 1}).Clone(); c.Data != nil || c.Bits != nil || c.Quality != nil {
+		t.Fatalf("expected no data, got %+v", c)
+	}
+}
+
+func BenchmarkPacketClone(b *testing.B) {
+	var p = &Packet{SrcID: 2042214, DstID: 91, DataType: VoiceBurstB}
+	p.SetData(make([]byte, 33))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Clone()
+	}
+}
+
+func BenchmarkPacketAlloc(b *testing.B) {
+	var data = make([]byte, 33)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var p = &Packet{SrcID: 2042214, DstID: 91, DataType: VoiceBurstB}
+		p.SetData(append([]byte{}, data...))
+	}
+}
@@ -0,0 +1,65 @@
+package packetdata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	ipv4HeaderSize = 20
+	udpHeaderSize  = 8
+	protocolUDP    = 17
+)
+
+// ParseUDP returns the ports and payload of an IPv4 UDP packet.
+func ParseUDP(data []byte) (srcPort, dstPort uint16, payload []byte, err error) {
+	if len(data) < ipv4HeaderSize || data[0]>>4 != 4 {
+		return 0, 0, nil, errors.New("packetdata: not an IPv4 packet")
+	}
+	var ihl = int(data[0]&0x0f) * 4
+	if ihl < ipv4HeaderSize || len(data) < ihl+udpHeaderSize {
+		return 0, 0, nil, errors.New("packetdata: truncated IPv4 packet")
+	}
+	if data[9] != protocolUDP {
+		return 0, 0, nil, fmt.Errorf("packetdata: unsupported IP protocol %d", data[9])
+	}
+
+	var (
+		total = int(binary.BigEndian.Uint16(data[2:]))
+		udp   = data[ihl:]
+		size  = int(binary.BigEndian.Uint16(udp[4:]))
+	)
+	if total > len(data) || size < udpHeaderSize || size > len(udp) {
+		return 0, 0, nil, errors.New("packetdata: truncated UDP packet")
+	}
+	return binary.BigEndian.Uint16(udp[0:]), binary.BigEndian.Uint16(udp[2:]), udp[udpHeaderSize:size], nil
+}
+
+// BuildUDP builds an IPv4 UDP packet, the UDP checksum is left zero.
+func BuildUDP(src, dst net.IP, srcPort, dstPort uint16, payload []byte) []byte {
+	var data = make([]byte, ipv4HeaderSize+udpHeaderSize+len(payload))
+	data[0] = 0x45
+	binary.BigEndian.PutUint16(data[2:], uint16(len(data)))
+	data[8] = 64 // TTL
+	data[9] = protocolUDP
+	copy(data[12:16], src.To4())
+	copy(data[16:20], dst.To4())
+
+	var sum uint32
+	for i := 0; i < ipv4HeaderSize; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(data[10:], ^uint16(sum))
+
+	var udp = data[ipv4HeaderSize:]
+	binary.BigEndian.PutUint16(udp[0:], srcPort)
+	binary.BigEndian.PutUint16(udp[2:], dstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderSize+len(payload)))
+	copy(udp[udpHeaderSize:], payload)
+	return data
+}
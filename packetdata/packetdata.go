@@ -0,0 +1,152 @@
+// Package packetdata reassembles the payload of data calls from the data
+// header and the rate ½, rate ¾ and rate 1 coded data blocks of a stream.
+package packetdata
+
+import (
+	"fmt"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/trellis"
+)
+
+// DefaultTimeout is the time after the last burst of a data call after which
+// the DataReassembler drops it as incomplete.
+const DefaultTimeout = dmr.DefaultDataCallTimeout
+
+// Rate1Data is the data type of rate 1 coded data in the Slot Type, see DMR
+// AI spec. Table 6.1. Packets carry it as data type 10, which the dmr package
+// assigns to voice burst A, so rate 1 data is recognised by the Slot Type.
+const Rate1Data uint8 = 10
+
+// rate1Size is the size of a rate 1 coded data block, the 196 info bits of
+// the burst carry 192 data bits with 2 reserved bits before and after the
+// Slot Type.
+const rate1Size = 24
+
+// DataReassembler decodes the data bursts of a stream and reassembles their
+// data calls with a dmr.DataCallAssembler, which calls OnData with the
+// payload of every completed call and OnDataError for failed calls.
+//
+// The blocks are corrected by their BPTC (196, 96) or Trellis code and
+// checked by their CRCs. Rate 1 coded blocks have no forward error
+// correction on air, the Reed-Solomon (12, 9) code only protects the full
+// LC, so those are only checked. Blocks that can't be decoded are counted as
+// lost.
+type DataReassembler struct {
+	*dmr.DataCallAssembler
+}
+
+// NewDataReassembler returns a data reassembler with the default timeout.
+func NewDataReassembler() *DataReassembler {
+	return &DataReassembler{dmr.NewDataCallAssembler(nil)}
+}
+
+// Middleware reassembles the data calls and passes on every packet.
+func (r *DataReassembler) Middleware() dmr.PacketMiddleware {
+	return func(p *dmr.Packet, next func(*dmr.Packet)) {
+		r.AddPacket(p)
+		next(p)
+	}
+}
+
+// AddPacket processes a packet. Data headers start a data call for the
+// stream, dropping the incomplete call of the stream, if any. Data blocks are
+// added to the data call of their stream, blocks without a data call are
+// ignored.
+func (r *DataReassembler) AddPacket(p *dmr.Packet) {
+	if p == nil || len(p.Bits) < dmr.PayloadBits {
+		return
+	}
+
+	switch dataType := burstDataType(p); dataType {
+	case dmr.Data:
+		r.addHeader(p)
+		break
+	case dmr.Rate12Data, dmr.Rate34Data, Rate1Data:
+		data, _ := decodeBlock(p, dataType)
+		if dataType == Rate1Data {
+			// The dmr package parses rate 1 blocks as data type Data
+			dataType = dmr.Data
+		}
+		// Failed blocks and calls are passed to OnDataError
+		r.AddDataBlock(p, dataType, data)
+		break
+	}
+}
+
+func (r *DataReassembler) addHeader(p *dmr.Packet) {
+	var data = make([]byte, dmr.DataHeaderSize)
+	if err := bptc.Decode(p.InfoBits(), data); err != nil {
+		r.fail(p, err)
+		return
+	}
+	h, err := dmr.ParseDataHeader(data, false)
+	if err != nil {
+		r.fail(p, err)
+		return
+	}
+	r.AddHeader(p, h)
+}
+
+func (r *DataReassembler) fail(p *dmr.Packet, err error) {
+	if r.OnDataError != nil {
+		r.OnDataError(p.SrcID, p.DstID, err)
+	}
+}
+
+// burstDataType returns the data type of the data sync burst, with rate 1
+// coded data told apart from voice burst A by the Slot Type.
+func burstDataType(p *dmr.Packet) uint8 {
+	if p.DataType != Rate1Data {
+		return p.DataType
+	}
+	switch dmr.SyncPattern(p.SyncBits()) {
+	case dmr.SyncPatternBSSourcedData, dmr.SyncPatternMSSourcedData:
+		st, err := dmr.ParseSlotType(p.SlotTypeBits())
+		if err != nil {
+			return dmr.UnknownSlotType
+		}
+		return st.DataType
+	}
+	return p.DataType
+}
+
+// decodeBlock returns the data block of the burst.
+func decodeBlock(p *dmr.Packet, dataType uint8) ([]byte, error) {
+	var data []byte
+	switch dataType {
+	case dmr.Rate12Data:
+		data = make([]byte, dmr.InfoSize)
+		if err := bptc.Decode(p.InfoBits(), data); err != nil {
+			return nil, err
+		}
+		break
+	case dmr.Rate34Data:
+		data = make([]byte, 18)
+		if err := trellis.Decode(p.InfoBits(), data); err != nil {
+			return nil, err
+		}
+		break
+	case Rate1Data:
+		var info = p.InfoBits()
+		data = dmr.BitsToBytes(append(append([]byte{}, info[:96]...), info[100:196]...))
+		break
+	}
+	return data, nil
+}
+
+// EncodeRate1Block returns the 196 info bits of a rate 1 coded data block of
+// 24 bytes, the reserved bits are zero.
+func EncodeRate1Block(data []byte) ([]byte, error) {
+	if len(data) != rate1Size {
+		return nil, fmt.Errorf("packetdata: expected %d bytes, got %d", rate1Size, len(data))
+	}
+	var (
+		bits = dmr.BytesToBits(data)
+		info = make([]byte, dmr.InfoBits)
+	)
+	copy(info[:96], bits[:96])
+	copy(info[100:], bits[96:])
+	return info, nil
+}
@@ -0,0 +1,196 @@
+package packetdata
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/trellis"
+)
+
+const testPayload = "The quick brown fox jumps over the lazy dog"
+
+func testBurst(t *testing.T, streamID uint32, dataType uint8, info []byte) *dmr.Packet {
+	slotType, err := dmr.BuildSlotType(1, dataType)
+	if err != nil {
+		t.Fatalf("build slot type failed: %v", err)
+	}
+	var p = &dmr.Packet{StreamID: streamID, SrcID: 2042214, DstID: 2043044, DataType: dataType}
+	p.SetInfoBits(info)
+	p.SetSlotTypeBits(slotType)
+	p.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedData))
+	return p
+}
+
+// testCall returns the bursts of a data call with the payload.
+func testCall(t *testing.T, streamID uint32, dataType uint8, confirmed bool) []*dmr.Packet {
+	var blockType = dataType
+	if dataType == Rate1Data {
+		blockType = dmr.Data
+	}
+	blocks, pad, err := dmr.Fragmenter{DataType: blockType, Confirmed: confirmed}.Fragment([]byte(testPayload))
+	if err != nil {
+		t.Fatalf("fragment failed: %v", err)
+	}
+
+	var h = &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatUnconfirmedData,
+		ServiceAccessPoint: dmr.ServiceAccessPointIPBasedPacketData,
+		SrcID:              2042214,
+		DstID:              2043044,
+		Data: &dmr.UnconfirmedData{
+			PadOctetCount:  uint8(pad),
+			FullMessage:    true,
+			BlocksToFollow: uint8(len(blocks)),
+		},
+	}
+	if confirmed {
+		h.PacketFormat = dmr.PacketFormatConfirmedData
+		h.Data = &dmr.ConfirmedData{
+			PadOctetCount:  uint8(pad),
+			FullMessage:    true,
+			BlocksToFollow: uint8(len(blocks)),
+		}
+	}
+	data, err := h.Bytes()
+	if err != nil {
+		t.Fatalf("encode header failed: %v", err)
+	}
+	var info = make([]byte, dmr.InfoBits)
+	if err := bptc.Encode(data, info); err != nil {
+		t.Fatalf("bptc encode failed: %v", err)
+	}
+
+	var packets = []*dmr.Packet{testBurst(t, streamID, dmr.Data, info)}
+	for _, block := range blocks {
+		var info = make([]byte, dmr.InfoBits)
+		switch dataType {
+		case dmr.Rate12Data:
+			err = bptc.Encode(block, info)
+			break
+		case dmr.Rate34Data:
+			info, err = trellis.Encode(block)
+			break
+		case Rate1Data:
+			info, err = EncodeRate1Block(block)
+			break
+		}
+		if err != nil {
+			t.Fatalf("encode block failed: %v", err)
+		}
+		packets = append(packets, testBurst(t, streamID, dataType, info))
+	}
+	return packets
+}
+
+func TestDataReassembler(t *testing.T) {
+	for _, dataType := range []uint8{dmr.Rate12Data, dmr.Rate34Data, Rate1Data} {
+		for _, confirmed := range []bool{false, true} {
+			var (
+				r        = NewDataReassembler()
+				received []byte
+				sap      uint8
+				errs     []error
+			)
+			r.OnData = func(call *dmr.DataCall) {
+				if call.SrcID != 2042214 || call.DstID != 2043044 {
+					t.Fatalf("unexpected addresses %d->%d", call.SrcID, call.DstID)
+				}
+				received, sap = call.Data, call.ServiceAccessPoint()
+			}
+			r.OnDataError = func(_, _ uint32, err error) { errs = append(errs, err) }
+
+			var packets = testCall(t, 1, dataType, confirmed)
+			if len(packets) < 3 {
+				t.Fatalf("expected at least two blocks, got %d", len(packets)-1)
+			}
+			for _, p := range packets {
+				r.AddPacket(p)
+			}
+			switch {
+			case len(errs) != 0:
+				t.Fatalf("data type %d, confirmed %t: unexpected errors %v", dataType, confirmed, errs)
+			case string(received) != testPayload:
+				t.Fatalf("data type %d, confirmed %t: expected %q, got %q", dataType, confirmed, testPayload, received)
+			case sap != dmr.ServiceAccessPointIPBasedPacketData:
+				t.Fatalf("data type %d, confirmed %t: expected sap %d, got %d",
+					dataType, confirmed, dmr.ServiceAccessPointIPBasedPacketData, sap)
+			}
+		}
+	}
+}
+
+func TestDataReassemblerErrors(t *testing.T) {
+	var (
+		r        = NewDataReassembler()
+		received int
+		errs     []error
+	)
+	r.OnData = func(*dmr.DataCall) { received++ }
+	r.OnDataError = func(_, _ uint32, err error) { errs = append(errs, err) }
+
+	// A corrupted unconfirmed block fails the CRC-32
+	var packets = testCall(t, 1, Rate1Data, false)
+	packets[1].Bits[0] ^= 1
+	for _, p := range packets {
+		r.AddPacket(p)
+	}
+	if received != 0 || len(errs) != 1 {
+		t.Fatalf("expected a CRC error, got %d received, errors %v", received, errs)
+	}
+
+	// A corrupted confirmed block is lost until it is retransmitted
+	errs = nil
+	packets = testCall(t, 2, Rate1Data, true)
+	var corrupt = packets[1].Clone()
+	corrupt.Bits[0] ^= 1
+	r.AddPacket(packets[0])
+	r.AddPacket(corrupt)
+	for _, p := range packets[2:] {
+		r.AddPacket(p)
+	}
+	if received != 0 || len(errs) != 0 {
+		t.Fatalf("expected an incomplete call, got %d received, errors %v", received, errs)
+	}
+	r.AddPacket(packets[1])
+	if received != 1 || len(errs) != 0 {
+		t.Fatalf("expected a retransmitted block, got %d received, errors %v", received, errs)
+	}
+
+	// A new header drops the incomplete call of the stream
+	packets = testCall(t, 3, dmr.Rate12Data, false)
+	r.AddPacket(packets[0])
+	r.AddPacket(packets[1])
+	for _, p := range packets {
+		r.AddPacket(p)
+	}
+	if received != 2 || len(errs) != 1 {
+		t.Fatalf("expected an interrupted call, got %d received, errors %v", received, errs)
+	}
+
+	// Blocks without data header and voice bursts are ignored
+	errs = nil
+	var voice = &dmr.Packet{StreamID: 4, DataType: dmr.VoiceBurstA}
+	voice.SetData(bytes.Repeat([]byte{0xa5}, 33))
+	voice.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedVoice))
+	r.AddPacket(voice)
+	for _, p := range testCall(t, 5, dmr.Rate34Data, false)[1:] {
+		r.AddPacket(p)
+	}
+	if received != 2 || len(errs) != 0 {
+		t.Fatalf("expected blocks to be ignored, got %d received, errors %v", received, errs)
+	}
+
+	// Incomplete calls time out
+	var timeouts = make(chan error, 1)
+	r.Timeout = time.Millisecond * 10
+	r.OnDataError = func(_, _ uint32, err error) { timeouts <- err }
+	r.AddPacket(testCall(t, 6, dmr.Rate12Data, false)[0])
+	select {
+	case <-timeouts:
+	case <-time.After(time.Second):
+		t.Fatal("expected a timeout")
+	}
+}
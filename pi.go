@@ -0,0 +1,92 @@
+package dmr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/crc"
+)
+
+// Privacy algorithm IDs of the PI header
+const (
+	AlgIDARC4   uint8 = 0x21
+	AlgIDDES    uint8 = 0x22
+	AlgIDAES128 uint8 = 0x24
+	AlgIDAES256 uint8 = 0x25
+)
+
+var AlgIDName = map[uint8]string{
+	AlgIDARC4:   "ARC4",
+	AlgIDDES:    "DES",
+	AlgIDAES128: "AES-128",
+	AlgIDAES256: "AES-256",
+}
+
+// PIHeader is the Privacy Indicator header, the standalone burst preceding
+// the voice bursts of an encrypted call. It carries the algorithm and key of
+// the call and the message indicator, which is the initialization vector of
+// the keystream of the first superframe.
+type PIHeader struct {
+	AlgID        uint8
+	FeatureSetID uint8
+	KeyID        uint8
+	MI           uint32 // Message indicator
+	DstID        uint32
+	CRC          uint16
+}
+
+func (h *PIHeader) String() string {
+	var alg, ok = AlgIDName[h.AlgID]
+	if !ok {
+		alg = fmt.Sprintf("algorithm %#02x", h.AlgID)
+	}
+	return fmt.Sprintf("encrypted (%s, key %d), MI %08x", alg, h.KeyID, h.MI)
+}
+
+// ParsePIHeader parses the BPTC (196, 96) decoded info of a PI header burst
+// and verifies its CRC.
+func ParsePIHeader(data []byte) (*PIHeader, error) {
+	if data == nil {
+		return nil, errors.New("dmr/pi header: data can't be nil")
+	}
+	if len(data) != InfoSize {
+		return nil, fmt.Errorf("dmr/pi header: data must be %d bytes, got %d", InfoSize, len(data))
+	}
+	var (
+		ccrc = binary.BigEndian.Uint16(data[10:])
+		hcrc = crc.CRC16(data[:10], crc.MaskPIHeader)
+	)
+	if ccrc != hcrc {
+		return nil, fmt.Errorf("dmr/pi header: CRC mismatch, %#04x != %#04x", ccrc, hcrc)
+	}
+
+	return &PIHeader{
+		AlgID:        data[0],
+		FeatureSetID: data[1],
+		KeyID:        data[2],
+		MI:           binary.BigEndian.Uint32(data[3:]),
+		DstID:        uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9]),
+		CRC:          ccrc,
+	}, nil
+}
+
+// Bytes returns the PI header with its CRC, to be BPTC (196, 96) encoded.
+func (h *PIHeader) Bytes() ([]byte, error) {
+	if h.DstID > 0xffffff {
+		return nil, fmt.Errorf("dmr/pi header: destination %d out of range", h.DstID)
+	}
+
+	var data = make([]byte, InfoSize)
+	data[0] = h.AlgID
+	data[1] = h.FeatureSetID
+	data[2] = h.KeyID
+	binary.BigEndian.PutUint32(data[3:], h.MI)
+	data[7] = uint8(h.DstID >> 16)
+	data[8] = uint8(h.DstID >> 8)
+	data[9] = uint8(h.DstID)
+
+	h.CRC = crc.CRC16(data[:10], crc.MaskPIHeader)
+	binary.BigEndian.PutUint16(data[10:], h.CRC)
+	return data, nil
+}
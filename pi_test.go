@@ -0,0 +1,50 @@
+package dmr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPIHeader(t *testing.T) {
+	// PI header of an AES-256 encrypted call to talkgroup 91
+	data, err := hex.DecodeString("2510055f3a91c400005ba14b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParsePIHeader(data)
+	switch {
+	case err != nil:
+		t.Fatalf("parse failed: %v", err)
+	case h.AlgID != AlgIDAES256 || h.KeyID != 5 || h.FeatureSetID != 0x10:
+		t.Fatalf("expected AES-256 key 5, got %s", h)
+	case h.MI != 0x5f3a91c4 || h.DstID != 91:
+		t.Fatalf("expected MI 5f3a91c4 to 91, got MI %08x to %d", h.MI, h.DstID)
+	case h.String() != "encrypted (AES-256, key 5), MI 5f3a91c4":
+		t.Fatalf("unexpected string %q", h.String())
+	}
+
+	encoded, err := (&PIHeader{AlgID: h.AlgID, FeatureSetID: h.FeatureSetID, KeyID: h.KeyID, MI: h.MI, DstID: h.DstID}).Bytes()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Fatalf("expected %x, got %x", data, encoded)
+	}
+
+	var corrupt = append([]byte{}, data...)
+	corrupt[2] ^= 0x01
+	if _, err := ParsePIHeader(corrupt); err == nil {
+		t.Fatal("parse of corrupted header succeeded")
+	}
+	// The CRC mask of the PI header differs from the data header's
+	if encoded, err = (&DataHeader{DstID: 91}).Bytes(); err != nil {
+		t.Fatalf("encode data header failed: %v", err)
+	}
+	if _, err := ParsePIHeader(encoded); err == nil {
+		t.Fatal("parse of data header succeeded")
+	}
+	if _, err := ParsePIHeader(data[:10]); err == nil {
+		t.Fatal("parse of 10 bytes succeeded")
+	}
+}
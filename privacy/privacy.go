@@ -0,0 +1,262 @@
+// Package privacy implements DMR basic privacy, the voice scrambling offered
+// by most radios. Basic privacy XORs the 49 voice parameter bits of every
+// AMBE+2 frame with a keystream derived from a 16 bit key. Enhanced privacy
+// is not implemented, but can be added as another Cipher.
+package privacy
+
+import (
+	"crypto/rc4"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// Cipher generates the keystream of an encrypted call.
+type Cipher interface {
+	// Keystream returns the AMBEDataBits keystream bits for the voice
+	// frame n of a call, the frames are numbered from zero.
+	Keystream(n int) []byte
+}
+
+// BasicPrivacy is the basic privacy cipher, the keystream is the same for
+// every frame.
+type BasicPrivacy struct {
+	keystream []byte
+}
+
+// NewBasicPrivacy returns the basic privacy cipher for the key. The keystream
+// is the start of the ARC4 keystream of the key in big endian order.
+func NewBasicPrivacy(key uint16) *BasicPrivacy {
+	c, _ := rc4.NewCipher([]byte{uint8(key >> 8), uint8(key)})
+	var ks = make([]byte, (dmr.AMBEDataBits+7)/8)
+	c.XORKeyStream(ks, ks)
+	return &BasicPrivacy{keystream: dmr.BytesToBits(ks)[:dmr.AMBEDataBits]}
+}
+
+// Keystream returns the keystream for the voice frame n.
+func (bp *BasicPrivacy) Keystream(_ int) []byte {
+	return bp.keystream
+}
+
+// KeyTable maps the key indices programmed in radios to the 16 bit basic
+// privacy keys.
+type KeyTable map[uint8]uint16
+
+// Cipher returns the cipher for the key at index.
+func (t KeyTable) Cipher(index uint8) (Cipher, bool) {
+	key, ok := t[index]
+	if !ok {
+		return nil, false
+	}
+	return NewBasicPrivacy(key), true
+}
+
+// Scramble XORs the voice parameters of the three AMBE+2 frames of the voice
+// burst with the keystream of the cipher. The frames are numbered from
+// frame, the number of the first frame of the burst in the call. As the
+// scrambling is a XOR, Scramble also descrambles.
+func Scramble(c Cipher, p *dmr.Packet, frame int) error {
+	if p.DataType < dmr.VoiceBurstA || p.DataType > dmr.VoiceBurstF {
+		return errors.New("privacy: not a voice burst")
+	}
+	if len(p.Bits) < dmr.PayloadBits {
+		return fmt.Errorf("privacy: expected %d payload bits, got %d", dmr.PayloadBits, len(p.Bits))
+	}
+
+	frames, err := dmr.SplitAMBEFrames(p.VoiceBits())
+	if err != nil {
+		return err
+	}
+	for i := range frames {
+		bits, _, err := dmr.DecodeAMBEFrame(frames[i])
+		if err != nil {
+			return err
+		}
+		var ks = c.Keystream(frame + i)
+		if len(ks) != dmr.AMBEDataBits {
+			return fmt.Errorf("privacy: expected %d keystream bits, got %d", dmr.AMBEDataBits, len(ks))
+		}
+		for j := range bits {
+			bits[j] ^= ks[j]
+		}
+		if frames[i], err = dmr.EncodeAMBEFrame(bits); err != nil {
+			return err
+		}
+	}
+
+	var center = p.Bits[dmr.VoiceHalfBits : dmr.VoiceHalfBits+dmr.SignalBits]
+	payload, err := dmr.BuildVoiceBurst(frames, center)
+	if err != nil {
+		return err
+	}
+	p.SetData(dmr.BitsToBytes(payload))
+	return nil
+}
+
+// Descramble descrambles the voice burst, see Scramble.
+func Descramble(c Cipher, p *dmr.Packet, frame int) error {
+	return Scramble(c, p, frame)
+}
+
+// DefaultTimeout is the time after the last frame of a stream after which the
+// Descrambler forgets a stream without terminator.
+const DefaultTimeout = time.Second
+
+// Descrambler tracks the Link Control of voice streams and flags the calls
+// that have the privacy service option set. If the application supplies the
+// key, the voice bursts of encrypted calls are descrambled before they are
+// passed on, so they can be decoded as any other call.
+type Descrambler struct {
+	Timeout time.Duration
+
+	// Keys returns the cipher for an encrypted call, or false if the key is
+	// unknown, in which case the call is passed on as is. The source and
+	// destination of the call are in the LC, the key index is not carried
+	// over the air for basic privacy, use for example a KeyTable lookup per
+	// talkgroup. If nil, no calls are descrambled.
+	Keys func(lc *dmr.LC) (Cipher, bool)
+	// OnEncrypted is called once per encrypted call, when the privacy
+	// service option was first seen.
+	OnEncrypted func(p *dmr.Packet, lc *dmr.LC)
+
+	mutex   *sync.Mutex
+	emb     *dmr.EMBReassembler
+	lc      *dmr.LC // Set by the EMB reassembler
+	streams map[uint32]*stream
+	now     func() time.Time
+}
+
+type stream struct {
+	encrypted bool
+	cipher    Cipher
+	frames    int // Voice frames of the call so far
+	last      time.Time
+}
+
+// NewDescrambler returns a descrambler with the default timeout.
+func NewDescrambler() *Descrambler {
+	var d = &Descrambler{
+		Timeout: DefaultTimeout,
+		mutex:   &sync.Mutex{},
+		streams: make(map[uint32]*stream),
+		now:     time.Now,
+	}
+	d.emb = dmr.NewEMBReassembler(func(_ uint32, lc *dmr.LC) { d.lc = lc })
+	return d
+}
+
+// Middleware descrambles the voice bursts of encrypted calls and passes on
+// every packet.
+func (d *Descrambler) Middleware() dmr.PacketMiddleware {
+	return func(p *dmr.Packet, next func(*dmr.Packet)) {
+		d.AddPacket(p)
+		next(p)
+	}
+}
+
+// AddPacket processes a packet, descrambling it in place if it is a voice
+// burst of an encrypted call with a known key.
+func (d *Descrambler) AddPacket(p *dmr.Packet) {
+	if p == nil || len(p.Bits) < dmr.PayloadBits {
+		return
+	}
+
+	var now = d.now()
+
+	d.mutex.Lock()
+	s, ok := d.streams[p.StreamID]
+	if !ok {
+		d.expire(now)
+		s = &stream{}
+		d.streams[p.StreamID] = s
+	}
+	s.last = now
+
+	var lc = d.decodeLC(p)
+	if p.DataType == dmr.TerminatorWithLC {
+		delete(d.streams, p.StreamID)
+	}
+	var started = lc != nil && lc.ServiceOptions.Privacy && !s.encrypted
+	if started {
+		s.encrypted = true
+		if d.Keys != nil {
+			s.cipher, _ = d.Keys(lc)
+		}
+	}
+
+	var (
+		cipher Cipher
+		frame  int
+	)
+	if p.DataType >= dmr.VoiceBurstA && p.DataType <= dmr.VoiceBurstF {
+		cipher, frame = s.cipher, s.frames
+		s.frames += dmr.AMBEBurstFrame
+	}
+	d.mutex.Unlock()
+
+	if started && d.OnEncrypted != nil {
+		d.OnEncrypted(p, lc)
+	}
+	if cipher != nil {
+		Descramble(cipher, p, frame)
+	}
+}
+
+// Encrypted returns true if the stream has the privacy service option set.
+// Streams are forgotten after their terminator.
+func (d *Descrambler) Encrypted(streamID uint32) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if s, ok := d.streams[streamID]; ok {
+		return s.encrypted
+	}
+	return false
+}
+
+// decodeLC decodes the LC of the packet, if any, the caller must hold the
+// mutex.
+func (d *Descrambler) decodeLC(p *dmr.Packet) *dmr.LC {
+	switch p.DataType {
+	case dmr.VoiceLC, dmr.TerminatorWithLC:
+		var (
+			data = make([]byte, 12)
+			mask = dmr.VoiceLCHeaderMask
+		)
+		if p.DataType == dmr.TerminatorWithLC {
+			mask = dmr.TerminatorWithLCMask
+		}
+		if err := bptc.Decode(p.InfoBits(), data); err != nil {
+			return nil
+		}
+		lc, err := dmr.ParseFullLCWithMask(data, mask)
+		if err != nil {
+			return nil
+		}
+		return lc
+	case dmr.VoiceBurstB, dmr.VoiceBurstC, dmr.VoiceBurstD, dmr.VoiceBurstE, dmr.VoiceBurstF:
+		d.lc = nil
+		if err := d.emb.AddPacket(p); err != nil {
+			return nil
+		}
+		return d.lc
+	}
+	return nil
+}
+
+// expire forgets the streams without frames for Timeout, the caller must hold
+// the mutex.
+func (d *Descrambler) expire(now time.Time) {
+	var timeout = d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	for id, s := range d.streams {
+		if now.Sub(s.last) > timeout {
+			delete(d.streams, id)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package privacy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+)
+
+// Voice burst A with the AMBE+2 silence frame.
+const testSilenceBurst = "b9e881526173002a6bb9e881526755fd7df75f7173002a6bb9e881526173002a6b"
+
+func testVoiceBurst(t *testing.T, streamID uint32) *dmr.Packet {
+	data, _ := hex.DecodeString(testSilenceBurst)
+	var p = &dmr.Packet{StreamID: streamID, DataType: dmr.VoiceBurstA}
+	p.SetData(data)
+	return p
+}
+
+func testLCPacket(t *testing.T, streamID uint32, dataType uint8, privacy bool) *dmr.Packet {
+	var (
+		lc = &dmr.LC{
+			CallType:       dmr.CallTypeGroup,
+			SrcID:          2042215,
+			DstID:          204,
+			ServiceOptions: dmr.ServiceOptions{Privacy: privacy},
+		}
+		mask = dmr.VoiceLCHeaderMask
+	)
+	if dataType == dmr.TerminatorWithLC {
+		mask = dmr.TerminatorWithLCMask
+	}
+	data, err := dmr.BuildFullLC(lc, mask)
+	if err != nil {
+		t.Fatalf("build LC failed: %v", err)
+	}
+	var info = make([]byte, dmr.InfoBits)
+	if err := bptc.Encode(data, info); err != nil {
+		t.Fatalf("bptc encode failed: %v", err)
+	}
+	var p = &dmr.Packet{StreamID: streamID, DataType: dataType}
+	p.SetInfoBits(info)
+	return p
+}
+
+func TestScramble(t *testing.T) {
+	var (
+		p        = testVoiceBurst(t, 1)
+		original = append([]byte{}, p.Data...)
+		center   = append([]byte{}, p.Data[14:19]...)
+		c        = NewBasicPrivacy(0x1234)
+	)
+	if len(c.Keystream(0)) != dmr.AMBEDataBits {
+		t.Fatalf("expected %d keystream bits, got %d", dmr.AMBEDataBits, len(c.Keystream(0)))
+	}
+	if bytes.Equal(c.Keystream(0), NewBasicPrivacy(0x1235).Keystream(0)) {
+		t.Fatal("expected different keystreams for different keys")
+	}
+
+	if err := Scramble(c, p, 0); err != nil {
+		t.Fatalf("scramble failed: %v", err)
+	}
+	switch {
+	case bytes.Equal(p.Data, original):
+		t.Fatal("scramble didn't change the voice burst")
+	case !bytes.Equal(p.Data[14:19], center):
+		t.Fatal("scramble changed the voice sync")
+	}
+	if err := Descramble(c, p, 0); err != nil {
+		t.Fatalf("descramble failed: %v", err)
+	}
+	if !bytes.Equal(p.Data, original) {
+		t.Fatalf("expected %x, got %x", original, p.Data)
+	}
+
+	if err := Scramble(c, testLCPacket(t, 1, dmr.VoiceLC, true), 0); err == nil {
+		t.Fatal("scramble of voice LC header succeeded")
+	}
+}
+
+func TestDescrambler(t *testing.T) {
+	var (
+		d          = NewDescrambler()
+		keys       = KeyTable{1: 0x1234}
+		encrypted  []uint32
+		voice      = testVoiceBurst(t, 1)
+		original   = append([]byte{}, voice.Data...)
+		clock      = time.Unix(1451736000, 0)
+		passed     int
+		middleware = d.Middleware()
+	)
+	d.now = func() time.Time { return clock }
+	d.Keys = func(lc *dmr.LC) (Cipher, bool) {
+		if lc.DstID != 204 {
+			return nil, false
+		}
+		return keys.Cipher(1)
+	}
+	d.OnEncrypted = func(p *dmr.Packet, lc *dmr.LC) {
+		encrypted = append(encrypted, p.StreamID)
+	}
+	Scramble(NewBasicPrivacy(0x1234), voice, 0)
+
+	for _, p := range []*dmr.Packet{
+		testLCPacket(t, 1, dmr.VoiceLC, true),
+		voice,
+		testLCPacket(t, 2, dmr.VoiceLC, false),
+	} {
+		middleware(p, func(*dmr.Packet) { passed++ })
+	}
+	switch {
+	case passed != 3:
+		t.Fatalf("expected 3 packets passed, got %d", passed)
+	case len(encrypted) != 1 || encrypted[0] != 1:
+		t.Fatalf("expected stream 1 flagged encrypted, got %v", encrypted)
+	case !d.Encrypted(1) || d.Encrypted(2):
+		t.Fatal("expected only stream 1 to be encrypted")
+	case !bytes.Equal(voice.Data, original):
+		t.Fatalf("expected descrambled %x, got %x", original, voice.Data)
+	}
+
+	// Clear calls are passed on as is.
+	var clear = testVoiceBurst(t, 2)
+	d.AddPacket(clear)
+	if !bytes.Equal(clear.Data, original) {
+		t.Fatal("clear voice burst changed")
+	}
+
+	d.AddPacket(testLCPacket(t, 1, dmr.TerminatorWithLC, true))
+	if d.Encrypted(1) {
+		t.Fatal("expected stream 1 forgotten after terminator")
+	}
+
+	clock = clock.Add(DefaultTimeout * 2)
+	d.AddPacket(testLCPacket(t, 3, dmr.VoiceLC, true))
+	if d.Encrypted(2) || !d.Encrypted(3) {
+		t.Fatal("expected stream 2 to expire")
+	}
+}
@@ -0,0 +1,113 @@
+package dmr
+
+import (
+	"github.com/pd0mz/go-dmr/crc/quadres_16_7"
+	"github.com/pd0mz/go-dmr/fec/golay"
+	"github.com/pd0mz/go-dmr/fec/rs"
+)
+
+// golayVoiceBits is the number of Golay (24, 12) and (23, 12) protected bits
+// of an AMBE+2 frame.
+const golayVoiceBits = 24 + 23
+
+// BurstQuality is the number of bits corrected by the forward error
+// correction of a burst, per FEC stage. It's an estimate of the quality of the
+// radio link the burst was received on, the more bits were corrected the
+// worse the link.
+type BurstQuality struct {
+	SlotType int // Golay (20, 8) of the Slot Type of data sync bursts
+	EMB      int // Quadratic residue (16, 7) of the EMB of voice bursts B to F
+	Voice    int // Golay codes of the AMBE+2 frames of voice bursts
+	Info     int // BPTC (196, 96) of the info bits, see AddInfo
+	FullLC   int // Reed-Solomon (12, 9) symbols of the full LC, see AddFullLC
+
+	// Bits is the number of bits checked by the stages.
+	Bits int
+	// Uncorrectable is set if any of the stages found more errors than it
+	// can correct, the number of corrected bits is then a lower bound.
+	Uncorrectable bool
+}
+
+// MeasureBurstQuality checks the Slot Type of data sync bursts, and the EMB
+// and AMBE+2 frames of voice bursts. The BPTC of the info bits is not
+// checked, as it is decoded by the bptc package, see AddInfo. The packet is
+// left untouched.
+func MeasureBurstQuality(p *Packet) *BurstQuality {
+	var q = &BurstQuality{}
+	if len(p.Bits) < PayloadBits {
+		return q
+	}
+
+	switch p.FrameType() {
+	case FrameTypeDataSync:
+		var bits = append([]byte{}, p.SlotTypeBits()...)
+		n, err := golay.Correct20_8(bits)
+		q.add(&q.SlotType, n, SlotTypeBits, err)
+		break
+	case FrameTypeVoice:
+		var bits = append([]byte{}, p.EMBBits()...)
+		n, err := quadres_16_7.Correct(bits)
+		q.add(&q.EMB, n, EMBBits, err)
+		q.addVoice(p)
+		break
+	case FrameTypeVoiceSync:
+		q.addVoice(p)
+		break
+	}
+	return q
+}
+
+// AddInfo adds the result of the BPTC (196, 96) decoding of the info bits,
+// as returned by bptc.DecodeCorrected.
+func (q *BurstQuality) AddInfo(corrected int, err error) {
+	q.add(&q.Info, corrected, InfoBits, err)
+}
+
+// AddFullLC checks the Reed-Solomon (12, 9) code of the full LC of a voice LC
+// header or terminator, the 12 bytes decoded from the info bits with the mask
+// of the burst type. A corrected symbol counts as a single corrected bit.
+func (q *BurstQuality) AddFullLC(data []byte, mask uint8) {
+	if len(data) != rs.CodewordSize {
+		return
+	}
+	var codeword = append([]byte{}, data...)
+	for i := rs.DataSize; i < len(codeword); i++ {
+		codeword[i] ^= mask
+	}
+	_, n, err := rs.Decode(codeword)
+	q.add(&q.FullLC, n, len(codeword)*8, err)
+}
+
+// Corrected returns the number of bits corrected by all stages.
+func (q *BurstQuality) Corrected() int {
+	return q.SlotType + q.EMB + q.Voice + q.Info + q.FullLC
+}
+
+// BER returns the estimated bit error rate, the corrected bits as a
+// fraction of the checked bits.
+func (q *BurstQuality) BER() float64 {
+	if q.Bits == 0 {
+		return 0
+	}
+	return float64(q.Corrected()) / float64(q.Bits)
+}
+
+func (q *BurstQuality) add(stage *int, corrected, bits int, err error) {
+	q.Bits += bits
+	if err != nil {
+		q.Uncorrectable = true
+		return
+	}
+	*stage += corrected
+}
+
+func (q *BurstQuality) addVoice(p *Packet) {
+	frames, err := SplitAMBEFrames(p.VoiceBits())
+	if err != nil {
+		return
+	}
+	for _, frame := range frames {
+		_, n, err := DecodeAMBEFrame(frame)
+		q.add(&q.Voice, n, golayVoiceBits, err)
+	}
+}
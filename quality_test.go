@@ -0,0 +1,81 @@
+package dmr
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestMeasureBurstQuality(t *testing.T) {
+	// Voice burst A, the AMBE+2 frames are checked
+	burst, _ := hex.DecodeString(testSilenceBurst)
+	var p = &Packet{DataType: VoiceBurstA}
+	p.SetData(burst)
+	if q := MeasureBurstQuality(p); q.Corrected() != 0 || q.Bits != 3*golayVoiceBits || q.Uncorrectable {
+		t.Fatalf("clean voice burst: unexpected quality %+v", q)
+	}
+	p.Bits[1] ^= 1
+	p.Bits[80] ^= 1
+	if q := MeasureBurstQuality(p); q.Voice != 2 || q.BER() != 2/float64(3*golayVoiceBits) {
+		t.Fatalf("voice burst with 2 bit errors: unexpected quality %+v", q)
+	}
+
+	// Voice burst B, the EMB is also checked
+	p = &Packet{DataType: VoiceBurstB}
+	p.SetData(burst)
+	embBits, err := (&EMB{ColorCode: 1, LCSS: FirstFragment}).Bits()
+	if err != nil {
+		t.Fatalf("build EMB failed: %v", err)
+	}
+	sync, err := BuildSyncBitsFromEMB(embBits, make([]byte, EMBSignallingLCFragmentBits))
+	if err != nil {
+		t.Fatalf("build sync failed: %v", err)
+	}
+	p.SetSyncBits(sync)
+	p.Bits[VoiceHalfBits] ^= 1
+	if q := MeasureBurstQuality(p); q.EMB != 1 || q.Voice != 0 || q.Bits != EMBBits+3*golayVoiceBits {
+		t.Fatalf("voice burst with EMB bit error: unexpected quality %+v", q)
+	}
+
+	// Data sync bursts, the Slot Type is checked
+	slotType, err := BuildSlotType(1, CSBK)
+	if err != nil {
+		t.Fatalf("build slot type failed: %v", err)
+	}
+	p = &Packet{DataType: CSBK}
+	p.SetData(make([]byte, PayloadBits/8))
+	slotType[3] ^= 1
+	p.SetSlotTypeBits(slotType)
+	var q = MeasureBurstQuality(p)
+	if q.SlotType != 1 || q.Bits != SlotTypeBits {
+		t.Fatalf("data burst with slot type bit error: unexpected quality %+v", q)
+	}
+	q.AddInfo(2, nil)
+	if q.Info != 2 || q.Corrected() != 3 || q.Bits != SlotTypeBits+InfoBits || q.Uncorrectable {
+		t.Fatalf("add info: unexpected quality %+v", q)
+	}
+	q.AddInfo(-1, errors.New("test: uncorrectable"))
+	if q.Info != 2 || !q.Uncorrectable {
+		t.Fatalf("add uncorrectable info: unexpected quality %+v", q)
+	}
+
+	// Full LC of a voice LC header with a symbol error after BPTC decoding
+	data, err := BuildFullLC(&LC{CallType: CallTypeGroup, DstID: 204, SrcID: 2042214}, VoiceLCHeaderMask)
+	if err != nil {
+		t.Fatalf("build LC failed: %v", err)
+	}
+	data[4] ^= 0x81
+	q = &BurstQuality{}
+	q.AddFullLC(data, VoiceLCHeaderMask)
+	if q.FullLC != 1 || q.Corrected() != 1 || q.Bits != 96 || q.Uncorrectable {
+		t.Fatalf("full LC with symbol error: unexpected quality %+v", q)
+	}
+	q.AddFullLC(data, TerminatorWithLCMask)
+	if !q.Uncorrectable {
+		t.Fatalf("full LC with the wrong mask: unexpected quality %+v", q)
+	}
+
+	if q := MeasureBurstQuality(&Packet{DataType: CSBK}); q.Bits != 0 || q.BER() != 0 {
+		t.Fatalf("packet without bits: unexpected quality %+v", q)
+	}
+}
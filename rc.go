@@ -0,0 +1,58 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/bit"
+	"github.com/pd0mz/go-dmr/fec/hamming"
+)
+
+// ReverseChannelBits is the size of the reverse channel signalling, which
+// takes the place of the embedded signalling of a voice burst with an EMB
+// LCSS of SingleFragment.
+const ReverseChannelBits = EMBSignallingLCFragmentBits
+
+// RCCommandNone is the reverse channel command of a null embedded LC, the
+// other 4-bit commands are defined by the application, such as a request to
+// cease transmission for preemption.
+const RCCommandNone uint8 = 0
+
+// ParseReverseChannel returns the 4-bit command of the reverse channel
+// signalling, after correcting a single bit error of the Hamming (7, 4, 3)
+// codeword it starts with. The other bits are reserved. The passed bits are
+// left untouched.
+func ParseReverseChannel(bits bit.Bits) (uint8, error) {
+	if bits == nil {
+		return 0, errors.New("dmr/rc: bits can't be nil")
+	}
+	if len(bits) != ReverseChannelBits {
+		return 0, fmt.Errorf("dmr/rc: expected %d bits, got %d", ReverseChannelBits, len(bits))
+	}
+
+	var codeword = append(bit.Bits{}, bits[:hamming.Hamming7_4_3.N]...)
+	if _, ok := hamming.Hamming7_4_3.Correct(codeword); !ok {
+		return 0, errors.New("dmr/rc: checksum error")
+	}
+	command, err := codeword.Uint8(0, hamming.Hamming7_4_3.K)
+	if err != nil {
+		return 0, err
+	}
+	return command, nil
+}
+
+// BuildReverseChannel builds the reverse channel signalling bits of the
+// command, to be sent with BuildSyncBitsFromEMB.
+func BuildReverseChannel(command uint8) (bit.Bits, error) {
+	if command > 0x0f {
+		return nil, fmt.Errorf("dmr/rc: command %d out of range", command)
+	}
+
+	codeword, err := hamming.Hamming7_4_3.Encode(bit.NewBits([]byte{command << 4})[:4])
+	if err != nil {
+		return nil, err
+	}
+	var bits = make(bit.Bits, ReverseChannelBits)
+	copy(bits, codeword)
+	return bits, nil
+}
@@ -0,0 +1,39 @@
+package dmr
+
+import (
+	"testing"
+)
+
+func TestReverseChannel(t *testing.T) {
+	for command := uint8(0); command < 16; command++ {
+		bits, err := BuildReverseChannel(command)
+		if err != nil {
+			t.Fatalf("build %d failed: %v", command, err)
+		}
+		if len(bits) != ReverseChannelBits {
+			t.Fatalf("build %d: expected %d bits, got %d", command, ReverseChannelBits, len(bits))
+		}
+
+		// Single bit errors of the codeword are corrected
+		for i := -1; i < 7; i++ {
+			var corrupt = append([]byte{}, bits...)
+			if i >= 0 {
+				corrupt[i] ^= 1
+			}
+			got, err := ParseReverseChannel(corrupt)
+			switch {
+			case err != nil:
+				t.Fatalf("parse %d with error in bit %d failed: %v", command, i, err)
+			case got != command:
+				t.Fatalf("parse %d with error in bit %d: got %d", command, i, got)
+			}
+		}
+	}
+
+	if _, err := BuildReverseChannel(16); err == nil {
+		t.Fatal("build of command 16 succeeded")
+	}
+	if _, err := ParseReverseChannel(make([]byte, 7)); err == nil {
+		t.Fatal("parse of 7 bits succeeded")
+	}
+}
@@ -0,0 +1,72 @@
+package dmr
+
+import "sync"
+
+// Router dispatches packets received by a Repeater to a PacketFunc per
+// destination talkgroup or subscriber.
+type Router struct {
+	mutex    *sync.RWMutex
+	routes   map[routeKey]PacketFunc
+	fallback PacketFunc
+}
+
+type routeKey struct {
+	callType uint8
+	dstID    uint32
+}
+
+// NewRouter installs a router as the PacketFunc of the repeater.
+func NewRouter(r Repeater) *Router {
+	var router = &Router{
+		mutex:  &sync.RWMutex{},
+		routes: make(map[routeKey]PacketFunc),
+	}
+	if r != nil {
+		r.SetPacketFunc(router.PacketFunc)
+	}
+	return router
+}
+
+// Route routes group calls to talkgroup tgID to f, a nil f removes the route.
+func (r *Router) Route(tgID uint32, f PacketFunc) {
+	r.route(routeKey{CallTypeGroup, tgID}, f)
+}
+
+// RouteUnit routes private calls to subscriber id to f, a nil f removes the route.
+func (r *Router) RouteUnit(id uint32, f PacketFunc) {
+	r.route(routeKey{CallTypePrivate, id}, f)
+}
+
+// RouteDefault routes packets without a matching route to f, packets are
+// dropped if there is no default route.
+func (r *Router) RouteDefault(f PacketFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fallback = f
+}
+
+func (r *Router) route(key routeKey, f PacketFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f == nil {
+		delete(r.routes, key)
+		return
+	}
+	r.routes[key] = f
+}
+
+// PacketFunc dispatches the packet to its route.
+func (r *Router) PacketFunc(rptr Repeater, p *Packet) error {
+	r.mutex.RLock()
+	f, ok := r.routes[routeKey{p.CallType, p.DstID}]
+	if !ok {
+		f = r.fallback
+	}
+	r.mutex.RUnlock()
+
+	if f == nil {
+		return nil
+	}
+	return f(rptr, p)
+}
@@ -0,0 +1,43 @@
+package dmr
+
+import "testing"
+
+func TestRouter(t *testing.T) {
+	var (
+		got    = map[string][]uint32{}
+		r      = NewRouter(nil)
+		handle = func(name string) PacketFunc {
+			return func(_ Repeater, p *Packet) error {
+				got[name] = append(got[name], p.DstID)
+				return nil
+			}
+		}
+	)
+	r.Route(3100, handle("3100"))
+	r.Route(91, handle("91"))
+	r.RouteUnit(2042214, handle("unit"))
+
+	for _, p := range []*Packet{
+		{CallType: CallTypeGroup, DstID: 3100},
+		{CallType: CallTypeGroup, DstID: 91},
+		{CallType: CallTypeGroup, DstID: 204},
+		{CallType: CallTypePrivate, DstID: 2042214},
+		{CallType: CallTypePrivate, DstID: 91},
+	} {
+		if err := r.PacketFunc(nil, p); err != nil {
+			t.Fatalf("packet func failed: %v", err)
+		}
+	}
+	if len(got["3100"]) != 1 || len(got["91"]) != 1 || len(got["unit"]) != 1 {
+		t.Fatalf("routing failed: %v", got)
+	}
+
+	r.RouteDefault(handle("default"))
+	r.Route(91, nil)
+	if err := r.PacketFunc(nil, &Packet{CallType: CallTypeGroup, DstID: 91}); err != nil {
+		t.Fatalf("packet func failed: %v", err)
+	}
+	if len(got["91"]) != 1 || len(got["default"]) != 1 {
+		t.Fatalf("default routing failed: %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package dmr
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSequenceTimeout is the time after the last frame of a stream after
+// which the SequenceChecker forgets a stream without terminator.
+const DefaultSequenceTimeout = time.Second
+
+// sequence tracks the sequence numbers of a stream, which increment by one
+// per frame and wrap from 255 to 0.
+type sequence struct {
+	next    uint8
+	started bool
+}
+
+// check returns the expected sequence number of the packet and the number of
+// frames lost before it. Frames arriving late or twice are out of order, but
+// not lost. A voice sync starts a new superframe, if its sequence number is
+// behind it resynchronizes the stream instead of being out of order.
+func (s *sequence) check(p *Packet) (expected uint8, lost int, ok bool) {
+	expected = s.next
+	if !s.started {
+		s.next, s.started = p.Sequence+1, true
+		return p.Sequence, 0, true
+	}
+
+	switch gap := p.Sequence - expected; {
+	case gap == 0:
+		s.next++
+		return expected, 0, true
+	case gap < 0x80:
+		s.next = p.Sequence + 1
+		return expected, int(gap), false
+	case p.DataType == VoiceBurstA:
+		s.next = p.Sequence + 1
+		return p.Sequence, 0, true
+	default:
+		return expected, 0, false
+	}
+}
+
+// SequenceChecker tracks the sequence numbers of streams and reports frames
+// that are missing or arrive out of order.
+type SequenceChecker struct {
+	Timeout time.Duration
+
+	// OnOutOfOrder is called if a frame doesn't have the expected sequence
+	// number.
+	OnOutOfOrder func(streamID uint32, expected, got byte)
+
+	mutex   *sync.Mutex
+	streams map[uint32]*sequenceStream
+	now     func() time.Time
+}
+
+type sequenceStream struct {
+	sequence
+	lost int
+	last time.Time
+}
+
+// NewSequenceChecker returns a sequence checker with the default timeout.
+func NewSequenceChecker() *SequenceChecker {
+	return &SequenceChecker{
+		Timeout: DefaultSequenceTimeout,
+		mutex:   &sync.Mutex{},
+		streams: make(map[uint32]*sequenceStream),
+		now:     time.Now,
+	}
+}
+
+// Middleware checks every packet and passes it on, including packets that
+// are out of order.
+func (c *SequenceChecker) Middleware() PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		c.Check(p)
+		next(p)
+	}
+}
+
+// Check checks the sequence number of the packet and returns the number of
+// frames lost before it.
+func (c *SequenceChecker) Check(p *Packet) int {
+	if p == nil {
+		return 0
+	}
+
+	var now = c.now()
+
+	c.mutex.Lock()
+	stream, ok := c.streams[p.StreamID]
+	if !ok {
+		c.expire(now)
+		stream = &sequenceStream{}
+		c.streams[p.StreamID] = stream
+	}
+	expected, lost, inOrder := stream.check(p)
+	stream.lost += lost
+	stream.last = now
+	if p.DataType == TerminatorWithLC {
+		delete(c.streams, p.StreamID)
+	}
+	c.mutex.Unlock()
+
+	if !inOrder && c.OnOutOfOrder != nil {
+		c.OnOutOfOrder(p.StreamID, expected, p.Sequence)
+	}
+	return lost
+}
+
+// Lost returns the number of frames lost in the stream so far, streams are
+// forgotten after their terminator.
+func (c *SequenceChecker) Lost(streamID uint32) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if stream, ok := c.streams[streamID]; ok {
+		return stream.lost
+	}
+	return 0
+}
+
+// expire forgets the streams without frames for Timeout, the caller must hold
+// the mutex.
+func (c *SequenceChecker) expire(now time.Time) {
+	var timeout = c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSequenceTimeout
+	}
+	for id, stream := range c.streams {
+		if now.Sub(stream.last) > timeout {
+			delete(c.streams, id)
+		}
+	}
+}
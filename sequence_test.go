@@ -0,0 +1,72 @@
+package dmr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSequenceChecker(t *testing.T) {
+	type outOfOrder struct {
+		Expected, Got byte
+	}
+	var (
+		c      = NewSequenceChecker()
+		report []outOfOrder
+	)
+	c.OnOutOfOrder = func(streamID uint32, expected, got byte) {
+		if streamID != 1 {
+			t.Fatalf("unexpected stream %d", streamID)
+		}
+		report = append(report, outOfOrder{expected, got})
+	}
+
+	for _, test := range []struct {
+		Sequence uint8
+		DataType uint8
+		Lost     int
+	}{
+		{253, VoiceBurstA, 0},
+		{254, VoiceBurstB, 0},
+		{255, VoiceBurstC, 0},
+		{0, VoiceBurstD, 0}, // Rollover
+		{3, VoiceBurstA, 2}, // 1 and 2 lost
+		{2, VoiceBurstF, 0}, // Late
+		{4, VoiceBurstB, 0},
+		{4, VoiceBurstB, 0}, // Duplicate
+		{0, VoiceBurstA, 0}, // New superframe, resynchronized
+		{1, VoiceBurstB, 0},
+	} {
+		if lost := c.Check(&Packet{StreamID: 1, Sequence: test.Sequence, DataType: test.DataType}); lost != test.Lost {
+			t.Fatalf("sequence %d: expected %d lost, got %d", test.Sequence, test.Lost, lost)
+		}
+	}
+	var want = []outOfOrder{{1, 3}, {4, 2}, {5, 4}}
+	if len(report) != len(want) {
+		t.Fatalf("expected out of order %v, got %v", want, report)
+	}
+	for i := range want {
+		if report[i] != want[i] {
+			t.Fatalf("expected out of order %v, got %v", want, report)
+		}
+	}
+	if lost := c.Lost(1); lost != 2 {
+		t.Fatalf("expected 2 lost frames, got %d", lost)
+	}
+
+	// The terminator ends the stream
+	var passed bool
+	c.Middleware()(&Packet{StreamID: 1, Sequence: 2, DataType: TerminatorWithLC}, func(*Packet) { passed = true })
+	if !passed || c.Lost(1) != 0 || len(c.streams) != 0 {
+		t.Fatal("terminator did not end stream")
+	}
+
+	// Streams without terminator expire
+	var clock = time.Now()
+	c.now = func() time.Time { return clock }
+	c.Check(&Packet{StreamID: 2})
+	clock = clock.Add(c.Timeout * 2)
+	c.Check(&Packet{StreamID: 3})
+	if _, ok := c.streams[2]; ok || len(c.streams) != 1 {
+		t.Fatal("stream did not expire")
+	}
+}
@@ -0,0 +1,58 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/fec/golay"
+)
+
+// SlotType contains the color code and data type carried in the Slot Type
+// field of a data sync burst, see DMR AI. spec. section 9.1.3.
+type SlotType struct {
+	ColorCode uint8
+	DataType  uint8
+}
+
+func (st *SlotType) String() string {
+	return fmt.Sprintf("color code %d, %s (%d)", st.ColorCode, DataTypeName[st.DataType], st.DataType)
+}
+
+// Bits returns the Slot Type as bits, including the Golay (20, 8) parity bits.
+func (st *SlotType) Bits() ([]byte, error) {
+	return BuildSlotType(st.ColorCode, st.DataType)
+}
+
+// BuildSlotType builds the Slot Type bits suitable for transmission.
+func BuildSlotType(cc, dt uint8) ([]byte, error) {
+	if cc > 15 {
+		return nil, fmt.Errorf("dmr/slot type: color code %d out of range", cc)
+	}
+	if dt > 15 {
+		return nil, fmt.Errorf("dmr/slot type: data type %d out of range", dt)
+	}
+
+	return golay.Encode20_8(BytesToBits([]byte{cc<<4 | dt}))
+}
+
+// ParseSlotType parses the Slot Type bits and corrects up to 3 bit errors
+// using the Golay (20, 8) parity. The passed bits are left untouched.
+func ParseSlotType(bits []byte) (*SlotType, error) {
+	if bits == nil {
+		return nil, errors.New("dmr/slot type: bits can't be nil")
+	}
+	if len(bits) != SlotTypeBits {
+		return nil, fmt.Errorf("dmr/slot type: expected %d bits, got %d", SlotTypeBits, len(bits))
+	}
+
+	data, _, err := golay.Decode20_8(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	var b = BitsToBytes(data)[0]
+	return &SlotType{
+		ColorCode: b >> 4,
+		DataType:  b & 0x0f,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package dmr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSlotType(t *testing.T) {
+	// Color code 1, terminator with LC
+	var want = []byte{0, 0, 0, 1, 0, 0, 1, 0, 1, 0, 1, 0, 0, 1, 0, 1, 1, 0, 0, 1}
+	bits, err := BuildSlotType(1, TerminatorWithLC)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !bytes.Equal(bits, want) {
+		t.Fatalf("encode failed: expected %v, got %v", want, bits)
+	}
+
+	var p = &Packet{}
+	for cc := uint8(0); cc < 16; cc++ {
+		for dt := PrivacyIndicator; dt <= Idle; dt++ {
+			bits, err := BuildSlotType(cc, dt)
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+
+			p.SetSlotTypeBits(bits)
+			st, err := ParseSlotType(p.SlotTypeBits())
+			if err != nil {
+				t.Fatalf("decode color code %d, %s failed: %v", cc, DataTypeName[dt], err)
+			}
+			if st.ColorCode != cc || st.DataType != dt {
+				t.Fatalf("decode failed: expected color code %d, %s, got %s", cc, DataTypeName[dt], st)
+			}
+
+			// Single and double bit errors must be corrected
+			for i := range bits {
+				for j := i; j < len(bits); j++ {
+					var corrupt = make([]byte, len(bits))
+					copy(corrupt, bits)
+					corrupt[i] ^= 1
+					if j != i {
+						corrupt[j] ^= 1
+					}
+					st, err := ParseSlotType(corrupt)
+					if err != nil {
+						t.Fatalf("decode with bits %d and %d flipped failed: %v", i, j, err)
+					}
+					if st.ColorCode != cc || st.DataType != dt {
+						t.Fatalf("decode with bits %d and %d flipped failed: expected color code %d, %s, got %s",
+							i, j, cc, DataTypeName[dt], st)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err := BuildSlotType(16, Idle); err == nil {
+		t.Fatal("expected error for color code 16")
+	}
+
+	// Four bit errors are detected
+	bits, _ = BuildSlotType(1, Idle)
+	for _, i := range []int{0, 5, 9, 17} {
+		bits[i] ^= 1
+	}
+	if _, err := ParseSlotType(bits); err == nil {
+		t.Fatal("decode with four bits flipped did not fail")
+	}
+}
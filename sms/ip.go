@@ -0,0 +1,123 @@
+package sms
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"unicode/utf16"
+)
+
+// MotorolaTMSPort is the UDP port of the Motorola Text Message Service.
+const MotorolaTMSPort = 4007
+
+// MotorolaUnitIP returns the IPv4 address Motorola radios use for a radio ID.
+func MotorolaUnitIP(id uint32) net.IP {
+	return net.IPv4(12, uint8(id>>16), uint8(id>>8), uint8(id))
+}
+
+// MotorolaGroupIP returns the IPv4 address Motorola radios use for a talkgroup.
+func MotorolaGroupIP(id uint32) net.IP {
+	return net.IPv4(225, uint8(id>>16), uint8(id>>8), uint8(id))
+}
+
+// Motorola TMS message header bits
+const (
+	motorolaExtension   = 0x80
+	motorolaTextMessage = 0x20 | motorolaExtension // Simple text message, with header extension
+	motorolaEncoding    = 0x04                     // UTF-16LE
+)
+
+// parseMotorola parses a Motorola TMS message, which starts with the size of
+// the message, the message header, the address length and address, and the
+// sequence number with its extension octets, followed by UTF-16LE text.
+func parseMotorola(data []byte) (string, error) {
+	if len(data) < 5 {
+		return "", errors.New("sms: Motorola message too short")
+	}
+	var size = int(binary.BigEndian.Uint16(data))
+	if size < 2 || size+2 > len(data) {
+		return "", fmt.Errorf("sms: Motorola message size %d exceeds %d bytes", size, len(data)-2)
+	}
+	data = data[2 : 2+size]
+
+	var (
+		header = data[0]
+		i      = 2 + int(data[1]) // Skip address
+	)
+	if header&motorolaExtension > 0 {
+		// Sequence number and its extension octets
+		for ; i < len(data) && data[i]&motorolaExtension > 0; i++ {
+		}
+		i++
+	}
+	if i > len(data) {
+		return "", errors.New("sms: truncated Motorola message header")
+	}
+	return decodeUTF16LE(data[i:]), nil
+}
+
+func buildMotorola(text string) []byte {
+	var (
+		encoded = encodeUTF16LE(text)
+		data    = make([]byte, 6, 6+len(encoded))
+	)
+	data[2] = motorolaTextMessage
+	data[3] = 0x00 // No address
+	data[4] = motorolaExtension | 0x01
+	data[5] = motorolaEncoding
+	data = append(data, encoded...)
+	binary.BigEndian.PutUint16(data, uint16(len(data)-2))
+	return data
+}
+
+// Hytera TMP framing
+const (
+	hyteraHeader  = 0x09
+	hyteraEnd     = 0x03
+	hyteraPrivate = 0x00a1
+	hyteraGroup   = 0x00b1
+	hyteraFixed   = 17 // Header, opcode, length, request ID, destination and source IP
+)
+
+// isHytera checks if the payload is framed as a Hytera TMP text message.
+func isHytera(data []byte) bool {
+	if len(data) < hyteraFixed+2 || data[0]&0x7f != hyteraHeader || data[len(data)-1] != hyteraEnd {
+		return false
+	}
+	var opcode = binary.BigEndian.Uint16(data[1:])
+	return opcode == hyteraPrivate || opcode == hyteraGroup
+}
+
+// parseHytera parses a Hytera TMP message, the text follows the request ID
+// and the destination and source IP, the message ends with a checksum and
+// the end marker.
+func parseHytera(data []byte) (string, error) {
+	if !isHytera(data) {
+		return "", errors.New("sms: not a Hytera message")
+	}
+	return decodeUTF16LE(data[hyteraFixed : len(data)-2]), nil
+}
+
+func decodeUTF16LE(data []byte) string {
+	var text = make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		text = append(text, c)
+	}
+	return string(utf16.Decode(text))
+}
+
+func encodeUTF16LE(text string) []byte {
+	var (
+		encoded = utf16.Encode([]rune(text))
+		data    = make([]byte, len(encoded)*2)
+	)
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(data[i*2:], c)
+	}
+	return data
+}
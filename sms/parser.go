@@ -0,0 +1,132 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/packetdata"
+)
+
+// Parser decodes the text messages in the data calls reassembled by a
+// packetdata.DataReassembler, see AddCall.
+type Parser struct {
+	// OnSMS is called with the text of every message, see Parse for the
+	// supported formats.
+	OnSMS func(src, dst uint32, text string)
+	// OnSMSError is called for text messages that can't be decoded, such as
+	// IP packet data that isn't a valid text message, and by Middleware for
+	// data calls that can't be reassembled.
+	OnSMSError func(src, dst uint32, err error)
+}
+
+// NewParser returns a parser calling fn with every text message.
+func NewParser(fn func(src, dst uint32, text string)) *Parser {
+	return &Parser{OnSMS: fn}
+}
+
+// AddCall processes a completed data call, it has the signature of
+// packetdata.DataReassembler.OnData. Data calls that don't carry a text
+// message are ignored.
+func (p *Parser) AddCall(call *dmr.DataCall) {
+	m, err := Parse(call)
+	switch {
+	case errors.Is(err, errNotText):
+		return
+	case err != nil:
+		if p.OnSMSError != nil {
+			p.OnSMSError(call.SrcID, call.DstID, err)
+		}
+		return
+	}
+	if p.OnSMS != nil {
+		p.OnSMS(m.SrcID, m.DstID, m.Text)
+	}
+}
+
+// Middleware reassembles the data calls and decodes their text messages, and
+// passes on every packet.
+func (p *Parser) Middleware() dmr.PacketMiddleware {
+	var r = packetdata.NewDataReassembler()
+	r.OnData = p.AddCall
+	r.OnDataError = func(src, dst uint32, err error) {
+		if p.OnSMSError != nil {
+			p.OnSMSError(src, dst, err)
+		}
+	}
+	return r.Middleware()
+}
+
+// parseIP returns the format, the UDP ports and the text of a Motorola TMS or
+// Hytera TMP message in an IPv4 UDP packet.
+func parseIP(data []byte) (format uint8, srcPort, dstPort uint16, text string, err error) {
+	if srcPort, dstPort, data, err = packetdata.ParseUDP(data); err != nil {
+		return
+	}
+	switch {
+	case srcPort == MotorolaTMSPort || dstPort == MotorolaTMSPort:
+		format = FormatMotorola
+		text, err = parseMotorola(data)
+		break
+	case isHytera(data):
+		format = FormatHytera
+		text, err = parseHytera(data)
+		break
+	default:
+		err = fmt.Errorf("sms: unsupported message on UDP port %d", dstPort)
+	}
+	return
+}
+
+// BuildSMS builds the data header and the rate ½ data bursts of a Motorola
+// TMS text message, see BuildMotorola. The caller sets the timeslot, stream
+// ID and sequence numbers of the packets.
+func BuildSMS(srcID, dstID uint32, text string, group bool, colorCode uint8) ([]*dmr.Packet, error) {
+	h, blocks, err := BuildMotorola(text, srcID, dstID, group)
+	if err != nil {
+		return nil, err
+	}
+	return buildBursts(h, blocks, colorCode)
+}
+
+// buildBursts returns the data sync bursts of the data header and the rate ½
+// data blocks.
+func buildBursts(h *dmr.DataHeader, blocks [][]byte, colorCode uint8) ([]*dmr.Packet, error) {
+	header, err := h.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var callType = dmr.CallTypePrivate
+	if h.DstIsGroup {
+		callType = dmr.CallTypeGroup
+	}
+	var packets = make([]*dmr.Packet, 0, 1+len(blocks))
+	for i, data := range append([][]byte{header}, blocks...) {
+		var dataType = dmr.Rate12Data
+		if i == 0 {
+			dataType = dmr.Data
+		}
+		var info = make([]byte, dmr.InfoBits)
+		if err := bptc.Encode(data, info); err != nil {
+			return nil, err
+		}
+		slotType, err := dmr.BuildSlotType(colorCode, dataType)
+		if err != nil {
+			return nil, err
+		}
+
+		var p = &dmr.Packet{
+			SrcID:    h.SrcID,
+			DstID:    h.DstID,
+			CallType: callType,
+			DataType: dataType,
+		}
+		p.SetInfoBits(info)
+		p.SetSlotTypeBits(slotType)
+		p.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedData))
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
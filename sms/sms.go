@@ -0,0 +1,182 @@
+// Package sms implements text messages carried in DMR data calls
+package sms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/packetdata"
+)
+
+// Message format
+const (
+	FormatDefinedShortData uint8 = iota // Defined short data, see DMR AI spec. part 2
+	FormatMotorola                      // Motorola Text Message Service (TMS) over UDP/IP
+	FormatHytera                        // Hytera Text Message Protocol (TMP) over UDP/IP
+	FormatUDT                           // Unified Data Transport, see DMR AI spec. part 4
+)
+
+var FormatName = map[uint8]string{
+	FormatDefinedShortData: "defined short data",
+	FormatMotorola:         "Motorola TMS",
+	FormatHytera:           "Hytera TMP",
+	FormatUDT:              "UDT",
+}
+
+// udtDDFormat is the text encoding of the UDT formats that carry text, 16-bit
+// Unicode characters are sent most significant octet first.
+var udtDDFormat = map[uint8]uint8{
+	dmr.UDTFormat4BitBCD:           dmr.DDFormatBCD,
+	dmr.UDTFormatISO_7BitChars:     dmr.DDFormat7BitChar,
+	dmr.UDTFormatISO_8BitChars:     dmr.DDFormat8BitISO8859_1,
+	dmr.UDTFormat16BitUnicodeChars: dmr.DDFormatUTF16BE,
+}
+
+// errNotText is wrapped by the errors of Parse for data calls that don't
+// carry a text message.
+var errNotText = errors.New("not a text message")
+
+// Message is a received or to be sent text message.
+type Message struct {
+	Format   uint8
+	DDFormat uint8 // Text encoding for defined short data
+	SrcID    uint32
+	DstID    uint32
+	SrcPort  uint16 // UDP ports for messages over IP
+	DstPort  uint16
+	Text     string
+}
+
+func (m *Message) String() string {
+	return fmt.Sprintf("%s message %d->%d: %q", FormatName[m.Format], m.SrcID, m.DstID, m.Text)
+}
+
+// Parse interprets the payload of a completed data call as a text message.
+// Defined short data, the UDT text formats and Motorola TMS and Hytera TMP
+// messages over UDP/IP are supported.
+func Parse(call *dmr.DataCall) (*Message, error) {
+	if call == nil || call.Header == nil {
+		return nil, errors.New("sms: data call can't be nil")
+	}
+
+	var m = &Message{
+		SrcID: call.SrcID,
+		DstID: call.DstID,
+	}
+
+	switch d := call.Header.Data.(type) {
+	case *dmr.ShortDataDefinedData:
+		text, err := DecodeText(call.Data, d.DDFormat)
+		if err != nil {
+			return nil, err
+		}
+		m.Format = FormatDefinedShortData
+		m.DDFormat = d.DDFormat
+		m.Text = text
+		return m, nil
+
+	case *dmr.UDTData:
+		ddFormat, ok := udtDDFormat[d.Format]
+		if !ok {
+			return nil, fmt.Errorf("sms: UDT data call with %s (%d) is %w", dmr.UDTFormatName[d.Format], d.Format, errNotText)
+		}
+		text, err := DecodeText(call.Data, ddFormat)
+		if err != nil {
+			return nil, err
+		}
+		m.Format = FormatUDT
+		m.DDFormat = ddFormat
+		m.Text = text
+		return m, nil
+
+	case *dmr.UnconfirmedData, *dmr.ConfirmedData:
+		if call.Header.ServiceAccessPoint != dmr.ServiceAccessPointIPBasedPacketData {
+			break
+		}
+		format, srcPort, dstPort, text, err := parseIP(call.Data)
+		if err != nil {
+			return nil, err
+		}
+		m.Format, m.SrcPort, m.DstPort, m.Text = format, srcPort, dstPort, text
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("sms: data call with %s (%d) is %w",
+		dmr.ServiceAccessPointName[call.Header.ServiceAccessPoint], call.Header.ServiceAccessPoint, errNotText)
+}
+
+// Build builds the defined short data header and the rate ½ data blocks for
+// an UTF-16BE text message, the blocks are ready to be BPTC encoded.
+func Build(text string, srcID, dstID uint32, group bool) (*dmr.DataHeader, [][]byte, error) {
+	return BuildDefined(text, dmr.DDFormatUTF16BE, srcID, dstID, group)
+}
+
+// BuildDefined is like Build, using the specified text encoding.
+func BuildDefined(text string, ddFormat uint8, srcID, dstID uint32, group bool) (*dmr.DataHeader, [][]byte, error) {
+	data, err := EncodeText(text, ddFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Appended blocks is a 6-bit field
+	blocks, pad, err := fragment(data, 0x3f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatShortDataDefined,
+		DstIsGroup:         group,
+		ServiceAccessPoint: dmr.ServiceAccessPointShortData,
+		DstID:              dstID,
+		SrcID:              srcID,
+		Data: &dmr.ShortDataDefinedData{
+			AppendedBlocks: uint8(len(blocks)),
+			DDFormat:       ddFormat,
+			FullMessage:    true,
+			BitPadding:     uint8(pad * 8),
+		},
+	}, blocks, nil
+}
+
+// BuildMotorola builds the unconfirmed data header and the rate ½ data blocks
+// for a Motorola TMS text message, the blocks are ready to be BPTC encoded.
+func BuildMotorola(text string, srcID, dstID uint32, group bool) (*dmr.DataHeader, [][]byte, error) {
+	var dstIP = MotorolaUnitIP(dstID)
+	if group {
+		dstIP = MotorolaGroupIP(dstID)
+	}
+	data := packetdata.BuildUDP(MotorolaUnitIP(srcID), dstIP, MotorolaTMSPort, MotorolaTMSPort, buildMotorola(text))
+
+	// Blocks to follow is a 7-bit field
+	blocks, pad, err := fragment(data, 0x7f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &dmr.DataHeader{
+		PacketFormat:       dmr.PacketFormatUnconfirmedData,
+		DstIsGroup:         group,
+		ServiceAccessPoint: dmr.ServiceAccessPointIPBasedPacketData,
+		DstID:              dstID,
+		SrcID:              srcID,
+		Data: &dmr.UnconfirmedData{
+			PadOctetCount:  uint8(pad),
+			FullMessage:    true,
+			BlocksToFollow: uint8(len(blocks)),
+		},
+	}, blocks, nil
+}
+
+func fragment(data []byte, max int) ([][]byte, int, error) {
+	var f = dmr.Fragmenter{DataType: dmr.Rate12Data}
+	blocks, pad, err := f.Fragment(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(blocks) > max {
+		return nil, 0, fmt.Errorf("sms: message needs %d blocks, maximum is %d", len(blocks), max)
+	}
+	return blocks, pad, nil
+}
@@ -0,0 +1,257 @@
+package sms
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/packetdata"
+)
+
+func testAssemble(t *testing.T, h *dmr.DataHeader, blocks [][]byte) *dmr.DataCall {
+	var (
+		call *dmr.DataCall
+		a    = dmr.NewDataCallAssembler(func(c *dmr.DataCall) { call = c })
+		p    = &dmr.Packet{SrcID: h.SrcID, DstID: h.DstID, DataType: dmr.Rate12Data}
+	)
+
+	// Round trip the header through its on-air encoding
+	data, err := h.Bytes()
+	if err != nil {
+		t.Fatalf("encode header failed: %v", err)
+	}
+	if h, err = dmr.ParseDataHeader(data, false); err != nil {
+		t.Fatalf("decode header failed: %v", err)
+	}
+
+	if err := a.AddHeader(p, h); err != nil {
+		t.Fatalf("add header failed: %v", err)
+	}
+	for i, block := range blocks {
+		if err := a.AddBlock(p, block); err != nil {
+			t.Fatalf("add block %d failed: %v", i, err)
+		}
+	}
+	if call == nil {
+		t.Fatal("data call did not complete")
+	}
+	return call
+}
+
+func TestDefinedShortData(t *testing.T) {
+	var tests = map[uint8]string{
+		dmr.DDFormatBCD:           "2042214",
+		dmr.DDFormat7BitChar:      "hello",
+		dmr.DDFormat8BitISO8859_1: "héllo",
+		dmr.DDFormatUTF16BE:       "hello ☺",
+		dmr.DDFormatUTF8:          "hello ☺",
+	}
+	for ddFormat, text := range tests {
+		h, blocks, err := BuildDefined(text, ddFormat, 2042214, 2043044, false)
+		if err != nil {
+			t.Fatalf("build %s failed: %v", dmr.DDFormatName[ddFormat], err)
+		}
+
+		m, err := Parse(testAssemble(t, h, blocks))
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", dmr.DDFormatName[ddFormat], err)
+		}
+		switch {
+		case m.Format != FormatDefinedShortData || m.DDFormat != ddFormat:
+			t.Fatalf("parse %s failed: wrong format %s", dmr.DDFormatName[ddFormat], FormatName[m.Format])
+
+		case m.Text != text:
+			t.Fatalf("parse %s failed: expected %q, got %q", dmr.DDFormatName[ddFormat], text, m.Text)
+
+		case m.SrcID != 2042214 || m.DstID != 2043044:
+			t.Fatalf("parse %s failed: wrong IDs %d->%d", dmr.DDFormatName[ddFormat], m.SrcID, m.DstID)
+		}
+	}
+}
+
+func TestUDT(t *testing.T) {
+	var tests = map[uint8]string{
+		dmr.UDTFormat4BitBCD:           "2042214",
+		dmr.UDTFormatISO_7BitChars:     "hello",
+		dmr.UDTFormatISO_8BitChars:     "héllo",
+		dmr.UDTFormat16BitUnicodeChars: "hé ☺",
+	}
+	for format, text := range tests {
+		var ddFormat = udtDDFormat[format]
+		data, err := EncodeText(text, ddFormat)
+		if err != nil {
+			t.Fatalf("encode %s failed: %v", dmr.UDTFormatName[format], err)
+		}
+		// One appended block with the CRC-16 at the end
+		var block = make([]byte, 12)
+		copy(block, data)
+
+		m, err := Parse(testAssemble(t, &dmr.DataHeader{
+			PacketFormat: dmr.PacketFormatUDT,
+			SrcID:        2042214,
+			DstID:        2043044,
+			Data:         &dmr.UDTData{Format: format, PadNibble: uint8((10 - len(data)) * 2)},
+		}, [][]byte{block}))
+		switch {
+		case err != nil:
+			t.Fatalf("parse %s failed: %v", dmr.UDTFormatName[format], err)
+
+		case m.Format != FormatUDT || m.DDFormat != ddFormat:
+			t.Fatalf("parse %s failed: wrong format %s", dmr.UDTFormatName[format], FormatName[m.Format])
+
+		case m.Text != text:
+			t.Fatalf("parse %s failed: expected %q, got %q", dmr.UDTFormatName[format], text, m.Text)
+		}
+	}
+
+	if _, err := Parse(testAssemble(t, &dmr.DataHeader{
+		PacketFormat: dmr.PacketFormatUDT,
+		Data:         &dmr.UDTData{Format: dmr.UDTFormatNMEALocation},
+	}, [][]byte{make([]byte, 12)})); err == nil {
+		t.Fatal("parse of NMEA location succeeded")
+	}
+}
+
+func TestMotorola(t *testing.T) {
+	h, blocks, err := BuildMotorola("hello", 2042214, 2043044, false)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	m, err := Parse(testAssemble(t, h, blocks))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if m.Format != FormatMotorola || m.Text != "hello" || m.DstPort != MotorolaTMSPort {
+		t.Fatalf("parse failed: got %s", m)
+	}
+}
+
+func TestMotorolaFixture(t *testing.T) {
+	// UDP payload of a Motorola TMS message with an UTF-16LE text. This is
+	// not an on-air capture, it is built from the message layout and should
+	// be replaced by a capture from a radio.
+	payload, _ := hex.DecodeString("000ea000820448006900200050004400")
+	text, err := parseMotorola(payload)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if text != "Hi PD" {
+		t.Fatalf("parse failed: expected %q, got %q", "Hi PD", text)
+	}
+}
+
+func TestHyteraFixture(t *testing.T) {
+	// UDP payload of a Hytera TMP private message with an UTF-16LE text. This
+	// is not an on-air capture either, it is built from the message layout.
+	payload, _ := hex.DecodeString("0900a1001400000001" + "0a1f2966" + "0a1f2ca4" + "48006900" + "ab03")
+	if !isHytera(payload) {
+		t.Fatal("payload not recognized as Hytera message")
+	}
+	text, err := parseHytera(payload)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if text != "Hi" {
+		t.Fatalf("parse failed: expected %q, got %q", "Hi", text)
+	}
+}
+
+func testDataCall(sap uint8, data []byte) *dmr.DataCall {
+	return &dmr.DataCall{
+		SrcID: 2042214,
+		DstID: 2043044,
+		Header: &dmr.DataHeader{
+			PacketFormat:       dmr.PacketFormatUnconfirmedData,
+			ServiceAccessPoint: sap,
+			Data:               &dmr.UnconfirmedData{},
+		},
+		Data: data,
+	}
+}
+
+func TestParser(t *testing.T) {
+	var (
+		src, dst uint32
+		texts    []string
+		errs     []error
+		p        = NewParser(func(s, d uint32, text string) {
+			src, dst = s, d
+			texts = append(texts, text)
+		})
+		middleware = p.Middleware()
+		passed     int
+		// Spans several blocks, with characters outside of ASCII and the BMP
+		text = "Héllo wörld ☺, the quick brown fox jumps over the lazy dog 😀"
+	)
+	p.OnSMSError = func(_, _ uint32, err error) { errs = append(errs, err) }
+
+	packets, err := BuildSMS(2042214, 2043044, text, false, 1)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if len(packets) < 4 {
+		t.Fatalf("expected at least three data blocks, got %d", len(packets)-1)
+	}
+	for _, packet := range packets {
+		packet.StreamID = 1
+		middleware(packet, func(*dmr.Packet) { passed++ })
+	}
+	switch {
+	case len(errs) != 0:
+		t.Fatalf("unexpected errors %v", errs)
+	case passed != len(packets):
+		t.Fatalf("expected %d packets passed, got %d", len(packets), passed)
+	case len(texts) != 1 || texts[0] != text:
+		t.Fatalf("expected %q, got %q", text, texts)
+	case src != 2042214 || dst != 2043044:
+		t.Fatalf("wrong IDs %d->%d", src, dst)
+	}
+
+	// Hytera TMP payload in an UDP packet
+	payload, _ := hex.DecodeString("0900a1001400000001" + "0a1f2966" + "0a1f2ca4" + "48006900" + "ab03")
+	p.AddCall(testDataCall(dmr.ServiceAccessPointIPBasedPacketData,
+		packetdata.BuildUDP(MotorolaUnitIP(2042214), MotorolaUnitIP(2043044), 5017, 5017, payload)))
+	if len(texts) != 2 || texts[1] != "Hi" {
+		t.Fatalf("expected %q, got %q", "Hi", texts)
+	}
+
+	// UDT with 16-bit Unicode characters, 14 octets of text, 8 pad octets
+	// and the CRC-16 in two appended blocks
+	var (
+		udt      = "Grüße ☺"
+		appended = make([]byte, 24)
+	)
+	encoded, err := EncodeText(udt, dmr.DDFormatUTF16BE)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	copy(appended, encoded)
+	packets, err = buildBursts(&dmr.DataHeader{
+		PacketFormat: dmr.PacketFormatUDT,
+		SrcID:        2042214,
+		DstID:        2043044,
+		Data: &dmr.UDTData{
+			Format:         dmr.UDTFormat16BitUnicodeChars,
+			AppendedBlocks: 1,
+			PadNibble:      uint8((22 - len(encoded)) * 2),
+		},
+	}, [][]byte{appended[:12], appended[12:]}, 1)
+	if err != nil {
+		t.Fatalf("build UDT failed: %v", err)
+	}
+	for _, packet := range packets {
+		packet.StreamID = 2
+		middleware(packet, func(*dmr.Packet) {})
+	}
+	if len(errs) != 0 || len(texts) != 3 || texts[2] != udt {
+		t.Fatalf("expected %q, got %q, errors %v", udt, texts, errs)
+	}
+
+	// Other SAPs are ignored, invalid IP packet data is reported
+	p.AddCall(testDataCall(dmr.ServiceAccessPointShortData, []byte("hello")))
+	p.AddCall(testDataCall(dmr.ServiceAccessPointIPBasedPacketData, []byte("hello")))
+	if len(texts) != 3 || len(errs) != 1 {
+		t.Fatalf("expected 1 error and no message, got %q, errors %v", texts[3:], errs)
+	}
+}
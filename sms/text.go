@@ -0,0 +1,103 @@
+package sms
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pd0mz/go-dmr"
+)
+
+// DecodeText decodes defined short data text, see dmr.DDFormat* constants.
+// Decoding stops at the first NUL character.
+func DecodeText(data []byte, ddFormat uint8) (string, error) {
+	switch ddFormat {
+	case dmr.DDFormatBCD:
+		return decodeBCD(data)
+	case dmr.DDFormat7BitChar:
+		return decode7Bit(data), nil
+	default:
+		return dmr.ParseMessageData(data, ddFormat, true)
+	}
+}
+
+// EncodeText encodes text as defined short data, see dmr.DDFormat* constants.
+func EncodeText(text string, ddFormat uint8) ([]byte, error) {
+	switch ddFormat {
+	case dmr.DDFormatBCD:
+		return encodeBCD(text)
+	case dmr.DDFormat7BitChar:
+		return encode7Bit(text)
+	default:
+		return dmr.BuildMessageData(text, ddFormat, false)
+	}
+}
+
+// decodeBCD decodes packed decimal digits, a nibble of 0xf marks the end.
+func decodeBCD(data []byte) (string, error) {
+	var text strings.Builder
+	for _, b := range data {
+		for _, digit := range []byte{b >> 4, b & 0x0f} {
+			switch {
+			case digit == 0x0f:
+				return text.String(), nil
+			case digit > 9:
+				return "", fmt.Errorf("sms: invalid BCD digit %#x", digit)
+			}
+			text.WriteByte('0' + digit)
+		}
+	}
+	return text.String(), nil
+}
+
+func encodeBCD(text string) ([]byte, error) {
+	var data = make([]byte, (len(text)+1)/2)
+	for i := range data {
+		data[i] = 0xff
+	}
+	for i, c := range []byte(text) {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("sms: can't encode %q as BCD", c)
+		}
+		if i%2 == 0 {
+			data[i/2] = (c-'0')<<4 | 0x0f
+		} else {
+			data[i/2] = data[i/2]&0xf0 | (c - '0')
+		}
+	}
+	return data, nil
+}
+
+// decode7Bit decodes packed 7-bit characters, most significant bit first.
+func decode7Bit(data []byte) string {
+	var (
+		bits = dmr.BytesToBits(data)
+		text strings.Builder
+	)
+	for i := 0; i+7 <= len(bits); i += 7 {
+		var c byte
+		for _, bit := range bits[i : i+7] {
+			c = c<<1 | bit
+		}
+		if c == 0 {
+			break
+		}
+		text.WriteByte(c)
+	}
+	return text.String()
+}
+
+func encode7Bit(text string) ([]byte, error) {
+	var bits = make([]byte, 0, len(text)*7+7)
+	for _, c := range []byte(text) {
+		if c > 0x7f {
+			return nil, fmt.Errorf("sms: can't encode %q as 7-bit character", c)
+		}
+		for i := 6; i >= 0; i-- {
+			bits = append(bits, (c>>uint(i))&1)
+		}
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, 0)
+	}
+	return dmr.BitsToBytes(bits), nil
+}
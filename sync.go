@@ -1,7 +1,9 @@
 package dmr
 
 import (
-	"bytes"
+	"fmt"
+
+	"github.com/pd0mz/go-dmr/bit"
 )
 
 // Table 9.2: SYNC Patterns
@@ -42,28 +44,71 @@ var (
 	}
 )
 
+// DefaultSyncPatternBitErrors is the number of bit errors tolerated by SyncPattern.
+const DefaultSyncPatternBitErrors = 3
+
+var syncPatterns = []struct {
+	pattern uint8
+	bytes   []byte
+}{
+	{SyncPatternBSSourcedVoice, bsSourcedVoice},
+	{SyncPatternBSSourcedData, bsSourcedData},
+	{SyncPatternMSSourcedVoice, msSourcedVoice},
+	{SyncPatternMSSourcedData, msSourcedData},
+	{SyncPatternMSSourcedRC, msSourcedRC},
+	{SyncPatternDirectVoiceTS1, directVoiceTS1},
+	{SyncPatternDirectDataTS1, directDataTS1},
+	{SyncPatternDirectVoiceTS2, directVoiceTS2},
+	{SyncPatternDirectDataTS2, directDataTS2},
+}
+
+// SyncPattern returns the SYNC pattern in the SYNC bits, tolerating up to
+// DefaultSyncPatternBitErrors bit errors.
 func SyncPattern(bits []byte) uint8 {
-	var b = BitsToBytes(bits)
-	switch {
-	case bytes.Equal(b, bsSourcedVoice):
-		return SyncPatternBSSourcedVoice
-	case bytes.Equal(b, bsSourcedData):
-		return SyncPatternBSSourcedData
-	case bytes.Equal(b, msSourcedVoice):
-		return SyncPatternMSSourcedVoice
-	case bytes.Equal(b, msSourcedData):
-		return SyncPatternMSSourcedData
-	case bytes.Equal(b, msSourcedRC):
-		return SyncPatternMSSourcedRC
-	case bytes.Equal(b, directVoiceTS1):
-		return SyncPatternDirectVoiceTS1
-	case bytes.Equal(b, directDataTS1):
-		return SyncPatternDirectDataTS1
-	case bytes.Equal(b, directVoiceTS2):
-		return SyncPatternDirectVoiceTS2
-	case bytes.Equal(b, directDataTS2):
-		return SyncPatternDirectDataTS2
-	default:
+	return ClassifySyncPattern(bits, DefaultSyncPatternBitErrors)
+}
+
+// ClassifySyncPattern returns the SYNC pattern with the smallest Hamming
+// distance to the SYNC bits, if that distance is at most maxErrors bits.
+func ClassifySyncPattern(bits []byte, maxErrors int) uint8 {
+	if len(bits) != SyncBits {
 		return SyncPatternUnknown
 	}
+
+	var (
+		b       = BitsToBytes(bits)
+		best    = SyncPatternUnknown
+		minimum = maxErrors + 1
+	)
+	for _, sync := range syncPatterns {
+		var distance int
+		for i := range b {
+			for x := b[i] ^ sync.bytes[i]; x != 0; x &= x - 1 {
+				distance++
+			}
+		}
+		if distance < minimum {
+			best, minimum = sync.pattern, distance
+		}
+	}
+	return best
+}
+
+// SyncPatternBits returns the bits of the SYNC pattern, or nil for unknown patterns.
+func SyncPatternBits(pattern uint8) []byte {
+	for _, sync := range syncPatterns {
+		if sync.pattern == pattern {
+			return BytesToBits(sync.bytes)
+		}
+	}
+	return nil
+}
+
+// ExtractSyncBits returns the 48 SYNC or embedded signalling bits in the
+// middle of a payload of PayloadBits.
+func ExtractSyncBits(payload bit.Bits) (bit.Bits, error) {
+	if len(payload) != PayloadBits {
+		return nil, fmt.Errorf("dmr/sync: expected %d payload bits, got %d", PayloadBits, len(payload))
+	}
+	return append(bit.Bits{}, payload[SyncOffsetBits:SyncOffsetBits+SyncBits]...), nil
 }
@@ -0,0 +1,63 @@
+package dmr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pd0mz/go-dmr/bit"
+)
+
+func TestSyncPattern(t *testing.T) {
+	for pattern := SyncPatternBSSourcedVoice; pattern < SyncPatternUnknown; pattern++ {
+		var bits = SyncPatternBits(pattern)
+		if test := SyncPattern(bits); test != pattern {
+			t.Fatalf("expected %s, got %s", SyncPatternName[pattern], SyncPatternName[test])
+		}
+
+		for errors := 1; errors <= 4; errors++ {
+			var corrupt = make([]byte, len(bits))
+			copy(corrupt, bits)
+			for i := 0; i < errors; i++ {
+				corrupt[i*11] ^= 1
+			}
+
+			var (
+				test = SyncPattern(corrupt)
+				want = pattern
+			)
+			if errors > DefaultSyncPatternBitErrors {
+				want = SyncPatternUnknown
+			}
+			if test != want {
+				t.Fatalf("%s with %d bit errors: expected %s, got %s", SyncPatternName[pattern],
+					errors, SyncPatternName[want], SyncPatternName[test])
+			}
+			if test = ClassifySyncPattern(corrupt, 0); test != SyncPatternUnknown {
+				t.Fatalf("%s with %d bit errors: expected no match without tolerance, got %s",
+					SyncPatternName[pattern], errors, SyncPatternName[test])
+			}
+		}
+	}
+}
+
+func TestExtractSyncBits(t *testing.T) {
+	var (
+		payload = make(bit.Bits, PayloadBits)
+		want    = SyncPatternBits(SyncPatternMSSourcedData)
+	)
+	copy(payload[SyncOffsetBits:], want)
+
+	sync, err := ExtractSyncBits(payload)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if !bytes.Equal(sync, want) {
+		t.Fatalf("extract failed: expected %v, got %v", want, sync)
+	}
+	if test := SyncPattern(sync); test != SyncPatternMSSourcedData {
+		t.Fatalf("expected %s, got %s", SyncPatternName[SyncPatternMSSourcedData], SyncPatternName[test])
+	}
+	if _, err := ExtractSyncBits(payload[:SyncBits]); err == nil {
+		t.Fatal("expected error on short payload")
+	}
+}
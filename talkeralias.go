@@ -0,0 +1,429 @@
+package dmr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TalkerAliasBits is the number of alias bits carried by the header and the
+// three blocks.
+const TalkerAliasBits = TalkerAliasHeaderBits + 3*TalkerAliasBlockBits
+
+// talkerAliasUnitBits is the size of a length unit per format: characters for
+// 7 bit and ISO 8 bit, octets for UTF-8 and code units for UTF-16.
+var talkerAliasUnitBits = map[uint8]int{
+	TalkerAlias7Bit:    7,
+	TalkerAliasISO8Bit: 8,
+	TalkerAliasUTF8:    8,
+	TalkerAliasUTF16:   16,
+}
+
+// talkerAliasOffset is the number of unused leading header bits, 8 and 16 bit
+// formats don't use the first bit after the length field.
+func talkerAliasOffset(format uint8) int {
+	if format == TalkerAlias7Bit {
+		return 0
+	}
+	return 1
+}
+
+// TalkerAliasAssembler collects the Talker Alias header and block LCs of a
+// call and decodes the alias. Blocks may arrive before the header (late
+// entry), a header with a different format or length starts a new alias.
+type TalkerAliasAssembler struct {
+	header *TalkerAliasHeaderLC
+	blocks [3][]byte
+}
+
+// NewTalkerAliasAssembler returns an empty talker alias assembler.
+func NewTalkerAliasAssembler() *TalkerAliasAssembler {
+	return &TalkerAliasAssembler{}
+}
+
+// Reset discards the collected alias.
+func (a *TalkerAliasAssembler) Reset() {
+	a.header = nil
+	a.blocks = [3][]byte{}
+}
+
+// AddLC adds a Link Control message, other LCs than Talker Alias header and
+// blocks are ignored. The alias is returned once all its characters have
+// been received.
+func (a *TalkerAliasAssembler) AddLC(lc *LC) (string, bool) {
+	if lc == nil {
+		return "", false
+	}
+
+	switch d := lc.Data.(type) {
+	case *TalkerAliasHeaderLC:
+		if len(d.Data) != TalkerAliasHeaderBits {
+			return "", false
+		}
+		if a.header != nil && (a.header.Format != d.Format || a.header.Length != d.Length) {
+			a.Reset()
+		}
+		a.header = d
+		break
+	case *TalkerAliasBlockLC:
+		if d.Block < 1 || d.Block > 3 || len(d.Data) != TalkerAliasBlockBits {
+			return "", false
+		}
+		a.blocks[d.Block-1] = d.Data
+		break
+	default:
+		return "", false
+	}
+
+	if !a.Complete() {
+		return "", false
+	}
+	return a.Alias(), true
+}
+
+// Complete returns true if all characters of the alias have been received.
+func (a *TalkerAliasAssembler) Complete() bool {
+	if a.header == nil {
+		return false
+	}
+	var need = talkerAliasOffset(a.header.Format) + int(a.header.Length)*talkerAliasUnitBits[a.header.Format]
+	return len(a.bits()) >= need
+}
+
+// Alias returns the alias decoded so far, which is the complete alias if
+// Complete returns true. Characters are decoded up to the first missing block.
+func (a *TalkerAliasAssembler) Alias() string {
+	if a.header == nil {
+		return ""
+	}
+
+	var (
+		bits  = a.bits()[talkerAliasOffset(a.header.Format):]
+		unit  = talkerAliasUnitBits[a.header.Format]
+		units = len(bits) / unit
+	)
+	if units > int(a.header.Length) {
+		units = int(a.header.Length)
+	}
+	return decodeTalkerAlias(bits[:units*unit], a.header.Format)
+}
+
+// bits returns the contiguous alias bits received, starting at the header.
+func (a *TalkerAliasAssembler) bits() []byte {
+	var bits = make([]byte, 0, TalkerAliasBits)
+	bits = append(bits, a.header.Data...)
+	for _, block := range a.blocks {
+		if block == nil {
+			break
+		}
+		bits = append(bits, block...)
+	}
+	return bits
+}
+
+// DefaultTalkerAliasTimeout is the time after the last packet of a stream
+// after which a stream without terminator is considered ended.
+const DefaultTalkerAliasTimeout = time.Second
+
+// TalkerAliasReassembler collects the Talker Alias LCs embedded in the voice
+// bursts per stream and calls OnTalkerAlias with every complete alias. If a
+// stream ends before its alias is complete, the characters received so far
+// are delivered with truncated set. A stream ends with its terminator or when
+// no packets are received for Timeout.
+type TalkerAliasReassembler struct {
+	Timeout time.Duration
+
+	// OnTalkerAlias is called with the alias of a stream, truncated is set if
+	// not all characters have been received.
+	OnTalkerAlias func(streamID uint32, alias string, truncated bool)
+
+	mutex   *sync.Mutex
+	emb     *EMBReassembler
+	streams map[uint32]*talkerAliasStream
+	pending []string // Aliases completed by the EMB reassembler
+}
+
+type talkerAliasStream struct {
+	assembler *TalkerAliasAssembler
+	delivered string // Last complete alias passed to OnTalkerAlias
+	timer     *time.Timer
+}
+
+// NewTalkerAliasReassembler returns a talker alias reassembler calling fn for
+// every reassembled alias.
+func NewTalkerAliasReassembler(fn func(streamID uint32, alias string, truncated bool)) *TalkerAliasReassembler {
+	r := &TalkerAliasReassembler{
+		Timeout:       DefaultTalkerAliasTimeout,
+		OnTalkerAlias: fn,
+		mutex:         &sync.Mutex{},
+		streams:       make(map[uint32]*talkerAliasStream),
+	}
+	r.emb = NewEMBReassembler(r.addLC)
+	return r
+}
+
+// PacketFunc can be installed as the PacketFunc of a Repeater.
+func (r *TalkerAliasReassembler) PacketFunc(_ Repeater, p *Packet) error {
+	return r.AddPacket(p)
+}
+
+// Middleware returns a PacketMiddleware that collects the talker aliases of
+// the packets passed through. Packets are passed on unmodified.
+func (r *TalkerAliasReassembler) Middleware() PacketMiddleware {
+	return func(p *Packet, next func(*Packet)) {
+		r.AddPacket(p)
+		next(p)
+	}
+}
+
+// AddPacket adds a voice packet, the terminator ends the stream.
+func (r *TalkerAliasReassembler) AddPacket(p *Packet) error {
+	if p == nil {
+		return errors.New("dmr/talker alias reassembler: packet can't be nil")
+	}
+
+	var (
+		complete, truncated []string
+		err                 error
+	)
+	r.mutex.Lock()
+	r.stream(p.StreamID)
+	if p.DataType == TerminatorWithLC {
+		truncated = r.end(p.StreamID, nil)
+	} else {
+		err = r.emb.AddPacket(p)
+		complete, r.pending = r.pending, nil
+	}
+	r.mutex.Unlock()
+
+	r.deliver(p.StreamID, complete, false)
+	r.deliver(p.StreamID, truncated, true)
+	return err
+}
+
+// AddLC adds a Link Control message of a stream, such as the LCs decoded from
+// the embedded signalling. Other LCs than Talker Alias header and blocks are
+// ignored.
+func (r *TalkerAliasReassembler) AddLC(streamID uint32, lc *LC) {
+	r.mutex.Lock()
+	r.stream(streamID)
+	var alias, ok = r.add(streamID, lc)
+	r.mutex.Unlock()
+
+	if ok {
+		r.deliver(streamID, []string{alias}, false)
+	}
+}
+
+// EndStream ends a stream, delivering a truncated alias if the alias was not
+// complete.
+func (r *TalkerAliasReassembler) EndStream(streamID uint32) {
+	r.mutex.Lock()
+	var aliases = r.end(streamID, nil)
+	r.mutex.Unlock()
+
+	r.deliver(streamID, aliases, true)
+}
+
+// stream returns the state of streamID and (re)starts its timer, with the
+// mutex held.
+func (r *TalkerAliasReassembler) stream(streamID uint32) *talkerAliasStream {
+	var stream, ok = r.streams[streamID]
+	if !ok {
+		stream = &talkerAliasStream{assembler: NewTalkerAliasAssembler()}
+		r.streams[streamID] = stream
+		stream.timer = time.AfterFunc(r.timeout(), func() {
+			r.mutex.Lock()
+			var aliases = r.end(streamID, stream)
+			r.mutex.Unlock()
+			r.deliver(streamID, aliases, true)
+		})
+	} else {
+		stream.timer.Reset(r.timeout())
+	}
+	return stream
+}
+
+// addLC is called by the EMB reassembler, with the mutex held.
+func (r *TalkerAliasReassembler) addLC(streamID uint32, lc *LC) {
+	if alias, ok := r.add(streamID, lc); ok {
+		r.pending = append(r.pending, alias)
+	}
+}
+
+// add adds an LC to the stream, with the mutex held. A complete alias is
+// returned once, unless the alias changes during the stream.
+func (r *TalkerAliasReassembler) add(streamID uint32, lc *LC) (string, bool) {
+	var stream, ok = r.streams[streamID]
+	if !ok {
+		return "", false
+	}
+	alias, ok := stream.assembler.AddLC(lc)
+	if !ok || alias == stream.delivered {
+		return "", false
+	}
+	stream.delivered = alias
+	return alias, true
+}
+
+// end removes the stream and returns the incomplete alias, with the mutex
+// held. If stream is not nil, only that stream is ended, as the timer may fire
+// after a new stream with the same stream ID started.
+func (r *TalkerAliasReassembler) end(streamID uint32, stream *talkerAliasStream) []string {
+	var active, ok = r.streams[streamID]
+	if !ok || (stream != nil && active != stream) {
+		return nil
+	}
+	active.timer.Stop()
+	delete(r.streams, streamID)
+
+	if active.assembler.Complete() {
+		return nil
+	}
+	if alias := active.assembler.Alias(); alias != "" {
+		return []string{alias}
+	}
+	return nil
+}
+
+func (r *TalkerAliasReassembler) deliver(streamID uint32, aliases []string, truncated bool) {
+	if r.OnTalkerAlias == nil {
+		return
+	}
+	for _, alias := range aliases {
+		r.OnTalkerAlias(streamID, alias, truncated)
+	}
+}
+
+func (r *TalkerAliasReassembler) timeout() time.Duration {
+	if r.Timeout <= 0 {
+		return DefaultTalkerAliasTimeout
+	}
+	return r.Timeout
+}
+
+func decodeTalkerAlias(bits []byte, format uint8) string {
+	switch format {
+	case TalkerAlias7Bit:
+		var text strings.Builder
+		for i := 0; i+7 <= len(bits); i += 7 {
+			var c byte
+			for _, bit := range bits[i : i+7] {
+				c = c<<1 | bit
+			}
+			text.WriteByte(c)
+		}
+		return text.String()
+
+	case TalkerAliasISO8Bit:
+		var text = make([]rune, 0, len(bits)/8)
+		for _, c := range BitsToBytes(bits) {
+			text = append(text, rune(c))
+		}
+		return string(text)
+
+	case TalkerAliasUTF8:
+		var data = BitsToBytes(bits)
+		// Drop an incomplete trailing character of a partial alias
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					data = data[:i]
+				}
+				break
+			}
+		}
+		return string(data)
+
+	case TalkerAliasUTF16:
+		var (
+			data = BitsToBytes(bits)
+			text = make([]uint16, len(data)/2)
+		)
+		for i := range text {
+			text[i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+		}
+		if n := len(text); n > 0 && utf16.IsSurrogate(rune(text[n-1])) && text[n-1] < 0xdc00 {
+			// Drop the high surrogate of an incomplete pair
+			text = text[:n-1]
+		}
+		return string(utf16.Decode(text))
+
+	default:
+		return ""
+	}
+}
+
+// BuildTalkerAliasLCs encodes the alias in the Talker Alias header LC and as
+// many block LCs as needed.
+func BuildTalkerAliasLCs(alias string, format uint8) ([]*LC, error) {
+	var units []uint16
+	switch format {
+	case TalkerAlias7Bit, TalkerAliasISO8Bit:
+		var max rune = 0x7f
+		if format == TalkerAliasISO8Bit {
+			max = 0xff
+		}
+		for _, c := range alias {
+			if c > max {
+				return nil, fmt.Errorf("dmr/talker alias: can't encode %q as %s", c, TalkerAliasFormatName[format])
+			}
+			units = append(units, uint16(c))
+		}
+		break
+	case TalkerAliasUTF8:
+		for _, c := range []byte(alias) {
+			units = append(units, uint16(c))
+		}
+		break
+	case TalkerAliasUTF16:
+		units = utf16.Encode([]rune(alias))
+		break
+	default:
+		return nil, fmt.Errorf("dmr/talker alias: format %d out of range", format)
+	}
+
+	var (
+		unit = talkerAliasUnitBits[format]
+		bits = make([]byte, talkerAliasOffset(format), TalkerAliasBits)
+	)
+	if len(bits)+len(units)*unit > TalkerAliasBits || len(units) > 31 {
+		return nil, fmt.Errorf("dmr/talker alias: alias of %d units exceeds the maximum length", len(units))
+	}
+	for _, u := range units {
+		for i := unit - 1; i >= 0; i-- {
+			bits = append(bits, uint8(u>>uint(i))&0x01)
+		}
+	}
+
+	var blocks = 0
+	if len(bits) > TalkerAliasHeaderBits {
+		blocks = (len(bits) - TalkerAliasHeaderBits + TalkerAliasBlockBits - 1) / TalkerAliasBlockBits
+	}
+	// The backing array is zeroed, which pads the last block
+	bits = bits[:TalkerAliasHeaderBits+blocks*TalkerAliasBlockBits]
+
+	var lcs = []*LC{&LC{
+		Opcode: TalkerAliasHeader,
+		Data: &TalkerAliasHeaderLC{
+			Format: format,
+			Length: uint8(len(units)),
+			Data:   bits[:TalkerAliasHeaderBits],
+		},
+	}}
+	for i := 0; i < blocks; i++ {
+		var offset = TalkerAliasHeaderBits + i*TalkerAliasBlockBits
+		lcs = append(lcs, &LC{
+			Opcode: TalkerAliasHeader + uint8(i+1),
+			Data: &TalkerAliasBlockLC{
+				Block: uint8(i + 1),
+				Data:  bits[offset : offset+TalkerAliasBlockBits],
+			},
+		})
+	}
+	return lcs, nil
+}
@@ -0,0 +1,207 @@
+package dmr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTalkerAliasAssembler(t *testing.T) {
+	var tests = []struct {
+		Alias  string
+		Format uint8
+		Blocks int
+	}{
+		{"PD0MZ", TalkerAlias7Bit, 0},
+		{"PD0MZ Wijnand", TalkerAlias7Bit, 1},
+		{"F4FXL Geoffrey Merck", TalkerAliasISO8Bit, 2},
+		{"Zoë Châtelet", TalkerAliasUTF8, 2},
+		{"Dvořák 日本語 ok", TalkerAliasUTF16, 3},
+	}
+
+	for _, test := range tests {
+		lcs, err := BuildTalkerAliasLCs(test.Alias, test.Format)
+		if err != nil {
+			t.Fatalf("build %q failed: %v", test.Alias, err)
+		}
+		if len(lcs) != 1+test.Blocks {
+			t.Fatalf("build %q failed: expected %d LCs, got %d", test.Alias, 1+test.Blocks, len(lcs))
+		}
+
+		var a = NewTalkerAliasAssembler()
+		for i, lc := range lcs {
+			data, err := lc.MarshalBinary()
+			if err != nil {
+				t.Fatalf("encode %s failed: %v", lc, err)
+			}
+			if lc, err = ParseLC(data); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			alias, ok := a.AddLC(lc)
+			switch {
+			case ok != (i == len(lcs)-1):
+				t.Fatalf("assemble %q failed: complete %t after %d LCs", test.Alias, ok, i+1)
+			case ok && alias != test.Alias:
+				t.Fatalf("assemble failed: expected %q, got %q", test.Alias, alias)
+			}
+		}
+	}
+}
+
+func TestTalkerAliasAssemblerPartial(t *testing.T) {
+	const want = "F4FXL Geoffrey Merck"
+	lcs, err := BuildTalkerAliasLCs(want, TalkerAliasISO8Bit)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	// Late entry: block 2 before the header and block 1
+	var a = NewTalkerAliasAssembler()
+	if _, ok := a.AddLC(lcs[2]); ok || a.Alias() != "" {
+		t.Fatalf("partial failed: got %q without header", a.Alias())
+	}
+	if _, ok := a.AddLC(lcs[0]); ok || a.Alias() != want[:6] {
+		t.Fatalf("partial failed: expected %q, got %q", want[:6], a.Alias())
+	}
+	if alias, ok := a.AddLC(lcs[1]); !ok || alias != want {
+		t.Fatalf("partial failed: expected %q, got %q", want, alias)
+	}
+
+	// A header for another alias discards the collected blocks
+	other, err := BuildTalkerAliasLCs("PD0MZ", TalkerAlias7Bit)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if alias, ok := a.AddLC(other[0]); !ok || alias != "PD0MZ" {
+		t.Fatalf("new alias failed: expected %q, got %q", "PD0MZ", alias)
+	}
+
+	a.Reset()
+	if a.Complete() || a.Alias() != "" {
+		t.Fatalf("reset failed: got %q", a.Alias())
+	}
+}
+
+func TestTalkerAliasAssemblerUTF8Partial(t *testing.T) {
+	// The header carries 6 octets, the "ë" is split over the header and block 1
+	lcs, err := BuildTalkerAliasLCs("Abcdeë", TalkerAliasUTF8)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var a = NewTalkerAliasAssembler()
+	a.AddLC(lcs[0])
+	if alias := a.Alias(); alias != "Abcde" {
+		t.Fatalf("partial failed: expected %q, got %q", "Abcde", alias)
+	}
+}
+
+func TestBuildTalkerAliasLCs(t *testing.T) {
+	var tests = []struct {
+		Alias  string
+		Format uint8
+	}{
+		{"Geoffrey Merck", TalkerAlias7Bit + 4},
+		{"é", TalkerAlias7Bit},
+		{"€", TalkerAliasISO8Bit},
+		{"0123456789012345678901234567", TalkerAliasISO8Bit},
+		{"0123456789abcd", TalkerAliasUTF16},
+	}
+	for _, test := range tests {
+		if _, err := BuildTalkerAliasLCs(test.Alias, test.Format); err == nil {
+			t.Fatalf("build %q as format %d succeeded, expected an error", test.Alias, test.Format)
+		}
+	}
+}
+
+func TestTalkerAliasReassembler(t *testing.T) {
+	type result struct {
+		StreamID  uint32
+		Alias     string
+		Truncated bool
+	}
+	var (
+		got = []result{}
+		r   = NewTalkerAliasReassembler(func(streamID uint32, alias string, truncated bool) {
+			got = append(got, result{streamID, alias, truncated})
+		})
+		lcss = []uint8{FirstFragment, Continuation, Continuation, LastFragment}
+	)
+	r.Timeout = time.Hour
+
+	lcs, err := BuildTalkerAliasLCs("F4FXL Geoffrey Merck", TalkerAliasISO8Bit)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var send = func(streamID uint32, lc *LC) {
+		fragments, err := BuildEmbeddedLCFragments(lc)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		for i, dt := range []uint8{VoiceBurstB, VoiceBurstC, VoiceBurstD, VoiceBurstE} {
+			var p = &Packet{StreamID: streamID, DataType: dt}
+			emb, err := BuildEMB(&EMB{ColorCode: 1, LCSS: lcss[i]})
+			if err != nil {
+				t.Fatalf("encode emb failed: %v", err)
+			}
+			sync, err := BuildSyncBitsFromEMB(emb, fragments[i])
+			if err != nil {
+				t.Fatalf("encode sync failed: %v", err)
+			}
+			p.SetSyncBits(sync)
+			if err := r.AddPacket(p); err != nil {
+				t.Fatalf("add packet failed: %v", err)
+			}
+		}
+	}
+
+	// Stream 1 repeats the complete alias, stream 2 ends after the first block
+	for _, lc := range append(lcs, lcs...) {
+		send(1, lc)
+	}
+	r.AddPacket(&Packet{StreamID: 1, DataType: TerminatorWithLC})
+	send(2, lcs[0])
+	send(2, lcs[1])
+	r.AddPacket(&Packet{StreamID: 2, DataType: TerminatorWithLC})
+
+	var want = []result{
+		{1, "F4FXL Geoffrey Merck", false},
+		{2, "F4FXL Geoffre", true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestTalkerAliasReassemblerTimeout(t *testing.T) {
+	var (
+		got = make(chan string, 2)
+		r   = NewTalkerAliasReassembler(func(streamID uint32, alias string, truncated bool) {
+			if streamID == 0x1234 && truncated {
+				got <- alias
+			}
+		})
+	)
+	r.Timeout = time.Millisecond * 20
+
+	lcs, err := BuildTalkerAliasLCs("PD0MZ Wijnand", TalkerAlias7Bit)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	r.AddPacket(&Packet{StreamID: 0x1234, DataType: VoiceBurstA})
+	r.AddLC(0x1234, lcs[0])
+
+	select {
+	case alias := <-got:
+		if alias != "PD0MZ W" {
+			t.Fatalf("expected truncated alias %q, got %q", "PD0MZ W", alias)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not time out")
+	}
+	r.EndStream(0x1234)
+	select {
+	case alias := <-got:
+		t.Fatalf("alias %q delivered twice", alias)
+	case <-time.After(r.Timeout * 2):
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"github.com/pd0mz/go-dmr"
 	"github.com/pd0mz/go-dmr/bptc"
 	"github.com/pd0mz/go-dmr/trellis"
-	"github.com/pd0mz/go-dmr/vbptc"
 )
 
 var log = logging.MustGetLogger("dmr/terminal")
@@ -45,21 +44,16 @@ type Slot struct {
 	selectiveAckRequestsSent int
 	rxSequence               int
 	fullMessageBlocks        int
-	embeddedSignalling       *vbptc.VBPTC
+	embeddedSignalling       *dmr.EmbeddedLCAssembler
 	last                     struct {
 		packetReceived time.Time
 	}
 }
 
 func NewSlot() *Slot {
-	s := &Slot{}
-
-	// Expecting 8 rows of variable length BPTC coded embedded LC data.
-	// It will contain 77 data bits (without the Hamming (16,11) checksums
-	// and the last row of parity bits).
-	s.embeddedSignalling = vbptc.New(8)
-
-	return s
+	return &Slot{
+		embeddedSignalling: dmr.NewEmbeddedLCAssembler(),
+	}
 }
 
 type VoiceFrameFunc func(*dmr.Packet, []byte)
@@ -528,12 +522,7 @@ func (t *Terminal) handleTerminatorWithLC(p *dmr.Packet) error {
 		return err
 	}
 
-	// Applying CRC mask to the checksum. See DMR AI. spec. page 143.
-	data[9] ^= 0x99
-	data[10] ^= 0x99
-	data[11] ^= 0x99
-
-	lc, err := dmr.ParseFullLC(data)
+	lc, err := dmr.ParseFullLCWithMask(data, dmr.TerminatorWithLCMask)
 	if err != nil {
 		return err
 	}
@@ -577,45 +566,15 @@ func (t *Terminal) handleVoice(p *dmr.Packet) error {
 		t.debugf(p, "embedded signalling %s", emb.String())
 
 		// Handling embedded signalling LC
-		switch emb.LCSS {
-		case dmr.SingleFragment:
-			return nil // FIXME(pd0mz): unhandled
-		case dmr.FirstFragment:
-			slot.embeddedSignalling.Clear()
-			break
+		frag, err := dmr.ParseEmbeddedSignallingLCFromSyncBits(sync)
+		if err != nil {
+			return err
 		}
-
-		if emb.LCSS == dmr.FirstFragment || emb.LCSS == dmr.Continuation || emb.LCSS == dmr.LastFragment {
-			frag, err := dmr.ParseEmbeddedSignallingLCFromSyncBits(sync)
-			if err != nil {
-				return err
-			}
-			if err := slot.embeddedSignalling.AddBurst(frag); err != nil {
-				return err
-			}
+		lc, err := slot.embeddedSignalling.AddFragment(emb.LCSS, frag)
+		if err != nil {
+			return err
 		}
-
-		if emb.LCSS == dmr.LastFragment {
-			if err := slot.embeddedSignalling.CheckAndRepair(); err != nil {
-				return err
-			}
-
-			var signalling = make([]byte, 77)
-			if err := slot.embeddedSignalling.GetData(signalling); err != nil {
-				return err
-			}
-			eslc, err := dmr.DeinterleaveEmbeddedSignallingLC(signalling)
-			if err != nil {
-				return err
-			}
-			if !eslc.Check() {
-				return errors.New("embedded signalling LC checksum failed")
-			}
-
-			lc, err := dmr.ParseLC(dmr.BitsToBytes(eslc.Bits))
-			if err != nil {
-				return err
-			}
+		if lc != nil {
 			t.debugf(p, "lc: %s", lc.String())
 		}
 	}
@@ -644,12 +603,7 @@ func (t *Terminal) handleVoiceLC(p *dmr.Packet) error {
 		return err
 	}
 
-	// Applying CRC mask to the checksum. See DMR AI. spec. page 143.
-	data[9] ^= 0x96
-	data[10] ^= 0x96
-	data[11] ^= 0x96
-
-	lc, err := dmr.ParseFullLC(data)
+	lc, err := dmr.ParseFullLCWithMask(data, dmr.VoiceLCHeaderMask)
 	if err != nil {
 		return err
 	}
@@ -7,6 +7,13 @@ import (
 	"github.com/pd0mz/go-dmr"
 )
 
+// MaxErrors is the maximum number of bit errors on the most likely path before
+// DecodeTribits considers the data to be uncorrectable. Random data typically
+// has 8 or more bit errors on its most likely path.
+const MaxErrors = 6
+
+const unreachable = 1 << 30
+
 var (
 	// See DMR AI protocol spec. page 130.
 	interleaveMatrix = []uint8{
@@ -16,6 +23,14 @@ var (
 		6, 7, 14, 15, 22, 23, 30, 31, 38, 39, 46, 47, 54, 55, 62, 63, 70, 71, 78, 79, 86, 87, 94, 95,
 	}
 
+	// Dibit pairs for each constellation point, see DMR AI protocol spec. page 129.
+	constellationDibits = [16][2]int8{
+		{+1, -1}, {-1, -1}, {+3, -3}, {-3, -3},
+		{-3, -1}, {+3, -1}, {-1, -3}, {+1, -3},
+		{-3, +3}, {+3, +3}, {-1, +1}, {+1, +1},
+		{+1, +3}, {-1, +3}, {+3, +1}, {-3, +1},
+	}
+
 	// See DMR AI protocol spec. page 129.
 	encoderStateTransition = []uint8{
 		0, 8, 4, 12, 2, 10, 6, 14,
@@ -45,11 +60,7 @@ func Decode(bits []byte, bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	points, err := ConstellationPoints(deinterleaved)
-	if err != nil {
-		return err
-	}
-	tribits, err := ExtractTribits(points)
+	tribits, err := DecodeTribits(deinterleaved)
 	if err != nil {
 		return err
 	}
@@ -61,6 +72,47 @@ func Decode(bits []byte, bytes []byte) error {
 	return nil
 }
 
+// Encode is a convenience function that takes 18 bytes (144 bits) binary and encodes them to 196 Info bits using Trellis encoding.
+func Encode(bytes []byte) ([]byte, error) {
+	if len(bytes) != 18 {
+		return nil, fmt.Errorf("trellis: expected 18 bytes, got %d", len(bytes))
+	}
+
+	var (
+		binary  = dmr.BytesToBits(bytes)
+		tribits = make([]uint8, 49) // Last tribit flushes the encoder
+		state   uint8
+		dibits  = make([]int8, 98)
+		bits    = make([]byte, dmr.InfoBits)
+	)
+	for i := 0; i < 144; i += 3 {
+		tribits[i/3] = binary[i]<<2 | binary[i+1]<<1 | binary[i+2]
+	}
+	for i, tribit := range tribits {
+		point := encoderStateTransition[state*8+tribit]
+		state = tribit
+		dibits[i*2] = constellationDibits[point][0]
+		dibits[i*2+1] = constellationDibits[point][1]
+	}
+
+	for i := 0; i < 98; i++ {
+		switch dibits[interleaveMatrix[i]] {
+		case +3:
+			bits[i*2+1] = 1
+			break
+		case -1:
+			bits[i*2] = 1
+			break
+		case -3:
+			bits[i*2] = 1
+			bits[i*2+1] = 1
+			break
+		}
+	}
+
+	return bits, nil
+}
+
 // ExtractDibits extracts dibits from bits.
 func ExtractDibits(bits []byte) ([]int8, error) {
 	if len(bits) != dmr.InfoBits {
@@ -201,6 +253,80 @@ func ExtractTribits(points []uint8) ([]uint8, error) {
 	return tribits, nil
 }
 
+// DecodeTribits decodes the deinterleaved dibits to Trellis tribits using a
+// Viterbi decoder, correcting symbol errors. Returns an error if the number
+// of bit errors on the most likely path exceeds MaxErrors.
+func DecodeTribits(dibits []int8) ([]uint8, error) {
+	return DecodeTribitsWithMaxErrors(dibits, MaxErrors)
+}
+
+// DecodeTribitsWithMaxErrors is like DecodeTribits, with the maximum number
+// of bit errors on the most likely path set by the caller.
+func DecodeTribitsWithMaxErrors(dibits []int8, maxErrors int) ([]uint8, error) {
+	if dibits == nil {
+		return nil, errors.New("trellis: dibits can't be nil")
+	}
+	if len(dibits) != 98 {
+		return nil, fmt.Errorf("trellis: expected 98 dibits, got %d", len(dibits))
+	}
+
+	var (
+		metric = [8]int{0, unreachable, unreachable, unreachable, unreachable, unreachable, unreachable, unreachable}
+		paths  [8][]uint8
+	)
+	for i := 0; i < 49; i++ {
+		var (
+			next      = [8]int{unreachable, unreachable, unreachable, unreachable, unreachable, unreachable, unreachable, unreachable}
+			nextPaths [8][]uint8
+			tribits   = uint8(8)
+		)
+		if i == 48 {
+			// The last tribit flushes the encoder and is always zero
+			tribits = 1
+		}
+		for state := uint8(0); state < 8; state++ {
+			if metric[state] == unreachable {
+				continue
+			}
+			for tribit := uint8(0); tribit < tribits; tribit++ {
+				var (
+					point = encoderStateTransition[state*8+tribit]
+					m     = metric[state] + dibitErrors(dibits[i*2], constellationDibits[point][0]) + dibitErrors(dibits[i*2+1], constellationDibits[point][1])
+				)
+				if m < next[tribit] {
+					next[tribit] = m
+					nextPaths[tribit] = append(append(make([]uint8, 0, 49), paths[state]...), tribit)
+				}
+			}
+		}
+		metric, paths = next, nextPaths
+	}
+
+	if metric[0] > maxErrors {
+		return nil, fmt.Errorf("trellis: %d bit errors exceed maximum of %d, data is corrupted", metric[0], maxErrors)
+	}
+	return paths[0][:48], nil
+}
+
+// dibitErrors returns the number of bit errors between two dibits.
+func dibitErrors(a, b int8) int {
+	var x = dibitBits(a) ^ dibitBits(b)
+	return int(x>>1) + int(x&1)
+}
+
+func dibitBits(dibit int8) uint8 {
+	switch dibit {
+	case +3:
+		return 1
+	case -1:
+		return 2
+	case -3:
+		return 3
+	default:
+		return 0
+	}
+}
+
 // ExtractBinary maps the tribits back to bits.
 func ExtractBinary(tribits []uint8) ([]byte, error) {
 	if tribits == nil {
@@ -0,0 +1,101 @@
+package trellis
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestTrellis(t *testing.T) {
+	var r = rand.New(rand.NewSource(0))
+	for n := 0; n < 16; n++ {
+		var want = make([]byte, 18)
+		r.Read(want)
+
+		bits, err := Encode(want)
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+
+		for flip := -1; flip < len(bits); flip++ {
+			var test = make([]byte, len(bits))
+			copy(test, bits)
+			if flip >= 0 {
+				test[flip] ^= 1
+			}
+
+			var data = make([]byte, 18)
+			if err := Decode(test, data); err != nil {
+				t.Fatalf("decode with bit %d flipped failed: %v", flip, err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Fatalf("decode with bit %d flipped failed: expected %x, got %x", flip, want, data)
+			}
+		}
+	}
+}
+
+func TestTrellisCorrupted(t *testing.T) {
+	var (
+		r        = rand.New(rand.NewSource(0))
+		bits     = make([]byte, 196)
+		data     = make([]byte, 18)
+		rejected int
+	)
+	for n := 0; n < 100; n++ {
+		for i := range bits {
+			bits[i] = byte(r.Intn(2))
+		}
+		if err := Decode(bits, data); err != nil {
+			rejected++
+		}
+	}
+	if rejected < 95 {
+		t.Fatalf("expected random data to be rejected, only %d out of 100 were", rejected)
+	}
+}
+
+func TestTrellisZero(t *testing.T) {
+	// All zero input keeps the encoder in state 0, every symbol is
+	// constellation point 0, see the state transition table on page 129.
+	bits, err := Encode(make([]byte, 18))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	dibits, err := ExtractDibits(bits)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	deinterleaved, err := Deinterleave(dibits)
+	if err != nil {
+		t.Fatalf("deinterleave failed: %v", err)
+	}
+	for i := 0; i < len(deinterleaved); i += 2 {
+		if deinterleaved[i] != +1 || deinterleaved[i+1] != -1 {
+			t.Fatalf("symbol %d: expected dibits +1 -1, got %+d %+d", i/2, deinterleaved[i], deinterleaved[i+1])
+		}
+	}
+}
+
+func TestTrellisMaxErrors(t *testing.T) {
+	bits, err := Encode(make([]byte, 18))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	bits[0] ^= 1
+
+	dibits, err := ExtractDibits(bits)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	deinterleaved, err := Deinterleave(dibits)
+	if err != nil {
+		t.Fatalf("deinterleave failed: %v", err)
+	}
+	if _, err := DecodeTribits(deinterleaved); err != nil {
+		t.Fatalf("decode with default maximum failed: %v", err)
+	}
+	if _, err := DecodeTribitsWithMaxErrors(deinterleaved, 0); err == nil {
+		t.Fatal("decode without tolerance accepted a bit error")
+	}
+}
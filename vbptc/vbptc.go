@@ -4,29 +4,8 @@ package vbptc
 import (
 	"errors"
 	"fmt"
-)
 
-var (
-	// See page 136 of the DMR AI. spec. for the generator matrix.
-	hamming_16_11_generator_matrix = []byte{
-		1, 0, 0, 1, 1,
-		1, 1, 0, 1, 0,
-		1, 1, 1, 1, 1,
-		1, 1, 1, 0, 0,
-		0, 1, 1, 1, 0,
-		1, 0, 1, 0, 1,
-		0, 1, 0, 1, 1,
-		1, 0, 1, 1, 0,
-		1, 1, 0, 0, 1,
-		0, 1, 1, 0, 1,
-		0, 0, 1, 1, 1,
-		// These are used to determine errors in the Hamming checksum bits.
-		1, 0, 0, 0, 0,
-		0, 1, 0, 0, 0,
-		0, 0, 1, 0, 0,
-		0, 0, 0, 1, 0,
-		0, 0, 0, 0, 1,
-	}
+	"github.com/pd0mz/go-dmr/fec/hamming"
 )
 
 type VBPTC struct {
@@ -83,37 +62,43 @@ func (v *VBPTC) CheckAndRepair() error {
 
 	var (
 		row, col uint8
-		errs     = make([]byte, 5)
+		repaired bool
 	)
 
 	// -1 because the last row contains only single parity check bits
 	for row = 0; row < v.expectedRows-1; row++ {
-		if !checkRow(v.matrix[row*16:], errs) {
-			// If the Hamming(16, 11, 4) column check failed, see if we can find
-			// the bit error location.
-			pos, found := findPosition(errs)
-			if !found {
-				return fmt.Errorf("vbptc: hamming(16,11) check error, can't repair row #%d", row)
-			}
-
-			// Flip wrong bit
-			v.matrix[row*16+pos] ^= 1
-			if !checkRow(v.matrix[row*16:], errs) {
-				return fmt.Errorf("vbptc: hamming(16,11) check error, couldn't repair row #%d", row)
-			}
+		// The Hamming(16, 11, 4) row check corrects a single bit error
+		pos, ok := hamming.Hamming16_11_4.Correct(v.matrix[row*16 : row*16+16])
+		if !ok {
+			return fmt.Errorf("vbptc: hamming(16,11) check error, can't repair row #%d", row)
+		}
+		if pos >= 0 {
+			repaired = true
 		}
 	}
 
+	var errCols []uint8
 	for col = 0; col < 16; col++ {
 		var parity uint8
 		for row = 0; row < v.expectedRows-1; row++ {
 			parity = (parity + v.matrix[row*16+col]) % 2
 		}
 		if parity != v.matrix[(v.expectedRows-1)*16+col] {
-			return fmt.Errorf("vbptc: parity check error in column #%d", col)
+			errCols = append(errCols, col)
 		}
 	}
 
+	switch {
+	case len(errCols) == 0:
+		break
+	case len(errCols) == 1 && !repaired:
+		// All rows are valid, so the parity check bit itself is wrong.
+		v.matrix[(v.expectedRows-1)*16+errCols[0]] ^= 1
+		break
+	default:
+		return fmt.Errorf("vbptc: parity check error in column #%d", errCols[0])
+	}
+
 	return nil
 }
 
@@ -146,50 +131,49 @@ func (v *VBPTC) GetData(bits []byte) error {
 	return nil
 }
 
-func checkRow(bits, errs []byte) bool {
-	if bits == nil || errs == nil {
-		return false
+// SetData places the data bits in the vbptc matrix and calculates the Hamming
+// (16,11) and parity check bits.
+func (v *VBPTC) SetData(bits []byte) error {
+	if v.matrix == nil || v.expectedRows < 2 {
+		return errors.New("vbptc: no matrix")
+	}
+	var size = int(v.expectedRows-1) * 11
+	if len(bits) < size {
+		return fmt.Errorf("vbptc: need at least %d bits, got %d", size, len(bits))
 	}
 
-	getParity(bits, errs)
-	errs[0] ^= bits[11]
-	errs[1] ^= bits[12]
-	errs[2] ^= bits[13]
-	errs[3] ^= bits[14]
-	errs[4] ^= bits[15]
-
-	return errs[0] == 0 && errs[1] == 0 && errs[2] == 0 && errs[3] == 0 && errs[4] == 0
-}
-
-func findPosition(errs []byte) (uint8, bool) {
-	for row := uint8(0); row < 16; row++ {
-		var found = true
-		switch {
-		case hamming_16_11_generator_matrix[row*5] != errs[0]:
-			found = false
-			break
-		case hamming_16_11_generator_matrix[row*5+1] != errs[1]:
-			found = false
-			break
-		case hamming_16_11_generator_matrix[row*5+2] != errs[2]:
-			found = false
-			break
-		case hamming_16_11_generator_matrix[row*5+3] != errs[3]:
-			found = false
-			break
+	var row, col uint8
+	for row = 0; row < v.expectedRows-1; row++ {
+		codeword, err := hamming.Hamming16_11_4.Encode(bits[int(row)*11 : int(row)*11+11])
+		if err != nil {
+			return err
 		}
-		if found {
-			return row, true
+		copy(v.matrix[row*16:row*16+16], codeword)
+	}
+	for col = 0; col < 16; col++ {
+		var parity uint8
+		for row = 0; row < v.expectedRows-1; row++ {
+			parity ^= v.matrix[row*16+col]
 		}
+		v.matrix[(v.expectedRows-1)*16+col] = parity
 	}
 
-	return 0, false
+	// Matrix is full
+	v.row = 0
+	v.col = 16
+	return nil
 }
 
-func getParity(bits, errs []byte) {
-	errs[0] = (bits[0] ^ bits[1] ^ bits[2] ^ bits[3] ^ bits[5] ^ bits[7] ^ bits[8])
-	errs[1] = (bits[1] ^ bits[2] ^ bits[3] ^ bits[4] ^ bits[6] ^ bits[8] ^ bits[9])
-	errs[2] = (bits[2] ^ bits[3] ^ bits[4] ^ bits[5] ^ bits[7] ^ bits[9] ^ bits[10])
-	errs[3] = (bits[0] ^ bits[1] ^ bits[2] ^ bits[4] ^ bits[6] ^ bits[7] ^ bits[10])
-	errs[4] = (bits[0] ^ bits[2] ^ bits[5] ^ bits[6] ^ bits[8] ^ bits[9] ^ bits[10])
+// Bursts returns the matrix bits in transmission order, as consumed by AddBurst.
+func (v *VBPTC) Bursts() []byte {
+	var (
+		bits     = make([]byte, 0, len(v.matrix))
+		row, col uint8
+	)
+	for col = 0; col < 16; col++ {
+		for row = 0; row < v.expectedRows; row++ {
+			bits = append(bits, v.matrix[row*16+col])
+		}
+	}
+	return bits
 }
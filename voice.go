@@ -3,196 +3,11 @@ package dmr
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/pd0mz/go-dmr/crc/quadres_16_7"
-	"github.com/pd0mz/go-dmr/fec"
+	"github.com/pd0mz/go-dmr/vbptc"
 )
 
-// Priority Levels
-const (
-	NoPriority uint8 = iota
-	Priority1
-	Priority2
-	Priority3
-)
-
-// PriorityName is a map of priority level to string.
-var PriorityName = map[uint8]string{
-	NoPriority: "no priority",
-	Priority1:  "priority 1",
-	Priority2:  "priority 2",
-	Priority3:  "priority 3",
-}
-
-// ServiceOptions as per DMR part 2, section 7.2.1.
-type ServiceOptions struct {
-	// Emergency service
-	Emergency bool
-	// Not defined in document
-	Privacy bool
-	// Broadcast service (only defined in group calls)
-	Broadcast bool
-	// Open Voice Call Mode
-	OpenVoiceCallMode bool
-	// Priority 3 (0b11) is the highest priority
-	Priority uint8
-}
-
-// Byte packs the service options to a single byte.
-func (so *ServiceOptions) Byte() byte {
-	var b byte
-	if so.Emergency {
-		b |= B00000001
-	}
-	if so.Privacy {
-		b |= B00000010
-	}
-	if so.Broadcast {
-		b |= B00010000
-	}
-	if so.OpenVoiceCallMode {
-		b |= B00100000
-	}
-	b |= (so.Priority << 6)
-	return b
-}
-
-// String representatation of the service options.
-func (so *ServiceOptions) String() string {
-	var part = []string{}
-	if so.Emergency {
-		part = append(part, "emergency")
-	}
-	if so.Privacy {
-		part = append(part, "privacy")
-	}
-	if so.Broadcast {
-		part = append(part, "broadcast")
-	}
-	if so.OpenVoiceCallMode {
-		part = append(part, "Open Voice Call Mode")
-	}
-	part = append(part, fmt.Sprintf("%s (%d)", PriorityName[so.Priority], so.Priority))
-	return strings.Join(part, ", ")
-}
-
-// ParseServiceOptions parses the service options byte.
-func ParseServiceOptions(data byte) ServiceOptions {
-	return ServiceOptions{
-		Emergency:         (data & B00000001) > 0,
-		Privacy:           (data & B00000010) > 0,
-		Broadcast:         (data & B00010000) > 0,
-		OpenVoiceCallMode: (data & B00100000) > 0,
-		Priority:          (data & B11000000) >> 6,
-	}
-}
-
-// Full Link Control Opcode
-const (
-	GroupVoiceChannelUser      uint8 = 0x00 // B000000
-	UnitToUnitVoiceChannelUser uint8 = 0x03 // B000011
-)
-
-// LC is a Link Control message.
-type LC struct {
-	CallType       uint8
-	Opcode         uint8
-	FeatureSetID   uint8
-	ServiceOptions ServiceOptions
-	DstID          uint32
-	SrcID          uint32
-}
-
-// Bytes packs the Link Control message to bytes.
-func (lc *LC) Bytes() []byte {
-	var fclo uint8
-	switch lc.CallType {
-	case CallTypeGroup:
-		fclo = GroupVoiceChannelUser
-		break
-	case CallTypePrivate:
-		fclo = UnitToUnitVoiceChannelUser
-		break
-	}
-
-	return []byte{
-		fclo,
-		lc.FeatureSetID,
-		lc.ServiceOptions.Byte(),
-		uint8(lc.DstID >> 16),
-		uint8(lc.DstID >> 8),
-		uint8(lc.DstID),
-		uint8(lc.SrcID >> 16),
-		uint8(lc.SrcID >> 8),
-		uint8(lc.SrcID),
-	}
-}
-
-func (lc *LC) String() string {
-	return fmt.Sprintf("call type %s, feature set id %d, %d->%d, service options %s",
-		CallTypeName[lc.CallType], lc.FeatureSetID, lc.SrcID, lc.DstID, lc.ServiceOptions.String())
-}
-
-// ParseLC parses a packed Link Control message.
-func ParseLC(data []byte) (*LC, error) {
-	if data == nil {
-		return nil, errors.New("dmr/lc: data can't be nil")
-	}
-	if len(data) != 9 {
-		return nil, fmt.Errorf("dmr/lc: expected 9 LC bytes, got %d", len(data))
-	}
-
-	if data[0]&B10000000 > 0 {
-		return nil, errors.New("dmr/lc: protect flag is not 0")
-	}
-
-	var (
-		ct   uint8
-		fclo = data[0] & B00111111
-	)
-	switch fclo {
-	case GroupVoiceChannelUser:
-		ct = CallTypeGroup
-		break
-	case UnitToUnitVoiceChannelUser:
-		ct = CallTypePrivate
-		break
-	default:
-		return nil, fmt.Errorf("dmr/lc: unknown FCLO %06b (%d)", fclo, fclo)
-	}
-
-	return &LC{
-		CallType:       ct,
-		FeatureSetID:   data[1],
-		ServiceOptions: ParseServiceOptions(data[2]),
-		DstID:          uint32(data[3])<<16 | uint32(data[4])<<8 | uint32(data[5]),
-		SrcID:          uint32(data[6])<<16 | uint32(data[7])<<8 | uint32(data[8]),
-	}, nil
-}
-
-// ParseFullLC parses a packed Link Control message and checks/corrects the Reed-Solomon check data.
-func ParseFullLC(data []byte) (*LC, error) {
-	if data == nil {
-		return nil, errors.New("dmr/full lc: data can't be nil")
-	}
-	if len(data) != 12 {
-		return nil, fmt.Errorf("dmr/full lc: expected 12 bytes, got %d", len(data))
-	}
-
-	syndrome := &fec.RS_12_9_Poly{}
-	if err := fec.RS_12_9_CalcSyndrome(data, syndrome); err != nil {
-		return nil, err
-	}
-	if !fec.RS_12_9_CheckSyndrome(syndrome) {
-		if _, err := fec.RS_12_9_Correct(data, syndrome); err != nil {
-			return nil, err
-		}
-	}
-
-	return ParseLC(data[:9])
-}
-
 // EMB LCSS fragments.
 const (
 	SingleFragment uint8 = iota
@@ -212,13 +27,59 @@ var LCSSName = map[uint8]string{
 // EMB contains embedded signalling.
 type EMB struct {
 	ColorCode uint8
+	PI        bool // Privacy indicator, set for the bursts of privacy calls
 	LCSS      uint8
 }
 
 func (emb *EMB) String() string {
+	if emb.PI {
+		return fmt.Sprintf("color code %d, privacy, %s (%d)", emb.ColorCode, LCSSName[emb.LCSS], emb.LCSS)
+	}
 	return fmt.Sprintf("color code %d, %s (%d)", emb.ColorCode, LCSSName[emb.LCSS], emb.LCSS)
 }
 
+// Bits returns the embedded signalling as bits, including the quadratic
+// residue (16, 7, 6) parity bits.
+func (emb *EMB) Bits() ([]byte, error) {
+	return BuildEMB(emb)
+}
+
+// Bytes returns the embedded signalling packed to two bytes.
+func (emb *EMB) Bytes() ([]byte, error) {
+	bits, err := BuildEMB(emb)
+	if err != nil {
+		return nil, err
+	}
+	return BitsToBytes(bits), nil
+}
+
+// BuildEMB builds the embedded signalling bits suitable for transmission.
+func BuildEMB(emb *EMB) ([]byte, error) {
+	if emb == nil {
+		return nil, errors.New("dmr/emb: emb can't be nil")
+	}
+	if emb.ColorCode > 15 {
+		return nil, fmt.Errorf("dmr/emb: color code %d out of range", emb.ColorCode)
+	}
+	if emb.LCSS > Continuation {
+		return nil, fmt.Errorf("dmr/emb: LCSS %d out of range", emb.LCSS)
+	}
+	var pi byte
+	if emb.PI {
+		pi = 1
+	}
+
+	return quadres_16_7.Encode([]byte{
+		(emb.ColorCode >> 3) & 0x01,
+		(emb.ColorCode >> 2) & 0x01,
+		(emb.ColorCode >> 1) & 0x01,
+		(emb.ColorCode >> 0) & 0x01,
+		pi,
+		(emb.LCSS >> 1) & 0x01,
+		(emb.LCSS >> 0) & 0x01,
+	}), nil
+}
+
 // ParseEMB parses embedded signalling
 func ParseEMB(bits []byte) (*EMB, error) {
 	if len(bits) != EMBBits {
@@ -228,13 +89,33 @@ func ParseEMB(bits []byte) (*EMB, error) {
 	if !quadres_16_7.Check(bits) {
 		return nil, errors.New("dmr/emb: checksum error")
 	}
+	return parseEMB(bits)
+}
+
+// ParseEMBCorrecting parses embedded signalling after correcting up to 2 bit
+// errors, it returns the number of corrected bits. The bits are not modified.
+func ParseEMBCorrecting(bits []byte) (*EMB, int, error) {
+	if len(bits) != EMBBits {
+		return nil, -1, fmt.Errorf("dmr/emb: expected %d bits, got %d", EMBBits, len(bits))
+	}
 
-	if bits[4] != 0 {
-		return nil, errors.New("dmr/emb: pi is not 0")
+	var corrected = make([]byte, EMBBits)
+	copy(corrected, bits)
+	n, err := quadres_16_7.Correct(corrected)
+	if err != nil {
+		return nil, -1, errors.New("dmr/emb: checksum error")
+	}
+	emb, err := parseEMB(corrected)
+	if err != nil {
+		return nil, -1, err
 	}
+	return emb, n, nil
+}
 
+func parseEMB(bits []byte) (*EMB, error) {
 	return &EMB{
 		ColorCode: uint8(bits[0])<<3 | uint8(bits[1])<<2 | uint8(bits[2])<<1 | uint8(bits[3]),
+		PI:        bits[4] != 0,
 		LCSS:      uint8(bits[5])<<1 | uint8(bits[6]),
 	}, nil
 }
@@ -254,6 +135,23 @@ func ParseEMBBitsFromSync(sync []byte) ([]byte, error) {
 	return bits, nil
 }
 
+// BuildSyncBitsFromEMB places the embedded signalling bits and the embedded
+// signalling LC fragment in the SYNC bits.
+func BuildSyncBitsFromEMB(emb, lc []byte) ([]byte, error) {
+	if len(emb) != EMBBits {
+		return nil, fmt.Errorf("dmr/emb to sync: expected %d emb bits, got %d", EMBBits, len(emb))
+	}
+	if len(lc) != EMBSignallingLCFragmentBits {
+		return nil, fmt.Errorf("dmr/emb to sync: expected %d lc bits, got %d", EMBSignallingLCFragmentBits, len(lc))
+	}
+
+	var sync = make([]byte, SyncBits)
+	copy(sync[:EMBHalfBits], emb[:EMBHalfBits])
+	copy(sync[EMBHalfBits:], lc)
+	copy(sync[EMBHalfBits+EMBSignallingLCFragmentBits:], emb[EMBHalfBits:])
+	return sync, nil
+}
+
 // ParseEmbeddedSignallingLCFromSyncBits extracts the embedded signalling LC from the SYNC bits.
 func ParseEmbeddedSignallingLCFromSyncBits(sync []byte) ([]byte, error) {
 	if sync == nil {
@@ -293,6 +191,31 @@ func (eslc *EmbeddedSignallingLC) Check() bool {
 	return calculated == checksum
 }
 
+// NewEmbeddedSignallingLC calculates the checksum for a packed Link Control
+// message and returns the embedded signalling LC.
+func NewEmbeddedSignallingLC(data []byte) (*EmbeddedSignallingLC, error) {
+	if len(data) != LCSize {
+		return nil, fmt.Errorf("dmr/emb lc: expected %d LC bytes, got %d", LCSize, len(data))
+	}
+
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	var checksum = uint8(sum % 31)
+
+	return &EmbeddedSignallingLC{
+		Bits: BytesToBits(data),
+		Checksum: []byte{
+			(checksum >> 4) & 0x01,
+			(checksum >> 3) & 0x01,
+			(checksum >> 2) & 0x01,
+			(checksum >> 1) & 0x01,
+			(checksum >> 0) & 0x01,
+		},
+	}, nil
+}
+
 // Interleave packs the embedded signalling LC to interleaved bits.
 func (eslc *EmbeddedSignallingLC) Interleave() []byte {
 	var bits = make([]byte, 77)
@@ -362,3 +285,176 @@ func DeinterleaveEmbeddedSignallingLC(bits []byte) (*EmbeddedSignallingLC, error
 
 	return eslc, nil
 }
+
+// Embedded LC fragments per superframe.
+const EmbeddedLCFragments = 4
+
+// BuildEmbeddedLCFragments encodes the Link Control message to the embedded
+// signalling LC fragments, in the order they are carried by voice bursts B to E.
+func BuildEmbeddedLCFragments(lc *LC) ([][]byte, error) {
+	if lc == nil {
+		return nil, errors.New("dmr/emb lc: lc can't be nil")
+	}
+
+	data, err := lc.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	eslc, err := NewEmbeddedSignallingLC(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var v = vbptc.New(8)
+	if err := v.SetData(eslc.Interleave()); err != nil {
+		return nil, err
+	}
+
+	var (
+		bits      = v.Bursts()
+		fragments = make([][]byte, EmbeddedLCFragments)
+	)
+	for i := range fragments {
+		fragments[i] = bits[i*EMBSignallingLCFragmentBits : (i+1)*EMBSignallingLCFragmentBits]
+	}
+	return fragments, nil
+}
+
+// EmbeddedLCAssembler collects the embedded signalling LC fragments of a voice
+// superframe and decodes the Link Control message once all fragments are in.
+type EmbeddedLCAssembler struct {
+	matrix    *vbptc.VBPTC
+	fragments int
+}
+
+// NewEmbeddedLCAssembler returns an empty embedded LC assembler.
+func NewEmbeddedLCAssembler() *EmbeddedLCAssembler {
+	return &EmbeddedLCAssembler{
+		matrix: vbptc.New(8),
+	}
+}
+
+// Reset discards all collected fragments.
+func (a *EmbeddedLCAssembler) Reset() {
+	a.matrix.Clear()
+	a.fragments = 0
+}
+
+// AddFragment adds the embedded signalling LC fragment from a voice burst with
+// the given LCSS. If the fragment completes the embedded LC, the decoded Link
+// Control message is returned, otherwise the returned LC is nil. Fragments
+// received out of order discard the collected state and return an error.
+func (a *EmbeddedLCAssembler) AddFragment(lcss uint8, bits []byte) (*LC, error) {
+	if len(bits) != EMBSignallingLCFragmentBits {
+		a.Reset()
+		return nil, fmt.Errorf("dmr/emb lc: expected %d fragment bits, got %d", EMBSignallingLCFragmentBits, len(bits))
+	}
+
+	switch lcss {
+	case SingleFragment:
+		// Single fragments carry reverse channel or null signalling, not LC.
+		return nil, nil
+	case FirstFragment:
+		a.Reset()
+		break
+	case Continuation, LastFragment:
+		if a.fragments == 0 {
+			// We missed the start of this embedded LC, wait for the next one.
+			return nil, nil
+		}
+		if (lcss == Continuation && a.fragments >= EmbeddedLCFragments-1) ||
+			(lcss == LastFragment && a.fragments != EmbeddedLCFragments-1) {
+			a.Reset()
+			return nil, fmt.Errorf("dmr/emb lc: unexpected %s after %d fragments", LCSSName[lcss], a.fragments)
+		}
+		break
+	default:
+		a.Reset()
+		return nil, fmt.Errorf("dmr/emb lc: LCSS %d out of range", lcss)
+	}
+
+	if err := a.matrix.AddBurst(bits); err != nil {
+		a.Reset()
+		return nil, err
+	}
+	if a.fragments++; lcss != LastFragment {
+		return nil, nil
+	}
+
+	defer a.Reset()
+	if err := a.matrix.CheckAndRepair(); err != nil {
+		return nil, err
+	}
+	var signalling = make([]byte, 77)
+	if err := a.matrix.GetData(signalling); err != nil {
+		return nil, err
+	}
+	eslc, err := DeinterleaveEmbeddedSignallingLC(signalling)
+	if err != nil {
+		return nil, err
+	}
+	if !eslc.Check() {
+		return nil, errors.New("dmr/emb lc: checksum error")
+	}
+	return ParseLC(BitsToBytes(eslc.Bits))
+}
+
+// EMBReassembler collects the embedded signalling LC fragments from the voice
+// bursts of each timeslot and calls OnLC for every complete Link Control
+// message. A new stream on a timeslot discards any incomplete embedded LC of
+// the previous stream.
+type EMBReassembler struct {
+	OnLC func(streamID uint32, lc *LC)
+
+	slot [2]struct {
+		streamID  uint32
+		assembler *EmbeddedLCAssembler
+	}
+}
+
+// NewEMBReassembler returns an EMB reassembler calling fn for every
+// reassembled Link Control message.
+func NewEMBReassembler(fn func(streamID uint32, lc *LC)) *EMBReassembler {
+	r := &EMBReassembler{OnLC: fn}
+	for i := range r.slot {
+		r.slot[i].assembler = NewEmbeddedLCAssembler()
+	}
+	return r
+}
+
+// AddPacket adds a voice packet. Packets other than voice bursts B to F are
+// ignored, as they don't carry embedded signalling.
+func (r *EMBReassembler) AddPacket(p *Packet) error {
+	if p == nil {
+		return errors.New("dmr/emb reassembler: packet can't be nil")
+	}
+	if p.DataType < VoiceBurstB || p.DataType > VoiceBurstF {
+		return nil
+	}
+	if p.Timeslot > 1 {
+		return fmt.Errorf("dmr/emb reassembler: timeslot %d out of range", p.Timeslot)
+	}
+
+	var slot = &r.slot[p.Timeslot]
+	if slot.streamID != p.StreamID {
+		slot.streamID = p.StreamID
+		slot.assembler.Reset()
+	}
+
+	emb, _, err := ParseEMBCorrecting(p.EMBBits())
+	if err != nil {
+		return err
+	}
+	fragment, err := ParseEmbeddedSignallingLCFromSyncBits(p.SyncBits())
+	if err != nil {
+		return err
+	}
+	lc, err := slot.assembler.AddFragment(emb.LCSS, fragment)
+	if err != nil {
+		return err
+	}
+	if lc != nil && r.OnLC != nil {
+		r.OnLC(p.StreamID, lc)
+	}
+	return nil
+}
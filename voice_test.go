@@ -0,0 +1,190 @@
+package dmr
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEMB(t *testing.T) {
+	for cc := uint8(0); cc < 16; cc++ {
+		for lcss := SingleFragment; lcss <= Continuation; lcss++ {
+			for _, pi := range []bool{false, true} {
+				want := &EMB{ColorCode: cc, PI: pi, LCSS: lcss}
+				bits, err := BuildEMB(want)
+				if err != nil {
+					t.Fatalf("encode failed: %v", err)
+				}
+				if bits[4] == 0 == pi {
+					t.Fatalf("encode %s: PI bit %d", want, bits[4])
+				}
+
+				test, err := ParseEMB(bits)
+				if err != nil {
+					t.Fatalf("decode %s failed: %v", want, err)
+				}
+				if *test != *want {
+					t.Fatalf("decode failed: %s != %s", test, want)
+				}
+			}
+
+			want := &EMB{ColorCode: cc, LCSS: lcss}
+			bits, err := BuildEMB(want)
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+
+			var lc = make([]byte, EMBSignallingLCFragmentBits)
+			sync, err := BuildSyncBitsFromEMB(bits, lc)
+			if err != nil {
+				t.Fatalf("encode sync failed: %v", err)
+			}
+			emb, err := ParseEMBBitsFromSync(sync)
+			if err != nil {
+				t.Fatalf("decode sync failed: %v", err)
+			}
+			if !bytes.Equal(emb, bits) {
+				t.Fatalf("decode sync failed: %v != %v", emb, bits)
+			}
+		}
+	}
+
+	if _, err := BuildEMB(&EMB{ColorCode: 16}); err == nil {
+		t.Fatal("expected error for color code 16")
+	}
+}
+
+func TestParseEMBCorrecting(t *testing.T) {
+	var want = &EMB{ColorCode: 7, LCSS: FirstFragment}
+	bits, err := BuildEMB(want)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	bits[2] ^= 1
+	bits[11] ^= 1
+
+	if _, err = ParseEMB(bits); err == nil {
+		t.Fatal("decode with 2 bit errors succeeded without correction")
+	}
+	test, n, err := ParseEMBCorrecting(bits)
+	switch {
+	case err != nil:
+		t.Fatalf("decode with correction failed: %v", err)
+	case n != 2:
+		t.Fatalf("decode with correction failed: corrected %d bits, expected 2", n)
+	case test.ColorCode != want.ColorCode || test.LCSS != want.LCSS:
+		t.Fatalf("decode with correction failed: %s != %s", test, want)
+	}
+
+	bits[14] ^= 1
+	if _, _, err = ParseEMBCorrecting(bits); err == nil {
+		t.Fatal("decode with 3 bit errors succeeded")
+	}
+}
+
+func TestEmbeddedLCAssembler(t *testing.T) {
+	var (
+		want = &LC{
+			CallType: CallTypeGroup,
+			Opcode:   GroupVoiceChannelUser,
+			DstID:    2042214,
+			SrcID:    2043044,
+		}
+		lcss = []uint8{FirstFragment, Continuation, Continuation, LastFragment}
+	)
+
+	fragments, err := BuildEmbeddedLCFragments(want)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var a = NewEmbeddedLCAssembler()
+	for flip := -1; flip < 4*EMBSignallingLCFragmentBits; flip++ {
+		var test *LC
+		for i, frag := range fragments {
+			var bits = make([]byte, len(frag))
+			copy(bits, frag)
+			if flip >= 0 && flip/EMBSignallingLCFragmentBits == i {
+				bits[flip%EMBSignallingLCFragmentBits] ^= 1
+			}
+
+			if test, err = a.AddFragment(lcss[i], bits); err != nil {
+				t.Fatalf("decode with bit %d flipped failed: %v", flip, err)
+			}
+			if test != nil && i != len(fragments)-1 {
+				t.Fatalf("decode with bit %d flipped returned LC after fragment %d", flip, i)
+			}
+		}
+		if !reflect.DeepEqual(test, want) {
+			t.Fatalf("decode with bit %d flipped failed: expected %s, got %s", flip, want, test)
+		}
+	}
+
+	// Missing continuation
+	if _, err := a.AddFragment(FirstFragment, fragments[0]); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, err := a.AddFragment(Continuation, fragments[1]); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, err := a.AddFragment(LastFragment, fragments[3]); err == nil {
+		t.Fatal("expected error for missing fragment")
+	}
+
+	// Late entry, wait for the next first fragment
+	if test, err := a.AddFragment(Continuation, fragments[2]); test != nil || err != nil {
+		t.Fatalf("expected no result after reset, got %v, %v", test, err)
+	}
+}
+
+func TestEMBReassembler(t *testing.T) {
+	var want = &LC{
+		CallType: CallTypePrivate,
+		Opcode:   UnitToUnitVoiceChannelUser,
+		DstID:    2042214,
+		SrcID:    2043044,
+	}
+	fragments, err := BuildEmbeddedLCFragments(want)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	var (
+		lcss = []uint8{FirstFragment, Continuation, Continuation, LastFragment}
+		got  = map[uint32]*LC{}
+		r    = NewEMBReassembler(func(streamID uint32, lc *LC) { got[streamID] = lc })
+	)
+	var voice = func(streamID uint32, dt uint8, fragment int) *Packet {
+		var p = &Packet{Timeslot: 1, StreamID: streamID, DataType: dt}
+		emb, err := BuildEMB(&EMB{ColorCode: 1, LCSS: lcss[fragment]})
+		if err != nil {
+			t.Fatalf("encode emb failed: %v", err)
+		}
+		sync, err := BuildSyncBitsFromEMB(emb, fragments[fragment])
+		if err != nil {
+			t.Fatalf("encode sync failed: %v", err)
+		}
+		p.SetSyncBits(sync)
+		return p
+	}
+
+	// Stream 1 is interrupted by stream 2 halfway the embedded LC
+	for i, p := range []*Packet{
+		voice(1, VoiceBurstB, 0),
+		voice(1, VoiceBurstC, 1),
+		voice(2, VoiceBurstB, 0),
+		voice(2, VoiceBurstC, 1),
+		voice(2, VoiceBurstD, 2),
+		voice(2, VoiceBurstE, 3),
+		voice(1, VoiceBurstD, 2),
+		voice(1, VoiceBurstE, 3),
+	} {
+		if err := r.AddPacket(p); err != nil {
+			t.Fatalf("add packet %d failed: %v", i, err)
+		}
+	}
+
+	if len(got) != 1 || !reflect.DeepEqual(got[2], want) {
+		t.Fatalf("expected %s for stream 2 only, got %v", want, got)
+	}
+}
@@ -0,0 +1,117 @@
+package dmr
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultVoiceStreamTimeout is the time after the last voice frame after which
+// a call without terminator is considered ended.
+const DefaultVoiceStreamTimeout = time.Millisecond * 200
+
+// VoiceStream groups voice packets by stream ID into calls. A call starts with
+// the first voice sync (burst A) of a stream and ends with a terminator or
+// when no frames are received for Timeout.
+type VoiceStream struct {
+	Timeout time.Duration
+
+	// OnCallStart is called with the first voice sync frame of a call.
+	OnCallStart func(p *Packet)
+	// OnVoiceFrame is called for every voice frame of a call, seq is the
+	// position of the frame in the superframe, 0 for burst A to 5 for burst F.
+	OnVoiceFrame func(p *Packet, seq byte)
+	// OnCallEnd is called when a call ended.
+	OnCallEnd func(streamID uint32, duration time.Duration)
+
+	mutex *sync.Mutex
+	calls map[uint32]*voiceCall
+}
+
+type voiceCall struct {
+	start, last time.Time
+	timer       *time.Timer
+}
+
+// NewVoiceStream returns a voice stream tracker with the default timeout.
+func NewVoiceStream() *VoiceStream {
+	return &VoiceStream{
+		Timeout: DefaultVoiceStreamTimeout,
+		mutex:   &sync.Mutex{},
+		calls:   make(map[uint32]*voiceCall),
+	}
+}
+
+// PacketFunc can be installed as the PacketFunc of a Repeater.
+func (vs *VoiceStream) PacketFunc(_ Repeater, p *Packet) error {
+	vs.AddPacket(p)
+	return nil
+}
+
+// AddPacket processes a packet, packets that are not part of a voice call are ignored.
+func (vs *VoiceStream) AddPacket(p *Packet) {
+	if p == nil {
+		return
+	}
+
+	switch p.DataType {
+	case VoiceBurstA, VoiceBurstB, VoiceBurstC, VoiceBurstD, VoiceBurstE, VoiceBurstF:
+		vs.voice(p)
+	case TerminatorWithLC:
+		vs.end(p.StreamID, nil)
+	}
+}
+
+func (vs *VoiceStream) voice(p *Packet) {
+	var now = time.Now()
+
+	vs.mutex.Lock()
+	call, ok := vs.calls[p.StreamID]
+	if !ok {
+		if p.DataType != VoiceBurstA {
+			// Wait for the voice sync to start the call
+			vs.mutex.Unlock()
+			return
+		}
+		call = &voiceCall{start: now}
+		vs.calls[p.StreamID] = call
+
+		var streamID = p.StreamID
+		call.timer = time.AfterFunc(vs.timeout(), func() { vs.end(streamID, call) })
+	} else {
+		call.timer.Reset(vs.timeout())
+	}
+	call.last = now
+	vs.mutex.Unlock()
+
+	if !ok && vs.OnCallStart != nil {
+		vs.OnCallStart(p)
+	}
+	if vs.OnVoiceFrame != nil {
+		vs.OnVoiceFrame(p, p.DataType-VoiceBurstA)
+	}
+}
+
+// end ends the call for streamID, if call is not nil it only ends that call,
+// as the timer may fire after a new call with the same stream ID started.
+func (vs *VoiceStream) end(streamID uint32, call *voiceCall) {
+	vs.mutex.Lock()
+	active, ok := vs.calls[streamID]
+	if !ok || (call != nil && active != call) {
+		vs.mutex.Unlock()
+		return
+	}
+	active.timer.Stop()
+	delete(vs.calls, streamID)
+	vs.mutex.Unlock()
+
+	if vs.OnCallEnd != nil {
+		vs.OnCallEnd(streamID, active.last.Sub(active.start))
+	}
+}
+
+func (vs *VoiceStream) timeout() time.Duration {
+	if vs.Timeout <= 0 {
+		return DefaultVoiceStreamTimeout
+	}
+	return vs.Timeout
+}
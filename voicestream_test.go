@@ -0,0 +1,58 @@
+package dmr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoiceStream(t *testing.T) {
+	var (
+		vs     = NewVoiceStream()
+		starts = make(chan uint32, 4)
+		frames = make(chan byte, 32)
+		ends   = make(chan uint32, 4)
+	)
+	vs.Timeout = time.Millisecond * 20
+	vs.OnCallStart = func(p *Packet) { starts <- p.StreamID }
+	vs.OnVoiceFrame = func(p *Packet, seq byte) { frames <- seq }
+	vs.OnCallEnd = func(streamID uint32, _ time.Duration) { ends <- streamID }
+
+	// Late entry, frames before the voice sync are ignored
+	vs.AddPacket(&Packet{StreamID: 1, DataType: VoiceBurstE})
+	vs.AddPacket(&Packet{StreamID: 1, DataType: VoiceBurstF})
+	for dt := VoiceBurstA; dt <= VoiceBurstF; dt++ {
+		vs.AddPacket(&Packet{StreamID: 1, DataType: dt})
+	}
+	vs.AddPacket(&Packet{StreamID: 1, DataType: TerminatorWithLC})
+
+	if id := <-starts; id != 1 {
+		t.Fatalf("expected call start for stream 1, got %d", id)
+	}
+	for want := byte(0); want < 6; want++ {
+		if seq := <-frames; seq != want {
+			t.Fatalf("expected frame %d, got %d", want, seq)
+		}
+	}
+	if id := <-ends; id != 1 {
+		t.Fatalf("expected call end for stream 1, got %d", id)
+	}
+
+	// Call without terminator ends after the timeout
+	vs.AddPacket(&Packet{StreamID: 2, DataType: VoiceBurstA})
+	<-starts
+	<-frames
+	select {
+	case id := <-ends:
+		if id != 2 {
+			t.Fatalf("expected call end for stream 2, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call did not time out")
+	}
+
+	select {
+	case id := <-ends:
+		t.Fatalf("unexpected call end for stream %d", id)
+	case <-time.After(vs.Timeout * 2):
+	}
+}
@@ -0,0 +1,191 @@
+// Package xlx links to XLX reflectors
+package xlx
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+// DefaultPort is the port XLX reflectors accept Homebrew (MMDVM) links on.
+const DefaultPort = 62030
+
+// Modules are linked with a group call to ModuleBase plus the module number,
+// A is 4001 up to Z at 4026. A call to ModuleBase itself unlinks.
+const (
+	ModuleBase      uint32 = 4000
+	ControlTimeslot uint8  = 1 // Timeslot 2
+)
+
+// XLX is a Homebrew link to an XLX reflector. The reflector uses the Homebrew
+// login and keepalives, but streams are routed to one of its modules A to Z,
+// which is selected with a group call on timeslot 2. The module is linked
+// again after every login as the reflector forgets it when the link drops.
+type XLX struct {
+	*homebrew.Homebrew
+
+	mutex  *sync.Mutex
+	module byte
+	linked bool
+}
+
+// New creates a new XLX link listening on addr, linking to module once
+// logged in. Module 0 doesn't link a module.
+func New(config *homebrew.RepeaterConfiguration, addr *net.UDPAddr, module byte) (*XLX, error) {
+	if err := validModule(module); err != nil {
+		return nil, err
+	}
+
+	h, err := homebrew.New(config, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var x = &XLX{
+		Homebrew: h,
+		mutex:    &sync.Mutex{},
+		module:   upper(module),
+	}
+	h.OnLink = x.onLink
+	return x, nil
+}
+
+// Module returns the selected module, or 0 if no module is linked.
+func (x *XLX) Module() byte {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.module
+}
+
+// SetModule switches to another module, module 0 unlinks from the current
+// module. If the reflector link is up, the control call is sent right away.
+func (x *XLX) SetModule(module byte) error {
+	if err := validModule(module); err != nil {
+		return err
+	}
+
+	x.mutex.Lock()
+	x.module = upper(module)
+	var linked = x.linked
+	x.mutex.Unlock()
+
+	if !linked {
+		return nil
+	}
+	return x.sendModule(upper(module))
+}
+
+func (x *XLX) onLink(peer *homebrew.Peer) {
+	x.mutex.Lock()
+	x.linked = true
+	var module = x.module
+	x.mutex.Unlock()
+
+	if module == 0 {
+		return
+	}
+	if err := x.sendModule(module); err != nil {
+		x.logger().Error("module link failed", "module", string(module), "error", err)
+	}
+}
+
+// logger returns the logger of the link, or the default logger.
+func (x *XLX) logger() *slog.Logger {
+	if x.Logger != nil {
+		return x.Logger
+	}
+	return slog.Default()
+}
+
+// sendModule sends the voice LC header and terminator of a group call to the
+// control talkgroup of the module.
+func (x *XLX) sendModule(module byte) error {
+	dstID, err := ModuleTalkgroup(module)
+	if err != nil {
+		return err
+	}
+
+	var (
+		streamID = rand.Uint32()
+		lc       = &dmr.LC{
+			CallType: dmr.CallTypeGroup,
+			Opcode:   dmr.GroupVoiceChannelUser,
+			DstID:    dstID,
+			SrcID:    x.Config.ID,
+		}
+	)
+	for i, dataType := range []uint8{dmr.VoiceLC, dmr.TerminatorWithLC} {
+		p, err := buildLCPacket(lc, dataType, x.Config.ColorCode)
+		if err != nil {
+			return err
+		}
+		p.Sequence = uint8(i)
+		p.StreamID = streamID
+		p.Timeslot = ControlTimeslot
+		if err := x.Send(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModuleTalkgroup returns the control talkgroup of the module.
+func ModuleTalkgroup(module byte) (uint32, error) {
+	if err := validModule(module); err != nil {
+		return 0, err
+	}
+	if module == 0 {
+		return ModuleBase, nil
+	}
+	return ModuleBase + uint32(upper(module)-'A') + 1, nil
+}
+
+func buildLCPacket(lc *dmr.LC, dataType, colorCode uint8) (*dmr.Packet, error) {
+	var mask = dmr.VoiceLCHeaderMask
+	if dataType == dmr.TerminatorWithLC {
+		mask = dmr.TerminatorWithLCMask
+	}
+	data, err := dmr.BuildFullLC(lc, mask)
+	if err != nil {
+		return nil, err
+	}
+	var info = make([]byte, dmr.InfoBits)
+	if err := bptc.Encode(data, info); err != nil {
+		return nil, err
+	}
+	slotType, err := dmr.BuildSlotType(colorCode, dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &dmr.Packet{
+		SrcID:    lc.SrcID,
+		DstID:    lc.DstID,
+		CallType: lc.CallType,
+		DataType: dataType,
+	}
+	p.SetInfoBits(info)
+	p.SetSlotTypeBits(slotType)
+	p.SetSyncBits(dmr.SyncPatternBits(dmr.SyncPatternBSSourcedData))
+	return p, nil
+}
+
+func validModule(module byte) error {
+	if module == 0 || ('A' <= upper(module) && upper(module) <= 'Z') {
+		return nil
+	}
+	return fmt.Errorf("xlx: module %q out of range A-Z", module)
+}
+
+func upper(module byte) byte {
+	if 'a' <= module && module <= 'z' {
+		return module - 'a' + 'A'
+	}
+	return module
+}
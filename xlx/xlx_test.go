@@ -0,0 +1,116 @@
+package xlx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pd0mz/go-dmr"
+	"github.com/pd0mz/go-dmr/bptc"
+	"github.com/pd0mz/go-dmr/homebrew"
+)
+
+func TestModuleTalkgroup(t *testing.T) {
+	var tests = []struct {
+		Module byte
+		Want   uint32
+	}{
+		{0, 4000},
+		{'A', 4001},
+		{'b', 4002},
+		{'Z', 4026},
+	}
+	for _, test := range tests {
+		got, err := ModuleTalkgroup(test.Module)
+		switch {
+		case err != nil:
+			t.Fatalf("module %q failed: %v", test.Module, err)
+		case got != test.Want:
+			t.Fatalf("module %q: expected %d, got %d", test.Module, test.Want, got)
+		}
+	}
+	for _, module := range []byte{'1', '[', '@'} {
+		if _, err := ModuleTalkgroup(module); err == nil {
+			t.Fatalf("module %q succeeded", module)
+		}
+	}
+}
+
+func TestXLX(t *testing.T) {
+	m, err := homebrew.NewMaster(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("new master failed: %v", err)
+	}
+	defer m.Close()
+	m.AddRepeater(2042214, []byte("passw0rd"))
+
+	var packets = make(chan *dmr.Packet, 4)
+	m.OnPacket = func(_ uint32, p *dmr.Packet) { packets <- p }
+	go m.ListenAndServe()
+
+	x, err := New(&homebrew.RepeaterConfiguration{
+		Callsign:  "PD0MZ",
+		ID:        2042214,
+		ColorCode: 1,
+	}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 'b')
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	defer x.Close()
+	go x.ListenAndServe()
+
+	if x.Module() != 'B' {
+		t.Fatalf("expected module B, got %q", x.Module())
+	}
+	if err := x.SetModule('1'); err == nil {
+		t.Fatal("set module 1 succeeded")
+	}
+	if err := x.Link(&homebrew.Peer{ID: 1, Addr: m.Addr(), AuthKey: []byte("passw0rd")}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	var expect = func(dstID uint32) {
+		for _, dataType := range []uint8{dmr.VoiceLC, dmr.TerminatorWithLC} {
+			select {
+			case p := <-packets:
+				switch {
+				case p.DataType != dataType:
+					t.Fatalf("expected %s, got %s", dmr.DataTypeName[dataType], dmr.DataTypeName[p.DataType])
+				case p.DstID != dstID || p.Timeslot != ControlTimeslot || p.CallType != dmr.CallTypeGroup:
+					t.Fatalf("expected group call to %d on TS2, got %+v", dstID, p)
+				}
+
+				var (
+					data = make([]byte, 12)
+					mask = dmr.VoiceLCHeaderMask
+				)
+				if dataType == dmr.TerminatorWithLC {
+					mask = dmr.TerminatorWithLCMask
+				}
+				if err := bptc.Decode(p.InfoBits(), data); err != nil {
+					t.Fatalf("decode failed: %v", err)
+				}
+				lc, err := dmr.ParseFullLCWithMask(data, mask)
+				if err != nil {
+					t.Fatalf("decode lc failed: %v", err)
+				}
+				if lc.DstID != dstID || lc.SrcID != 2042214 {
+					t.Fatalf("unexpected LC %s", lc)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no %s to %d received", dmr.DataTypeName[dataType], dstID)
+			}
+		}
+	}
+
+	// The module is linked after login, and switched at runtime
+	expect(4002)
+	if err := x.SetModule('C'); err != nil {
+		t.Fatalf("set module failed: %v", err)
+	}
+	expect(4003)
+	if err := x.SetModule(0); err != nil {
+		t.Fatalf("unlink failed: %v", err)
+	}
+	expect(4000)
+}